@@ -0,0 +1,186 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkcs12
+
+import (
+	"crypto/rand"
+	"io"
+	"io/fs"
+
+	v2 "github.com/scholar-ink/go-pkcs12/v2"
+)
+
+// EncodeFromFS reads a PEM-encoded private key from keyPath, a PEM-encoded
+// end-entity certificate from certPath, and PEM-encoded CA certificates from
+// every file in fsys matching chainGlob, and encodes them using
+// DefaultEncoder and entropy from crypto/rand.  See Encoder.EncodeFromFS.
+func EncodeFromFS(fsys fs.FS, keyPath, certPath, chainGlob, password string) (pfxData []byte, err error) {
+	return DefaultEncoder.EncodeFromFS(rand.Reader, fsys, keyPath, certPath, chainGlob, password)
+}
+
+// EncodeFromFS reads a PEM-encoded private key from keyPath, a PEM-encoded
+// end-entity certificate from certPath, and PEM-encoded CA certificates from
+// every file in fsys matching chainGlob, and encodes them with enc.Encode.
+//
+// The first certificate in certPath is the end-entity certificate; any
+// further certificates in certPath (as found in "fullchain" files) are
+// treated as CA certificates and precede those matched by chainGlob.  Files
+// matched by chainGlob are read in lexical order.  chainGlob may be empty,
+// in which case only certPath is consulted.
+//
+// The private key may be a PKCS#8 "PRIVATE KEY", a PKCS#1 "RSA PRIVATE KEY",
+// or a SEC 1 "EC PRIVATE KEY" block.  Encrypted PEM keys are not supported;
+// see EncryptedPEMKey.
+func (enc *Encoder) EncodeFromFS(rand io.Reader, fsys fs.FS, keyPath, certPath, chainGlob, password string) (pfxData []byte, err error) {
+	pfxData, err = v2.EncodeFromFS(rand, fsys, keyPath, certPath, chainGlob, password, enc.opts...)
+	return pfxData, unwrap(err)
+}
+
+// Repair recovers as many private keys, certificates and CRLs as possible
+// from a PKCS#12 file which cannot be decoded because of common
+// corruptions:
+//
+//   - data following the PFX, such as padding added by file transfers;
+//   - an outer length which does not match the size of the file;
+//   - a MacData which is truncated or otherwise unreadable, in which case
+//     the integrity of the file is not verified;
+//   - zero padding after a SafeContents;
+//   - individual SafeContents or SafeBags which cannot be decrypted or
+//     parsed, which are skipped.
+//
+// Shrouded and plain key bags, certificate and CRL bags, and the compressed
+// bags of Encoder.WithBagCompression are recovered.  Bags of any other
+// type are skipped, and each one is reported in Errors.
+//
+// Repair returns an error only if the authenticated safe itself cannot be
+// read, or if an intact MAC does not verify with password.  Its results
+// come from a damaged file and should be treated with suspicion; it is
+// intended for forensic and recovery use, not as a lenient Decode.
+func Repair(pfxData []byte, password string, opts *RepairOptions) (*RepairResult, error) {
+	result, err := v2.Repair(pfxData, password, opts)
+	return result, unwrap(err)
+}
+
+// RotateMACOnly replaces the integrity password of pfxData with newPassword.
+// The MAC is verified with oldPassword and then recomputed over the
+// unchanged authenticated safe with newPassword, a fresh salt, and the
+// original digest algorithm and iteration count.  Any fields which follow
+// the iteration count in the MacData are carried over.  The encrypted
+// contents, including shrouded keys, are left byte-for-byte untouched and so
+// remain protected by whatever privacy password they were created with.
+//
+// This is intended for deployments where the privacy and integrity
+// passwords are managed separately.  Note that most software, including
+// Decode, assumes that both passwords are the same.
+//
+// The new salt is drawn from crypto/rand.  See Encoder.RotateMACOnly.
+func RotateMACOnly(pfxData []byte, oldPassword, newPassword string) ([]byte, error) {
+	return DefaultEncoder.RotateMACOnly(rand.Reader, pfxData, oldPassword, newPassword)
+}
+
+// RotateMACOnly is like the package-level RotateMACOnly function, but draws
+// the new salt from rand, or from the fixed stream if enc has fixed
+// randomness.  The digest algorithm and iteration count are still those of
+// the original MAC, not those of enc.
+func (enc *Encoder) RotateMACOnly(rand io.Reader, pfxData []byte, oldPassword, newPassword string) ([]byte, error) {
+	rotated, err := v2.RotateMACOnly(rand, pfxData, oldPassword, newPassword, enc.opts...)
+	return rotated, unwrap(err)
+}
+
+// BindPassword returns a password derived from password and
+// bindingContext, such as a device serial number or a hardware identifier,
+// so that a file encoded with it can only be decoded by a party which knows
+// both: a leaked password alone does not open a file bound to a device.
+// Pass the result as the password to both the encoding and the decoding
+// functions.
+//
+// The derived password is the base64url encoding without padding (RFC
+// 4648, section 5) of HMAC-SHA-256 keyed with the UTF-8 encoding of
+// password, over the bytes of "go-pkcs12 password binding", a zero byte
+// and bindingContext.  It consists of 43 ASCII characters, so other tools
+// can open a bound file given the derived password, which can be computed
+// with, for example:
+//
+//	printf 'go-pkcs12 password binding\0%s' "$CONTEXT" |
+//	    openssl dgst -sha256 -hmac "$PASSWORD" -binary | basenc --base64url | tr -d =
+//
+// The binding is no stronger than the secrecy of bindingContext, which
+// should therefore not be guessable from public information.
+func BindPassword(password string, bindingContext []byte) string {
+	return v2.BindPassword(password, bindingContext)
+}
+
+// ConvertFromBCFKS converts the Bouncy Castle FIPS keystore bcfksData,
+// protected with password, into pfxData protected with the same password,
+// using DefaultEncoder.  See Encoder.ConvertFromBCFKS.
+func ConvertFromBCFKS(rand io.Reader, bcfksData []byte, password string) (pfxData []byte, err error) {
+	return DefaultEncoder.ConvertFromBCFKS(rand, bcfksData, password)
+}
+
+// ConvertFromBCFKS converts the Bouncy Castle FIPS keystore bcfksData,
+// protected with password, into pfxData protected with the same password
+// and the algorithms of enc.  A keystore holding a single private key entry
+// becomes a file like those of Encode, with the entry's alias as the
+// friendlyName; one holding only trusted certificates becomes a trust store
+// like those of EncodeTrustStore.  Other keystores, including those with
+// secret keys, cannot be converted.
+//
+// ConvertFromBCFKS has not been tested with keystores written by Bouncy
+// Castle, so conversions of such keystores should be checked before the
+// original is discarded.
+func (enc *Encoder) ConvertFromBCFKS(rand io.Reader, bcfksData []byte, password string) (pfxData []byte, err error) {
+	pfxData, err = v2.ConvertFromBCFKS(rand, bcfksData, password, enc.opts...)
+	return pfxData, unwrap(err)
+}
+
+// ConvertToBCFKS converts pfxData, protected with password, into a Bouncy
+// Castle FIPS keystore protected with the same password, using
+// DefaultDecoder.  See Decoder.ConvertToBCFKS.
+func ConvertToBCFKS(rand io.Reader, pfxData []byte, password string) (bcfksData []byte, err error) {
+	return DefaultDecoder.ConvertToBCFKS(rand, pfxData, password)
+}
+
+// ConvertToBCFKS converts pfxData, protected with password, into a Bouncy
+// Castle FIPS keystore protected with the same password, with parameters
+// chosen to match Bouncy Castle's defaults.  A file with a private key
+// becomes a keystore with a single private key entry, holding the
+// certificate which matches the key followed by the others; a file without
+// one becomes a keystore of trusted certificates.  Entries are named after
+// the friendlyName of their bags where there is one.
+//
+// The output has only been tested by reading it back with this package;
+// whether Bouncy Castle reads it has not been verified.
+func (dec *Decoder) ConvertToBCFKS(rand io.Reader, pfxData []byte, password string) (bcfksData []byte, err error) {
+	bcfksData, err = v2.ConvertToBCFKS(rand, pfxData, password, dec.opts...)
+	return bcfksData, unwrap(err)
+}
+
+// SealWithKMS envelopes pfxData, typically a password-protected PKCS#12
+// file, under a random AES-256-GCM content key, and returns the envelope
+// together with the content key encrypted by kmsEncrypt, which usually
+// calls the Encrypt operation of a cloud key management service.  The file
+// can then be stored where the password alone does not suffice to read it,
+// and is recovered by OpenWithKMS.  pfxData is not parsed, so any data can
+// be sealed.
+func SealWithKMS(pfxData []byte, kmsEncrypt func([]byte) ([]byte, error)) ([]byte, error) {
+	sealed, err := v2.SealWithKMS(pfxData, kmsEncrypt)
+	return sealed, unwrap(err)
+}
+
+// OpenWithKMS returns the data sealed by SealWithKMS, decrypting the content
+// key with kmsDecrypt, which usually calls the Decrypt operation of the key
+// management service which encrypted it.
+func OpenWithKMS(sealed []byte, kmsDecrypt func([]byte) ([]byte, error)) (pfxData []byte, err error) {
+	pfxData, err = v2.OpenWithKMS(sealed, kmsDecrypt)
+	return pfxData, unwrap(err)
+}
+
+// RepairOptions configures Repair.  The zero value, and a nil
+// *RepairOptions, apply only the repairs that are safe to make
+// automatically.
+type RepairOptions = v2.RepairOptions
+
+// A RepairResult holds what Repair could salvage from a damaged file.
+type RepairResult = v2.RepairResult
@@ -1,23 +1,98 @@
-// Copyright 2015 The Go Authors. All rights reserved.
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
 
 package pkcs12
 
-import "errors"
+import v2 "github.com/scholar-ink/go-pkcs12/v2"
 
 var (
 	// ErrDecryption represents a failure to decrypt the input.
-	ErrDecryption = errors.New("pkcs12: decryption error, incorrect padding")
+	ErrDecryption = v2.ErrDecryption
 
 	// ErrIncorrectPassword is returned when an incorrect password is detected.
 	// Usually, P12/PFX data is signed to be able to verify the password.
-	ErrIncorrectPassword = errors.New("pkcs12: decryption password incorrect")
+	ErrIncorrectPassword = v2.ErrIncorrectPassword
+
+	// ErrLegacyEncodingDisabled is returned when an Encoder would produce
+	// output protected with weak algorithms after DisableLegacyEncoding has
+	// been called.
+	ErrLegacyEncodingDisabled = v2.ErrLegacyEncodingDisabled
+
+	// ErrDuplicateCertificate is returned when a file contains the same
+	// certificate more than once and the Decoder is configured with
+	// RejectDuplicateCertificates.
+	ErrDuplicateCertificate = v2.ErrDuplicateCertificate
+
+	// ErrDuplicateKeyID is returned when a file contains several private
+	// keys with the same localKeyId and the Decoder is configured with
+	// RejectDuplicateKeyIDs, as it is by default.
+	ErrDuplicateKeyID = v2.ErrDuplicateKeyID
+
+	// ErrMissingSignature is returned by a Decoder configured with
+	// WithIntegrityVerifier when a file is not in public-key integrity
+	// mode, so that its signature cannot be verified.
+	ErrMissingSignature = v2.ErrMissingSignature
+
+	// ErrKeyMismatch is returned by an Encoder when the private key is of
+	// the same algorithm, and for ECDSA on the same curve, as the
+	// end-entity certificate's public key, but is not its private key.
+	ErrKeyMismatch = v2.ErrKeyMismatch
+
+	// ErrEmptyContainer is passed to the warning function of a Decoder
+	// configured with WithEmptyContainers when a file contains no SafeBags.
+	ErrEmptyContainer = v2.ErrEmptyContainer
+
+	// ErrEncryptedDataVersion and ErrEncryptedContentType are passed to
+	// the warning function of a Decoder configured with
+	// WithLenientEncryptedData when an EncryptedData has a version other
+	// than 0, or encrypted content which is not labeled as data.
+	ErrEncryptedDataVersion = v2.ErrEncryptedDataVersion
+	ErrEncryptedContentType = v2.ErrEncryptedContentType
 )
 
 // NotImplementedError indicates that the input is not currently supported.
-type NotImplementedError string
+type NotImplementedError = v2.NotImplementedError
+
+// DowngradeError is returned by CheckDowngrade when a PKCS#12 file is
+// protected less strongly than its predecessor.
+type DowngradeError = v2.DowngradeError
+
+// SizeError is returned by an Encoder configured with WithMaxSize when the
+// encoded file would exceed the limit.
+type SizeError = v2.SizeError
+
+// IterationsError is returned by a Decoder when a key derivation in the
+// input uses fewer iterations than the minimum set with WithMinIterations,
+// or no iterations at all.
+type IterationsError = v2.IterationsError
+
+// KeyAlgorithmMismatchError is returned by an Encoder when the private key
+// and the end-entity certificate's public key are of different algorithms,
+// such as an Ed25519 key with an ECDSA certificate.
+type KeyAlgorithmMismatchError = v2.KeyAlgorithmMismatchError
+
+// CurveMismatchError is returned by an Encoder when an ECDSA private key
+// and the end-entity certificate's public key are on different curves.
+type CurveMismatchError = v2.CurveMismatchError
+
+// LeakError is returned by Canary.Scan when the output contains a secret
+// of the canary.
+type LeakError = v2.LeakError
+
+// KeyTypeError is returned by DecodeTyped when the private key of a file
+// is not of the expected type.
+type KeyTypeError = v2.KeyTypeError
+
+// A SizeContribution is the share of an encoded file taken by one of its
+// parts, as reported in a SizeError.
+type SizeContribution = v2.SizeContribution
 
-func (e NotImplementedError) Error() string {
-	return "pkcs12: " + string(e)
+// unwrap returns the error classified by err if it is a version 2 *Error,
+// so that this package returns the same errors as before it became a shim.
+func unwrap(err error) error {
+	if e, ok := err.(*v2.Error); ok {
+		return e.Err
+	}
+	return err
 }
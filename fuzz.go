@@ -0,0 +1,28 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkcs12
+
+import v2 "github.com/scholar-ink/go-pkcs12/v2"
+
+// FuzzDecode runs data through every decoding entry point of this package
+// using password.  It is intended to be called from fuzz targets, including
+// those of downstream packages that want to exercise the package with their
+// own corpora, for example:
+//
+//	func FuzzPKCS12(f *testing.F) {
+//		f.Fuzz(func(t *testing.T, data []byte, password string) {
+//			pkcs12.FuzzDecode(data, password)
+//		})
+//	}
+//
+// Malformed input is expected and simply rejected; FuzzDecode panics only
+// if it detects a bug, such as input that decodes successfully but cannot
+// be re-encoded and decoded again.  Files whose private key does not match
+// their certificate decode, but are deliberately rejected by Encode, and
+// are also treated as malformed.  It returns 1 if data was decoded
+// successfully and 0 otherwise, following the go-fuzz convention.
+func FuzzDecode(data []byte, password string) int {
+	return v2.FuzzDecode(data, password)
+}
@@ -0,0 +1,248 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkcs12
+
+import (
+	"crypto/x509"
+
+	v2 "github.com/scholar-ink/go-pkcs12/v2"
+)
+
+// VerifyIntegrity verifies the integrity of pfxData using DefaultDecoder
+// and reports which mechanisms were checked.  The password-based MAC is
+// verified whenever pfxData has one; a signature is verified only if the
+// Decoder has a verifier certificate, and is then required.
+func VerifyIntegrity(pfxData []byte, password string) (Integrity, error) {
+	return DefaultDecoder.VerifyIntegrity(pfxData, password)
+}
+
+// VerifyIntegrity is like the package-level VerifyIntegrity function, but
+// uses the options of dec.
+func (dec *Decoder) VerifyIntegrity(pfxData []byte, password string) (Integrity, error) {
+	integrity, err := v2.VerifyIntegrity(pfxData, password, dec.opts...)
+	return integrity, unwrap(err)
+}
+
+// InspectProtection verifies pfxData with password using DefaultDecoder
+// and reports how it is protected.
+func InspectProtection(pfxData []byte, password string) (*Protection, error) {
+	return DefaultDecoder.InspectProtection(pfxData, password)
+}
+
+// InspectProtection is like the package-level InspectProtection function,
+// but uses the options of dec.  It fails for files encrypted with a key
+// derivation function registered with RegisterKeyDerivationFunction, whose
+// cost it cannot read.
+func (dec *Decoder) InspectProtection(pfxData []byte, password string) (*Protection, error) {
+	protection, err := v2.InspectProtection(pfxData, password, dec.opts...)
+	return protection, unwrap(err)
+}
+
+// CheckDowngrade compares the protection of a re-issued PKCS#12 file, next,
+// with that of its predecessor, prev, and returns a *DowngradeError if next
+// has a weaker MAC, cipher or PBKDF2 pseudorandom function, fewer
+// iterations of the same key derivation function, or drops encryption that
+// prev had.  It returns nil if next is protected at least as strongly.
+func CheckDowngrade(prev, next *Protection) error {
+	return unwrap(v2.CheckDowngrade(prev, next))
+}
+
+// PeekMAC returns the MacData of pfxData using DefaultDecoder.  See
+// Decoder.PeekMAC.
+func PeekMAC(pfxData []byte) (*MacInfo, error) {
+	return DefaultDecoder.PeekMAC(pfxData)
+}
+
+// PeekMAC returns the MacData of pfxData without verifying it, so that
+// tooling can record how a stored file is protected without knowing its
+// password.  It returns nil and no error if pfxData has no MacData, as in
+// public-key integrity mode.
+func (dec *Decoder) PeekMAC(pfxData []byte) (*MacInfo, error) {
+	mac, err := v2.PeekMAC(pfxData, dec.opts...)
+	return mac, unwrap(err)
+}
+
+// PeekExtensions returns the Extensions of pfxData using DefaultDecoder.
+// See Decoder.PeekExtensions.
+func PeekExtensions(pfxData []byte) ([]Extension, error) {
+	return DefaultDecoder.PeekExtensions(pfxData)
+}
+
+// PeekExtensions returns the Extensions of pfxData, in the order in which
+// they appear, without verifying its integrity, so that they can be
+// examined without the password.  Since nothing is verified, their content
+// must not be trusted.
+func (dec *Decoder) PeekExtensions(pfxData []byte) ([]Extension, error) {
+	extensions, err := v2.PeekExtensions(pfxData, dec.opts...)
+	return extensions, unwrap(err)
+}
+
+// DiagnosePassword reports which encoding of password verifies the MAC of
+// pfxData, using DefaultDecoder.  See Decoder.DiagnosePassword.
+func DiagnosePassword(pfxData []byte, password string) (PasswordEncoding, error) {
+	return DefaultDecoder.DiagnosePassword(pfxData, password)
+}
+
+// DiagnosePassword reports which encoding of password verifies the MAC of
+// pfxData, to explain why a password which works with another tool is
+// rejected here.  The encodings are tried in the order in which they are
+// declared, and ErrIncorrectPassword is returned if none of them verifies
+// the MAC.  Encodings which give the same bytes as an earlier one, such as
+// UTF8AsBMPPassword for an ASCII password, are not reported.
+func (dec *Decoder) DiagnosePassword(pfxData []byte, password string) (PasswordEncoding, error) {
+	encoding, err := v2.DiagnosePassword(pfxData, password, dec.opts...)
+	return encoding, unwrap(err)
+}
+
+// UTF8AsBMPString returns the string whose characters are the bytes of the
+// UTF-8 encoding of password, so that decoding with it reproduces
+// UTF8AsBMPPassword.
+func UTF8AsBMPString(password string) string {
+	return v2.UTF8AsBMPString(password)
+}
+
+// Dump describes the contents of pfxData using DefaultDecoder.  See
+// Decoder.Dump.
+func Dump(pfxData []byte, password string) (*Report, error) {
+	return DefaultDecoder.Dump(pfxData, password)
+}
+
+// Dump verifies the integrity of pfxData and describes each of its SafeBags,
+// decrypting shrouded keys to compute their digests.  No key material is
+// included in the report.  Nested safeContentsBags are reported as single
+// bags, and Extensions are reported without being interpreted.
+func (dec *Decoder) Dump(pfxData []byte, password string) (*Report, error) {
+	report, err := v2.Dump(pfxData, password, dec.opts...)
+	return report, unwrap(err)
+}
+
+// ParseReport unmarshals the JSON encoding of a Report, failing if it was
+// written with a schema other than ReportSchema.  A report without a
+// schema, written before the encoding was versioned, is treated as schema 1.
+func ParseReport(data []byte) (*Report, error) {
+	report, err := v2.ParseReport(data)
+	return report, unwrap(err)
+}
+
+// ProbeCompatibility heuristically reports which common readers are
+// expected to accept pfxData, based on the algorithms and structure it
+// uses.  No password is needed, so the MAC is not verified, and shrouded
+// keys inside encrypted SafeContents are not examined.  The results encode
+// widely reported behavior of default configurations, current as of this
+// package's release, and are no substitute for testing with the actual
+// reader.
+func ProbeCompatibility(pfxData []byte) ([]ReaderCompat, error) {
+	readers, err := v2.ProbeCompatibility(pfxData)
+	return readers, unwrap(err)
+}
+
+// KeyFingerprint returns the fingerprint of privateKey printed by
+//
+//	openssl pkcs8 -topk8 -nocrypt -outform DER | openssl md5
+//
+// that is, the MD5 digest of its unencrypted PKCS#8 encoding, in lower-case
+// hex.  It identifies a key, not a PKCS#12 file: the same key has the same
+// fingerprint whatever the password and algorithms of the file holding it.
+func KeyFingerprint(privateKey interface{}) (string, error) {
+	fingerprint, err := v2.KeyFingerprint(privateKey)
+	return fingerprint, unwrap(err)
+}
+
+// CertificateFingerprint returns the SHA-256 fingerprint of certificate as
+// displayed by "keytool -list", which identifies private key entries by
+// their certificate, and by "openssl x509 -fingerprint -sha256": upper-case
+// hex bytes separated by colons.
+func CertificateFingerprint(certificate *x509.Certificate) string {
+	return v2.CertificateFingerprint(certificate)
+}
+
+// SanitizeAttribute makes an attribute value safe for display.  Control
+// characters, Unicode bidirectional formatting characters, and invalid
+// UTF-8 are replaced with U+FFFD, and the result is truncated to at most
+// maxLength bytes, on a character boundary.  A maxLength of zero or less
+// means no limit.
+func SanitizeAttribute(value string, maxLength int) string {
+	return v2.SanitizeAttribute(value, maxLength)
+}
+
+// Integrity is a set of integrity mechanisms of a PKCS#12 file which were
+// verified, as reported by VerifyIntegrity.
+type Integrity = v2.Integrity
+
+const (
+	// PasswordIntegrity means that the password-based MAC was verified.
+	PasswordIntegrity = v2.PasswordIntegrity
+
+	// PublicKeyIntegrity means that the signature of a file in
+	// public-key integrity mode was verified against the Decoder's
+	// verifier certificate.
+	PublicKeyIntegrity = v2.PublicKeyIntegrity
+)
+
+// Protection summarizes the cryptographic protection of a PKCS#12 file, as
+// reported by InspectProtection.  Where a file uses several encryption
+// algorithms, the weakest is reported, ranked by cipher, then by PBKDF2
+// pseudorandom function, then by iteration count.  For PBES2 with scrypt,
+// the iteration count is the scrypt cost parameter N.
+type Protection = v2.Protection
+
+// MacInfo describes the MacData of a PKCS#12 file, which protects its
+// integrity in password integrity mode.
+type MacInfo = v2.MacInfo
+
+// An Extension is a ContentInfo of the authenticated safe of a PKCS#12 file
+// whose content type is not one of those RFC 7292 uses for SafeContents.
+// Some enterprise exports append such ContentInfos to carry vendor data,
+// such as the DPAPI-NG protection descriptor of a Windows password hint.
+// This package does not interpret them.
+type Extension = v2.Extension
+
+// A PasswordEncoding is a way of turning a password into the bytes from
+// which the keys of a PKCS#12 file are derived, as reported by
+// DiagnosePassword.
+type PasswordEncoding = v2.PasswordEncoding
+
+const (
+	// BMPPassword is the encoding of RFC 7292: UTF-16 (big-endian) with a
+	// zero terminator, as used by OpenSSL and Windows.
+	BMPPassword = v2.BMPPassword
+
+	// EmptyBMPPassword is the empty password encoded as no bytes at all,
+	// instead of a lone terminator.  Some implementations produce it for
+	// the empty password, and Decode accepts it as a fallback.
+	EmptyBMPPassword = v2.EmptyBMPPassword
+
+	// UTF8AsBMPPassword is the UTF-8 encoding of the password with each
+	// byte taken as a character and then encoded as a BMPString, as done
+	// by tools which read the password in Latin-1.  It differs from
+	// BMPPassword only for passwords with non-ASCII characters.  Such
+	// files can be decoded by passing UTF8AsBMPString(password) as the
+	// password.
+	UTF8AsBMPPassword = v2.UTF8AsBMPPassword
+)
+
+// A Report describes the contents of a PKCS#12 file, as returned by Dump.
+// It can be marshaled as JSON for consumption by inventory and audit
+// systems; see ReportSchema for the stability of that encoding.
+type Report = v2.Report
+
+// An ExtensionReport describes an Extension of a PKCS#12 file.
+type ExtensionReport = v2.ExtensionReport
+
+// A BagReport describes one SafeBag of a PKCS#12 file.
+type BagReport = v2.BagReport
+
+// ReportSchema is the version of the JSON encoding of Report and the types
+// it contains, which Dump records in Report.Schema.  The version is only
+// incremented by incompatible changes, such as the removal or reuse of a
+// field; fields may be added without one.  Consumers should therefore
+// ignore fields they do not know, and Report, BagReport and ExtensionReport
+// keep such fields in Unknown when a newer report is unmarshaled, and write
+// them back when it is marshaled again.
+const ReportSchema = v2.ReportSchema
+
+// A ReaderCompat is the expected outcome of reading a PKCS#12 file with one
+// commonly used implementation, as reported by ProbeCompatibility.
+type ReaderCompat = v2.ReaderCompat
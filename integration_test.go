@@ -0,0 +1,87 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkcs12
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCredentialStore(t *testing.T) {
+	key, cert := newTestCertificate(t)
+	pfxData, err := Encode(rand.Reader, key, cert, nil, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "identity.p12")
+	if err := os.WriteFile(path, pfxData, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewCredentialStore(path, "wrong"); err != ErrIncorrectPassword {
+		t.Errorf("got error %v for the wrong password, want ErrIncorrectPassword", err)
+	}
+	store, err := NewCredentialStore(path, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Errors passed to onError are unwrapped too.  The larger iteration
+	// count changes the size of the file, so that Watch reloads it.
+	wrong, err := DefaultEncoder.WithIterations(70000).Encode(rand.Reader, key, cert, nil, "other password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	errs := make(chan error, 1)
+	go store.Watch(ctx, time.Millisecond, func(err error) {
+		select {
+		case errs <- err:
+		default:
+		}
+	})
+	if err := os.WriteFile(path, wrong, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-errs; err != ErrIncorrectPassword {
+		t.Errorf("got error %v from Watch, want ErrIncorrectPassword", err)
+	}
+	if !store.Certificate().Leaf.Equal(cert) {
+		t.Error("a failed reload replaced the active identity")
+	}
+}
+
+func ExampleLoadTLSClientIdentity() {
+	cert, err := LoadTLSClientIdentity("client.p12", "password")
+	if err != nil {
+		panic(err)
+	}
+	config := &tls.Config{Certificates: []tls.Certificate{cert}}
+	_ = config
+}
+
+func ExampleSaveTLSServerIdentity() {
+	cert, err := tls.LoadX509KeyPair("server.crt", "server.key")
+	if err != nil {
+		panic(err)
+	}
+	if err := SaveTLSServerIdentity("server.p12", cert, DefaultPassword); err != nil {
+		panic(err)
+	}
+}
+
+func ExampleLoadTrustBundle() {
+	pool, err := LoadTrustBundle("truststore.p12", DefaultPassword)
+	if err != nil {
+		panic(err)
+	}
+	config := &tls.Config{RootCAs: pool}
+	_ = config
+}
@@ -0,0 +1,190 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkcs12
+
+import (
+	"crypto"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+
+	v2 "github.com/scholar-ink/go-pkcs12/v2"
+)
+
+// DecodeKey extracts the private key from pfxData using DefaultDecoder.
+// See Decoder.DecodeKey.
+func DecodeKey(pfxData []byte, password string) (crypto.PrivateKey, error) {
+	return DefaultDecoder.DecodeKey(pfxData, password)
+}
+
+// DecodeKey extracts the single private key from pfxData, which may be held
+// in a shrouded or a plain key bag.  Certificate bags are skipped without
+// being parsed, so that a malformed or unsupported certificate does not
+// prevent access to the key.
+func (dec *Decoder) DecodeKey(pfxData []byte, password string) (crypto.PrivateKey, error) {
+	privateKey, err := v2.DecodeKey(pfxData, password, dec.opts...)
+	return privateKey, unwrap(err)
+}
+
+// DecodeKeys extracts every private key from pfxData using DefaultDecoder.
+// See Decoder.DecodeKeys.
+func DecodeKeys(pfxData []byte, password string) ([]KeyEntry, error) {
+	return DefaultDecoder.DecodeKeys(pfxData, password)
+}
+
+// DecodeKeys extracts the private keys from pfxData, in the order in which
+// they appear, skipping certificate bags as DecodeKey does.  Keys which
+// share a localKeyId are handled according to dec's KeyIDPolicy.
+func (dec *Decoder) DecodeKeys(pfxData []byte, password string) ([]KeyEntry, error) {
+	keys, err := v2.DecodeKeys(pfxData, password, dec.opts...)
+	return keys, unwrap(err)
+}
+
+// DecodeTyped is like Decode, but returns the private key as a K, such as
+// *ecdsa.PrivateKey or crypto.Signer, and fails with a *KeyTypeError if
+// it is not one.  It uses DefaultDecoder; see DecodeTypedWith.
+func DecodeTyped[K crypto.PrivateKey](pfxData []byte, password string) (K, *x509.Certificate, error) {
+	return DecodeTypedWith[K](DefaultDecoder, pfxData, password)
+}
+
+// DecodeTypedWith is like DecodeTyped, but uses the options of dec.
+func DecodeTypedWith[K crypto.PrivateKey](dec *Decoder, pfxData []byte, password string) (K, *x509.Certificate, error) {
+	if dec == nil {
+		dec = DefaultDecoder
+	}
+	privateKey, certificate, err := v2.DecodeTyped[K](pfxData, password, dec.opts...)
+	return privateKey, certificate, unwrap(err)
+}
+
+// DecodeDualStack extracts the classical and post-quantum identities of
+// pfxData using DefaultDecoder.  See Decoder.DecodeDualStack.
+func DecodeDualStack(pfxData []byte, password string) (classical, postQuantum tls.Certificate, err error) {
+	return DefaultDecoder.DecodeDualStack(pfxData, password)
+}
+
+// DecodeDualStack extracts the classical and post-quantum identities of
+// pfxData, the mirror of EncodeDualStack.  pfxData must contain exactly two
+// private keys, one of them ML-DSA.  Each key is paired with the
+// certificate which has the same LocalKeyId, or failing that with the
+// certificate whose public key matches it, and its chain is built from the
+// certificates which remain.
+func (dec *Decoder) DecodeDualStack(pfxData []byte, password string) (classical, postQuantum tls.Certificate, err error) {
+	classical, postQuantum, err = v2.DecodeDualStack(pfxData, password, dec.opts...)
+	return classical, postQuantum, unwrap(err)
+}
+
+// EncodeDualStack produces pfxData containing two identities for the same
+// subject, one with a classical key and one with a post-quantum key, using
+// DefaultEncoder.  See Encoder.EncodeDualStack.
+func EncodeDualStack(rand io.Reader, classical, postQuantum tls.Certificate, password string) (pfxData []byte, err error) {
+	return DefaultEncoder.EncodeDualStack(rand, classical, postQuantum, password)
+}
+
+// EncodeDualStack produces pfxData containing two identities for the same
+// subject, for servers which offer both a classical and a post-quantum
+// certificate during a migration to hybrid TLS.  postQuantum must have an
+// ML-DSA private key and classical must not; the end-entity certificates
+// of both must have the same subject.
+//
+// Each certificate is linked to its key with its own LocalKeyId, and both
+// identities carry the same friendlyName, the common name of the subject,
+// so that tools which group entries by name show them together.  The two
+// end-entity certificates are stored first, classical first, followed by
+// the CA certificates of both chains without duplicates.
+func (enc *Encoder) EncodeDualStack(rand io.Reader, classical, postQuantum tls.Certificate, password string) (pfxData []byte, err error) {
+	pfxData, err = v2.EncodeDualStack(rand, classical, postQuantum, password, enc.opts...)
+	return pfxData, unwrap(err)
+}
+
+// DecodePKCS11 decodes pfxData with DecodeChainWithCAs and returns the
+// PKCS#11 attribute values for its private key, public key, and
+// certificates.  RSA (two-prime), ECDSA (NIST curves), and Ed25519 keys are
+// supported.
+//
+// The CKA_ID of the private key, public key, and end-entity certificate is
+// the certificate's subject key identifier if present, or else the SHA-1
+// hash of its subject public key.  CA certificates get an ID computed the
+// same way from their own public key.  Labels are the common name of the
+// respective certificate's subject.
+func DecodePKCS11(pfxData []byte, password string) (*PKCS11Objects, error) {
+	return DefaultDecoder.DecodePKCS11(pfxData, password)
+}
+
+// DecodePKCS11 is like the package-level DecodePKCS11 function, but uses the
+// options of dec.
+func (dec *Decoder) DecodePKCS11(pfxData []byte, password string) (*PKCS11Objects, error) {
+	objects, err := v2.DecodePKCS11(pfxData, password, dec.opts...)
+	return objects, unwrap(err)
+}
+
+// A KeyIDPolicy specifies how a Decoder handles private key bags which
+// share a localKeyId, as some buggy exporters produce.  Such a file does
+// not say which key belongs to which certificate.  Key bags without a
+// localKeyId never share one.
+type KeyIDPolicy = v2.KeyIDPolicy
+
+const (
+	// RejectDuplicateKeyIDs fails decoding with ErrDuplicateKeyID.  It
+	// is the default.
+	RejectDuplicateKeyIDs = v2.RejectDuplicateKeyIDs
+
+	// FirstDuplicateKeyID keeps only the first key bag with each
+	// localKeyId.
+	FirstDuplicateKeyID = v2.FirstDuplicateKeyID
+
+	// KeepDuplicateKeyIDs keeps every key bag.  DecodeKeys marks keys
+	// which share a localKeyId as Ambiguous; the functions which return a
+	// single key still require the file to contain exactly one.
+	KeepDuplicateKeyIDs = v2.KeepDuplicateKeyIDs
+)
+
+// A KeyEntry is a private key returned by DecodeKeys.
+type KeyEntry = v2.KeyEntry
+
+const (
+	// Ed448PrivateKeySize is the size of an Ed448 private key in bytes.
+	Ed448PrivateKeySize = v2.Ed448PrivateKeySize
+
+	// X448PrivateKeySize is the size of an X448 private key in bytes.
+	X448PrivateKeySize = v2.X448PrivateKeySize
+)
+
+// An Ed448PrivateKey is the private key string of an Ed448 key, RFC 8032
+// section 5.2.5.  The standard library does not implement Ed448, so this
+// package can store such keys, as produced by OpenSSL, and read them back,
+// but cannot sign with them or compute their public keys.
+type Ed448PrivateKey = v2.Ed448PrivateKey
+
+// An X448PrivateKey is the private key of an X448 key agreement key, RFC
+// 7748 section 5.  Like Ed448PrivateKey, it can be stored and read back,
+// but the standard library cannot use it.
+type X448PrivateKey = v2.X448PrivateKey
+
+// PKCS#11 key types (CKK_*), as used in PKCS11PrivateKey.KeyType.
+const (
+	PKCS11KeyTypeRSA       = v2.PKCS11KeyTypeRSA       // CKK_RSA
+	PKCS11KeyTypeEC        = v2.PKCS11KeyTypeEC        // CKK_EC
+	PKCS11KeyTypeECEdwards = v2.PKCS11KeyTypeECEdwards // CKK_EC_EDWARDS
+)
+
+// PKCS11Objects holds the attribute values needed to create the objects of
+// an identity decoded from a PKCS#12 file on a PKCS#11 token with
+// C_CreateObject.  Every byte slice is encoded exactly as PKCS#11 expects for
+// the attribute named in its comment; big integers are unsigned and
+// big-endian.  All objects share the same CKA_ID, so that tokens and
+// middleware can associate them.
+type PKCS11Objects = v2.PKCS11Objects
+
+// PKCS11PrivateKey holds the attributes of a CKO_PRIVATE_KEY object.
+// Fields which do not apply to KeyType are nil.
+type PKCS11PrivateKey = v2.PKCS11PrivateKey
+
+// PKCS11PublicKey holds the attributes of a CKO_PUBLIC_KEY object.
+// Fields which do not apply to KeyType are nil.
+type PKCS11PublicKey = v2.PKCS11PublicKey
+
+// PKCS11Certificate holds the attributes of a CKO_CERTIFICATE object of type
+// CKC_X_509.
+type PKCS11Certificate = v2.PKCS11Certificate
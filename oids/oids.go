@@ -0,0 +1,68 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package oids names the ASN.1 object identifiers known to package pkcs12:
+// its content and bag types, attributes, and algorithms.  It is used by
+// pkcs12 to describe identifiers in error messages and reports, and lets
+// callers do the same with identifiers found in Protection or MacInfo.
+//
+// It is a shim over the package of the same name in version 2.
+package oids
+
+import (
+	"encoding/asn1"
+
+	"github.com/scholar-ink/go-pkcs12/v2/oids"
+)
+
+// A Kind classifies an object identifier by the role it plays in a PKCS#12
+// file.
+type Kind = oids.Kind
+
+const (
+	ContentType   = oids.ContentType   // a PKCS#7 content type
+	BagType       = oids.BagType       // a SafeBag type, or the type of a certificate in a certBag
+	Attribute     = oids.Attribute     // a bag or signer attribute
+	Encryption    = oids.Encryption    // a password-based encryption scheme or cipher
+	KeyDerivation = oids.KeyDerivation // a key derivation function
+	Digest        = oids.Digest        // a message digest
+	MAC           = oids.MAC           // an HMAC, as used as a PBKDF2 pseudorandom function
+	Signature     = oids.Signature     // a signature algorithm
+	PublicKey     = oids.PublicKey     // a public key algorithm
+	Curve         = oids.Curve         // a named elliptic curve
+	Other         = oids.Other         // anything else
+)
+
+// An Info describes an object identifier.
+type Info = oids.Info
+
+// Lookup returns the description of oid, and whether it is known.
+func Lookup(oid asn1.ObjectIdentifier) (Info, bool) {
+	return oids.Lookup(oid)
+}
+
+// ByName returns the description of the object identifier named name, and
+// whether it is known.  Names are case-sensitive.
+func ByName(name string) (Info, bool) {
+	return oids.ByName(name)
+}
+
+// Name returns the name of oid, or its dotted form if it is not known.
+func Name(oid asn1.ObjectIdentifier) string {
+	return oids.Name(oid)
+}
+
+// Describe returns the name of oid followed by its dotted form in
+// parentheses, such as "pbeWithSHAAnd40BitRC2-CBC (1.2.840.113549.1.12.1.6)",
+// or only the dotted form if it is not known.  It is the form used in the
+// error messages of package pkcs12.
+func Describe(oid asn1.ObjectIdentifier) string {
+	return oids.Describe(oid)
+}
+
+// All returns the descriptions of every known object identifier, sorted by
+// kind and then by name.
+func All() []Info {
+	return oids.All()
+}
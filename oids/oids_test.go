@@ -0,0 +1,27 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oids
+
+import (
+	"encoding/asn1"
+	"testing"
+)
+
+func TestLookup(t *testing.T) {
+	rc2 := asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 1, 6}
+	info, ok := Lookup(rc2)
+	if !ok || info.Name != "pbeWithSHAAnd40BitRC2-CBC" || info.Kind != Encryption {
+		t.Errorf("got %+v, %v", info, ok)
+	}
+	if got, want := Describe(rc2), "pbeWithSHAAnd40BitRC2-CBC (1.2.840.113549.1.12.1.6)"; got != want {
+		t.Errorf("Describe = %q, want %q", got, want)
+	}
+	if byName, ok := ByName(Name(rc2)); !ok || !byName.OID.Equal(rc2) {
+		t.Errorf("ByName returned %+v, %v", byName, ok)
+	}
+	if len(All()) == 0 {
+		t.Error("All returned no identifiers")
+	}
+}
@@ -0,0 +1,502 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkcs12
+
+import (
+	"context"
+	"crypto"
+	"crypto/x509"
+	"encoding/asn1"
+
+	v2 "github.com/scholar-ink/go-pkcs12/v2"
+)
+
+// WithASN1Parser returns a copy of dec which uses parser.
+func (dec Decoder) WithASN1Parser(parser ASN1Parser) *Decoder {
+	return dec.with(v2.WithASN1Parser(parser))
+}
+
+// WithAllowInsecure returns a copy of dec which, if allow is true, decodes
+// files protected with algorithms that are too weak to be trusted and are
+// otherwise rejected, such as the PKCS#5 v1.5 schemes used by some
+// pre-standard tools to shroud keys and the RC4 schemes of very old Windows
+// and Netscape exports.  It also lifts the iteration floor of
+// WithMinIterations.  It is intended for recovering data from archived
+// files, not for routine use.
+func (dec Decoder) WithAllowInsecure(allow bool) *Decoder {
+	return dec.with(v2.WithAllowInsecure(allow))
+}
+
+// WithCertificateAnnotator returns a copy of dec which calls annotate for
+// every certificate decoded by DecodeCertBags, in file order.
+func (dec Decoder) WithCertificateAnnotator(annotate CertificateAnnotator) *Decoder {
+	return dec.with(v2.WithCertificateAnnotator(annotate))
+}
+
+// WithContext returns a copy of dec which abandons key derivations once
+// ctx is done, making the decoding functions return ctx.Err().  ctx is
+// checked periodically during each derivation, so that a long-running
+// decode can be cancelled or given a deadline.
+func (dec Decoder) WithContext(ctx context.Context) *Decoder {
+	return dec.with(v2.WithDecodeContext(ctx))
+}
+
+// WithDuplicateCertificates returns a copy of dec which handles duplicate
+// certificates in DecodeChain and DecodeTrustStore according to policy.
+func (dec Decoder) WithDuplicateCertificates(policy DuplicatePolicy) *Decoder {
+	return dec.with(v2.WithDuplicateCertificates(policy))
+}
+
+// WithDuplicateKeyIDs returns a copy of dec which handles private key bags
+// sharing a localKeyId according to policy.
+func (dec Decoder) WithDuplicateKeyIDs(policy KeyIDPolicy) *Decoder {
+	return dec.with(v2.WithDuplicateKeyIDs(policy))
+}
+
+// WithEmptyContainers returns a copy of dec which accepts PKCS#12 files that
+// are structurally valid but contain no SafeBags at all, as exported by some
+// HSMs.  Decode and DecodeChain then return no key and no certificates
+// instead of an error, and an EncryptedData without any encrypted content is
+// taken to be an empty SafeContents.  If warn is not nil, it is called with
+// ErrEmptyContainer whenever an empty file is decoded.
+//
+// Callers must then be prepared for a nil certificate and private key
+// alongside a nil error.
+func (dec Decoder) WithEmptyContainers(warn func(warning error)) *Decoder {
+	return dec.with(v2.WithEmptyContainers(warn))
+}
+
+// WithExtensions returns a copy of dec which skips Extensions when decoding,
+// calling report with each of them, rather than failing with a
+// NotImplementedError.  report must not be nil.
+func (dec Decoder) WithExtensions(report func(Extension)) *Decoder {
+	return dec.with(v2.WithExtensions(report))
+}
+
+// WithIgnoredKeyBags returns a copy of dec whose DecodeTrustStore skips
+// private key bags rather than failing, since some tools leave an orphaned
+// key in the trust stores they export.  If report is non-nil, it is called
+// for each skipped key bag with the bag's localKeyId, or nil if it has none.
+func (dec Decoder) WithIgnoredKeyBags(report func(localKeyID []byte)) *Decoder {
+	return dec.with(v2.WithIgnoredKeyBags(report))
+}
+
+// WithIntegrityVerifier returns a copy of dec which verifies the signature
+// of files in public-key integrity mode, whose AuthenticatedSafe is signed
+// rather than (or as well as) protected with a MAC, using the public key
+// of verifier.  Files which are not signed are then rejected with
+// ErrMissingSignature, even if their MAC is valid, so that a successful
+// decode always means that the signature was verified.  Without a
+// verifier, signed files can only be decoded if they also carry a
+// password-based MAC, which is then verified instead.
+func (dec Decoder) WithIntegrityVerifier(verifier *x509.Certificate) *Decoder {
+	return dec.with(v2.WithIntegrityVerifier(verifier))
+}
+
+// WithKDF returns a copy of dec which derives its keys with kdf.  See
+// Encoder.WithKDF.
+func (dec Decoder) WithKDF(kdf KDF) *Decoder {
+	return dec.with(v2.WithDecodeKDF(kdf))
+}
+
+// WithLaxCertificates returns a copy of dec which, if lax is true, accepts
+// certificates which crypto/x509 rejects because they repeat an extension
+// or are not DER, such as those of some devices with non-minimal lengths,
+// serial numbers with leading zeros, or BOOLEANs other than 0xFF for true.
+// Such a certificate is parsed from a normalized copy, in which every
+// length, INTEGER and BOOLEAN is re-encoded minimally and only the first
+// of each extension is kept.
+//
+// The Raw and RawTBSCertificate fields of the certificate are nevertheless
+// its original encoding, so that fingerprints and CheckSignatureFrom apply
+// to the certificate as issued.  Its other Raw fields refer to the
+// normalized copy.  Certificates which cannot be normalized still fail to
+// decode with the error of crypto/x509.
+func (dec Decoder) WithLaxCertificates(lax bool) *Decoder {
+	return dec.with(v2.WithLaxCertificates(lax))
+}
+
+// WithLeafInChain returns a copy of dec which, if include is true, returns
+// the leaf certificate from DecodeChainWithCAs as the first element of
+// caCerts as well, for TLS stacks which expect the complete chain in a
+// single slice.
+func (dec Decoder) WithLeafInChain(include bool) *Decoder {
+	return dec.with(v2.WithLeafInChain(include))
+}
+
+// WithLenientEncryptedData returns a copy of dec which accepts EncryptedData
+// SafeContents whose version is not 0, such as the version 2 of CMS, or
+// whose encrypted content is labeled with a content type other than data,
+// as some producers emit although the payload is an ordinary SafeContents.
+// If warn is not nil, it is called with ErrEncryptedDataVersion or
+// ErrEncryptedContentType for each such EncryptedData.
+func (dec Decoder) WithLenientEncryptedData(warn func(warning error)) *Decoder {
+	return dec.with(v2.WithLenientEncryptedData(warn))
+}
+
+// WithLimiter returns a copy of dec which takes the work of its key
+// derivations from limiter, so that a multi-tenant service can give each
+// tenant a Decoder with its own limiter and one tenant's files, however
+// high their iteration counts, cannot monopolize the CPU.  A unit of work
+// is one iteration of the PKCS#12 KDF, PBKDF1 or PBKDF2, or one mixing step
+// of scrypt, as counted by WithProgress; files declaring more work simply
+// wait longer.
+//
+// The work is requested ahead of each block of up to 1024 iterations, so
+// the burst of limiter must be at least 1024.  The context set with
+// WithContext, if any, is passed to WaitN, and an error from WaitN
+// abandons the decode and is returned.
+func (dec Decoder) WithLimiter(limiter Limiter) *Decoder {
+	return dec.with(v2.WithLimiter(limiter))
+}
+
+// WithMaxDecompressedSize returns a copy of dec which fails to decode a
+// file whose compressed bags, such as those written by an Encoder
+// configured with WithBagCompression, expand to more than limit bytes in
+// total.  The default limit, restored by a limit of 0, is 4 MiB.
+func (dec Decoder) WithMaxDecompressedSize(limit int) *Decoder {
+	return dec.with(v2.WithMaxDecompressedSize(limit))
+}
+
+// WithMaxScryptMemory returns a copy of dec which fails to decode a file
+// whose scrypt parameters need more than limit bytes of memory, 128 * r *
+// N, before deriving any key, so that untrusted files cannot make decoding
+// allocate large amounts of memory.  The default limit, restored by a
+// limit of 0, is 32 MiB.  Limits above 1 GiB have no effect, since scrypt
+// parameters needing more are always rejected.
+func (dec Decoder) WithMaxScryptMemory(limit int) *Decoder {
+	return dec.with(v2.WithMaxScryptMemory(limit))
+}
+
+// WithMinIterations returns a copy of dec which rejects files whose MAC,
+// content encryption or key encryption derives its key with fewer than
+// min iterations of the PKCS#12 KDF, PBKDF2 or PKCS#5 v1.5 PBKDF1, with an
+// *IterationsError.  This enforces an organizational floor on inbound
+// credentials, such as the 10,000 iterations of OpenSSL 3.  Keys derived
+// with scrypt are not subject to the floor, whose cost is set by memory
+// rather than by iterations.
+//
+// Even without this option, a count of zero iterations is rejected.
+// WithAllowInsecure disables both checks.
+func (dec Decoder) WithMinIterations(min int) *Decoder {
+	return dec.with(v2.WithMinIterations(min))
+}
+
+// WithMissingMAC returns a copy of dec which, if allow is true, decodes
+// files in password integrity mode which have no MAC at all, such as those
+// produced by MinimalRouter and by the routers it emulates.  The integrity
+// of such files is not verified, and VerifyIntegrity reports that nothing
+// was checked.  A MAC which is present is still verified.
+func (dec Decoder) WithMissingMAC(allow bool) *Decoder {
+	return dec.with(v2.WithMissingMAC(allow))
+}
+
+// WithProgress returns a copy of dec which calls report as key derivations
+// and SafeBags are processed, so that interactive programs can show that
+// a decode with a high iteration count is not hung.  report is called on
+// the decoding goroutine, at most about a hundred times per key derivation.
+func (dec Decoder) WithProgress(report func(Progress)) *Decoder {
+	return dec.with(v2.WithDecodeProgress(report))
+}
+
+// WithSanitizedAttributes returns a copy of dec which passes the bag
+// attribute values exposed by ToPEM, such as friendlyName, through
+// SanitizeAttribute with the given maxLength.  Attributes in PKCS#12 files
+// from untrusted sources may contain control characters or be arbitrarily
+// long, which is a hazard for UIs and logs that display them.  The
+// unsanitized values remain available from a Decoder without this option.
+func (dec Decoder) WithSanitizedAttributes(maxLength int) *Decoder {
+	return dec.with(v2.WithSanitizedAttributes(maxLength))
+}
+
+// WithSecp256k1 returns a copy of dec which, if enabled is true, decodes
+// ECDSA keys on secp256k1, and certificates whose public key is on it, as
+// described for Secp256k1.  Otherwise they fail to decode with the error
+// of crypto/x509, which does not support the curve.
+//
+// The keys are ordinary *ecdsa.PrivateKey values, but signing with them
+// through crypto/ecdsa is not constant-time, and leaks information about
+// the private key to anyone who can time it.  Convert them to the key type
+// of a constant-time secp256k1 implementation before signing.
+func (dec Decoder) WithSecp256k1(enabled bool) *Decoder {
+	return dec.with(v2.WithSecp256k1(enabled))
+}
+
+// WithTrailingZeroPadding returns a copy of dec which, if allow is true,
+// ignores zero bytes following the SafeBag sequence of a SafeContents, as
+// emitted by some generators.  Trailing data which is not all zeros is
+// still rejected.
+func (dec Decoder) WithTrailingZeroPadding(allow bool) *Decoder {
+	return dec.with(v2.WithTrailingZeroPadding(allow))
+}
+
+// WithYieldInterval returns a copy of dec which calls runtime.Gosched
+// after every iterations iterations of each key derivation, so that a
+// decode with a high iteration count does not starve other goroutines on
+// single-core devices.  An interval of zero or less, the default, never
+// yields.
+func (dec Decoder) WithYieldInterval(iterations int) *Decoder {
+	return dec.with(v2.WithDecodeYieldInterval(iterations))
+}
+
+// WithAESKeySize returns a copy of enc whose PBES2 algorithms use AES-CBC
+// with keys of the given size in bits, which must be 128, 192 or 256, the
+// default.  Some releases of Java keytool write and expect AES-128.  It
+// has no effect on the legacy PKCS#12 algorithms, so it is meant to be used
+// with Modern.
+func (enc Encoder) WithAESKeySize(bits int) *Encoder {
+	return enc.with(v2.WithAESKeySize(bits))
+}
+
+// WithAutomaticFriendlyName returns a copy of enc which gives the private
+// key bag and the end-entity certificate bag a friendlyName taken from the
+// certificate, as OpenSSL and the Windows certificate export wizard
+// effectively do: the first DNS name of its Subject Alternative Name
+// extension, or, if it has none, the common name of its subject.  No
+// friendlyName is added if the certificate has neither, or if the
+// encoding method already sets one, as EncodeTLSCertificate does when
+// its options carry a FriendlyName.
+func (enc Encoder) WithAutomaticFriendlyName(enabled bool) *Encoder {
+	return enc.with(v2.WithAutomaticFriendlyName(enabled))
+}
+
+// WithBagCompression returns a copy of enc whose trust store encoding
+// methods compress with zlib each certificate and CRL bag whose value is
+// at least threshold bytes long, if that makes it shorter, to reduce the
+// size of large bundles sent to devices with little bandwidth.  The
+// compressed bags keep their attributes, but use a bag type which only
+// this package understands; other implementations ignore or reject them.
+// A threshold of 0 disables compression.
+func (enc Encoder) WithBagCompression(threshold int) *Encoder {
+	return enc.with(v2.WithBagCompression(threshold))
+}
+
+// WithCamellia returns a copy of enc whose PBES2 algorithms use
+// Camellia-CBC with keys of the given size in bits, which must be 128, 192
+// or 256, instead of AES-CBC, as some Japanese government CA tooling does.
+// Like WithAESKeySize, it is meant to be used with Modern.  Camellia is
+// read by OpenSSL, but not by Windows or by the providers of the JDK.
+func (enc Encoder) WithCamellia(bits int) *Encoder {
+	return enc.with(v2.WithCamellia(bits))
+}
+
+// WithChaCha20Poly1305 returns a copy of enc whose PBES2 algorithms use
+// ChaCha20-Poly1305, under the object identifier which RFC 8103 assigns it
+// in CMS, instead of AES-CBC or Camellia-CBC, if enabled is true.  It is
+// faster than AES in software, on platforms without AES instructions.
+// The scheme is experimental: no other PKCS#12 implementation reads it, so
+// it is only suitable for files which never leave applications built with
+// this package.  Like WithAESKeySize, it is meant to be used with Modern.
+func (enc Encoder) WithChaCha20Poly1305(enabled bool) *Encoder {
+	return enc.with(v2.WithChaCha20Poly1305(enabled))
+}
+
+// WithCompatibilityLevel returns a copy of enc which uses the defaults
+// that this package considers appropriate as of the given year, allowing
+// consumers to test their readers against upcoming default changes before
+// they take effect.  The levels are:
+//
+//   - before 2024: HMAC-SHA-1 MAC, as produced by DefaultEncoder today.
+//   - 2024 and later: HMAC-SHA-256 MAC, the default of OpenSSL 3.
+//
+// Only the parameters named above are affected; the encryption algorithms
+// of enc are retained.
+func (enc Encoder) WithCompatibilityLevel(year int) *Encoder {
+	return enc.with(v2.WithCompatibilityLevel(year))
+}
+
+// WithContext returns a copy of enc which abandons key derivations once
+// ctx is done, making the encoding functions return ctx.Err().  See
+// Decoder.WithContext.
+func (enc Encoder) WithContext(ctx context.Context) *Encoder {
+	return enc.with(v2.WithEncodeContext(ctx))
+}
+
+// WithFixedRandomness returns a copy of enc which ignores the rand argument
+// of its encoding methods and draws every salt from a stream determined by
+// seed alone, so that encoding the same input twice yields identical
+// output.  It exists for known-answer tests in validation labs, which need
+// full control over the generated values, and must never be used to
+// produce files which protect real keys: anyone who knows seed knows every
+// salt.  A nil seed restores the use of rand.
+//
+// The stream is the concatenation of SHA-256(seed || counter) for counter
+// = 0, 1, 2, ..., each counter encoded as a 64-bit big-endian integer, and
+// starts afresh for each call.  Salts are drawn from it in the order in
+// which the file is assembled: the shrouded key, then the certificates,
+// then the MAC.
+func (enc Encoder) WithFixedRandomness(seed []byte) *Encoder {
+	return enc.with(v2.WithFixedRandomness(seed))
+}
+
+// WithIterations returns a copy of enc which encrypts the certificates and
+// the private key with the given iteration count of the key derivation,
+// such as the 600,000 that OWASP recommends for PBKDF2-HMAC-SHA-256, or a
+// low count to speed up tests.  It applies to PBES2 with PBKDF2 and to the
+// legacy PKCS#12 algorithms alike, but not to the MAC, whose count is set
+// with WithMAC, nor to scrypt.  An iteration count below 1 is treated as 1.
+func (enc Encoder) WithIterations(iterations int) *Encoder {
+	return enc.with(v2.WithIterations(iterations))
+}
+
+// WithKDF returns a copy of enc which derives its keys with kdf.  It
+// replaces the PKCS#12 key derivation function, used by the MAC and the
+// PKCS#12 encryption algorithms, and PBKDF2, used by PBES2; other key
+// derivation functions, such as scrypt, PBKDF1 and that of the GOST MAC,
+// are unaffected.  The file records the usual algorithms, salts and
+// iteration counts, but it can only be decoded by a Decoder with the same
+// KDF.  A nil kdf restores the built-in functions.
+func (enc Encoder) WithKDF(kdf KDF) *Encoder {
+	return enc.with(v2.WithEncodeKDF(kdf))
+}
+
+// WithKeyDerivationFunction returns a copy of enc whose PBES2 algorithms
+// derive their keys with the KeyDerivationFunction registered for oid,
+// rather than with PBKDF2 or scrypt.  Encoding fails with a
+// NotImplementedError if none is registered.  The iteration count of enc
+// then has no effect on PBES2; the parameters are chosen by the
+// KeyDerivationFunction.  Like WithScrypt, it is meant to be used with
+// Modern.
+func (enc Encoder) WithKeyDerivationFunction(oid asn1.ObjectIdentifier) *Encoder {
+	return enc.with(v2.WithKeyDerivationFunction(oid))
+}
+
+// WithMAC returns a copy of enc which authenticates the file with HMAC
+// using digest, keyed by the PKCS#12 key derivation with the given
+// iteration count, to meet policies such as 100,000 iterations with
+// SHA-256.  digest must be one of crypto.SHA1, crypto.SHA224,
+// crypto.SHA256, crypto.SHA384, crypto.SHA512, crypto.SHA512_224 and
+// crypto.SHA512_256; encoding with any other fails with a
+// NotImplementedError.  An iteration count below 1 is treated as 1.
+func (enc Encoder) WithMAC(digest crypto.Hash, iterations int) *Encoder {
+	return enc.with(v2.WithMAC(digest, iterations))
+}
+
+// WithMaxSize returns a copy of enc whose encoding methods fail with a
+// *SizeError, rather than returning the file, if it would be longer than
+// limit bytes, as required by a database column or a device's key slot.
+// The error lists the parts of the file by size, so that the caller can
+// tell which certificates to leave out.  A limit of 0 removes the
+// restriction.
+func (enc Encoder) WithMaxSize(limit int) *Encoder {
+	return enc.with(v2.WithMaxSize(limit))
+}
+
+// WithPBEScheme returns a copy of enc whose PBES2 algorithms encrypt with
+// the PBEScheme registered for oid, rather than with AES-CBC.  Encoding
+// fails with a NotImplementedError if none is registered.  Like
+// WithAESKeySize, it is meant to be used with Modern.
+func (enc Encoder) WithPBEScheme(oid asn1.ObjectIdentifier) *Encoder {
+	return enc.with(v2.WithPBEScheme(oid))
+}
+
+// WithProgress returns a copy of enc which calls report as key derivations
+// are processed.  See Decoder.WithProgress.
+func (enc Encoder) WithProgress(report func(Progress)) *Encoder {
+	return enc.with(v2.WithEncodeProgress(report))
+}
+
+// WithSaltLength returns a copy of enc which generates salts of length
+// bytes, such as the 16 or 32 that some compliance profiles require, for
+// both the encryption of the certificates and the private key and the MAC.
+// The defaults are 8 bytes for the MAC and the PKCS#12 algorithms, and 16
+// for PBES2.  PBES1 salts are always 8 bytes, as RFC 8018 requires, and a
+// registered KeyDerivationFunction chooses its own salt.  A length below 1
+// restores the defaults.
+func (enc Encoder) WithSaltLength(length int) *Encoder {
+	return enc.with(v2.WithSaltLength(length))
+}
+
+// WithScrypt returns a copy of enc whose PBES2 algorithms derive their keys
+// with scrypt (RFC 7914), using CPU/memory cost n, block size r and
+// parallelization p, rather than with PBKDF2.  n must be a power of two
+// greater than 1; RFC 7914 suggests n = 16384, r = 8 and p = 1 for
+// interactive use, which takes 16 MiB of memory.  Parameters needing more
+// than 1 GiB, 128 * r * n bytes, or mixing more than 4 GiB, 128 * r * n * p
+// bytes, are rejected when encoding and decoding alike, and a Decoder
+// rejects files needing more than 32 MiB unless configured with
+// WithMaxScryptMemory.  The iteration count of enc then has no effect on
+// PBES2.
+//
+// Only enc's PBES2 algorithms are affected, so WithScrypt is meant to be
+// used with Modern.  Not every reader of PKCS#12 files supports scrypt.
+func (enc Encoder) WithScrypt(n, r, p int) *Encoder {
+	return enc.with(v2.WithScrypt(n, r, p))
+}
+
+// WithYieldInterval returns a copy of enc which yields during key
+// derivations.  See Decoder.WithYieldInterval.
+func (enc Encoder) WithYieldInterval(iterations int) *Encoder {
+	return enc.with(v2.WithEncodeYieldInterval(iterations))
+}
+
+// An ASN1Parser selects the ASN.1 implementation which a Decoder uses for
+// the outer structure of PKCS#12 files: the PFX, the AuthenticatedSafe and
+// the SafeContents.  The contents of individual bags are always parsed
+// with encoding/asn1.
+type ASN1Parser = v2.ASN1Parser
+
+const (
+	// ReflectParser parses with encoding/asn1.  It is the default.
+	ReflectParser = v2.ReflectParser
+
+	// StreamParser parses with a non-reflective DER reader modeled on
+	// golang.org/x/crypto/cryptobyte.  It is faster and allocates
+	// less, which matters to services decoding many files, and its
+	// syntax errors give the byte offset at which parsing failed.  It
+	// is intended to accept exactly the inputs that ReflectParser
+	// accepts, and to produce the same result.
+	StreamParser = v2.StreamParser
+)
+
+// A KDFPurpose identifies what the key material returned by a KDF is used
+// for.  Its values are the ID bytes of the PKCS#12 key derivation function
+// (RFC 7292, appendix B.3).
+type KDFPurpose = v2.KDFPurpose
+
+const (
+	// EncryptionKeyPurpose is the key of an encryption algorithm: a
+	// PKCS#12 algorithm or the encryption scheme of PBES2.
+	EncryptionKeyPurpose = v2.EncryptionKeyPurpose
+
+	// IVPurpose is the IV of a PKCS#12 encryption algorithm.
+	IVPurpose = v2.IVPurpose
+
+	// MACKeyPurpose is the key of the HMAC which authenticates the file.
+	MACKeyPurpose = v2.MACKeyPurpose
+)
+
+// A KDF derives the keys of an Encoder or Decoder configured with
+// WithKDF, in place of the key derivation functions of the file, so that
+// an organization can route key derivation through an HSM or KMS which
+// combines a secret it holds with the password.  A KDF is given the salt
+// and iteration count recorded in the file but not the password, which an
+// implementation that needs it must obtain itself, for instance when it is
+// constructed.  Its implementations must be safe for concurrent use.
+type KDF = v2.KDF
+
+// A Limiter rations the key derivation work of a Decoder configured with
+// WithLimiter.  WaitN blocks until n units of work may be performed, or
+// returns an error if they never can be.  *rate.Limiter of
+// golang.org/x/time/rate implements Limiter.
+type Limiter = v2.Limiter
+
+// A ProgressStage identifies what a Progress report counts.
+type ProgressStage = v2.ProgressStage
+
+const (
+	// KeyDerivationStage counts the iterations of a single key
+	// derivation.  Decoding or encoding a file involves several key
+	// derivations, for the MAC and for each encrypted SafeContents and
+	// shrouded key, and each is reported from zero to completion.
+	KeyDerivationStage = v2.KeyDerivationStage
+
+	// BagStage counts the SafeBags processed by a decoding operation.
+	BagStage = v2.BagStage
+)
+
+// A Progress reports how far a long-running operation has got, to the
+// callback configured with Decoder.WithProgress or Encoder.WithProgress.
+type Progress = v2.Progress
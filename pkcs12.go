@@ -1,5 +1,4 @@
 // Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
-// Copyright 2015 The Go Authors. All rights reserved.
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
 
@@ -9,373 +8,211 @@
 // do not support newer formats.  Since PKCS#12 uses weak encryption
 // primitives, it SHOULD NOT be used for new applications.
 //
+// This package is version 1 of github.com/scholar-ink/go-pkcs12, and is a
+// shim over version 2, github.com/scholar-ink/go-pkcs12/v2.  A Decoder or
+// Encoder is a list of version 2 options, each function calls its version 2
+// equivalent, and errors are returned as they were before version 2
+// existed, so they can still be compared with ==.
+//
 // This package is forked from golang.org/x/crypto/pkcs12, which is frozen.
 // The implementation is distilled from https://tools.ietf.org/html/rfc7292
 // and referenced documents.
 package pkcs12 // import "github.com/scholar-ink/go-pkcs12"
 
 import (
-	"crypto/ecdsa"
-	"crypto/rsa"
-	"crypto/sha1"
 	"crypto/x509"
-	"crypto/x509/pkix"
-	"encoding/asn1"
-	"encoding/hex"
 	"encoding/pem"
-	"errors"
 	"io"
+
+	v2 "github.com/scholar-ink/go-pkcs12/v2"
 )
 
 // DefaultPassword is the string "changeit", a commonly-used password for
 // PKCS#12 files. Due to the weak encryption used by PKCS#12, it is
 // RECOMMENDED that you use DefaultPassword when encoding PKCS#12 files,
 // and protect the PKCS#12 files using other means.
-const DefaultPassword = "changeit"
-
-var (
-	oidDataContentType          = asn1.ObjectIdentifier([]int{1, 2, 840, 113549, 1, 7, 1})
-	oidEncryptedDataContentType = asn1.ObjectIdentifier([]int{1, 2, 840, 113549, 1, 7, 6})
+const DefaultPassword = v2.DefaultPassword
 
-	oidFriendlyName     = asn1.ObjectIdentifier([]int{1, 2, 840, 113549, 1, 9, 20})
-	oidLocalKeyID       = asn1.ObjectIdentifier([]int{1, 2, 840, 113549, 1, 9, 21})
-	oidMicrosoftCSPName = asn1.ObjectIdentifier([]int{1, 3, 6, 1, 4, 1, 311, 17, 1})
-)
-
-type pfxPdu struct {
-	Version  int
-	AuthSafe contentInfo
-	MacData  macData `asn1:"optional"`
-}
-
-type contentInfo struct {
-	ContentType asn1.ObjectIdentifier
-	Content     asn1.RawValue `asn1:"tag:0,explicit,optional"`
+// A Decoder contains options for decoding PKCS#12 files.  The zero value
+// decodes strictly, rejecting anything that does not conform to RFC 7292.
+// Decoders are configured with methods that return a modified copy, so a
+// Decoder can be shared freely once created.
+//
+// A Decoder is never modified after it has been returned by one of those
+// methods, and is safe for concurrent use by multiple goroutines, for
+// instance as a package-level variable of a service.  Callback functions
+// passed to a Decoder, such as the warning function of
+// WithEmptyContainers, are called from the goroutine doing the decoding
+// and must themselves be safe for concurrent use if the Decoder is shared.
+type Decoder struct {
+	// opts are applied in order by each method.  The With methods append
+	// to a copy which never shares its backing array with the receiver.
+	opts []v2.DecodeOption
 }
 
-type encryptedData struct {
-	Version              int
-	EncryptedContentInfo encryptedContentInfo
+// with returns a copy of dec which also applies opt.
+func (dec Decoder) with(opt v2.DecodeOption) *Decoder {
+	dec.opts = append(dec.opts[:len(dec.opts):len(dec.opts)], opt)
+	return &dec
 }
 
-type encryptedContentInfo struct {
-	ContentType                asn1.ObjectIdentifier
-	ContentEncryptionAlgorithm pkix.AlgorithmIdentifier
-	EncryptedContent           []byte `asn1:"tag:0,optional"`
-}
+// DefaultDecoder is the Decoder used by the package-level decoding
+// functions.  It decodes strictly.
+var DefaultDecoder = new(Decoder)
 
-func (i encryptedContentInfo) Algorithm() pkix.AlgorithmIdentifier {
-	return i.ContentEncryptionAlgorithm
+// An Encoder contains methods for encoding PKCS#12 files.  This package
+// defines several different Encoders with different parameters.
+//
+// Like a Decoder, an Encoder is configured with methods that return a
+// modified copy, is never modified afterwards, and is safe for concurrent
+// use by multiple goroutines.  The rand argument of its methods must be
+// safe for concurrent use if it is shared; crypto/rand.Reader is, and is
+// used when rand is nil.
+type Encoder struct {
+	// As in Decoder, opts are applied in order by each method, starting
+	// from the Modern profile of version 2.
+	opts []v2.EncodeOption
 }
 
-func (i encryptedContentInfo) Data() []byte { return i.EncryptedContent }
-
-func (i *encryptedContentInfo) SetData(data []byte) { i.EncryptedContent = data }
-
-type safeBag struct {
-	Id         asn1.ObjectIdentifier
-	Value      asn1.RawValue     `asn1:"tag:0,explicit"`
-	Attributes []pkcs12Attribute `asn1:"set,optional"`
+// with returns a copy of enc which also applies opt.
+func (enc Encoder) with(opt v2.EncodeOption) *Encoder {
+	enc.opts = append(enc.opts[:len(enc.opts):len(enc.opts)], opt)
+	return &enc
 }
 
-type pkcs12Attribute struct {
-	Id    asn1.ObjectIdentifier
-	Value asn1.RawValue `asn1:"set"`
+// DefaultEncoder encrypts both the certificates and the private key with
+// SHA-1 and 3-key Triple DES, and authenticates the file with HMAC-SHA-1.
+// It is the Encoder used by Encode.
+//
+// The defaults of DefaultEncoder will change in the next major release of
+// this package; use WithCompatibilityLevel to opt into them early.
+var DefaultEncoder = &Encoder{opts: []v2.EncodeOption{v2.WithProfile(v2.Compatible)}}
+
+// Legacy emulates the behavior of OpenSSL's PKCS12_create and of earlier
+// versions of this package: the certificates are encrypted with 40-bit RC2,
+// which is trivially breakable, and the private key with 3-key Triple DES.
+// Only use Legacy when the output must be read by software which cannot
+// decrypt anything else.  Legacy refuses to encode after
+// DisableLegacyEncoding has been called.
+var Legacy = &Encoder{opts: []v2.EncodeOption{v2.WithProfile(v2.Legacy)}}
+
+// OpenSSL111 reproduces the structure of the files written by the
+// "openssl pkcs12 -export" command of OpenSSL 1.1.1, and of OpenSSL 3 with
+// the -legacy flag: the algorithms of Legacy with 2048 iterations for the
+// MAC as well as the encryption, an explicit NULL parameter in the MAC
+// digest algorithm, and no empty attribute sets on the CA certificate bags.
+// Apart from the salts and the ciphertexts which depend on them, its output
+// is identical to OpenSSL's for the same key, certificates and
+// friendlyName, so the two can be diffed during interoperability
+// certification.  Like Legacy, it refuses to encode after
+// DisableLegacyEncoding has been called.
+var OpenSSL111 = &Encoder{opts: []v2.EncodeOption{v2.WithProfile(v2.OpenSSL111)}}
+
+// Modern encrypts both the certificates and the private key with PBES2,
+// using PBKDF2 with HMAC-SHA-256 and AES-256-CBC, and authenticates the file
+// with HMAC-SHA-256, as OpenSSL 3 does by default.  Its output is read by
+// OpenSSL 1.1.1 and later, Windows 10 1709 and later and JDK 8u301 and
+// later, but not by older software; use ProbeCompatibility to check.
+var Modern = &Encoder{opts: []v2.EncodeOption{v2.WithProfile(v2.Modern)}}
+
+// MinimalRouter produces the minimal layout exported by some embedded
+// routers, such as MikroTik RouterOS, which is also the layout they most
+// reliably import: a single unencrypted SafeContents holding a plain
+// keyBag followed by the certificate bags, and no MAC.  The LocalKeyId and
+// friendlyName attributes are set as by Modern.
+//
+// Nothing in its output is protected, so MinimalRouter only accepts the
+// empty password, and its output must be kept confidential by other means.
+// Files in this layout are read by a Decoder configured with
+// WithMissingMAC.
+var MinimalRouter = &Encoder{opts: []v2.EncodeOption{v2.WithProfile(v2.MinimalRouter)}}
+
+// Decode extracts a certificate and private key from pfxData using
+// DefaultDecoder. This function assumes that there is only one certificate
+// and only one private key in the pfxData.  Since PKCS#12 files often contain
+// more than one certificate, you probably want to use DecodeChain instead.
+func Decode(pfxData []byte, password string) (privateKey interface{}, certificate *x509.Certificate, err error) {
+	return DefaultDecoder.Decode(pfxData, password)
 }
 
-type encryptedPrivateKeyInfo struct {
-	AlgorithmIdentifier pkix.AlgorithmIdentifier
-	EncryptedData       []byte
+// Decode is like the package-level Decode function, but uses the options of
+// dec.
+func (dec *Decoder) Decode(pfxData []byte, password string) (privateKey interface{}, certificate *x509.Certificate, err error) {
+	return dec.DecodeChain(pfxData, password)
 }
 
-func (i encryptedPrivateKeyInfo) Algorithm() pkix.AlgorithmIdentifier {
-	return i.AlgorithmIdentifier
+// DecodeChain extracts a certificate, a CA certificate chain, and private key
+// from pfxData using DefaultDecoder. This function assumes that there is at
+// least one certificate and only one private key in the pfxData.  The first
+// certificate is assumed to be the leaf certificate, and subsequent
+// certificates, if any, are assumed to comprise the CA certificate chain.
+// Use DecodeChainWithCAs to obtain the CA certificates as well.
+//
+// The private key is a *rsa.PrivateKey, *ecdsa.PrivateKey,
+// ed25519.PrivateKey, *mldsa.PrivateKey, Ed448PrivateKey or X448PrivateKey,
+// or an *ecdh.PrivateKey for X25519 key agreement keys.  Encode accepts the
+// same types.  ECDSA keys, and the public keys of certificates, may also be
+// on the brainpoolP256r1, brainpoolP384r1 and brainpoolP512r1 curves of
+// RFC 5639, which crypto/x509 does not support, or on secp256k1 if the
+// Decoder is configured with WithSecp256k1.
+//
+// Unlike the curves of crypto/elliptic, this package's implementations of
+// the Brainpool curves and of secp256k1 are not constant-time: signing with
+// a Brainpool or secp256k1 key returned by DecodeChain, or any other use of
+// its Curve, takes time which depends on the private key.  Such keys are
+// meant to be handed to a constant-time implementation, such as an HSM,
+// rather than used where timing can be observed.
+//
+// Certificates are never re-encoded: the Raw field of each returned
+// certificate is exactly the DER embedded in pfxData, so signatures and
+// fingerprints computed over it match those of the original.
+func DecodeChain(pfxData []byte, password string) (privateKey interface{}, certificate *x509.Certificate, err error) {
+	return DefaultDecoder.DecodeChain(pfxData, password)
 }
 
-func (i encryptedPrivateKeyInfo) Data() []byte {
-	return i.EncryptedData
+// DecodeChain is like the package-level DecodeChain function, but uses the
+// options of dec.
+func (dec *Decoder) DecodeChain(pfxData []byte, password string) (privateKey interface{}, certificate *x509.Certificate, err error) {
+	privateKey, certificate, _, err = dec.DecodeChainWithCAs(pfxData, password)
+	return
 }
 
-func (i *encryptedPrivateKeyInfo) SetData(data []byte) {
-	i.EncryptedData = data
+// DecodeChainWithCAs is like DecodeChain, but also returns the CA
+// certificate chain in caCerts, in the order in which it appears in
+// pfxData, using DefaultDecoder.  The leaf certificate is not included in
+// caCerts unless the Decoder is configured with WithLeafInChain.
+func DecodeChainWithCAs(pfxData []byte, password string) (privateKey interface{}, certificate *x509.Certificate, caCerts []*x509.Certificate, err error) {
+	return DefaultDecoder.DecodeChainWithCAs(pfxData, password)
 }
 
-// PEM block types
-const (
-	certificateType = "CERTIFICATE"
-	privateKeyType  = "PRIVATE KEY"
-)
-
-// unmarshal calls asn1.Unmarshal, but also returns an error if there is any
-// trailing data after unmarshaling.
-func unmarshal(in []byte, out interface{}) error {
-	trailing, err := asn1.Unmarshal(in, out)
-	if err != nil {
-		return err
-	}
-	if len(trailing) != 0 {
-		return errors.New("pkcs12: trailing data found")
-	}
-	return nil
+// DecodeChainWithCAs is like the package-level DecodeChainWithCAs
+// function, but uses the options of dec.
+func (dec *Decoder) DecodeChainWithCAs(pfxData []byte, password string) (privateKey interface{}, certificate *x509.Certificate, caCerts []*x509.Certificate, err error) {
+	privateKey, certificate, caCerts, err = v2.Decode(pfxData, password, dec.opts...)
+	return privateKey, certificate, caCerts, unwrap(err)
 }
 
-// ToPEM converts all "safe bags" contained in pfxData to PEM blocks.
+// ToPEM converts all "safe bags" contained in pfxData to PEM blocks using
+// DefaultDecoder.
 // DO NOT USE THIS FUNCTION. ToPEM creates invalid PEM blocks; private keys
-// are encoded as raw RSA or EC private keys rather than PKCS#8 despite being
-// labeled "PRIVATE KEY".  To decode a PKCS#12 file, use DecodeChain instead,
-// and use the encoding/pem package to convert to PEM if necessary.
+// other than Ed25519, X25519, Ed448 and X448 keys are encoded as raw RSA or
+// EC private keys rather than PKCS#8 despite being labeled "PRIVATE KEY".
+// To decode a PKCS#12 file, use DecodeChain instead, and use the
+// encoding/pem package to convert to PEM if necessary.
 func ToPEM(pfxData []byte, password string) ([]*pem.Block, error) {
-	encodedPassword, err := bmpString(password)
-	if err != nil {
-		return nil, ErrIncorrectPassword
-	}
-
-	bags, encodedPassword, err := getSafeContents(pfxData, encodedPassword)
-
-	if err != nil {
-		return nil, err
-	}
-
-	blocks := make([]*pem.Block, 0, len(bags))
-	for _, bag := range bags {
-		block, err := convertBag(&bag, encodedPassword)
-		if err != nil {
-			return nil, err
-		}
-		blocks = append(blocks, block)
-	}
-
-	return blocks, nil
-}
-
-func convertBag(bag *safeBag, password []byte) (*pem.Block, error) {
-	block := &pem.Block{
-		Headers: make(map[string]string),
-	}
-
-	for _, attribute := range bag.Attributes {
-		k, v, err := convertAttribute(&attribute)
-		if err != nil {
-			return nil, err
-		}
-		block.Headers[k] = v
-	}
-
-	switch {
-	case bag.Id.Equal(oidCertBag):
-		block.Type = certificateType
-		certsData, err := decodeCertBag(bag.Value.Bytes)
-		if err != nil {
-			return nil, err
-		}
-		block.Bytes = certsData
-	case bag.Id.Equal(oidPKCS8ShroundedKeyBag):
-		block.Type = privateKeyType
-
-		key, err := decodePkcs8ShroudedKeyBag(bag.Value.Bytes, password)
-		if err != nil {
-			return nil, err
-		}
-
-		switch key := key.(type) {
-		case *rsa.PrivateKey:
-			block.Bytes = x509.MarshalPKCS1PrivateKey(key)
-		case *ecdsa.PrivateKey:
-			block.Bytes, err = x509.MarshalECPrivateKey(key)
-			if err != nil {
-				return nil, err
-			}
-		default:
-			return nil, errors.New("found unknown private key type in PKCS#8 wrapping")
-		}
-	default:
-		return nil, errors.New("don't know how to convert a safe bag of type " + bag.Id.String())
-	}
-	return block, nil
-}
-
-func convertAttribute(attribute *pkcs12Attribute) (key, value string, err error) {
-	isString := false
-
-	switch {
-	case attribute.Id.Equal(oidFriendlyName):
-		key = "friendlyName"
-		isString = true
-	case attribute.Id.Equal(oidLocalKeyID):
-		key = "localKeyId"
-	case attribute.Id.Equal(oidMicrosoftCSPName):
-		// This key is chosen to match OpenSSL.
-		key = "Microsoft CSP Name"
-		isString = true
-	default:
-		return "", "", errors.New("pkcs12: unknown attribute with OID " + attribute.Id.String())
-	}
-
-	if isString {
-		if err := unmarshal(attribute.Value.Bytes, &attribute.Value); err != nil {
-			return "", "", err
-		}
-		if value, err = decodeBMPString(attribute.Value.Bytes); err != nil {
-			return "", "", err
-		}
-	} else {
-		var id []byte
-		if err := unmarshal(attribute.Value.Bytes, &id); err != nil {
-			return "", "", err
-		}
-		value = hex.EncodeToString(id)
-	}
-
-	return key, value, nil
-}
-
-// Decode extracts a certificate and private key from pfxData. This function
-// assumes that there is only one certificate and only one private key in the
-// pfxData.  Since PKCS#12 files often contain more than one certificate, you
-// probably want to use DecodeChain instead.
-func Decode(pfxData []byte, password string) (privateKey interface{}, certificate *x509.Certificate, err error) {
-	privateKey, certificate, err = DecodeChain(pfxData, password)
-	return
-}
-
-// DecodeChain extracts a certificate, a CA certificate chain, and private key
-// from pfxData. This function assumes that there is at least one certificate
-// and only one private key in the pfxData.  The first certificate is assumed to
-// be the leaf certificate, and subsequent certificates, if any, are assumed to
-// comprise the CA certificate chain.
-func DecodeChain(pfxData []byte, password string) (privateKey interface{}, certificate *x509.Certificate, err error) {
-	encodedPassword, err := bmpString(password)
-	if err != nil {
-		return nil, nil, err
-	}
-
-	bags, encodedPassword, err := getSafeContents(pfxData, encodedPassword)
-	if err != nil {
-		return nil, nil, err
-	}
-
-	for _, bag := range bags {
-		switch {
-		case bag.Id.Equal(oidCertBag):
-			certsData, err := decodeCertBag(bag.Value.Bytes)
-			if err != nil {
-				return nil, nil, err
-			}
-			certs, err := x509.ParseCertificates(certsData)
-			if err != nil {
-				return nil, nil, err
-			}
-			if len(certs) != 1 {
-				err = errors.New("pkcs12: expected exactly one certificate in the certBag")
-				return nil, nil, err
-			}
-			if certificate == nil {
-				certificate = certs[0]
-			}
-
-		case bag.Id.Equal(oidPKCS8ShroundedKeyBag):
-			if privateKey != nil {
-				err = errors.New("pkcs12: expected exactly one key bag")
-				return nil, nil, err
-			}
-
-			if privateKey, err = decodePkcs8ShroudedKeyBag(bag.Value.Bytes, encodedPassword); err != nil {
-				return nil, nil, err
-			}
-		}
-	}
-
-	if certificate == nil {
-		return nil, nil, errors.New("pkcs12: certificate missing")
-	}
-	if privateKey == nil {
-		return nil, nil, errors.New("pkcs12: private key missing")
-	}
-
-	return
+	return DefaultDecoder.ToPEM(pfxData, password)
 }
 
-func getSafeContents(p12Data, password []byte) (bags []safeBag, updatedPassword []byte, err error) {
-	pfx := new(pfxPdu)
-	if err := unmarshal(p12Data, pfx); err != nil {
-		return nil, nil, errors.New("pkcs12: error reading P12 data: " + err.Error())
-	}
-
-	if pfx.Version != 3 {
-		return nil, nil, NotImplementedError("can only decode v3 PFX PDU's")
-	}
-
-	if !pfx.AuthSafe.ContentType.Equal(oidDataContentType) {
-		return nil, nil, NotImplementedError("only password-protected PFX is implemented")
-	}
-
-	// unmarshal the explicit bytes in the content for type 'data'
-	if err := unmarshal(pfx.AuthSafe.Content.Bytes, &pfx.AuthSafe.Content); err != nil {
-		return nil, nil, err
-	}
-
-	if len(pfx.MacData.Mac.Algorithm.Algorithm) == 0 {
-		return nil, nil, errors.New("pkcs12: no MAC in data")
-	}
-
-	if err := verifyMac(&pfx.MacData, pfx.AuthSafe.Content.Bytes, password); err != nil {
-		if err == ErrIncorrectPassword && len(password) == 2 && password[0] == 0 && password[1] == 0 {
-			// some implementations use an empty byte array
-			// for the empty string password try one more
-			// time with empty-empty password
-			password = nil
-			err = verifyMac(&pfx.MacData, pfx.AuthSafe.Content.Bytes, password)
-		}
-		if err != nil {
-			return nil, nil, err
-		}
-	}
-
-	var authenticatedSafe []contentInfo
-	if err := unmarshal(pfx.AuthSafe.Content.Bytes, &authenticatedSafe); err != nil {
-		return nil, nil, err
-	}
-
-	if len(authenticatedSafe) != 2 {
-		return nil, nil, NotImplementedError("expected exactly two items in the authenticated safe")
-	}
-
-	for _, ci := range authenticatedSafe {
-		var data []byte
-
-		switch {
-		case ci.ContentType.Equal(oidDataContentType):
-			if err := unmarshal(ci.Content.Bytes, &data); err != nil {
-				return nil, nil, err
-			}
-		case ci.ContentType.Equal(oidEncryptedDataContentType):
-			var encryptedData encryptedData
-			if err := unmarshal(ci.Content.Bytes, &encryptedData); err != nil {
-				return nil, nil, err
-			}
-			if encryptedData.Version != 0 {
-				return nil, nil, NotImplementedError("only version 0 of EncryptedData is supported")
-			}
-			if data, err = pbDecrypt(encryptedData.EncryptedContentInfo, password); err != nil {
-				return nil, nil, err
-			}
-		default:
-			return nil, nil, NotImplementedError("only data and encryptedData content types are supported in authenticated safe")
-		}
-
-		var safeContents []safeBag
-		if err := unmarshal(data, &safeContents); err != nil {
-			return nil, nil, err
-		}
-		bags = append(bags, safeContents...)
-	}
-
-	return bags, password, nil
+// ToPEM is like the package-level ToPEM function, but uses the options of
+// dec.  The same warnings apply.
+func (dec *Decoder) ToPEM(pfxData []byte, password string) ([]*pem.Block, error) {
+	blocks, err := v2.ToPEM(pfxData, password, dec.opts...)
+	return blocks, unwrap(err)
 }
 
 // Encode produces pfxData containing one private key (privateKey), an
 // end-entity certificate (certificate), and any number of CA certificates
-// (caCerts).
+// (caCerts) using DefaultEncoder.
 //
 // The private key is encrypted with the provided password, but due to the
 // weak encryption primitives used by PKCS#12, it is RECOMMENDED that you
@@ -383,152 +220,46 @@ func getSafeContents(p12Data, password []byte) (bags []safeBag, updatedPassword
 // the resulting pfxData using other means.
 //
 // The rand argument is used to provide entropy for the encryption, and
-// can be set to rand.Reader from the crypto/rand package.
+// can be set to rand.Reader from the crypto/rand package, which is used if
+// rand is nil.
+//
+// caCerts may be nil or empty, but neither privateKey, certificate nor any
+// element of caCerts may be nil.
+//
+// Encode creates two SafeContents: one that's encrypted and contains the
+// certificates, and another that is unencrypted and contains the private key
+// shrouded with 3DES.  The private key bag and the end-entity certificate bag
+// have the LocalKeyId attribute set to the SHA-1 fingerprint of the
+// end-entity certificate.  Use Legacy.Encode if the certificates must be
+// encrypted with 40-bit RC2, as earlier versions of Encode did.
 //
-// Encode emulates the behavior of OpenSSL's PKCS12_create: it creates two
-// SafeContents: one that's encrypted with RC2 and contains the certificates,
-// and another that is unencrypted and contains the private key shrouded with
-// 3DES  The private key bag and the end-entity certificate bag have the
-// LocalKeyId attribute set to the SHA-1 fingerprint of the end-entity
-// certificate.
+// Certificates are embedded exactly as their Raw field, which must hold a
+// valid DER certificate; they are never re-encoded.
 func Encode(rand io.Reader, privateKey interface{}, certificate *x509.Certificate, caCerts []*x509.Certificate, password string) (pfxData []byte, err error) {
-	encodedPassword, err := bmpString(password)
-	if err != nil {
-		return nil, err
-	}
-
-	var pfx pfxPdu
-	pfx.Version = 3
-
-	var certFingerprint = sha1.Sum(certificate.Raw)
-	var localKeyIdAttr pkcs12Attribute
-	localKeyIdAttr.Id = oidLocalKeyID
-	localKeyIdAttr.Value.Class = 0
-	localKeyIdAttr.Value.Tag = 17
-	localKeyIdAttr.Value.IsCompound = true
-	if localKeyIdAttr.Value.Bytes, err = asn1.Marshal(certFingerprint[:]); err != nil {
-		return nil, err
-	}
-
-	var certBags []safeBag
-	var certBag *safeBag
-	if certBag, err = makeCertBag(certificate.Raw, []pkcs12Attribute{localKeyIdAttr}); err != nil {
-		return nil, err
-	}
-	certBags = append(certBags, *certBag)
-
-	for _, cert := range caCerts {
-		if certBag, err = makeCertBag(cert.Raw, []pkcs12Attribute{}); err != nil {
-			return nil, err
-		}
-		certBags = append(certBags, *certBag)
-	}
-
-	var keyBag safeBag
-	keyBag.Id = oidPKCS8ShroundedKeyBag
-	keyBag.Value.Class = 2
-	keyBag.Value.Tag = 0
-	keyBag.Value.IsCompound = true
-	if keyBag.Value.Bytes, err = encodePkcs8ShroudedKeyBag(rand, privateKey, encodedPassword); err != nil {
-		return nil, err
-	}
-	keyBag.Attributes = append(keyBag.Attributes, localKeyIdAttr)
-
-	// Construct an authenticated safe with two SafeContents.
-	// The first SafeContents is encrypted and contains the cert bags.
-	// The second SafeContents is unencrypted and contains the shrouded key bag.
-	var authenticatedSafe [2]contentInfo
-	if authenticatedSafe[0], err = makeSafeContents(rand, certBags, encodedPassword); err != nil {
-		return nil, err
-	}
-	if authenticatedSafe[1], err = makeSafeContents(rand, []safeBag{keyBag}, nil); err != nil {
-		return nil, err
-	}
-
-	var authenticatedSafeBytes []byte
-	if authenticatedSafeBytes, err = asn1.Marshal(authenticatedSafe[:]); err != nil {
-		return nil, err
-	}
-
-	// compute the MAC
-	pfx.MacData.Mac.Algorithm.Algorithm = oidSHA1
-	pfx.MacData.MacSalt = make([]byte, 8)
-	if _, err = rand.Read(pfx.MacData.MacSalt); err != nil {
-		return nil, err
-	}
-	pfx.MacData.Iterations = 1
-	if err = computeMac(&pfx.MacData, authenticatedSafeBytes, encodedPassword); err != nil {
-		return nil, err
-	}
-
-	pfx.AuthSafe.ContentType = oidDataContentType
-	pfx.AuthSafe.Content.Class = 2
-	pfx.AuthSafe.Content.Tag = 0
-	pfx.AuthSafe.Content.IsCompound = true
-	if pfx.AuthSafe.Content.Bytes, err = asn1.Marshal(authenticatedSafeBytes); err != nil {
-		return nil, err
-	}
-
-	if pfxData, err = asn1.Marshal(pfx); err != nil {
-		return nil, errors.New("pkcs12: error writing P12 data: " + err.Error())
-	}
-	return
+	return DefaultEncoder.Encode(rand, privateKey, certificate, caCerts, password)
 }
 
-func makeCertBag(certBytes []byte, attributes []pkcs12Attribute) (certBag *safeBag, err error) {
-	certBag = new(safeBag)
-	certBag.Id = oidCertBag
-	certBag.Value.Class = 2
-	certBag.Value.Tag = 0
-	certBag.Value.IsCompound = true
-	if certBag.Value.Bytes, err = encodeCertBag(certBytes); err != nil {
-		return nil, err
-	}
-	certBag.Attributes = attributes
-	return
+// Encode produces pfxData containing one private key (privateKey), an
+// end-entity certificate (certificate), and any number of CA certificates
+// (caCerts), using the algorithms of enc.  See the package-level Encode
+// function for details.
+func (enc *Encoder) Encode(rand io.Reader, privateKey interface{}, certificate *x509.Certificate, caCerts []*x509.Certificate, password string) (pfxData []byte, err error) {
+	pfxData, err = v2.Encode(rand, privateKey, certificate, caCerts, password, enc.opts...)
+	return pfxData, unwrap(err)
 }
 
-func makeSafeContents(rand io.Reader, bags []safeBag, password []byte) (ci contentInfo, err error) {
-	var data []byte
-	if data, err = asn1.Marshal(bags); err != nil {
-		return
-	}
-
-	if password == nil {
-		ci.ContentType = oidDataContentType
-		ci.Content.Class = 2
-		ci.Content.Tag = 0
-		ci.Content.IsCompound = true
-		if ci.Content.Bytes, err = asn1.Marshal(data); err != nil {
-			return
-		}
-	} else {
-		randomSalt := make([]byte, 8)
-		if _, err = rand.Read(randomSalt); err != nil {
-			return
-		}
-
-		var algo pkix.AlgorithmIdentifier
-		algo.Algorithm = oidPBEWithSHAAnd40BitRC2CBC
-		if algo.Parameters.FullBytes, err = asn1.Marshal(pbeParams{Salt: randomSalt, Iterations: 2048}); err != nil {
-			return
-		}
-
-		var encryptedData encryptedData
-		encryptedData.Version = 0
-		encryptedData.EncryptedContentInfo.ContentType = oidDataContentType
-		encryptedData.EncryptedContentInfo.ContentEncryptionAlgorithm = algo
-		if err = pbEncrypt(&encryptedData.EncryptedContentInfo, data, password); err != nil {
-			return
-		}
-
-		ci.ContentType = oidEncryptedDataContentType
-		ci.Content.Class = 2
-		ci.Content.Tag = 0
-		ci.Content.IsCompound = true
-		if ci.Content.Bytes, err = asn1.Marshal(encryptedData); err != nil {
-			return
-		}
-	}
-	return
-}
+// An EncryptedPEMKey is a private key in a traditional encrypted PEM block,
+// with Proc-Type and DEK-Info headers, as written by "openssl ec -des3" and
+// "openssl rsa -aes256 -traditional".  Encode and the other encoding
+// functions accept an EncryptedPEMKey, or a pointer to one, in place of a
+// private key, and decrypt it with Passphrase, so that such keys need not
+// be converted with openssl first.
+//
+// PEM holds the PEM encoding, in which the first "RSA PRIVATE KEY", "EC
+// PRIVATE KEY" or "PRIVATE KEY" block is used.  That block may also be
+// unencrypted, in which case Passphrase is ignored.  PKCS#8 "ENCRYPTED
+// PRIVATE KEY" blocks are not supported.
+//
+// The encryption of traditional PEM is weak and unauthenticated, so a wrong
+// passphrase is usually, but not always, detected.
+type EncryptedPEMKey = v2.EncryptedPEMKey
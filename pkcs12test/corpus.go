@@ -0,0 +1,34 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package pkcs12test provides a corpus of malformed and unusual PKCS#12
+// files for testing code which decodes them.  It is kept apart from package
+// pkcs12 so that the files are embedded only in the binaries which import
+// it, such as test binaries.
+//
+// It is a shim over the package of the same name in version 2.
+package pkcs12test
+
+import "github.com/scholar-ink/go-pkcs12/v2/pkcs12test"
+
+// A CorpusEntry is a file of the regression corpus returned by
+// MalformedCorpus.
+type CorpusEntry = pkcs12test.CorpusEntry
+
+// MalformedCorpus returns the regression corpus of malformed and unusual
+// PKCS#12 files which package pkcs12 is tested against.  Some of them decode,
+// possibly only with lenient options, and others must be rejected, but
+// none may cause a panic or a hang.
+func MalformedCorpus() []CorpusEntry {
+	return pkcs12test.MalformedCorpus()
+}
+
+// ReplayCorpus calls decode with the data and password of each entry of
+// MalformedCorpus, so that integrators can check that code wrapping
+// package pkcs12 tolerates the same inputs.  Errors returned by decode are
+// expected and ignored; ReplayCorpus returns an error naming the first
+// entry for which decode panicked.
+func ReplayCorpus(decode func(data []byte, password string) error) error {
+	return pkcs12test.ReplayCorpus(decode)
+}
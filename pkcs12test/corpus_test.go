@@ -0,0 +1,23 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkcs12test
+
+import (
+	"testing"
+
+	"github.com/scholar-ink/go-pkcs12"
+)
+
+func TestReplayCorpus(t *testing.T) {
+	if len(MalformedCorpus()) == 0 {
+		t.Fatal("the corpus is empty")
+	}
+	if err := ReplayCorpus(func(data []byte, password string) error {
+		_, _, err := pkcs12.DefaultDecoder.WithTrailingZeroPadding(true).Decode(data, password)
+		return err
+	}); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,160 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkcs12
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"io"
+
+	v2 "github.com/scholar-ink/go-pkcs12/v2"
+)
+
+// DecodeTrustStore extracts the certificates from pfxData, which must be a
+// PKCS#12 file containing exclusively certificates with no associated
+// private keys, such as a Java trust store, using DefaultDecoder.
+// Certificates are returned in the order in which they appear in the file;
+// duplicates are handled according to the Decoder's DuplicatePolicy.  CRL
+// bags are skipped; use DecodeTrustStoreWithCRLs to obtain them.
+func DecodeTrustStore(pfxData []byte, password string) (certs []*x509.Certificate, err error) {
+	return DefaultDecoder.DecodeTrustStore(pfxData, password)
+}
+
+// DecodeTrustStore is like the package-level DecodeTrustStore function, but
+// uses the options of dec.
+func (dec *Decoder) DecodeTrustStore(pfxData []byte, password string) (certs []*x509.Certificate, err error) {
+	certs, err = v2.DecodeTrustStore(pfxData, password, dec.opts...)
+	return certs, unwrap(err)
+}
+
+// DecodeTrustStoreWithCRLs is like DecodeTrustStore, but also returns the
+// CRLs in pfxData, such as those embedded by EncodeTrustStoreWithCRLs, in
+// the order in which they appear.  The CRLs are parsed but not verified.
+func DecodeTrustStoreWithCRLs(pfxData []byte, password string) (certs []*x509.Certificate, crls []*x509.RevocationList, err error) {
+	return DefaultDecoder.DecodeTrustStoreWithCRLs(pfxData, password)
+}
+
+// DecodeTrustStoreWithCRLs is like the package-level
+// DecodeTrustStoreWithCRLs function, but uses the options of dec.
+func (dec *Decoder) DecodeTrustStoreWithCRLs(pfxData []byte, password string) (certs []*x509.Certificate, crls []*x509.RevocationList, err error) {
+	certs, crls, err = v2.DecodeTrustStoreWithCRLs(pfxData, password, dec.opts...)
+	return certs, crls, unwrap(err)
+}
+
+// DecodeCertBags returns every certificate bag in pfxData, in the order in
+// which they appear, using DefaultDecoder.  Unlike DecodeChain, it does not
+// require a private key to be present.
+func DecodeCertBags(pfxData []byte, password string) ([]CertBag, error) {
+	return DefaultDecoder.DecodeCertBags(pfxData, password)
+}
+
+// DecodeCertBags is like the package-level DecodeCertBags function, but uses
+// the options of dec.
+func (dec *Decoder) DecodeCertBags(pfxData []byte, password string) ([]CertBag, error) {
+	bags, err := v2.DecodeCertBags(pfxData, password, dec.opts...)
+	return bags, unwrap(err)
+}
+
+// EncodeTrustStore produces pfxData containing any number of CA certificates
+// (certs) to be trusted, using DefaultEncoder.  The certificates are marked
+// as trusted with the attribute used by Java key stores, so the output can
+// be used as a Java trust store, and carry a friendlyName equal to their
+// subject.
+func EncodeTrustStore(rand io.Reader, certs []*x509.Certificate, password string) (pfxData []byte, err error) {
+	return DefaultEncoder.EncodeTrustStore(rand, certs, password)
+}
+
+// EncodeTrustStore is like the package-level EncodeTrustStore function, but
+// uses the algorithms of enc.
+func (enc *Encoder) EncodeTrustStore(rand io.Reader, certs []*x509.Certificate, password string) (pfxData []byte, err error) {
+	pfxData, err = v2.EncodeTrustStore(rand, certs, password, enc.opts...)
+	return pfxData, unwrap(err)
+}
+
+// EncodeTrustStoreWithCRLs is like EncodeTrustStore, but also embeds the
+// current CRL of some or all of the CAs, so that systems without network
+// access receive revocation information together with the trust anchors.
+// Each CRL must be signed by one of certs, and no CA may have more than one
+// CRL.  The CRLs are stored in CRL bags carrying the same friendlyName as
+// the certificate of their issuer.
+func EncodeTrustStoreWithCRLs(rand io.Reader, certs []*x509.Certificate, crls []*x509.RevocationList, password string) (pfxData []byte, err error) {
+	return DefaultEncoder.EncodeTrustStoreWithCRLs(rand, certs, crls, password)
+}
+
+// EncodeTrustStoreWithCRLs is like the package-level
+// EncodeTrustStoreWithCRLs function, but uses the algorithms of enc.
+func (enc *Encoder) EncodeTrustStoreWithCRLs(rand io.Reader, certs []*x509.Certificate, crls []*x509.RevocationList, password string) (pfxData []byte, err error) {
+	pfxData, err = v2.EncodeTrustStoreWithCRLs(rand, certs, crls, password, enc.opts...)
+	return pfxData, unwrap(err)
+}
+
+// ApplyTrustDelta returns a copy of the trust store base in which the
+// certificates of remove are removed and those of add are added, using
+// DefaultEncoder and entropy from crypto/rand.  See
+// Encoder.ApplyTrustDelta.
+func ApplyTrustDelta(base []byte, add, remove []*x509.Certificate, password string) (pfxData []byte, err error) {
+	return DefaultEncoder.ApplyTrustDelta(rand.Reader, base, add, remove, password)
+}
+
+// ApplyTrustDelta returns a copy of the trust store base, decoded with
+// DefaultDecoder and password, in which the certificates of remove are
+// removed and those of add are added, protected with the algorithms of enc
+// and password.  It is intended for pipelines which periodically refresh a
+// CA bundle.
+//
+// Entries which are kept, including CRL bags, retain their bags exactly as
+// they appear in base, attributes and all, and keep their order, except
+// that compressed bags are stored decompressed unless enc is configured
+// with WithBagCompression.  The certificates of add follow them, marked as
+// trusted and named as EncodeTrustStore does; a certificate which is
+// already in the result is not added again.  Certificates of remove which
+// are not in base are ignored.  base must not contain private keys.
+func (enc *Encoder) ApplyTrustDelta(rand io.Reader, base []byte, add, remove []*x509.Certificate, password string) (pfxData []byte, err error) {
+	pfxData, err = v2.ApplyTrustDelta(rand, base, add, remove, password, enc.opts...)
+	return pfxData, unwrap(err)
+}
+
+// EncodeEmpty produces pfxData containing no keys or certificates using
+// DefaultEncoder.  See Encoder.EncodeEmpty.
+func EncodeEmpty(rand io.Reader, password string) (pfxData []byte, err error) {
+	return DefaultEncoder.EncodeEmpty(rand, password)
+}
+
+// EncodeEmpty produces pfxData containing no keys or certificates, for use
+// as a placeholder which is later replaced by a real identity or trust
+// store.  The file has an empty AuthenticatedSafe protected by a MAC
+// computed according to enc, so password can still be verified.
+func (enc *Encoder) EncodeEmpty(rand io.Reader, password string) (pfxData []byte, err error) {
+	pfxData, err = v2.EncodeEmpty(rand, password, enc.opts...)
+	return pfxData, unwrap(err)
+}
+
+// A DuplicatePolicy specifies how a Decoder handles a certificate which
+// appears more than once in a file, possibly with different attributes.
+// Certificates are duplicates if their DER encodings are identical.
+type DuplicatePolicy = v2.DuplicatePolicy
+
+const (
+	// DeduplicateCertificates keeps only the first occurrence of each
+	// certificate.  It is the default.
+	DeduplicateCertificates = v2.DeduplicateCertificates
+
+	// KeepDuplicateCertificates returns every occurrence of each
+	// certificate.
+	KeepDuplicateCertificates = v2.KeepDuplicateCertificates
+
+	// RejectDuplicateCertificates fails decoding with
+	// ErrDuplicateCertificate.
+	RejectDuplicateCertificates = v2.RejectDuplicateCertificates
+)
+
+// A CertBag is a certificate bag decoded from a PKCS#12 file.
+type CertBag = v2.CertBag
+
+// A CertificateAnnotator enriches each certificate decoded by
+// DecodeCertBags with caller-defined metadata, such as certificate
+// transparency lookup results or inventory identifiers, which is stored in
+// CertBag.Annotation.  Returning an error aborts decoding with that error.
+type CertificateAnnotator = v2.CertificateAnnotator
@@ -0,0 +1,203 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkcs12
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/scholar-ink/go-pkcs12/v2/internal/core"
+)
+
+// An ErrorKind classifies an Error.
+type ErrorKind int
+
+const (
+	// Malformed means that the input could not be parsed.
+	Malformed ErrorKind = iota + 1
+
+	// IncorrectPassword means that the password does not match the MAC
+	// or the encryption of the input.
+	IncorrectPassword
+
+	// Unsupported means that the input, or the requested output, uses a
+	// feature which is not implemented.
+	Unsupported
+
+	// PolicyViolation means that the input, or the requested output, was
+	// refused by an option such as WithMinIterations or WithMaxSize, by
+	// DisableLegacyEncoding, or by CheckDowngrade.
+	PolicyViolation
+
+	// InvalidInput means that the arguments of a function are unusable,
+	// such as a key which does not match its certificate, or a type
+	// argument of DecodeTyped which the key of the file does not have.
+	InvalidInput
+
+	// Canceled means that the context of the operation was done.
+	Canceled
+)
+
+var kindNames = [...]string{
+	Malformed:         "malformed",
+	IncorrectPassword: "incorrect password",
+	Unsupported:       "unsupported",
+	PolicyViolation:   "policy violation",
+	InvalidInput:      "invalid input",
+	Canceled:          "canceled",
+}
+
+func (k ErrorKind) String() string {
+	if k > 0 && int(k) < len(kindNames) {
+		return kindNames[k]
+	}
+	return "unknown"
+}
+
+// An Error is returned by every function of this package which fails, and
+// by the methods of DecodeCache and CredentialStore.  The error which
+// caused it, such as ErrIncorrectPassword or an *IterationsError, is
+// available with errors.Unwrap, so errors.Is and errors.As see through it.
+// Version 1 of this package returns that error unwrapped.
+type Error struct {
+	// Op names the failed operation, such as "decode".
+	Op string
+
+	Kind ErrorKind
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return "pkcs12: " + e.Op + ": " + strings.TrimPrefix(e.Err.Error(), "pkcs12: ")
+}
+
+func (e *Error) Unwrap() error { return e.Err }
+
+// decodeError returns err, returned by op, as an *Error, or nil if err is
+// nil.  Errors which are not otherwise classified are Malformed.
+func decodeError(op string, err error) error {
+	return wrapError(op, err, Malformed)
+}
+
+// encodeError is like decodeError, for operations whose input is supplied
+// by the caller rather than read from a file: errors which are not
+// otherwise classified are InvalidInput.
+func encodeError(op string, err error) error {
+	return wrapError(op, err, InvalidInput)
+}
+
+func wrapError(op string, err error, fallback ErrorKind) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{Op: op, Kind: errorKind(err, fallback), Err: err}
+}
+
+func errorKind(err error, fallback ErrorKind) ErrorKind {
+	var notImplemented NotImplementedError
+	var iterations *IterationsError
+	var size *SizeError
+	var downgrade *DowngradeError
+	var mismatch *KeyAlgorithmMismatchError
+	var curveMismatch *CurveMismatchError
+	var keyType *KeyTypeError
+	switch {
+	case errors.Is(err, ErrIncorrectPassword):
+		return IncorrectPassword
+	case errors.As(err, &notImplemented):
+		return Unsupported
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return Canceled
+	case errors.As(err, &iterations), errors.As(err, &size), errors.As(err, &downgrade),
+		errors.Is(err, ErrLegacyEncodingDisabled), errors.Is(err, ErrDuplicateCertificate), errors.Is(err, ErrDuplicateKeyID), errors.Is(err, ErrMissingSignature):
+		return PolicyViolation
+	case errors.As(err, &mismatch), errors.As(err, &curveMismatch), errors.As(err, &keyType), errors.Is(err, ErrKeyMismatch):
+		return InvalidInput
+	}
+	return fallback
+}
+
+var (
+	// ErrDecryption represents a failure to decrypt the input.
+	ErrDecryption = core.ErrDecryption
+
+	// ErrIncorrectPassword is returned when an incorrect password is detected.
+	// Usually, P12/PFX data is signed to be able to verify the password.
+	ErrIncorrectPassword = core.ErrIncorrectPassword
+
+	// ErrLegacyEncodingDisabled is returned when encoding would produce
+	// output protected with weak algorithms after DisableLegacyEncoding has
+	// been called.
+	ErrLegacyEncodingDisabled = core.ErrLegacyEncodingDisabled
+
+	// ErrDuplicateCertificate is returned when a file contains the same
+	// certificate more than once and decoding is configured with
+	// WithDuplicateCertificates(RejectDuplicateCertificates).
+	ErrDuplicateCertificate = core.ErrDuplicateCertificate
+
+	// ErrDuplicateKeyID is returned when a file contains several private
+	// keys with the same localKeyId and the policy of WithDuplicateKeyIDs
+	// is RejectDuplicateKeyIDs, as it is by default.
+	ErrDuplicateKeyID = core.ErrDuplicateKeyID
+
+	// ErrMissingSignature is returned by decoding with
+	// WithIntegrityVerifier when a file is not in public-key integrity
+	// mode, so that its signature cannot be verified.
+	ErrMissingSignature = core.ErrMissingSignature
+
+	// ErrKeyMismatch is returned by encoding when the private key is of
+	// the same algorithm, and for ECDSA on the same curve, as the
+	// end-entity certificate's public key, but is not its private key.
+	ErrKeyMismatch = core.ErrKeyMismatch
+
+	// ErrEmptyContainer is passed to the warning function of
+	// WithEmptyContainers when a file contains no SafeBags.
+	ErrEmptyContainer = core.ErrEmptyContainer
+
+	// ErrEncryptedDataVersion and ErrEncryptedContentType are passed to
+	// the warning function of WithLenientEncryptedData when an
+	// EncryptedData has a version other than 0, or encrypted content which
+	// is not labeled as data.
+	ErrEncryptedDataVersion = core.ErrEncryptedDataVersion
+	ErrEncryptedContentType = core.ErrEncryptedContentType
+)
+
+// NotImplementedError indicates that the input is not currently supported.
+type NotImplementedError = core.NotImplementedError
+
+// DowngradeError is returned by CheckDowngrade when a PKCS#12 file is
+// protected less strongly than its predecessor.
+type DowngradeError = core.DowngradeError
+
+// SizeError is returned by encoding with WithMaxSize when the encoded file
+// would exceed the limit.
+type SizeError = core.SizeError
+
+// IterationsError is returned by decoding when a key derivation in the
+// input uses fewer iterations than the minimum set with WithMinIterations,
+// or no iterations at all.
+type IterationsError = core.IterationsError
+
+// KeyAlgorithmMismatchError is returned by encoding when the private key
+// and the end-entity certificate's public key are of different algorithms,
+// such as an Ed25519 key with an ECDSA certificate.
+type KeyAlgorithmMismatchError = core.KeyAlgorithmMismatchError
+
+// CurveMismatchError is returned by encoding when an ECDSA private key
+// and the end-entity certificate's public key are on different curves.
+type CurveMismatchError = core.CurveMismatchError
+
+// LeakError is returned by Canary.Scan when the output contains a secret
+// of the canary.
+type LeakError = core.LeakError
+
+// KeyTypeError is returned by DecodeTyped when the private key of a file
+// is not of the expected type.
+type KeyTypeError = core.KeyTypeError
+
+// A SizeContribution is the share of an encoded file taken by one of its
+// parts, as reported in a SizeError.
+type SizeContribution = core.SizeContribution
@@ -0,0 +1,255 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkcs12
+
+import (
+	"context"
+	"crypto"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"time"
+
+	"github.com/scholar-ink/go-pkcs12/v2/internal/core"
+)
+
+// ToTLSCertificate decodes pfxData, which must contain exactly one private
+// key, and returns it as a tls.Certificate whose Certificate chain begins
+// with the end-entity certificate, which is also set as Leaf, followed by
+// the CA certificates.  The leaf is never included twice, even with
+// WithLeafInChain(true).
+func ToTLSCertificate(pfxData []byte, password string, opts ...DecodeOption) (tls.Certificate, error) {
+	cert, err := newDecoder(opts).ToTLSCertificate(pfxData, password)
+	return cert, decodeError("convert to TLS certificate", err)
+}
+
+// EncodeTLSCertificate produces pfxData containing the private key and
+// chain of cert, the mirror of ToTLSCertificate.  cert.Certificate[0] is
+// the end-entity certificate, as in crypto/tls, and the remaining
+// certificates are encoded as CA certificates in the same order.  If
+// cert.Leaf is set it must be the same certificate.  The private key must
+// implement crypto.Signer and match the end-entity certificate.
+func EncodeTLSCertificate(rand io.Reader, cert tls.Certificate, password string, options *TLSCertificateOptions, opts ...EncodeOption) ([]byte, error) {
+	pfxData, err := newEncoder(opts).EncodeTLSCertificate(rand, cert, password, options)
+	return pfxData, encodeError("encode TLS certificate", err)
+}
+
+// LoadTLSClientIdentity reads the PKCS#12 file at path and returns its
+// identity as a tls.Certificate, ready for use in tls.Config.Certificates.
+// The private key must match the end-entity certificate and the certificate
+// must currently be valid; any CA certificates in the file are included in
+// the chain presented to servers.
+func LoadTLSClientIdentity(path, password string) (tls.Certificate, error) {
+	cert, err := core.LoadTLSClientIdentity(path, password)
+	return cert, decodeError("load TLS client identity", err)
+}
+
+// SaveTLSServerIdentity encodes cert, including its chain, like
+// EncodeTLSCertificate, and writes it to path with permissions 0600,
+// replacing any existing file atomically.
+func SaveTLSServerIdentity(rand io.Reader, path string, cert tls.Certificate, password string, opts ...EncodeOption) error {
+	return encodeError("save TLS server identity", newEncoder(opts).SaveTLSServerIdentity(rand, path, cert, password))
+}
+
+// LoadTrustBundle reads the PKCS#12 file at path and returns a pool
+// containing every certificate in it.  Private keys, if any, are ignored.
+func LoadTrustBundle(path, password string) (*x509.CertPool, error) {
+	pool, err := core.LoadTrustBundle(path, password)
+	return pool, decodeError("load trust bundle", err)
+}
+
+// LoadEntry reads, decodes, and validates the PKCS#12 file at path,
+// returning an error if the file cannot be read or decoded, or if its
+// identity fails validation.
+func LoadEntry(path, password string) (*Entry, error) {
+	entry, err := core.LoadEntry(path, password)
+	return entry, decodeError("load entry", err)
+}
+
+// A CredentialStore holds the active TLS identity loaded from a PKCS#12 file
+// and atomically replaces it whenever the file is successfully reloaded.
+//
+// Unlike Entry, which reloads lazily during handshakes, a CredentialStore
+// only reloads when Reload is called or while Watch is running.  Like Entry,
+// it validates every new identity before making it active: the private key
+// must match the end-entity certificate, and the certificate must be within
+// its validity period.  An identity that fails validation is never served.
+//
+// A CredentialStore is safe for concurrent use by multiple goroutines.
+type CredentialStore struct {
+	store *core.CredentialStore
+}
+
+// NewCredentialStore loads, decodes, and validates the PKCS#12 file at path,
+// returning an error if any of these steps fail.
+func NewCredentialStore(path, password string) (*CredentialStore, error) {
+	store, err := core.NewCredentialStore(path, password)
+	if err != nil {
+		return nil, decodeError("load credential store", err)
+	}
+	return &CredentialStore{store}, nil
+}
+
+// Reload re-reads, decodes, and validates the file.  On success, the new
+// identity becomes active; on failure, the previous identity remains active
+// and the error is returned.
+func (s *CredentialStore) Reload() error {
+	return decodeError("reload credential store", s.store.Reload())
+}
+
+// Watch polls the file every interval and calls Reload whenever its
+// modification time or size changes, until ctx is done.  Errors from Reload
+// are passed to onError, which may be nil.  Watch blocks, so it is normally
+// run in its own goroutine.
+func (s *CredentialStore) Watch(ctx context.Context, interval time.Duration, onError func(error)) {
+	if onError != nil {
+		report := onError
+		onError = func(err error) { report(decodeError("reload credential store", err)) }
+	}
+	s.store.Watch(ctx, interval, onError)
+}
+
+// Certificate returns the active identity.
+func (s *CredentialStore) Certificate() *tls.Certificate {
+	return s.store.Certificate()
+}
+
+// GetCertificate returns the active identity.  It has the signature of
+// tls.Config.GetCertificate.
+func (s *CredentialStore) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return s.store.GetCertificate(hello)
+}
+
+// GetClientCertificate returns the active identity.  It has the signature of
+// tls.Config.GetClientCertificate.
+func (s *CredentialStore) GetClientCertificate(request *tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	return s.store.GetClientCertificate(request)
+}
+
+// A DecodeCache memoizes the results of Decode, so that repeatedly decoding
+// the same file with the same password, as gateways which reload a client
+// bundle on every request do, does not repeat the expensive key derivation
+// and decryption.
+//
+// Entries are keyed by a SHA-256 HMAC, under a random per-cache key, of the
+// password and pfxData, so the cache never retains the password itself.
+// Only successful decodes are cached.  The least recently used entry is
+// evicted once the cache is full.
+//
+// Results are shared between all callers that decode the same file, so the
+// returned private keys and certificates must not be modified.
+//
+// A DecodeCache is safe for concurrent use by multiple goroutines.
+type DecodeCache struct {
+	cache *core.DecodeCache
+}
+
+// NewDecodeCache returns a DecodeCache which decodes with opts and holds at
+// most maxEntries results.  If maxEntries is zero or negative, the cache is
+// unbounded.
+func NewDecodeCache(maxEntries int, opts ...DecodeOption) *DecodeCache {
+	return &DecodeCache{core.NewDecodeCache(newDecoder(opts), maxEntries)}
+}
+
+// Decode is like the package-level Decode function, but returns a
+// previously decoded result if pfxData and password have been decoded
+// successfully before.
+func (c *DecodeCache) Decode(pfxData []byte, password string) (privateKey crypto.PrivateKey, certificate *x509.Certificate, caCerts []*x509.Certificate, err error) {
+	privateKey, certificate, caCerts, err = c.cache.DecodeChainWithCAs(pfxData, password)
+	return privateKey, certificate, caCerts, decodeError("decode", err)
+}
+
+// Len returns the number of cached results.
+func (c *DecodeCache) Len() int {
+	return c.cache.Len()
+}
+
+// EncodeEnrollmentResponse packages resp into pfxData in the form that
+// device management agents expect when installing an enrolled identity:
+//
+//   - the private key must match the issued certificate;
+//   - the CA certificates are ordered from the issuer of the certificate
+//     towards the root, and certificates which are not on that path are
+//     dropped;
+//   - both the key bag and the end-entity certificate bag carry the
+//     LocalKeyId and friendlyName attributes.
+//
+// It is an error for resp.CACerts to be non-empty but not to contain the
+// issuer of resp.Certificate.
+func EncodeEnrollmentResponse(rand io.Reader, resp *EnrollmentResponse, password string, opts ...EncodeOption) ([]byte, error) {
+	pfxData, err := newEncoder(opts).EncodeEnrollmentResponse(rand, resp, password)
+	return pfxData, encodeError("encode enrollment response", err)
+}
+
+// ParseMDMPayloads returns every com.apple.security.pkcs12 payload found in
+// plist, which may be a complete configuration profile, a bare payload
+// <dict>, or any XML property list containing such payloads.  Signed
+// (CMS-wrapped) profiles must be unwrapped by the caller first.
+func ParseMDMPayloads(plist []byte) ([]*MDMPayload, error) {
+	payloads, err := core.ParseMDMPayloads(plist)
+	return payloads, decodeError("parse MDM payloads", err)
+}
+
+// NewCanary returns a new Canary, reading its key, password and the
+// randomness of its encoding from rand, or from crypto/rand if rand is nil.
+// The file is encoded with the Modern profile.
+func NewCanary(rand io.Reader) (*Canary, error) {
+	canary, err := core.NewCanary(rand)
+	return canary, encodeError("create canary", err)
+}
+
+// TLSCertificateOptions configures EncodeTLSCertificate.  A nil
+// *TLSCertificateOptions is equivalent to the zero value.
+type TLSCertificateOptions = core.TLSCertificateOptions
+
+// PlatformCryptoProvider is the name of the Windows key storage provider
+// which keeps keys in the TPM, for use as TLSCertificateOptions.CSPName.
+const PlatformCryptoProvider = core.PlatformCryptoProvider
+
+// An Entry is a TLS identity (a private key, an end-entity certificate, and
+// any CA certificates) loaded from a PKCS#12 file on disk.  Its
+// GetCertificate and GetClientCertificate methods can be used directly as
+// crypto/tls callbacks, and transparently reload the file when its
+// modification time or size changes, so that servers pick up rotated
+// credentials without restarting.  The file is checked at most once a
+// second, and handshakes never wait for a reload: while one is in progress
+// they are served the previous identity.
+//
+// Like CredentialStore, an Entry validates every identity before serving
+// it: the private key must match the end-entity certificate, and the
+// certificate must be within its validity period.  If reloading fails (for
+// example because the file is being rewritten, or holds an expired
+// certificate), the previously loaded identity continues to be served, and
+// the reload is retried only once the modification time or size of the
+// file changes again, or Invalidate is called.
+//
+// An Entry is safe for concurrent use by multiple goroutines.
+type Entry = core.Entry
+
+// A Canary is a PKCS#12 file with a freshly generated key and password,
+// for testing that an application never writes the secrets of the files
+// it decodes to its logs.  The test has the application decode PFXData
+// with Password along its usual code path, capturing its log and debug
+// output, and then passes the output to Scan.
+//
+// Scan reports a leak with a *LeakError, which is a finding about the
+// output rather than a failure of this package, so it is not wrapped in an
+// *Error.
+type Canary = core.Canary
+
+// An EnrollmentResponse is the result of a certificate enrollment performed
+// by an EST (RFC 7030) or SCEP (RFC 8894) client: a locally generated
+// private key, the certificate issued for it, and the CA certificates
+// returned by the server.
+type EnrollmentResponse = core.EnrollmentResponse
+
+// MDMPayloadType is the PayloadType of Apple configuration profile payloads
+// carrying PKCS#12 data.
+const MDMPayloadType = core.MDMPayloadType
+
+// An MDMPayload is a com.apple.security.pkcs12 payload of an Apple
+// configuration profile (.mobileconfig), which installs a PKCS#12 identity
+// on macOS and iOS devices.
+type MDMPayload = core.MDMPayload
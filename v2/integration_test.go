@@ -0,0 +1,119 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkcs12
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTLSCertificate(t *testing.T) {
+	key, cert := newTestCertificate(t)
+	tlsCert := tls.Certificate{Certificate: [][]byte{cert.Raw}, PrivateKey: key}
+	path := filepath.Join(t.TempDir(), "identity.p12")
+	if err := SaveTLSServerIdentity(rand.Reader, path, tlsCert, "password"); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadTLSClientIdentity(path, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !loaded.Leaf.Equal(cert) || len(loaded.Certificate) != 1 {
+		t.Error("loaded identity does not match")
+	}
+	if _, err := LoadTLSClientIdentity(path, "wrong"); errorKindOf(err) != IncorrectPassword {
+		t.Errorf("got error %v for the wrong password", err)
+	}
+}
+
+func TestDecodeCache(t *testing.T) {
+	key, cert := newTestCertificate(t)
+	pfxData, err := Encode(rand.Reader, key, cert, nil, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache := NewDecodeCache(1, WithLeafInChain(true))
+	for i := 0; i < 2; i++ {
+		privateKey, _, caCerts, err := cache.Decode(pfxData, "password")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !key.Equal(privateKey) || len(caCerts) != 1 {
+			t.Error("decoded identity does not match")
+		}
+	}
+	if cache.Len() != 1 {
+		t.Errorf("got %d cached results, want 1", cache.Len())
+	}
+	if _, _, _, err := cache.Decode(pfxData, "wrong"); errorKindOf(err) != IncorrectPassword {
+		t.Errorf("got error %v for the wrong password", err)
+	}
+}
+
+func TestCredentialStore(t *testing.T) {
+	key, cert := newTestCertificate(t)
+	pfxData, err := Encode(rand.Reader, key, cert, nil, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "identity.p12")
+	if err := os.WriteFile(path, pfxData, 0600); err != nil {
+		t.Fatal(err)
+	}
+	store, err := NewCredentialStore(path, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !store.Certificate().Leaf.Equal(cert) {
+		t.Error("active identity does not match")
+	}
+
+	if err := os.WriteFile(path, []byte("not a PKCS#12 file"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Reload(); errorKindOf(err) != Malformed {
+		t.Errorf("got error %v reloading malformed input", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	errs := make(chan error, 1)
+	go store.Watch(ctx, time.Millisecond, func(err error) {
+		select {
+		case errs <- err:
+		default:
+		}
+	})
+	// Change the size of the file so that Watch reloads it.
+	if err := os.WriteFile(path, []byte("still not a PKCS#12 file"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-errs; errorKindOf(err) != Malformed {
+		t.Errorf("got error %v from Watch", err)
+	}
+	if !store.Certificate().Leaf.Equal(cert) {
+		t.Error("a failed reload replaced the active identity")
+	}
+}
+
+func TestCanary(t *testing.T) {
+	canary, err := NewCanary(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err := Decode(canary.PFXData, canary.Password); err != nil {
+		t.Fatal(err)
+	}
+	// A leak is reported as a *LeakError rather than wrapped in an *Error.
+	var leak *LeakError
+	if err := canary.Scan([]byte("password: " + canary.Password)); !errors.As(err, &leak) || errorKindOf(err) != 0 {
+		t.Errorf("got error %v for a leaked password, want a *LeakError", err)
+	}
+}
@@ -0,0 +1,159 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package brainpool implements the brainpoolP256r1, brainpoolP384r1 and
+// brainpoolP512r1 elliptic curves of RFC 5639.  The generic arithmetic of
+// elliptic.CurveParams requires a = -3, which does not hold for the r1
+// curves, so each is computed on its isomorphic twist t1, for which it
+// does.  Like elliptic.CurveParams, it is not constant-time.
+package brainpool
+
+import (
+	"crypto/elliptic"
+	"math/big"
+	"sync"
+)
+
+type rcurve struct {
+	params  *elliptic.CurveParams
+	twisted *elliptic.CurveParams
+
+	// z is the parameter of the isomorphism of RFC 5639, section 3, which
+	// maps (x, y) on the r1 curve to (x*z^2, y*z^3) on the t1 curve.
+	z2, z3, zInv2, zInv3 *big.Int
+}
+
+var (
+	once                   sync.Once
+	p256r1, p384r1, p512r1 *rcurve
+)
+
+func initAll() {
+	p256r1 = newCurve("brainpoolP256r1", 256,
+		"a9fb57dba1eea9bc3e660a909d838d726e3bf623d52620282013481d1f6e5377",
+		"a9fb57dba1eea9bc3e660a909d838d718c397aa3b561a6f7901e0e82974856a7",
+		"26dc5c6ce94a4b44f330b5d9bbd77cbf958416295cf7e1ce6bccdc18ff8c07b6",
+		"8bd2aeb9cb7e57cb2c4b482ffc81b7afb9de27e1e3bd23c23a4453bd9ace3262",
+		"547ef835c3dac4fd97f8461a14611dc9c27745132ded8e545c1d54c72f046997",
+		"3e2d4bd9597b58639ae7aa669cab9837cf5cf20a2c852d10f655668dfc150ef0")
+	p384r1 = newCurve("brainpoolP384r1", 384,
+		"8cb91e82a3386d280f5d6f7e50e641df152f7109ed5456b412b1da197fb71123acd3a729901d1a71874700133107ec53",
+		"8cb91e82a3386d280f5d6f7e50e641df152f7109ed5456b31f166e6cac0425a7cf3ab6af6b7fc3103b883202e9046565",
+		"04a8c7dd22ce28268b39b55416f0447c2fb77de107dcd2a62e880ea53eeb62d57cb4390295dbc9943ab78696fa504c11",
+		"1d1c64f068cf45ffa2a63a81b7c13f6b8847a3e77ef14fe3db7fcafe0cbd10e8e826e03436d646aaef87b2e247d4af1e",
+		"8abe1d7520f9c2a45cb1eb8e95cfd55262b70b29feec5864e19c054ff99129280e4646217791811142820341263c5315",
+		"41dfe8dd399331f7166a66076734a89cd0d2bcdb7d068e44e1f378f41ecbae97d2d63dbc87bccddccc5da39e8589291c")
+	p512r1 = newCurve("brainpoolP512r1", 512,
+		"aadd9db8dbe9c48b3fd4e6ae33c9fc07cb308db3b3c9d20ed6639cca703308717d4d9b009bc66842aecda12ae6a380e62881ff2f2d82c68528aa6056583a48f3",
+		"aadd9db8dbe9c48b3fd4e6ae33c9fc07cb308db3b3c9d20ed6639cca70330870553e5c414ca92619418661197fac10471db1d381085ddaddb58796829ca90069",
+		"3df91610a83441caea9863bc2ded5d5aa8253aa10a2ef1c98b9ac8b57f1117a72bf2c7b9e7c1ac4d77fc94cadc083e67984050b75ebae5dd2809bd638016f723",
+		"81aee4bdd82ed9645a21322e9c4c6a9385ed9f70b5d916c1b43b62eef4d0098eff3b1f78e2d0d48d50d1687b93b97d5f7c6d5047406a5e688b352209bcb9f822",
+		"7dde385d566332ecc0eabfa9cf7822fdf209f70024a57b1aa000c55b881f8111b2dcde494a5f485e5bca4bd88a2763aed1ca2b2fa8f0540678cd1e0f3ad80892",
+		"12ee58e6764838b69782136f0f2d3ba06e27695716054092e60a80bedb212b64e585d90bce13761f85c3f1d2a64e3be8fea2220f01eba5eeb0f35dbd29d922ab")
+}
+
+// newCurve returns the r1 curve with the given prime p, order n,
+// coefficient b, base point (gx, gy) and isomorphism parameter z, all
+// in hex.
+func newCurve(name string, bitSize int, p, n, b, gx, gy, z string) *rcurve {
+	c := &rcurve{params: &elliptic.CurveParams{
+		Name:    name,
+		BitSize: bitSize,
+		P:       fromHex(p),
+		N:       fromHex(n),
+		B:       fromHex(b),
+		Gx:      fromHex(gx),
+		Gy:      fromHex(gy),
+	}}
+	P := c.params.P
+	zz := fromHex(z)
+	c.z2 = new(big.Int).Exp(zz, big.NewInt(2), P)
+	c.z3 = new(big.Int).Exp(zz, big.NewInt(3), P)
+	zInv := new(big.Int).ModInverse(zz, P)
+	c.zInv2 = new(big.Int).Exp(zInv, big.NewInt(2), P)
+	c.zInv3 = new(big.Int).Exp(zInv, big.NewInt(3), P)
+
+	// The t1 curve has b_t = b*z^6 and the image of the r1 base point.
+	bt := new(big.Int).Mul(c.params.B, new(big.Int).Exp(zz, big.NewInt(6), P))
+	gxt, gyt := c.toTwisted(c.params.Gx, c.params.Gy)
+	c.twisted = &elliptic.CurveParams{
+		Name:    name,
+		BitSize: bitSize,
+		P:       P,
+		N:       c.params.N,
+		B:       bt.Mod(bt, P),
+		Gx:      gxt,
+		Gy:      gyt,
+	}
+	return c
+}
+
+func fromHex(s string) *big.Int {
+	n, ok := new(big.Int).SetString(s, 16)
+	if !ok {
+		panic("brainpool: invalid constant " + s)
+	}
+	return n
+}
+
+// P256r1 returns the brainpoolP256r1 curve.
+func P256r1() elliptic.Curve {
+	once.Do(initAll)
+	return p256r1
+}
+
+// P384r1 returns the brainpoolP384r1 curve.
+func P384r1() elliptic.Curve {
+	once.Do(initAll)
+	return p384r1
+}
+
+// P512r1 returns the brainpoolP512r1 curve.
+func P512r1() elliptic.Curve {
+	once.Do(initAll)
+	return p512r1
+}
+
+func (c *rcurve) toTwisted(x, y *big.Int) (*big.Int, *big.Int) {
+	return c.mulMod(x, c.z2), c.mulMod(y, c.z3)
+}
+
+func (c *rcurve) fromTwisted(x, y *big.Int) (*big.Int, *big.Int) {
+	return c.mulMod(x, c.zInv2), c.mulMod(y, c.zInv3)
+}
+
+func (c *rcurve) mulMod(a, b *big.Int) *big.Int {
+	r := new(big.Int).Mul(a, b)
+	return r.Mod(r, c.params.P)
+}
+
+// Params returns the parameters of the r1 curve, whose A is not -3, so
+// that their generic methods must not be used.
+func (c *rcurve) Params() *elliptic.CurveParams { return c.params }
+
+func (c *rcurve) IsOnCurve(x, y *big.Int) bool {
+	if x.Sign() < 0 || x.Cmp(c.params.P) >= 0 || y.Sign() < 0 || y.Cmp(c.params.P) >= 0 {
+		return false
+	}
+	return c.twisted.IsOnCurve(c.toTwisted(x, y))
+}
+
+func (c *rcurve) Add(x1, y1, x2, y2 *big.Int) (*big.Int, *big.Int) {
+	tx1, ty1 := c.toTwisted(x1, y1)
+	tx2, ty2 := c.toTwisted(x2, y2)
+	return c.fromTwisted(c.twisted.Add(tx1, ty1, tx2, ty2))
+}
+
+func (c *rcurve) Double(x1, y1 *big.Int) (*big.Int, *big.Int) {
+	return c.fromTwisted(c.twisted.Double(c.toTwisted(x1, y1)))
+}
+
+func (c *rcurve) ScalarMult(x1, y1 *big.Int, k []byte) (*big.Int, *big.Int) {
+	tx1, ty1 := c.toTwisted(x1, y1)
+	return c.fromTwisted(c.twisted.ScalarMult(tx1, ty1, k))
+}
+
+func (c *rcurve) ScalarBaseMult(k []byte) (*big.Int, *big.Int) {
+	return c.fromTwisted(c.twisted.ScalarBaseMult(k))
+}
@@ -0,0 +1,98 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package brainpool
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"math/big"
+	"testing"
+)
+
+// The keys and signatures over "brainpool test message" with SHA-256 were
+// generated with OpenSSL.
+var opensslTests = []struct {
+	curve       func() elliptic.Curve
+	d, pub, sig string
+}{
+	{
+		P256r1,
+		"95a68559e1becf15573c10e5763eb21f7befff1de4e1950ef229d631f4cfd54f",
+		"04796abf5b304d28a169dbdbb13d6d08dd7020e953f72827641889e0771ad5d25d9d49a10ea73150686a7cfc36bb3eaddcd62f557d19958ea277875f3df05ec42c",
+		"3044022011a4c59b5f709bc37f92672b7cfc07be9e090f5cfb07e14d2c475242c628812f0220364c86d70ad34a7e38380c1b511b5dc89beb12ab5bb2da5f543b9a1d48a425c9",
+	},
+	{
+		P384r1,
+		"6ac7b87ccfe63b9afd0d2d8bf7cae3ae36c77ca85334d96f1490bc88c1cf2ea958298c201ac06fc1ee100853777838d2",
+		"040e8a2ede0987579539e7c616b8be96a1e66e2c0401199325a2fb2a19a60fcdb28d7e6d110008b84c030c9f0faf7092408aeda3ae672efcf336b037f0351bc9a170c862f95edd1d60267171b6cfc2c5d81122a32bd8da0b876291bfbe518134ca",
+		"3064023057eb9a0610e32cc284adaa37ad2e10f9a01149b1ab921dd3108e88523b59094d0af8a09afe084c1a68ec47c6e1e5696f023021e167fa7d920cf54e4c13496c85dcf7e42cb70361fb72bf950b4b5c89e49c58f5545bdb8cfefbab38998e76e5b6b9df",
+	},
+	{
+		P512r1,
+		"7945e8147ccd4dbd28f521e3579bb3150772fc1b2277005e2f65f529ca2a0a384b61e5c6ad07e7cc5a16e9f00dc6e79db24f02ad86d8f2c1108e8f492db27aad",
+		"04103082d8116b5dd4573c5fe55c3a759efa15c858e0b3860ac1779024c9085798f149bd75c76d83571345f9124515cfd89b1ca1f9015f6031e1a2a71e7b5c0ba980b3dd20b80818f78c33986812e1f6c863f6288059c227cc44087ba3cf5ef7d15dbc9b6f424a79a50c6a628a57a4cbdf7fc84372cb0ea0856a335f66ee616690",
+		"3081850240278f7a1c28ef4e72ab8bae0bc96728830bb5d16f351ca6b5f54877051a160671797d5fa84c4b7a4032c18ef054ebc2539e1450fe64f9cec9ab6187a0e98feb7f024100a2ade0d18e1c502966bb1ff0662ab584afb627232dff4e2e57e587b90e281d8d5f81b3c2b42b6cd0cb36c072751bd730cabaa6abb80457535d51658f8be4fe9b",
+	},
+}
+
+func fromHexBytes(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+func TestOpenSSL(t *testing.T) {
+	digest := sha256.Sum256([]byte("brainpool test message"))
+	for _, test := range opensslTests {
+		curve := test.curve()
+		t.Run(curve.Params().Name, func(t *testing.T) {
+			params := curve.Params()
+			if !curve.IsOnCurve(params.Gx, params.Gy) {
+				t.Fatal("base point is not on the curve")
+			}
+			x, y := curve.ScalarBaseMult(fromHexBytes(test.d))
+			if got := elliptic.Marshal(curve, x, y); !bytes.Equal(got, fromHexBytes(test.pub)) {
+				t.Fatalf("got public key %x, want %s", got, test.pub)
+			}
+			if !curve.IsOnCurve(x, y) {
+				t.Error("public key is not on the curve")
+			}
+			if x1, y1 := curve.Add(x, y, x, y); !bigEqual(curve.Double(x, y))(x1, y1) {
+				t.Error("P+P differs from 2P")
+			}
+			if x1, y1 := curve.ScalarMult(params.Gx, params.Gy, params.N.Bytes()); x1.Sign() != 0 || y1.Sign() != 0 {
+				t.Error("nG is not the point at infinity")
+			}
+
+			pub := &ecdsa.PublicKey{Curve: curve, X: x, Y: y}
+			if !ecdsa.VerifyASN1(pub, digest[:], fromHexBytes(test.sig)) {
+				t.Error("OpenSSL signature does not verify")
+			}
+			priv := &ecdsa.PrivateKey{PublicKey: *pub, D: new(big.Int).SetBytes(fromHexBytes(test.d))}
+			sig, err := ecdsa.SignASN1(rand.Reader, priv, digest[:])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !ecdsa.VerifyASN1(pub, digest[:], sig) {
+				t.Error("signature does not verify")
+			}
+			digest[0] ^= 1
+			if ecdsa.VerifyASN1(pub, digest[:], sig) {
+				t.Error("signature verifies for another digest")
+			}
+			digest[0] ^= 1
+		})
+	}
+}
+
+func bigEqual(x0, y0 *big.Int) func(x1, y1 *big.Int) bool {
+	return func(x1, y1 *big.Int) bool { return x0.Cmp(x1) == 0 && y0.Cmp(y1) == 0 }
+}
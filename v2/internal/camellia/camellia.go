@@ -0,0 +1,212 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package camellia implements the Camellia block cipher specified in
+// RFC 3713.
+package camellia
+
+import (
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"math/bits"
+)
+
+// BlockSize is the Camellia block size in bytes.
+const BlockSize = 16
+
+type camelliaCipher struct {
+	// The subkeys in encryption order, and in decryption order.
+	enc, dec subkeys
+}
+
+// subkeys are the whitening keys kw1 to kw4, the round keys k1 to k18 or
+// k24, and the FL/FL^-1 keys ke1 to ke4 or ke6.
+type subkeys struct {
+	kw [4]uint64
+	k  []uint64
+	ke []uint64
+}
+
+var sigma = [6]uint64{
+	0xa09e667f3bcc908b, 0xb67ae8584caa73b2, 0xc6ef372fe94f82be,
+	0x54ff53a5f1d36f1c, 0x10e527fade682d1d, 0xb05688c2b3e6c1fd,
+}
+
+// NewCipher returns a Camellia cipher keyed with key, which must be 16, 24
+// or 32 bytes long.
+func NewCipher(key []byte) (cipher.Block, error) {
+	var kl, kr [2]uint64
+	switch len(key) {
+	case 16:
+		kl = [2]uint64{binary.BigEndian.Uint64(key), binary.BigEndian.Uint64(key[8:])}
+	case 24:
+		kl = [2]uint64{binary.BigEndian.Uint64(key), binary.BigEndian.Uint64(key[8:])}
+		r := binary.BigEndian.Uint64(key[16:])
+		kr = [2]uint64{r, ^r}
+	case 32:
+		kl = [2]uint64{binary.BigEndian.Uint64(key), binary.BigEndian.Uint64(key[8:])}
+		kr = [2]uint64{binary.BigEndian.Uint64(key[16:]), binary.BigEndian.Uint64(key[24:])}
+	default:
+		return nil, errors.New("camellia: invalid key size")
+	}
+
+	d1, d2 := kl[0]^kr[0], kl[1]^kr[1]
+	d2 ^= f(d1, sigma[0])
+	d1 ^= f(d2, sigma[1])
+	d1 ^= kl[0]
+	d2 ^= kl[1]
+	d2 ^= f(d1, sigma[2])
+	d1 ^= f(d2, sigma[3])
+	ka := [2]uint64{d1, d2}
+
+	c := new(camelliaCipher)
+	if len(key) == 16 {
+		c.enc.kw = [4]uint64{kl[0], kl[1], rotHi(ka, 111), rotLo(ka, 111)}
+		c.enc.k = []uint64{
+			ka[0], ka[1], rotHi(kl, 15), rotLo(kl, 15), rotHi(ka, 15), rotLo(ka, 15),
+			rotHi(kl, 45), rotLo(kl, 45), rotHi(ka, 45), rotLo(kl, 60), rotHi(ka, 60), rotLo(ka, 60),
+			rotHi(kl, 94), rotLo(kl, 94), rotHi(ka, 94), rotLo(ka, 94), rotHi(kl, 111), rotLo(kl, 111),
+		}
+		c.enc.ke = []uint64{rotHi(ka, 30), rotLo(ka, 30), rotHi(kl, 77), rotLo(kl, 77)}
+	} else {
+		d1, d2 = ka[0]^kr[0], ka[1]^kr[1]
+		d2 ^= f(d1, sigma[4])
+		d1 ^= f(d2, sigma[5])
+		kb := [2]uint64{d1, d2}
+
+		c.enc.kw = [4]uint64{kl[0], kl[1], rotHi(kb, 111), rotLo(kb, 111)}
+		c.enc.k = []uint64{
+			kb[0], kb[1], rotHi(kr, 15), rotLo(kr, 15), rotHi(ka, 15), rotLo(ka, 15),
+			rotHi(kb, 30), rotLo(kb, 30), rotHi(kl, 45), rotLo(kl, 45), rotHi(ka, 45), rotLo(ka, 45),
+			rotHi(kr, 60), rotLo(kr, 60), rotHi(kb, 60), rotLo(kb, 60), rotHi(kl, 77), rotLo(kl, 77),
+			rotHi(kr, 94), rotLo(kr, 94), rotHi(ka, 94), rotLo(ka, 94), rotHi(kl, 111), rotLo(kl, 111),
+		}
+		c.enc.ke = []uint64{
+			rotHi(kr, 30), rotLo(kr, 30), rotHi(kl, 60), rotLo(kl, 60), rotHi(ka, 77), rotLo(ka, 77),
+		}
+	}
+
+	// Decryption uses the same subkeys in reverse order.
+	c.dec.kw = [4]uint64{c.enc.kw[2], c.enc.kw[3], c.enc.kw[0], c.enc.kw[1]}
+	c.dec.k = reversed(c.enc.k)
+	c.dec.ke = reversed(c.enc.ke)
+	return c, nil
+}
+
+func (*camelliaCipher) BlockSize() int { return BlockSize }
+
+func (c *camelliaCipher) Encrypt(dst, src []byte) { crypt(&c.enc, dst, src) }
+
+func (c *camelliaCipher) Decrypt(dst, src []byte) { crypt(&c.dec, dst, src) }
+
+func crypt(s *subkeys, dst, src []byte) {
+	if len(src) < BlockSize || len(dst) < BlockSize {
+		panic("camellia: input not full block")
+	}
+	d1 := binary.BigEndian.Uint64(src) ^ s.kw[0]
+	d2 := binary.BigEndian.Uint64(src[8:]) ^ s.kw[1]
+	for i := 0; i < len(s.k); i += 6 {
+		if i > 0 {
+			d1 = fl(d1, s.ke[i/3-2])
+			d2 = flInv(d2, s.ke[i/3-1])
+		}
+		d2 ^= f(d1, s.k[i])
+		d1 ^= f(d2, s.k[i+1])
+		d2 ^= f(d1, s.k[i+2])
+		d1 ^= f(d2, s.k[i+3])
+		d2 ^= f(d1, s.k[i+4])
+		d1 ^= f(d2, s.k[i+5])
+	}
+	binary.BigEndian.PutUint64(dst, d2^s.kw[2])
+	binary.BigEndian.PutUint64(dst[8:], d1^s.kw[3])
+}
+
+// f is the F-function of RFC 3713, section 2.4.1.
+func f(in, ke uint64) uint64 {
+	x := in ^ ke
+	t1 := sbox1[x>>56]
+	t2 := sbox2(byte(x >> 48))
+	t3 := sbox3(byte(x >> 40))
+	t4 := sbox4(byte(x >> 32))
+	t5 := sbox2(byte(x >> 24))
+	t6 := sbox3(byte(x >> 16))
+	t7 := sbox4(byte(x >> 8))
+	t8 := sbox1[byte(x)]
+	y1 := t1 ^ t3 ^ t4 ^ t6 ^ t7 ^ t8
+	y2 := t1 ^ t2 ^ t4 ^ t5 ^ t7 ^ t8
+	y3 := t1 ^ t2 ^ t3 ^ t5 ^ t6 ^ t8
+	y4 := t2 ^ t3 ^ t4 ^ t5 ^ t6 ^ t7
+	y5 := t1 ^ t2 ^ t6 ^ t7 ^ t8
+	y6 := t2 ^ t3 ^ t5 ^ t7 ^ t8
+	y7 := t3 ^ t4 ^ t5 ^ t6 ^ t8
+	y8 := t1 ^ t4 ^ t5 ^ t6 ^ t7
+	return uint64(y1)<<56 | uint64(y2)<<48 | uint64(y3)<<40 | uint64(y4)<<32 |
+		uint64(y5)<<24 | uint64(y6)<<16 | uint64(y7)<<8 | uint64(y8)
+}
+
+// fl and flInv are the FL- and FL^-1-functions of RFC 3713, sections 2.4.2
+// and 2.4.3.
+func fl(in, ke uint64) uint64 {
+	x1, x2 := uint32(in>>32), uint32(in)
+	k1, k2 := uint32(ke>>32), uint32(ke)
+	x2 ^= bits.RotateLeft32(x1&k1, 1)
+	x1 ^= x2 | k2
+	return uint64(x1)<<32 | uint64(x2)
+}
+
+func flInv(in, ke uint64) uint64 {
+	y1, y2 := uint32(in>>32), uint32(in)
+	k1, k2 := uint32(ke>>32), uint32(ke)
+	y1 ^= y2 | k2
+	y2 ^= bits.RotateLeft32(y1&k1, 1)
+	return uint64(y1)<<32 | uint64(y2)
+}
+
+// rotHi and rotLo return the high and low halves of the 128-bit value x
+// rotated left by n bits.
+func rotHi(x [2]uint64, n uint) uint64 {
+	if n >= 64 {
+		x[0], x[1], n = x[1], x[0], n-64
+	}
+	if n == 0 {
+		return x[0]
+	}
+	return x[0]<<n | x[1]>>(64-n)
+}
+
+func rotLo(x [2]uint64, n uint) uint64 {
+	return rotHi([2]uint64{x[1], x[0]}, n)
+}
+
+func reversed(s []uint64) []uint64 {
+	r := make([]uint64, len(s))
+	for i, v := range s {
+		r[len(s)-1-i] = v
+	}
+	return r
+}
+
+func sbox2(x byte) byte { return bits.RotateLeft8(sbox1[x], 1) }
+func sbox3(x byte) byte { return bits.RotateLeft8(sbox1[x], 7) }
+func sbox4(x byte) byte { return sbox1[bits.RotateLeft8(x, 1)] }
+
+var sbox1 = [256]byte{
+	112, 130, 44, 236, 179, 39, 192, 229, 228, 133, 87, 53, 234, 12, 174, 65,
+	35, 239, 107, 147, 69, 25, 165, 33, 237, 14, 79, 78, 29, 101, 146, 189,
+	134, 184, 175, 143, 124, 235, 31, 206, 62, 48, 220, 95, 94, 197, 11, 26,
+	166, 225, 57, 202, 213, 71, 93, 61, 217, 1, 90, 214, 81, 86, 108, 77,
+	139, 13, 154, 102, 251, 204, 176, 45, 116, 18, 43, 32, 240, 177, 132, 153,
+	223, 76, 203, 194, 52, 126, 118, 5, 109, 183, 169, 49, 209, 23, 4, 215,
+	20, 88, 58, 97, 222, 27, 17, 28, 50, 15, 156, 22, 83, 24, 242, 34,
+	254, 68, 207, 178, 195, 181, 122, 145, 36, 8, 232, 168, 96, 252, 105, 80,
+	170, 208, 160, 125, 161, 137, 98, 151, 84, 91, 30, 149, 224, 255, 100, 210,
+	16, 196, 0, 72, 163, 247, 117, 219, 138, 3, 230, 218, 9, 63, 221, 148,
+	135, 92, 131, 2, 205, 74, 144, 51, 115, 103, 246, 243, 157, 127, 191, 226,
+	82, 155, 216, 38, 200, 55, 198, 59, 129, 150, 111, 75, 19, 190, 99, 46,
+	233, 121, 167, 140, 159, 110, 188, 142, 41, 245, 249, 182, 47, 253, 180, 89,
+	120, 152, 6, 106, 231, 70, 113, 186, 212, 37, 171, 66, 136, 162, 141, 250,
+	114, 7, 185, 85, 248, 238, 172, 10, 54, 73, 42, 104, 60, 56, 241, 164,
+	64, 40, 211, 123, 187, 201, 67, 193, 21, 227, 173, 244, 119, 199, 128, 158,
+}
@@ -0,0 +1,51 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package camellia
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func TestVectors(t *testing.T) {
+	// The first three are from RFC 3713, appendix A; the last was
+	// produced by "openssl enc -camellia-192-ecb".
+	var tests = []struct {
+		key, plaintext, ciphertext string
+	}{
+		{"0123456789abcdeffedcba9876543210", "0123456789abcdeffedcba9876543210", "67673138549669730857065648eabe43"},
+		{"0123456789abcdeffedcba98765432100011223344556677", "0123456789abcdeffedcba9876543210", "b4993401b3e996f84ee5cee7d79b09b9"},
+		{"0123456789abcdeffedcba987654321000112233445566778899aabbccddeeff", "0123456789abcdeffedcba9876543210", "9acc237dff16d76c20ef7c919e3a7509"},
+		{"364d645e07ab86b93706f341a1387995904074bc2dcdea9c", "2e1ca5ccb883707360e9b1042ae0faaa", "2c71c192bb780936042657c582542e87"},
+	}
+	for _, test := range tests {
+		key, _ := hex.DecodeString(test.key)
+		plaintext, _ := hex.DecodeString(test.plaintext)
+		ciphertext, _ := hex.DecodeString(test.ciphertext)
+
+		c, err := NewCipher(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := make([]byte, BlockSize)
+		c.Encrypt(got, plaintext)
+		if !bytes.Equal(got, ciphertext) {
+			t.Errorf("key %s: got ciphertext %x, want %x", test.key, got, ciphertext)
+		}
+		c.Decrypt(got, ciphertext)
+		if !bytes.Equal(got, plaintext) {
+			t.Errorf("key %s: got plaintext %x, want %x", test.key, got, plaintext)
+		}
+	}
+}
+
+func TestInvalidKeySize(t *testing.T) {
+	for _, n := range []int{0, 8, 15, 17, 33} {
+		if _, err := NewCipher(make([]byte, n)); err == nil {
+			t.Errorf("%d-byte key: no error", n)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package ccm implements the CCM mode of operation for 128-bit block
+// ciphers, as specified in NIST SP 800-38C and RFC 3610.
+package ccm
+
+import (
+	"crypto/cipher"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+)
+
+const blockSize = 16
+
+type ccm struct {
+	block     cipher.Block
+	nonceSize int
+	tagSize   int
+}
+
+// New returns block wrapped in CCM mode with the given nonce and tag sizes,
+// in bytes.  The nonce size must be between 7 and 13, and the tag size an
+// even number between 4 and 16.
+func New(block cipher.Block, nonceSize, tagSize int) (cipher.AEAD, error) {
+	if block.BlockSize() != blockSize {
+		return nil, errors.New("ccm: block size must be 16 bytes")
+	}
+	if nonceSize < 7 || nonceSize > 13 {
+		return nil, errors.New("ccm: invalid nonce size")
+	}
+	if tagSize < 4 || tagSize > 16 || tagSize%2 != 0 {
+		return nil, errors.New("ccm: invalid tag size")
+	}
+	return &ccm{block: block, nonceSize: nonceSize, tagSize: tagSize}, nil
+}
+
+func (c *ccm) NonceSize() int { return c.nonceSize }
+
+func (c *ccm) Overhead() int { return c.tagSize }
+
+// maxLength returns the largest message length which can be encoded in the
+// length field left over by the nonce.
+func (c *ccm) maxLength() uint64 {
+	if q := 15 - c.nonceSize; q < 8 {
+		return 1<<(8*uint(q)) - 1
+	}
+	return 1<<64 - 1
+}
+
+// counter sets ctr to the counter block with index i.
+func (c *ccm) counter(ctr *[blockSize]byte, nonce []byte, i uint64) {
+	q := 15 - c.nonceSize
+	ctr[0] = byte(q - 1)
+	copy(ctr[1:], nonce)
+	for j := blockSize - 1; j > c.nonceSize; j-- {
+		ctr[j] = byte(i)
+		i >>= 8
+	}
+}
+
+// crypt XORs src with the key stream starting at counter block 1.
+func (c *ccm) crypt(dst, src, nonce []byte) {
+	var ctr, stream [blockSize]byte
+	for i := uint64(1); len(src) > 0; i++ {
+		c.counter(&ctr, nonce, i)
+		c.block.Encrypt(stream[:], ctr[:])
+		n := subtle.XORBytes(dst, src, stream[:])
+		dst, src = dst[n:], src[n:]
+	}
+}
+
+// mac returns the encrypted authentication tag of plaintext and data.
+func (c *ccm) mac(nonce, plaintext, data []byte) []byte {
+	var x, b [blockSize]byte
+	q := 15 - c.nonceSize
+
+	b[0] = byte(8*((c.tagSize-2)/2) + (q - 1))
+	if len(data) > 0 {
+		b[0] |= 0x40
+	}
+	copy(b[1:], nonce)
+	length := uint64(len(plaintext))
+	for j := blockSize - 1; j > c.nonceSize; j-- {
+		b[j] = byte(length)
+		length >>= 8
+	}
+	c.block.Encrypt(x[:], b[:])
+
+	absorb := func(p []byte) {
+		for len(p) > 0 {
+			n := subtle.XORBytes(x[:], x[:], p)
+			c.block.Encrypt(x[:], x[:])
+			p = p[n:]
+		}
+	}
+
+	if len(data) > 0 {
+		var header []byte
+		switch n := uint64(len(data)); {
+		case n < 0xff00:
+			header = binary.BigEndian.AppendUint16(nil, uint16(n))
+		case n <= 0xffffffff:
+			header = binary.BigEndian.AppendUint32([]byte{0xff, 0xfe}, uint32(n))
+		default:
+			header = binary.BigEndian.AppendUint64([]byte{0xff, 0xff}, n)
+		}
+		aad := append(header, data...)
+		if r := len(aad) % blockSize; r != 0 {
+			aad = append(aad, make([]byte, blockSize-r)...)
+		}
+		absorb(aad)
+	}
+	absorb(plaintext)
+
+	var ctr, s0 [blockSize]byte
+	c.counter(&ctr, nonce, 0)
+	c.block.Encrypt(s0[:], ctr[:])
+	tag := make([]byte, c.tagSize)
+	subtle.XORBytes(tag, x[:c.tagSize], s0[:c.tagSize])
+	return tag
+}
+
+func (c *ccm) Seal(dst, nonce, plaintext, data []byte) []byte {
+	if len(nonce) != c.nonceSize {
+		panic("ccm: incorrect nonce length")
+	}
+	if uint64(len(plaintext)) > c.maxLength() {
+		panic("ccm: message too large")
+	}
+	tag := c.mac(nonce, plaintext, data)
+	ret, out := sliceForAppend(dst, len(plaintext)+c.tagSize)
+	c.crypt(out, plaintext, nonce)
+	copy(out[len(plaintext):], tag)
+	return ret
+}
+
+var errOpen = errors.New("ccm: message authentication failed")
+
+func (c *ccm) Open(dst, nonce, ciphertext, data []byte) ([]byte, error) {
+	if len(nonce) != c.nonceSize {
+		panic("ccm: incorrect nonce length")
+	}
+	if len(ciphertext) < c.tagSize || uint64(len(ciphertext)-c.tagSize) > c.maxLength() {
+		return nil, errOpen
+	}
+	tag := ciphertext[len(ciphertext)-c.tagSize:]
+	ciphertext = ciphertext[:len(ciphertext)-c.tagSize]
+
+	ret, out := sliceForAppend(dst, len(ciphertext))
+	c.crypt(out, ciphertext, nonce)
+	if subtle.ConstantTimeCompare(c.mac(nonce, out, data), tag) != 1 {
+		clear(out)
+		return nil, errOpen
+	}
+	return ret, nil
+}
+
+// sliceForAppend extends in by n bytes, returning the whole slice and the
+// extension.
+func sliceForAppend(in []byte, n int) (head, tail []byte) {
+	if total := len(in) + n; cap(in) >= total {
+		head = in[:total]
+	} else {
+		head = make([]byte, total)
+		copy(head, in)
+	}
+	tail = head[len(in):]
+	return
+}
@@ -0,0 +1,77 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ccm
+
+import (
+	"bytes"
+	"crypto/aes"
+	"encoding/hex"
+	"testing"
+)
+
+func TestVectors(t *testing.T) {
+	// NIST SP 800-38C, Appendix C.
+	var tests = []struct {
+		key, nonce, data, plain, cipher string
+		tagSize                         int
+	}{
+		{
+			"404142434445464748494a4b4c4d4e4f",
+			"10111213141516",
+			"0001020304050607",
+			"20212223",
+			"7162015b4dac255d",
+			4,
+		},
+		{
+			"404142434445464748494a4b4c4d4e4f",
+			"1011121314151617",
+			"000102030405060708090a0b0c0d0e0f",
+			"202122232425262728292a2b2c2d2e2f",
+			"d2a1f0e051ea5f62081a7792073d593d1fc64fbfaccd",
+			6,
+		},
+		{
+			"404142434445464748494a4b4c4d4e4f",
+			"101112131415161718191a1b",
+			"000102030405060708090a0b0c0d0e0f10111213",
+			"202122232425262728292a2b2c2d2e2f3031323334353637",
+			"e3b201a9f5b71a7a9b1ceaeccd97e70b6176aad9a4428aa5484392fbc1b09951",
+			8,
+		},
+	}
+
+	for i, test := range tests {
+		key, _ := hex.DecodeString(test.key)
+		nonce, _ := hex.DecodeString(test.nonce)
+		data, _ := hex.DecodeString(test.data)
+		plain, _ := hex.DecodeString(test.plain)
+		want, _ := hex.DecodeString(test.cipher)
+
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		aead, err := New(block, len(nonce), test.tagSize)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := aead.Seal(nil, nonce, plain, data)
+		if !bytes.Equal(got, want) {
+			t.Errorf("#%d: Seal = %x, want %x", i, got, want)
+		}
+		opened, err := aead.Open(nil, nonce, want, data)
+		if err != nil {
+			t.Errorf("#%d: Open: %v", i, err)
+		} else if !bytes.Equal(opened, plain) {
+			t.Errorf("#%d: Open = %x, want %x", i, opened, plain)
+		}
+
+		want[0] ^= 1
+		if _, err := aead.Open(nil, nonce, want, data); err == nil {
+			t.Errorf("#%d: Open accepted modified ciphertext", i)
+		}
+	}
+}
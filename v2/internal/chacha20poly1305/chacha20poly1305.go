@@ -0,0 +1,266 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package chacha20poly1305 implements the ChaCha20-Poly1305 AEAD of RFC
+// 8439, which is not in the standard library.  It favors simplicity over
+// speed.
+package chacha20poly1305
+
+import (
+	"crypto/cipher"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"math/bits"
+)
+
+const (
+	// KeySize is the size of the key in bytes.
+	KeySize = 32
+
+	// NonceSize is the size of the nonce in bytes.
+	NonceSize = 12
+
+	// Overhead is the size of the Poly1305 tag in bytes.
+	Overhead = 16
+
+	blockSize = 64
+
+	// maxLength is the longest plaintext that can be encrypted before
+	// the 32-bit block counter, which starts at 1, wraps.
+	maxLength = (1<<32 - 1) * blockSize
+)
+
+type chacha20poly1305 struct {
+	key [8]uint32
+}
+
+// New returns ChaCha20-Poly1305 keyed with the 32-byte key.
+func New(key []byte) (cipher.AEAD, error) {
+	if len(key) != KeySize {
+		return nil, errors.New("chacha20poly1305: bad key length")
+	}
+	c := new(chacha20poly1305)
+	for i := range c.key {
+		c.key[i] = binary.LittleEndian.Uint32(key[4*i:])
+	}
+	return c, nil
+}
+
+func (c *chacha20poly1305) NonceSize() int { return NonceSize }
+
+func (c *chacha20poly1305) Overhead() int { return Overhead }
+
+// block sets out to the ChaCha20 block with the given counter and nonce,
+// RFC 8439 section 2.3.
+func (c *chacha20poly1305) block(out *[blockSize]byte, counter uint32, nonce []byte) {
+	state := [16]uint32{
+		0x61707865, 0x3320646e, 0x79622d32, 0x6b206574,
+		c.key[0], c.key[1], c.key[2], c.key[3],
+		c.key[4], c.key[5], c.key[6], c.key[7],
+		counter,
+		binary.LittleEndian.Uint32(nonce[0:]),
+		binary.LittleEndian.Uint32(nonce[4:]),
+		binary.LittleEndian.Uint32(nonce[8:]),
+	}
+	x := state
+	quarterRound := func(a, b, c, d int) {
+		x[a] += x[b]
+		x[d] = bits.RotateLeft32(x[d]^x[a], 16)
+		x[c] += x[d]
+		x[b] = bits.RotateLeft32(x[b]^x[c], 12)
+		x[a] += x[b]
+		x[d] = bits.RotateLeft32(x[d]^x[a], 8)
+		x[c] += x[d]
+		x[b] = bits.RotateLeft32(x[b]^x[c], 7)
+	}
+	for i := 0; i < 10; i++ {
+		quarterRound(0, 4, 8, 12)
+		quarterRound(1, 5, 9, 13)
+		quarterRound(2, 6, 10, 14)
+		quarterRound(3, 7, 11, 15)
+		quarterRound(0, 5, 10, 15)
+		quarterRound(1, 6, 11, 12)
+		quarterRound(2, 7, 8, 13)
+		quarterRound(3, 4, 9, 14)
+	}
+	for i := range x {
+		binary.LittleEndian.PutUint32(out[4*i:], x[i]+state[i])
+	}
+}
+
+// crypt XORs src with the key stream starting at block 1.
+func (c *chacha20poly1305) crypt(dst, src, nonce []byte) {
+	var stream [blockSize]byte
+	for counter := uint32(1); len(src) > 0; counter++ {
+		c.block(&stream, counter, nonce)
+		n := subtle.XORBytes(dst, src, stream[:])
+		dst, src = dst[n:], src[n:]
+	}
+}
+
+// tag returns the Poly1305 tag of ciphertext and data, RFC 8439 section
+// 2.8.
+func (c *chacha20poly1305) tag(nonce, ciphertext, data []byte) [Overhead]byte {
+	var otk [blockSize]byte
+	c.block(&otk, 0, nonce)
+	p := newPoly1305(otk[:32])
+	p.writePadded(data)
+	p.writePadded(ciphertext)
+	var lengths [16]byte
+	binary.LittleEndian.PutUint64(lengths[0:], uint64(len(data)))
+	binary.LittleEndian.PutUint64(lengths[8:], uint64(len(ciphertext)))
+	p.writePadded(lengths[:])
+	return p.sum()
+}
+
+func (c *chacha20poly1305) Seal(dst, nonce, plaintext, data []byte) []byte {
+	if len(nonce) != NonceSize {
+		panic("chacha20poly1305: incorrect nonce length")
+	}
+	if uint64(len(plaintext)) > maxLength {
+		panic("chacha20poly1305: message too large")
+	}
+	ret, out := sliceForAppend(dst, len(plaintext)+Overhead)
+	c.crypt(out, plaintext, nonce)
+	tag := c.tag(nonce, out[:len(plaintext)], data)
+	copy(out[len(plaintext):], tag[:])
+	return ret
+}
+
+var errOpen = errors.New("chacha20poly1305: message authentication failed")
+
+func (c *chacha20poly1305) Open(dst, nonce, ciphertext, data []byte) ([]byte, error) {
+	if len(nonce) != NonceSize {
+		panic("chacha20poly1305: incorrect nonce length")
+	}
+	if len(ciphertext) < Overhead || uint64(len(ciphertext)-Overhead) > maxLength {
+		return nil, errOpen
+	}
+	tag := ciphertext[len(ciphertext)-Overhead:]
+	ciphertext = ciphertext[:len(ciphertext)-Overhead]
+
+	want := c.tag(nonce, ciphertext, data)
+	if subtle.ConstantTimeCompare(want[:], tag) != 1 {
+		return nil, errOpen
+	}
+	ret, out := sliceForAppend(dst, len(ciphertext))
+	c.crypt(out, ciphertext, nonce)
+	return ret, nil
+}
+
+// poly1305 is the one-time authenticator of RFC 8439 section 2.5, with the
+// accumulator and key held in 26-bit limbs.
+type poly1305 struct {
+	r, h [5]uint64
+	s    [4]uint32
+}
+
+func newPoly1305(key []byte) *poly1305 {
+	p := new(poly1305)
+	p.r[0] = uint64(binary.LittleEndian.Uint32(key[0:])) & 0x3ffffff
+	p.r[1] = uint64(binary.LittleEndian.Uint32(key[3:])>>2) & 0x3ffff03
+	p.r[2] = uint64(binary.LittleEndian.Uint32(key[6:])>>4) & 0x3ffc0ff
+	p.r[3] = uint64(binary.LittleEndian.Uint32(key[9:])>>6) & 0x3f03fff
+	p.r[4] = uint64(binary.LittleEndian.Uint32(key[12:])>>8) & 0x00fffff
+	for i := range p.s {
+		p.s[i] = binary.LittleEndian.Uint32(key[16+4*i:])
+	}
+	return p
+}
+
+// writePadded absorbs msg followed by zeros up to a multiple of 16 bytes.
+func (p *poly1305) writePadded(msg []byte) {
+	for len(msg) > 0 {
+		var block [16]byte
+		n := copy(block[:], msg)
+		msg = msg[n:]
+		p.absorb(&block)
+	}
+}
+
+// absorb adds the full 16-byte block to the accumulator and multiplies it
+// by r, modulo 2^130 - 5.
+func (p *poly1305) absorb(block *[16]byte) {
+	const mask = 0x3ffffff
+	r0, r1, r2, r3, r4 := p.r[0], p.r[1], p.r[2], p.r[3], p.r[4]
+	s1, s2, s3, s4 := r1*5, r2*5, r3*5, r4*5
+
+	h0 := p.h[0] + uint64(binary.LittleEndian.Uint32(block[0:]))&mask
+	h1 := p.h[1] + uint64(binary.LittleEndian.Uint32(block[3:])>>2)&mask
+	h2 := p.h[2] + uint64(binary.LittleEndian.Uint32(block[6:])>>4)&mask
+	h3 := p.h[3] + uint64(binary.LittleEndian.Uint32(block[9:])>>6)&mask
+	h4 := p.h[4] + (uint64(binary.LittleEndian.Uint32(block[12:])>>8) | 1<<24)
+
+	d0 := h0*r0 + h1*s4 + h2*s3 + h3*s2 + h4*s1
+	d1 := h0*r1 + h1*r0 + h2*s4 + h3*s3 + h4*s2
+	d2 := h0*r2 + h1*r1 + h2*r0 + h3*s4 + h4*s3
+	d3 := h0*r3 + h1*r2 + h2*r1 + h3*r0 + h4*s4
+	d4 := h0*r4 + h1*r3 + h2*r2 + h3*r1 + h4*r0
+
+	d1 += d0 >> 26
+	d2 += d1 >> 26
+	d3 += d2 >> 26
+	d4 += d3 >> 26
+	h0 = d0&mask + (d4>>26)*5
+	p.h = [5]uint64{h0 & mask, d1&mask + h0>>26, d2 & mask, d3 & mask, d4 & mask}
+}
+
+// sum returns the tag: the accumulator fully reduced, plus s.
+func (p *poly1305) sum() [Overhead]byte {
+	const mask = 0x3ffffff
+	h0, h1, h2, h3, h4 := p.h[0], p.h[1], p.h[2], p.h[3], p.h[4]
+	h2 += h1 >> 26
+	h1 &= mask
+	h3 += h2 >> 26
+	h2 &= mask
+	h4 += h3 >> 26
+	h3 &= mask
+	h0 += (h4 >> 26) * 5
+	h4 &= mask
+	h1 += h0 >> 26
+	h0 &= mask
+
+	// Compute h - (2^130 - 5) and keep it if it is not negative.
+	g0 := h0 + 5
+	g1 := h1 + g0>>26
+	g2 := h2 + g1>>26
+	g3 := h3 + g2>>26
+	g4 := h4 + g3>>26 - 1<<26
+	g0, g1, g2, g3 = g0&mask, g1&mask, g2&mask, g3&mask
+	keep := g4>>63 - 1 // all ones if g4 is not negative
+	h0 = h0&^keep | g0&keep
+	h1 = h1&^keep | g1&keep
+	h2 = h2&^keep | g2&keep
+	h3 = h3&^keep | g3&keep
+	h4 = h4&^keep | g4&keep
+
+	words := [4]uint64{
+		(h0 | h1<<26) & 0xffffffff,
+		(h1>>6 | h2<<20) & 0xffffffff,
+		(h2>>12 | h3<<14) & 0xffffffff,
+		(h3>>18 | h4<<8) & 0xffffffff,
+	}
+	var tag [Overhead]byte
+	var carry uint64
+	for i, w := range words {
+		f := w + uint64(p.s[i]) + carry
+		binary.LittleEndian.PutUint32(tag[4*i:], uint32(f))
+		carry = f >> 32
+	}
+	return tag
+}
+
+// sliceForAppend extends in by n bytes, returning the whole slice and the
+// extension.
+func sliceForAppend(in []byte, n int) (head, tail []byte) {
+	if total := len(in) + n; cap(in) >= total {
+		head = in[:total]
+	} else {
+		head = make([]byte, total)
+		copy(head, in)
+	}
+	tail = head[len(in):]
+	return
+}
@@ -0,0 +1,533 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"crypto"
+	"crypto/aes"
+	"crypto/hmac"
+	cryptorand "crypto/rand"
+	"crypto/sha512"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/scholar-ink/go-pkcs12/v2/internal/ccm"
+	"github.com/scholar-ink/go-pkcs12/v2/oids"
+)
+
+// BCFKS is the FIPS keystore format of Bouncy Castle, described by the
+// ASN.1 module in org.bouncycastle.asn1.bc.  Its store and its private keys
+// are encrypted with PBES2 (PBKDF2 with HMAC-SHA-512 and AES-256-CCM), and
+// it is authenticated with HMAC-SHA-512.  Each key is derived from the
+// password and a purpose string, both encoded as in PKCS#12.
+//
+// The implementation follows that ASN.1 module, but has only been tested
+// against keystores written by this package, not against keystores
+// written by Bouncy Castle itself.
+
+// Object types of BCFKS ObjectData.
+const (
+	bcfksCertificate         = 0
+	bcfksPrivateKey          = 1
+	bcfksSecretKey           = 2
+	bcfksProtectedPrivateKey = 3
+	bcfksProtectedSecretKey  = 4
+)
+
+// Parameters of the BCFKS files produced by this package, chosen to match
+// the defaults of Bouncy Castle.
+const (
+	bcfksIterations = 51200
+	bcfksSaltLen    = 64
+	bcfksNonceLen   = 12
+	bcfksICVLen     = 16
+)
+
+type bcfksObjectStore struct {
+	StoreData      asn1.RawValue // EncryptedObjectStoreData or ObjectStoreData
+	IntegrityCheck asn1.RawValue
+}
+
+type bcfksPbkdMacIntegrityCheck struct {
+	MacAlgorithm  pkix.AlgorithmIdentifier
+	PbkdAlgorithm pkix.AlgorithmIdentifier
+	Mac           []byte
+}
+
+type bcfksEncryptedObjectStoreData struct {
+	EncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedContent    []byte
+}
+
+type bcfksObjectStoreData struct {
+	Version                 int
+	DataProtectionAlgorithm pkix.AlgorithmIdentifier
+	CreationDate            time.Time `asn1:"generalized"`
+	LastModifiedDate        time.Time `asn1:"generalized"`
+	ObjectDataSequence      []bcfksObjectData
+	Comment                 string `asn1:"optional,utf8"`
+}
+
+type bcfksObjectData struct {
+	Type             int
+	Identifier       string    `asn1:"utf8"`
+	CreationDate     time.Time `asn1:"generalized"`
+	LastModifiedDate time.Time `asn1:"generalized"`
+	Data             []byte
+	Comment          string `asn1:"optional,utf8"`
+}
+
+type bcfksEncryptedPrivateKeyData struct {
+	EncryptedPrivateKeyInfo encryptedPrivateKeyInfo
+	Certificates            []asn1.RawValue
+}
+
+// bcfksContents holds the entries of a BCFKS keystore which can be
+// represented in PKCS#12: at most one private key with its chain, or any
+// number of trusted certificates.
+type bcfksContents struct {
+	alias      string
+	privateKey crypto.PrivateKey
+	chain      []*x509.Certificate
+	trusted    []*x509.Certificate
+}
+
+// ConvertFromBCFKS converts the Bouncy Castle FIPS keystore bcfksData,
+// protected with password, into pfxData protected with the same password,
+// using DefaultEncoder.  See Encoder.ConvertFromBCFKS.
+func ConvertFromBCFKS(rand io.Reader, bcfksData []byte, password string) (pfxData []byte, err error) {
+	return DefaultEncoder.ConvertFromBCFKS(rand, bcfksData, password)
+}
+
+// ConvertFromBCFKS converts the Bouncy Castle FIPS keystore bcfksData,
+// protected with password, into pfxData protected with the same password
+// and the algorithms of enc.  A keystore holding a single private key entry
+// becomes a file like those of Encode, with the entry's alias as the
+// friendlyName; one holding only trusted certificates becomes a trust store
+// like those of EncodeTrustStore.  Other keystores, including those with
+// secret keys, cannot be converted.
+//
+// ConvertFromBCFKS has not been tested with keystores written by Bouncy
+// Castle, so conversions of such keystores should be checked before the
+// original is discarded.
+func (enc *Encoder) ConvertFromBCFKS(rand io.Reader, bcfksData []byte, password string) (pfxData []byte, err error) {
+	contents, err := decodeBCFKS(bcfksData, password, enc.monitor().withoutKDF())
+	if err != nil {
+		return nil, err
+	}
+	if contents.privateKey == nil {
+		return enc.EncodeTrustStore(rand, contents.trusted, password)
+	}
+	if len(contents.trusted) != 0 {
+		return nil, NotImplementedError("BCFKS keystores with both a private key and trusted certificates cannot be converted")
+	}
+	if len(contents.chain) == 0 {
+		return nil, errors.New("pkcs12: BCFKS private key entry has no certificate")
+	}
+	var attrs []pkcs12Attribute
+	if contents.alias != "" {
+		attr, err := makeFriendlyNameAttribute(contents.alias)
+		if err != nil {
+			return nil, err
+		}
+		attrs = append(attrs, attr)
+	}
+	return enc.encode(rand, contents.privateKey, contents.chain[0], contents.chain[1:], password, attrs, nil)
+}
+
+// ConvertToBCFKS converts pfxData, protected with password, into a Bouncy
+// Castle FIPS keystore protected with the same password, using
+// DefaultDecoder.  See Decoder.ConvertToBCFKS.
+func ConvertToBCFKS(rand io.Reader, pfxData []byte, password string) (bcfksData []byte, err error) {
+	return DefaultDecoder.ConvertToBCFKS(rand, pfxData, password)
+}
+
+// ConvertToBCFKS converts pfxData, protected with password, into a Bouncy
+// Castle FIPS keystore protected with the same password, with parameters
+// chosen to match Bouncy Castle's defaults.  A file with a private key
+// becomes a keystore with a single private key entry, holding the
+// certificate which matches the key followed by the others; a file without
+// one becomes a keystore of trusted certificates.  Entries are named after
+// the friendlyName of their bags where there is one.
+//
+// The output has only been tested by reading it back with this package;
+// whether Bouncy Castle reads it has not been verified.
+func (dec *Decoder) ConvertToBCFKS(rand io.Reader, pfxData []byte, password string) (bcfksData []byte, err error) {
+	if rand == nil {
+		rand = cryptorand.Reader
+	}
+	encodedPassword, err := bmpString(password)
+	if err != nil {
+		return nil, ErrIncorrectPassword
+	}
+	bags, encodedPassword, err := dec.getSafeContents(pfxData, encodedPassword)
+	if err != nil {
+		return nil, err
+	}
+
+	var contents bcfksContents
+	var names []string
+	for i, bag := range bags {
+		switch {
+		case bag.Id.Equal(oidCertBag):
+			cert, err := parseCertBag(bag.Value.Bytes)
+			if err != nil {
+				return nil, err
+			}
+			contents.trusted = append(contents.trusted, cert)
+			names = append(names, friendlyName(&bag))
+		case bag.Id.Equal(oidPKCS8ShroundedKeyBag), bag.Id.Equal(oidKeyBag):
+			if contents.privateKey != nil {
+				return nil, errors.New("pkcs12: expected exactly one key bag")
+			}
+			if bag.Id.Equal(oidKeyBag) {
+				contents.privateKey, err = parsePKCS8PrivateKey(bag.Value.Bytes)
+			} else {
+				contents.privateKey, err = dec.decodePkcs8ShroudedKeyBag(bag.Value.Bytes, encodedPassword)
+			}
+			if err != nil {
+				return nil, err
+			}
+			contents.alias = friendlyName(&bag)
+		}
+		dec.bagDone(i, len(bags))
+	}
+
+	if contents.privateKey != nil {
+		signer, ok := contents.privateKey.(crypto.Signer)
+		if !ok {
+			return nil, errors.New("pkcs12: private key does not implement crypto.Signer")
+		}
+		var rest []*x509.Certificate
+		for i, cert := range contents.trusted {
+			if contents.chain == nil && publicKeyMatches(signer.Public(), cert) {
+				contents.chain = []*x509.Certificate{cert}
+				if contents.alias == "" {
+					contents.alias = names[i]
+				}
+				continue
+			}
+			rest = append(rest, cert)
+		}
+		if contents.chain == nil {
+			return nil, errors.New("pkcs12: no certificate matches the private key")
+		}
+		contents.chain = append(contents.chain, rest...)
+		contents.trusted = nil
+	}
+	return encodeBCFKS(rand, &contents, names, password, dec.monitor().withoutKDF())
+}
+
+// friendlyName returns the value of bag's friendlyName attribute, or "" if
+// it has none or it is malformed.
+func friendlyName(bag *safeBag) string {
+	for i := range bag.Attributes {
+		if !bag.Attributes[i].Id.Equal(oidFriendlyName) {
+			continue
+		}
+		if _, value, err := convertAttribute(&bag.Attributes[i]); err == nil {
+			return value
+		}
+	}
+	return ""
+}
+
+// bcfksPassword returns the PBKDF2 password from which the BCFKS key for
+// purpose is derived.
+func bcfksPassword(password, purpose string) ([]byte, error) {
+	var kdfPassword []byte
+	if password != "" {
+		var err error
+		if kdfPassword, err = bmpString(password); err != nil {
+			return nil, err
+		}
+	}
+	encodedPurpose, err := bmpString(purpose)
+	if err != nil {
+		return nil, err
+	}
+	return append(kdfPassword, encodedPurpose...), nil
+}
+
+// bcfksMac returns the HMAC of data as specified by the integrity check,
+// whose Mac field is ignored.
+func bcfksMac(check *bcfksPbkdMacIntegrityCheck, data []byte, password string, m *kdfMonitor) ([]byte, error) {
+	newHash, err := pbes2HashFor(check.MacAlgorithm)
+	if err != nil {
+		return nil, err
+	}
+	if !check.PbkdAlgorithm.Algorithm.Equal(oidPBKDF2) {
+		return nil, NotImplementedError("key derivation function " + oids.Describe(check.PbkdAlgorithm.Algorithm) + " is not supported")
+	}
+	var kdfParams pbkdf2Params
+	if err := unmarshal(check.PbkdAlgorithm.Parameters.FullBytes, &kdfParams); err != nil {
+		return nil, err
+	}
+	kdfHash, err := pbes2HashFor(kdfParams.PRF)
+	if err != nil {
+		return nil, err
+	}
+	keyLen := kdfParams.KeyLength
+	if keyLen == 0 {
+		keyLen = newHash().Size()
+	}
+	kdfPassword, err := bcfksPassword(password, "INTEGRITY_CHECK")
+	if err != nil {
+		return nil, err
+	}
+	key := pbkdf2Key(kdfHash, kdfPassword, kdfParams.Salt, kdfParams.IterationCount, keyLen, m)
+	if err := m.err(); err != nil {
+		return nil, err
+	}
+	mac := hmac.New(newHash, key)
+	mac.Write(data)
+	return mac.Sum(nil), nil
+}
+
+func decodeBCFKS(bcfksData []byte, password string, m *kdfMonitor) (*bcfksContents, error) {
+	var store bcfksObjectStore
+	if err := unmarshal(bcfksData, &store); err != nil {
+		return nil, errors.New("pkcs12: error reading BCFKS data: " + err.Error())
+	}
+	if store.IntegrityCheck.Class != asn1.ClassUniversal {
+		return nil, NotImplementedError("only password-based BCFKS integrity checks are supported")
+	}
+	var check bcfksPbkdMacIntegrityCheck
+	if err := unmarshal(store.IntegrityCheck.FullBytes, &check); err != nil {
+		return nil, errors.New("pkcs12: error reading BCFKS integrity check: " + err.Error())
+	}
+	expectedMAC, err := bcfksMac(&check, store.StoreData.FullBytes, password, m)
+	if err != nil {
+		return nil, err
+	}
+	if !hmac.Equal(check.Mac, expectedMAC) {
+		return nil, ErrIncorrectPassword
+	}
+
+	// ObjectStoreData begins with its version, EncryptedObjectStoreData
+	// with an AlgorithmIdentifier.
+	plaintext := store.StoreData.FullBytes
+	var first asn1.RawValue
+	if _, err := asn1.Unmarshal(store.StoreData.Bytes, &first); err != nil {
+		return nil, errors.New("pkcs12: error reading BCFKS data: " + err.Error())
+	}
+	if first.Tag != asn1.TagInteger {
+		var encrypted bcfksEncryptedObjectStoreData
+		if err := unmarshal(plaintext, &encrypted); err != nil {
+			return nil, errors.New("pkcs12: error reading BCFKS data: " + err.Error())
+		}
+		if plaintext, err = bcfksOpen(encrypted.EncryptionAlgorithm, encrypted.EncryptedContent, password, "STORE_ENCRYPTION", m); err != nil {
+			return nil, err
+		}
+	}
+	var storeData bcfksObjectStoreData
+	if err := unmarshal(plaintext, &storeData); err != nil {
+		return nil, errors.New("pkcs12: error reading BCFKS object store: " + err.Error())
+	}
+
+	contents := new(bcfksContents)
+	for _, object := range storeData.ObjectDataSequence {
+		switch object.Type {
+		case bcfksCertificate:
+			cert, err := x509.ParseCertificate(object.Data)
+			if err != nil {
+				return nil, err
+			}
+			contents.trusted = append(contents.trusted, cert)
+		case bcfksPrivateKey:
+			if contents.privateKey != nil {
+				return nil, NotImplementedError("BCFKS keystores with more than one private key cannot be converted")
+			}
+			var keyData bcfksEncryptedPrivateKeyData
+			if err := unmarshal(object.Data, &keyData); err != nil {
+				return nil, errors.New("pkcs12: error reading BCFKS private key: " + err.Error())
+			}
+			info := keyData.EncryptedPrivateKeyInfo
+			if !info.AlgorithmIdentifier.Algorithm.Equal(oidPBES2) {
+				return nil, NotImplementedError("BCFKS private key algorithm " + oids.Describe(info.AlgorithmIdentifier.Algorithm) + " is not supported")
+			}
+			pkData, err := bcfksOpen(info.AlgorithmIdentifier, info.EncryptedData, password, "PRIVATE_KEY_ENCRYPTION", m)
+			if err != nil {
+				return nil, errors.New("pkcs12: error decrypting BCFKS private key: " + err.Error())
+			}
+			if contents.privateKey, err = parsePKCS8PrivateKey(pkData); err != nil {
+				return nil, errors.New("pkcs12: error parsing PKCS#8 private key: " + err.Error())
+			}
+			for _, raw := range keyData.Certificates {
+				cert, err := x509.ParseCertificate(raw.FullBytes)
+				if err != nil {
+					return nil, err
+				}
+				contents.chain = append(contents.chain, cert)
+			}
+			contents.alias = object.Identifier
+		case bcfksSecretKey, bcfksProtectedPrivateKey, bcfksProtectedSecretKey:
+			return nil, NotImplementedError("BCFKS entry " + strconv.Quote(object.Identifier) + " of type " + strconv.Itoa(object.Type) + " cannot be converted")
+		default:
+			return nil, NotImplementedError("unknown BCFKS entry type " + strconv.Itoa(object.Type))
+		}
+	}
+	return contents, nil
+}
+
+// bcfksOpen decrypts encrypted with the PBES2 algorithm, deriving the key
+// for purpose.
+func bcfksOpen(algorithm pkix.AlgorithmIdentifier, encrypted []byte, password, purpose string, m *kdfMonitor) ([]byte, error) {
+	if !algorithm.Algorithm.Equal(oidPBES2) {
+		return nil, NotImplementedError("BCFKS encryption algorithm " + oids.Describe(algorithm.Algorithm) + " is not supported")
+	}
+	kdfPassword, err := bcfksPassword(password, purpose)
+	if err != nil {
+		return nil, err
+	}
+	return pbes2DecryptRaw(nil, algorithm, encrypted, kdfPassword, m)
+}
+
+// bcfksSeal encrypts plaintext with PBES2, PBKDF2 with HMAC-SHA-512 and
+// AES-256-CCM, deriving the key for purpose.
+func bcfksSeal(rand io.Reader, plaintext []byte, password, purpose string, m *kdfMonitor) (algorithm pkix.AlgorithmIdentifier, encrypted []byte, err error) {
+	kdfPassword, err := bcfksPassword(password, purpose)
+	if err != nil {
+		return algorithm, nil, err
+	}
+	kdf, salt, err := bcfksKDF(rand, 32)
+	if err != nil {
+		return algorithm, nil, err
+	}
+	nonce := make([]byte, bcfksNonceLen)
+	if _, err := io.ReadFull(rand, nonce); err != nil {
+		return algorithm, nil, errors.New("pkcs12: error reading random nonce: " + err.Error())
+	}
+	schemeParams, err := asn1.Marshal(ccmParams{Nonce: nonce, ICVLen: bcfksICVLen})
+	if err != nil {
+		return algorithm, nil, err
+	}
+	params, err := asn1.Marshal(pbes2Params{
+		KeyDerivationFunc: kdf,
+		EncryptionScheme: pkix.AlgorithmIdentifier{
+			Algorithm:  oidAES256CCM,
+			Parameters: asn1.RawValue{FullBytes: schemeParams},
+		},
+	})
+	if err != nil {
+		return algorithm, nil, err
+	}
+
+	key := pbkdf2Key(sha512.New, kdfPassword, salt, bcfksIterations, 32, m)
+	if err := m.err(); err != nil {
+		return algorithm, nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return algorithm, nil, err
+	}
+	aead, err := ccm.New(block, bcfksNonceLen, bcfksICVLen)
+	if err != nil {
+		return algorithm, nil, err
+	}
+	algorithm = pkix.AlgorithmIdentifier{Algorithm: oidPBES2, Parameters: asn1.RawValue{FullBytes: params}}
+	return algorithm, aead.Seal(nil, nonce, plaintext, nil), nil
+}
+
+// bcfksKDF returns the PBKDF2 AlgorithmIdentifier of a new BCFKS key of
+// keyLen bytes, and its salt.
+func bcfksKDF(rand io.Reader, keyLen int) (kdf pkix.AlgorithmIdentifier, salt []byte, err error) {
+	salt = make([]byte, bcfksSaltLen)
+	if _, err := io.ReadFull(rand, salt); err != nil {
+		return kdf, nil, errors.New("pkcs12: error reading random salt: " + err.Error())
+	}
+	params, err := asn1.Marshal(pbkdf2Params{
+		Salt:           salt,
+		IterationCount: bcfksIterations,
+		KeyLength:      keyLen,
+		PRF:            pkix.AlgorithmIdentifier{Algorithm: oidHmacWithSHA512, Parameters: asn1.NullRawValue},
+	})
+	if err != nil {
+		return kdf, nil, err
+	}
+	return pkix.AlgorithmIdentifier{Algorithm: oidPBKDF2, Parameters: asn1.RawValue{FullBytes: params}}, salt, nil
+}
+
+// encodeBCFKS encodes contents as an encrypted BCFKS keystore.  names are
+// the aliases of the trusted certificates, where known.
+func encodeBCFKS(rand io.Reader, contents *bcfksContents, names []string, password string, m *kdfMonitor) (bcfksData []byte, err error) {
+	now := time.Now().UTC().Truncate(time.Second)
+	object := func(typ int, alias string, data []byte) bcfksObjectData {
+		return bcfksObjectData{Type: typ, Identifier: alias, CreationDate: now, LastModifiedDate: now, Data: data}
+	}
+
+	var objects []bcfksObjectData
+	if contents.privateKey != nil {
+		pkData, err := marshalPKCS8PrivateKey(contents.privateKey, contents.chain[0])
+		if err != nil {
+			return nil, errors.New("pkcs12: error encoding PKCS#8 private key: " + err.Error())
+		}
+		var keyData bcfksEncryptedPrivateKeyData
+		info := &keyData.EncryptedPrivateKeyInfo
+		if info.AlgorithmIdentifier, info.EncryptedData, err = bcfksSeal(rand, pkData, password, "PRIVATE_KEY_ENCRYPTION", m); err != nil {
+			return nil, err
+		}
+		for _, cert := range contents.chain {
+			keyData.Certificates = append(keyData.Certificates, asn1.RawValue{FullBytes: cert.Raw})
+		}
+		data, err := asn1.Marshal(keyData)
+		if err != nil {
+			return nil, err
+		}
+		alias := contents.alias
+		if alias == "" {
+			alias = "1"
+		}
+		objects = append(objects, object(bcfksPrivateKey, alias, data))
+	}
+	for i, cert := range contents.trusted {
+		alias := names[i]
+		if alias == "" {
+			alias = strconv.Itoa(i + 1)
+		}
+		objects = append(objects, object(bcfksCertificate, alias, cert.Raw))
+	}
+
+	plaintext, err := asn1.Marshal(bcfksObjectStoreData{
+		DataProtectionAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidHmacWithSHA512, Parameters: asn1.NullRawValue},
+		CreationDate:            now,
+		LastModifiedDate:        now,
+		ObjectDataSequence:      objects,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var encrypted bcfksEncryptedObjectStoreData
+	if encrypted.EncryptionAlgorithm, encrypted.EncryptedContent, err = bcfksSeal(rand, plaintext, password, "STORE_ENCRYPTION", m); err != nil {
+		return nil, err
+	}
+	storeData, err := asn1.Marshal(encrypted)
+	if err != nil {
+		return nil, err
+	}
+
+	check := bcfksPbkdMacIntegrityCheck{
+		MacAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidHmacWithSHA512, Parameters: asn1.NullRawValue},
+	}
+	if check.PbkdAlgorithm, _, err = bcfksKDF(rand, 64); err != nil {
+		return nil, err
+	}
+	if check.Mac, err = bcfksMac(&check, storeData, password, m); err != nil {
+		return nil, err
+	}
+	integrityCheck, err := asn1.Marshal(check)
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(bcfksObjectStore{
+		StoreData:      asn1.RawValue{FullBytes: storeData},
+		IntegrityCheck: asn1.RawValue{FullBytes: integrityCheck},
+	})
+}
@@ -0,0 +1,178 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha512"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"testing"
+)
+
+func TestBCFKSRoundTrip(t *testing.T) {
+	caKey, ca := newTestCertificate(t, "ca.example.com", nil, nil)
+	key, cert := newTestCertificate(t, "bcfks.example.com", ca, caKey)
+	pfxData, err := DefaultEncoder.WithCompatibilityLevel(2024).encode(rand.Reader, key, cert, []*x509.Certificate{ca}, "password", []pkcs12Attribute{mustFriendlyName(t, "server")}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bcfksData, err := ConvertToBCFKS(rand.Reader, pfxData, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	contents, err := decodeBCFKS(bcfksData, "password", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if contents.alias != "server" {
+		t.Errorf("got alias %q, want %q", contents.alias, "server")
+	}
+	if len(contents.chain) != 2 || !contents.chain[0].Equal(cert) || !contents.chain[1].Equal(ca) {
+		t.Error("BCFKS key entry has the wrong chain")
+	}
+	if _, err := decodeBCFKS(bcfksData, "wrong", nil); err != ErrIncorrectPassword {
+		t.Errorf("got error %v with the wrong password, want ErrIncorrectPassword", err)
+	}
+
+	converted, err := ConvertFromBCFKS(rand.Reader, bcfksData, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	privateKey, certificate, caCerts, err := DecodeChainWithCAs(converted, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !key.Equal(privateKey) || !certificate.Equal(cert) || len(caCerts) != 1 || !caCerts[0].Equal(ca) {
+		t.Error("converting back did not preserve the identity")
+	}
+	blocks, err := ToPEM(converted, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if blocks[0].Headers["friendlyName"] != "server" {
+		t.Errorf("got friendlyName %q, want %q", blocks[0].Headers["friendlyName"], "server")
+	}
+}
+
+func TestBCFKSTrustStore(t *testing.T) {
+	_, root1 := newTestCertificate(t, "root1.example.com", nil, nil)
+	_, root2 := newTestCertificate(t, "root2.example.com", nil, nil)
+	pfxData, err := EncodeTrustStore(rand.Reader, []*x509.Certificate{root1, root2}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bcfksData, err := ConvertToBCFKS(rand.Reader, pfxData, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	converted, err := ConvertFromBCFKS(rand.Reader, bcfksData, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	certs, err := DecodeTrustStore(converted, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(certs) != 2 || !certs[0].Equal(root1) || !certs[1].Equal(root2) {
+		t.Error("converting back did not preserve the trust store")
+	}
+}
+
+// TestBCFKSIntegrityKey checks the MAC against an independent derivation
+// of the integrity key, from the password and purpose encoded as Bouncy
+// Castle's PBEParametersGenerator.PKCS12PasswordToBytes does.
+func TestBCFKSIntegrityKey(t *testing.T) {
+	_, root := newTestCertificate(t, "root.example.com", nil, nil)
+	pfxData, err := EncodeTrustStore(rand.Reader, []*x509.Certificate{root}, "pw")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bcfksData, err := ConvertToBCFKS(rand.Reader, pfxData, "pw")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var store bcfksObjectStore
+	if err := unmarshal(bcfksData, &store); err != nil {
+		t.Fatal(err)
+	}
+	var check bcfksPbkdMacIntegrityCheck
+	if err := unmarshal(store.IntegrityCheck.FullBytes, &check); err != nil {
+		t.Fatal(err)
+	}
+	var kdfParams pbkdf2Params
+	if err := unmarshal(check.PbkdAlgorithm.Parameters.FullBytes, &kdfParams); err != nil {
+		t.Fatal(err)
+	}
+	password := []byte("\x00p\x00w\x00\x00\x00I\x00N\x00T\x00E\x00G\x00R\x00I\x00T\x00Y\x00_\x00C\x00H\x00E\x00C\x00K\x00\x00")
+	key, err := pbkdf2.Key(sha512.New, string(password), kdfParams.Salt, kdfParams.IterationCount, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mac := hmac.New(sha512.New, key)
+	mac.Write(store.StoreData.FullBytes)
+	if !bytes.Equal(mac.Sum(nil), check.Mac) {
+		t.Error("MAC does not match the independently derived key")
+	}
+
+	// Tampering with the store is detected.
+	tampered := append([]byte{}, bcfksData...)
+	tampered[len(tampered)-len(store.IntegrityCheck.FullBytes)-1] ^= 1
+	if _, err := ConvertFromBCFKS(rand.Reader, tampered, "pw"); err != ErrIncorrectPassword {
+		t.Errorf("got error %v for a tampered keystore, want ErrIncorrectPassword", err)
+	}
+}
+
+func TestBCFKSUnsupportedEntry(t *testing.T) {
+	storeData, err := asn1.Marshal(bcfksObjectStoreData{
+		DataProtectionAlgorithm: sha512MacAlgorithm(),
+		ObjectDataSequence:      []bcfksObjectData{{Type: bcfksSecretKey, Identifier: "aes", Data: []byte{0}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	check := bcfksPbkdMacIntegrityCheck{MacAlgorithm: sha512MacAlgorithm()}
+	if check.PbkdAlgorithm, _, err = bcfksKDF(rand.Reader, 64); err != nil {
+		t.Fatal(err)
+	}
+	if check.Mac, err = bcfksMac(&check, storeData, "", nil); err != nil {
+		t.Fatal(err)
+	}
+	integrityCheck, err := asn1.Marshal(check)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bcfksData, err := asn1.Marshal(bcfksObjectStore{
+		StoreData:      asn1.RawValue{FullBytes: storeData},
+		IntegrityCheck: asn1.RawValue{FullBytes: integrityCheck},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ConvertFromBCFKS(rand.Reader, bcfksData, ""); err == nil {
+		t.Error("converted a keystore with a secret key")
+	} else if _, ok := err.(NotImplementedError); !ok {
+		t.Errorf("got error %v, want a NotImplementedError", err)
+	}
+}
+
+func mustFriendlyName(t *testing.T, name string) pkcs12Attribute {
+	attr, err := makeFriendlyNameAttribute(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return attr
+}
+
+func sha512MacAlgorithm() pkix.AlgorithmIdentifier {
+	return pkix.AlgorithmIdentifier{Algorithm: oidHmacWithSHA512, Parameters: asn1.NullRawValue}
+}
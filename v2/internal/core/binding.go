@@ -0,0 +1,41 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+)
+
+// passwordBindingLabel separates the MACs computed by BindPassword from
+// other uses of HMAC keyed with the same password.
+const passwordBindingLabel = "go-pkcs12 password binding\x00"
+
+// BindPassword returns a password derived from password and
+// bindingContext, such as a device serial number or a hardware identifier,
+// so that a file encoded with it can only be decoded by a party which knows
+// both: a leaked password alone does not open a file bound to a device.
+// Pass the result as the password to both the encoding and the decoding
+// functions.
+//
+// The derived password is the base64url encoding without padding (RFC
+// 4648, section 5) of HMAC-SHA-256 keyed with the UTF-8 encoding of
+// password, over the bytes of "go-pkcs12 password binding", a zero byte
+// and bindingContext.  It consists of 43 ASCII characters, so other tools
+// can open a bound file given the derived password, which can be computed
+// with, for example:
+//
+//	printf 'go-pkcs12 password binding\0%s' "$CONTEXT" |
+//	    openssl dgst -sha256 -hmac "$PASSWORD" -binary | basenc --base64url | tr -d =
+//
+// The binding is no stronger than the secrecy of bindingContext, which
+// should therefore not be guessable from public information.
+func BindPassword(password string, bindingContext []byte) string {
+	mac := hmac.New(sha256.New, []byte(password))
+	mac.Write([]byte(passwordBindingLabel))
+	mac.Write(bindingContext)
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,31 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"crypto/rand"
+	"testing"
+)
+
+func TestBindPassword(t *testing.T) {
+	// Computed with the openssl command in the documentation.
+	if got, want := BindPassword("password", []byte("device-1234")), "R9ZEhLbDbMhWIbem5CXZ5ij-fj1dNOXL59dxSfzylIU"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	key, cert := newTestCertificate(t, "device.example.com", nil, nil)
+	pfxData, err := Modern.Encode(rand.Reader, key, cert, nil, BindPassword("password", []byte("device-1234")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := Decode(pfxData, BindPassword("password", []byte("device-1234"))); err != nil {
+		t.Error(err)
+	}
+	for _, password := range []string{"password", BindPassword("password", []byte("device-1235")), BindPassword("wrong", []byte("device-1234"))} {
+		if _, _, err := Decode(pfxData, password); err != ErrIncorrectPassword {
+			t.Errorf("got error %v for password %q, want ErrIncorrectPassword", err, password)
+		}
+	}
+}
@@ -2,27 +2,34 @@
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
 
-package pkcs12
+package core
 
 import (
 	"errors"
 	"unicode/utf16"
+	"unicode/utf8"
 )
 
-// bmpString returns s encoded in UCS-2 with a zero terminator.
+// bmpString returns s encoded in UTF-16 (big-endian) with a zero terminator.
+//
+// RFC 7292 specifies that passwords are BMPStrings, i.e. UCS-2, which cannot
+// represent characters outside the Basic Multilingual Plane.  Such characters
+// are encoded as surrogate pairs, which is what other implementations
+// (including OpenSSL and Windows) do, so that files protected with such
+// passwords can be exchanged with them.
 func bmpString(s string) ([]byte, error) {
 	// References:
 	// https://tools.ietf.org/html/rfc7292#appendix-B.1
 	// https://en.wikipedia.org/wiki/Plane_(Unicode)#Basic_Multilingual_Plane
 	//  - non-BMP characters are encoded in UTF 16 by using a surrogate pair of 16-bit codes
-	//	  EncodeRune returns 0xfffd if the rune does not need special encoding
 	//  - the above RFC provides the info that BMPStrings are NULL terminated.
 
 	ret := make([]byte, 0, 2*len(s)+2)
 
 	for _, r := range s {
-		if t, _ := utf16.EncodeRune(r); t != 0xfffd {
-			return nil, errors.New("pkcs12: string contains characters that cannot be encoded in UCS-2")
+		if r1, r2 := utf16.EncodeRune(r); r1 != utf8.RuneError {
+			ret = append(ret, byte(r1>>8), byte(r1), byte(r2>>8), byte(r2))
+			continue
 		}
 		ret = append(ret, byte(r/256), byte(r%256))
 	}
@@ -2,7 +2,7 @@
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
 
-package pkcs12
+package core
 
 import (
 	"bytes"
@@ -20,8 +20,8 @@ var bmpStringTests = []struct {
 	{"Beavis", "0042006500610076006900730000", false},
 	// Some characters from the "Letterlike Symbols Unicode block".
 	{"\u2115 - Double-struck N", "21150020002d00200044006f00750062006c0065002d00730074007200750063006b0020004e0000", false},
-	// any character outside the BMP should trigger an error.
-	{"\U0001f000 East wind (Mahjong)", "", true},
+	// Characters outside the BMP are encoded as surrogate pairs.
+	{"\U0001f000 East wind (Mahjong)", "d83cdc0000200045006100730074002000770069006e006400200028004d00610068006a006f006e006700290000", false},
 }
 
 func TestBMPString(t *testing.T) {
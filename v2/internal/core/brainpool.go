@@ -0,0 +1,32 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"crypto/elliptic"
+	"encoding/asn1"
+
+	"github.com/scholar-ink/go-pkcs12/v2/internal/brainpool"
+)
+
+// see https://tools.ietf.org/html/rfc5639#section-4.1
+var (
+	oidNamedCurveBrainpoolP256r1 = asn1.ObjectIdentifier{1, 3, 36, 3, 3, 2, 8, 1, 1, 7}
+	oidNamedCurveBrainpoolP384r1 = asn1.ObjectIdentifier{1, 3, 36, 3, 3, 2, 8, 1, 1, 11}
+	oidNamedCurveBrainpoolP512r1 = asn1.ObjectIdentifier{1, 3, 36, 3, 3, 2, 8, 1, 1, 13}
+)
+
+// brainpoolCurve returns the Brainpool curve identified by oid, or nil.
+func brainpoolCurve(oid asn1.ObjectIdentifier) elliptic.Curve {
+	switch {
+	case oid.Equal(oidNamedCurveBrainpoolP256r1):
+		return brainpool.P256r1()
+	case oid.Equal(oidNamedCurveBrainpoolP384r1):
+		return brainpool.P384r1()
+	case oid.Equal(oidNamedCurveBrainpoolP512r1):
+		return brainpool.P512r1()
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"testing"
+
+	"github.com/scholar-ink/go-pkcs12/v2/internal/brainpool"
+)
+
+func TestBrainpool(t *testing.T) {
+	pfxData, _ := base64.StdEncoding.DecodeString(openSSLBrainpoolTestData)
+	privateKey, certificate, err := Decode(pfxData, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, ok := privateKey.(*ecdsa.PrivateKey)
+	if !ok || key.Curve != brainpool.P256r1() {
+		t.Fatalf("decoded a %T, want a brainpoolP256r1 *ecdsa.PrivateKey", privateKey)
+	}
+	if certificate.Subject.CommonName != "brainpool.example.com" {
+		t.Errorf("got common name %q", certificate.Subject.CommonName)
+	}
+	if certificate.PublicKeyAlgorithm != x509.ECDSA || !publicKeyMatches(key.Public(), certificate) {
+		t.Error("key does not match the certificate")
+	}
+	if err := certificate.CheckSignatureFrom(certificate); err != nil {
+		t.Errorf("self-signature does not verify: %v", err)
+	}
+
+	blocks, err := ToPEM(pfxData, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, block := range blocks {
+		if block.Type != privateKeyType {
+			continue
+		}
+		if pemKey, err := parseECPrivateKey(block.Bytes); err != nil {
+			t.Error(err)
+		} else if !key.Equal(pemKey) {
+			t.Error("PEM key does not match")
+		}
+	}
+
+	pfxData, err = Modern.Encode(rand.Reader, key, certificate, nil, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	decodedKey, decodedCert, err := Decode(pfxData, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !key.Equal(decodedKey) {
+		t.Error("re-encoded key does not match")
+	}
+	if !decodedCert.Equal(certificate) {
+		t.Error("re-encoded certificate does not match")
+	}
+}
+
+func TestBrainpoolPKCS8(t *testing.T) {
+	for _, curve := range []elliptic.Curve{brainpool.P256r1(), brainpool.P384r1(), brainpool.P512r1()} {
+		key, err := ecdsa.GenerateKey(curve, rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		der, err := marshalPKCS8PrivateKey(key, nil)
+		if err != nil {
+			t.Fatalf("%s: %v", curve.Params().Name, err)
+		}
+		decodedKey, err := parsePKCS8PrivateKey(der)
+		if err != nil {
+			t.Fatalf("%s: %v", curve.Params().Name, err)
+		}
+		if !key.Equal(decodedKey) {
+			t.Errorf("%s: decoded key does not match", curve.Params().Name)
+		}
+	}
+}
+
+// openSSLBrainpoolTestData was generated with
+//
+//	openssl genpkey -algorithm EC -pkeyopt ec_paramgen_curve:brainpoolP256r1 -out brainpool.key
+//	openssl req -new -x509 -key brainpool.key -subj /CN=brainpool.example.com -days 36500 -out brainpool.crt
+//	openssl pkcs12 -export -inkey brainpool.key -in brainpool.crt -passout pass:password
+const openSSLBrainpoolTestData = `MIIELAIBAzCCA+IGCSqGSIb3DQEHAaCCA9MEggPPMIIDyzCCAoIGCSqGSIb3DQEHBqCCAnMwggJv
+AgEAMIICaAYJKoZIhvcNAQcBMFcGCSqGSIb3DQEFDTBKMCkGCSqGSIb3DQEFDDAcBAjtlu+Tf/gy
+ZAICCAAwDAYIKoZIhvcNAgkFADAdBglghkgBZQMEASoEEL8L3kY65mrA7e7uXRW+NGyAggIAnsdV
+vsnShalM3MkLI7Mokksm3Ko5s5hKQgGMw67OCbnvz90p60KkO6edOMUxl3KLQ6klbrKtegnFl9GA
+n4TAi7+nKTNS9OmGDXuidWDHX6C+4syVGCwrtj5KG4GVHu5cpBWd+ErDAuRaGegx40G2TL+rHFfu
+1I5+NUwUKH0smke1wSom6d0iD4fhGQWAwyNhsWgMVhyh4TIswRNKmpEBn9Tg5zEKtzndO9fQZNdT
+VQESsZq9jLf7+QMrr3Ae5D7m0bmKFD9p1Z90C0WF8Geg+h75IN7bujF/XyN7z2D/BQnXfxtVXXKV
+KSUIMtgvN08kGW3Hlh/Pd4NqXIeoBvEUN5PXLrNIizR2s3G508LgmloqzboTCT+2pi6hp6yDuPh5
+5ZF/BVVy/ivX9efhaA30cdeTdHRyR5gBOzKySkOnIdtQbBnqF0BL0aszOojxOT/emHWAIwL5OGQ+
+nbcUPytUhjtLWNH1Q4XudJ+RUFE5zLO9G575nI8DEjIkUHFjcmby2yUvn4H/UEdyNcIDUvOmCcFm
+Oqy6/lr0EqFnizgRNx9gdvpqZxxPnJI5/jSabLv7gV0LzrCL+w4sRrgE67WokUc/bqWVcLqdB3uu
+0C4rIm/NXEUD8K4RW717EOPoUCBC+lbUh+6fL/Im37v6Fodby1q2KLhfD7z3Dy1yqwcQbWAwggFB
+BgkqhkiG9w0BBwGgggEyBIIBLjCCASowggEmBgsqhkiG9w0BDAoBAqCB7zCB7DBXBgkqhkiG9w0B
+BQ0wSjApBgkqhkiG9w0BBQwwHAQIhyVsb+gMU0QCAggAMAwGCCqGSIb3DQIJBQAwHQYJYIZIAWUD
+BAEqBBDhGtGe5SKi5oiPrCfffZCSBIGQsOphg4O0gEl93Y1bsUZ4t6nOmdCKpetLEbn4E6QRENCm
+k3lZT/PNMWbF8YnuRpg1uYmQiNJOHdSTcD+Z60tMYcaxsKhTqXBQuP/2ldVlar1U7WKdlXiMVrsE
+Q9on897eUaYEVvOn84OrctWXxnFFKzWJixwwJZu82k7UCEjZeOqpJOhxmK0XZgKmRqrfRgM0MSUw
+IwYJKoZIhvcNAQkVMRYEFLF+onj+L6tHvkmHYaUYD40U5Pl3MEEwMTANBglghkgBZQMEAgEFAAQg
+hu8BJ2Yd/6BDgqzOOHA3NdkpsFlkkx15sCv4CgQhCPwECM3wteROacp2AgIIAA==`
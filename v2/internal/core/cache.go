@@ -0,0 +1,120 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"container/list"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/binary"
+	"sync"
+)
+
+// A DecodeCache memoizes the results of DecodeChainWithCAs, so that
+// repeatedly decoding the same file with the same password, as gateways
+// which reload a client bundle on every request do, does not repeat the
+// expensive key derivation and decryption.
+//
+// Entries are keyed by a SHA-256 HMAC, under a random per-cache key, of the
+// password and pfxData, so the cache never retains the password itself.
+// Only successful decodes are cached.  The least recently used entry is
+// evicted once the cache is full.
+//
+// Results are shared between all callers that decode the same file, so the
+// returned private keys and certificates must not be modified.
+//
+// A DecodeCache is safe for concurrent use by multiple goroutines.
+type DecodeCache struct {
+	dec        *Decoder
+	maxEntries int
+	hmacKey    [32]byte
+
+	mu      sync.Mutex // guards lru and entries
+	lru     *list.List
+	entries map[[sha256.Size]byte]*list.Element
+}
+
+type decodeCacheEntry struct {
+	key         [sha256.Size]byte
+	privateKey  interface{}
+	certificate *x509.Certificate
+	caCerts     []*x509.Certificate
+}
+
+// NewDecodeCache returns a DecodeCache which decodes with dec (or
+// DefaultDecoder if dec is nil) and holds at most maxEntries results.  If
+// maxEntries is zero or negative, the cache is unbounded.
+func NewDecodeCache(dec *Decoder, maxEntries int) *DecodeCache {
+	if dec == nil {
+		dec = DefaultDecoder
+	}
+	c := &DecodeCache{
+		dec:        dec,
+		maxEntries: maxEntries,
+		lru:        list.New(),
+		entries:    make(map[[sha256.Size]byte]*list.Element),
+	}
+	if _, err := rand.Read(c.hmacKey[:]); err != nil {
+		panic("pkcs12: error reading random key: " + err.Error())
+	}
+	return c
+}
+
+// DecodeChainWithCAs is like Decoder.DecodeChainWithCAs, but returns a
+// previously decoded result if pfxData and password have been decoded
+// successfully before.
+func (c *DecodeCache) DecodeChainWithCAs(pfxData []byte, password string) (privateKey interface{}, certificate *x509.Certificate, caCerts []*x509.Certificate, err error) {
+	key := c.key(pfxData, password)
+
+	c.mu.Lock()
+	if elem, ok := c.entries[key]; ok {
+		c.lru.MoveToFront(elem)
+		entry := elem.Value.(*decodeCacheEntry)
+		c.mu.Unlock()
+		return entry.privateKey, entry.certificate, append([]*x509.Certificate(nil), entry.caCerts...), nil
+	}
+	c.mu.Unlock()
+
+	if privateKey, certificate, caCerts, err = c.dec.DecodeChainWithCAs(pfxData, password); err != nil {
+		return nil, nil, nil, err
+	}
+
+	c.mu.Lock()
+	if _, ok := c.entries[key]; !ok {
+		c.entries[key] = c.lru.PushFront(&decodeCacheEntry{
+			key:         key,
+			privateKey:  privateKey,
+			certificate: certificate,
+			caCerts:     append([]*x509.Certificate(nil), caCerts...),
+		})
+		if c.maxEntries > 0 && c.lru.Len() > c.maxEntries {
+			oldest := c.lru.Remove(c.lru.Back()).(*decodeCacheEntry)
+			delete(c.entries, oldest.key)
+		}
+	}
+	c.mu.Unlock()
+
+	return privateKey, certificate, caCerts, nil
+}
+
+// Len returns the number of cached results.
+func (c *DecodeCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
+
+func (c *DecodeCache) key(pfxData []byte, password string) (key [sha256.Size]byte) {
+	mac := hmac.New(sha256.New, c.hmacKey[:])
+	var passwordLen [8]byte
+	binary.BigEndian.PutUint64(passwordLen[:], uint64(len(password)))
+	mac.Write(passwordLen[:])
+	mac.Write([]byte(password))
+	mac.Write(pfxData)
+	mac.Sum(key[:0])
+	return key
+}
@@ -0,0 +1,57 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"crypto/rand"
+	"testing"
+)
+
+func TestDecodeCache(t *testing.T) {
+	cache := NewDecodeCache(nil, 2)
+
+	var files [][]byte
+	for _, name := range []string{"a.example.com", "b.example.com", "c.example.com"} {
+		key, cert := newTestCertificate(t, name, nil, nil)
+		pfxData, err := Encode(rand.Reader, key, cert, nil, "password")
+		if err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, pfxData)
+	}
+
+	key1, cert1, _, err := cache.DecodeChainWithCAs(files[0], "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	key2, cert2, _, err := cache.DecodeChainWithCAs(files[0], "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert1 != cert2 || key1 != key2 {
+		t.Error("second decode was not served from the cache")
+	}
+
+	if _, _, _, err := cache.DecodeChainWithCAs(files[0], "wrong"); err != ErrIncorrectPassword {
+		t.Errorf("got error %v, want ErrIncorrectPassword", err)
+	}
+	if n := cache.Len(); n != 1 {
+		t.Errorf("failed decode was cached: %d entries", n)
+	}
+
+	for _, pfxData := range files[1:] {
+		if _, _, _, err := cache.DecodeChainWithCAs(pfxData, "password"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := cache.Len(); n != 2 {
+		t.Errorf("got %d entries, want 2", n)
+	}
+	if _, cert3, _, err := cache.DecodeChainWithCAs(files[0], "password"); err != nil {
+		t.Fatal(err)
+	} else if cert3 == cert1 {
+		t.Error("least recently used entry was not evicted")
+	}
+}
@@ -0,0 +1,137 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"math/big"
+	"time"
+)
+
+// A Canary is a PKCS#12 file with a freshly generated key and password,
+// for testing that an application never writes the secrets of the files
+// it decodes to its logs.  The test has the application decode PFXData
+// with Password along its usual code path, capturing its log and debug
+// output, and then passes the output to Scan.
+type Canary struct {
+	// PFXData is the encoding of PrivateKey and Certificate protected by
+	// Password.
+	PFXData     []byte
+	Password    string
+	PrivateKey  *ecdsa.PrivateKey
+	Certificate *x509.Certificate
+
+	secrets []canarySecret
+}
+
+type canarySecret struct {
+	name  string
+	value []byte
+}
+
+// NewCanary returns a new Canary, reading its key, password and the
+// randomness of its encoding from rand, or from crypto/rand if rand is nil.
+// The file is encoded with Modern.
+func NewCanary(rand io.Reader) (*Canary, error) {
+	rand = Modern.entropy(rand)
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand)
+	if err != nil {
+		return nil, err
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "pkcs12 canary"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand, template, template, key.Public(), key)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	passwordBytes := make([]byte, 18)
+	if _, err := io.ReadFull(rand, passwordBytes); err != nil {
+		return nil, err
+	}
+	password := base64.RawURLEncoding.EncodeToString(passwordBytes)
+	pfxData, err := Modern.Encode(rand, key, cert, nil, password)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Canary{PFXData: pfxData, Password: password, PrivateKey: key, Certificate: cert}
+	encodedPassword, err := bmpString(password)
+	if err != nil {
+		return nil, err
+	}
+	pkcs8Key, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	sec1Key, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	ecdhKey, err := key.ECDH()
+	if err != nil {
+		return nil, err
+	}
+	c.secrets = []canarySecret{
+		{"password", []byte(password)},
+		{"BMPString password", encodedPassword[:len(encodedPassword)-2]},
+		{"PKCS#8 private key", pkcs8Key},
+		{"SEC 1 private key", sec1Key},
+		{"private scalar", ecdhKey.Bytes()},
+		{"decimal private scalar", []byte(key.D.String())},
+	}
+	return c, nil
+}
+
+// Scan returns a *LeakError if output contains any of the secrets of c:
+// the password, as a string or BMPString, or the private key, as PKCS#8,
+// SEC 1 or its bare scalar.  Binary secrets are also found hex- and
+// base64-encoded, including within a longer base64 string such as a PEM
+// block, since whitespace is ignored.
+func (c *Canary) Scan(output []byte) error {
+	compact := bytes.Join(bytes.Fields(output), nil)
+	for _, secret := range c.secrets {
+		for _, form := range canaryForms(secret.value) {
+			if bytes.Contains(output, form.value) || bytes.Contains(compact, form.value) {
+				return &LeakError{Secret: secret.name, Encoding: form.name}
+			}
+		}
+	}
+	return nil
+}
+
+// canaryForms returns the encodings of secret which Scan looks for.  For
+// base64, the encodings of secret starting at each of the three possible
+// offsets from a group boundary are returned, each trimmed to the
+// characters which do not depend on surrounding data.
+func canaryForms(secret []byte) []canarySecret {
+	forms := []canarySecret{
+		{"raw", secret},
+		{"hex", []byte(hex.EncodeToString(secret))},
+		{"upper-case hex", bytes.ToUpper([]byte(hex.EncodeToString(secret)))},
+	}
+	for offset := 0; offset < 3 && len(secret)-offset >= 6; offset++ {
+		aligned := secret[offset:]
+		aligned = aligned[:len(aligned)/3*3]
+		forms = append(forms,
+			canarySecret{"base64", []byte(base64.StdEncoding.EncodeToString(aligned))},
+			canarySecret{"base64url", []byte(base64.URLEncoding.EncodeToString(aligned))})
+	}
+	return forms
+}
@@ -0,0 +1,66 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"log"
+	"testing"
+)
+
+func TestCanary(t *testing.T) {
+	c, err := NewCanary(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privateKey, certificate, err := Decode(c.PFXData, c.Password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.PrivateKey.Equal(privateKey) || !c.Certificate.Equal(certificate) {
+		t.Fatal("canary decodes to another identity")
+	}
+
+	var buf bytes.Buffer
+	logger := log.New(&buf, "", log.LstdFlags)
+	logger.Printf("decoded %s, serial %v", certificate.Subject, certificate.SerialNumber)
+	logger.Printf("certificate:\n%s", pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certificate.Raw}))
+	if err := c.Scan(buf.Bytes()); err != nil {
+		t.Fatalf("found a leak in clean output: %v", err)
+	}
+
+	pkcs8Key, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encodedPassword, err := bmpString(c.Password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		name, output     string
+		secret, encoding string
+	}{
+		{"password", "opening with password " + c.Password, "password", "raw"},
+		{"hex BMPString password", "kdf input " + hex.EncodeToString(encodedPassword), "BMPString password", "hex"},
+		{"PEM private key", "key:\n" + string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8Key})), "PKCS#8 private key", "base64"},
+		{"formatted private key", fmt.Sprintf("key: %+v", privateKey), "decimal private scalar", "raw"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			err := c.Scan([]byte(test.output))
+			leak, ok := err.(*LeakError)
+			if !ok {
+				t.Fatalf("got %v, want a *LeakError", err)
+			}
+			if leak.Secret != test.secret || leak.Encoding != test.encoding {
+				t.Errorf("found the %s %s, want the %s %s", leak.Encoding, leak.Secret, test.encoding, test.secret)
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"crypto/x509"
+)
+
+// A CertBag is a certificate bag decoded from a PKCS#12 file.
+type CertBag struct {
+	// Raw is the DER encoding of the CertBag structure (RFC 7292,
+	// section 4.2.3), exactly as it appears in the file.
+	Raw []byte
+
+	// Certificate is the certificate contained in the bag.  Its Raw field
+	// is exactly the DER embedded in the bag.
+	Certificate *x509.Certificate
+
+	// Annotation is the value returned for Certificate by the Decoder's
+	// CertificateAnnotator, or nil if it has none.
+	Annotation interface{}
+}
+
+// A CertificateAnnotator enriches each certificate decoded by
+// DecodeCertBags with caller-defined metadata, such as certificate
+// transparency lookup results or inventory identifiers, which is stored in
+// CertBag.Annotation.  Returning an error aborts decoding with that error.
+type CertificateAnnotator func(cert *x509.Certificate) (annotation interface{}, err error)
+
+// WithCertificateAnnotator returns a copy of dec which calls annotate for
+// every certificate decoded by DecodeCertBags, in file order.
+func (dec Decoder) WithCertificateAnnotator(annotate CertificateAnnotator) *Decoder {
+	dec.annotate = annotate
+	return &dec
+}
+
+// DecodeCertBags returns every certificate bag in pfxData, in the order in
+// which they appear, using DefaultDecoder.  Unlike DecodeChain, it does not
+// require a private key to be present.
+func DecodeCertBags(pfxData []byte, password string) ([]CertBag, error) {
+	return DefaultDecoder.DecodeCertBags(pfxData, password)
+}
+
+// DecodeCertBags is like the package-level DecodeCertBags function, but uses
+// the options of dec.
+func (dec *Decoder) DecodeCertBags(pfxData []byte, password string) ([]CertBag, error) {
+	encodedPassword, err := bmpString(password)
+	if err != nil {
+		return nil, err
+	}
+
+	bags, _, err := dec.getSafeContents(pfxData, encodedPassword)
+	if err != nil {
+		return nil, err
+	}
+
+	var certBags []CertBag
+	for _, bag := range bags {
+		if !bag.Id.Equal(oidCertBag) {
+			continue
+		}
+		cert, err := dec.parseCert(bag.Value.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certBag := CertBag{Raw: bag.Value.Bytes, Certificate: cert}
+		if dec.annotate != nil {
+			if certBag.Annotation, err = dec.annotate(cert); err != nil {
+				return nil, err
+			}
+		}
+		certBags = append(certBags, certBag)
+	}
+	return certBags, nil
+}
@@ -0,0 +1,80 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/x509"
+	"errors"
+	"testing"
+)
+
+func TestDecodeCertBags(t *testing.T) {
+	rootKey, root := newTestCertificate(t, "root", nil, nil)
+	key, leaf := newTestCertificate(t, "leaf.example.com", root, rootKey)
+	pfxData, err := Encode(rand.Reader, key, leaf, []*x509.Certificate{root}, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certBags, err := DecodeCertBags(pfxData, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(certBags) != 2 {
+		t.Fatalf("got %d cert bags, want 2", len(certBags))
+	}
+	for i, want := range []*x509.Certificate{leaf, root} {
+		if !bytes.Equal(certBags[i].Certificate.Raw, want.Raw) {
+			t.Errorf("#%d: certificate DER differs from input", i)
+		}
+		encoded, err := encodeCertBag(want.Raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(certBags[i].Raw, encoded) {
+			t.Errorf("#%d: raw cert bag differs from encoding", i)
+		}
+	}
+}
+
+func TestCertificateAnnotator(t *testing.T) {
+	rootKey, root := newTestCertificate(t, "root", nil, nil)
+	key, leaf := newTestCertificate(t, "leaf.example.com", root, rootKey)
+	pfxData, err := Encode(rand.Reader, key, leaf, []*x509.Certificate{root}, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	inventory := map[string]int{"leaf.example.com": 17, "root": 42}
+	dec := DefaultDecoder.WithCertificateAnnotator(func(cert *x509.Certificate) (interface{}, error) {
+		id, ok := inventory[cert.Subject.CommonName]
+		if !ok {
+			return nil, errors.New("not in inventory")
+		}
+		return id, nil
+	})
+	certBags, err := dec.DecodeCertBags(pfxData, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, certBag := range certBags {
+		if want := inventory[certBag.Certificate.Subject.CommonName]; certBag.Annotation != want {
+			t.Errorf("%s: got annotation %v, want %d", certBag.Certificate.Subject.CommonName, certBag.Annotation, want)
+		}
+	}
+
+	delete(inventory, "root")
+	if _, err := dec.DecodeCertBags(pfxData, "password"); err == nil || err.Error() != "not in inventory" {
+		t.Errorf("got error %v, want annotator error", err)
+	}
+
+	if certBags, err = DecodeCertBags(pfxData, "password"); err != nil {
+		t.Fatal(err)
+	} else if certBags[0].Annotation != nil {
+		t.Error("DefaultDecoder produced an annotation")
+	}
+}
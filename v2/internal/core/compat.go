@@ -0,0 +1,227 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+
+	"github.com/scholar-ink/go-pkcs12/v2/oids"
+)
+
+// A ReaderCompat is the expected outcome of reading a PKCS#12 file with one
+// commonly used implementation, as reported by ProbeCompatibility.
+type ReaderCompat struct {
+	// Reader names the implementation, such as "OpenSSL 3" or "JDK 8".
+	Reader string
+
+	// Compatible reports whether Reader is expected to accept the file.
+	Compatible bool
+
+	// Reasons describes each feature of the file which Reader is not
+	// expected to support.
+	Reasons []string
+}
+
+// compatReaders are the readers reported by ProbeCompatibility, in order.
+var compatReaders = []string{
+	"OpenSSL 1.0", "OpenSSL 1.1", "OpenSSL 3",
+	"JDK 8", "JDK 11", "JDK 17",
+	"Windows 7", "Windows 10", "Windows 11",
+	"macOS",
+}
+
+// ProbeCompatibility heuristically reports which common readers are
+// expected to accept pfxData, based on the algorithms and structure it
+// uses.  No password is needed, so the MAC is not verified, and shrouded
+// keys inside encrypted SafeContents are not examined.  The results encode
+// widely reported behavior of default configurations, current as of this
+// package's release, and are no substitute for testing with the actual
+// reader.
+func ProbeCompatibility(pfxData []byte) ([]ReaderCompat, error) {
+	pfx := new(pfxPdu)
+	if err := unmarshal(pfxData, pfx); err != nil {
+		return nil, errors.New("pkcs12: error reading P12 data: " + err.Error())
+	}
+	if pfx.Version != 3 {
+		return nil, NotImplementedError("can only decode v3 PFX PDU's")
+	}
+
+	incompatible := make(map[string][]string)
+	reject := func(reason string, readers ...string) {
+		if len(readers) == 0 {
+			readers = compatReaders
+		}
+		for _, reader := range readers {
+			incompatible[reader] = append(incompatible[reader], reason)
+		}
+	}
+
+	var content []byte
+	switch {
+	case pfx.AuthSafe.ContentType.Equal(oidDataContentType):
+		if err := unmarshal(pfx.AuthSafe.Content.Bytes, &content); err != nil {
+			return nil, err
+		}
+	case pfx.AuthSafe.ContentType.Equal(oidSignedDataContentType):
+		reject("public-key integrity mode")
+		signed := new(signedData)
+		if err := unmarshal(pfx.AuthSafe.Content.Bytes, signed); err != nil {
+			return nil, errors.New("pkcs12: error reading signed data: " + err.Error())
+		}
+		var err error
+		if content, err = signed.content(); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, NotImplementedError("only password and public-key integrity modes are implemented")
+	}
+
+	switch macAlgorithm := pfx.MacData.Mac.Algorithm.Algorithm; {
+	case len(macAlgorithm) == 0:
+		reject("no MAC", "JDK 8", "Windows 7", "macOS")
+	case macAlgorithm.Equal(oidSHA1):
+	case macAlgorithm.Equal(oidSHA256):
+		reject("HMAC-SHA-256 MAC (requires update 301 or later)", "JDK 8")
+		reject("HMAC-SHA-256 MAC", "Windows 7", "macOS")
+	case macAlgorithm.Equal(oidSHA384), macAlgorithm.Equal(oidSHA512):
+		name := "HMAC-SHA-384 MAC"
+		if macAlgorithm.Equal(oidSHA512) {
+			name = "HMAC-SHA-512 MAC"
+		}
+		reject(name+" (requires update 301 or later)", "JDK 8")
+		reject(name, "Windows 7", "Windows 10", "Windows 11", "macOS")
+	case macAlgorithm.Equal(oidSM3):
+		reject("HMAC-SM3 MAC", "OpenSSL 1.0", "JDK 8", "JDK 11", "JDK 17", "Windows 7", "Windows 10", "Windows 11", "macOS")
+	default:
+		reject("MAC digest " + oids.Describe(macAlgorithm))
+	}
+
+	authenticatedSafe, err := DefaultDecoder.unmarshalAuthenticatedSafe(content)
+	if err != nil {
+		return nil, err
+	}
+	var algorithms, kdfs []asn1.ObjectIdentifier
+	addAlgorithms := func(algorithm pkix.AlgorithmIdentifier) {
+		encryption, keyDerivation := encryptionAlgorithms(algorithm)
+		algorithms = append(algorithms, encryption...)
+		kdfs = append(kdfs, keyDerivation...)
+	}
+	for _, ci := range authenticatedSafe {
+		switch {
+		case ci.ContentType.Equal(oidDataContentType):
+			var data []byte
+			if err := unmarshal(ci.Content.Bytes, &data); err != nil {
+				return nil, err
+			}
+			if len(data) == 0 {
+				continue
+			}
+			var bags []safeBag
+			if err := DefaultDecoder.unmarshalSafeContents(data, &bags); err != nil {
+				return nil, err
+			}
+			for _, bag := range bags {
+				if !bag.Id.Equal(oidPKCS8ShroundedKeyBag) {
+					continue
+				}
+				pkinfo := new(encryptedPrivateKeyInfo)
+				if err := unmarshal(bag.Value.Bytes, pkinfo); err != nil {
+					return nil, errors.New("pkcs12: error decoding PKCS#8 shrouded key bag: " + err.Error())
+				}
+				addAlgorithms(pkinfo.AlgorithmIdentifier)
+			}
+		case ci.ContentType.Equal(oidEncryptedDataContentType):
+			var encryptedData encryptedData
+			if err := unmarshal(ci.Content.Bytes, &encryptedData); err != nil {
+				return nil, err
+			}
+			addAlgorithms(encryptedData.EncryptedContentInfo.ContentEncryptionAlgorithm)
+		default:
+			reject("content type " + oids.Describe(ci.ContentType))
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, algorithm := range algorithms {
+		if seen[algorithm.String()] {
+			continue
+		}
+		seen[algorithm.String()] = true
+		switch {
+		case algorithm.Equal(oidPBEWithSHAAnd3KeyTripleDESCBC):
+		case algorithm.Equal(oidPBEWithSHAAnd40BitRC2CBC):
+			reject("40-bit RC2 encryption (requires the legacy provider)", "OpenSSL 3")
+		case algorithm.Equal(oidPBES2):
+			reject("PBES2 encryption (requires update 301 or later)", "JDK 8")
+			reject("PBES2 encryption", "Windows 7", "macOS")
+		case algorithm.Equal(oidCamellia128CBC), algorithm.Equal(oidCamellia192CBC), algorithm.Equal(oidCamellia256CBC):
+			reject("Camellia-CBC encryption", "JDK 8", "JDK 11", "JDK 17", "Windows 7", "Windows 10", "Windows 11", "macOS")
+		case algorithm.Equal(oidSM4CBC):
+			reject("SM4-CBC encryption", "OpenSSL 1.0", "JDK 8", "JDK 11", "JDK 17", "Windows 7", "Windows 10", "Windows 11", "macOS")
+		case algorithm.Equal(oidSEEDCBC):
+			reject("SEED-CBC encryption (requires the legacy provider)", "OpenSSL 3")
+			reject("SEED-CBC encryption", "JDK 8", "JDK 11", "JDK 17", "Windows 7", "Windows 10", "Windows 11", "macOS")
+		case algorithm.Equal(oidChaCha20Poly1305):
+			reject("ChaCha20-Poly1305 encryption")
+		case algorithm.Equal(oidAES128CBC), algorithm.Equal(oidAES192CBC), algorithm.Equal(oidAES256CBC),
+			algorithm.Equal(oidAES128CCM), algorithm.Equal(oidAES192CCM), algorithm.Equal(oidAES256CCM):
+		default:
+			reject("encryption algorithm " + oids.Describe(algorithm))
+		}
+	}
+	for _, kdf := range kdfs {
+		if seen[kdf.String()] {
+			continue
+		}
+		seen[kdf.String()] = true
+		switch {
+		case kdf.Equal(oidPBKDF2), kdf.Equal(oidHmacWithSHA1), kdf.Equal(oidHmacWithSHA256), kdf.Equal(oidHmacWithSHA384), kdf.Equal(oidHmacWithSHA512):
+		case kdf.Equal(oidScrypt):
+			reject("scrypt key derivation", "OpenSSL 1.0", "JDK 8", "JDK 11", "JDK 17", "Windows 7", "Windows 10", "Windows 11", "macOS")
+		case kdf.Equal(oidHmacWithSM3):
+			reject("HMAC-SM3 pseudorandom function", "OpenSSL 1.0", "JDK 8", "JDK 11", "JDK 17", "Windows 7", "Windows 10", "Windows 11", "macOS")
+		case kdf.Equal(oidHmacWithStreebog512):
+			reject("HMAC-Streebog-512 pseudorandom function (requires the GOST engine)", "OpenSSL 1.0", "OpenSSL 1.1", "OpenSSL 3")
+			reject("HMAC-Streebog-512 pseudorandom function", "JDK 8", "JDK 11", "JDK 17", "Windows 7", "Windows 10", "Windows 11", "macOS")
+		default:
+			reject("key derivation function " + oids.Describe(kdf))
+		}
+	}
+
+	compat := make([]ReaderCompat, len(compatReaders))
+	for i, reader := range compatReaders {
+		compat[i] = ReaderCompat{
+			Reader:     reader,
+			Compatible: len(incompatible[reader]) == 0,
+			Reasons:    incompatible[reader],
+		}
+	}
+	return compat, nil
+}
+
+// encryptionAlgorithms returns the OID of the password-based encryption
+// algorithm followed, if it is PBES2, by that of its encryption scheme.  For
+// PBES2 it also returns the OID of the key derivation function followed, if
+// that is PBKDF2, by that of its pseudorandom function.
+func encryptionAlgorithms(algorithm pkix.AlgorithmIdentifier) (encryption, keyDerivation []asn1.ObjectIdentifier) {
+	if !algorithm.Algorithm.Equal(oidPBES2) {
+		return []asn1.ObjectIdentifier{algorithm.Algorithm}, nil
+	}
+	var params pbes2Params
+	if err := unmarshal(algorithm.Parameters.FullBytes, &params); err != nil {
+		return []asn1.ObjectIdentifier{algorithm.Algorithm}, nil
+	}
+	encryption = []asn1.ObjectIdentifier{algorithm.Algorithm, params.EncryptionScheme.Algorithm}
+	keyDerivation = []asn1.ObjectIdentifier{params.KeyDerivationFunc.Algorithm}
+	if params.KeyDerivationFunc.Algorithm.Equal(oidPBKDF2) {
+		var kdfParams pbkdf2Params
+		if err := unmarshal(params.KeyDerivationFunc.Parameters.FullBytes, &kdfParams); err == nil && len(kdfParams.PRF.Algorithm) != 0 {
+			keyDerivation = append(keyDerivation, kdfParams.PRF.Algorithm)
+		}
+	}
+	return encryption, keyDerivation
+}
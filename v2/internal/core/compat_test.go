@@ -0,0 +1,78 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"crypto"
+	"crypto/rand"
+	"testing"
+)
+
+func TestProbeCompatibility(t *testing.T) {
+	key, cert := newTestCertificate(t, "compat.example.com", nil, nil)
+	for _, test := range []struct {
+		name         string
+		enc          *Encoder
+		incompatible []string
+	}{
+		{"DefaultEncoder", DefaultEncoder, nil},
+		{"Legacy", Legacy, []string{"OpenSSL 3"}},
+		{"SHA-256 MAC", DefaultEncoder.WithCompatibilityLevel(2024), []string{"JDK 8", "Windows 7", "macOS"}},
+		{"SHA-512 MAC", DefaultEncoder.WithMAC(crypto.SHA512, 2048), []string{"JDK 8", "Windows 7", "Windows 10", "Windows 11", "macOS"}},
+		{"Modern", Modern, []string{"JDK 8", "Windows 7", "macOS"}},
+		{"scrypt", Modern.WithScrypt(1<<10, 8, 1), []string{"OpenSSL 1.0", "JDK 8", "JDK 11", "JDK 17", "Windows 7", "Windows 10", "Windows 11", "macOS"}},
+	} {
+		pfxData, err := test.enc.Encode(rand.Reader, key, cert, nil, "password")
+		if err != nil {
+			t.Fatal(err)
+		}
+		compat, err := ProbeCompatibility(pfxData)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(compat) != len(compatReaders) {
+			t.Fatalf("%s: got %d readers, want %d", test.name, len(compat), len(compatReaders))
+		}
+		want := make(map[string]bool)
+		for _, reader := range test.incompatible {
+			want[reader] = true
+		}
+		for _, c := range compat {
+			if c.Compatible == want[c.Reader] {
+				t.Errorf("%s: %s: got compatible %v, reasons %q", test.name, c.Reader, c.Compatible, c.Reasons)
+			}
+			if !c.Compatible && len(c.Reasons) == 0 {
+				t.Errorf("%s: %s: incompatible without a reason", test.name, c.Reader)
+			}
+		}
+	}
+}
+
+func TestProbeCompatibilityReasons(t *testing.T) {
+	key, cert := newTestCertificate(t, "compat.example.com", nil, nil)
+	pfxData, err := Modern.Encode(rand.Reader, key, cert, nil, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	compat, err := ProbeCompatibility(pfxData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reasons := make(map[string][]string)
+	for _, c := range compat {
+		reasons[c.Reader] = c.Reasons
+	}
+	// Only JDK 8 is told that an update would help.
+	want := map[string]string{
+		"JDK 8":     "HMAC-SHA-256 MAC (requires update 301 or later)",
+		"Windows 7": "HMAC-SHA-256 MAC",
+		"macOS":     "HMAC-SHA-256 MAC",
+	}
+	for reader, reason := range want {
+		if len(reasons[reader]) == 0 || reasons[reader][0] != reason {
+			t.Errorf("%s: got reasons %q, want %q first", reader, reasons[reader], reason)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"io"
+	"strconv"
+
+	"github.com/scholar-ink/go-pkcs12/v2/oids"
+)
+
+var (
+	// oidCompressedBag marks a SafeBag holding a compressed certificate
+	// or CRL bag.  It is the CMS CompressedData content type, which is
+	// not a bag type of RFC 7292, so other implementations treat such
+	// bags as unknown.  See https://tools.ietf.org/html/rfc3274.
+	oidCompressedBag = asn1.ObjectIdentifier([]int{1, 2, 840, 113549, 1, 9, 16, 1, 9})
+	oidZlibCompress  = asn1.ObjectIdentifier([]int{1, 2, 840, 113549, 1, 9, 16, 3, 8})
+)
+
+// defaultMaxDecompressedSize is the number of bytes to which a Decoder
+// lets the compressed bags of a file expand, unless changed with
+// WithMaxDecompressedSize.
+const defaultMaxDecompressedSize = 4 << 20
+
+// compressedData is the CompressedData of RFC 3274, whose encapsulated
+// content type is that of the compressed bag.
+type compressedData struct {
+	Version              int
+	CompressionAlgorithm pkix.AlgorithmIdentifier
+	EncapContentInfo     encapsulatedContentInfo
+}
+
+type encapsulatedContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     []byte `asn1:"tag:0,explicit"`
+}
+
+// WithBagCompression returns a copy of enc whose trust store encoding
+// methods compress with zlib each certificate and CRL bag whose value is
+// at least threshold bytes long, if that makes it shorter, to reduce the
+// size of large bundles sent to devices with little bandwidth.  The
+// compressed bags keep their attributes, but use a bag type which only
+// this package understands; other implementations ignore or reject them.
+// A threshold of 0 disables compression.
+func (enc Encoder) WithBagCompression(threshold int) *Encoder {
+	enc.compressionThreshold = threshold
+	return &enc
+}
+
+// WithMaxDecompressedSize returns a copy of dec which fails to decode a
+// file whose compressed bags, such as those written by an Encoder
+// configured with WithBagCompression, expand to more than limit bytes in
+// total.  The default limit, restored by a limit of 0, is 4 MiB.
+func (dec Decoder) WithMaxDecompressedSize(limit int) *Decoder {
+	dec.maxDecompressedSize = limit
+	return &dec
+}
+
+// compressBags returns bags with the certificate and CRL bags compressed
+// according to enc.  bags is not modified.
+func (enc *Encoder) compressBags(bags []safeBag) ([]safeBag, error) {
+	if enc.compressionThreshold <= 0 {
+		return bags, nil
+	}
+	compressed := make([]safeBag, len(bags))
+	for i, bag := range bags {
+		if (bag.Id.Equal(oidCertBag) || bag.Id.Equal(oidCRLBag)) && len(bag.Value.Bytes) >= enc.compressionThreshold {
+			var err error
+			if bag, err = compressBag(bag); err != nil {
+				return nil, err
+			}
+		}
+		compressed[i] = bag
+	}
+	return compressed, nil
+}
+
+// compressBag returns bag compressed, or bag itself if compression does
+// not make it shorter.
+func compressBag(bag safeBag) (safeBag, error) {
+	var buf bytes.Buffer
+	w, err := zlib.NewWriterLevel(&buf, zlib.BestCompression)
+	if err != nil {
+		return bag, err
+	}
+	if _, err := w.Write(bag.Value.Bytes); err != nil {
+		return bag, err
+	}
+	if err := w.Close(); err != nil {
+		return bag, err
+	}
+
+	var data compressedData
+	data.CompressionAlgorithm.Algorithm = oidZlibCompress
+	data.EncapContentInfo.ContentType = bag.Id
+	data.EncapContentInfo.Content = buf.Bytes()
+	value, err := asn1.Marshal(data)
+	if err != nil {
+		return bag, errors.New("pkcs12: error encoding compressed bag: " + err.Error())
+	}
+	if len(value) >= len(bag.Value.Bytes) {
+		return bag, nil
+	}
+
+	compressed := safeBag{Id: oidCompressedBag, Attributes: bag.Attributes}
+	compressed.Value.Class = 2
+	compressed.Value.Tag = 0
+	compressed.Value.IsCompound = true
+	compressed.Value.Bytes = value
+	return compressed, nil
+}
+
+// decompressBags replaces the compressed bags among bags with the bags
+// they contain, failing if they expand beyond the limit of dec.
+func (dec *Decoder) decompressBags(bags []safeBag) error {
+	limit := dec.maxDecompressedSize
+	if limit <= 0 {
+		limit = defaultMaxDecompressedSize
+	}
+	for i := range bags {
+		if !bags[i].Id.Equal(oidCompressedBag) {
+			continue
+		}
+		bagType, value, err := decompressBag(bags[i].Value.Bytes, limit)
+		if err != nil {
+			return err
+		}
+		limit -= len(value)
+		bags[i].Id = bagType
+		bags[i].Value = asn1.RawValue{Class: 2, Tag: 0, IsCompound: true, Bytes: value}
+	}
+	return nil
+}
+
+// decompressBag returns the bag type and value of the compressed bag
+// asn1Data, which may expand to at most limit bytes.
+func decompressBag(asn1Data []byte, limit int) (bagType asn1.ObjectIdentifier, value []byte, err error) {
+	var data compressedData
+	if err := unmarshal(asn1Data, &data); err != nil {
+		return nil, nil, errors.New("pkcs12: error decoding compressed bag: " + err.Error())
+	}
+	if data.Version != 0 {
+		return nil, nil, NotImplementedError("compressed bag version " + strconv.Itoa(data.Version) + " is not supported")
+	}
+	if !data.CompressionAlgorithm.Algorithm.Equal(oidZlibCompress) {
+		return nil, nil, NotImplementedError("compression algorithm " + oids.Describe(data.CompressionAlgorithm.Algorithm) + " is not supported")
+	}
+	contentType := data.EncapContentInfo.ContentType
+	if !contentType.Equal(oidCertBag) && !contentType.Equal(oidCRLBag) {
+		return nil, nil, errors.New("pkcs12: compressed bag holds a " + oids.Name(contentType) + ", not a certificate or CRL bag")
+	}
+
+	r, err := zlib.NewReader(bytes.NewReader(data.EncapContentInfo.Content))
+	if err != nil {
+		return nil, nil, errors.New("pkcs12: error decompressing bag: " + err.Error())
+	}
+	defer r.Close()
+	decompressed, err := io.ReadAll(io.LimitReader(r, int64(limit)+1))
+	if err != nil {
+		return nil, nil, errors.New("pkcs12: error decompressing bag: " + err.Error())
+	}
+	if len(decompressed) > limit {
+		return nil, nil, errors.New("pkcs12: compressed bags expand to more than the limit of the Decoder")
+	}
+	return contentType, decompressed, nil
+}
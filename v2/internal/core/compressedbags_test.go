@@ -0,0 +1,102 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newCompressibleCertificate returns a self-signed certificate with many
+// names, which compresses well, as do the large bundles that compression
+// is meant for.
+func newCompressibleCertificate(t *testing.T) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "www.example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	for i := 0; i < 200; i++ {
+		template.DNSNames = append(template.DNSNames, "host-"+strconv.Itoa(i)+".example.com")
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func TestBagCompression(t *testing.T) {
+	ca, crl := newTestCRLIssuer(t, "CA")
+	cert := newCompressibleCertificate(t)
+	certs := []*x509.Certificate{ca, cert}
+	crls := []*x509.RevocationList{crl}
+
+	plain, err := Modern.EncodeTrustStoreWithCRLs(rand.Reader, certs, crls, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	compressed, err := Modern.WithBagCompression(256).EncodeTrustStoreWithCRLs(rand.Reader, certs, crls, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(compressed) >= len(plain)-len(cert.Raw)/2 {
+		t.Errorf("compressed trust store has %d bytes, uncompressed %d", len(compressed), len(plain))
+	}
+
+	decodedCerts, decodedCRLs, err := DecodeTrustStoreWithCRLs(compressed, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(decodedCerts) != 2 || !decodedCerts[0].Equal(ca) || !decodedCerts[1].Equal(cert) {
+		t.Error("decoded certificates do not match")
+	}
+	if len(decodedCRLs) != 1 || string(decodedCRLs[0].Raw) != string(crl.Raw) {
+		t.Error("decoded CRLs do not match")
+	}
+
+	if _, err := DefaultDecoder.WithMaxDecompressedSize(len(cert.Raw)-1).DecodeTrustStore(compressed, "password"); err == nil || !strings.Contains(err.Error(), "limit") {
+		t.Errorf("got error %v for a bag beyond the decompression limit", err)
+	}
+}
+
+func TestBagCompressionLimit(t *testing.T) {
+	bag := safeBag{Id: oidCertBag}
+	bag.Value.Bytes = make([]byte, defaultMaxDecompressedSize+1)
+	compressed, err := compressBag(bag)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !compressed.Id.Equal(oidCompressedBag) {
+		t.Fatal("zeros were not compressed")
+	}
+	pfxData, err := Modern.encodeTrustStoreBags(rand.Reader, []safeBag{compressed}, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pfxData) > 64<<10 {
+		t.Fatalf("compressed bag takes %d bytes", len(pfxData))
+	}
+	if _, err := DecodeTrustStore(pfxData, "password"); err == nil || !strings.Contains(err.Error(), "limit") {
+		t.Errorf("got error %v for a bag beyond the default decompression limit", err)
+	}
+}
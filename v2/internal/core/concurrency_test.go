@@ -0,0 +1,81 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"crypto/rand"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// sharedDecoder and sharedEncoder are configured once and then used from
+// many goroutines, as consuming services do.
+var (
+	sharedDecoder = DefaultDecoder.WithLeafInChain(true).WithSanitizedAttributes(64)
+	sharedEncoder = DefaultEncoder.WithCompatibilityLevel(2024)
+)
+
+func TestWithMethodsCopy(t *testing.T) {
+	dec, enc := *sharedDecoder, *sharedEncoder
+
+	sharedDecoder.WithTrailingZeroPadding(true).WithLeafInChain(false).WithDuplicateCertificates(RejectDuplicateCertificates)
+	sharedDecoder.WithIgnoredKeyBags(nil).WithASN1Parser(StreamParser).WithEmptyContainers(nil).WithSanitizedAttributes(1)
+	sharedEncoder.WithCompatibilityLevel(2000)
+
+	if !reflect.DeepEqual(dec, *sharedDecoder) {
+		t.Error("configuring a copy modified the shared Decoder")
+	}
+	if !reflect.DeepEqual(enc, *sharedEncoder) {
+		t.Error("configuring a copy modified the shared Encoder")
+	}
+}
+
+// TestConcurrentUse is meaningful when run with the race detector.
+func TestConcurrentUse(t *testing.T) {
+	key, cert := newTestCertificate(t, "concurrent.example.com", nil, nil)
+	pfxData, err := sharedEncoder.Encode(rand.Reader, key, cert, nil, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 32)
+	for i := 0; i < 8; i++ {
+		wg.Add(4)
+		go func() {
+			defer wg.Done()
+			if _, err := sharedEncoder.Encode(rand.Reader, key, cert, nil, "password"); err != nil {
+				errs <- err
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			_, certificate, caCerts, err := sharedDecoder.DecodeChainWithCAs(pfxData, "password")
+			if err != nil {
+				errs <- err
+			} else if !certificate.Equal(cert) || len(caCerts) != 1 {
+				t.Error("got unexpected DecodeChain results")
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if _, _, err := sharedDecoder.WithASN1Parser(StreamParser).WithLeafInChain(false).Decode(pfxData, "password"); err != nil {
+				errs <- err
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if _, err := sharedDecoder.Dump(pfxData, "password"); err != nil {
+				errs <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
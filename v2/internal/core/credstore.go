@@ -0,0 +1,134 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"context"
+	"crypto"
+	"crypto/tls"
+	"errors"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// A CredentialStore holds the active TLS identity loaded from a PKCS#12 file
+// and atomically replaces it whenever the file is successfully reloaded.
+//
+// Unlike Entry, which reloads lazily during handshakes, a CredentialStore
+// only reloads when Reload is called or while Watch is running.  Like Entry,
+// it validates every new identity before making it active: the private key
+// must match the end-entity certificate, and the certificate must be within
+// its validity period.  An identity that fails validation is never served.
+//
+// A CredentialStore is safe for concurrent use by multiple goroutines.
+type CredentialStore struct {
+	path     string
+	password string
+
+	active atomic.Pointer[tls.Certificate]
+
+	mu      sync.Mutex // serializes reloads
+	modTime time.Time
+	size    int64
+}
+
+// NewCredentialStore loads, decodes, and validates the PKCS#12 file at path,
+// returning an error if any of these steps fail.
+func NewCredentialStore(path, password string) (*CredentialStore, error) {
+	s := &CredentialStore{path: path, password: password}
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Reload re-reads, decodes, and validates the file.  On success, the new
+// identity becomes active; on failure, the previous identity remains active
+// and the error is returned.
+func (s *CredentialStore) Reload() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return errors.New("pkcs12: error reading " + s.path + ": " + err.Error())
+	}
+	cert, err := loadValidTLSCertificate(s.path, s.password)
+	if err != nil {
+		return err
+	}
+	s.active.Store(cert)
+	s.modTime, s.size = info.ModTime(), info.Size()
+	return nil
+}
+
+// Watch polls the file every interval and calls Reload whenever its
+// modification time or size changes, until ctx is done.  Errors from Reload
+// are passed to onError, which may be nil.  Watch blocks, so it is normally
+// run in its own goroutine.
+func (s *CredentialStore) Watch(ctx context.Context, interval time.Duration, onError func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		info, err := os.Stat(s.path)
+		if err == nil {
+			s.mu.Lock()
+			unchanged := info.ModTime().Equal(s.modTime) && info.Size() == s.size
+			s.mu.Unlock()
+			if unchanged {
+				continue
+			}
+			err = s.Reload()
+		}
+		if err != nil && onError != nil {
+			onError(err)
+		}
+	}
+}
+
+// Certificate returns the active identity.
+func (s *CredentialStore) Certificate() *tls.Certificate {
+	return s.active.Load()
+}
+
+// GetCertificate returns the active identity.  It has the signature of
+// tls.Config.GetCertificate.
+func (s *CredentialStore) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return s.Certificate(), nil
+}
+
+// GetClientCertificate returns the active identity.  It has the signature of
+// tls.Config.GetClientCertificate.
+func (s *CredentialStore) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	return s.Certificate(), nil
+}
+
+// validateTLSCertificate checks that cert's private key matches its leaf
+// certificate and that the leaf is valid at now.
+func validateTLSCertificate(cert *tls.Certificate, now time.Time) error {
+	signer, ok := cert.PrivateKey.(crypto.Signer)
+	if !ok {
+		return errors.New("pkcs12: private key does not implement crypto.Signer")
+	}
+	if !publicKeyMatches(signer.Public(), cert.Leaf) {
+		return errors.New("pkcs12: private key does not match certificate")
+	}
+	if now.Before(cert.Leaf.NotBefore) {
+		return errors.New("pkcs12: certificate is not yet valid")
+	}
+	if now.After(cert.Leaf.NotAfter) {
+		return errors.New("pkcs12: certificate has expired")
+	}
+	return nil
+}
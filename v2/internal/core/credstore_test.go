@@ -0,0 +1,83 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCredentialStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "identity.p12")
+	start := time.Now().Add(-time.Hour)
+	writeTestP12(t, path, "first.example.com", "password", start)
+
+	store, err := NewCredentialStore(path, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := store.Certificate().Leaf.Subject.CommonName; got != "first.example.com" {
+		t.Fatalf("got %q, want first.example.com", got)
+	}
+
+	// Without Reload or Watch, changes are not picked up.
+	writeTestP12(t, path, "second.example.com", "password", start.Add(time.Minute))
+	if got := store.Certificate().Leaf.Subject.CommonName; got != "first.example.com" {
+		t.Errorf("before Reload: got %q, want first.example.com", got)
+	}
+	if err := store.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if cert, _ := store.GetCertificate(nil); cert.Leaf.Subject.CommonName != "second.example.com" {
+		t.Errorf("after Reload: got %q, want second.example.com", cert.Leaf.Subject.CommonName)
+	}
+
+	// An identity whose key does not match its certificate is rejected.
+	_, cert := newTestCertificate(t, "mismatch.example.com", nil, nil)
+	otherKey, _ := newTestCertificate(t, "other.example.com", nil, nil)
+	pfxData := encodeMismatchedIdentity(t, otherKey, cert)
+	if err := os.WriteFile(path, pfxData, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Reload(); err == nil {
+		t.Error("expected Reload to reject mismatched key")
+	}
+	if cert, _ := store.GetClientCertificate(nil); cert.Leaf.Subject.CommonName != "second.example.com" {
+		t.Errorf("after failed Reload: got %q, want second.example.com", cert.Leaf.Subject.CommonName)
+	}
+}
+
+func TestCredentialStoreWatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "identity.p12")
+	start := time.Now().Add(-time.Hour)
+	writeTestP12(t, path, "first.example.com", "password", start)
+
+	store, err := NewCredentialStore(path, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		store.Watch(ctx, 10*time.Millisecond, func(err error) { t.Error(err) })
+		close(done)
+	}()
+
+	writeTestP12(t, path, "second.example.com", "password", start.Add(time.Minute))
+	deadline := time.Now().Add(5 * time.Second)
+	for store.Certificate().Leaf.Subject.CommonName != "second.example.com" {
+		if time.Now().After(deadline) {
+			t.Fatal("Watch did not pick up the new identity")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cancel()
+	<-done
+}
@@ -0,0 +1,124 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"errors"
+	"io"
+	"strconv"
+)
+
+var (
+	// see https://tools.ietf.org/html/rfc7292#section-4.2.4
+	oidCRLBag         = asn1.ObjectIdentifier([]int{1, 2, 840, 113549, 1, 12, 10, 1, 4})
+	oidCRLTypeX509CRL = asn1.ObjectIdentifier([]int{1, 2, 840, 113549, 1, 9, 23, 1})
+)
+
+type crlBag struct {
+	Id   asn1.ObjectIdentifier
+	Data []byte `asn1:"tag:0,explicit"`
+}
+
+func decodeCRLBag(asn1Data []byte) (x509CRL []byte, err error) {
+	bag := new(crlBag)
+	if err := unmarshal(asn1Data, bag); err != nil {
+		return nil, errors.New("pkcs12: error decoding CRL bag: " + err.Error())
+	}
+	if !bag.Id.Equal(oidCRLTypeX509CRL) {
+		return nil, NotImplementedError("only X509 CRLs are supported")
+	}
+	return bag.Data, nil
+}
+
+// parseCRLBag parses the X.509 CRL contained in the CRL bag asn1Data.
+func parseCRLBag(asn1Data []byte) (*x509.RevocationList, error) {
+	crlData, err := decodeCRLBag(asn1Data)
+	if err != nil {
+		return nil, err
+	}
+	return x509.ParseRevocationList(crlData)
+}
+
+// makeCRLBag returns a CRL bag embedding the DER CRL crlBytes verbatim.
+func makeCRLBag(crlBytes []byte, attributes []pkcs12Attribute) (*safeBag, error) {
+	data, err := asn1.Marshal(crlBag{Id: oidCRLTypeX509CRL, Data: crlBytes})
+	if err != nil {
+		return nil, errors.New("pkcs12: error encoding CRL bag: " + err.Error())
+	}
+	bag := new(safeBag)
+	bag.Id = oidCRLBag
+	bag.Value.Class = 2
+	bag.Value.Tag = 0
+	bag.Value.IsCompound = true
+	bag.Value.Bytes = data
+	bag.Attributes = attributes
+	return bag, nil
+}
+
+// EncodeTrustStoreWithCRLs is like EncodeTrustStore, but also embeds the
+// current CRL of some or all of the CAs, so that systems without network
+// access receive revocation information together with the trust anchors.
+// Each CRL must be signed by one of certs, and no CA may have more than one
+// CRL.  The CRLs are stored in CRL bags carrying the same friendlyName as
+// the certificate of their issuer.
+func EncodeTrustStoreWithCRLs(rand io.Reader, certs []*x509.Certificate, crls []*x509.RevocationList, password string) (pfxData []byte, err error) {
+	return DefaultEncoder.EncodeTrustStoreWithCRLs(rand, certs, crls, password)
+}
+
+// EncodeTrustStoreWithCRLs is like the package-level
+// EncodeTrustStoreWithCRLs function, but uses the algorithms of enc.
+func (enc *Encoder) EncodeTrustStoreWithCRLs(rand io.Reader, certs []*x509.Certificate, crls []*x509.RevocationList, password string) (pfxData []byte, err error) {
+	var crlBags []safeBag
+	issued := make(map[*x509.Certificate]bool, len(crls))
+	for i, crl := range crls {
+		if crl == nil {
+			return nil, errors.New("pkcs12: CRL " + strconv.Itoa(i) + " is nil")
+		}
+		issuer := crlIssuer(crl, certs)
+		if issuer == nil {
+			return nil, errors.New("pkcs12: CRL of " + crl.Issuer.String() + " is not signed by any of the certificates")
+		}
+		if issued[issuer] {
+			return nil, errors.New("pkcs12: more than one CRL of " + crl.Issuer.String())
+		}
+		issued[issuer] = true
+
+		friendlyNameAttr, err := makeFriendlyNameAttribute(issuer.Subject.String())
+		if err != nil {
+			return nil, err
+		}
+		bag, err := makeCRLBag(crl.Raw, []pkcs12Attribute{friendlyNameAttr})
+		if err != nil {
+			return nil, err
+		}
+		crlBags = append(crlBags, *bag)
+	}
+	return enc.encodeTrustStore(rand, certs, crlBags, password)
+}
+
+// crlIssuer returns the certificate among certs which signed crl, or nil.
+func crlIssuer(crl *x509.RevocationList, certs []*x509.Certificate) *x509.Certificate {
+	for _, cert := range certs {
+		if cert != nil && crl.CheckSignatureFrom(cert) == nil {
+			return cert
+		}
+	}
+	return nil
+}
+
+// DecodeTrustStoreWithCRLs is like DecodeTrustStore, but also returns the
+// CRLs in pfxData, such as those embedded by EncodeTrustStoreWithCRLs, in
+// the order in which they appear.  The CRLs are parsed but not verified.
+func DecodeTrustStoreWithCRLs(pfxData []byte, password string) (certs []*x509.Certificate, crls []*x509.RevocationList, err error) {
+	return DefaultDecoder.DecodeTrustStoreWithCRLs(pfxData, password)
+}
+
+// DecodeTrustStoreWithCRLs is like the package-level
+// DecodeTrustStoreWithCRLs function, but uses the options of dec.
+func (dec *Decoder) DecodeTrustStoreWithCRLs(pfxData []byte, password string) (certs []*x509.Certificate, crls []*x509.RevocationList, err error) {
+	return dec.decodeTrustStore(pfxData, password, true)
+}
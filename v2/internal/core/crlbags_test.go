@@ -0,0 +1,105 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// newTestCRLIssuer returns a self-signed CA which may sign CRLs, together
+// with an empty CRL which it has signed.
+func newTestCRLIssuer(t *testing.T, commonName string) (*x509.Certificate, *x509.RevocationList) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err = x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		Number:     big.NewInt(1),
+		ThisUpdate: time.Now().Add(-time.Hour),
+		NextUpdate: time.Now().Add(time.Hour),
+	}, cert, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	crl, err := x509.ParseRevocationList(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, crl
+}
+
+func TestTrustStoreWithCRLs(t *testing.T) {
+	ca1, crl1 := newTestCRLIssuer(t, "CA 1")
+	ca2, crl2 := newTestCRLIssuer(t, "CA 2")
+	ca3, _ := newTestCRLIssuer(t, "CA 3")
+	certs := []*x509.Certificate{ca1, ca2, ca3}
+
+	pfxData, err := EncodeTrustStoreWithCRLs(rand.Reader, certs, []*x509.RevocationList{crl2, crl1}, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gotCerts, gotCRLs, err := DecodeTrustStoreWithCRLs(pfxData, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(gotCerts) != 3 || len(gotCRLs) != 2 {
+		t.Fatalf("got %d certificates and %d CRLs, want 3 and 2", len(gotCerts), len(gotCRLs))
+	}
+	for i, cert := range gotCerts {
+		if !cert.Equal(certs[i]) {
+			t.Errorf("certificate %d differs", i)
+		}
+	}
+	if string(gotCRLs[0].Raw) != string(crl2.Raw) || string(gotCRLs[1].Raw) != string(crl1.Raw) {
+		t.Error("got the wrong CRLs")
+	}
+
+	blocks, err := ToPEM(pfxData, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != 5 || blocks[3].Type != "X509 CRL" || blocks[3].Headers["friendlyName"] != ca2.Subject.String() {
+		t.Errorf("the CRL bags are not named after their issuer")
+	}
+
+	// DecodeTrustStore skips the CRLs.
+	if gotCerts, err = DecodeTrustStore(pfxData, "password"); err != nil {
+		t.Fatal(err)
+	} else if len(gotCerts) != 3 {
+		t.Errorf("DecodeTrustStore returned %d certificates, want 3", len(gotCerts))
+	}
+
+	if _, err := EncodeTrustStoreWithCRLs(rand.Reader, certs[:1], []*x509.RevocationList{crl2}, "password"); err == nil {
+		t.Error("encoded a CRL whose issuer is not in the trust store")
+	}
+	if _, err := EncodeTrustStoreWithCRLs(rand.Reader, certs, []*x509.RevocationList{crl1, crl1}, "password"); err == nil {
+		t.Error("encoded two CRLs of one issuer")
+	}
+}
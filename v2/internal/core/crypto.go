@@ -0,0 +1,417 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Copyright 2015 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/sha1"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"io"
+
+	"github.com/scholar-ink/go-pkcs12/v2/internal/rc2"
+	"github.com/scholar-ink/go-pkcs12/v2/oids"
+)
+
+var (
+	oidPBEWithSHAAnd3KeyTripleDESCBC = asn1.ObjectIdentifier([]int{1, 2, 840, 113549, 1, 12, 1, 3})
+	oidPBEWithSHAAnd2KeyTripleDESCBC = asn1.ObjectIdentifier([]int{1, 2, 840, 113549, 1, 12, 1, 4})
+	oidPBEWithSHAAnd128BitRC2CBC     = asn1.ObjectIdentifier([]int{1, 2, 840, 113549, 1, 12, 1, 5})
+	oidPBEWithSHAAnd40BitRC2CBC      = asn1.ObjectIdentifier([]int{1, 2, 840, 113549, 1, 12, 1, 6})
+	oidPBES2                         = asn1.ObjectIdentifier([]int{1, 2, 840, 113549, 1, 5, 13})
+)
+
+// pbeCipher is an abstraction of a PKCS#12 cipher.
+type pbeCipher interface {
+	// create returns a cipher.Block given a key.
+	create(key []byte) (cipher.Block, error)
+	// deriveKey returns a key derived from the given password and salt.
+	deriveKey(salt, password []byte, iterations int, m *kdfMonitor) []byte
+	// deriveKey returns an IV derived from the given password and salt.
+	deriveIV(salt, password []byte, iterations int, m *kdfMonitor) []byte
+}
+
+type shaWithTripleDESCBC struct{}
+
+func (shaWithTripleDESCBC) create(key []byte) (cipher.Block, error) {
+	return des.NewTripleDESCipher(key)
+}
+
+func (shaWithTripleDESCBC) deriveKey(salt, password []byte, iterations int, m *kdfMonitor) []byte {
+	return pbkdf(sha1.New, 20, 64, salt, password, iterations, 1, 24, m)
+}
+
+func (shaWithTripleDESCBC) deriveIV(salt, password []byte, iterations int, m *kdfMonitor) []byte {
+	return pbkdf(sha1.New, 20, 64, salt, password, iterations, 2, 8, m)
+}
+
+// shaWith2KeyTripleDESCBC is the Triple DES variant of older Java and
+// Mozilla stacks, whose third key is the same as the first.
+type shaWith2KeyTripleDESCBC struct{}
+
+func (shaWith2KeyTripleDESCBC) create(key []byte) (cipher.Block, error) {
+	return des.NewTripleDESCipher(append(key[:16:16], key[:8]...))
+}
+
+func (shaWith2KeyTripleDESCBC) deriveKey(salt, password []byte, iterations int, m *kdfMonitor) []byte {
+	return pbkdf(sha1.New, 20, 64, salt, password, iterations, 1, 16, m)
+}
+
+func (shaWith2KeyTripleDESCBC) deriveIV(salt, password []byte, iterations int, m *kdfMonitor) []byte {
+	return pbkdf(sha1.New, 20, 64, salt, password, iterations, 2, 8, m)
+}
+
+type shaWith128BitRC2CBC struct{}
+
+func (shaWith128BitRC2CBC) create(key []byte) (cipher.Block, error) {
+	return rc2.New(key, len(key)*8)
+}
+
+func (shaWith128BitRC2CBC) deriveKey(salt, password []byte, iterations int, m *kdfMonitor) []byte {
+	return pbkdf(sha1.New, 20, 64, salt, password, iterations, 1, 16, m)
+}
+
+func (shaWith128BitRC2CBC) deriveIV(salt, password []byte, iterations int, m *kdfMonitor) []byte {
+	return pbkdf(sha1.New, 20, 64, salt, password, iterations, 2, 8, m)
+}
+
+type shaWith40BitRC2CBC struct{}
+
+func (shaWith40BitRC2CBC) create(key []byte) (cipher.Block, error) {
+	return rc2.New(key, len(key)*8)
+}
+
+func (shaWith40BitRC2CBC) deriveKey(salt, password []byte, iterations int, m *kdfMonitor) []byte {
+	return pbkdf(sha1.New, 20, 64, salt, password, iterations, 1, 5, m)
+}
+
+func (shaWith40BitRC2CBC) deriveIV(salt, password []byte, iterations int, m *kdfMonitor) []byte {
+	return pbkdf(sha1.New, 20, 64, salt, password, iterations, 2, 8, m)
+}
+
+// isWeakEncryptionAlgorithm reports whether the encryption algorithm
+// identified by algorithm is considered too weak to be produced once
+// DisableLegacyEncoding has been called.
+func isWeakEncryptionAlgorithm(algorithm asn1.ObjectIdentifier) bool {
+	return algorithm.Equal(oidPBEWithSHAAnd40BitRC2CBC)
+}
+
+// checkInsecure returns an error if algorithm is too weak to be trusted and
+// dec does not allow insecure algorithms.
+func (dec *Decoder) checkInsecure(algorithm asn1.ObjectIdentifier) error {
+	if dec.allowInsecure {
+		return nil
+	}
+	switch {
+	case isPBES1(algorithm):
+		return NotImplementedError("PKCS#5 v1.5 algorithm " + oids.Describe(algorithm) + " is insecure and requires WithAllowInsecure")
+	case isStreamPBE(algorithm):
+		return NotImplementedError("RC4 algorithm " + oids.Describe(algorithm) + " is insecure and requires WithAllowInsecure")
+	}
+	return nil
+}
+
+// encryptionStrength returns the approximate security, in bits, of the
+// encryption algorithm identified by algorithm, or 0 if it is unknown.
+// scheme identifies the encryption scheme if algorithm is PBES2.
+func encryptionStrength(algorithm, scheme asn1.ObjectIdentifier) int {
+	switch {
+	case algorithm.Equal(oidPBEWithSHAAnd3KeyTripleDESCBC), algorithm.Equal(oidPBEWithSHAAnd128BitRC2CBC):
+		// RC2 with a 128-bit key is credited no more than Triple DES.
+		return 112
+	case algorithm.Equal(oidPBEWithSHAAnd2KeyTripleDESCBC):
+		return 80
+	case algorithm.Equal(oidPBEWithSHAAnd40BitRC2CBC), algorithm.Equal(oidPBEWithSHAAnd40BitRC4):
+		return 40
+	case algorithm.Equal(oidPBEWithSHAAnd128BitRC4):
+		// RC4 is broken, whatever its key length.
+		return 40
+	case algorithm.Equal(oidPBES2):
+		keySize, blockSize := pbes2SchemeSizes(scheme)
+		if blockSize != 0 && blockSize < 16 {
+			// A 64-bit block, as of Magma, is credited no more than
+			// Triple DES, whose block it shares.
+			return 112
+		}
+		return keySize * 8
+	default:
+		return 0
+	}
+}
+
+// pbeIterations returns the key derivation iteration count of algorithm.
+func pbeIterations(algorithm pkix.AlgorithmIdentifier) (int, error) {
+	if algorithm.Algorithm.Equal(oidPBES2) {
+		return pbes2Iterations(algorithm)
+	}
+	var params pbeParams
+	if err := unmarshal(algorithm.Parameters.FullBytes, &params); err != nil {
+		return 0, err
+	}
+	return params.Iterations, nil
+}
+
+type pbeParams struct {
+	Salt       []byte
+	Iterations int
+}
+
+// pbeSettings are the parameters, other than the algorithm, of the
+// password-based encryption algorithms generated by an Encoder.
+type pbeSettings struct {
+	iterations int
+
+	// scrypt, if not nil, holds the scrypt cost parameters which replace
+	// PBKDF2 as the key derivation function of PBES2.  Its Salt is unused.
+	scrypt *scryptParams
+
+	// kdf, if not nil, identifies the registered KeyDerivationFunction
+	// which replaces PBKDF2 and scrypt.
+	kdf asn1.ObjectIdentifier
+
+	// aesKeySize is the key size in bits of the AES-CBC encryption scheme
+	// of PBES2, or 0 for the default of 256.
+	aesKeySize int
+
+	// camelliaKeySize, if not 0, is the key size in bits of the
+	// Camellia-CBC encryption scheme which replaces AES-CBC.
+	camelliaKeySize int
+
+	// scheme, if not nil, identifies the registered PBEScheme which
+	// replaces the built-in encryption schemes of PBES2.
+	scheme asn1.ObjectIdentifier
+
+	// chacha20Poly1305 selects the ChaCha20-Poly1305 encryption scheme,
+	// which replaces AES-CBC and Camellia-CBC.
+	chacha20Poly1305 bool
+
+	// saltLength, if not 0, is the length in bytes of the generated salts,
+	// which replaces the default of the algorithm.
+	saltLength int
+}
+
+func (enc *Encoder) pbeSettings() pbeSettings {
+	return pbeSettings{iterations: enc.encryptionIterations, scrypt: enc.scrypt, kdf: enc.kdf, aesKeySize: enc.aesKeySize, camelliaKeySize: enc.camelliaKeySize, scheme: enc.pbeScheme, chacha20Poly1305: enc.chacha20Poly1305, saltLength: enc.saltLength}
+}
+
+// saltLen returns the length of the salts to generate for an algorithm
+// whose default is defaultLen.
+func (settings *pbeSettings) saltLen(defaultLen int) int {
+	if settings.saltLength != 0 {
+		return settings.saltLength
+	}
+	return defaultLen
+}
+
+// WithIterations returns a copy of enc which encrypts the certificates and
+// the private key with the given iteration count of the key derivation,
+// such as the 600,000 that OWASP recommends for PBKDF2-HMAC-SHA-256, or a
+// low count to speed up tests.  It applies to PBES2 with PBKDF2 and to the
+// legacy PKCS#12 algorithms alike, but not to the MAC, whose count is set
+// with WithMAC, nor to scrypt.  An iteration count below 1 is treated as 1.
+func (enc Encoder) WithIterations(iterations int) *Encoder {
+	if iterations < 1 {
+		iterations = 1
+	}
+	enc.encryptionIterations = iterations
+	return &enc
+}
+
+// WithSaltLength returns a copy of enc which generates salts of length
+// bytes, such as the 16 or 32 that some compliance profiles require, for
+// both the encryption of the certificates and the private key and the MAC.
+// The defaults are 8 bytes for the MAC and the PKCS#12 algorithms, and 16
+// for PBES2.  PBES1 salts are always 8 bytes, as RFC 8018 requires, and a
+// registered KeyDerivationFunction chooses its own salt.  A length below 1
+// restores the defaults.
+func (enc Encoder) WithSaltLength(length int) *Encoder {
+	if length < 1 {
+		length = 0
+	}
+	enc.saltLength = length
+	return &enc
+}
+
+// newPBEAlgorithm returns the identifier of the password-based encryption
+// algorithm algoID with a random salt and the given settings.
+func newPBEAlgorithm(rand io.Reader, algoID asn1.ObjectIdentifier, settings pbeSettings) (algorithm pkix.AlgorithmIdentifier, err error) {
+	if algoID.Equal(oidPBES2) {
+		return newPBES2Algorithm(rand, settings)
+	}
+	saltLen := settings.saltLen(8)
+	if isPBES1(algoID) {
+		saltLen = 8
+	}
+	randomSalt := make([]byte, saltLen)
+	if _, err = rand.Read(randomSalt); err != nil {
+		return algorithm, errors.New("pkcs12: error reading random salt: " + err.Error())
+	}
+	algorithm.Algorithm = algoID
+	if algorithm.Parameters.FullBytes, err = asn1.Marshal(pbeParams{Salt: randomSalt, Iterations: settings.iterations}); err != nil {
+		return algorithm, errors.New("pkcs12: error encoding params: " + err.Error())
+	}
+	return algorithm, nil
+}
+
+func pbeCipherFor(algorithm pkix.AlgorithmIdentifier, password []byte, m *kdfMonitor) (cipher.Block, []byte, error) {
+	if isPBES1(algorithm.Algorithm) {
+		return pbes1CipherFor(algorithm, password, m)
+	}
+
+	var cipherType pbeCipher
+
+	switch {
+	case algorithm.Algorithm.Equal(oidPBEWithSHAAnd3KeyTripleDESCBC):
+		cipherType = shaWithTripleDESCBC{}
+	case algorithm.Algorithm.Equal(oidPBEWithSHAAnd2KeyTripleDESCBC):
+		cipherType = shaWith2KeyTripleDESCBC{}
+	case algorithm.Algorithm.Equal(oidPBEWithSHAAnd128BitRC2CBC):
+		cipherType = shaWith128BitRC2CBC{}
+	case algorithm.Algorithm.Equal(oidPBEWithSHAAnd40BitRC2CBC):
+		cipherType = shaWith40BitRC2CBC{}
+	default:
+		return nil, nil, NotImplementedError("algorithm " + oids.Describe(algorithm.Algorithm) + " is not supported")
+	}
+
+	var params pbeParams
+	if err := unmarshal(algorithm.Parameters.FullBytes, &params); err != nil {
+		return nil, nil, err
+	}
+
+	key := cipherType.deriveKey(params.Salt, password, params.Iterations, m)
+	iv := cipherType.deriveIV(params.Salt, password, params.Iterations, m)
+	if err := m.err(); err != nil {
+		return nil, nil, err
+	}
+
+	block, err := cipherType.create(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return block, iv, nil
+}
+
+func pbDecrypterFor(algorithm pkix.AlgorithmIdentifier, password []byte, m *kdfMonitor) (cipher.BlockMode, int, error) {
+	block, iv, err := pbeCipherFor(algorithm, password, m)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return cipher.NewCBCDecrypter(block, iv), block.BlockSize(), nil
+}
+
+func pbDecrypt(info decryptable, password []byte, m *kdfMonitor) (decrypted []byte, err error) {
+	return pbDecryptTo(nil, info, password, m)
+}
+
+// pbDecryptTo is like pbDecrypt, but decrypts into dst if it has enough
+// capacity, so that callers can supply a scratch buffer.
+func pbDecryptTo(dst []byte, info decryptable, password []byte, m *kdfMonitor) (decrypted []byte, err error) {
+	if info.Algorithm().Algorithm.Equal(oidPBES2) {
+		if len(info.Data()) == 0 {
+			return nil, errors.New("pkcs12: empty encrypted data")
+		}
+		return pbes2Decrypt(dst, info.Algorithm(), info.Data(), password, m)
+	}
+	if isStreamPBE(info.Algorithm().Algorithm) {
+		if len(info.Data()) == 0 {
+			return nil, errors.New("pkcs12: empty encrypted data")
+		}
+		return streamDecrypt(dst, info.Algorithm(), info.Data(), password, m)
+	}
+
+	cbc, blockSize, err := pbDecrypterFor(info.Algorithm(), password, m)
+	if err != nil {
+		return nil, err
+	}
+	return cbcDecrypt(dst, cbc, blockSize, info.Data())
+}
+
+// cbcDecrypt decrypts and unpads encrypted with cbc, decrypting into dst if
+// it has enough capacity.
+func cbcDecrypt(dst []byte, cbc cipher.BlockMode, blockSize int, encrypted []byte) (decrypted []byte, err error) {
+	if len(encrypted) == 0 {
+		return nil, errors.New("pkcs12: empty encrypted data")
+	}
+	if len(encrypted)%blockSize != 0 {
+		return nil, errors.New("pkcs12: input is not a multiple of the block size")
+	}
+	if cap(dst) < len(encrypted) {
+		dst = make([]byte, len(encrypted))
+	}
+	decrypted = dst[:len(encrypted)]
+	cbc.CryptBlocks(decrypted, encrypted)
+
+	psLen := int(decrypted[len(decrypted)-1])
+	if psLen == 0 || psLen > blockSize {
+		return nil, ErrDecryption
+	}
+
+	if len(decrypted) < psLen {
+		return nil, ErrDecryption
+	}
+	ps := decrypted[len(decrypted)-psLen:]
+	decrypted = decrypted[:len(decrypted)-psLen]
+	if bytes.Compare(ps, bytes.Repeat([]byte{byte(psLen)}, psLen)) != 0 {
+		return nil, ErrDecryption
+	}
+
+	return
+}
+
+// decryptable abstracts an object that contains ciphertext.
+type decryptable interface {
+	Algorithm() pkix.AlgorithmIdentifier
+	Data() []byte
+}
+
+func pbEncrypterFor(algorithm pkix.AlgorithmIdentifier, password []byte, m *kdfMonitor) (cipher.BlockMode, int, error) {
+	block, iv, err := pbeCipherFor(algorithm, password, m)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return cipher.NewCBCEncrypter(block, iv), block.BlockSize(), nil
+}
+
+func pbEncrypt(info encryptable, decrypted []byte, password []byte, m *kdfMonitor) error {
+	if info.Algorithm().Algorithm.Equal(oidPBES2) {
+		encrypted, err := pbes2Encrypt(info.Algorithm(), decrypted, password, m)
+		if err != nil {
+			return err
+		}
+		info.SetData(encrypted)
+		return nil
+	}
+
+	cbc, blockSize, err := pbEncrypterFor(info.Algorithm(), password, m)
+	if err != nil {
+		return err
+	}
+	info.SetData(cbcEncrypt(cbc, blockSize, decrypted))
+	return nil
+}
+
+// cbcEncrypt pads decrypted as described in RFC 8018, section 6.1.1, and
+// encrypts it with cbc.
+func cbcEncrypt(cbc cipher.BlockMode, blockSize int, decrypted []byte) []byte {
+	psLen := blockSize - len(decrypted)%blockSize
+	encrypted := make([]byte, len(decrypted)+psLen)
+	copy(encrypted[:len(decrypted)], decrypted)
+	copy(encrypted[len(decrypted):], bytes.Repeat([]byte{byte(psLen)}, psLen))
+	cbc.CryptBlocks(encrypted, encrypted)
+	return encrypted
+}
+
+// encryptable abstracts a object that contains ciphertext.
+type encryptable interface {
+	Algorithm() pkix.AlgorithmIdentifier
+	SetData([]byte)
+}
@@ -0,0 +1,322 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Copyright 2015 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"testing"
+)
+
+var sha1WithTripleDES = asn1.ObjectIdentifier([]int{1, 2, 840, 113549, 1, 12, 1, 3})
+
+func TestPbDecrypterFor(t *testing.T) {
+	params, _ := asn1.Marshal(pbeParams{
+		Salt:       []byte{1, 2, 3, 4, 5, 6, 7, 8},
+		Iterations: 2048,
+	})
+	alg := pkix.AlgorithmIdentifier{
+		Algorithm: asn1.ObjectIdentifier([]int{1, 2, 3}),
+		Parameters: asn1.RawValue{
+			FullBytes: params,
+		},
+	}
+
+	pass, _ := bmpString("Sesame open")
+
+	_, _, err := pbDecrypterFor(alg, pass, nil)
+	if _, ok := err.(NotImplementedError); !ok {
+		t.Errorf("expected not implemented error, got: %T %s", err, err)
+	}
+
+	alg.Algorithm = sha1WithTripleDES
+	cbc, blockSize, err := pbDecrypterFor(alg, pass, nil)
+	if err != nil {
+		t.Errorf("unexpected error from pbDecrypterFor %v", err)
+	}
+	if blockSize != 8 {
+		t.Errorf("unexpected block size %d, wanted 8", blockSize)
+	}
+
+	plaintext := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+	expectedCiphertext := []byte{185, 73, 135, 249, 137, 1, 122, 247}
+	ciphertext := make([]byte, len(plaintext))
+	cbc.CryptBlocks(ciphertext, plaintext)
+
+	if bytes.Compare(ciphertext, expectedCiphertext) != 0 {
+		t.Errorf("bad ciphertext, got %x but wanted %x", ciphertext, expectedCiphertext)
+	}
+}
+
+func TestPbEncrypterFor(t *testing.T) {
+	params, _ := asn1.Marshal(pbeParams{
+		Salt:       []byte{1, 2, 3, 4, 5, 6, 7, 8},
+		Iterations: 2048,
+	})
+	alg := pkix.AlgorithmIdentifier{
+		Algorithm: asn1.ObjectIdentifier([]int{1, 2, 3}),
+		Parameters: asn1.RawValue{
+			FullBytes: params,
+		},
+	}
+
+	pass, _ := bmpString("Sesame open")
+
+	_, _, err := pbEncrypterFor(alg, pass, nil)
+	if _, ok := err.(NotImplementedError); !ok {
+		t.Errorf("expected not implemented error, got: %T %s", err, err)
+	}
+
+	alg.Algorithm = asn1.ObjectIdentifier([]int{1, 2, 840, 113549, 1, 12, 1, 3})
+	cbc, _, err := pbEncrypterFor(alg, pass, nil)
+	if err != nil {
+		t.Errorf("err: %v", err)
+	}
+
+	expectedM := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+	M := []byte{185, 73, 135, 249, 137, 1, 122, 247}
+	cbc.CryptBlocks(M, M)
+
+	if bytes.Compare(M, expectedM) != 0 {
+		t.Errorf("expected M to be '%d', but found '%d", expectedM, M)
+	}
+}
+
+var pbDecryptTests = []struct {
+	in            []byte
+	expected      []byte
+	expectedError error
+}{
+	{
+		[]byte("\x33\x73\xf3\x9f\xda\x49\xae\xfc\xa0\x9a\xdf\x5a\x58\xa0\xea\x46"), // 7 padding bytes
+		[]byte("A secret!"),
+		nil,
+	},
+	{
+		[]byte("\x33\x73\xf3\x9f\xda\x49\xae\xfc\x96\x24\x2f\x71\x7e\x32\x3f\xe7"), // 8 padding bytes
+		[]byte("A secret"),
+		nil,
+	},
+	{
+		[]byte("\x35\x0c\xc0\x8d\xab\xa9\x5d\x30\x7f\x9a\xec\x6a\xd8\x9b\x9c\xd9"), // 9 padding bytes, incorrect
+		nil,
+		ErrDecryption,
+	},
+	{
+		[]byte("\xb2\xf9\x6e\x06\x60\xae\x20\xcf\x08\xa0\x7b\xd9\x6b\x20\xef\x41"), // incorrect padding bytes: [ ... 0x04 0x02 ]
+		nil,
+		ErrDecryption,
+	},
+}
+
+func TestPbDecrypt(t *testing.T) {
+	for i, test := range pbDecryptTests {
+		decryptable := testDecryptable{
+			data: test.in,
+			algorithm: pkix.AlgorithmIdentifier{
+				Algorithm: sha1WithTripleDES,
+				Parameters: pbeParams{
+					Salt:       []byte("\xf1\xf2\xf3\xf4\xf5\xf6\xf7\xf8"),
+					Iterations: 4096,
+				}.RawASN1(),
+			},
+		}
+		password, _ := bmpString("sesame")
+
+		plaintext, err := pbDecrypt(decryptable, password, nil)
+		if err != test.expectedError {
+			t.Errorf("#%d: got error %q, but wanted %q", i, err, test.expectedError)
+			continue
+		}
+
+		if !bytes.Equal(plaintext, test.expected) {
+			t.Errorf("#%d: got %x, but wanted %x", i, plaintext, test.expected)
+		}
+	}
+}
+
+func TestPbEncrypt(t *testing.T) {
+	tests := [][]byte{
+		[]byte("A secret!"),
+		[]byte("A secret"),
+	}
+	expected := [][]byte{
+		[]byte("\x33\x73\xf3\x9f\xda\x49\xae\xfc\xa0\x9a\xdf\x5a\x58\xa0\xea\x46"), // 7 padding bytes
+		[]byte("\x33\x73\xf3\x9f\xda\x49\xae\xfc\x96\x24\x2f\x71\x7e\x32\x3f\xe7"), // 8 padding bytes
+	}
+
+	for i, c := range tests {
+		td := testDecryptable{
+			algorithm: pkix.AlgorithmIdentifier{
+				Algorithm: asn1.ObjectIdentifier([]int{1, 2, 840, 113549, 1, 12, 1, 3}), // SHA1/3TDES
+				Parameters: pbeParams{
+					Salt:       []byte("\xf1\xf2\xf3\xf4\xf5\xf6\xf7\xf8"),
+					Iterations: 4096,
+				}.RawASN1(),
+			},
+		}
+		p, _ := bmpString("sesame")
+
+		err := pbEncrypt(&td, c, p, nil)
+		if err != nil {
+			t.Errorf("error encrypting %d: %v", c, err)
+		}
+
+		if bytes.Compare(td.data, expected[i]) != 0 {
+			t.Errorf("expected %d to be encrypted to %d, but found %d", c, expected[i], td.data)
+		}
+	}
+}
+
+// openSSLOlderPBETestData was produced by "openssl pkcs12 -export -legacy"
+// of OpenSSL 3.0 with "-keypbe PBE-SHA1-2DES -certpbe PBE-SHA1-RC2-128" and
+// the password "password", for the identity of openSSL3TestData.
+const openSSLOlderPBETestData = `MIIDmgIBAzCCA2AGCSqGSIb3DQEHAaCCA1EEggNNMIIDSTCCAj8GCSqGSIb3DQEHBqCCAjAwggIs
+AgEAMIICJQYJKoZIhvcNAQcBMBwGCiqGSIb3DQEMAQUwDgQI3mW2Q+KeYbcCAggAgIIB+D3UEcG9
+pR806v4eu29Pno2yRguxOUZ5fvSOLR5HX6UHYvZLutV3TCd0sGHIqtGr5lk3TrlU14A9p8Anymr+
+N4Uolns8FQ/6JIt6hQK4uVCMRZrwqQ8GrWzheq5xEqGEyQLXysaJmIikB7ChF1ZWhc7+2xRSNCfY
+YcKRGWaIPx8ZqUsIA2netDkcyXgrCim0YRtujf5d1HzsDmqhtoDTwwR4bKUdv5cil6VGyZoDloOB
+V2+unjdq8HRzdv6uqdHhOH373Rm2F4ysECWqr2hvvM4Kgg3W7QiDAXbqGpboeeUej8wqP6/Q3tfq
+zcIqveJ4cWjNIR/6agaJB/gyIS3TtRCgR2kmGf1zqiyPP994ny9zjyiobqAhhIO/hl04l5N+okO9
+5kUyC1vrWSymd2Aacd6bBjOAl9LVd+NEzh4SCi0gefWMrUHw58fU9aobcIk19iyjKVMAMNbkfrf3
+b5rc9zjn10GEvLe9bo98C+nKmNwO6C/g7mxlSRg2memLa64fbKBSzjxmWGMLjO0gJw4407RzkEYW
+pQdLYpVebsYXjgeSZOzK+uqskhPL0X95XCN9+FktIKpOn4PvMe+lTKNEWgSJNkM0pLi+rDb9Kfax
+eL4wEOvaUd0MR5zJkfIJE9/XXHTnwsiwParer3r/78tRlLaomfQt9xASXDCCAQIGCSqGSIb3DQEH
+AaCB9ASB8TCB7jCB6wYLKoZIhvcNAQwKAQKggbQwgbEwHAYKKoZIhvcNAQwBBDAOBAh+XB0qKeBq
+RgICCAAEgZC3vMZYwgT+ITwhZ7C3TxW1GQyVCRpsXQEgqmnyxo9RgtGDK7FY6NnY5cW7mzrsn8n/
+8El4hFmOMxuwK1Cb4gDxxVxdqtBIsw9qfcP/LvKrCvGriRtu/wyGSf1VYSbh9oG92/rd6090EAqE
+BMfF76Jzy7bEUbPXPsVk+mJsb878AhAVCRkzU6W6oFFgBimMGn4xJTAjBgkqhkiG9w0BCRUxFgQU
+UEPB1/rHyY3HFBeulriIGYUZERYwMTAhMAkGBSsOAwIaBQAEFK5fozbSsks1aIj5xMbY+zdvSohN
+BAhOhACUGifHkAICCAA=`
+
+func TestOlderPBESchemes(t *testing.T) {
+	p12, _ := base64.StdEncoding.DecodeString(openSSLOlderPBETestData)
+	privateKey, certificate, err := Decode(p12, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if certificate.Subject.CommonName != "openssl3.example.com" {
+		t.Errorf("got certificate for %q", certificate.Subject.CommonName)
+	}
+	if key, ok := privateKey.(*ecdsa.PrivateKey); !ok || !publicKeyMatches(key.Public(), certificate) {
+		t.Errorf("got the wrong private key %T", privateKey)
+	}
+
+	protection, err := InspectProtection(p12, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !protection.ContentAlgorithm.Equal(oidPBEWithSHAAnd128BitRC2CBC) || !protection.KeyAlgorithm.Equal(oidPBEWithSHAAnd2KeyTripleDESCBC) {
+		t.Errorf("got protection %+v", protection)
+	}
+}
+
+type testDecryptable struct {
+	data      []byte
+	algorithm pkix.AlgorithmIdentifier
+}
+
+func (d testDecryptable) Algorithm() pkix.AlgorithmIdentifier { return d.algorithm }
+func (d testDecryptable) Data() []byte                        { return d.data }
+func (d *testDecryptable) SetData(data []byte)                { d.data = data }
+
+func (params pbeParams) RawASN1() (raw asn1.RawValue) {
+	asn1Bytes, err := asn1.Marshal(params)
+	if err != nil {
+		panic(err)
+	}
+	_, err = asn1.Unmarshal(asn1Bytes, &raw)
+	if err != nil {
+		panic(err)
+	}
+	return
+}
+
+func TestWithIterations(t *testing.T) {
+	key, cert := newTestCertificate(t, "www.example.com", nil, nil)
+	for _, test := range []struct {
+		name string
+		enc  *Encoder
+	}{
+		{"DefaultEncoder", DefaultEncoder},
+		{"Modern", Modern},
+	} {
+		pfxData, err := test.enc.WithIterations(10000).WithMAC(crypto.SHA256, 20000).Encode(rand.Reader, key, cert, nil, "password")
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if _, _, err := DefaultDecoder.WithMinIterations(10000).Decode(pfxData, "password"); err != nil {
+			t.Errorf("%s: %v", test.name, err)
+		}
+		_, _, err = DefaultDecoder.WithMinIterations(10001).Decode(pfxData, "password")
+		if iterationsErr, ok := err.(*IterationsError); !ok || iterationsErr.What == "MAC" || iterationsErr.Iterations != 10000 {
+			t.Errorf("%s: got error %v with a minimum of 10001, want an IterationsError for 10000 encryption iterations", test.name, err)
+		}
+	}
+}
+
+func TestWithSaltLength(t *testing.T) {
+	key, cert := newTestCertificate(t, "www.example.com", nil, nil)
+	for _, enc := range []*Encoder{DefaultEncoder, Modern} {
+		pfxData, err := enc.WithSaltLength(32).Encode(rand.Reader, key, cert, nil, "password")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := Decode(pfxData, "password"); err != nil {
+			t.Fatal(err)
+		}
+		info, err := PeekMAC(pfxData)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(info.Salt) != 32 {
+			t.Errorf("got a MAC salt of %d bytes, want 32", len(info.Salt))
+		}
+	}
+
+	for _, test := range []struct {
+		algorithm  asn1.ObjectIdentifier
+		saltLength int
+		want       int
+	}{
+		{oidPBEWithSHAAnd3KeyTripleDESCBC, 0, 8},
+		{oidPBEWithSHAAnd3KeyTripleDESCBC, 32, 32},
+		{oidPBES2, 0, pbes2SaltLen},
+		{oidPBES2, 32, 32},
+		{oidPBEWithSHA1AndDESCBC, 32, 8},
+	} {
+		algorithm, err := newPBEAlgorithm(rand.Reader, test.algorithm, pbeSettings{iterations: 1, saltLength: test.saltLength})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var salt []byte
+		if test.algorithm.Equal(oidPBES2) {
+			var params pbes2Params
+			var kdfParams pbkdf2Params
+			if _, err := asn1.Unmarshal(algorithm.Parameters.FullBytes, &params); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := asn1.Unmarshal(params.KeyDerivationFunc.Parameters.FullBytes, &kdfParams); err != nil {
+				t.Fatal(err)
+			}
+			salt = kdfParams.Salt
+		} else {
+			var params pbeParams
+			if _, err := asn1.Unmarshal(algorithm.Parameters.FullBytes, &params); err != nil {
+				t.Fatal(err)
+			}
+			salt = params.Salt
+		}
+		if len(salt) != test.want {
+			t.Errorf("%v with a salt length of %d: got a salt of %d bytes, want %d", test.algorithm, test.saltLength, len(salt), test.want)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"crypto"
+	"crypto/subtle"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+)
+
+// see https://tools.ietf.org/html/rfc8410#section-3
+var (
+	oidX25519 = asn1.ObjectIdentifier{1, 3, 101, 110}
+	oidX448   = asn1.ObjectIdentifier{1, 3, 101, 111}
+	oidEd448  = asn1.ObjectIdentifier{1, 3, 101, 113}
+)
+
+const (
+	// Ed448PrivateKeySize is the size of an Ed448 private key in bytes.
+	Ed448PrivateKeySize = 57
+
+	// X448PrivateKeySize is the size of an X448 private key in bytes.
+	X448PrivateKeySize = 56
+)
+
+// An Ed448PrivateKey is the private key string of an Ed448 key, RFC 8032
+// section 5.2.5.  The standard library does not implement Ed448, so this
+// package can store such keys, as produced by OpenSSL, and read them back,
+// but cannot sign with them or compute their public keys.
+type Ed448PrivateKey []byte
+
+// Equal reports whether priv and x are the same Ed448 key.
+func (priv Ed448PrivateKey) Equal(x crypto.PrivateKey) bool {
+	xx, ok := x.(Ed448PrivateKey)
+	return ok && subtle.ConstantTimeCompare(priv, xx) == 1
+}
+
+// An X448PrivateKey is the private key of an X448 key agreement key, RFC
+// 7748 section 5.  Like Ed448PrivateKey, it can be stored and read back,
+// but the standard library cannot use it.
+type X448PrivateKey []byte
+
+// Equal reports whether priv and x are the same X448 key.
+func (priv X448PrivateKey) Equal(x crypto.PrivateKey) bool {
+	xx, ok := x.(X448PrivateKey)
+	return ok && subtle.ConstantTimeCompare(priv, xx) == 1
+}
+
+// marshalCurve448PrivateKey returns the PKCS#8 encoding of an Ed448 or X448
+// private key, RFC 8410 section 7, and reports whether privateKey is one.
+func marshalCurve448PrivateKey(privateKey interface{}) (der []byte, ok bool, err error) {
+	var algorithm asn1.ObjectIdentifier
+	var key []byte
+	switch k := privateKey.(type) {
+	case Ed448PrivateKey:
+		if len(k) != Ed448PrivateKeySize {
+			return nil, true, errors.New("pkcs12: Ed448 private key has the wrong length")
+		}
+		algorithm, key = oidEd448, k
+	case X448PrivateKey:
+		if len(k) != X448PrivateKeySize {
+			return nil, true, errors.New("pkcs12: X448 private key has the wrong length")
+		}
+		algorithm, key = oidX448, k
+	default:
+		return nil, false, nil
+	}
+	curvePrivateKey, err := asn1.Marshal(key)
+	if err != nil {
+		return nil, true, err
+	}
+	der, err = asn1.Marshal(pkcs8{
+		Algorithm:  pkix.AlgorithmIdentifier{Algorithm: algorithm},
+		PrivateKey: curvePrivateKey,
+	})
+	return der, true, err
+}
+
+// parseCurve448PrivateKey returns the Ed448PrivateKey or X448PrivateKey
+// held by privKey, and reports whether privKey is an Ed448 or X448 key.
+func parseCurve448PrivateKey(privKey *pkcs8) (key interface{}, ok bool, err error) {
+	algorithm := privKey.Algorithm.Algorithm
+	var name string
+	var size int
+	switch {
+	case algorithm.Equal(oidEd448):
+		name, size = "Ed448", Ed448PrivateKeySize
+	case algorithm.Equal(oidX448):
+		name, size = "X448", X448PrivateKeySize
+	default:
+		return nil, false, nil
+	}
+	if len(privKey.Algorithm.Parameters.FullBytes) != 0 {
+		return nil, true, errors.New("pkcs12: invalid " + name + " private key parameters")
+	}
+	var curvePrivateKey []byte
+	if err := unmarshal(privKey.PrivateKey, &curvePrivateKey); err != nil {
+		return nil, true, errors.New("pkcs12: invalid " + name + " private key: " + err.Error())
+	}
+	if len(curvePrivateKey) != size {
+		return nil, true, errors.New("pkcs12: invalid " + name + " private key length")
+	}
+	if algorithm.Equal(oidEd448) {
+		return Ed448PrivateKey(curvePrivateKey), true, nil
+	}
+	return X448PrivateKey(curvePrivateKey), true, nil
+}
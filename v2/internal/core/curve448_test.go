@@ -0,0 +1,108 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"crypto"
+	"crypto/rand"
+	"encoding/base64"
+	"testing"
+)
+
+func TestCurve448(t *testing.T) {
+	for _, test := range []struct {
+		name       string
+		base64P12  string
+		commonName string
+		size       int
+	}{
+		{"Ed448", openSSLEd448TestData, "ed448.example.com", Ed448PrivateKeySize},
+		{"X448", openSSLX448TestData, "x448.example.com", X448PrivateKeySize},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			p12, _ := base64.StdEncoding.DecodeString(test.base64P12)
+			key, cert, err := Decode(p12, "password")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cert.Subject.CommonName != test.commonName {
+				t.Errorf("got common name %q, want %q", cert.Subject.CommonName, test.commonName)
+			}
+			switch key := key.(type) {
+			case Ed448PrivateKey:
+				if test.name != "Ed448" || len(key) != test.size {
+					t.Fatalf("decoded a %d-byte %T", len(key), key)
+				}
+			case X448PrivateKey:
+				if test.name != "X448" || len(key) != test.size {
+					t.Fatalf("decoded a %d-byte %T", len(key), key)
+				}
+			default:
+				t.Fatalf("decoded a %T", key)
+			}
+
+			pfxData, err := Modern.Encode(rand.Reader, key, cert, nil, "password")
+			if err != nil {
+				t.Fatal(err)
+			}
+			decodedKey, _, err := Decode(pfxData, "password")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !key.(interface{ Equal(crypto.PrivateKey) bool }).Equal(decodedKey) {
+				t.Error("re-encoded key does not match")
+			}
+
+			if _, err := ToPEM(p12, "password"); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+
+	_, cert := newTestCertificate(t, "www.example.com", nil, nil)
+	if _, err := Modern.Encode(rand.Reader, Ed448PrivateKey(make([]byte, 32)), cert, nil, "password"); err == nil {
+		t.Error("encoded an Ed448 key of the wrong length")
+	}
+}
+
+// openSSLEd448TestData and openSSLX448TestData were written by OpenSSL 3.0
+// for an Ed448 key with a self-signed certificate, and for an X448 key with
+// a certificate issued with "openssl x509 -new -force_pubkey" by that Ed448
+// key, with the password "password".
+const openSSLEd448TestData = `MIID5gIBAzCCA5wGCSqGSIb3DQEHAaCCA40EggOJMIIDhTCCAoIGCSqGSIb3DQEHBqCCAnMwggJv
+AgEAMIICaAYJKoZIhvcNAQcBMFcGCSqGSIb3DQEFDTBKMCkGCSqGSIb3DQEFDDAcBAifTyLmVyhR
+gQICCAAwDAYIKoZIhvcNAgkFADAdBglghkgBZQMEASoEED6pEKjSmfh0zcj97LPp/PeAggIABdvv
+W3Gorz3bwRt0R37Xs2d/v6iLkFwO/D79SjrQYEPMlRayE/of0w/x6ZehkAmB0wKdPTCvYc1qOfJc
+VUfdQo/EAVrBOCOm3Ee1rpZXkaLY1hW0enYkUifweObKlTONcD5LDYwWfBsYhPpxaj5a4IxgndwA
+Vh/QR5gG8p6eEZ0aZYZs9WH7VXhBAuqT7P1BIRljewSg9MoDmEUv05FvTGGnkI4JyJf8l80xWVA9
+J1QGOyGDN4aZJCFRR3Swx0h+Ms+kCpkb2am2ViDvUuW/Ca5zovpnn4JUzvsmbalZbaVYpHHtVDuH
+gHLFzhi0ETjEFjA7+iR6n6sMyhSc7COWLA/ISIWJJ+a0uL1lSRY2cx9pok+AWg8HuU5hT/PGxnC7
+6/jeVuVaXzDhV4INWDztyp+uK17GBW3msGGO24ef1Zm3CSAIrwe4bNMVlqttSLLCaz7mTQfeXZEt
+FHQXFgyGYfQi+wdYSUVVxM35Vro0KPKLw7/Y/NPO+X3t0/lP3FdJtMATFp08yB50iYEYKk58hQKa
+5QMU3UZnB2tsj9Y5Op8FIblUGQ7OpmHhLQNKr+A0d8evXcox2lY4WfgEdUF15wz+/AS7o0Hy9C3V
+QnZGapxf23ll7rrJC4Q/uT0lsEw0UZxvsZ78qHTsYkU5CDll+MSios1RqG2roQ9+XuRq6T8wgfwG
+CSqGSIb3DQEHAaCB7gSB6zCB6DCB5QYLKoZIhvcNAQwKAQKgga4wgaswVwYJKoZIhvcNAQUNMEow
+KQYJKoZIhvcNAQUMMBwECGteHDmg/eljAgIIADAMBggqhkiG9w0CCQUAMB0GCWCGSAFlAwQBKgQQ
+dp2c0Iq7vE6yW51ArcymvQRQGtnOuolUVjEMvl8z6NsWljqxrCf9mH4rWmvA61IRjD6xX1/Eg/w8
+bDCvY+WJLkRu0yeqKbScM56y8QsH3qEC5TPnRT6XLa4LD8CKpOZdtvgxJTAjBgkqhkiG9w0BCRUx
+FgQUolMUOpS93VEUBa+e29Mt3hFFc7kwQTAxMA0GCWCGSAFlAwQCAQUABCCFsN1pW3ZcQtbdZG0r
+ZTR31S6IBZ0NX2zTNUJQGQ6mAgQImmqD6A/kNegCAggA`
+
+const openSSLX448TestData = `MIIDhgIBAzCCAzwGCSqGSIb3DQEHAaCCAy0EggMpMIIDJTCCAiIGCSqGSIb3DQEHBqCCAhMwggIP
+AgEAMIICCAYJKoZIhvcNAQcBMFcGCSqGSIb3DQEFDTBKMCkGCSqGSIb3DQEFDDAcBAhz+FqNrob8
+iAICCAAwDAYIKoZIhvcNAgkFADAdBglghkgBZQMEASoEED2d3PakIZAoNcmGdYxX1E+AggGg3MPV
+xG+vTkQhCNsKBA8WFkSgQGicKDDlhtsYfDLooQAKEBXn+unkq3jYxLaueSDEqAR+CYEezrQw9Srw
+7gbN3QmDKh4aTYDvQtHaHhAhNHn/1gxwg0cgLyEd/hYqFfGE/SKka+0p/xGxhOELEzVxSyzrkOZI
+AiPewPXZY8m8U3ojjBvNQtk/JgS71wYoAbLj22Sx1OujRI5/PNQ60kLHA/CQMDxmYgs6svKnlJc2
+w8BpTi3VqWBQFTneTVPO6dwG35qyehEKx2azrxmMjcY2hpBX0C2BBSvah/vnBQ3Ycbdhq+41Saz6
+HJR4C/fOkxD6yISLqW5acaxsRx96oatNH9Bfu1i2w2rQ+QHvr8se8jZg48LnPDj1curepcq+CkPK
+j3Hk1LxrS9MO4gmC0TnNclEzdr7DyXkhJFntcAGv2Vk21x/lRJL7rK6Z4ABPIlpvqIoHpy8OEgw+
+skMaHcDmcLhJIDHIaNYmcHEkR4OMyECieIp9FvmHP70rB5rsWLRMx4Fg9ABIkDfBOV7JZ3NBYlnO
+Wojb1YUO3T+Dsbd9s2QwgfwGCSqGSIb3DQEHAaCB7gSB6zCB6DCB5QYLKoZIhvcNAQwKAQKgga4w
+gaswVwYJKoZIhvcNAQUNMEowKQYJKoZIhvcNAQUMMBwECHi8b4/p/9UmAgIIADAMBggqhkiG9w0C
+CQUAMB0GCWCGSAFlAwQBKgQQ0zujB6PDsR1yk4pbZbSZoARQuwGv4BsouoXqqkpaDYuKUhCjklYw
+36rRsuZs6qMJbYJt5td2CPYJiWc8pP63cb3ksZ+AG0l1ck857iUmPMAOe0gd/2iHUAxCo6gUYnvS
+rVsxJTAjBgkqhkiG9w0BCRUxFgQUpDTy8NTvxNZx5tW6EaAi07LEeeUwQTAxMA0GCWCGSAFlAwQC
+AQUABCBOhc0tgAovAs2rQ8szQK/EUD4gbMlCDZcWRS/epZlxsQQI6B6TYj2dfnoCAggA`
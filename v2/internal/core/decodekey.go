@@ -0,0 +1,85 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"crypto"
+	"errors"
+)
+
+// DecodeKey extracts the private key from pfxData using DefaultDecoder.
+// See Decoder.DecodeKey.
+func DecodeKey(pfxData []byte, password string) (crypto.PrivateKey, error) {
+	return DefaultDecoder.DecodeKey(pfxData, password)
+}
+
+// DecodeKey extracts the single private key from pfxData, which may be held
+// in a shrouded or a plain key bag.  Certificate bags are skipped without
+// being parsed, so that a malformed or unsupported certificate does not
+// prevent access to the key.
+func (dec *Decoder) DecodeKey(pfxData []byte, password string) (crypto.PrivateKey, error) {
+	keys, err := dec.DecodeKeys(pfxData, password)
+	if err != nil {
+		return nil, err
+	}
+	switch len(keys) {
+	case 0:
+		return nil, errors.New("pkcs12: private key missing")
+	case 1:
+		return keys[0].PrivateKey, nil
+	default:
+		return nil, errors.New("pkcs12: expected exactly one key bag")
+	}
+}
+
+// DecodeKeys extracts every private key from pfxData using DefaultDecoder.
+// See Decoder.DecodeKeys.
+func DecodeKeys(pfxData []byte, password string) ([]KeyEntry, error) {
+	return DefaultDecoder.DecodeKeys(pfxData, password)
+}
+
+// DecodeKeys extracts the private keys from pfxData, in the order in which
+// they appear, skipping certificate bags as DecodeKey does.  Keys which
+// share a localKeyId are handled according to dec's KeyIDPolicy.
+func (dec *Decoder) DecodeKeys(pfxData []byte, password string) ([]KeyEntry, error) {
+	encodedPassword, err := bmpString(password)
+	if err != nil {
+		return nil, err
+	}
+
+	bags, encodedPassword, err := dec.getSafeContents(pfxData, encodedPassword)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []KeyEntry
+	for i, bag := range bags {
+		var key crypto.PrivateKey
+		switch {
+		case bag.Id.Equal(oidPKCS8ShroundedKeyBag), bag.Id.Equal(oidKeyBag):
+			if key, err = dec.decodeKeyBag(&bag, encodedPassword); err != nil {
+				return nil, err
+			}
+		default:
+			dec.bagDone(i, len(bags))
+			continue
+		}
+		dec.bagDone(i, len(bags))
+		keys = append(keys, KeyEntry{PrivateKey: key, LocalKeyID: localKeyID(&bag)})
+	}
+	return dec.handleDuplicateKeyIDs(keys)
+}
+
+// decodeKeyBag returns the private key held by bag, which is a shrouded or
+// a plain key bag.
+func (dec *Decoder) decodeKeyBag(bag *safeBag, password []byte) (key interface{}, err error) {
+	if !bag.Id.Equal(oidKeyBag) {
+		return dec.decodePkcs8ShroudedKeyBag(bag.Value.Bytes, password)
+	}
+	if key, err = dec.parsePKCS8PrivateKey(bag.Value.Bytes); err != nil {
+		return nil, errors.New("pkcs12: error parsing PKCS#8 private key: " + err.Error())
+	}
+	return key, nil
+}
@@ -0,0 +1,70 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/asn1"
+	"testing"
+)
+
+func TestDecodeKey(t *testing.T) {
+	key, cert := newTestCertificate(t, "key.example.com", nil, nil)
+	pfxData, err := Encode(rand.Reader, key, cert, nil, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Replace the certificates with one that cannot be parsed.
+	broken := rewriteAuthenticatedSafe(t, pfxData, "password", func(authenticatedSafe []contentInfo) []contentInfo {
+		certBag, err := asn1.Marshal(certBag{Id: oidCertTypeX509Certificate, Data: []byte{0x30, 0x00}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		bags := []safeBag{{Id: oidCertBag, Value: asn1.RawValue{Class: 2, Tag: 0, IsCompound: true, Bytes: certBag}}}
+		data, err := asn1.Marshal(bags)
+		if err != nil {
+			t.Fatal(err)
+		}
+		authenticatedSafe[0] = contentInfo{ContentType: oidDataContentType}
+		setSafeContentsData(t, &authenticatedSafe[0], data)
+		return authenticatedSafe
+	})
+	if _, _, err := Decode(broken, "password"); err == nil {
+		t.Fatal("Decode accepted a malformed certificate")
+	}
+
+	privateKey, err := DecodeKey(broken, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !key.Equal(privateKey) {
+		t.Error("decoded key does not match")
+	}
+	if _, err := DecodeKey(broken, "wrong"); err != ErrIncorrectPassword {
+		t.Errorf("got error %v with the wrong password, want ErrIncorrectPassword", err)
+	}
+
+	// Replace the shrouded key bag with a plain one.
+	plain := rewriteAuthenticatedSafe(t, pfxData, "password", func(authenticatedSafe []contentInfo) []contentInfo {
+		pkData, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		bags := []safeBag{{Id: oidKeyBag, Value: asn1.RawValue{Class: 2, Tag: 0, IsCompound: true, Bytes: pkData}}}
+		data, err := asn1.Marshal(bags)
+		if err != nil {
+			t.Fatal(err)
+		}
+		setSafeContentsData(t, &authenticatedSafe[1], data)
+		return authenticatedSafe
+	})
+	if privateKey, err = DecodeKey(plain, "password"); err != nil {
+		t.Fatal(err)
+	} else if !key.Equal(privateKey) {
+		t.Error("decoded plain key does not match")
+	}
+}
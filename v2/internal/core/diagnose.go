@@ -0,0 +1,129 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"bytes"
+	"errors"
+)
+
+// A PasswordEncoding is a way of turning a password into the bytes from
+// which the keys of a PKCS#12 file are derived, as reported by
+// DiagnosePassword.
+type PasswordEncoding int
+
+const (
+	// BMPPassword is the encoding of RFC 7292: UTF-16 (big-endian) with a
+	// zero terminator, as used by OpenSSL and Windows.
+	BMPPassword PasswordEncoding = iota + 1
+
+	// EmptyBMPPassword is the empty password encoded as no bytes at all,
+	// instead of a lone terminator.  Some implementations produce it for
+	// the empty password, and Decode accepts it as a fallback.
+	EmptyBMPPassword
+
+	// UTF8AsBMPPassword is the UTF-8 encoding of the password with each
+	// byte taken as a character and then encoded as a BMPString, as done
+	// by tools which read the password in Latin-1.  It differs from
+	// BMPPassword only for passwords with non-ASCII characters.  Such
+	// files can be decoded by passing UTF8AsBMPString(password) as the
+	// password.
+	UTF8AsBMPPassword
+)
+
+func (e PasswordEncoding) String() string {
+	switch e {
+	case BMPPassword:
+		return "BMPString"
+	case EmptyBMPPassword:
+		return "empty BMPString without terminator"
+	case UTF8AsBMPPassword:
+		return "UTF-8 bytes as BMPString"
+	default:
+		return "unknown password encoding"
+	}
+}
+
+// UTF8AsBMPString returns the string whose characters are the bytes of the
+// UTF-8 encoding of password, so that decoding with it reproduces
+// UTF8AsBMPPassword.
+func UTF8AsBMPString(password string) string {
+	runes := make([]rune, len(password))
+	for i := 0; i < len(password); i++ {
+		runes[i] = rune(password[i])
+	}
+	return string(runes)
+}
+
+// DiagnosePassword reports which encoding of password verifies the MAC of
+// pfxData, using DefaultDecoder.  See Decoder.DiagnosePassword.
+func DiagnosePassword(pfxData []byte, password string) (PasswordEncoding, error) {
+	return DefaultDecoder.DiagnosePassword(pfxData, password)
+}
+
+// DiagnosePassword reports which encoding of password verifies the MAC of
+// pfxData, to explain why a password which works with another tool is
+// rejected here.  The encodings are tried in the order in which they are
+// declared, and ErrIncorrectPassword is returned if none of them verifies
+// the MAC.  Encodings which give the same bytes as an earlier one, such as
+// UTF8AsBMPPassword for an ASCII password, are not reported.
+func (dec *Decoder) DiagnosePassword(pfxData []byte, password string) (PasswordEncoding, error) {
+	pfx := new(pfxPdu)
+	if err := dec.unmarshalPFX(pfxData, pfx); err != nil {
+		return 0, errors.New("pkcs12: error reading P12 data: " + err.Error())
+	}
+	if pfx.Version != 3 {
+		return 0, NotImplementedError("can only decode v3 PFX PDU's")
+	}
+	content, _, err := authSafeContent(pfx)
+	if err != nil {
+		return 0, err
+	}
+	if len(pfx.MacData.Mac.Algorithm.Algorithm) == 0 {
+		return 0, errors.New("pkcs12: no MAC in data")
+	}
+
+	var candidates [][]byte
+	for _, encoding := range []PasswordEncoding{BMPPassword, EmptyBMPPassword, UTF8AsBMPPassword} {
+		var encoded []byte
+		switch encoding {
+		case BMPPassword:
+			encoded, err = bmpString(password)
+		case EmptyBMPPassword:
+			if password != "" {
+				continue
+			}
+			encoded = []byte{}
+		case UTF8AsBMPPassword:
+			encoded, err = bmpString(UTF8AsBMPString(password))
+		}
+		if err != nil {
+			return 0, err
+		}
+		if containsBytes(candidates, encoded) {
+			continue
+		}
+		candidates = append(candidates, encoded)
+
+		switch err := verifyMac(&pfx.MacData, content, encoded, dec.monitor()); err {
+		case nil:
+			return encoding, nil
+		case ErrIncorrectPassword:
+		default:
+			return 0, err
+		}
+	}
+	return 0, ErrIncorrectPassword
+}
+
+// containsBytes reports whether b is an element of list.
+func containsBytes(list [][]byte, b []byte) bool {
+	for _, e := range list {
+		if bytes.Equal(e, b) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,67 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"crypto/rand"
+	"encoding/asn1"
+	"testing"
+)
+
+func TestDiagnosePassword(t *testing.T) {
+	key, cert := newTestCertificate(t, "www.example.com", nil, nil)
+	encode := func(password string) []byte {
+		pfxData, err := Encode(rand.Reader, key, cert, nil, password)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return pfxData
+	}
+
+	// Recompute the MAC of a file with the empty password over no bytes,
+	// rather than over the terminator of an empty BMPString.
+	var pfx pfxPdu
+	if err := unmarshal(encode(""), &pfx); err != nil {
+		t.Fatal(err)
+	}
+	content, _, err := authSafeContent(&pfx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := computeMac(&pfx.MacData, content, []byte{}, nil); err != nil {
+		t.Fatal(err)
+	}
+	emptyBytes, err := asn1.Marshal(pfx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		name     string
+		pfxData  []byte
+		password string
+		want     PasswordEncoding
+	}{
+		{"ASCII", encode("password"), "password", BMPPassword},
+		{"non-ASCII", encode("pässwörd"), "pässwörd", BMPPassword},
+		{"empty", encode(""), "", BMPPassword},
+		{"empty without terminator", emptyBytes, "", EmptyBMPPassword},
+		{"UTF-8 as BMPString", encode(UTF8AsBMPString("pässwörd")), "pässwörd", UTF8AsBMPPassword},
+	} {
+		got, err := DiagnosePassword(test.pfxData, test.password)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+		} else if got != test.want {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+
+	if _, err := DiagnosePassword(encode("pässwörd"), "password"); err != ErrIncorrectPassword {
+		t.Errorf("got error %v for the wrong password, want ErrIncorrectPassword", err)
+	}
+	if _, _, err := Decode(encode(UTF8AsBMPString("pässwörd")), UTF8AsBMPString("pässwörd")); err != nil {
+		t.Errorf("decoding with UTF8AsBMPString: %v", err)
+	}
+}
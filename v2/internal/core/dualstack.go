@@ -0,0 +1,217 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/mldsa"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+)
+
+// EncodeDualStack produces pfxData containing two identities for the same
+// subject, one with a classical key and one with a post-quantum key, using
+// DefaultEncoder.  See Encoder.EncodeDualStack.
+func EncodeDualStack(rand io.Reader, classical, postQuantum tls.Certificate, password string) (pfxData []byte, err error) {
+	return DefaultEncoder.EncodeDualStack(rand, classical, postQuantum, password)
+}
+
+// EncodeDualStack produces pfxData containing two identities for the same
+// subject, for servers which offer both a classical and a post-quantum
+// certificate during a migration to hybrid TLS.  postQuantum must have an
+// ML-DSA private key and classical must not; the end-entity certificates
+// of both must have the same subject.
+//
+// Each certificate is linked to its key with its own LocalKeyId, and both
+// identities carry the same friendlyName, the common name of the subject,
+// so that tools which group entries by name show them together.  The two
+// end-entity certificates are stored first, classical first, followed by
+// the CA certificates of both chains without duplicates.
+func (enc *Encoder) EncodeDualStack(rand io.Reader, classical, postQuantum tls.Certificate, password string) (pfxData []byte, err error) {
+	if enc.isLegacy() && legacyEncodingDisabled.Load() {
+		return nil, ErrLegacyEncodingDisabled
+	}
+	rand = enc.entropy(rand)
+
+	classicalCerts, err := tlsCertificateChain(classical)
+	if err != nil {
+		return nil, err
+	}
+	postQuantumCerts, err := tlsCertificateChain(postQuantum)
+	if err != nil {
+		return nil, err
+	}
+	if isPostQuantumKey(classical.PrivateKey) {
+		return nil, errors.New("pkcs12: classical identity has a post-quantum private key")
+	}
+	if !isPostQuantumKey(postQuantum.PrivateKey) {
+		return nil, errors.New("pkcs12: post-quantum identity does not have an ML-DSA private key")
+	}
+	if !bytes.Equal(classicalCerts[0].RawSubject, postQuantumCerts[0].RawSubject) {
+		return nil, errors.New("pkcs12: dual-stack certificates have different subjects")
+	}
+
+	encodedPassword, err := bmpString(password)
+	if err != nil {
+		return nil, err
+	}
+
+	var attrs []pkcs12Attribute
+	if name := classicalCerts[0].Subject.CommonName; name != "" {
+		attr, err := makeFriendlyNameAttribute(name)
+		if err != nil {
+			return nil, err
+		}
+		attrs = append(attrs, attr)
+	}
+
+	var leafBags, keyBags []safeBag
+	for _, identity := range []struct {
+		privateKey interface{}
+		leaf       *x509.Certificate
+	}{
+		{classical.PrivateKey, classicalCerts[0]},
+		{postQuantum.PrivateKey, postQuantumCerts[0]},
+	} {
+		certBag, keyBag, err := enc.identityBags(rand, identity.privateKey, identity.leaf, encodedPassword, attrs, nil)
+		if err != nil {
+			return nil, err
+		}
+		leafBags = append(leafBags, certBag)
+		keyBags = append(keyBags, keyBag)
+	}
+
+	var caCerts []*x509.Certificate
+	for _, cert := range append(classicalCerts[1:], postQuantumCerts[1:]...) {
+		if !containsCertificate(caCerts, cert) {
+			caCerts = append(caCerts, cert)
+		}
+	}
+
+	return enc.assemble(rand, leafBags, caCerts, keyBags, encodedPassword)
+}
+
+// DecodeDualStack extracts the classical and post-quantum identities of
+// pfxData using DefaultDecoder.  See Decoder.DecodeDualStack.
+func DecodeDualStack(pfxData []byte, password string) (classical, postQuantum tls.Certificate, err error) {
+	return DefaultDecoder.DecodeDualStack(pfxData, password)
+}
+
+// DecodeDualStack extracts the classical and post-quantum identities of
+// pfxData, the mirror of EncodeDualStack.  pfxData must contain exactly two
+// private keys, one of them ML-DSA.  Each key is paired with the
+// certificate which has the same LocalKeyId, or failing that with the
+// certificate whose public key matches it, and its chain is built from the
+// certificates which remain.
+func (dec *Decoder) DecodeDualStack(pfxData []byte, password string) (classical, postQuantum tls.Certificate, err error) {
+	encodedPassword, err := bmpString(password)
+	if err != nil {
+		return classical, postQuantum, err
+	}
+
+	bags, encodedPassword, err := dec.getSafeContents(pfxData, encodedPassword)
+	if err != nil {
+		return classical, postQuantum, err
+	}
+
+	var certs []*x509.Certificate
+	var certKeyIDs [][]byte
+	var keys []KeyEntry
+	for i, bag := range bags {
+		switch {
+		case bag.Id.Equal(oidCertBag):
+			cert, err := parseCertBag(bag.Value.Bytes)
+			if err != nil {
+				return classical, postQuantum, err
+			}
+			certs = append(certs, cert)
+			certKeyIDs = append(certKeyIDs, localKeyID(&bag))
+
+		case bag.Id.Equal(oidPKCS8ShroundedKeyBag):
+			key, err := dec.decodePkcs8ShroudedKeyBag(bag.Value.Bytes, encodedPassword)
+			if err != nil {
+				return classical, postQuantum, err
+			}
+			keys = append(keys, KeyEntry{PrivateKey: key, LocalKeyID: localKeyID(&bag)})
+		}
+		dec.bagDone(i, len(bags))
+	}
+
+	if len(keys) != 2 {
+		return classical, postQuantum, errors.New("pkcs12: expected exactly two key bags")
+	}
+	if isPostQuantumKey(keys[0].PrivateKey) {
+		keys[0], keys[1] = keys[1], keys[0]
+	}
+	if isPostQuantumKey(keys[0].PrivateKey) || !isPostQuantumKey(keys[1].PrivateKey) {
+		return classical, postQuantum, errors.New("pkcs12: expected one classical and one ML-DSA private key")
+	}
+
+	leaves := make([]*x509.Certificate, len(keys))
+	for i, key := range keys {
+		if leaves[i] = matchingCertificate(key, certs, certKeyIDs); leaves[i] == nil {
+			return classical, postQuantum, errors.New("pkcs12: certificate missing for private key")
+		}
+	}
+
+	var pool []*x509.Certificate
+	for _, cert := range certs {
+		if !containsCertificate(leaves, cert) && !containsCertificate(pool, cert) {
+			pool = append(pool, cert)
+		}
+	}
+	var identities [2]tls.Certificate
+	for i, key := range keys {
+		chain, err := issuingChain(leaves[i], pool)
+		if err != nil {
+			return classical, postQuantum, err
+		}
+		identities[i] = *tlsCertificate(key.PrivateKey, leaves[i], chain)
+	}
+	return identities[0], identities[1], nil
+}
+
+// matchingCertificate returns the certificate among certs which belongs to
+// key: the one whose localKeyId, given by the corresponding element of
+// keyIDs, equals that of key, or else the first whose public key matches.
+func matchingCertificate(key KeyEntry, certs []*x509.Certificate, keyIDs [][]byte) *x509.Certificate {
+	if key.LocalKeyID != nil {
+		for i, cert := range certs {
+			if bytes.Equal(keyIDs[i], key.LocalKeyID) {
+				return cert
+			}
+		}
+	}
+	signer, ok := key.PrivateKey.(crypto.Signer)
+	if !ok {
+		return nil
+	}
+	for _, cert := range certs {
+		if publicKeyMatches(signer.Public(), cert) {
+			return cert
+		}
+	}
+	return nil
+}
+
+// containsCertificate reports whether cert is in certs.
+func containsCertificate(certs []*x509.Certificate, cert *x509.Certificate) bool {
+	for _, c := range certs {
+		if c.Equal(cert) {
+			return true
+		}
+	}
+	return false
+}
+
+// isPostQuantumKey reports whether privateKey is a post-quantum signature
+// key.
+func isPostQuantumKey(privateKey interface{}) bool {
+	_, ok := privateKey.(*mldsa.PrivateKey)
+	return ok
+}
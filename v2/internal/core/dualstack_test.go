@@ -0,0 +1,95 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/mldsa"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// newTestMLDSACertificate returns an ML-DSA-44 key and a certificate for it
+// named commonName and issued by parent, or a self-signed CA certificate if
+// parent is nil.
+func newTestMLDSACertificate(t *testing.T, commonName string, parent *x509.Certificate, parentKey interface{}) (*mldsa.PrivateKey, *x509.Certificate) {
+	key, err := mldsa.GenerateKey(mldsa.MLDSA44())
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		DNSNames:     []string{commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	if parent == nil {
+		template.BasicConstraintsValid, template.IsCA = true, true
+		template.KeyUsage |= x509.KeyUsageCertSign
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, key.Public(), parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, cert
+}
+
+func TestDualStack(t *testing.T) {
+	rootKey, root := newTestCertificate(t, "root", nil, nil)
+	pqRootKey, pqRoot := newTestMLDSACertificate(t, "pq root", nil, nil)
+	key, leaf := newTestCertificate(t, "www.example.com", root, rootKey)
+	pqKey, pqLeaf := newTestMLDSACertificate(t, "www.example.com", pqRoot, pqRootKey)
+
+	classical := tls.Certificate{Certificate: [][]byte{leaf.Raw, root.Raw}, PrivateKey: key}
+	postQuantum := tls.Certificate{Certificate: [][]byte{pqLeaf.Raw, pqRoot.Raw}, PrivateKey: pqKey}
+	pfxData, err := EncodeDualStack(rand.Reader, classical, postQuantum, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gotClassical, gotPostQuantum, err := DecodeDualStack(pfxData, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		name      string
+		got, want tls.Certificate
+	}{
+		{"classical", gotClassical, classical},
+		{"post-quantum", gotPostQuantum, postQuantum},
+	} {
+		if len(test.got.Certificate) != 2 || !bytes.Equal(test.got.Certificate[0], test.want.Certificate[0]) || !bytes.Equal(test.got.Certificate[1], test.want.Certificate[1]) {
+			t.Errorf("%s: got a chain of %d certificates, want the original chain", test.name, len(test.got.Certificate))
+		}
+		if !test.got.PrivateKey.(interface{ Equal(crypto.PrivateKey) bool }).Equal(test.want.PrivateKey) {
+			t.Errorf("%s: got the wrong private key", test.name)
+		}
+	}
+
+	if _, _, err := Decode(pfxData, "password"); err == nil {
+		t.Error("Decode accepted a file with two keys")
+	}
+	if _, err := EncodeDualStack(rand.Reader, postQuantum, classical, "password"); err == nil {
+		t.Error("EncodeDualStack accepted swapped identities")
+	}
+	otherKey, other := newTestMLDSACertificate(t, "other.example.com", pqRoot, pqRootKey)
+	postQuantum = tls.Certificate{Certificate: [][]byte{other.Raw}, PrivateKey: otherKey}
+	if _, err := EncodeDualStack(rand.Reader, classical, postQuantum, "password"); err == nil {
+		t.Error("EncodeDualStack accepted certificates with different subjects")
+	}
+}
@@ -0,0 +1,186 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+
+	"github.com/scholar-ink/go-pkcs12/v2/oids"
+)
+
+// A Report describes the contents of a PKCS#12 file, as returned by Dump.
+// It can be marshaled as JSON for consumption by inventory and audit
+// systems; see ReportSchema for the stability of that encoding.
+type Report struct {
+	// Schema is the version of the encoding, ReportSchema for reports
+	// returned by Dump.
+	Schema int `json:"schema"`
+
+	Bags []BagReport `json:"bags"`
+
+	// Extensions describes the ContentInfos of the authenticated safe
+	// which are not SafeContents, such as vendor protection descriptors.
+	Extensions []ExtensionReport `json:"extensions,omitempty"`
+
+	// Unknown holds the members of an unmarshaled report which this
+	// version of the package does not know of.
+	Unknown map[string]json.RawMessage `json:"-"`
+}
+
+// An ExtensionReport describes an Extension of a PKCS#12 file.
+type ExtensionReport struct {
+	// Type is the name of the content type, or its dotted OID if it is
+	// not known.
+	Type string `json:"type"`
+
+	// Index is the position of the ContentInfo in the authenticated safe.
+	Index int `json:"index"`
+
+	// SHA256 is the hex SHA-256 digest of the content.
+	SHA256 string `json:"sha256"`
+
+	// Unknown is as for Report.
+	Unknown map[string]json.RawMessage `json:"-"`
+}
+
+// A BagReport describes one SafeBag of a PKCS#12 file.
+type BagReport struct {
+	// Type is the RFC 7292 name of the bag type, such as "certBag" or
+	// "pkcs8ShroudedKeyBag", or its dotted OID if it is not known.
+	Type string `json:"type"`
+
+	// SafeContents is the index of the SafeContents holding the bag.
+	SafeContents int `json:"safeContents"`
+
+	// Attributes are the bag attributes, named as in the PEM headers
+	// produced by ToPEM.
+	Attributes map[string]string `json:"attributes,omitempty"`
+
+	// SHA256 is the hex SHA-256 digest of the bag's decrypted content: the
+	// DER certificate of a certBag, the PKCS#8 PrivateKeyInfo of a key bag,
+	// and the encoded bag value otherwise.  Unlike the file itself,
+	// which is re-salted every time it is written, the digest only changes
+	// when the content does, so it can be used to track changes across
+	// re-encryptions and password rotations.
+	SHA256 string `json:"sha256"`
+
+	// Unknown is as for Report.
+	Unknown map[string]json.RawMessage `json:"-"`
+}
+
+// Dump describes the contents of pfxData using DefaultDecoder.  See
+// Decoder.Dump.
+func Dump(pfxData []byte, password string) (*Report, error) {
+	return DefaultDecoder.Dump(pfxData, password)
+}
+
+// Dump verifies the integrity of pfxData and describes each of its SafeBags,
+// decrypting shrouded keys to compute their digests.  No key material is
+// included in the report.  Nested safeContentsBags are reported as single
+// bags, and Extensions are reported without being interpreted.
+func (dec *Decoder) Dump(pfxData []byte, password string) (*Report, error) {
+	encodedPassword, err := bmpString(password)
+	if err != nil {
+		return nil, err
+	}
+	pfx := new(pfxPdu)
+	if err := dec.unmarshalPFX(pfxData, pfx); err != nil {
+		return nil, errors.New("pkcs12: error reading P12 data: " + err.Error())
+	}
+	if pfx.Version != 3 {
+		return nil, NotImplementedError("can only decode v3 PFX PDU's")
+	}
+	content, encodedPassword, _, err := dec.verifyIntegrity(pfx, encodedPassword)
+	if err != nil {
+		return nil, err
+	}
+	authenticatedSafe, err := dec.unmarshalAuthenticatedSafe(content)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{Schema: ReportSchema, Bags: []BagReport{}}
+	for i, ci := range authenticatedSafe {
+		if isExtension(ci.ContentType) {
+			digest := sha256.Sum256(ci.Content.Bytes)
+			report.Extensions = append(report.Extensions, ExtensionReport{
+				Type:   oids.Name(ci.ContentType),
+				Index:  i,
+				SHA256: hex.EncodeToString(digest[:]),
+			})
+			continue
+		}
+		bags, err := dec.getSafeContentsOf(ci, encodedPassword)
+		if err != nil {
+			return nil, err
+		}
+		for j := range bags {
+			bagReport, err := dec.reportBag(&bags[j], encodedPassword)
+			if err != nil {
+				return nil, err
+			}
+			bagReport.SafeContents = i
+			report.Bags = append(report.Bags, bagReport)
+		}
+	}
+	return report, nil
+}
+
+// reportBag describes bag, decrypting it with password if it is shrouded.
+func (dec *Decoder) reportBag(bag *safeBag, password []byte) (report BagReport, err error) {
+	report.Type = oids.Name(bag.Id)
+
+	if len(bag.Attributes) > 0 {
+		report.Attributes = make(map[string]string, len(bag.Attributes))
+	}
+	for i := range bag.Attributes {
+		k, v, err := convertAttribute(&bag.Attributes[i])
+		if err != nil {
+			return report, err
+		}
+		if dec.sanitizeAttributes {
+			v = SanitizeAttribute(v, dec.maxAttributeLength)
+		}
+		report.Attributes[k] = v
+	}
+
+	var digest [sha256.Size]byte
+	switch {
+	case bag.Id.Equal(oidCertBag):
+		certsData, err := decodeCertBag(bag.Value.Bytes)
+		if err != nil {
+			return report, err
+		}
+		digest = sha256.Sum256(certsData)
+	case bag.Id.Equal(oidPKCS8ShroundedKeyBag):
+		if digest, err = dec.shroudedKeyDigest(bag.Value.Bytes, password); err != nil {
+			return report, err
+		}
+	default:
+		digest = sha256.Sum256(bag.Value.Bytes)
+	}
+	report.SHA256 = hex.EncodeToString(digest[:])
+	return report, nil
+}
+
+// shroudedKeyDigest returns the SHA-256 digest of the PrivateKeyInfo in the
+// shrouded key bag asn1Data.  The key is decrypted into a scratch buffer,
+// which is zeroed after use.
+func (dec *Decoder) shroudedKeyDigest(asn1Data, password []byte) (digest [sha256.Size]byte, err error) {
+	pkinfo := new(encryptedPrivateKeyInfo)
+	if err = unmarshal(asn1Data, pkinfo); err != nil {
+		return digest, errors.New("pkcs12: error decoding PKCS#8 shrouded key bag: " + err.Error())
+	}
+	buf := getScratch(len(pkinfo.Data()))
+	defer putScratch(buf)
+	pkData, err := dec.decryptShroudedKey(*buf, pkinfo, password)
+	if err != nil {
+		return digest, err
+	}
+	return sha256.Sum256(pkData), nil
+}
@@ -0,0 +1,111 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/scholar-ink/go-pkcs12/v2/oids"
+)
+
+func TestDumpDigests(t *testing.T) {
+	caKey, ca := newTestCertificate(t, "Dump CA", nil, nil)
+	key, cert := newTestCertificate(t, "dump.example.com", ca, caKey)
+
+	first, err := Encode(rand.Reader, key, cert, []*x509.Certificate{ca}, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := Legacy.Encode(rand.Reader, key, cert, []*x509.Certificate{ca}, "other")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := Dump(first, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Bags) != 3 {
+		t.Fatalf("got %d bags, want 3", len(report.Bags))
+	}
+
+	certDigest, caDigest := sha256.Sum256(cert.Raw), sha256.Sum256(ca.Raw)
+	pkData, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDigest := sha256.Sum256(pkData)
+	for _, bag := range report.Bags {
+		switch bag.Type {
+		case "certBag":
+			want := caDigest
+			if bag.Attributes["localKeyId"] != "" {
+				want = certDigest
+			}
+			if bag.SHA256 != hex.EncodeToString(want[:]) {
+				t.Errorf("got certificate digest %s", bag.SHA256)
+			}
+		case "pkcs8ShroudedKeyBag":
+			if bag.SHA256 != hex.EncodeToString(keyDigest[:]) {
+				t.Errorf("got key digest %s", bag.SHA256)
+			}
+		default:
+			t.Errorf("unexpected bag type %s", bag.Type)
+		}
+	}
+
+	// The digests survive re-encryption under different algorithms and
+	// passwords.
+	other, err := Dump(second, "other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(report, other) {
+		t.Errorf("reports differ after re-encryption:\n%+v\n%+v", report, other)
+	}
+
+	if _, err := json.Marshal(report); err != nil {
+		t.Error(err)
+	}
+	if _, err := Dump(first, "wrong"); err != ErrIncorrectPassword {
+		t.Errorf("got error %v with the wrong password, want ErrIncorrectPassword", err)
+	}
+}
+
+// TestOIDsRegistered checks that every object identifier used by this
+// package is described by package oids.
+func TestOIDsRegistered(t *testing.T) {
+	for _, oid := range []asn1.ObjectIdentifier{
+		oidPBEWithSHAAnd3KeyTripleDESCBC, oidPBEWithSHAAnd2KeyTripleDESCBC, oidPBEWithSHAAnd128BitRC2CBC, oidPBEWithSHAAnd40BitRC2CBC, oidPBEWithSHAAnd128BitRC4, oidPBEWithSHAAnd40BitRC4, oidPBES2, oidSHA1, oidSHA256,
+		oidPBEWithMD5AndDESCBC, oidPBEWithMD5AndRC2CBC, oidPBEWithSHA1AndDESCBC, oidPBEWithSHA1AndRC2CBC,
+		oidPBKDF2, oidScrypt, oidHmacWithSHA1, oidHmacWithSHA256, oidHmacWithSHA384, oidHmacWithSHA512,
+		oidAES128CBC, oidAES192CBC, oidAES256CBC, oidCamellia128CBC, oidCamellia192CBC, oidCamellia256CBC, oidSM4CBC, oidSEEDCBC, oidSM3, oidHmacWithSM3, oidStreebog512, oidHmacWithStreebog512, oidMagmaCTRACPKM, oidKuznyechikCTRACPKM, oidAES128CCM, oidAES192CCM, oidAES256CCM, oidAES256GCM, oidChaCha20Poly1305,
+		oidNamedCurveP224, oidNamedCurveP256, oidNamedCurveP384, oidNamedCurveP521, oidNamedCurveBrainpoolP256r1, oidNamedCurveBrainpoolP384r1, oidNamedCurveBrainpoolP512r1, oidNamedCurveSecp256k1, oidEd25519, oidEd448, oidX25519, oidX448,
+		oidDataContentType, oidEncryptedDataContentType, oidEnvelopedDataContentType, oidSignedDataContentType,
+		oidFriendlyName, oidLocalKeyID, oidMicrosoftCSPName, oidContentTypeAttribute, oidMessageDigestAttribute,
+		oidCertTypeX509Certificate, oidKeyBag, oidPKCS8ShroundedKeyBag, oidCertBag,
+		oidSHA384, oidSHA512, oidSHA224, oidSHA512_224, oidSHA512_256, oidRSAEncryption, oidRSASSAPSS,
+		oidSHA1WithRSA, oidSHA256WithRSA, oidSHA384WithRSA, oidSHA512WithRSA,
+		oidECPublicKey, oidECDSAWithSHA1, oidECDSAWithSHA256, oidECDSAWithSHA384, oidECDSAWithSHA512,
+		oidJavaTrustStore, oidAnyExtendedKeyUsage, oidCRLBag, oidCRLTypeX509CRL, oidCompressedBag, oidZlibCompress,
+	} {
+		if _, ok := oids.Lookup(oid); !ok {
+			t.Errorf("%s is not registered", oid)
+		}
+	}
+
+	err := NotImplementedError("algorithm " + oids.Describe(oidPBEWithSHAAnd128BitRC4) + " is not supported")
+	if _, _, gotErr := pbeCipherFor(pkix.AlgorithmIdentifier{Algorithm: oidPBEWithSHAAnd128BitRC4}, nil, nil); gotErr != err {
+		t.Errorf("got error %v, want %v", gotErr, err)
+	}
+}
@@ -0,0 +1,54 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"io"
+)
+
+// WithEmptyContainers returns a copy of dec which accepts PKCS#12 files that
+// are structurally valid but contain no SafeBags at all, as exported by some
+// HSMs.  Decode and DecodeChain then return no key and no certificates
+// instead of an error, and an EncryptedData without any encrypted content is
+// taken to be an empty SafeContents.  If warn is not nil, it is called with
+// ErrEmptyContainer whenever an empty file is decoded.
+//
+// Callers must then be prepared for a nil certificate and private key
+// alongside a nil error.
+func (dec Decoder) WithEmptyContainers(warn func(warning error)) *Decoder {
+	dec.allowEmpty = true
+	dec.warnEmpty = warn
+	return &dec
+}
+
+// emptyContainer reports whether bags should be treated as an empty file
+// rather than rejected, warning about it if so.
+func (dec *Decoder) emptyContainer(bags []safeBag) bool {
+	if !dec.allowEmpty || len(bags) != 0 {
+		return false
+	}
+	if dec.warnEmpty != nil {
+		dec.warnEmpty(ErrEmptyContainer)
+	}
+	return true
+}
+
+// EncodeEmpty produces pfxData containing no keys or certificates using
+// DefaultEncoder.  See Encoder.EncodeEmpty.
+func EncodeEmpty(rand io.Reader, password string) (pfxData []byte, err error) {
+	return DefaultEncoder.EncodeEmpty(rand, password)
+}
+
+// EncodeEmpty produces pfxData containing no keys or certificates, for use
+// as a placeholder which is later replaced by a real identity or trust
+// store.  The file has an empty AuthenticatedSafe protected by a MAC
+// computed according to enc, so password can still be verified.
+func (enc *Encoder) EncodeEmpty(rand io.Reader, password string) (pfxData []byte, err error) {
+	encodedPassword, err := bmpString(password)
+	if err != nil {
+		return nil, err
+	}
+	return enc.makePFX(enc.entropy(rand), []contentInfo{}, encodedPassword, nil)
+}
@@ -0,0 +1,70 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/asn1"
+	"testing"
+)
+
+func TestEmptyContainers(t *testing.T) {
+	pfxData, err := EncodeEmpty(rand.Reader, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := DecodeChain(pfxData, "password"); err == nil {
+		t.Error("DecodeChain accepted an empty file by default")
+	}
+
+	var warnings []error
+	dec := DefaultDecoder.WithEmptyContainers(func(warning error) {
+		warnings = append(warnings, warning)
+	})
+	privateKey, certificate, caCerts, err := dec.DecodeChainWithCAs(pfxData, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if privateKey != nil || certificate != nil || caCerts != nil {
+		t.Error("got non-empty results from an empty file")
+	}
+	if _, _, err := dec.DecodeChain(pfxData, "wrong"); err != ErrIncorrectPassword {
+		t.Errorf("got error %v with the wrong password, want ErrIncorrectPassword", err)
+	}
+	if certs, err := dec.DecodeTrustStore(pfxData, "password"); err != nil || certs != nil {
+		t.Errorf("DecodeTrustStore = %v, %v", certs, err)
+	}
+	if len(warnings) != 2 || warnings[0] != ErrEmptyContainer {
+		t.Errorf("got warnings %v", warnings)
+	}
+
+	// An EncryptedData whose optional encrypted content is absent.
+	_, cert := newTestCertificate(t, "empty.example.com", nil, nil)
+	pfxData, err = EncodeTrustStore(rand.Reader, []*x509.Certificate{cert}, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pfxData = rewriteAuthenticatedSafe(t, pfxData, "password", func(authenticatedSafe []contentInfo) []contentInfo {
+		var ed encryptedData
+		if err := unmarshal(authenticatedSafe[0].Content.Bytes, &ed); err != nil {
+			t.Fatal(err)
+		}
+		ed.EncryptedContentInfo.EncryptedContent = nil
+		authenticatedSafe[0].Content = asn1.RawValue{Class: 2, Tag: 0, IsCompound: true}
+		var err error
+		if authenticatedSafe[0].Content.Bytes, err = asn1.Marshal(ed); err != nil {
+			t.Fatal(err)
+		}
+		return authenticatedSafe
+	})
+	if _, err := DecodeTrustStore(pfxData, "password"); err == nil {
+		t.Error("DecodeTrustStore accepted absent encrypted content by default")
+	}
+	if certs, err := dec.DecodeTrustStore(pfxData, "password"); err != nil || certs != nil {
+		t.Errorf("DecodeTrustStore = %v, %v", certs, err)
+	}
+}
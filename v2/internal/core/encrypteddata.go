@@ -0,0 +1,45 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"github.com/scholar-ink/go-pkcs12/v2/oids"
+)
+
+// WithLenientEncryptedData returns a copy of dec which accepts EncryptedData
+// SafeContents whose version is not 0, such as the version 2 of CMS, or
+// whose encrypted content is labeled with a content type other than data,
+// as some producers emit although the payload is an ordinary SafeContents.
+// If warn is not nil, it is called with ErrEncryptedDataVersion or
+// ErrEncryptedContentType for each such EncryptedData.
+func (dec Decoder) WithLenientEncryptedData(warn func(warning error)) *Decoder {
+	dec.lenientEncrypted = true
+	dec.warnEncrypted = warn
+	return &dec
+}
+
+// checkEncryptedData applies dec's policy to the version and content type of
+// ed.
+func (dec *Decoder) checkEncryptedData(ed *encryptedData) error {
+	if ed.Version != 0 {
+		if !dec.lenientEncrypted {
+			return NotImplementedError("only version 0 of EncryptedData is supported")
+		}
+		dec.encryptedDataWarning(ErrEncryptedDataVersion)
+	}
+	if contentType := ed.EncryptedContentInfo.ContentType; !contentType.Equal(oidDataContentType) {
+		if !dec.lenientEncrypted {
+			return NotImplementedError("encrypted content type " + oids.Describe(contentType) + " is not supported")
+		}
+		dec.encryptedDataWarning(ErrEncryptedContentType)
+	}
+	return nil
+}
+
+func (dec *Decoder) encryptedDataWarning(warning error) {
+	if dec.warnEncrypted != nil {
+		dec.warnEncrypted(warning)
+	}
+}
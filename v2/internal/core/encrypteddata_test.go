@@ -0,0 +1,79 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"crypto/rand"
+	"encoding/asn1"
+	"testing"
+)
+
+// rewriteEncryptedData applies rewrite to the EncryptedData holding the
+// certificates of pfxData.
+func rewriteEncryptedData(t *testing.T, pfxData []byte, rewrite func(*encryptedData)) []byte {
+	return rewriteAuthenticatedSafe(t, pfxData, "password", func(authenticatedSafe []contentInfo) []contentInfo {
+		var ed encryptedData
+		if err := unmarshal(authenticatedSafe[0].Content.Bytes, &ed); err != nil {
+			t.Fatal(err)
+		}
+		rewrite(&ed)
+		data, err := asn1.Marshal(ed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		authenticatedSafe[0].Content = asn1.RawValue{Class: 2, Tag: 0, IsCompound: true, Bytes: data}
+		return authenticatedSafe
+	})
+}
+
+func TestLenientEncryptedData(t *testing.T) {
+	key, cert := newTestCertificate(t, "encrypted.example.com", nil, nil)
+	pfxData, err := Encode(rand.Reader, key, cert, nil, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// An unprotectedAttrs with a single attribute, as CMS allows in
+	// version 2.
+	attrs, err := asn1.Marshal(pkcs12Attribute{Id: oidFriendlyName, Value: asn1.RawValue{Tag: 17, IsCompound: true, Bytes: []byte{0x1e, 0x00}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		rewrite func(*encryptedData)
+		warning error
+	}{
+		{"version 2", func(ed *encryptedData) {
+			ed.Version = 2
+			ed.UnprotectedAttrs = asn1.RawValue{Class: 2, Tag: 1, IsCompound: true, Bytes: attrs}
+		}, ErrEncryptedDataVersion},
+		{"content type", func(ed *encryptedData) {
+			ed.EncryptedContentInfo.ContentType = oidEncryptedDataContentType
+		}, ErrEncryptedContentType},
+	}
+	for _, test := range tests {
+		modified := rewriteEncryptedData(t, pfxData, test.rewrite)
+		if _, _, err := Decode(modified, "password"); err == nil {
+			t.Errorf("%s: strict Decode succeeded", test.name)
+		} else if _, ok := err.(NotImplementedError); !ok {
+			t.Errorf("%s: got error %v, want a NotImplementedError", test.name, err)
+		}
+
+		var warnings []error
+		dec := DefaultDecoder.WithLenientEncryptedData(func(warning error) { warnings = append(warnings, warning) })
+		_, certificate, err := dec.Decode(modified, "password")
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if !certificate.Equal(cert) {
+			t.Errorf("%s: got the wrong certificate", test.name)
+		}
+		if len(warnings) != 1 || warnings[0] != test.warning {
+			t.Errorf("%s: got warnings %v, want %v", test.name, warnings, test.warning)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+)
+
+// An EncryptedPEMKey is a private key in a traditional encrypted PEM block,
+// with Proc-Type and DEK-Info headers, as written by "openssl ec -des3" and
+// "openssl rsa -aes256 -traditional".  Encode and the other encoding
+// functions accept an EncryptedPEMKey, or a pointer to one, in place of a
+// private key, and decrypt it with Passphrase, so that such keys need not
+// be converted with openssl first.
+//
+// PEM holds the PEM encoding, in which the first "RSA PRIVATE KEY", "EC
+// PRIVATE KEY" or "PRIVATE KEY" block is used.  That block may also be
+// unencrypted, in which case Passphrase is ignored.  PKCS#8 "ENCRYPTED
+// PRIVATE KEY" blocks are not supported.
+//
+// The encryption of traditional PEM is weak and unauthenticated, so a wrong
+// passphrase is usually, but not always, detected.
+type EncryptedPEMKey struct {
+	PEM        []byte
+	Passphrase []byte
+}
+
+// decryptPEMKey returns privateKey, or the private key it holds if it is an
+// EncryptedPEMKey.
+func decryptPEMKey(privateKey interface{}) (interface{}, error) {
+	var key EncryptedPEMKey
+	switch k := privateKey.(type) {
+	case EncryptedPEMKey:
+		key = k
+	case *EncryptedPEMKey:
+		if k == nil {
+			return nil, errors.New("pkcs12: private key is nil")
+		}
+		key = *k
+	default:
+		return privateKey, nil
+	}
+
+	rest := key.PEM
+	for {
+		var block *pem.Block
+		if block, rest = pem.Decode(rest); block == nil {
+			return nil, errors.New("pkcs12: no private key found in PEM data")
+		}
+		if !isPEMPrivateKeyType(block.Type) {
+			continue
+		}
+		if !x509.IsEncryptedPEMBlock(block) {
+			return parsePEMPrivateKeyBlock(block.Type, block.Bytes)
+		}
+		der, err := x509.DecryptPEMBlock(block, key.Passphrase)
+		if err == x509.IncorrectPasswordError {
+			return nil, ErrIncorrectPassword
+		} else if err != nil {
+			return nil, errors.New("pkcs12: error decrypting " + block.Type + ": " + err.Error())
+		}
+		defer clear(der)
+		privateKey, err := parsePEMPrivateKeyBlock(block.Type, der)
+		if err != nil {
+			// A wrong passphrase which happens to yield valid
+			// padding produces garbage.
+			return nil, ErrIncorrectPassword
+		}
+		return privateKey, nil
+	}
+}
@@ -0,0 +1,117 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"errors"
+	"io"
+)
+
+// An EnrollmentResponse is the result of a certificate enrollment performed
+// by an EST (RFC 7030) or SCEP (RFC 8894) client: a locally generated
+// private key, the certificate issued for it, and the CA certificates
+// returned by the server.
+type EnrollmentResponse struct {
+	PrivateKey  interface{}
+	Certificate *x509.Certificate
+
+	// CACerts are the certificates returned by the EST /cacerts or SCEP
+	// GetCACert operation, in any order.  They may include certificates
+	// which are not part of the issuing chain, such as SCEP RA
+	// certificates; those are omitted from the output.
+	CACerts []*x509.Certificate
+
+	// FriendlyName is the name under which the identity is shown once
+	// installed.  If empty, the common name of Certificate is used.
+	FriendlyName string
+}
+
+// EncodeEnrollmentResponse packages resp into pfxData using DefaultEncoder.
+// See Encoder.EncodeEnrollmentResponse.
+func EncodeEnrollmentResponse(rand io.Reader, resp *EnrollmentResponse, password string) (pfxData []byte, err error) {
+	return DefaultEncoder.EncodeEnrollmentResponse(rand, resp, password)
+}
+
+// EncodeEnrollmentResponse packages resp into pfxData in the form that
+// device management agents expect when installing an enrolled identity:
+//
+//   - the private key must match the issued certificate;
+//   - the CA certificates are ordered from the issuer of the certificate
+//     towards the root, and certificates which are not on that path are
+//     dropped;
+//   - both the key bag and the end-entity certificate bag carry the
+//     LocalKeyId and friendlyName attributes.
+//
+// It is an error for resp.CACerts to be non-empty but not to contain the
+// issuer of resp.Certificate.
+func (enc *Encoder) EncodeEnrollmentResponse(rand io.Reader, resp *EnrollmentResponse, password string) (pfxData []byte, err error) {
+	if resp == nil {
+		return nil, errors.New("pkcs12: enrollment response is nil")
+	}
+	if resp.Certificate == nil {
+		return nil, errors.New("pkcs12: enrollment response has no certificate")
+	}
+	signer, ok := resp.PrivateKey.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("pkcs12: enrollment response private key does not implement crypto.Signer")
+	}
+	if !publicKeyMatches(signer.Public(), resp.Certificate) {
+		return nil, errors.New("pkcs12: enrollment response private key does not match certificate")
+	}
+
+	chain, err := issuingChain(resp.Certificate, resp.CACerts)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.CACerts) != 0 && len(chain) == 0 {
+		return nil, errors.New("pkcs12: issuer of the enrolled certificate not found in CA certificates")
+	}
+
+	friendlyName := resp.FriendlyName
+	if friendlyName == "" {
+		friendlyName = resp.Certificate.Subject.CommonName
+	}
+	var attrs []pkcs12Attribute
+	if friendlyName != "" {
+		attr, err := makeFriendlyNameAttribute(friendlyName)
+		if err != nil {
+			return nil, err
+		}
+		attrs = append(attrs, attr)
+	}
+
+	return enc.encode(rand, resp.PrivateKey, resp.Certificate, chain, password, attrs, nil)
+}
+
+// issuingChain returns the certificates from pool which form the issuing
+// chain of leaf, starting with its issuer and ending at a self-signed
+// certificate or at the last issuer found in pool.
+func issuingChain(leaf *x509.Certificate, pool []*x509.Certificate) ([]*x509.Certificate, error) {
+	var chain []*x509.Certificate
+	for current := leaf; ; {
+		var issuer *x509.Certificate
+		for _, candidate := range pool {
+			if candidate != nil && bytes.Equal(candidate.RawSubject, current.RawIssuer) && current.CheckSignatureFrom(candidate) == nil {
+				issuer = candidate
+				break
+			}
+		}
+		if issuer == nil || issuer.Equal(current) {
+			// Either the chain is incomplete or current is self-signed.
+			break
+		}
+		for _, cert := range chain {
+			if cert.Equal(issuer) {
+				return nil, errors.New("pkcs12: CA certificates contain a loop")
+			}
+		}
+		chain = append(chain, issuer)
+		current = issuer
+	}
+	return chain, nil
+}
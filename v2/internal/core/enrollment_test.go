@@ -0,0 +1,68 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"testing"
+)
+
+func TestEncodeEnrollmentResponse(t *testing.T) {
+	rootKey, root := newTestCertificate(t, "root", nil, nil)
+	intermediateKey, intermediate := newTestCertificate(t, "intermediate", root, rootKey)
+	_, ra := newTestCertificate(t, "SCEP RA", root, rootKey)
+	key, leaf := newTestCertificate(t, "device-1234", intermediate, intermediateKey)
+
+	resp := &EnrollmentResponse{
+		PrivateKey:  key,
+		Certificate: leaf,
+		CACerts:     []*x509.Certificate{ra, root, intermediate},
+	}
+	pfxData, err := EncodeEnrollmentResponse(rand.Reader, resp, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, certificate, caCerts, err := DecodeChainWithCAs(pfxData, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !certificate.Equal(leaf) || len(caCerts) != 2 || !caCerts[0].Equal(intermediate) || !caCerts[1].Equal(root) {
+		t.Errorf("unexpected chain %v, %v", certificate, caCerts)
+	}
+
+	blocks, err := ToPEM(pfxData, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, block := range blocks {
+		if block.Headers["friendlyName"] == "device-1234" && block.Headers["localKeyId"] == "" {
+			t.Errorf("%s block has friendlyName but no localKeyId", block.Type)
+		}
+	}
+	if blocks[0].Headers["friendlyName"] != "device-1234" || blocks[len(blocks)-1].Headers["friendlyName"] != "device-1234" {
+		t.Errorf("friendlyName missing from leaf or key bag: %v", blocks)
+	}
+
+	resp.FriendlyName = "Work profile"
+	if pfxData, err = EncodeEnrollmentResponse(rand.Reader, resp, "password"); err != nil {
+		t.Fatal(err)
+	}
+	if blocks, err = ToPEM(pfxData, "password"); err != nil {
+		t.Fatal(err)
+	}
+	if got := blocks[0].Headers["friendlyName"]; got != "Work profile" {
+		t.Errorf("got friendlyName %q, want \"Work profile\"", got)
+	}
+
+	otherKey, _ := newTestCertificate(t, "other", nil, nil)
+	if _, err := EncodeEnrollmentResponse(rand.Reader, &EnrollmentResponse{PrivateKey: otherKey, Certificate: leaf}, "password"); err == nil {
+		t.Error("expected error for mismatched key")
+	}
+	if _, err := EncodeEnrollmentResponse(rand.Reader, &EnrollmentResponse{PrivateKey: key, Certificate: leaf, CACerts: []*x509.Certificate{ra}}, "password"); err == nil {
+		t.Error("expected error when issuer is missing")
+	}
+}
@@ -0,0 +1,202 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// An Entry is a TLS identity (a private key, an end-entity certificate, and
+// any CA certificates) loaded from a PKCS#12 file on disk.  Its
+// GetCertificate and GetClientCertificate methods can be used directly as
+// crypto/tls callbacks, and transparently reload the file when its
+// modification time or size changes, so that servers pick up rotated
+// credentials without restarting.  The file is checked at most once a
+// second, and handshakes never wait for a reload: while one is in progress
+// they are served the previous identity.
+//
+// Like CredentialStore, an Entry validates every identity before serving
+// it: the private key must match the end-entity certificate, and the
+// certificate must be within its validity period.  If reloading fails (for
+// example because the file is being rewritten, or holds an expired
+// certificate), the previously loaded identity continues to be served, and
+// the reload is retried only once the modification time or size of the
+// file changes again, or Invalidate is called.
+//
+// An Entry is safe for concurrent use by multiple goroutines.
+type Entry struct {
+	path     string
+	password string
+
+	// interval is the time between checks of the file, which is
+	// entryCheckInterval except in tests.
+	interval time.Duration
+
+	cert atomic.Pointer[tls.Certificate]
+
+	reloadMu sync.Mutex // serializes reloads
+
+	mu      sync.Mutex // guards the fields below
+	checked time.Time
+	stale   bool
+	loaded  fileVersion
+	failed  fileVersion
+}
+
+// A fileVersion identifies the contents of a file by its modification time
+// and size.  The zero fileVersion identifies no file.
+type fileVersion struct {
+	modTime time.Time
+	size    int64
+}
+
+func versionOf(info os.FileInfo) fileVersion {
+	return fileVersion{modTime: info.ModTime(), size: info.Size()}
+}
+
+func (v fileVersion) equal(other fileVersion) bool {
+	return v.modTime.Equal(other.modTime) && v.size == other.size
+}
+
+// entryCheckInterval is the time an Entry waits between checks of its file.
+const entryCheckInterval = time.Second
+
+// LoadEntry reads, decodes, and validates the PKCS#12 file at path,
+// returning an error if the file cannot be read or decoded, or if its
+// identity fails validation.
+func LoadEntry(path, password string) (*Entry, error) {
+	e := &Entry{path: path, password: password, interval: entryCheckInterval}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, errors.New("pkcs12: error reading " + path + ": " + err.Error())
+	}
+	cert, err := loadValidTLSCertificate(path, password)
+	if err != nil {
+		return nil, err
+	}
+	e.cert.Store(cert)
+	e.loaded, e.checked = versionOf(info), time.Now()
+	return e, nil
+}
+
+// Certificate returns the current identity, first reloading the file if it
+// has changed since it was last loaded.
+func (e *Entry) Certificate() *tls.Certificate {
+	now := time.Now()
+	e.mu.Lock()
+	due := e.stale || now.Sub(e.checked) >= e.interval
+	if due {
+		e.checked = now
+	}
+	e.mu.Unlock()
+
+	if due {
+		e.refresh()
+	}
+	return e.cert.Load()
+}
+
+// GetCertificate returns the current identity.  It has the signature of
+// tls.Config.GetCertificate.
+func (e *Entry) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return e.Certificate(), nil
+}
+
+// GetClientCertificate returns the current identity.  It has the signature
+// of tls.Config.GetClientCertificate.
+func (e *Entry) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	return e.Certificate(), nil
+}
+
+// Invalidate forces the file to be reloaded on the next use of e, even if
+// its modification time and size are unchanged or its last reload failed.
+// It is intended to be called from a file system notification hook, such
+// as an fsnotify watcher.
+func (e *Entry) Invalidate() {
+	e.mu.Lock()
+	e.stale = true
+	e.mu.Unlock()
+}
+
+// refresh reloads the file at e.path if it has changed since it was last
+// loaded, and no reload of that version of it has failed, or if e is
+// stale.  It returns at once if another goroutine is reloading the file.
+func (e *Entry) refresh() {
+	if !e.reloadMu.TryLock() {
+		return
+	}
+	defer e.reloadMu.Unlock()
+
+	info, err := os.Stat(e.path)
+	if err != nil {
+		return
+	}
+	version := versionOf(info)
+
+	e.mu.Lock()
+	stale := e.stale
+	e.stale = false
+	wanted := stale || !(version.equal(e.loaded) || version.equal(e.failed))
+	e.mu.Unlock()
+	if !wanted {
+		return
+	}
+
+	cert, err := loadValidTLSCertificate(e.path, e.password)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err != nil {
+		e.failed = version
+		return
+	}
+	e.cert.Store(cert)
+	e.loaded, e.failed = version, fileVersion{}
+}
+
+// loadValidTLSCertificate reads, decodes, and validates the PKCS#12 file
+// at path.
+func loadValidTLSCertificate(path, password string) (*tls.Certificate, error) {
+	cert, err := loadTLSCertificate(path, password)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateTLSCertificate(cert, time.Now()); err != nil {
+		return nil, err
+	}
+	return cert, nil
+}
+
+// loadTLSCertificate reads and decodes the PKCS#12 file at path.
+func loadTLSCertificate(path, password string) (*tls.Certificate, error) {
+	pfxData, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.New("pkcs12: error reading " + path + ": " + err.Error())
+	}
+	privateKey, certificate, caCerts, err := DecodeChainWithCAs(pfxData, password)
+	if err != nil {
+		return nil, err
+	}
+	return tlsCertificate(privateKey, certificate, caCerts), nil
+}
+
+// tlsCertificate assembles a tls.Certificate from decoded PKCS#12 contents.
+func tlsCertificate(privateKey interface{}, certificate *x509.Certificate, caCerts []*x509.Certificate) *tls.Certificate {
+	cert := &tls.Certificate{
+		Certificate: make([][]byte, 0, 1+len(caCerts)),
+		PrivateKey:  privateKey,
+		Leaf:        certificate,
+	}
+	cert.Certificate = append(cert.Certificate, certificate.Raw)
+	for _, caCert := range caCerts {
+		cert.Certificate = append(cert.Certificate, caCert.Raw)
+	}
+	return cert
+}
@@ -0,0 +1,131 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeTestP12 encodes a fresh identity for commonName and atomically
+// replaces path with it, using the given modification time.
+func writeTestP12(t *testing.T, path, commonName, password string, modTime time.Time) {
+	rootKey, root := newTestCertificate(t, "root", nil, nil)
+	key, cert := newTestCertificate(t, commonName, root, rootKey)
+	pfxData, err := Encode(rand.Reader, key, cert, nil, password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, pfxData, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(tmp, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEntry(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "identity.p12")
+	start := time.Now().Add(-time.Hour)
+	writeTestP12(t, path, "first.example.com", "password", start)
+
+	entry, err := LoadEntry(path, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry.interval = 0
+	commonName := func() string {
+		cert, err := entry.GetCertificate(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cert.Leaf.Subject.CommonName
+	}
+	if got := commonName(); got != "first.example.com" {
+		t.Fatalf("got %q, want first.example.com", got)
+	}
+
+	writeTestP12(t, path, "second.example.com", "password", start.Add(time.Minute))
+	if got := commonName(); got != "second.example.com" {
+		t.Errorf("after rotation: got %q, want second.example.com", got)
+	}
+
+	// A corrupt file must not replace the current identity.
+	if err := os.WriteFile(path, []byte("garbage"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if got := commonName(); got != "second.example.com" {
+		t.Errorf("after corruption: got %q, want second.example.com", got)
+	}
+	entry.mu.Lock()
+	failed := entry.failed
+	entry.mu.Unlock()
+	if failed.size != int64(len("garbage")) {
+		t.Errorf("failed reload was not recorded: %+v", failed)
+	}
+
+	writeTestP12(t, path, "third.example.com", "password", start.Add(time.Minute))
+	entry.Invalidate()
+	if cert, _ := entry.GetClientCertificate(nil); cert.Leaf.Subject.CommonName != "third.example.com" {
+		t.Errorf("after Invalidate: got %q, want third.example.com", cert.Leaf.Subject.CommonName)
+	}
+
+	if _, err := LoadEntry(filepath.Join(t.TempDir(), "missing.p12"), "password"); err == nil {
+		t.Error("expected error loading a missing file")
+	}
+}
+
+func TestEntryValidates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "identity.p12")
+	start := time.Now().Add(-time.Hour)
+	writeTestP12(t, path, "first.example.com", "password", start)
+	entry, err := LoadEntry(path, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry.interval = 0
+
+	// An identity whose key does not match its certificate is not served.
+	otherKey, _ := newTestCertificate(t, "other.example.com", nil, nil)
+	_, cert := newTestCertificate(t, "mismatched.example.com", nil, nil)
+	if err := os.WriteFile(path, encodeMismatchedIdentity(t, otherKey, cert), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if got := entry.Certificate().Leaf.Subject.CommonName; got != "first.example.com" {
+		t.Errorf("got %q, want first.example.com", got)
+	}
+	if _, err := LoadEntry(path, "password"); err == nil {
+		t.Error("LoadEntry accepted a mismatched private key")
+	}
+}
+
+func TestEntryInterval(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "identity.p12")
+	start := time.Now().Add(-time.Hour)
+	writeTestP12(t, path, "first.example.com", "password", start)
+	entry, err := LoadEntry(path, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry.interval = time.Hour
+
+	// The file is not checked again within the interval, unless e is
+	// invalidated.
+	writeTestP12(t, path, "second.example.com", "password", start.Add(time.Minute))
+	if got := entry.Certificate().Leaf.Subject.CommonName; got != "first.example.com" {
+		t.Errorf("within the interval: got %q, want first.example.com", got)
+	}
+	entry.Invalidate()
+	if got := entry.Certificate().Leaf.Subject.CommonName; got != "second.example.com" {
+		t.Errorf("after Invalidate: got %q, want second.example.com", got)
+	}
+}
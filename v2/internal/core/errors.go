@@ -0,0 +1,153 @@
+// Copyright 2015 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	// ErrDecryption represents a failure to decrypt the input.
+	ErrDecryption = errors.New("pkcs12: decryption error, incorrect padding")
+
+	// ErrIncorrectPassword is returned when an incorrect password is detected.
+	// Usually, P12/PFX data is signed to be able to verify the password.
+	ErrIncorrectPassword = errors.New("pkcs12: decryption password incorrect")
+
+	// ErrLegacyEncodingDisabled is returned when an Encoder would produce
+	// output protected with weak algorithms after DisableLegacyEncoding has
+	// been called.
+	ErrLegacyEncodingDisabled = errors.New("pkcs12: legacy encoding has been disabled")
+
+	// ErrDuplicateCertificate is returned when a file contains the same
+	// certificate more than once and the Decoder is configured with
+	// RejectDuplicateCertificates.
+	ErrDuplicateCertificate = errors.New("pkcs12: duplicate certificate")
+
+	// ErrDuplicateKeyID is returned when a file contains several private
+	// keys with the same localKeyId and the Decoder is configured with
+	// RejectDuplicateKeyIDs, as it is by default.
+	ErrDuplicateKeyID = errors.New("pkcs12: duplicate localKeyId")
+
+	// ErrMissingSignature is returned by a Decoder configured with
+	// WithIntegrityVerifier when a file is not in public-key integrity
+	// mode, so that its signature cannot be verified.
+	ErrMissingSignature = errors.New("pkcs12: file is not signed, but the Decoder requires a signature")
+
+	// ErrKeyMismatch is returned by an Encoder when the private key is of
+	// the same algorithm, and for ECDSA on the same curve, as the
+	// end-entity certificate's public key, but is not its private key.
+	ErrKeyMismatch = errors.New("pkcs12: private key does not match the certificate")
+
+	// ErrEmptyContainer is passed to the warning function of a Decoder
+	// configured with WithEmptyContainers when a file contains no SafeBags.
+	ErrEmptyContainer = errors.New("pkcs12: file contains no keys or certificates")
+
+	// ErrEncryptedDataVersion and ErrEncryptedContentType are passed to
+	// the warning function of a Decoder configured with
+	// WithLenientEncryptedData when an EncryptedData has a version other
+	// than 0, or encrypted content which is not labeled as data.
+	ErrEncryptedDataVersion = errors.New("pkcs12: unexpected EncryptedData version")
+	ErrEncryptedContentType = errors.New("pkcs12: unexpected encrypted content type")
+)
+
+// NotImplementedError indicates that the input is not currently supported.
+type NotImplementedError string
+
+func (e NotImplementedError) Error() string {
+	return "pkcs12: " + string(e)
+}
+
+// DowngradeError is returned by CheckDowngrade when a PKCS#12 file is
+// protected less strongly than its predecessor.
+type DowngradeError struct {
+	// Reasons describes each way in which protection was weakened.
+	Reasons []string
+}
+
+func (e *DowngradeError) Error() string {
+	return "pkcs12: protection downgraded: " + strings.Join(e.Reasons, "; ")
+}
+
+// SizeError is returned by an Encoder configured with WithMaxSize when the
+// encoded file would exceed the limit.
+type SizeError struct {
+	// Size is the length of the encoded file, and Limit the maximum.
+	Size, Limit int
+
+	// Contributors lists what the file is made of, largest first.
+	Contributors []SizeContribution
+}
+
+func (e *SizeError) Error() string {
+	msg := fmt.Sprintf("pkcs12: encoded file is %d bytes, exceeding the limit of %d", e.Size, e.Limit)
+	for i, c := range e.Contributors {
+		if i == 3 {
+			break
+		}
+		if i == 0 {
+			msg += "; largest contributors: "
+		} else {
+			msg += ", "
+		}
+		msg += fmt.Sprintf("%s (%d bytes)", c.Description, c.Size)
+	}
+	return msg
+}
+
+// IterationsError is returned by a Decoder when a key derivation in the
+// input uses fewer iterations than the minimum set with WithMinIterations,
+// or no iterations at all.
+type IterationsError struct {
+	// What names the derivation: "MAC", "content encryption" or "key
+	// encryption".
+	What string
+
+	// Iterations is the count found in the input, and Minimum the lowest
+	// count accepted.
+	Iterations, Minimum int
+}
+
+func (e *IterationsError) Error() string {
+	return fmt.Sprintf("pkcs12: %s uses %d iterations, below the minimum of %d", e.What, e.Iterations, e.Minimum)
+}
+
+// KeyAlgorithmMismatchError is returned by an Encoder when the private key
+// and the end-entity certificate's public key are of different algorithms,
+// such as an Ed25519 key with an ECDSA certificate.
+type KeyAlgorithmMismatchError struct {
+	KeyAlgorithm, CertificateAlgorithm x509.PublicKeyAlgorithm
+}
+
+func (e *KeyAlgorithmMismatchError) Error() string {
+	return fmt.Sprintf("pkcs12: %v private key does not match the %v public key of the certificate", e.KeyAlgorithm, e.CertificateAlgorithm)
+}
+
+// CurveMismatchError is returned by an Encoder when an ECDSA private key
+// and the end-entity certificate's public key are on different curves.
+type CurveMismatchError struct {
+	// KeyCurve and CertificateCurve are the names of the curves, such as
+	// "P-256".
+	KeyCurve, CertificateCurve string
+}
+
+func (e *CurveMismatchError) Error() string {
+	return fmt.Sprintf("pkcs12: private key is on curve %s but the certificate public key is on curve %s", e.KeyCurve, e.CertificateCurve)
+}
+
+// LeakError is returned by Canary.Scan when the output contains a secret
+// of the canary.
+type LeakError struct {
+	// Secret describes the secret, such as "password" or "PKCS#8 private
+	// key", and Encoding how it was found, such as "raw" or "base64".
+	Secret, Encoding string
+}
+
+func (e *LeakError) Error() string {
+	return "pkcs12: output contains the " + e.Encoding + " canary " + e.Secret
+}
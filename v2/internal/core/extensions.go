@@ -0,0 +1,89 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"encoding/asn1"
+	"errors"
+)
+
+// An Extension is a ContentInfo of the authenticated safe of a PKCS#12 file
+// whose content type is not one of those RFC 7292 uses for SafeContents.
+// Some enterprise exports append such ContentInfos to carry vendor data,
+// such as the DPAPI-NG protection descriptor of a Windows password hint.
+// This package does not interpret them.
+type Extension struct {
+	// Index is the position of the ContentInfo in the authenticated safe.
+	Index int
+
+	// ContentType identifies the format of Content.
+	ContentType asn1.ObjectIdentifier
+
+	// Content is the DER encoding of the content, exactly as it appears in
+	// the file.
+	Content []byte
+}
+
+// isExtension reports whether a ContentInfo of the authenticated safe with
+// the given content type is an Extension.  EnvelopedData, which RFC 7292
+// uses in public-key privacy mode, is not: it holds SafeContents which this
+// package cannot decrypt, and must not be mistaken for opaque vendor data.
+func isExtension(contentType asn1.ObjectIdentifier) bool {
+	return !contentType.Equal(oidDataContentType) &&
+		!contentType.Equal(oidEncryptedDataContentType) &&
+		!contentType.Equal(oidEnvelopedDataContentType)
+}
+
+func newExtension(index int, ci contentInfo) Extension {
+	return Extension{
+		Index:       index,
+		ContentType: ci.ContentType,
+		Content:     append([]byte(nil), ci.Content.Bytes...),
+	}
+}
+
+// WithExtensions returns a copy of dec which skips Extensions when decoding,
+// calling report with each of them, rather than failing with a
+// NotImplementedError.  report must not be nil.
+func (dec Decoder) WithExtensions(report func(Extension)) *Decoder {
+	dec.reportExtension = report
+	return &dec
+}
+
+// PeekExtensions returns the Extensions of pfxData using DefaultDecoder.
+// See Decoder.PeekExtensions.
+func PeekExtensions(pfxData []byte) ([]Extension, error) {
+	return DefaultDecoder.PeekExtensions(pfxData)
+}
+
+// PeekExtensions returns the Extensions of pfxData, in the order in which
+// they appear, without verifying its integrity, so that they can be
+// examined without the password.  Since nothing is verified, their content
+// must not be trusted.
+func (dec *Decoder) PeekExtensions(pfxData []byte) ([]Extension, error) {
+	pfx := new(pfxPdu)
+	if err := dec.unmarshalPFX(pfxData, pfx); err != nil {
+		return nil, errors.New("pkcs12: error reading P12 data: " + err.Error())
+	}
+	if pfx.Version != 3 {
+		return nil, NotImplementedError("can only decode v3 PFX PDU's")
+	}
+	content, _, err := authSafeContent(pfx)
+	if err != nil {
+		return nil, err
+	}
+	authenticatedSafe, err := dec.unmarshalAuthenticatedSafe(content)
+	if err != nil {
+		return nil, err
+	}
+
+	var extensions []Extension
+	for i, ci := range authenticatedSafe {
+		if isExtension(ci.ContentType) {
+			extensions = append(extensions, newExtension(i, ci))
+		}
+	}
+	return extensions, nil
+}
@@ -0,0 +1,69 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/asn1"
+	"testing"
+)
+
+func TestExtensions(t *testing.T) {
+	key, cert := newTestCertificate(t, "extension.example.com", nil, nil)
+	pfxData, err := Encode(rand.Reader, key, cert, nil, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A vendor ContentInfo appended to the authenticated safe.
+	vendorType := asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 74, 1}
+	descriptor, _ := asn1.Marshal("SID=S-1-5-21-1004336348-1177238915-682003330-512")
+	pfxData = rewriteAuthenticatedSafe(t, pfxData, "password", func(authenticatedSafe []contentInfo) []contentInfo {
+		return append(authenticatedSafe, contentInfo{
+			ContentType: vendorType,
+			Content:     asn1.RawValue{Class: 2, Tag: 0, IsCompound: true, Bytes: descriptor},
+		})
+	})
+
+	if _, _, err := Decode(pfxData, "password"); err == nil {
+		t.Error("strict Decode succeeded")
+	} else if _, ok := err.(NotImplementedError); !ok {
+		t.Errorf("got error %v, want a NotImplementedError", err)
+	}
+
+	var reported []Extension
+	dec := DefaultDecoder.WithExtensions(func(ext Extension) { reported = append(reported, ext) })
+	privateKey, certificate, err := dec.Decode(pfxData, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !key.Equal(privateKey) || !certificate.Equal(cert) {
+		t.Error("decoded identity does not match")
+	}
+
+	peeked, err := PeekExtensions(pfxData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, extensions := range map[string][]Extension{"WithExtensions": reported, "PeekExtensions": peeked} {
+		if len(extensions) != 1 {
+			t.Errorf("%s: got %d extensions, want 1", name, len(extensions))
+			continue
+		}
+		ext := extensions[0]
+		if ext.Index != 2 || !ext.ContentType.Equal(vendorType) || !bytes.Equal(ext.Content, descriptor) {
+			t.Errorf("%s: got extension %+v", name, ext)
+		}
+	}
+
+	report, err := Dump(pfxData, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Bags) != 2 || len(report.Extensions) != 1 || report.Extensions[0].Type != vendorType.String() || report.Extensions[0].Index != 2 {
+		t.Errorf("got report %+v", report)
+	}
+}
@@ -0,0 +1,48 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"strings"
+)
+
+// KeyFingerprint returns the fingerprint of privateKey printed by
+//
+//	openssl pkcs8 -topk8 -nocrypt -outform DER | openssl md5
+//
+// that is, the MD5 digest of its unencrypted PKCS#8 encoding, in lower-case
+// hex.  It identifies a key, not a PKCS#12 file: the same key has the same
+// fingerprint whatever the password and algorithms of the file holding it.
+func KeyFingerprint(privateKey interface{}) (string, error) {
+	der, err := marshalPKCS8PrivateKey(privateKey, nil)
+	if err != nil {
+		return "", errors.New("pkcs12: error encoding PKCS#8 private key: " + err.Error())
+	}
+	defer clear(der)
+	sum := md5.Sum(der)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// CertificateFingerprint returns the SHA-256 fingerprint of certificate as
+// displayed by "keytool -list", which identifies private key entries by
+// their certificate, and by "openssl x509 -fingerprint -sha256": upper-case
+// hex bytes separated by colons.
+func CertificateFingerprint(certificate *x509.Certificate) string {
+	sum := sha256.Sum256(certificate.Raw)
+	digits := strings.ToUpper(hex.EncodeToString(sum[:]))
+	var b strings.Builder
+	for i := 0; i < len(digits); i += 2 {
+		if i > 0 {
+			b.WriteByte(':')
+		}
+		b.WriteString(digits[i : i+2])
+	}
+	return b.String()
+}
@@ -0,0 +1,36 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"encoding/base64"
+	"testing"
+)
+
+func TestFingerprints(t *testing.T) {
+	p12, _ := base64.StdEncoding.DecodeString(openSSL111TestData)
+	privateKey, certificate, err := Decode(p12, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// openssl pkcs12 -legacy -nocerts -nodes | openssl pkcs8 -topk8 -nocrypt -outform DER | openssl md5
+	got, err := KeyFingerprint(privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "a23db98a2d93273bd01d4b3c70e3925e"; got != want {
+		t.Errorf("got key fingerprint %s, want %s", got, want)
+	}
+
+	// openssl pkcs12 -legacy -clcerts -nokeys | openssl x509 -noout -fingerprint -sha256
+	if got, want := CertificateFingerprint(certificate), "5E:8A:9B:57:EA:30:71:1E:E8:A1:01:1E:09:94:75:8F:3E:F4:28:18:D3:0A:03:36:CC:50:AC:BE:E3:44:E4:46"; got != want {
+		t.Errorf("got certificate fingerprint %s, want %s", got, want)
+	}
+
+	if _, err := KeyFingerprint(struct{}{}); err == nil {
+		t.Error("computed the fingerprint of an unknown key type")
+	}
+}
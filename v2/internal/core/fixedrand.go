@@ -0,0 +1,72 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	cryptorand "crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"io"
+)
+
+// WithFixedRandomness returns a copy of enc which ignores the rand argument
+// of its encoding methods and draws every salt from a stream determined by
+// seed alone, so that encoding the same input twice yields identical
+// output.  It exists for known-answer tests in validation labs, which need
+// full control over the generated values, and must never be used to
+// produce files which protect real keys: anyone who knows seed knows every
+// salt.  A nil seed restores the use of rand.
+//
+// The stream is the concatenation of SHA-256(seed || counter) for counter
+// = 0, 1, 2, ..., each counter encoded as a 64-bit big-endian integer, and
+// starts afresh for each call.  Salts are drawn from it in the order in
+// which the file is assembled: the shrouded key, then the certificates,
+// then the MAC.
+func (enc Encoder) WithFixedRandomness(seed []byte) *Encoder {
+	if seed == nil {
+		enc.fixedSeed = nil
+	} else {
+		enc.fixedSeed = append([]byte{}, seed...)
+	}
+	return &enc
+}
+
+// entropy returns the source of the random values of a single encoding
+// operation, which is rand, or crypto/rand if rand is nil, unless enc has
+// fixed randomness.
+func (enc *Encoder) entropy(rand io.Reader) io.Reader {
+	if enc.fixedSeed != nil {
+		return &fixedReader{seed: enc.fixedSeed}
+	}
+	if rand == nil {
+		return cryptorand.Reader
+	}
+	return rand
+}
+
+// fixedReader reads the stream described by WithFixedRandomness.
+type fixedReader struct {
+	seed    []byte
+	counter uint64
+	buf     []byte
+}
+
+func (r *fixedReader) Read(p []byte) (n int, err error) {
+	for n < len(p) {
+		if len(r.buf) == 0 {
+			h := sha256.New()
+			h.Write(r.seed)
+			var counter [8]byte
+			binary.BigEndian.PutUint64(counter[:], r.counter)
+			h.Write(counter[:])
+			r.buf = h.Sum(nil)
+			r.counter++
+		}
+		copied := copy(p[n:], r.buf)
+		r.buf = r.buf[copied:]
+		n += copied
+	}
+	return n, nil
+}
@@ -0,0 +1,86 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"io"
+	"testing"
+)
+
+func TestFixedRandomness(t *testing.T) {
+	key, cert := newTestCertificate(t, "kat.example.com", nil, nil)
+	enc := DefaultEncoder.WithFixedRandomness([]byte("seed"))
+
+	first, err := enc.Encode(rand.Reader, key, cert, nil, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The rand argument is ignored, even if it would fail.
+	second, err := enc.Encode(failingReader{}, key, cert, nil, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(first, second) {
+		t.Error("encoding twice with the same seed gave different output")
+	}
+	if _, _, err := Decode(first, "password"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The MAC salt is drawn last.
+	info, err := PeekMAC(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream := make([]byte, 24)
+	if _, err := io.ReadFull(enc.entropy(nil), stream); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(info.Salt, stream[16:24]) {
+		t.Errorf("MAC salt is %x, want %x", info.Salt, stream[16:24])
+	}
+
+	other, err := DefaultEncoder.WithFixedRandomness([]byte("other seed")).Encode(rand.Reader, key, cert, nil, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(first, other) {
+		t.Error("different seeds gave the same output")
+	}
+
+	if _, err := enc.WithFixedRandomness(nil).Encode(failingReader{}, key, cert, nil, "password"); err == nil {
+		t.Error("a nil seed did not restore the use of rand")
+	}
+}
+
+func TestFixedReader(t *testing.T) {
+	seed := []byte("seed")
+	var want []byte
+	for counter := byte(0); counter < 3; counter++ {
+		block := sha256.Sum256(append(append([]byte{}, seed...), 0, 0, 0, 0, 0, 0, 0, counter))
+		want = append(want, block[:]...)
+	}
+
+	// Read in pieces which straddle the block boundaries.
+	r := &fixedReader{seed: seed}
+	var got []byte
+	for _, n := range []int{5, 30, 1, 60} {
+		buf := make([]byte, n)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, buf...)
+	}
+	if !bytes.Equal(got, want[:len(got)]) {
+		t.Errorf("got stream %x, want %x", got, want[:len(got)])
+	}
+}
+
+type failingReader struct{}
+
+func (failingReader) Read([]byte) (int, error) { return 0, io.ErrUnexpectedEOF }
@@ -0,0 +1,51 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import "crypto/x509"
+
+// WithAutomaticFriendlyName returns a copy of enc which gives the private
+// key bag and the end-entity certificate bag a friendlyName taken from the
+// certificate, as OpenSSL and the Windows certificate export wizard
+// effectively do: the first DNS name of its Subject Alternative Name
+// extension, or, if it has none, the common name of its subject.  No
+// friendlyName is added if the certificate has neither, or if the
+// encoding method already sets one, as EncodeTLSCertificate does when
+// its options carry a FriendlyName.
+func (enc Encoder) WithAutomaticFriendlyName(enabled bool) *Encoder {
+	enc.autoFriendlyName = enabled
+	return &enc
+}
+
+// addFriendlyName returns identityAttrs with the friendlyName described by
+// WithAutomaticFriendlyName added, if enc has it enabled.
+func (enc *Encoder) addFriendlyName(identityAttrs []pkcs12Attribute, certificate *x509.Certificate) ([]pkcs12Attribute, error) {
+	if !enc.autoFriendlyName {
+		return identityAttrs, nil
+	}
+	for _, attr := range identityAttrs {
+		if attr.Id.Equal(oidFriendlyName) {
+			return identityAttrs, nil
+		}
+	}
+	name := certificateName(certificate)
+	if name == "" {
+		return identityAttrs, nil
+	}
+	attr, err := makeFriendlyNameAttribute(name)
+	if err != nil {
+		return nil, err
+	}
+	return append(identityAttrs, attr), nil
+}
+
+// certificateName returns the first DNS SAN of certificate, or its subject
+// common name.
+func certificateName(certificate *x509.Certificate) string {
+	if len(certificate.DNSNames) > 0 {
+		return certificate.DNSNames[0]
+	}
+	return certificate.Subject.CommonName
+}
@@ -0,0 +1,69 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"testing"
+)
+
+func TestAutomaticFriendlyName(t *testing.T) {
+	key, cert := newTestCertificate(t, "cn.example.com", nil, nil)
+	_, ca := newTestCertificate(t, "ca.example.com", nil, nil)
+	auto := DefaultEncoder.WithAutomaticFriendlyName(true)
+
+	friendlyNames := func(pfxData []byte) []string {
+		t.Helper()
+		blocks, err := ToPEM(pfxData, "password")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, block := range blocks {
+			names = append(names, block.Headers["friendlyName"])
+		}
+		return names
+	}
+	check := func(name string, pfxData []byte, err error, want string) {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The blocks are the leaf, the CA certificate, then the key.
+		got := friendlyNames(pfxData)
+		if len(got) != 3 || got[0] != want || got[1] != "" || got[2] != want {
+			t.Errorf("%s: got friendly names %q, want %q on the leaf and key", name, got, want)
+		}
+	}
+
+	pfxData, err := auto.Encode(rand.Reader, key, cert, []*x509.Certificate{ca}, "password")
+	check("SAN", pfxData, err, "cn.example.com")
+
+	cert.DNSNames = []string{"san.example.com", "other.example.com"}
+	pfxData, err = auto.Encode(rand.Reader, key, cert, []*x509.Certificate{ca}, "password")
+	check("first SAN", pfxData, err, "san.example.com")
+
+	cert.DNSNames = nil
+	cert.Subject.CommonName = "subject"
+	pfxData, err = auto.Encode(rand.Reader, key, cert, []*x509.Certificate{ca}, "password")
+	check("CN", pfxData, err, "subject")
+
+	pfxData, err = auto.EncodeTLSCertificate(rand.Reader, tls.Certificate{
+		Certificate: [][]byte{cert.Raw, ca.Raw},
+		PrivateKey:  key,
+		Leaf:        cert,
+	}, "password", &TLSCertificateOptions{FriendlyName: "explicit"})
+	check("explicit", pfxData, err, "explicit")
+
+	cert.Subject.CommonName = ""
+	pfxData, err = auto.Encode(rand.Reader, key, cert, []*x509.Certificate{ca}, "password")
+	check("unnamed", pfxData, err, "")
+
+	cert.Subject.CommonName = "subject"
+	pfxData, err = Encode(rand.Reader, key, cert, []*x509.Certificate{ca}, "password")
+	check("disabled", pfxData, err, "")
+}
@@ -0,0 +1,51 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"testing"
+
+	"github.com/scholar-ink/go-pkcs12/v2/pkcs12test"
+)
+
+// FuzzPKCS12's seed corpus lives in testdata/fuzz/FuzzPKCS12, in addition to
+// the test vectors and the pkcs12test.MalformedCorpus added below.
+func FuzzPKCS12(f *testing.F) {
+	for _, base64P12 := range testdata {
+		p12, _ := base64.StdEncoding.DecodeString(base64P12)
+		f.Add(p12, "")
+	}
+	for _, entry := range pkcs12test.MalformedCorpus() {
+		f.Add(entry.Data, entry.Password)
+	}
+	f.Fuzz(func(t *testing.T, data []byte, password string) {
+		FuzzDecode(data, password)
+	})
+}
+
+// TestFuzzDecodeKeyMismatch checks that FuzzDecode does not report a bug
+// for a file which decodes but which Encode rejects because its private key
+// does not match its certificate, as files exported by OpenSSL may.
+func TestFuzzDecodeKeyMismatch(t *testing.T) {
+	_, cert := newTestCertificate(t, "www.example.com", nil, nil)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, _ := newTestCertificate(t, "other.example.com", nil, nil)
+
+	for _, key := range []interface{}{rsaKey, otherKey} {
+		pfxData := encodeMismatchedIdentity(t, key, cert)
+		if _, _, err := DecodeChain(pfxData, "password"); err != nil {
+			t.Fatalf("%T: %v", key, err)
+		}
+		if FuzzDecode(pfxData, "password") != 0 {
+			t.Errorf("%T: FuzzDecode re-encoded a mismatched key", key)
+		}
+	}
+}
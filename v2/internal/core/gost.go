@@ -0,0 +1,189 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/subtle"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"hash"
+	"sync/atomic"
+
+	"github.com/scholar-ink/go-pkcs12/v2/oids"
+)
+
+var (
+	oidStreebog512         = asn1.ObjectIdentifier([]int{1, 2, 643, 7, 1, 1, 2, 3})
+	oidHmacWithStreebog512 = asn1.ObjectIdentifier([]int{1, 2, 643, 7, 1, 1, 4, 2})
+	oidMagmaCTRACPKM       = asn1.ObjectIdentifier([]int{1, 2, 643, 7, 1, 1, 5, 1, 1})
+	oidKuznyechikCTRACPKM  = asn1.ObjectIdentifier([]int{1, 2, 643, 7, 1, 1, 5, 2, 1})
+)
+
+var gostAlgorithms atomic.Pointer[GOST]
+
+const gostNotRegistered = "requires an implementation registered with RegisterGOST"
+
+// GOST holds implementations of the Russian GOST primitives, which this
+// package does not include, for decoding key containers that follow
+// RFC 9548, such as those exported by CryptoPro CSP.  Such files are
+// authenticated with HMAC using the 512-bit GOST R 34.11-2012 (Streebog)
+// hash, keyed by PBKDF2 rather than the PKCS#12 key derivation, and
+// encrypted with PBES2, using PBKDF2 with the same HMAC, and the
+// GOST R 34.12-2015 Kuznyechik or Magma cipher in CTR-ACPKM mode
+// (RFC 8645).
+//
+// A nil field leaves files which need it failing with a
+// NotImplementedError, as they do when no GOST is registered.
+type GOST struct {
+	// Streebog512 returns a new hash.Hash computing the 512-bit
+	// GOST R 34.11-2012 digest.
+	Streebog512 func() hash.Hash
+
+	// Kuznyechik and Magma return the GOST R 34.12-2015 block ciphers
+	// keyed with a 32-byte key.  Magma is the 64-bit block cipher of
+	// GOST 28147-89 with the S-box fixed by GOST R 34.12-2015.
+	Kuznyechik, Magma func(key []byte) (cipher.Block, error)
+}
+
+// RegisterGOST makes the primitives of g available to every Decoder,
+// replacing any registered before.  It is intended to be called during
+// program initialization with implementations from a third-party package.
+func RegisterGOST(g GOST) {
+	gostAlgorithms.Store(&g)
+}
+
+// registeredGOST returns the primitives registered with RegisterGOST, all
+// nil if there are none.
+func registeredGOST() GOST {
+	if g := gostAlgorithms.Load(); g != nil {
+		return *g
+	}
+	return GOST{}
+}
+
+// gostHash returns the registered Streebog512.
+func gostHash() (func() hash.Hash, error) {
+	newHash := registeredGOST().Streebog512
+	if newHash == nil {
+		return nil, NotImplementedError("GOST R 34.11-2012 " + gostNotRegistered)
+	}
+	return newHash, nil
+}
+
+// gostCipherFor returns the registered block cipher of the CTR-ACPKM
+// scheme, and the size of its ACPKM sections in bytes.
+func gostCipherFor(scheme asn1.ObjectIdentifier) (newBlock func([]byte) (cipher.Block, error), sectionSize int, err error) {
+	g := registeredGOST()
+	switch {
+	case scheme.Equal(oidKuznyechikCTRACPKM):
+		newBlock, sectionSize = g.Kuznyechik, 4096
+	case scheme.Equal(oidMagmaCTRACPKM):
+		newBlock, sectionSize = g.Magma, 1024
+	}
+	if newBlock == nil {
+		return nil, 0, NotImplementedError("PBES2 encryption scheme " + oids.Describe(scheme) + " " + gostNotRegistered)
+	}
+	return newBlock, sectionSize, nil
+}
+
+// isCTRACPKM reports whether scheme is a GOST CTR-ACPKM encryption scheme.
+func isCTRACPKM(scheme asn1.ObjectIdentifier) bool {
+	return scheme.Equal(oidKuznyechikCTRACPKM) || scheme.Equal(oidMagmaCTRACPKM)
+}
+
+// gost3412Params are the parameters of the GOST R 34.12-2015 encryption
+// schemes, RFC 9337 section 4.  The IV is the first half block of UKM.
+type gost3412Params struct {
+	UKM []byte
+}
+
+// ctrACPKMDecrypt decrypts encrypted with block in the CTR-ACPKM mode of
+// scheme, decrypting into dst if it has enough capacity.
+func ctrACPKMDecrypt(dst []byte, block cipher.Block, scheme pkix.AlgorithmIdentifier, encrypted []byte) ([]byte, error) {
+	var params gost3412Params
+	if err := unmarshal(scheme.Parameters.FullBytes, &params); err != nil {
+		return nil, err
+	}
+	newBlock, sectionSize, err := gostCipherFor(scheme.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+	n := block.BlockSize()
+	if len(params.UKM) < n/2 {
+		return nil, errors.New("pkcs12: GOST UKM is too short")
+	}
+
+	// The counter starts as the IV followed by zeros, and is incremented
+	// as an n-bit integer across sections.
+	ctr := make([]byte, n)
+	copy(ctr, params.UKM[:n/2])
+	keystream := make([]byte, n)
+	if cap(dst) < len(encrypted) {
+		dst = make([]byte, len(encrypted))
+	}
+	decrypted := dst[:len(encrypted)]
+	for off := 0; off < len(encrypted); off += n {
+		if off > 0 && off%sectionSize == 0 {
+			if block, err = acpkm(block, newBlock); err != nil {
+				return nil, err
+			}
+		}
+		block.Encrypt(keystream, ctr)
+		for i := n - 1; i >= 0; i-- {
+			ctr[i]++
+			if ctr[i] != 0 {
+				break
+			}
+		}
+		subtle.XORBytes(decrypted[off:], encrypted[off:], keystream)
+	}
+	return decrypted, nil
+}
+
+// acpkmConstant is D of RFC 8645, section 4.1, for 256-bit keys.
+var acpkmConstant = []byte{
+	0x80, 0x81, 0x82, 0x83, 0x84, 0x85, 0x86, 0x87, 0x88, 0x89, 0x8a, 0x8b, 0x8c, 0x8d, 0x8e, 0x8f,
+	0x90, 0x91, 0x92, 0x93, 0x94, 0x95, 0x96, 0x97, 0x98, 0x99, 0x9a, 0x9b, 0x9c, 0x9d, 0x9e, 0x9f,
+}
+
+// acpkm returns the block cipher keyed with the next section key of
+// RFC 8645, section 4.1: the encryption of acpkmConstant with block.
+func acpkm(block cipher.Block, newBlock func([]byte) (cipher.Block, error)) (cipher.Block, error) {
+	key := make([]byte, len(acpkmConstant))
+	for i := 0; i < len(key); i += block.BlockSize() {
+		block.Encrypt(key[i:], acpkmConstant[i:])
+	}
+	return newBlock(key)
+}
+
+// gostMACKeyDerivationSize is the length of the PBKDF2 output of which the
+// last 32 bytes key the MAC of an RFC 9548 file.
+const gostMACKeyDerivationSize = 96
+
+// gostMACFor returns the MAC of message as specified by macData according
+// to RFC 9548, section 5: HMAC-Streebog-512 keyed with the last 32 bytes
+// of 96 derived from the UTF-8 password by PBKDF2 with the same HMAC.
+// password is the BMPString encoding, as for macFor.
+func gostMACFor(macData *macData, message, password []byte, m *kdfMonitor) ([]byte, error) {
+	newHash, err := gostHash()
+	if err != nil {
+		return nil, err
+	}
+	utf8Password, err := decodeBMPString(password)
+	if err != nil {
+		return nil, err
+	}
+	key := pbkdf2Key(newHash, []byte(utf8Password), macData.MacSalt, macData.Iterations, gostMACKeyDerivationSize, m)
+	if err := m.err(); err != nil {
+		return nil, err
+	}
+
+	mac := hmac.New(newHash, key[gostMACKeyDerivationSize-32:])
+	mac.Write(message)
+	return mac.Sum(nil), nil
+}
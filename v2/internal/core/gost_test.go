@@ -0,0 +1,141 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha512"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"testing"
+)
+
+// registerTestGOST registers stand-ins for the GOST primitives, which are
+// not available in the standard library, for the duration of t.
+func registerTestGOST(t *testing.T) {
+	previous := gostAlgorithms.Load()
+	t.Cleanup(func() { gostAlgorithms.Store(previous) })
+	RegisterGOST(GOST{
+		Streebog512: sha512.New,
+		Kuznyechik:  aes.NewCipher,
+	})
+}
+
+func TestGOSTMAC(t *testing.T) {
+	key, cert := newTestCertificate(t, "www.example.com", nil, nil)
+	pfxData, err := Encode(rand.Reader, key, cert, nil, "pässwörd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pfx pfxPdu
+	if err := unmarshal(pfxData, &pfx); err != nil {
+		t.Fatal(err)
+	}
+	content, _, err := authSafeContent(&pfx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pfx.MacData.Mac.Algorithm.Algorithm = oidStreebog512
+	encodedPassword, _ := bmpString("pässwörd")
+
+	if err := computeMac(&pfx.MacData, content, encodedPassword, nil); err == nil {
+		t.Fatal("computed a GOST MAC without a registered implementation")
+	} else if _, ok := err.(NotImplementedError); !ok {
+		t.Fatalf("got error %v without a registered implementation, want a NotImplementedError", err)
+	}
+
+	registerTestGOST(t)
+	if err := computeMac(&pfx.MacData, content, encodedPassword, nil); err != nil {
+		t.Fatal(err)
+	}
+	derived, err := pbkdf2.Key(sha512.New, "pässwörd", pfx.MacData.MacSalt, pfx.MacData.Iterations, 96)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mac := hmac.New(sha512.New, derived[64:])
+	mac.Write(content)
+	if !bytes.Equal(pfx.MacData.Mac.Digest, mac.Sum(nil)) {
+		t.Fatal("MAC is not keyed with the last 32 bytes of the PBKDF2 output")
+	}
+
+	gostData, err := asn1.Marshal(pfx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := Decode(gostData, "pässwörd"); err != nil {
+		t.Error(err)
+	}
+	if _, _, err := Decode(gostData, "password"); err != ErrIncorrectPassword {
+		t.Errorf("got error %v for the wrong password, want ErrIncorrectPassword", err)
+	}
+}
+
+func TestGOSTCTRACPKM(t *testing.T) {
+	registerTestGOST(t)
+
+	// Three sections, the last of them partial, so that the key changes
+	// twice.
+	const sectionSize = 4096
+	plaintext := make([]byte, 2*sectionSize+5)
+	rand.Read(plaintext)
+	salt, ukm := make([]byte, 32), make([]byte, 16)
+	rand.Read(salt)
+	rand.Read(ukm)
+
+	key, err := pbkdf2.Key(sha512.New, "password", salt, 2000, 32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ciphertext := make([]byte, len(plaintext))
+	counter := append(append([]byte{}, ukm[:8]...), make([]byte, 8)...)
+	for off := 0; off < len(plaintext); off += sectionSize {
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stream := cipher.NewCTR(block, counter)
+		skip := make([]byte, off)
+		stream.XORKeyStream(skip, skip)
+		end := min(off+sectionSize, len(plaintext))
+		stream.XORKeyStream(ciphertext[off:end], plaintext[off:end])
+
+		next := make([]byte, 32)
+		block.Encrypt(next, acpkmConstant)
+		block.Encrypt(next[16:], acpkmConstant[16:])
+		key = next
+	}
+
+	kdfParams, _ := asn1.Marshal(pbkdf2Params{
+		Salt:           salt,
+		IterationCount: 2000,
+		KeyLength:      32,
+		PRF:            pkix.AlgorithmIdentifier{Algorithm: oidHmacWithStreebog512, Parameters: asn1.NullRawValue},
+	})
+	schemeParams, _ := asn1.Marshal(gost3412Params{UKM: ukm})
+	params, _ := asn1.Marshal(pbes2Params{
+		KeyDerivationFunc: pkix.AlgorithmIdentifier{Algorithm: oidPBKDF2, Parameters: asn1.RawValue{FullBytes: kdfParams}},
+		EncryptionScheme:  pkix.AlgorithmIdentifier{Algorithm: oidKuznyechikCTRACPKM, Parameters: asn1.RawValue{FullBytes: schemeParams}},
+	})
+	encodedPassword, _ := bmpString("password")
+	decrypted, err := pbes2Decrypt(nil, pkix.AlgorithmIdentifier{Algorithm: oidPBES2, Parameters: asn1.RawValue{FullBytes: params}}, ciphertext, encodedPassword, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decrypted, plaintext) {
+		t.Error("CTR-ACPKM decryption does not match")
+	}
+
+	RegisterGOST(GOST{Streebog512: sha512.New})
+	if _, err := pbes2Decrypt(nil, pkix.AlgorithmIdentifier{Algorithm: oidPBES2, Parameters: asn1.RawValue{FullBytes: params}}, ciphertext, encodedPassword, nil); err == nil {
+		t.Error("decrypted with Kuznyechik unregistered")
+	} else if _, ok := err.(NotImplementedError); !ok {
+		t.Errorf("got error %v with Kuznyechik unregistered, want a NotImplementedError", err)
+	}
+}
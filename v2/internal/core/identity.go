@@ -0,0 +1,77 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// LoadTLSClientIdentity reads the PKCS#12 file at path and returns its
+// identity as a tls.Certificate, ready for use in tls.Config.Certificates.
+// The private key must match the end-entity certificate and the certificate
+// must currently be valid; any CA certificates in the file are included in
+// the chain presented to servers.
+func LoadTLSClientIdentity(path, password string) (tls.Certificate, error) {
+	cert, err := loadValidTLSCertificate(path, password)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return *cert, nil
+}
+
+// SaveTLSServerIdentity encodes cert, including its chain, and writes it to
+// path with permissions 0600, replacing any existing file atomically.  It
+// uses DefaultEncoder at the strongest compatibility level and entropy from
+// crypto/rand.
+func SaveTLSServerIdentity(path string, cert tls.Certificate, password string) error {
+	return DefaultEncoder.WithCompatibilityLevel(2024).SaveTLSServerIdentity(rand.Reader, path, cert, password)
+}
+
+// SaveTLSServerIdentity is like the package-level SaveTLSServerIdentity
+// function, but uses the options of enc and the entropy of rand.
+func (enc *Encoder) SaveTLSServerIdentity(rand io.Reader, path string, cert tls.Certificate, password string) error {
+	pfxData, err := enc.EncodeTLSCertificate(rand, cert, password, nil)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".pkcs12-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(pfxData); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// LoadTrustBundle reads the PKCS#12 file at path and returns a pool
+// containing every certificate in it.  Private keys, if any, are ignored.
+func LoadTrustBundle(path, password string) (*x509.CertPool, error) {
+	pfxData, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.New("pkcs12: error reading " + path + ": " + err.Error())
+	}
+	certBags, err := DecodeCertBags(pfxData, password)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	for _, certBag := range certBags {
+		pool.AddCert(certBag.Certificate)
+	}
+	return pool, nil
+}
@@ -0,0 +1,52 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTLSIdentityRoundTrip(t *testing.T) {
+	rootKey, root := newTestCertificate(t, "root", nil, nil)
+	key, leaf := newTestCertificate(t, "server.example.com", root, rootKey)
+	path := filepath.Join(t.TempDir(), "server.p12")
+
+	err := SaveTLSServerIdentity(path, tls.Certificate{
+		Certificate: [][]byte{leaf.Raw, root.Raw},
+		PrivateKey:  key,
+	}, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(path); err != nil {
+		t.Fatal(err)
+	} else if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("got permissions %o, want 600", perm)
+	}
+
+	cert, err := LoadTLSClientIdentity(path, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cert.Leaf.Equal(leaf) || len(cert.Certificate) != 2 {
+		t.Errorf("unexpected identity %v", cert)
+	}
+
+	pool, err := LoadTrustBundle(path, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := leaf.Verify(x509.VerifyOptions{Roots: pool}); err != nil {
+		t.Errorf("leaf does not verify against trust bundle: %v", err)
+	}
+
+	if _, err := LoadTLSClientIdentity(path, "wrong"); err != ErrIncorrectPassword {
+		t.Errorf("got error %v, want ErrIncorrectPassword", err)
+	}
+}
@@ -0,0 +1,135 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"crypto/x509"
+	"errors"
+)
+
+// Integrity is a set of integrity mechanisms of a PKCS#12 file which were
+// verified, as reported by VerifyIntegrity.
+type Integrity int
+
+const (
+	// PasswordIntegrity means that the password-based MAC was verified.
+	PasswordIntegrity Integrity = 1 << iota
+
+	// PublicKeyIntegrity means that the signature of a file in
+	// public-key integrity mode was verified against the Decoder's
+	// verifier certificate.
+	PublicKeyIntegrity
+)
+
+// WithIntegrityVerifier returns a copy of dec which verifies the signature
+// of files in public-key integrity mode, whose AuthenticatedSafe is signed
+// rather than (or as well as) protected with a MAC, using the public key
+// of verifier.  Files which are not signed are then rejected with
+// ErrMissingSignature, even if their MAC is valid, so that a successful
+// decode always means that the signature was verified.  Without a
+// verifier, signed files can only be decoded if they also carry a
+// password-based MAC, which is then verified instead.
+func (dec Decoder) WithIntegrityVerifier(verifier *x509.Certificate) *Decoder {
+	dec.verifier = verifier
+	return &dec
+}
+
+// VerifyIntegrity verifies the integrity of pfxData using DefaultDecoder
+// and reports which mechanisms were checked.  The password-based MAC is
+// verified whenever pfxData has one; a signature is verified only if the
+// Decoder has a verifier certificate, and is then required.
+func VerifyIntegrity(pfxData []byte, password string) (Integrity, error) {
+	return DefaultDecoder.VerifyIntegrity(pfxData, password)
+}
+
+// VerifyIntegrity is like the package-level VerifyIntegrity function, but
+// uses the options of dec.
+func (dec *Decoder) VerifyIntegrity(pfxData []byte, password string) (Integrity, error) {
+	encodedPassword, err := bmpString(password)
+	if err != nil {
+		return 0, ErrIncorrectPassword
+	}
+	pfx := new(pfxPdu)
+	if err := dec.unmarshalPFX(pfxData, pfx); err != nil {
+		return 0, errors.New("pkcs12: error reading P12 data: " + err.Error())
+	}
+	if pfx.Version != 3 {
+		return 0, NotImplementedError("can only decode v3 PFX PDU's")
+	}
+	_, _, checked, err := dec.verifyIntegrity(pfx, encodedPassword)
+	return checked, err
+}
+
+// verifyIntegrity verifies the MAC and/or signature of pfx, and returns the
+// encoded AuthenticatedSafe together with the password, which is updated if
+// the MAC could only be verified using the empty-password fallback.
+func (dec *Decoder) verifyIntegrity(pfx *pfxPdu, password []byte) (content, updatedPassword []byte, checked Integrity, err error) {
+	content, signed, err := authSafeContent(pfx)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+
+	if len(pfx.MacData.Mac.Algorithm.Algorithm) != 0 {
+		if err := dec.checkIterations("MAC", pfx.MacData.Iterations); err != nil {
+			return nil, nil, 0, err
+		}
+		if err := verifyMac(&pfx.MacData, content, password, dec.monitor()); err != nil {
+			if err == ErrIncorrectPassword && len(password) == 2 && password[0] == 0 && password[1] == 0 {
+				// some implementations use an empty byte array
+				// for the empty string password try one more
+				// time with empty-empty password
+				password = nil
+				err = verifyMac(&pfx.MacData, content, password, dec.monitor())
+			}
+			if err != nil {
+				return nil, nil, 0, err
+			}
+		}
+		checked |= PasswordIntegrity
+	}
+
+	if dec.verifier != nil {
+		if signed == nil {
+			return nil, nil, 0, ErrMissingSignature
+		}
+		if err := signed.verify(content, dec.verifier); err != nil {
+			return nil, nil, 0, err
+		}
+		checked |= PublicKeyIntegrity
+	}
+
+	if checked == 0 {
+		if signed != nil {
+			return nil, nil, 0, errors.New("pkcs12: signed data has no MAC and the Decoder has no verifier certificate")
+		}
+		if !dec.allowMissingMAC {
+			return nil, nil, 0, errors.New("pkcs12: no MAC in data")
+		}
+	}
+	return content, password, checked, nil
+}
+
+// authSafeContent returns the encoded AuthenticatedSafe of pfx without
+// verifying it, together with the SignedData holding it in public-key
+// integrity mode.
+func authSafeContent(pfx *pfxPdu) (content []byte, signed *signedData, err error) {
+	switch {
+	case pfx.AuthSafe.ContentType.Equal(oidDataContentType):
+		if err := unmarshal(pfx.AuthSafe.Content.Bytes, &content); err != nil {
+			return nil, nil, err
+		}
+	case pfx.AuthSafe.ContentType.Equal(oidSignedDataContentType):
+		signed = new(signedData)
+		if err := unmarshal(pfx.AuthSafe.Content.Bytes, signed); err != nil {
+			return nil, nil, errors.New("pkcs12: error reading signed data: " + err.Error())
+		}
+		if content, err = signed.content(); err != nil {
+			return nil, nil, err
+		}
+	default:
+		return nil, nil, NotImplementedError("only password and public-key integrity modes are implemented")
+	}
+	return content, signed, nil
+}
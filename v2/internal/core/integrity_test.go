@@ -0,0 +1,131 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"testing"
+)
+
+// signPFX converts pfxData to public-key integrity mode by signing its
+// AuthenticatedSafe with signerKey, keeping the password-based MAC only if
+// keepMAC is true.
+func signPFX(t *testing.T, pfxData []byte, signerKey *ecdsa.PrivateKey, signer *x509.Certificate, keepMAC bool) []byte {
+	var pfx pfxPdu
+	if err := unmarshal(pfxData, &pfx); err != nil {
+		t.Fatal(err)
+	}
+	var content []byte
+	if err := unmarshal(pfx.AuthSafe.Content.Bytes, &content); err != nil {
+		t.Fatal(err)
+	}
+
+	marshal := func(v interface{}) []byte {
+		b, err := asn1.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+	digest := sha256.Sum256(content)
+	attrs := append(
+		marshal(pkcs12Attribute{Id: oidContentTypeAttribute, Value: asn1.RawValue{Tag: 17, IsCompound: true, Bytes: marshal(oidDataContentType)}}),
+		marshal(pkcs12Attribute{Id: oidMessageDigestAttribute, Value: asn1.RawValue{Tag: 17, IsCompound: true, Bytes: marshal(digest[:])}})...)
+	signedAttrs := marshal(asn1.RawValue{Tag: 17, IsCompound: true, Bytes: attrs})
+	attrsDigest := sha256.Sum256(signedAttrs)
+	signature, err := ecdsa.SignASN1(rand.Reader, signerKey, attrsDigest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sd := signedData{
+		Version:          1,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{{Algorithm: oidSHA256}},
+		ContentInfo: contentInfo{
+			ContentType: oidDataContentType,
+			Content:     asn1.RawValue{Class: 2, Tag: 0, IsCompound: true, Bytes: marshal(content)},
+		},
+		SignerInfos: []signerInfo{{
+			Version: 1,
+			SID: asn1.RawValue{FullBytes: marshal(struct {
+				Issuer asn1.RawValue
+				Serial *big.Int
+			}{asn1.RawValue{FullBytes: signer.RawIssuer}, signer.SerialNumber})},
+			DigestAlgorithm:    pkix.AlgorithmIdentifier{Algorithm: oidSHA256},
+			SignedAttrs:        asn1.RawValue{Class: 2, Tag: 0, IsCompound: true, Bytes: attrs},
+			SignatureAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidECDSAWithSHA256},
+			Signature:          signature,
+		}},
+	}
+	pfx.AuthSafe = contentInfo{
+		ContentType: oidSignedDataContentType,
+		Content:     asn1.RawValue{Class: 2, Tag: 0, IsCompound: true, Bytes: marshal(sd)},
+	}
+	if !keepMAC {
+		pfx.MacData = macData{}
+	}
+	return marshal(pfx)
+}
+
+func TestIntegrityModes(t *testing.T) {
+	key, leaf := newTestCertificate(t, "signed.example.com", nil, nil)
+	signerKey, signer := newTestCertificate(t, "Signer", nil, nil)
+	_, otherSigner := newTestCertificate(t, "Other Signer", nil, nil)
+	pfxData, err := Encode(rand.Reader, key, leaf, nil, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dual := signPFX(t, pfxData, signerKey, signer, true)
+	signedOnly := signPFX(t, pfxData, signerKey, signer, false)
+
+	withVerifier := DefaultDecoder.WithIntegrityVerifier(signer)
+	for _, test := range []struct {
+		name    string
+		dec     *Decoder
+		pfxData []byte
+		want    Integrity
+	}{
+		{"password", DefaultDecoder, pfxData, PasswordIntegrity},
+		{"dual", DefaultDecoder, dual, PasswordIntegrity},
+		{"dual with verifier", withVerifier, dual, PasswordIntegrity | PublicKeyIntegrity},
+		{"signed with verifier", withVerifier, signedOnly, PublicKeyIntegrity},
+	} {
+		checked, err := test.dec.VerifyIntegrity(test.pfxData, "password")
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if checked != test.want {
+			t.Errorf("%s: checked %b, want %b", test.name, checked, test.want)
+		}
+		if _, certificate, err := test.dec.DecodeChain(test.pfxData, "password"); err != nil {
+			t.Errorf("%s: DecodeChain: %v", test.name, err)
+		} else if !certificate.Equal(leaf) {
+			t.Errorf("%s: DecodeChain returned wrong certificate", test.name)
+		}
+	}
+
+	if _, err := withVerifier.VerifyIntegrity(pfxData, "password"); err != ErrMissingSignature {
+		t.Errorf("MAC-only file with a verifier: got error %v, want ErrMissingSignature", err)
+	}
+	if _, _, err := withVerifier.Decode(pfxData, "password"); err != ErrMissingSignature {
+		t.Errorf("MAC-only file with a verifier: Decode returned %v, want ErrMissingSignature", err)
+	}
+	if _, err := VerifyIntegrity(signedOnly, "password"); err == nil {
+		t.Error("signed file without MAC was accepted without a verifier")
+	}
+	if _, err := DefaultDecoder.WithIntegrityVerifier(otherSigner).VerifyIntegrity(dual, "password"); err == nil {
+		t.Error("signature was accepted with the wrong verifier")
+	}
+	if _, err := withVerifier.VerifyIntegrity(dual, "wrong"); err != ErrIncorrectPassword {
+		t.Errorf("got error %v, want ErrIncorrectPassword", err)
+	}
+}
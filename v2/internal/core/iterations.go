@@ -0,0 +1,61 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import "crypto/x509/pkix"
+
+// WithMinIterations returns a copy of dec which rejects files whose MAC,
+// content encryption or key encryption derives its key with fewer than
+// min iterations of the PKCS#12 KDF, PBKDF2 or PKCS#5 v1.5 PBKDF1, with an
+// *IterationsError.  This enforces an organizational floor on inbound
+// credentials, such as the 10,000 iterations of OpenSSL 3.  Keys derived
+// with scrypt are not subject to the floor, whose cost is set by memory
+// rather than by iterations.
+//
+// Even without this option, a count of zero iterations is rejected.
+// WithAllowInsecure disables both checks.
+func (dec Decoder) WithMinIterations(min int) *Decoder {
+	dec.minIterations = min
+	return &dec
+}
+
+// checkIterations returns an *IterationsError if what, a key derivation,
+// uses fewer iterations than dec accepts.
+func (dec *Decoder) checkIterations(what string, iterations int) error {
+	if dec.allowInsecure {
+		return nil
+	}
+	min := dec.minIterations
+	if min < 1 {
+		min = 1
+	}
+	if iterations < min {
+		return &IterationsError{What: what, Iterations: iterations, Minimum: min}
+	}
+	return nil
+}
+
+// checkPBEIterations is checkIterations for the key derivation of the
+// password-based encryption algorithm.  Parameters which cannot be parsed
+// are left for the decryption to report.
+func (dec *Decoder) checkPBEIterations(what string, algorithm pkix.AlgorithmIdentifier) error {
+	if dec.allowInsecure {
+		return nil
+	}
+	if algorithm.Algorithm.Equal(oidPBES2) {
+		var params pbes2Params
+		if err := unmarshal(algorithm.Parameters.FullBytes, &params); err != nil {
+			return nil
+		}
+		if params.KeyDerivationFunc.Algorithm.Equal(oidScrypt) {
+			return nil
+		}
+	}
+	iterations, err := pbeIterations(algorithm)
+	if err != nil {
+		return nil
+	}
+	return dec.checkIterations(what, iterations)
+}
@@ -0,0 +1,60 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"crypto"
+	"crypto/rand"
+	"testing"
+)
+
+func TestWithMinIterations(t *testing.T) {
+	key, cert := newTestCertificate(t, "www.example.com", nil, nil)
+	pfxData, err := Modern.Encode(rand.Reader, key, cert, nil, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	strongMAC, err := Modern.WithMAC(crypto.SHA256, 10000).Encode(rand.Reader, key, cert, nil, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	scrypt, err := Modern.WithMAC(crypto.SHA256, 10000).WithScrypt(1<<10, 8, 1).Encode(rand.Reader, key, cert, nil, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		name    string
+		dec     *Decoder
+		pfxData []byte
+		what    string
+	}{
+		{"at the floor", DefaultDecoder.WithMinIterations(2048), pfxData, ""},
+		{"weak MAC", DefaultDecoder.WithMinIterations(10000), pfxData, "MAC"},
+		{"weak encryption", DefaultDecoder.WithMinIterations(10000), strongMAC, "content encryption"},
+		{"insecure allowed", DefaultDecoder.WithMinIterations(10000).WithAllowInsecure(true), pfxData, ""},
+		{"scrypt", DefaultDecoder.WithMinIterations(10000), scrypt, ""},
+	} {
+		_, _, err := test.dec.Decode(test.pfxData, "password")
+		if test.what == "" {
+			if err != nil {
+				t.Errorf("%s: %v", test.name, err)
+			}
+			continue
+		}
+		iterErr, ok := err.(*IterationsError)
+		if !ok {
+			t.Errorf("%s: got error %v, want an *IterationsError", test.name, err)
+			continue
+		}
+		if iterErr.What != test.what || iterErr.Iterations != 2048 || iterErr.Minimum != 10000 {
+			t.Errorf("%s: got %+v", test.name, iterErr)
+		}
+	}
+
+	if err := DefaultDecoder.checkIterations("MAC", 0); err == nil {
+		t.Error("accepted zero iterations without a floor")
+	}
+}
@@ -0,0 +1,100 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"errors"
+	"strconv"
+)
+
+// A KDFPurpose identifies what the key material returned by a KDF is used
+// for.  Its values are the ID bytes of the PKCS#12 key derivation function
+// (RFC 7292, appendix B.3).
+type KDFPurpose int
+
+const (
+	// EncryptionKeyPurpose is the key of an encryption algorithm: a
+	// PKCS#12 algorithm or the encryption scheme of PBES2.
+	EncryptionKeyPurpose KDFPurpose = 1
+
+	// IVPurpose is the IV of a PKCS#12 encryption algorithm.
+	IVPurpose KDFPurpose = 2
+
+	// MACKeyPurpose is the key of the HMAC which authenticates the file.
+	MACKeyPurpose KDFPurpose = 3
+)
+
+func (p KDFPurpose) String() string {
+	switch p {
+	case EncryptionKeyPurpose:
+		return "encryption key"
+	case IVPurpose:
+		return "IV"
+	case MACKeyPurpose:
+		return "MAC key"
+	default:
+		return "unknown purpose"
+	}
+}
+
+// A KDF derives the keys of an Encoder or Decoder configured with
+// WithKDF, in place of the key derivation functions of the file, so that
+// an organization can route key derivation through an HSM or KMS which
+// combines a secret it holds with the password.  A KDF is given the salt
+// and iteration count recorded in the file but not the password, which an
+// implementation that needs it must obtain itself, for instance when it is
+// constructed.  Its implementations must be safe for concurrent use.
+type KDF interface {
+	// Derive returns length bytes of key material for purpose.
+	Derive(salt []byte, iterations int, purpose KDFPurpose, length int) ([]byte, error)
+}
+
+// WithKDF returns a copy of enc which derives its keys with kdf.  It
+// replaces the PKCS#12 key derivation function, used by the MAC and the
+// PKCS#12 encryption algorithms, and PBKDF2, used by PBES2; other key
+// derivation functions, such as scrypt, PBKDF1 and that of the GOST MAC,
+// are unaffected.  The file records the usual algorithms, salts and
+// iteration counts, but it can only be decoded by a Decoder with the same
+// KDF.  A nil kdf restores the built-in functions.
+func (enc Encoder) WithKDF(kdf KDF) *Encoder {
+	enc.externalKDF = kdf
+	return &enc
+}
+
+// WithKDF returns a copy of dec which derives its keys with kdf.  See
+// Encoder.WithKDF.
+func (dec Decoder) WithKDF(kdf KDF) *Decoder {
+	dec.externalKDF = kdf
+	return &dec
+}
+
+// withoutKDF returns a copy of m without its external KDF, for the key
+// derivations of formats other than PKCS#12, such as BCFKS.
+func (m *kdfMonitor) withoutKDF() *kdfMonitor {
+	if m == nil || m.kdf == nil {
+		return m
+	}
+	withoutKDF := *m
+	withoutKDF.kdf = nil
+	return &withoutKDF
+}
+
+// derive returns the key material of the external KDF of m, or nil if it
+// fails or the derivation has already been abandoned, in which case err
+// returns the reason.
+func (m *kdfMonitor) derive(salt []byte, iterations int, purpose KDFPurpose, length int) []byte {
+	if m.cancelled != nil {
+		return nil
+	}
+	key, err := m.kdf.Derive(salt, iterations, purpose, length)
+	if err == nil && len(key) != length {
+		err = errors.New("pkcs12: KDF returned " + strconv.Itoa(len(key)) + " bytes of key material, want " + strconv.Itoa(length))
+	}
+	if err != nil {
+		m.cancelled = err
+		return nil
+	}
+	return key
+}
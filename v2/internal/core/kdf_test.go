@@ -0,0 +1,85 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+// secretKDF stands in for a KDF backed by an HSM: it derives keys from a
+// secret it holds, combined with the salt, iteration count and purpose.
+type secretKDF struct {
+	secret   []byte
+	purposes map[KDFPurpose]bool
+}
+
+func (kdf *secretKDF) Derive(salt []byte, iterations int, purpose KDFPurpose, length int) ([]byte, error) {
+	if kdf.purposes != nil {
+		kdf.purposes[purpose] = true
+	}
+	info := binary.BigEndian.AppendUint32(nil, uint32(iterations))
+	info = append(info, byte(purpose))
+	return hkdf.Key(sha256.New, kdf.secret, salt, string(info), length)
+}
+
+type failingKDF struct{}
+
+var errKDFUnavailable = errors.New("HSM unavailable")
+
+func (failingKDF) Derive(salt []byte, iterations int, purpose KDFPurpose, length int) ([]byte, error) {
+	return nil, errKDFUnavailable
+}
+
+func TestKDF(t *testing.T) {
+	key, cert := newTestCertificate(t, "www.example.com", nil, nil)
+	for _, test := range []struct {
+		name     string
+		enc      *Encoder
+		purposes []KDFPurpose
+	}{
+		{"DefaultEncoder", DefaultEncoder, []KDFPurpose{EncryptionKeyPurpose, IVPurpose, MACKeyPurpose}},
+		{"Modern", Modern, []KDFPurpose{EncryptionKeyPurpose, MACKeyPurpose}},
+	} {
+		kdf := &secretKDF{secret: []byte("HSM secret"), purposes: make(map[KDFPurpose]bool)}
+		pfxData, err := test.enc.WithKDF(kdf).Encode(rand.Reader, key, cert, nil, "password")
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		for _, purpose := range test.purposes {
+			if !kdf.purposes[purpose] {
+				t.Errorf("%s: KDF not used for the %v", test.name, purpose)
+			}
+		}
+		if len(kdf.purposes) != len(test.purposes) {
+			t.Errorf("%s: KDF used for %d purposes, want %d", test.name, len(kdf.purposes), len(test.purposes))
+		}
+
+		privateKey, certificate, err := DefaultDecoder.WithKDF(&secretKDF{secret: []byte("HSM secret")}).Decode(pfxData, "password")
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if !key.Equal(privateKey) || !certificate.Equal(cert) {
+			t.Errorf("%s: decoded identity does not match", test.name)
+		}
+		if _, _, err := Decode(pfxData, "password"); err != ErrIncorrectPassword {
+			t.Errorf("%s: got error %v without the KDF, want ErrIncorrectPassword", test.name, err)
+		}
+		if _, _, err := DefaultDecoder.WithKDF(&secretKDF{secret: []byte("other secret")}).Decode(pfxData, "password"); err != ErrIncorrectPassword {
+			t.Errorf("%s: got error %v with another secret, want ErrIncorrectPassword", test.name, err)
+		}
+		if _, _, err := DefaultDecoder.WithKDF(failingKDF{}).Decode(pfxData, "password"); err != errKDFUnavailable {
+			t.Errorf("%s: got error %v from a failing KDF, want %v", test.name, err, errKDFUnavailable)
+		}
+	}
+
+	if _, err := Modern.WithKDF(failingKDF{}).Encode(rand.Reader, key, cert, nil, "password"); err != errKDFUnavailable {
+		t.Errorf("got error %v from a failing KDF, want %v", err, errKDFUnavailable)
+	}
+}
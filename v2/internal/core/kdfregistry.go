@@ -0,0 +1,69 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"encoding/asn1"
+	"io"
+	"sync"
+
+	"github.com/scholar-ink/go-pkcs12/v2/oids"
+)
+
+// A KeyDerivationFunction is a PBES2 key derivation function which is not
+// built into this package, such as Argon2id under a private object
+// identifier, for files which are only produced and read by applications
+// that register it.  Its implementations must be safe for concurrent use.
+type KeyDerivationFunction interface {
+	// NewParameters returns the DER encoding of the parameters of the
+	// AlgorithmIdentifier of a new derivation, reading any salt from
+	// rand.
+	NewParameters(rand io.Reader) ([]byte, error)
+
+	// DeriveKey returns a key of keyLen bytes derived from password, the
+	// UTF-8 encoding of the password, with the DER-encoded parameters
+	// params read from a file.
+	DeriveKey(password, params []byte, keyLen int) ([]byte, error)
+}
+
+var (
+	keyDerivationFunctionsMu sync.RWMutex
+	keyDerivationFunctions   = make(map[string]KeyDerivationFunction)
+)
+
+// RegisterKeyDerivationFunction makes kdf available to every Decoder, and
+// to Encoders configured with WithKeyDerivationFunction, as the PBES2 key
+// derivation function identified by oid, replacing any registered before.
+// PBKDF2 and scrypt are built in and cannot be replaced.  It is intended to
+// be called during program initialization.
+func RegisterKeyDerivationFunction(oid asn1.ObjectIdentifier, kdf KeyDerivationFunction) {
+	keyDerivationFunctionsMu.Lock()
+	defer keyDerivationFunctionsMu.Unlock()
+	keyDerivationFunctions[oid.String()] = kdf
+}
+
+// registeredKeyDerivationFunction returns the KeyDerivationFunction
+// registered for oid.
+func registeredKeyDerivationFunction(oid asn1.ObjectIdentifier) (KeyDerivationFunction, error) {
+	keyDerivationFunctionsMu.RLock()
+	defer keyDerivationFunctionsMu.RUnlock()
+	kdf, ok := keyDerivationFunctions[oid.String()]
+	if !ok || kdf == nil {
+		return nil, NotImplementedError("key derivation function " + oids.Describe(oid) + " is not supported")
+	}
+	return kdf, nil
+}
+
+// WithKeyDerivationFunction returns a copy of enc whose PBES2 algorithms
+// derive their keys with the KeyDerivationFunction registered for oid,
+// rather than with PBKDF2 or scrypt.  Encoding fails with a
+// NotImplementedError if none is registered.  The iteration count of enc
+// then has no effect on PBES2; the parameters are chosen by the
+// KeyDerivationFunction.  Like WithScrypt, it is meant to be used with
+// Modern.
+func (enc Encoder) WithKeyDerivationFunction(oid asn1.ObjectIdentifier) *Encoder {
+	enc.kdf = oid
+	return &enc
+}
@@ -0,0 +1,81 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/asn1"
+	"io"
+	"testing"
+)
+
+// hkdfKDF stands in for a KeyDerivationFunction such as Argon2id, which is
+// not in the standard library.  Its parameters are a SEQUENCE holding the
+// salt.
+type hkdfKDF struct{}
+
+type hkdfParams struct {
+	Salt []byte
+}
+
+func (hkdfKDF) NewParameters(rand io.Reader) ([]byte, error) {
+	salt := make([]byte, 16)
+	if _, err := io.ReadFull(rand, salt); err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(hkdfParams{Salt: salt})
+}
+
+func (hkdfKDF) DeriveKey(password, params []byte, keyLen int) ([]byte, error) {
+	var p hkdfParams
+	if _, err := asn1.Unmarshal(params, &p); err != nil {
+		return nil, err
+	}
+	return hkdf.Key(sha256.New, password, p.Salt, "", keyLen)
+}
+
+func TestKeyDerivationFunction(t *testing.T) {
+	oidHKDF := asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 99999, 1}
+	key, cert := newTestCertificate(t, "www.example.com", nil, nil)
+	enc := Modern.WithKeyDerivationFunction(oidHKDF)
+
+	if _, err := enc.Encode(rand.Reader, key, cert, nil, "password"); err == nil {
+		t.Fatal("encoded with an unregistered key derivation function")
+	} else if _, ok := err.(NotImplementedError); !ok {
+		t.Fatalf("got error %v for an unregistered key derivation function, want a NotImplementedError", err)
+	}
+
+	RegisterKeyDerivationFunction(oidHKDF, hkdfKDF{})
+	pfxData, err := enc.Encode(rand.Reader, key, cert, nil, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	privateKey, certificate, err := Decode(pfxData, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !key.Equal(privateKey) || !certificate.Equal(cert) {
+		t.Error("decoded identity does not match")
+	}
+	if _, _, err := Decode(pfxData, "wrong"); err != ErrIncorrectPassword {
+		t.Errorf("got error %v for the wrong password, want ErrIncorrectPassword", err)
+	}
+	if _, err := InspectProtection(pfxData, "password"); err == nil {
+		t.Error("inspected a file with a registered key derivation function")
+	} else if _, ok := err.(NotImplementedError); ok {
+		t.Errorf("got NotImplementedError %v for a registered key derivation function", err)
+	}
+
+	keyDerivationFunctionsMu.Lock()
+	delete(keyDerivationFunctions, oidHKDF.String())
+	keyDerivationFunctionsMu.Unlock()
+	if _, _, err := Decode(pfxData, "password"); err == nil {
+		t.Error("decoded with an unregistered key derivation function")
+	} else if _, ok := err.(NotImplementedError); !ok {
+		t.Errorf("got error %v for an unregistered key derivation function, want a NotImplementedError", err)
+	}
+}
@@ -0,0 +1,98 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"crypto"
+	"encoding/asn1"
+	"errors"
+)
+
+// A KeyIDPolicy specifies how a Decoder handles private key bags which
+// share a localKeyId, as some buggy exporters produce.  Such a file does
+// not say which key belongs to which certificate.  Key bags without a
+// localKeyId never share one.
+type KeyIDPolicy int
+
+const (
+	// RejectDuplicateKeyIDs fails decoding with ErrDuplicateKeyID.  It
+	// is the default.
+	RejectDuplicateKeyIDs KeyIDPolicy = iota
+
+	// FirstDuplicateKeyID keeps only the first key bag with each
+	// localKeyId.
+	FirstDuplicateKeyID
+
+	// KeepDuplicateKeyIDs keeps every key bag.  DecodeKeys marks keys
+	// which share a localKeyId as Ambiguous; the functions which return a
+	// single key still require the file to contain exactly one.
+	KeepDuplicateKeyIDs
+)
+
+// WithDuplicateKeyIDs returns a copy of dec which handles private key bags
+// sharing a localKeyId according to policy.
+func (dec Decoder) WithDuplicateKeyIDs(policy KeyIDPolicy) *Decoder {
+	dec.duplicateKeyIDs = policy
+	return &dec
+}
+
+// A KeyEntry is a private key returned by DecodeKeys.
+type KeyEntry struct {
+	PrivateKey crypto.PrivateKey
+
+	// LocalKeyID is the localKeyId attribute of the key's bag, or nil if
+	// it has none.
+	LocalKeyID []byte
+
+	// Ambiguous reports that another key in the file has the same
+	// LocalKeyID.
+	Ambiguous bool
+}
+
+// handleDuplicateKeyIDs applies dec's KeyIDPolicy to keys, preserving the
+// order of the keys which are kept.
+func (dec *Decoder) handleDuplicateKeyIDs(keys []KeyEntry) ([]KeyEntry, error) {
+	first := make(map[string]int, len(keys))
+	kept := make([]KeyEntry, 0, len(keys))
+	for _, key := range keys {
+		if key.LocalKeyID == nil {
+			kept = append(kept, key)
+			continue
+		}
+		i, seen := first[string(key.LocalKeyID)]
+		if !seen {
+			first[string(key.LocalKeyID)] = len(kept)
+			kept = append(kept, key)
+			continue
+		}
+		switch dec.duplicateKeyIDs {
+		case RejectDuplicateKeyIDs:
+			return nil, ErrDuplicateKeyID
+		case KeepDuplicateKeyIDs:
+			kept[i].Ambiguous = true
+			key.Ambiguous = true
+			kept = append(kept, key)
+		}
+	}
+	return kept, nil
+}
+
+// decodeLocalKeyID returns the bytes of a localKeyId attribute value, which
+// RFC 2985 defines as an OCTET STRING.  A few exporters write a
+// PrintableString or UTF8String instead; its contents are returned as they
+// are, so that the bags of a key and its certificate still match.
+func decodeLocalKeyID(value asn1.RawValue) ([]byte, error) {
+	if value.Class == asn1.ClassUniversal && !value.IsCompound {
+		switch value.Tag {
+		case asn1.TagPrintableString, asn1.TagUTF8String:
+			return value.Bytes, nil
+		}
+	}
+	var id []byte
+	if err := unmarshal(value.FullBytes, &id); err != nil {
+		return nil, errors.New("pkcs12: error decoding localKeyId: " + err.Error())
+	}
+	return id, nil
+}
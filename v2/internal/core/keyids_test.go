@@ -0,0 +1,118 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/asn1"
+	"encoding/hex"
+	"testing"
+)
+
+func TestDuplicateKeyIDs(t *testing.T) {
+	key, cert := newTestCertificate(t, "keyid.example.com", nil, nil)
+	pfxData, err := Encode(rand.Reader, key, cert, nil, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Repeat the SafeContents holding the key bag, as buggy exporters
+	// do, so that two key bags have the same localKeyId.
+	duplicated := rewriteAuthenticatedSafe(t, pfxData, "password", func(authenticatedSafe []contentInfo) []contentInfo {
+		return append(authenticatedSafe, authenticatedSafe[1])
+	})
+
+	if _, _, err := DecodeChain(duplicated, "password"); err != ErrDuplicateKeyID {
+		t.Errorf("DecodeChain returned %v, want ErrDuplicateKeyID", err)
+	}
+	if _, err := DecodeKey(duplicated, "password"); err != ErrDuplicateKeyID {
+		t.Errorf("DecodeKey returned %v, want ErrDuplicateKeyID", err)
+	}
+
+	first := DefaultDecoder.WithDuplicateKeyIDs(FirstDuplicateKeyID)
+	privateKey, certificate, err := first.DecodeChain(duplicated, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !key.Equal(privateKey) || !certificate.Equal(cert) {
+		t.Error("DecodeChain returned the wrong identity")
+	}
+	if _, err := first.DecodeKey(duplicated, "password"); err != nil {
+		t.Error(err)
+	}
+
+	keep := DefaultDecoder.WithDuplicateKeyIDs(KeepDuplicateKeyIDs)
+	keys, err := keep.DecodeKeys(duplicated, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := sha1.Sum(cert.Raw)
+	if len(keys) != 2 {
+		t.Fatalf("got %d keys, want 2", len(keys))
+	}
+	for i, entry := range keys {
+		if !entry.Ambiguous || !bytes.Equal(entry.LocalKeyID, id[:]) || !key.Equal(entry.PrivateKey) {
+			t.Errorf("key %d is %+v", i, entry)
+		}
+	}
+	if _, _, err := keep.DecodeChain(duplicated, "password"); err == nil {
+		t.Error("DecodeChain returned one of two keys")
+	}
+
+	keys, err = DecodeKeys(pfxData, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 || keys[0].Ambiguous {
+		t.Errorf("got keys %+v for a file with one key", keys)
+	}
+}
+
+func TestStringLocalKeyID(t *testing.T) {
+	key, cert := newTestCertificate(t, "stringid.example.com", nil, nil)
+	pfxData, err := Encode(rand.Reader, key, cert, nil, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tag := range []int{asn1.TagPrintableString, asn1.TagUTF8String} {
+		// Replace the localKeyId of the key bag, and repeat it so that
+		// duplicates are detected too.
+		modified := rewriteAuthenticatedSafe(t, pfxData, "password", func(authenticatedSafe []contentInfo) []contentInfo {
+			var bags []safeBag
+			if err := unmarshal(safeContentsData(t, authenticatedSafe[1]), &bags); err != nil {
+				t.Fatal(err)
+			}
+			id, err := asn1.Marshal(asn1.RawValue{Tag: tag, Bytes: []byte("Key 1")})
+			if err != nil {
+				t.Fatal(err)
+			}
+			bags[0].Attributes[0].Value = asn1.RawValue{Tag: 17, IsCompound: true, Bytes: id}
+			data, err := asn1.Marshal(bags)
+			if err != nil {
+				t.Fatal(err)
+			}
+			setSafeContentsData(t, &authenticatedSafe[1], data)
+			return append(authenticatedSafe, authenticatedSafe[1])
+		})
+
+		keys, err := DefaultDecoder.WithDuplicateKeyIDs(KeepDuplicateKeyIDs).DecodeKeys(modified, "password")
+		if err != nil {
+			t.Fatalf("tag %d: %v", tag, err)
+		}
+		if len(keys) != 2 || string(keys[0].LocalKeyID) != "Key 1" || !keys[0].Ambiguous {
+			t.Errorf("tag %d: got keys %+v", tag, keys)
+		}
+
+		blocks, err := DefaultDecoder.WithDuplicateKeyIDs(KeepDuplicateKeyIDs).ToPEM(modified, "password")
+		if err != nil {
+			t.Fatalf("tag %d: %v", tag, err)
+		}
+		if got := blocks[len(blocks)-1].Headers["localKeyId"]; got != hex.EncodeToString([]byte("Key 1")) {
+			t.Errorf("tag %d: ToPEM gave localKeyId %q", tag, got)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+)
+
+// checkKeyMatchesCertificate returns a *KeyAlgorithmMismatchError if
+// privateKey and the public key of certificate are of different
+// algorithms, a *CurveMismatchError if they are ECDSA keys on different
+// curves, and ErrKeyMismatch if privateKey is otherwise not the private
+// key of certificate.  Keys which do not expose their public key, and keys
+// of algorithms other than RSA, ECDSA and Ed25519, are not checked.
+func checkKeyMatchesCertificate(privateKey interface{}, certificate *x509.Certificate) error {
+	key, ok := privateKey.(interface{ Public() crypto.PublicKey })
+	if !ok {
+		return nil
+	}
+	keyAlgorithm := publicKeyAlgorithm(key.Public())
+	if keyAlgorithm == x509.UnknownPublicKeyAlgorithm {
+		return nil
+	}
+	certPublicKey, err := certificatePublicKey(certificate)
+	if err != nil {
+		return nil
+	}
+	certAlgorithm := publicKeyAlgorithm(certPublicKey)
+	if certAlgorithm == x509.UnknownPublicKeyAlgorithm {
+		return nil
+	}
+	if keyAlgorithm != certAlgorithm {
+		return &KeyAlgorithmMismatchError{KeyAlgorithm: keyAlgorithm, CertificateAlgorithm: certAlgorithm}
+	}
+	if keyAlgorithm == x509.ECDSA {
+		keyCurve := key.Public().(*ecdsa.PublicKey).Curve.Params().Name
+		certCurve := certPublicKey.(*ecdsa.PublicKey).Curve.Params().Name
+		if keyCurve != certCurve {
+			return &CurveMismatchError{KeyCurve: keyCurve, CertificateCurve: certCurve}
+		}
+	}
+	if !publicKeyMatches(key.Public(), certificate) {
+		return ErrKeyMismatch
+	}
+	return nil
+}
+
+// publicKeyAlgorithm returns the algorithm of publicKey, or
+// x509.UnknownPublicKeyAlgorithm if it is not an RSA, ECDSA or Ed25519
+// key.
+func publicKeyAlgorithm(publicKey crypto.PublicKey) x509.PublicKeyAlgorithm {
+	switch publicKey.(type) {
+	case *rsa.PublicKey:
+		return x509.RSA
+	case *ecdsa.PublicKey:
+		return x509.ECDSA
+	case ed25519.PublicKey:
+		return x509.Ed25519
+	}
+	return x509.UnknownPublicKeyAlgorithm
+}
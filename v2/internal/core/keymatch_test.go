@@ -0,0 +1,72 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"errors"
+	"testing"
+)
+
+func TestKeyMismatch(t *testing.T) {
+	_, cert := newTestCertificate(t, "www.example.com", nil, nil)
+
+	p384Key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = Encode(rand.Reader, p384Key, cert, nil, "password")
+	var curveErr *CurveMismatchError
+	if !errors.As(err, &curveErr) {
+		t.Fatalf("P-384 key with a P-256 certificate: got error %v, want a CurveMismatchError", err)
+	}
+	if curveErr.KeyCurve != "P-384" || curveErr.CertificateCurve != "P-256" {
+		t.Errorf("got curves %q and %q, want P-384 and P-256", curveErr.KeyCurve, curveErr.CertificateCurve)
+	}
+
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = Encode(rand.Reader, edKey, cert, nil, "password")
+	var algorithmErr *KeyAlgorithmMismatchError
+	if !errors.As(err, &algorithmErr) {
+		t.Fatalf("Ed25519 key with an ECDSA certificate: got error %v, want a KeyAlgorithmMismatchError", err)
+	}
+	if algorithmErr.KeyAlgorithm != x509.Ed25519 || algorithmErr.CertificateAlgorithm != x509.ECDSA {
+		t.Errorf("got algorithms %v and %v, want Ed25519 and ECDSA", algorithmErr.KeyAlgorithm, algorithmErr.CertificateAlgorithm)
+	}
+
+	otherKey, _ := newTestCertificate(t, "other.example.com", nil, nil)
+	if _, err := Encode(rand.Reader, otherKey, cert, nil, "password"); err != ErrKeyMismatch {
+		t.Errorf("P-256 key of another certificate: got error %v, want ErrKeyMismatch", err)
+	}
+}
+
+// encodeMismatchedIdentity returns a file holding privateKey and
+// certificate, which Encode would refuse to produce if they do not match.
+func encodeMismatchedIdentity(t *testing.T, privateKey interface{}, certificate *x509.Certificate) []byte {
+	keyBag := safeBag{Id: oidKeyBag}
+	keyBag.Value.Class = 2
+	keyBag.Value.Tag = 0
+	keyBag.Value.IsCompound = true
+	var err error
+	if keyBag.Value.Bytes, err = x509.MarshalPKCS8PrivateKey(privateKey); err != nil {
+		t.Fatal(err)
+	}
+	certBag, err := makeCertBag(certificate.Raw, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pfxData, err := Modern.encodeTrustStoreBags(rand.Reader, []safeBag{keyBag, *certBag}, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pfxData
+}
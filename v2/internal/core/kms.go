@@ -0,0 +1,155 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"strconv"
+
+	"github.com/scholar-ink/go-pkcs12/v2/oids"
+)
+
+// see https://tools.ietf.org/html/rfc5084#section-3.2
+var oidAES256GCM = asn1.ObjectIdentifier([]int{2, 16, 840, 1, 101, 3, 4, 1, 46})
+
+// kmsEnvelope is the wrapper format of SealWithKMS:
+//
+//	KMSEnvelope ::= SEQUENCE {
+//	    version              INTEGER (0),
+//	    encryptedKey         OCTET STRING,
+//	    contentEncryption    AlgorithmIdentifier,
+//	    encryptedContent     OCTET STRING }
+//
+// encryptedKey is the content key as returned by the KMS, and
+// contentEncryption is aes256-GCM with the GCMParameters of RFC 5084.  The
+// additional authenticated data of the encryption is the DER encoding of a
+// SEQUENCE of the first three fields, so that none of them can be replaced
+// without detection.
+type kmsEnvelope struct {
+	Version           int
+	EncryptedKey      []byte
+	ContentEncryption pkix.AlgorithmIdentifier
+	EncryptedContent  []byte
+}
+
+// kmsEnvelopeHeader is the part of a kmsEnvelope which is authenticated as
+// additional data.
+type kmsEnvelopeHeader struct {
+	Version           int
+	EncryptedKey      []byte
+	ContentEncryption pkix.AlgorithmIdentifier
+}
+
+// additionalData returns the additional authenticated data of envelope.
+func (envelope *kmsEnvelope) additionalData() ([]byte, error) {
+	return asn1.Marshal(kmsEnvelopeHeader{
+		Version:           envelope.Version,
+		EncryptedKey:      envelope.EncryptedKey,
+		ContentEncryption: envelope.ContentEncryption,
+	})
+}
+
+// gcmParams are the parameters of AES-GCM, RFC 5084 section 3.2.
+type gcmParams struct {
+	Nonce  []byte
+	ICVLen int `asn1:"optional,default:12"`
+}
+
+// SealWithKMS envelopes pfxData, typically a password-protected PKCS#12
+// file, under a random AES-256-GCM content key, and returns the envelope
+// together with the content key encrypted by kmsEncrypt, which usually
+// calls the Encrypt operation of a cloud key management service.  The file
+// can then be stored where the password alone does not suffice to read it,
+// and is recovered by OpenWithKMS.  pfxData is not parsed, so any data can
+// be sealed.
+func SealWithKMS(pfxData []byte, kmsEncrypt func([]byte) ([]byte, error)) ([]byte, error) {
+	key := make([]byte, 32)
+	defer clear(key)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, 12)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	aead, err := newKMSEnvelopeAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	envelope := kmsEnvelope{
+		ContentEncryption: pkix.AlgorithmIdentifier{Algorithm: oidAES256GCM},
+	}
+	if envelope.ContentEncryption.Parameters.FullBytes, err = asn1.Marshal(gcmParams{Nonce: nonce, ICVLen: aead.Overhead()}); err != nil {
+		return nil, err
+	}
+	if envelope.EncryptedKey, err = kmsEncrypt(key); err != nil {
+		return nil, errors.New("pkcs12: error encrypting the content key with KMS: " + err.Error())
+	}
+	additionalData, err := envelope.additionalData()
+	if err != nil {
+		return nil, err
+	}
+	envelope.EncryptedContent = aead.Seal(nil, nonce, pfxData, additionalData)
+	return asn1.Marshal(envelope)
+}
+
+// OpenWithKMS returns the data sealed by SealWithKMS, decrypting the content
+// key with kmsDecrypt, which usually calls the Decrypt operation of the key
+// management service which encrypted it.
+func OpenWithKMS(sealed []byte, kmsDecrypt func([]byte) ([]byte, error)) (pfxData []byte, err error) {
+	var envelope kmsEnvelope
+	if err := unmarshal(sealed, &envelope); err != nil {
+		return nil, errors.New("pkcs12: error decoding KMS envelope: " + err.Error())
+	}
+	if envelope.Version != 0 {
+		return nil, NotImplementedError("KMS envelope version " + strconv.Itoa(envelope.Version) + " is not supported")
+	}
+	if !envelope.ContentEncryption.Algorithm.Equal(oidAES256GCM) {
+		return nil, NotImplementedError("KMS envelope content encryption " + oids.Describe(envelope.ContentEncryption.Algorithm) + " is not supported")
+	}
+	var params gcmParams
+	if err := unmarshal(envelope.ContentEncryption.Parameters.FullBytes, &params); err != nil {
+		return nil, errors.New("pkcs12: error decoding KMS envelope: " + err.Error())
+	}
+
+	key, err := kmsDecrypt(envelope.EncryptedKey)
+	if err != nil {
+		return nil, errors.New("pkcs12: error decrypting the content key with KMS: " + err.Error())
+	}
+	defer clear(key)
+	aead, err := newKMSEnvelopeAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(params.Nonce) != aead.NonceSize() || params.ICVLen != aead.Overhead() {
+		return nil, NotImplementedError("KMS envelope AES-GCM parameters are not supported")
+	}
+	additionalData, err := envelope.additionalData()
+	if err != nil {
+		return nil, err
+	}
+	if pfxData, err = aead.Open(nil, params.Nonce, envelope.EncryptedContent, additionalData); err != nil {
+		return nil, errors.New("pkcs12: KMS envelope authentication failed")
+	}
+	return pfxData, nil
+}
+
+// newKMSEnvelopeAEAD returns AES-256-GCM keyed with key.
+func newKMSEnvelopeAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != 32 {
+		return nil, errors.New("pkcs12: KMS content key has the wrong length")
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
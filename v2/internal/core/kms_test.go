@@ -0,0 +1,122 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/asn1"
+	"errors"
+	"testing"
+)
+
+// testKMS stands in for a key management service, wrapping keys with
+// AES-GCM under its master key.
+type testKMS struct {
+	aead cipher.AEAD
+}
+
+func newTestKMS(t *testing.T) *testKMS {
+	masterKey := make([]byte, 32)
+	if _, err := rand.Read(masterKey); err != nil {
+		t.Fatal(err)
+	}
+	block, err := aes.NewCipher(masterKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testKMS{aead: aead}
+}
+
+func (k *testKMS) Encrypt(plaintext []byte) ([]byte, error) {
+	nonce := make([]byte, k.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return k.aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func (k *testKMS) Decrypt(ciphertext []byte) ([]byte, error) {
+	if len(ciphertext) < k.aead.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	return k.aead.Open(nil, ciphertext[:k.aead.NonceSize()], ciphertext[k.aead.NonceSize():], nil)
+}
+
+func TestSealWithKMS(t *testing.T) {
+	key, cert := newTestCertificate(t, "www.example.com", nil, nil)
+	pfxData, err := Modern.Encode(rand.Reader, key, cert, nil, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	kms := newTestKMS(t)
+	sealed, err := SealWithKMS(pfxData, kms.Encrypt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(sealed, pfxData) {
+		t.Fatal("sealed data contains the PFX")
+	}
+	if _, _, err := Decode(sealed, "password"); err == nil {
+		t.Error("decoded sealed data without opening it")
+	}
+
+	opened, err := OpenWithKMS(sealed, kms.Decrypt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(opened, pfxData) {
+		t.Fatal("opened data does not match")
+	}
+
+	if _, err := OpenWithKMS(sealed, newTestKMS(t).Decrypt); err == nil {
+		t.Error("opened with another KMS key")
+	}
+	tampered := append([]byte{}, sealed...)
+	tampered[len(tampered)-1] ^= 1
+	if _, err := OpenWithKMS(tampered, kms.Decrypt); err == nil {
+		t.Error("opened tampered data")
+	}
+
+	// The header is authenticated: wrapping the same content key again
+	// changes encryptedKey, which must be detected.
+	var envelope kmsEnvelope
+	if err := unmarshal(sealed, &envelope); err != nil {
+		t.Fatal(err)
+	}
+	contentKey, err := kms.Decrypt(envelope.EncryptedKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if envelope.EncryptedKey, err = kms.Encrypt(contentKey); err != nil {
+		t.Fatal(err)
+	}
+	rewrapped, err := asn1.Marshal(envelope)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenWithKMS(rewrapped, kms.Decrypt); err == nil {
+		t.Error("opened an envelope whose encrypted key was replaced")
+	}
+
+	if _, err := OpenWithKMS(sealed, func(ciphertext []byte) ([]byte, error) { return make([]byte, 16), nil }); err == nil {
+		t.Error("opened with a content key of the wrong length")
+	}
+
+	kmsErr := errors.New("kms unavailable")
+	failing := func([]byte) ([]byte, error) { return nil, kmsErr }
+	if _, err := SealWithKMS(pfxData, failing); err == nil {
+		t.Error("sealed although the KMS failed")
+	}
+	if _, err := OpenWithKMS(sealed, failing); err == nil {
+		t.Error("opened although the KMS failed")
+	}
+}
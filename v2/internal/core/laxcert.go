@@ -0,0 +1,228 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"bytes"
+	"crypto/x509"
+	"errors"
+
+	"github.com/scholar-ink/go-pkcs12/v2/internal/der"
+)
+
+// maxLaxDepth bounds the nesting of the elements normalized by
+// normalizeDER.
+const maxLaxDepth = 32
+
+// WithLaxCertificates returns a copy of dec which, if lax is true, accepts
+// certificates which crypto/x509 rejects because they repeat an extension
+// or are not DER, such as those of some devices with non-minimal lengths,
+// serial numbers with leading zeros, or BOOLEANs other than 0xFF for true.
+// Such a certificate is parsed from a normalized copy, in which every
+// length, INTEGER and BOOLEAN is re-encoded minimally and only the first
+// of each extension is kept.
+//
+// The Raw and RawTBSCertificate fields of the certificate are nevertheless
+// its original encoding, so that fingerprints and CheckSignatureFrom apply
+// to the certificate as issued.  Its other Raw fields refer to the
+// normalized copy.  Certificates which cannot be normalized still fail to
+// decode with the error of crypto/x509.
+func (dec Decoder) WithLaxCertificates(lax bool) *Decoder {
+	dec.laxCertificates = lax
+	return &dec
+}
+
+// parseCert is like parseCertBag, but also parses certificates on
+// secp256k1 if dec is configured with WithSecp256k1, and falls back to
+// parseLaxCertificate if dec accepts lax certificates.
+func (dec *Decoder) parseCert(asn1Data []byte) (*x509.Certificate, error) {
+	cert, err := parseCertBag(asn1Data)
+	if err == nil || (!dec.laxCertificates && !dec.secp256k1) {
+		return cert, err
+	}
+	certData, bagErr := decodeCertBag(asn1Data)
+	if bagErr != nil {
+		return nil, err
+	}
+	if dec.secp256k1 {
+		if cert, curveErr := parseNamedCurveCertificate(certData, secp256k1Curve); curveErr == nil {
+			return cert, nil
+		}
+	}
+	if !dec.laxCertificates {
+		return nil, err
+	}
+	if cert, laxErr := parseLaxCertificate(certData); laxErr == nil {
+		return cert, nil
+	}
+	return nil, err
+}
+
+// parseLaxCertificate parses a certificate which is not DER, or which
+// repeats extensions, as described for WithLaxCertificates.
+func parseLaxCertificate(certData []byte) (*x509.Certificate, error) {
+	normalized, err := normalizeDER(certData, 0)
+	if err != nil {
+		return nil, err
+	}
+	if normalized, err = removeDuplicateExtensions(normalized); err != nil {
+		return nil, err
+	}
+	if bytes.Equal(normalized, certData) {
+		return nil, errors.New("pkcs12: certificate cannot be normalized")
+	}
+	cert, err := x509.ParseCertificate(normalized)
+	if err != nil {
+		return nil, err
+	}
+
+	_, certContents, rest, err := readLaxElement(certData)
+	if err != nil {
+		return nil, err
+	}
+	_, _, tbsRest, err := readLaxElement(certContents)
+	if err != nil {
+		return nil, err
+	}
+	cert.Raw = certData[:len(certData)-len(rest)]
+	cert.RawTBSCertificate = certContents[:len(certContents)-len(tbsRest)]
+	return cert, nil
+}
+
+// readLaxElement reads the first element of b, whose tag must be a single
+// octet and whose length may be in a non-minimal but definite form.  It
+// returns the contents, and the elements following it.
+func readLaxElement(b []byte) (tag der.Tag, contents, rest []byte, err error) {
+	if len(b) < 2 {
+		return 0, nil, nil, errors.New("pkcs12: truncated element")
+	}
+	if b[0]&0x1f == 0x1f {
+		return 0, nil, nil, errors.New("pkcs12: high tag number")
+	}
+	tag = der.Tag(b[0])
+	length, header := int(b[1]), 2
+	if length&0x80 != 0 {
+		n := length & 0x7f
+		if n == 0 {
+			return 0, nil, nil, errors.New("pkcs12: indefinite length")
+		}
+		if n > 4 || len(b) < header+n {
+			return 0, nil, nil, errors.New("pkcs12: invalid length")
+		}
+		length = 0
+		for _, c := range b[header : header+n] {
+			length = length<<8 | int(c)
+		}
+		header += n
+	}
+	if length > len(b)-header {
+		return 0, nil, nil, errors.New("pkcs12: truncated element")
+	}
+	return tag, b[header : header+length], b[header+length:], nil
+}
+
+// normalizeDER re-encodes the elements of b with minimal lengths, and with
+// the redundant leading octets of INTEGERs removed and true BOOLEANs as
+// 0xFF.  The contents of primitive elements are otherwise kept verbatim.
+func normalizeDER(b []byte, depth int) ([]byte, error) {
+	if depth > maxLaxDepth {
+		return nil, errors.New("pkcs12: elements nested too deeply")
+	}
+	out := make([]byte, 0, len(b))
+	for len(b) > 0 {
+		tag, contents, rest, err := readLaxElement(b)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case tag.Constructed() == tag:
+			if contents, err = normalizeDER(contents, depth+1); err != nil {
+				return nil, err
+			}
+		case tag == der.Integer:
+			for len(contents) > 1 && (contents[0] == 0 && contents[1]&0x80 == 0 || contents[0] == 0xff && contents[1]&0x80 != 0) {
+				contents = contents[1:]
+			}
+		case tag == 0x01 && len(contents) == 1 && contents[0] != 0:
+			contents = []byte{0xff}
+		}
+		out = der.AppendHeader(out, tag, len(contents))
+		out = append(out, contents...)
+		b = rest
+	}
+	return out, nil
+}
+
+// removeDuplicateExtensions returns the DER certificate certData without
+// the second and later occurrences of each extension.
+func removeDuplicateExtensions(certData []byte) ([]byte, error) {
+	input := der.NewString(certData)
+	certificate, err := input.ReadElement(der.Sequence)
+	if err != nil {
+		return nil, err
+	}
+	tbs, err := certificate.ReadElement(der.Sequence)
+	if err != nil {
+		return nil, err
+	}
+	extensionsTag := der.Tag(3).ContextSpecific().Constructed()
+	var newTBS []byte
+	changed := false
+	for !tbs.Empty() {
+		_, full, err := tbs.ReadAnyElement()
+		if err != nil {
+			return nil, err
+		}
+		if der.Tag(full[0]) != extensionsTag {
+			newTBS = append(newTBS, full...)
+			continue
+		}
+		element := der.NewString(full)
+		extensions, err := element.ReadElement(extensionsTag)
+		if err != nil {
+			return nil, err
+		}
+		list, err := extensions.ReadElement(der.Sequence)
+		if err != nil {
+			return nil, err
+		}
+		var unique []byte
+		seen := make(map[string]bool)
+		for !list.Empty() {
+			_, extension, err := list.ReadAnyElement()
+			if err != nil {
+				return nil, err
+			}
+			element := der.NewString(extension)
+			fields, err := element.ReadElement(der.Sequence)
+			if err != nil {
+				return nil, err
+			}
+			_, id, err := fields.ReadAnyElement()
+			if err != nil {
+				return nil, err
+			}
+			if seen[string(id)] {
+				changed = true
+				continue
+			}
+			seen[string(id)] = true
+			unique = append(unique, extension...)
+		}
+		sequence := der.AppendHeader(nil, der.Sequence, len(unique))
+		sequence = append(sequence, unique...)
+		newTBS = der.AppendHeader(newTBS, extensionsTag, len(sequence))
+		newTBS = append(newTBS, sequence...)
+	}
+	if !changed {
+		return certData, nil
+	}
+
+	body := der.AppendHeader(nil, der.Sequence, len(newTBS))
+	body = append(body, newTBS...)
+	body = append(body, certificate.Bytes()...)
+	out := der.AppendHeader(nil, der.Sequence, len(body))
+	return append(out, body...), nil
+}
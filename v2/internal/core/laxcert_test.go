@@ -0,0 +1,158 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// nonDERCertificate returns a certificate issued by ca, signed with caKey,
+// whose TBSCertificate repeats its first extension, has a serial number
+// with a leading zero octet, and encodes its validity with a non-minimal
+// length, as some device certificates do.
+func nonDERCertificate(t *testing.T, ca *x509.Certificate, caKey *ecdsa.PrivateKey) []byte {
+	key, _ := newTestCertificate(t, "device", nil, nil)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(0x1234),
+		Subject:      pkix.Name{CommonName: "device.example.com"},
+		DNSNames:     []string{"device.example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, template, ca, key.Public(), caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cert struct {
+		TBS                asn1.RawValue
+		SignatureAlgorithm asn1.RawValue
+		Signature          asn1.BitString
+	}
+	if _, err := asn1.Unmarshal(certDER, &cert); err != nil {
+		t.Fatal(err)
+	}
+	var fields []asn1.RawValue
+	if _, err := asn1.Unmarshal(cert.TBS.FullBytes, &fields); err != nil {
+		t.Fatal(err)
+	}
+
+	// fields are version, serialNumber, signature, issuer, validity,
+	// subject, subjectPublicKeyInfo, and extensions.
+	var extensions []asn1.RawValue
+	if _, err := asn1.Unmarshal(fields[7].Bytes, &extensions); err != nil {
+		t.Fatal(err)
+	}
+	extensions = append(extensions, extensions[0])
+	extensionsDER, err := asn1.Marshal(extensions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields[7] = asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 3, IsCompound: true, Bytes: extensionsDER}
+	fields[1] = asn1.RawValue{Tag: asn1.TagInteger, Bytes: append([]byte{0}, fields[1].Bytes...)}
+	fields[4] = asn1.RawValue{FullBytes: append([]byte{0x30, 0x81, byte(len(fields[4].Bytes))}, fields[4].Bytes...)}
+
+	var tbs []byte
+	for _, field := range fields {
+		b, err := asn1.Marshal(field)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tbs = append(tbs, b...)
+	}
+	tbs, err = asn1.Marshal(asn1.RawValue{Tag: asn1.TagSequence, IsCompound: true, Bytes: tbs})
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := sha256.Sum256(tbs)
+	signature, err := ecdsa.SignASN1(rand.Reader, caKey, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert.TBS = asn1.RawValue{FullBytes: tbs}
+	cert.Signature = asn1.BitString{Bytes: signature, BitLength: 8 * len(signature)}
+	certDER, err = asn1.Marshal(cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return certDER
+}
+
+func TestLaxCertificates(t *testing.T) {
+	caKey, ca := newTestCertificate(t, "ca.example.com", nil, nil)
+	certDER := nonDERCertificate(t, ca, caKey)
+	if _, err := x509.ParseCertificate(certDER); err == nil {
+		t.Fatal("crypto/x509 accepts the non-DER certificate")
+	}
+
+	bagData, err := asn1.Marshal(certBag{Id: oidCertTypeX509Certificate, Data: certDER})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bag := safeBag{Id: oidCertBag}
+	bag.Value = asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: bagData}
+	pfxData, err := Modern.encodeTrustStoreBags(rand.Reader, []safeBag{bag}, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := DecodeTrustStore(pfxData, "password"); err == nil {
+		t.Fatal("decoded the non-DER certificate strictly")
+	}
+	certs, err := DefaultDecoder.WithLaxCertificates(true).DecodeTrustStore(pfxData, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert := certs[0]
+	if !bytes.Equal(cert.Raw, certDER) {
+		t.Error("Raw is not the original encoding")
+	}
+	if err := cert.CheckSignatureFrom(ca); err != nil {
+		t.Errorf("signature does not verify: %v", err)
+	}
+	if cert.SerialNumber.Int64() != 0x1234 || cert.Subject.CommonName != "device.example.com" {
+		t.Errorf("got serial %v and subject %v", cert.SerialNumber, cert.Subject)
+	}
+	seen := make(map[string]bool)
+	for _, extension := range cert.Extensions {
+		if seen[extension.Id.String()] {
+			t.Errorf("extension %v repeated", extension.Id)
+		}
+		seen[extension.Id.String()] = true
+	}
+}
+
+func TestNormalizeDER(t *testing.T) {
+	for _, test := range []struct {
+		in, want []byte
+	}{
+		{[]byte{0x30, 0x81, 0x03, 0x02, 0x01, 0x05}, []byte{0x30, 0x03, 0x02, 0x01, 0x05}},
+		{[]byte{0x02, 0x03, 0x00, 0x00, 0x7f}, []byte{0x02, 0x01, 0x7f}},
+		{[]byte{0x02, 0x02, 0xff, 0x80}, []byte{0x02, 0x01, 0x80}},
+		{[]byte{0x02, 0x02, 0x00, 0x80}, []byte{0x02, 0x02, 0x00, 0x80}},
+		{[]byte{0x01, 0x01, 0x01}, []byte{0x01, 0x01, 0xff}},
+		{[]byte{0x04, 0x82, 0x00, 0x01, 0x00}, []byte{0x04, 0x01, 0x00}},
+	} {
+		got, err := normalizeDER(test.in, 0)
+		if err != nil {
+			t.Errorf("%x: %v", test.in, err)
+		} else if !bytes.Equal(got, test.want) {
+			t.Errorf("%x: got %x, want %x", test.in, got, test.want)
+		}
+	}
+	for _, in := range [][]byte{{0x30, 0x80, 0x00, 0x00}, {0x30, 0x05, 0x02}, {0x1f, 0x01, 0x00}} {
+		if _, err := normalizeDER(in, 0); err == nil {
+			t.Errorf("%x: normalized invalid input", in)
+		}
+	}
+}
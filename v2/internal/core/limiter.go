@@ -0,0 +1,69 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import "context"
+
+// A Limiter rations the key derivation work of a Decoder configured with
+// WithLimiter.  WaitN blocks until n units of work may be performed, or
+// returns an error if they never can be.  *rate.Limiter of
+// golang.org/x/time/rate implements Limiter.
+type Limiter interface {
+	WaitN(ctx context.Context, n int) error
+}
+
+// limiterChunk is the largest number of units for which a Limiter is
+// asked at once.
+const limiterChunk = 1024
+
+// WithLimiter returns a copy of dec which takes the work of its key
+// derivations from limiter, so that a multi-tenant service can give each
+// tenant a Decoder with its own limiter and one tenant's files, however
+// high their iteration counts, cannot monopolize the CPU.  A unit of work
+// is one iteration of the PKCS#12 KDF, PBKDF1 or PBKDF2, or one mixing step
+// of scrypt, as counted by WithProgress; files declaring more work simply
+// wait longer.
+//
+// The work is requested ahead of each block of up to 1024 iterations, so
+// the burst of limiter must be at least 1024.  The context set with
+// WithContext, if any, is passed to WaitN, and an error from WaitN
+// abandons the decode and is returned.
+func (dec Decoder) WithLimiter(limiter Limiter) *Decoder {
+	dec.limiter = limiter
+	return &dec
+}
+
+// charge takes the work of the iterations following the done-th of a key
+// derivation from the limiter, a block at a time.  It returns false if the
+// limiter refuses.
+func (m *kdfMonitor) charge(done, total int) bool {
+	if m.limiter == nil || m.cancelled != nil {
+		return m.cancelled == nil
+	}
+	var n int
+	switch {
+	case done == 1:
+		n = total
+	case done%limiterChunk == 0:
+		n = total - done
+	default:
+		return true
+	}
+	if n > limiterChunk {
+		n = limiterChunk
+	}
+	if n <= 0 {
+		return true
+	}
+	ctx := m.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if err := m.limiter.WaitN(ctx, n); err != nil {
+		m.cancelled = err
+		return false
+	}
+	return true
+}
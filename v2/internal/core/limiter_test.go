@@ -0,0 +1,65 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"testing"
+)
+
+// countingLimiter is a Limiter which grants up to budget units of work,
+// counting those requested.
+type countingLimiter struct {
+	requested, largest, budget int
+}
+
+var errBudgetExhausted = errors.New("budget exhausted")
+
+func (l *countingLimiter) WaitN(ctx context.Context, n int) error {
+	l.requested += n
+	if n > l.largest {
+		l.largest = n
+	}
+	if l.budget > 0 && l.requested > l.budget {
+		return errBudgetExhausted
+	}
+	return nil
+}
+
+func TestWithLimiter(t *testing.T) {
+	key, cert := newTestCertificate(t, "www.example.com", nil, nil)
+	pfxData, err := OpenSSL111.Encode(rand.Reader, key, cert, nil, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var work int
+	dec := DefaultDecoder.WithProgress(func(p Progress) {
+		if p.Stage == KeyDerivationStage && p.Done == p.Total {
+			work += p.Total
+		}
+	})
+	if _, _, err := dec.Decode(pfxData, "password"); err != nil {
+		t.Fatal(err)
+	}
+
+	limiter := new(countingLimiter)
+	if _, _, err := DefaultDecoder.WithLimiter(limiter).Decode(pfxData, "password"); err != nil {
+		t.Fatal(err)
+	}
+	if limiter.requested != work {
+		t.Errorf("requested %d units, want the %d iterations of the key derivations", limiter.requested, work)
+	}
+	if limiter.largest > limiterChunk {
+		t.Errorf("requested %d units at once, more than %d", limiter.largest, limiterChunk)
+	}
+
+	limiter = &countingLimiter{budget: work / 2}
+	if _, _, err := DefaultDecoder.WithLimiter(limiter).Decode(pfxData, "password"); err != errBudgetExhausted {
+		t.Errorf("got error %v from an exhausted limiter, want %v", err, errBudgetExhausted)
+	}
+}
@@ -0,0 +1,149 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Copyright 2015 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"hash"
+
+	"github.com/scholar-ink/go-pkcs12/v2/internal/sm3"
+	"github.com/scholar-ink/go-pkcs12/v2/oids"
+)
+
+type macData struct {
+	Mac        digestInfo
+	MacSalt    []byte
+	Iterations int `asn1:"optional,default:1"`
+}
+
+// from PKCS#7:
+type digestInfo struct {
+	Algorithm pkix.AlgorithmIdentifier
+	Digest    []byte
+}
+
+var (
+	oidSHA1       = asn1.ObjectIdentifier([]int{1, 3, 14, 3, 2, 26})
+	oidSHA256     = asn1.ObjectIdentifier([]int{2, 16, 840, 1, 101, 3, 4, 2, 1})
+	oidSHA224     = asn1.ObjectIdentifier([]int{2, 16, 840, 1, 101, 3, 4, 2, 4})
+	oidSHA512_224 = asn1.ObjectIdentifier([]int{2, 16, 840, 1, 101, 3, 4, 2, 5})
+	oidSHA512_256 = asn1.ObjectIdentifier([]int{2, 16, 840, 1, 101, 3, 4, 2, 6})
+	oidSM3        = asn1.ObjectIdentifier([]int{1, 2, 156, 10197, 1, 401})
+)
+
+// macDigest describes a digest algorithm which can be used for MacData.
+type macDigest struct {
+	hash func() hash.Hash
+	u, v int // output and block sizes in bytes, as in RFC 7292 appendix B.2
+}
+
+func macDigestFor(algorithm asn1.ObjectIdentifier) (*macDigest, error) {
+	switch {
+	case algorithm.Equal(oidSHA1):
+		return &macDigest{sha1.New, 20, 64}, nil
+	case algorithm.Equal(oidSHA224):
+		return &macDigest{sha256.New224, 28, 64}, nil
+	case algorithm.Equal(oidSHA256):
+		return &macDigest{sha256.New, 32, 64}, nil
+	case algorithm.Equal(oidSHA384):
+		return &macDigest{sha512.New384, 48, 128}, nil
+	case algorithm.Equal(oidSHA512):
+		return &macDigest{sha512.New, 64, 128}, nil
+	case algorithm.Equal(oidSHA512_224):
+		return &macDigest{sha512.New512_224, 28, 128}, nil
+	case algorithm.Equal(oidSHA512_256):
+		return &macDigest{sha512.New512_256, 32, 128}, nil
+	case algorithm.Equal(oidSM3):
+		// The GM/T 0024 profile of PKCS#12.
+		return &macDigest{sm3.New, sm3.Size, sm3.BlockSize}, nil
+	default:
+		return nil, NotImplementedError("unknown digest algorithm: " + oids.Describe(algorithm))
+	}
+}
+
+// WithMAC returns a copy of enc which authenticates the file with HMAC
+// using digest, keyed by the PKCS#12 key derivation with the given
+// iteration count, to meet policies such as 100,000 iterations with
+// SHA-256.  digest must be one of crypto.SHA1, crypto.SHA224,
+// crypto.SHA256, crypto.SHA384, crypto.SHA512, crypto.SHA512_224 and
+// crypto.SHA512_256; encoding with any other fails with a
+// NotImplementedError.  An iteration count below 1 is treated as 1.
+func (enc Encoder) WithMAC(digest crypto.Hash, iterations int) *Encoder {
+	enc.macAlgorithm, enc.macHash = macAlgorithmFor(digest), digest
+	if iterations < 1 {
+		iterations = 1
+	}
+	enc.macIterations = iterations
+	return &enc
+}
+
+// macAlgorithmFor returns the identifier of the MacData digest h, or nil if
+// it is not supported.
+func macAlgorithmFor(h crypto.Hash) asn1.ObjectIdentifier {
+	switch h {
+	case crypto.SHA1:
+		return oidSHA1
+	case crypto.SHA224:
+		return oidSHA224
+	case crypto.SHA256:
+		return oidSHA256
+	case crypto.SHA384:
+		return oidSHA384
+	case crypto.SHA512:
+		return oidSHA512
+	case crypto.SHA512_224:
+		return oidSHA512_224
+	case crypto.SHA512_256:
+		return oidSHA512_256
+	default:
+		return nil
+	}
+}
+
+// macFor returns the MAC of message as specified by macData, keyed with
+// password, notifying m of the progress of the key derivation.
+func macFor(macData *macData, message, password []byte, m *kdfMonitor) ([]byte, error) {
+	if macData.Mac.Algorithm.Algorithm.Equal(oidStreebog512) {
+		return gostMACFor(macData, message, password, m)
+	}
+
+	digest, err := macDigestFor(macData.Mac.Algorithm.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	key := pbkdf(digest.hash, digest.u, digest.v, macData.MacSalt, password, macData.Iterations, 3, digest.u, m)
+	if err := m.err(); err != nil {
+		return nil, err
+	}
+
+	mac := hmac.New(digest.hash, key)
+	mac.Write(message)
+	return mac.Sum(nil), nil
+}
+
+func verifyMac(macData *macData, message, password []byte, m *kdfMonitor) error {
+	expectedMAC, err := macFor(macData, message, password, m)
+	if err != nil {
+		return err
+	}
+
+	if !hmac.Equal(macData.Mac.Digest, expectedMAC) {
+		return ErrIncorrectPassword
+	}
+	return nil
+}
+
+func computeMac(macData *macData, message, password []byte, m *kdfMonitor) (err error) {
+	macData.Mac.Digest, err = macFor(macData, message, password, m)
+	return err
+}
@@ -0,0 +1,186 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Copyright 2015 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"encoding/asn1"
+	"encoding/base64"
+	"testing"
+)
+
+func TestVerifyMac(t *testing.T) {
+	td := macData{
+		Mac: digestInfo{
+			Digest: []byte{0x18, 0x20, 0x3d, 0xff, 0x1e, 0x16, 0xf4, 0x92, 0xf2, 0xaf, 0xc8, 0x91, 0xa9, 0xba, 0xd6, 0xca, 0x9d, 0xee, 0x51, 0x93},
+		},
+		MacSalt:    []byte{1, 2, 3, 4, 5, 6, 7, 8},
+		Iterations: 2048,
+	}
+
+	message := []byte{11, 12, 13, 14, 15}
+	password, _ := bmpString("")
+
+	td.Mac.Algorithm.Algorithm = asn1.ObjectIdentifier([]int{1, 2, 3})
+	err := verifyMac(&td, message, password, nil)
+	if _, ok := err.(NotImplementedError); !ok {
+		t.Errorf("err: %v", err)
+	}
+
+	td.Mac.Algorithm.Algorithm = asn1.ObjectIdentifier([]int{1, 3, 14, 3, 2, 26})
+	err = verifyMac(&td, message, password, nil)
+	if err != ErrIncorrectPassword {
+		t.Errorf("Expected incorrect password, got err: %v", err)
+	}
+
+	password, _ = bmpString("Sesame open")
+	err = verifyMac(&td, message, password, nil)
+	if err != nil {
+		t.Errorf("err: %v", err)
+	}
+
+}
+
+func TestComputeMac(t *testing.T) {
+	td := macData{
+		MacSalt:    []byte{1, 2, 3, 4, 5, 6, 7, 8},
+		Iterations: 2048,
+	}
+
+	message := []byte{11, 12, 13, 14, 15}
+	password, _ := bmpString("Sesame open")
+
+	td.Mac.Algorithm.Algorithm = asn1.ObjectIdentifier([]int{1, 2, 3})
+	err := computeMac(&td, message, password, nil)
+	if _, ok := err.(NotImplementedError); !ok {
+		t.Errorf("err: %v", err)
+	}
+
+	td.Mac.Algorithm.Algorithm = asn1.ObjectIdentifier([]int{1, 3, 14, 3, 2, 26})
+	err = computeMac(&td, message, password, nil)
+	if err != nil {
+		t.Errorf("err: %v", err)
+	}
+
+	expectedDigest := []byte{0x18, 0x20, 0x3d, 0xff, 0x1e, 0x16, 0xf4, 0x92, 0xf2, 0xaf, 0xc8, 0x91, 0xa9, 0xba, 0xd6, 0xca, 0x9d, 0xee, 0x51, 0x93}
+
+	if bytes.Compare(td.Mac.Digest, expectedDigest) != 0 {
+		t.Errorf("Computed incorrect MAC; expected MAC to be '%d' but got '%d'", expectedDigest, td.Mac.Digest)
+	}
+
+}
+
+// openSSLMACTestData holds files written by "openssl pkcs12 -export -nokeys
+// -certpbe NONE -macalg <digest>" of OpenSSL 3.0, with the password
+// "password", for a certificate for openssl3.example.com.
+var openSSLMACTestData = map[string]string{
+	"sha224": `MIICPgIBAzCCAfgGCSqGSIb3DQEHAaCCAekEggHlMIIB4TCCAd0GCSqGSIb3DQEHAaCCAc4EggHK
+MIIBxjCCAcIGCyqGSIb3DQEMCgEDoIIBsTCCAa0GCiqGSIb3DQEJFgGgggGdBIIBmTCCAZUwggE7
+oAMCAQICFD44u/pnCIYRMZ4DE+tzLyqmuHLQMAoGCCqGSM49BAMCMB8xHTAbBgNVBAMMFG9wZW5z
+c2wzLmV4YW1wbGUuY29tMCAXDTI2MTAxNDA2MTczN1oYDzIxMjYwOTIwMDYxNzM3WjAfMR0wGwYD
+VQQDDBRvcGVuc3NsMy5leGFtcGxlLmNvbTBZMBMGByqGSM49AgEGCCqGSM49AwEHA0IABB3TbZio
+y2nqIYmnfd77GQ4l5jm8NQOMPRnsHmyZHFPfj0swlIuSpKWEfVSAUKp2FmkM9kFpgL/w25BYm85a
+tv2jUzBRMB0GA1UdDgQWBBSu0kicbwtkpW2bC4i5mE4QmAQvCTAfBgNVHSMEGDAWgBSu0kicbwtk
+pW2bC4i5mE4QmAQvCTAPBgNVHRMBAf8EBTADAQH/MAoGCCqGSM49BAMCA0gAMEUCICVlDw3X5ub0
+pUeIbP4/HjTuwe0ac3nx/BjM7ut1FdepAiEA5YykO8pu/i3DzZIS7FGEDzAFPa5v29qlaihhdh3w
+gU8wPTAtMA0GCWCGSAFlAwQCBAUABBxrL0JYeO5bc7H/AjrV7IXFe/Ns9MXij3rxJkLdBAjjrRv5
+kcH1lgICCAA=`,
+	"sha384": `MIICUgIBAzCCAfgGCSqGSIb3DQEHAaCCAekEggHlMIIB4TCCAd0GCSqGSIb3DQEHAaCCAc4EggHK
+MIIBxjCCAcIGCyqGSIb3DQEMCgEDoIIBsTCCAa0GCiqGSIb3DQEJFgGgggGdBIIBmTCCAZUwggE7
+oAMCAQICFD44u/pnCIYRMZ4DE+tzLyqmuHLQMAoGCCqGSM49BAMCMB8xHTAbBgNVBAMMFG9wZW5z
+c2wzLmV4YW1wbGUuY29tMCAXDTI2MTAxNDA2MTczN1oYDzIxMjYwOTIwMDYxNzM3WjAfMR0wGwYD
+VQQDDBRvcGVuc3NsMy5leGFtcGxlLmNvbTBZMBMGByqGSM49AgEGCCqGSM49AwEHA0IABB3TbZio
+y2nqIYmnfd77GQ4l5jm8NQOMPRnsHmyZHFPfj0swlIuSpKWEfVSAUKp2FmkM9kFpgL/w25BYm85a
+tv2jUzBRMB0GA1UdDgQWBBSu0kicbwtkpW2bC4i5mE4QmAQvCTAfBgNVHSMEGDAWgBSu0kicbwtk
+pW2bC4i5mE4QmAQvCTAPBgNVHRMBAf8EBTADAQH/MAoGCCqGSM49BAMCA0gAMEUCICVlDw3X5ub0
+pUeIbP4/HjTuwe0ac3nx/BjM7ut1FdepAiEA5YykO8pu/i3DzZIS7FGEDzAFPa5v29qlaihhdh3w
+gU8wUTBBMA0GCWCGSAFlAwQCAgUABDC0BDhLCkfD2ZfijIa6RGfa7pq29pxYUiSkJxrHIB/gla+4
+eQy2w986p7I61jMoCe0ECA9DLltyYADAAgIIAA==`,
+	"sha512": `MIICYgIBAzCCAfgGCSqGSIb3DQEHAaCCAekEggHlMIIB4TCCAd0GCSqGSIb3DQEHAaCCAc4EggHK
+MIIBxjCCAcIGCyqGSIb3DQEMCgEDoIIBsTCCAa0GCiqGSIb3DQEJFgGgggGdBIIBmTCCAZUwggE7
+oAMCAQICFD44u/pnCIYRMZ4DE+tzLyqmuHLQMAoGCCqGSM49BAMCMB8xHTAbBgNVBAMMFG9wZW5z
+c2wzLmV4YW1wbGUuY29tMCAXDTI2MTAxNDA2MTczN1oYDzIxMjYwOTIwMDYxNzM3WjAfMR0wGwYD
+VQQDDBRvcGVuc3NsMy5leGFtcGxlLmNvbTBZMBMGByqGSM49AgEGCCqGSM49AwEHA0IABB3TbZio
+y2nqIYmnfd77GQ4l5jm8NQOMPRnsHmyZHFPfj0swlIuSpKWEfVSAUKp2FmkM9kFpgL/w25BYm85a
+tv2jUzBRMB0GA1UdDgQWBBSu0kicbwtkpW2bC4i5mE4QmAQvCTAfBgNVHSMEGDAWgBSu0kicbwtk
+pW2bC4i5mE4QmAQvCTAPBgNVHRMBAf8EBTADAQH/MAoGCCqGSM49BAMCA0gAMEUCICVlDw3X5ub0
+pUeIbP4/HjTuwe0ac3nx/BjM7ut1FdepAiEA5YykO8pu/i3DzZIS7FGEDzAFPa5v29qlaihhdh3w
+gU8wYTBRMA0GCWCGSAFlAwQCAwUABEDAPvRSzfUxG5XmV6kSraj4zAnWxnBZ63sBp1jh28da1/f4
+zXsMc4Mdh02+F5XBBq/JFoA9+8JQPxs8slqs043+BAjOz0+K+VCuwwICCAA=`,
+	"sha512-224": `MIICPgIBAzCCAfgGCSqGSIb3DQEHAaCCAekEggHlMIIB4TCCAd0GCSqGSIb3DQEHAaCCAc4EggHK
+MIIBxjCCAcIGCyqGSIb3DQEMCgEDoIIBsTCCAa0GCiqGSIb3DQEJFgGgggGdBIIBmTCCAZUwggE7
+oAMCAQICFD44u/pnCIYRMZ4DE+tzLyqmuHLQMAoGCCqGSM49BAMCMB8xHTAbBgNVBAMMFG9wZW5z
+c2wzLmV4YW1wbGUuY29tMCAXDTI2MTAxNDA2MTczN1oYDzIxMjYwOTIwMDYxNzM3WjAfMR0wGwYD
+VQQDDBRvcGVuc3NsMy5leGFtcGxlLmNvbTBZMBMGByqGSM49AgEGCCqGSM49AwEHA0IABB3TbZio
+y2nqIYmnfd77GQ4l5jm8NQOMPRnsHmyZHFPfj0swlIuSpKWEfVSAUKp2FmkM9kFpgL/w25BYm85a
+tv2jUzBRMB0GA1UdDgQWBBSu0kicbwtkpW2bC4i5mE4QmAQvCTAfBgNVHSMEGDAWgBSu0kicbwtk
+pW2bC4i5mE4QmAQvCTAPBgNVHRMBAf8EBTADAQH/MAoGCCqGSM49BAMCA0gAMEUCICVlDw3X5ub0
+pUeIbP4/HjTuwe0ac3nx/BjM7ut1FdepAiEA5YykO8pu/i3DzZIS7FGEDzAFPa5v29qlaihhdh3w
+gU8wPTAtMA0GCWCGSAFlAwQCBQUABBxNkGX3tqCQjnuw24W2Hefc2R0GPhoRSAVaeKoTBAhfke7U
+OYJlfQICCAA=`,
+	"sha512-256": `MIICQgIBAzCCAfgGCSqGSIb3DQEHAaCCAekEggHlMIIB4TCCAd0GCSqGSIb3DQEHAaCCAc4EggHK
+MIIBxjCCAcIGCyqGSIb3DQEMCgEDoIIBsTCCAa0GCiqGSIb3DQEJFgGgggGdBIIBmTCCAZUwggE7
+oAMCAQICFD44u/pnCIYRMZ4DE+tzLyqmuHLQMAoGCCqGSM49BAMCMB8xHTAbBgNVBAMMFG9wZW5z
+c2wzLmV4YW1wbGUuY29tMCAXDTI2MTAxNDA2MTczN1oYDzIxMjYwOTIwMDYxNzM3WjAfMR0wGwYD
+VQQDDBRvcGVuc3NsMy5leGFtcGxlLmNvbTBZMBMGByqGSM49AgEGCCqGSM49AwEHA0IABB3TbZio
+y2nqIYmnfd77GQ4l5jm8NQOMPRnsHmyZHFPfj0swlIuSpKWEfVSAUKp2FmkM9kFpgL/w25BYm85a
+tv2jUzBRMB0GA1UdDgQWBBSu0kicbwtkpW2bC4i5mE4QmAQvCTAfBgNVHSMEGDAWgBSu0kicbwtk
+pW2bC4i5mE4QmAQvCTAPBgNVHRMBAf8EBTADAQH/MAoGCCqGSM49BAMCA0gAMEUCICVlDw3X5ub0
+pUeIbP4/HjTuwe0ac3nx/BjM7ut1FdepAiEA5YykO8pu/i3DzZIS7FGEDzAFPa5v29qlaihhdh3w
+gU8wQTAxMA0GCWCGSAFlAwQCBgUABCAknW4IGiug1ImhCvHlAjf8parXU8L+I/5F6XOgx9u9sQQI
+sBI6dzfj40MCAggA`,
+}
+
+func TestSHA2MACs(t *testing.T) {
+	for name, base64P12 := range openSSLMACTestData {
+		p12, _ := base64.StdEncoding.DecodeString(base64P12)
+		certs, err := DecodeTrustStore(p12, "password")
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if len(certs) != 1 || certs[0].Subject.CommonName != "openssl3.example.com" {
+			t.Errorf("%s: got the wrong certificates", name)
+		}
+		if _, err := DecodeTrustStore(p12, "wrong"); err != ErrIncorrectPassword {
+			t.Errorf("%s: got error %v for the wrong password", name, err)
+		}
+	}
+}
+
+func TestWithMAC(t *testing.T) {
+	key, cert := newTestCertificate(t, "mac.example.com", nil, nil)
+	for _, test := range []struct {
+		digest    crypto.Hash
+		algorithm asn1.ObjectIdentifier
+	}{
+		{crypto.SHA1, oidSHA1},
+		{crypto.SHA256, oidSHA256},
+		{crypto.SHA512, oidSHA512},
+	} {
+		pfxData, err := DefaultEncoder.WithMAC(test.digest, 100000).Encode(rand.Reader, key, cert, nil, "password")
+		if err != nil {
+			t.Fatalf("%v: %v", test.digest, err)
+		}
+		protection, err := InspectProtection(pfxData, "password")
+		if err != nil {
+			t.Fatalf("%v: %v", test.digest, err)
+		}
+		if !protection.MACAlgorithm.Equal(test.algorithm) || protection.MACIterations != 100000 {
+			t.Errorf("%v: got MAC %v with %d iterations", test.digest, protection.MACAlgorithm, protection.MACIterations)
+		}
+		if _, _, err := Decode(pfxData, "password"); err != nil {
+			t.Errorf("%v: %v", test.digest, err)
+		}
+	}
+
+	_, err := DefaultEncoder.WithMAC(crypto.MD5, 1).Encode(rand.Reader, key, cert, nil, "password")
+	if _, ok := err.(NotImplementedError); !ok {
+		t.Errorf("got error %v for an MD5 MAC, want a NotImplementedError", err)
+	}
+}
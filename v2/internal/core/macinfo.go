@@ -0,0 +1,146 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"encoding/asn1"
+	"errors"
+
+	"github.com/scholar-ink/go-pkcs12/v2/internal/der"
+)
+
+// MacInfo describes the MacData of a PKCS#12 file, which protects its
+// integrity in password integrity mode.
+type MacInfo struct {
+	// Digest identifies the digest algorithm of the HMAC and of the key
+	// derivation.
+	Digest asn1.ObjectIdentifier
+
+	// MAC is the stored MAC value.
+	MAC []byte
+
+	Salt       []byte
+	Iterations int
+
+	// Extra holds the encodings of any fields following the iteration
+	// count, which some implementations append.  RFC 7292 defines none,
+	// but they are preserved by RotateMACOnly since other validators may
+	// check them.
+	Extra [][]byte
+
+	// Raw is the DER encoding of the MacData exactly as it appears in the
+	// file.
+	Raw []byte
+}
+
+// PeekMAC returns the MacData of pfxData using DefaultDecoder.  See
+// Decoder.PeekMAC.
+func PeekMAC(pfxData []byte) (*MacInfo, error) {
+	return DefaultDecoder.PeekMAC(pfxData)
+}
+
+// PeekMAC returns the MacData of pfxData without verifying it, so that
+// tooling can record how a stored file is protected without knowing its
+// password.  It returns nil and no error if pfxData has no MacData, as in
+// public-key integrity mode.
+func (dec *Decoder) PeekMAC(pfxData []byte) (*MacInfo, error) {
+	pfx := new(pfxPdu)
+	if err := dec.unmarshalPFX(pfxData, pfx); err != nil {
+		return nil, errors.New("pkcs12: error reading P12 data: " + err.Error())
+	}
+	if pfx.Version != 3 {
+		return nil, NotImplementedError("can only decode v3 PFX PDU's")
+	}
+	if pfx.MacData.Mac.Algorithm.Algorithm == nil {
+		return nil, nil
+	}
+
+	raw, err := rawMacData(pfxData)
+	if err != nil {
+		return nil, errors.New("pkcs12: error reading P12 data: " + err.Error())
+	}
+	trailer, err := macDataTrailer(raw)
+	if err != nil {
+		return nil, errors.New("pkcs12: error reading MAC data: " + err.Error())
+	}
+	info := &MacInfo{
+		Digest:     pfx.MacData.Mac.Algorithm.Algorithm,
+		MAC:        pfx.MacData.Mac.Digest,
+		Salt:       pfx.MacData.MacSalt,
+		Iterations: pfx.MacData.Iterations,
+		Raw:        raw,
+	}
+	for s := der.NewString(trailer); !s.Empty(); {
+		_, field, err := s.ReadAnyElement()
+		if err != nil {
+			return nil, errors.New("pkcs12: error reading MAC data: " + err.Error())
+		}
+		info.Extra = append(info.Extra, field)
+	}
+	return info, nil
+}
+
+// rawMacData returns the encoded MacData of the PFX pfxData.
+func rawMacData(pfxData []byte) ([]byte, error) {
+	s := der.NewString(pfxData)
+	body, err := s.ReadElement(der.Sequence)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := body.ReadInt(); err != nil {
+		return nil, err
+	}
+	if _, err := body.ReadElement(der.Sequence); err != nil {
+		return nil, err
+	}
+	_, raw, err := body.ReadAnyElement()
+	return raw, err
+}
+
+// macDataTrailer returns the encoded fields following the iteration count
+// of the encoded MacData raw.
+func macDataTrailer(raw []byte) ([]byte, error) {
+	s := der.NewString(raw)
+	body, err := s.ReadElement(der.Sequence)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := body.ReadElement(der.Sequence); err != nil {
+		return nil, err
+	}
+	if _, err := body.ReadOctetString(); err != nil {
+		return nil, err
+	}
+	if body.PeekTag(der.Integer) {
+		if _, err := body.ReadInt(); err != nil {
+			return nil, err
+		}
+	}
+	return body.Bytes(), nil
+}
+
+// marshalPFXWithTrailer marshals pfx with trailer appended to its MacData.
+func marshalPFXWithTrailer(pfx *pfxPdu, trailer []byte) ([]byte, error) {
+	if len(trailer) == 0 {
+		return asn1.Marshal(*pfx)
+	}
+	md, err := asn1.Marshal(pfx.MacData)
+	if err != nil {
+		return nil, err
+	}
+	var macData asn1.RawValue
+	if _, err := asn1.Unmarshal(md, &macData); err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(struct {
+		Version  int
+		AuthSafe contentInfo
+		MacData  asn1.RawValue
+	}{
+		pfx.Version,
+		pfx.AuthSafe,
+		asn1.RawValue{Tag: asn1.TagSequence, IsCompound: true, Bytes: append(macData.Bytes, trailer...)},
+	})
+}
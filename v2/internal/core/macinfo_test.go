@@ -0,0 +1,82 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/asn1"
+	"testing"
+)
+
+func TestPeekMAC(t *testing.T) {
+	key, cert := newTestCertificate(t, "mac.example.com", nil, nil)
+	pfxData, err := DefaultEncoder.WithCompatibilityLevel(2024).Encode(rand.Reader, key, cert, nil, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, dec := range []*Decoder{DefaultDecoder, DefaultDecoder.WithASN1Parser(StreamParser)} {
+		info, err := dec.PeekMAC(pfxData)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !info.Digest.Equal(oidSHA256) || info.Iterations != 1 || len(info.Salt) != 8 || len(info.MAC) != 32 {
+			t.Errorf("got %+v", info)
+		}
+
+		var md macData
+		if rest, err := asn1.Unmarshal(info.Raw, &md); err != nil || len(rest) != 0 {
+			t.Fatalf("Raw is not a MacData: %v", err)
+		}
+		if !bytes.Equal(md.Mac.Digest, info.MAC) || !bytes.Contains(pfxData, info.Raw) {
+			t.Error("Raw does not match the file")
+		}
+	}
+
+	signed := signPFX(t, pfxData, key, cert, false)
+	if info, err := PeekMAC(signed); err != nil || info != nil {
+		t.Errorf("PeekMAC of a file without MAC = %v, %v", info, err)
+	}
+}
+
+func TestMacDataTrailer(t *testing.T) {
+	key, cert := newTestCertificate(t, "trailer.example.com", nil, nil)
+	pfxData, err := Encode(rand.Reader, key, cert, nil, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pfx pfxPdu
+	if err := unmarshal(pfxData, &pfx); err != nil {
+		t.Fatal(err)
+	}
+	extra, _ := asn1.Marshal(asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, Bytes: []byte("vendor")})
+	if pfxData, err = marshalPFXWithTrailer(&pfx, extra); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, dec := range []*Decoder{DefaultDecoder, DefaultDecoder.WithASN1Parser(StreamParser)} {
+		if _, _, err := dec.Decode(pfxData, "password"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rotated, err := RotateMACOnly(pfxData, "password", "new")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, data := range [][]byte{pfxData, rotated} {
+		info, err := PeekMAC(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(info.Extra) != 1 || !bytes.Equal(info.Extra[0], extra) {
+			t.Errorf("got extra fields %x, want %x", info.Extra, extra)
+		}
+	}
+	if _, err := VerifyIntegrity(rotated, "new"); err != nil {
+		t.Error(err)
+	}
+}
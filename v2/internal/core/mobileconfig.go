@@ -0,0 +1,241 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// MDMPayloadType is the PayloadType of Apple configuration profile payloads
+// carrying PKCS#12 data.
+const MDMPayloadType = "com.apple.security.pkcs12"
+
+// An MDMPayload is a com.apple.security.pkcs12 payload of an Apple
+// configuration profile (.mobileconfig), which installs a PKCS#12 identity
+// on macOS and iOS devices.
+type MDMPayload struct {
+	Identifier  string // PayloadIdentifier
+	UUID        string // PayloadUUID
+	DisplayName string // PayloadDisplayName
+	Description string // PayloadDescription
+	FileName    string // PayloadCertificateFileName
+
+	// Password is the password of Content.  If empty, the key is omitted
+	// and the device prompts the user for the password during
+	// installation.
+	Password string
+
+	// Content is the PKCS#12 data (PayloadContent).
+	Content []byte
+}
+
+// MarshalPlist returns p as an XML property list <dict> element, suitable
+// for inclusion in the PayloadContent array of a configuration profile.  If
+// p.UUID is empty, a random UUID is used.
+func (p *MDMPayload) MarshalPlist() ([]byte, error) {
+	if len(p.Content) == 0 {
+		return nil, errors.New("pkcs12: MDM payload has no content")
+	}
+	uuid := p.UUID
+	if uuid == "" {
+		var err error
+		if uuid, err = randomUUID(); err != nil {
+			return nil, err
+		}
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("<dict>\n")
+	writeString := func(key, value string) {
+		if value == "" {
+			return
+		}
+		writePlistKey(&buf, key)
+		buf.WriteString("\t<string>")
+		xml.EscapeText(&buf, []byte(value))
+		buf.WriteString("</string>\n")
+	}
+	writeString("Password", p.Password)
+	writeString("PayloadCertificateFileName", p.FileName)
+	writePlistKey(&buf, "PayloadContent")
+	buf.WriteString("\t<data>")
+	buf.WriteString(base64.StdEncoding.EncodeToString(p.Content))
+	buf.WriteString("</data>\n")
+	writeString("PayloadDescription", p.Description)
+	writeString("PayloadDisplayName", p.DisplayName)
+	writeString("PayloadIdentifier", p.Identifier)
+	writeString("PayloadType", MDMPayloadType)
+	writeString("PayloadUUID", uuid)
+	writePlistKey(&buf, "PayloadVersion")
+	buf.WriteString("\t<integer>1</integer>\n")
+	buf.WriteString("</dict>\n")
+	return buf.Bytes(), nil
+}
+
+func writePlistKey(buf *bytes.Buffer, key string) {
+	buf.WriteString("\t<key>")
+	xml.EscapeText(buf, []byte(key))
+	buf.WriteString("</key>\n")
+}
+
+// ParseMDMPayloads returns every com.apple.security.pkcs12 payload found in
+// plist, which may be a complete configuration profile, a bare payload
+// <dict>, or any XML property list containing such payloads.  Signed
+// (CMS-wrapped) profiles must be unwrapped by the caller first.
+func ParseMDMPayloads(plist []byte) ([]*MDMPayload, error) {
+	d := xml.NewDecoder(bytes.NewReader(plist))
+	var payloads []*MDMPayload
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			return payloads, nil
+		}
+		if err != nil {
+			return nil, errors.New("pkcs12: error parsing property list: " + err.Error())
+		}
+		if start, ok := tok.(xml.StartElement); ok && start.Name.Local != "plist" {
+			value, err := parsePlistValue(d, start)
+			if err != nil {
+				return nil, err
+			}
+			if payloads, err = collectMDMPayloads(payloads, value); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+// collectMDMPayloads appends every PKCS#12 payload dictionary reachable from
+// value to payloads.
+func collectMDMPayloads(payloads []*MDMPayload, value interface{}) ([]*MDMPayload, error) {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		if value["PayloadType"] == MDMPayloadType {
+			p := &MDMPayload{}
+			p.Identifier, _ = value["PayloadIdentifier"].(string)
+			p.UUID, _ = value["PayloadUUID"].(string)
+			p.DisplayName, _ = value["PayloadDisplayName"].(string)
+			p.Description, _ = value["PayloadDescription"].(string)
+			p.FileName, _ = value["PayloadCertificateFileName"].(string)
+			p.Password, _ = value["Password"].(string)
+			var ok bool
+			if p.Content, ok = value["PayloadContent"].([]byte); !ok {
+				return nil, errors.New("pkcs12: MDM payload has no PayloadContent data")
+			}
+			return append(payloads, p), nil
+		}
+		for _, v := range value {
+			var err error
+			if payloads, err = collectMDMPayloads(payloads, v); err != nil {
+				return nil, err
+			}
+		}
+	case []interface{}:
+		for _, v := range value {
+			var err error
+			if payloads, err = collectMDMPayloads(payloads, v); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return payloads, nil
+}
+
+// parsePlistValue parses the XML property list value starting with start.
+// Dictionaries are returned as map[string]interface{}, arrays as
+// []interface{}, data as []byte, integers as int64, booleans as bool, and
+// all other values as strings.
+func parsePlistValue(d *xml.Decoder, start xml.StartElement) (interface{}, error) {
+	switch start.Name.Local {
+	case "dict":
+		dict := make(map[string]interface{})
+		var key *string
+		for {
+			tok, err := d.Token()
+			if err != nil {
+				return nil, errors.New("pkcs12: error parsing property list: " + err.Error())
+			}
+			switch tok := tok.(type) {
+			case xml.EndElement:
+				return dict, nil
+			case xml.StartElement:
+				value, err := parsePlistValue(d, tok)
+				if err != nil {
+					return nil, err
+				}
+				if tok.Name.Local == "key" {
+					k := value.(string)
+					key = &k
+				} else if key != nil {
+					dict[*key] = value
+					key = nil
+				}
+			}
+		}
+	case "array":
+		var array []interface{}
+		for {
+			tok, err := d.Token()
+			if err != nil {
+				return nil, errors.New("pkcs12: error parsing property list: " + err.Error())
+			}
+			switch tok := tok.(type) {
+			case xml.EndElement:
+				return array, nil
+			case xml.StartElement:
+				value, err := parsePlistValue(d, tok)
+				if err != nil {
+					return nil, err
+				}
+				array = append(array, value)
+			}
+		}
+	case "true", "false":
+		if err := d.Skip(); err != nil {
+			return nil, err
+		}
+		return start.Name.Local == "true", nil
+	}
+
+	var text string
+	if err := d.DecodeElement(&text, &start); err != nil {
+		return nil, errors.New("pkcs12: error parsing property list: " + err.Error())
+	}
+	switch start.Name.Local {
+	case "data":
+		data, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(text), ""))
+		if err != nil {
+			return nil, errors.New("pkcs12: invalid property list data: " + err.Error())
+		}
+		return data, nil
+	case "integer":
+		n, err := strconv.ParseInt(strings.TrimSpace(text), 10, 64)
+		if err != nil {
+			return nil, errors.New("pkcs12: invalid property list integer: " + err.Error())
+		}
+		return n, nil
+	}
+	return text, nil
+}
+
+// randomUUID returns a random (version 4) UUID in its canonical form.
+func randomUUID() (string, error) {
+	var u [16]byte
+	if _, err := rand.Read(u[:]); err != nil {
+		return "", err
+	}
+	u[6] = u[6]&0x0f | 0x40
+	u[8] = u[8]&0x3f | 0x80
+	h := strings.ToUpper(hex.EncodeToString(u[:]))
+	return h[:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:], nil
+}
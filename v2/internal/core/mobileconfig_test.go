@@ -0,0 +1,82 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"bytes"
+	"crypto/rand"
+	"strings"
+	"testing"
+)
+
+func TestMDMPayload(t *testing.T) {
+	key, cert := newTestCertificate(t, "mdm.example.com", nil, nil)
+	pfxData, err := Encode(rand.Reader, key, cert, nil, "p&ssword")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payload := &MDMPayload{
+		Identifier:  "com.example.identity",
+		DisplayName: "Device <identity>",
+		FileName:    "device.p12",
+		Password:    "p&ssword",
+		Content:     pfxData,
+	}
+	dict, err := payload.MarshalPlist()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	profile := `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>PayloadContent</key>
+	<array>
+		<dict>
+			<key>PayloadType</key>
+			<string>com.apple.wifi.managed</string>
+			<key>AutoJoin</key>
+			<true/>
+		</dict>
+		` + string(dict) + `
+	</array>
+	<key>PayloadType</key>
+	<string>Configuration</string>
+	<key>PayloadVersion</key>
+	<integer>1</integer>
+</dict>
+</plist>`
+
+	payloads, err := ParseMDMPayloads([]byte(profile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(payloads) != 1 {
+		t.Fatalf("got %d payloads, want 1", len(payloads))
+	}
+	got := payloads[0]
+	if got.Identifier != payload.Identifier || got.DisplayName != payload.DisplayName || got.FileName != payload.FileName || got.Password != payload.Password {
+		t.Errorf("got %+v, want %+v", got, payload)
+	}
+	if len(got.UUID) != 36 {
+		t.Errorf("got UUID %q", got.UUID)
+	}
+	if !bytes.Equal(got.Content, pfxData) {
+		t.Error("content does not round-trip")
+	}
+	if _, _, err := Decode(got.Content, got.Password); err != nil {
+		t.Error(err)
+	}
+
+	payload.Password = ""
+	if dict, err = payload.MarshalPlist(); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(dict), "<key>Password</key>") {
+		t.Error("empty password was included")
+	}
+}
@@ -0,0 +1,271 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"math/big"
+
+	"github.com/scholar-ink/go-pkcs12/v2/internal/brainpool"
+	"github.com/scholar-ink/go-pkcs12/v2/internal/der"
+	"github.com/scholar-ink/go-pkcs12/v2/internal/secp256k1"
+)
+
+// The named curves of this file are those which this package implements
+// but crypto/x509 does not: the Brainpool curves, which are always
+// decoded, and secp256k1, which is decoded only by a Decoder configured
+// with WithSecp256k1.  ECDSA keys on any of them are encoded.
+
+// ecPrivateKey is the SEC 1 ECPrivateKey structure, RFC 5915 section 3.
+type ecPrivateKey struct {
+	Version       int
+	PrivateKey    []byte
+	NamedCurveOID asn1.ObjectIdentifier `asn1:"optional,explicit,tag:0"`
+	PublicKey     asn1.BitString        `asn1:"optional,explicit,tag:1"`
+}
+
+// namedCurveOID returns the object identifier of curve, and reports whether
+// it is one of the named curves of this file.
+func namedCurveOID(curve elliptic.Curve) (asn1.ObjectIdentifier, bool) {
+	switch curve {
+	case brainpool.P256r1():
+		return oidNamedCurveBrainpoolP256r1, true
+	case brainpool.P384r1():
+		return oidNamedCurveBrainpoolP384r1, true
+	case brainpool.P512r1():
+		return oidNamedCurveBrainpoolP512r1, true
+	case secp256k1.S256():
+		return oidNamedCurveSecp256k1, true
+	}
+	return nil, false
+}
+
+// anyNamedCurve returns the named curve of this file identified by oid, or
+// nil.
+func anyNamedCurve(oid asn1.ObjectIdentifier) elliptic.Curve {
+	if curve := brainpoolCurve(oid); curve != nil {
+		return curve
+	}
+	return secp256k1Curve(oid)
+}
+
+// marshalNamedECPrivateKey returns the SEC 1 encoding of key, which is on
+// a named curve of this file, naming the curve if curveOID is not nil.
+func marshalNamedECPrivateKey(key *ecdsa.PrivateKey, curveOID asn1.ObjectIdentifier) ([]byte, error) {
+	params := key.Curve.Params()
+	if key.D == nil || key.X == nil || key.Y == nil {
+		return nil, errors.New("pkcs12: invalid " + params.Name + " private key")
+	}
+	privateKey := key.D.FillBytes(make([]byte, (params.N.BitLen()+7)/8))
+	defer clear(privateKey)
+	publicKey := elliptic.Marshal(key.Curve, key.X, key.Y)
+	return asn1.Marshal(ecPrivateKey{
+		Version:       1,
+		PrivateKey:    privateKey,
+		NamedCurveOID: curveOID,
+		PublicKey:     asn1.BitString{Bytes: publicKey, BitLength: 8 * len(publicKey)},
+	})
+}
+
+// parseNamedECPrivateKey parses the SEC 1 encoding of a private key on
+// curve.
+func parseNamedECPrivateKey(curve elliptic.Curve, sec1 *ecPrivateKey) (*ecdsa.PrivateKey, error) {
+	if sec1.Version != 1 {
+		return nil, errors.New("pkcs12: unknown EC private key version")
+	}
+	params := curve.Params()
+	d := new(big.Int).SetBytes(sec1.PrivateKey)
+	if d.Sign() <= 0 || d.Cmp(params.N) >= 0 || len(sec1.PrivateKey) > (params.N.BitLen()+7)/8 {
+		return nil, errors.New("pkcs12: invalid " + params.Name + " private key value")
+	}
+	key := &ecdsa.PrivateKey{D: d}
+	key.Curve = curve
+	key.X, key.Y = curve.ScalarBaseMult(sec1.PrivateKey)
+	return key, nil
+}
+
+// marshalECPrivateKey is like x509.MarshalECPrivateKey, but also accepts
+// keys on the named curves of this file.
+func marshalECPrivateKey(key *ecdsa.PrivateKey) ([]byte, error) {
+	if oid, ok := namedCurveOID(key.Curve); ok {
+		return marshalNamedECPrivateKey(key, oid)
+	}
+	return x509.MarshalECPrivateKey(key)
+}
+
+// parseECPrivateKey is like x509.ParseECPrivateKey, but also parses keys on
+// the Brainpool curves.
+func parseECPrivateKey(der []byte) (*ecdsa.PrivateKey, error) {
+	var sec1 ecPrivateKey
+	if err := unmarshal(der, &sec1); err == nil {
+		if curve := brainpoolCurve(sec1.NamedCurveOID); curve != nil {
+			return parseNamedECPrivateKey(curve, &sec1)
+		}
+	}
+	return x509.ParseECPrivateKey(der)
+}
+
+// marshalNamedCurvePrivateKey returns the PKCS#8 encoding of privateKey,
+// RFC 5915 section 2, and reports whether it is an ECDSA key on a named
+// curve of this file, which x509.MarshalPKCS8PrivateKey rejects.
+func marshalNamedCurvePrivateKey(privateKey interface{}) (der []byte, ok bool, err error) {
+	key, isECDSA := privateKey.(*ecdsa.PrivateKey)
+	if !isECDSA || key == nil {
+		return nil, false, nil
+	}
+	oid, ok := namedCurveOID(key.Curve)
+	if !ok {
+		return nil, false, nil
+	}
+	curveParams, err := asn1.Marshal(oid)
+	if err != nil {
+		return nil, true, err
+	}
+	sec1, err := marshalNamedECPrivateKey(key, nil)
+	if err != nil {
+		return nil, true, err
+	}
+	defer clear(sec1)
+	der, err = asn1.Marshal(pkcs8{
+		Algorithm: pkix.AlgorithmIdentifier{
+			Algorithm:  oidECPublicKey,
+			Parameters: asn1.RawValue{FullBytes: curveParams},
+		},
+		PrivateKey: sec1,
+	})
+	return der, true, err
+}
+
+// parseNamedCurvePrivateKey returns the *ecdsa.PrivateKey held by privKey,
+// and reports whether privKey is an EC key on a curve returned by curves,
+// which x509.ParsePKCS8PrivateKey rejects as an unknown curve.
+func parseNamedCurvePrivateKey(privKey *pkcs8, curves func(asn1.ObjectIdentifier) elliptic.Curve) (key interface{}, ok bool, err error) {
+	if !privKey.Algorithm.Algorithm.Equal(oidECPublicKey) {
+		return nil, false, nil
+	}
+	var curveOID asn1.ObjectIdentifier
+	if err := unmarshal(privKey.Algorithm.Parameters.FullBytes, &curveOID); err != nil {
+		return nil, false, nil
+	}
+	curve := curves(curveOID)
+	if curve == nil {
+		return nil, false, nil
+	}
+	name := curve.Params().Name
+	var sec1 ecPrivateKey
+	if err := unmarshal(privKey.PrivateKey, &sec1); err != nil {
+		return nil, true, errors.New("pkcs12: invalid " + name + " private key: " + err.Error())
+	}
+	if sec1.NamedCurveOID != nil && !sec1.NamedCurveOID.Equal(curveOID) {
+		return nil, true, errors.New("pkcs12: " + name + " private key names two different curves")
+	}
+	ecKey, err := parseNamedECPrivateKey(curve, &sec1)
+	if err != nil {
+		return nil, true, err
+	}
+	return ecKey, true, nil
+}
+
+// encodedOIDECPublicKey is the DER encoding of oidECPublicKey.
+var encodedOIDECPublicKey = []byte{0x06, 0x07, 0x2a, 0x86, 0x48, 0xce, 0x3d, 0x02, 0x01}
+
+// parseCertificate is like x509.ParseCertificate, but also parses
+// certificates whose public key is on a Brainpool curve.  See
+// parseNamedCurveCertificate.
+func parseCertificate(asn1Data []byte) (*x509.Certificate, error) {
+	return parseNamedCurveCertificate(asn1Data, brainpoolCurve)
+}
+
+// parseNamedCurveCertificate is like x509.ParseCertificate, but also parses
+// certificates whose public key is on a curve returned by curves, which
+// crypto/x509 rejects as an unsupported elliptic curve.  Such a
+// certificate is parsed from a copy in which the key's algorithm is
+// replaced by one of the same length which crypto/x509 skips, after which
+// the algorithm and the *ecdsa.PublicKey are filled in and the Raw fields
+// which differ are pointed back at asn1Data.
+func parseNamedCurveCertificate(asn1Data []byte, curves func(asn1.ObjectIdentifier) elliptic.Curve) (*x509.Certificate, error) {
+	cert, err := x509.ParseCertificate(asn1Data)
+	if err == nil {
+		return cert, nil
+	}
+	certFull, tbsFull, spkiOffset, spkiFull, ok := findSubjectPublicKeyInfo(asn1Data)
+	if !ok {
+		return nil, err
+	}
+	var spki subjectPublicKeyInfo
+	if unmarshal(spkiFull, &spki) != nil || !spki.Algorithm.Algorithm.Equal(oidECPublicKey) {
+		return nil, err
+	}
+	var curveOID asn1.ObjectIdentifier
+	if unmarshal(spki.Algorithm.Parameters.FullBytes, &curveOID) != nil {
+		return nil, err
+	}
+	curve := curves(curveOID)
+	if curve == nil {
+		return nil, err
+	}
+	x, y := elliptic.Unmarshal(curve, spki.PublicKey.RightAlign())
+	if x == nil {
+		return nil, errors.New("pkcs12: invalid " + curve.Params().Name + " public key in certificate")
+	}
+
+	i := bytes.Index(spkiFull, encodedOIDECPublicKey)
+	if i < 0 {
+		return nil, err
+	}
+	masked := bytes.Clone(asn1Data)
+	masked[spkiOffset+i+len(encodedOIDECPublicKey)-1] = 0x7f
+	cert, maskedErr := x509.ParseCertificate(masked)
+	if maskedErr != nil {
+		return nil, err
+	}
+	cert.Raw = certFull
+	cert.RawTBSCertificate = tbsFull
+	cert.RawSubjectPublicKeyInfo = spkiFull
+	cert.PublicKeyAlgorithm = x509.ECDSA
+	cert.PublicKey = &ecdsa.PublicKey{Curve: curve, X: x, Y: y}
+	return cert, nil
+}
+
+// findSubjectPublicKeyInfo returns the complete encodings of the
+// certificate certData, of its TBSCertificate, and of its
+// SubjectPublicKeyInfo, together with the offset of the latter in
+// certData.
+func findSubjectPublicKeyInfo(certData []byte) (certFull, tbsFull []byte, spkiOffset int, spkiFull []byte, ok bool) {
+	s := der.NewString(certData)
+	if !s.PeekTag(der.Sequence) {
+		return nil, nil, 0, nil, false
+	}
+	certificate, certFull, err := s.ReadAnyElement()
+	if err != nil || !certificate.PeekTag(der.Sequence) {
+		return nil, nil, 0, nil, false
+	}
+	tbs, tbsFull, err := certificate.ReadAnyElement()
+	if err != nil {
+		return nil, nil, 0, nil, false
+	}
+	if tbs.PeekTag(der.Tag(0).ContextSpecific().Constructed()) {
+		if _, _, err := tbs.ReadAnyElement(); err != nil {
+			return nil, nil, 0, nil, false
+		}
+	}
+	// serialNumber, signature, issuer, validity and subject.
+	for i := 0; i < 5; i++ {
+		if _, _, err := tbs.ReadAnyElement(); err != nil {
+			return nil, nil, 0, nil, false
+		}
+	}
+	spkiOffset = tbs.Offset()
+	if _, spkiFull, err = tbs.ReadAnyElement(); err != nil {
+		return nil, nil, 0, nil, false
+	}
+	return certFull, tbsFull, spkiOffset, spkiFull, true
+}
@@ -0,0 +1,209 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"errors"
+
+	"github.com/scholar-ink/go-pkcs12/v2/internal/der"
+)
+
+// An ASN1Parser selects the ASN.1 implementation which a Decoder uses for
+// the outer structure of PKCS#12 files: the PFX, the AuthenticatedSafe and
+// the SafeContents.  The contents of individual bags are always parsed
+// with encoding/asn1.
+type ASN1Parser int
+
+const (
+	// ReflectParser parses with encoding/asn1.  It is the default.
+	ReflectParser ASN1Parser = iota
+
+	// StreamParser parses with a non-reflective DER reader modeled on
+	// golang.org/x/crypto/cryptobyte.  It is faster and allocates
+	// less, which matters to services decoding many files, and its
+	// syntax errors give the byte offset at which parsing failed.  It
+	// is intended to accept exactly the inputs that ReflectParser
+	// accepts, and to produce the same result.
+	StreamParser
+)
+
+// explicitTag0 is the tag of the [0] EXPLICIT content of ContentInfos and
+// SafeBags.
+var explicitTag0 = der.Tag(0).Constructed().ContextSpecific()
+
+// WithASN1Parser returns a copy of dec which uses parser.
+func (dec Decoder) WithASN1Parser(parser ASN1Parser) *Decoder {
+	dec.parser = parser
+	return &dec
+}
+
+// unmarshalPFX unmarshals a PFX with dec's parser.
+func (dec *Decoder) unmarshalPFX(data []byte, pfx *pfxPdu) error {
+	if dec.parser != StreamParser {
+		return unmarshal(data, pfx)
+	}
+	s := der.NewString(data)
+	body, err := s.ReadElement(der.Sequence)
+	if err != nil {
+		return err
+	}
+	if !s.Empty() {
+		return errors.New("pkcs12: trailing data found")
+	}
+	if pfx.Version, err = body.ReadInt(); err != nil {
+		return err
+	}
+	if err := readContentInfo(&body, &pfx.AuthSafe); err != nil {
+		return err
+	}
+	if body.PeekTag(der.Sequence) {
+		return readMacData(&body, &pfx.MacData)
+	}
+	return nil
+}
+
+// unmarshalAuthenticatedSafe unmarshals an AuthenticatedSafe with dec's
+// parser.
+func (dec *Decoder) unmarshalAuthenticatedSafe(data []byte) (authenticatedSafe []contentInfo, err error) {
+	if dec.parser != StreamParser {
+		err = unmarshal(data, &authenticatedSafe)
+		return authenticatedSafe, err
+	}
+	s := der.NewString(data)
+	body, err := s.ReadElement(der.Sequence)
+	if err != nil {
+		return nil, err
+	}
+	if !s.Empty() {
+		return nil, errors.New("pkcs12: trailing data found")
+	}
+	authenticatedSafe = make([]contentInfo, 0)
+	for !body.Empty() {
+		var ci contentInfo
+		if err := readContentInfo(&body, &ci); err != nil {
+			return nil, err
+		}
+		authenticatedSafe = append(authenticatedSafe, ci)
+	}
+	return authenticatedSafe, nil
+}
+
+// streamSafeContents reads a SafeContents with StreamParser, returning any
+// data following it.
+func streamSafeContents(data []byte, safeContents *[]safeBag) (trailing []byte, err error) {
+	s := der.NewString(data)
+	body, err := s.ReadElement(der.Sequence)
+	if err != nil {
+		return nil, err
+	}
+	bags := make([]safeBag, 0, countElements(body))
+	for !body.Empty() {
+		var bag safeBag
+		if err := readSafeBag(&body, &bag); err != nil {
+			return nil, err
+		}
+		bags = append(bags, bag)
+	}
+	*safeContents = bags
+	return s.Bytes(), nil
+}
+
+// countElements returns the number of elements in s, stopping at the first
+// malformed one.
+func countElements(s der.String) (n int) {
+	for ; !s.Empty(); n++ {
+		if _, _, err := s.ReadAnyElement(); err != nil {
+			break
+		}
+	}
+	return n
+}
+
+func readContentInfo(s *der.String, ci *contentInfo) (err error) {
+	body, err := s.ReadElement(der.Sequence)
+	if err != nil {
+		return err
+	}
+	if ci.ContentType, err = body.ReadOID(); err != nil {
+		return err
+	}
+	if body.PeekTag(explicitTag0) {
+		ci.Content, err = body.ReadAnyRawValue()
+	}
+	return err
+}
+
+func readMacData(s *der.String, md *macData) (err error) {
+	body, err := s.ReadElement(der.Sequence)
+	if err != nil {
+		return err
+	}
+	digestInfo, err := body.ReadElement(der.Sequence)
+	if err != nil {
+		return err
+	}
+	algorithm, err := digestInfo.ReadElement(der.Sequence)
+	if err != nil {
+		return err
+	}
+	if md.Mac.Algorithm.Algorithm, err = algorithm.ReadOID(); err != nil {
+		return err
+	}
+	if !algorithm.Empty() {
+		if md.Mac.Algorithm.Parameters, err = algorithm.ReadAnyRawValue(); err != nil {
+			return err
+		}
+	}
+	if md.Mac.Digest, err = digestInfo.ReadOctetString(); err != nil {
+		return err
+	}
+	if md.MacSalt, err = body.ReadOctetString(); err != nil {
+		return err
+	}
+	md.Iterations = 1
+	if body.PeekTag(der.Integer) {
+		if md.Iterations, err = body.ReadInt(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readSafeBag(s *der.String, bag *safeBag) (err error) {
+	body, err := s.ReadElement(der.Sequence)
+	if err != nil {
+		return err
+	}
+	if bag.Id, err = body.ReadOID(); err != nil {
+		return err
+	}
+	if bag.Value, err = body.ReadRawValue(explicitTag0); err != nil {
+		return err
+	}
+
+	if !body.PeekTag(der.Set) {
+		return nil
+	}
+	attributes, err := body.ReadElement(der.Set)
+	if err != nil {
+		return err
+	}
+	bag.Attributes = make([]pkcs12Attribute, 0, countElements(attributes))
+	for !attributes.Empty() {
+		var attribute pkcs12Attribute
+		attr, err := attributes.ReadElement(der.Sequence)
+		if err != nil {
+			return err
+		}
+		if attribute.Id, err = attr.ReadOID(); err != nil {
+			return err
+		}
+		if attribute.Value, err = attr.ReadAnyRawValue(); err != nil {
+			return err
+		}
+		bag.Attributes = append(bag.Attributes, attribute)
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/scholar-ink/go-pkcs12/v2/internal/der"
+)
+
+// parserTestInputs returns PKCS#12 files exercising both parsers, with
+// their passwords.
+func parserTestInputs(t testing.TB) (inputs [][]byte, passwords []string) {
+	for _, base64P12 := range testdata {
+		p12, _ := base64.StdEncoding.DecodeString(base64P12)
+		inputs, passwords = append(inputs, p12), append(passwords, "")
+	}
+
+	rootKey, root := newTestCertificate(t, "Parser Root", nil, nil)
+	key, leaf := newTestCertificate(t, "parser.example.com", root, rootKey)
+	for _, enc := range []*Encoder{DefaultEncoder, Legacy} {
+		pfxData, err := enc.Encode(rand.Reader, key, leaf, []*x509.Certificate{root}, "password")
+		if err != nil {
+			t.Fatal(err)
+		}
+		inputs, passwords = append(inputs, pfxData), append(passwords, "password")
+	}
+	trustStore, err := EncodeTrustStore(rand.Reader, []*x509.Certificate{root, leaf}, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	inputs, passwords = append(inputs, trustStore), append(passwords, "password")
+	return inputs, passwords
+}
+
+// compareParsers checks that ReflectParser and StreamParser agree on
+// pfxData.
+func compareParsers(t *testing.T, pfxData []byte, password string) {
+	encodedPassword, _ := bmpString(password)
+	reflectBags, reflectPassword, reflectErr := DefaultDecoder.getSafeContents(pfxData, encodedPassword)
+	streamBags, streamPassword, streamErr := DefaultDecoder.WithASN1Parser(StreamParser).getSafeContents(pfxData, encodedPassword)
+	if (reflectErr == nil) != (streamErr == nil) {
+		t.Fatalf("parsers disagree: ReflectParser error %v, StreamParser error %v", reflectErr, streamErr)
+	}
+	if reflectErr != nil {
+		return
+	}
+	if !reflect.DeepEqual(reflectBags, streamBags) || !bytes.Equal(reflectPassword, streamPassword) {
+		t.Fatalf("parsers disagree on %x", pfxData)
+	}
+}
+
+func TestStreamParser(t *testing.T) {
+	inputs, passwords := parserTestInputs(t)
+	for i, pfxData := range inputs {
+		compareParsers(t, pfxData, passwords[i])
+
+		// Truncations and bit flips in the outer structure, which is
+		// covered by the MAC, are rejected by both parsers unless the
+		// MAC is broken too; this exercises the error paths.
+		for _, n := range []int{0, 1, 2, 4, 16, len(pfxData) / 2, len(pfxData) - 1} {
+			compareParsers(t, pfxData[:n], passwords[i])
+		}
+		for _, pos := range []int{1, 3, 5, 8, 20} {
+			corrupted := append([]byte{}, pfxData...)
+			corrupted[pos] ^= 0x40
+			compareParsers(t, corrupted, passwords[i])
+		}
+	}
+}
+
+func TestStreamParserErrorOffset(t *testing.T) {
+	key, cert := newTestCertificate(t, "offset.example.com", nil, nil)
+	pfxData, err := Encode(rand.Reader, key, cert, nil, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Corrupt the tag of the AuthSafe ContentInfo, which follows the
+	// PFX header and the three-byte version.
+	header := len(pfxData) - len(mustContents(t, pfxData))
+	pfxData[header+3] = 0x04
+
+	_, _, err = DefaultDecoder.WithASN1Parser(StreamParser).DecodeChain(pfxData, "password")
+	want := (&der.SyntaxError{Offset: header + 3, Msg: "unexpected tag 4"}).Error()
+	if err == nil || !strings.HasSuffix(err.Error(), want) {
+		t.Errorf("got error %v, want %q", err, want)
+	}
+}
+
+// mustContents returns the contents of the DER element der.
+func mustContents(t *testing.T, data []byte) []byte {
+	var raw asn1.RawValue
+	if err := unmarshal(data, &raw); err != nil {
+		t.Fatal(err)
+	}
+	return raw.Bytes
+}
+
+func FuzzASN1Parser(f *testing.F) {
+	inputs, passwords := parserTestInputs(f)
+	for i := range inputs {
+		f.Add(inputs[i], passwords[i])
+	}
+	f.Fuzz(compareParsers)
+}
+
+func BenchmarkASN1Parser(b *testing.B) {
+	var bags []safeBag
+	for i := 0; i < 100; i++ {
+		_, cert := newTestCertificate(b, "benchmark.example.com", nil, nil)
+		bag, err := makeCertBag(cert.Raw, nil)
+		if err != nil {
+			b.Fatal(err)
+		}
+		bags = append(bags, *bag)
+	}
+	data, err := asn1.Marshal(bags)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	for _, parser := range []struct {
+		name   string
+		parser ASN1Parser
+	}{{"ReflectParser", ReflectParser}, {"StreamParser", StreamParser}} {
+		dec := DefaultDecoder.WithASN1Parser(parser.parser)
+		b.Run(parser.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				var safeContents []safeBag
+				if err := dec.unmarshalSafeContents(data, &safeContents); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"hash"
+
+	"github.com/scholar-ink/go-pkcs12/v2/internal/rc2"
+)
+
+// PKCS#5 v1.5 (PBES1) schemes, RFC 8018 appendix A.3.
+var (
+	oidPBEWithMD5AndDESCBC  = asn1.ObjectIdentifier([]int{1, 2, 840, 113549, 1, 5, 3})
+	oidPBEWithMD5AndRC2CBC  = asn1.ObjectIdentifier([]int{1, 2, 840, 113549, 1, 5, 6})
+	oidPBEWithSHA1AndDESCBC = asn1.ObjectIdentifier([]int{1, 2, 840, 113549, 1, 5, 10})
+	oidPBEWithSHA1AndRC2CBC = asn1.ObjectIdentifier([]int{1, 2, 840, 113549, 1, 5, 11})
+)
+
+// isPBES1 reports whether algorithm is one of the supported PBES1 schemes.
+func isPBES1(algorithm asn1.ObjectIdentifier) bool {
+	return algorithm.Equal(oidPBEWithMD5AndDESCBC) || algorithm.Equal(oidPBEWithMD5AndRC2CBC) ||
+		algorithm.Equal(oidPBEWithSHA1AndDESCBC) || algorithm.Equal(oidPBEWithSHA1AndRC2CBC)
+}
+
+// pbkdf1 implements PBKDF1 of RFC 8018, section 5.1, returning 16 bytes of
+// key material: the DES or RC2 key followed by the IV.
+func pbkdf1(newHash func() hash.Hash, password, salt []byte, iterations int, m *kdfMonitor) []byte {
+	h := newHash()
+	h.Write(password)
+	h.Write(salt)
+	t := h.Sum(nil)
+	if !m.iteration(1, iterations) {
+		return nil
+	}
+	for i := 1; i < iterations; i++ {
+		h.Reset()
+		h.Write(t)
+		t = h.Sum(t[:0])
+		if !m.iteration(i+1, iterations) {
+			return nil
+		}
+	}
+	return t[:16]
+}
+
+// pbes1CipherFor returns the block cipher and IV of the PBES1 algorithm.
+// password is the BMPString encoding used by the PKCS#12 KDF; PBES1 takes
+// the octets of the password itself, as OpenSSL does.
+func pbes1CipherFor(algorithm pkix.AlgorithmIdentifier, password []byte, m *kdfMonitor) (cipher.Block, []byte, error) {
+	var newHash func() hash.Hash
+	switch {
+	case algorithm.Algorithm.Equal(oidPBEWithMD5AndDESCBC), algorithm.Algorithm.Equal(oidPBEWithMD5AndRC2CBC):
+		newHash = md5.New
+	default:
+		newHash = sha1.New
+	}
+
+	var params pbeParams
+	if err := unmarshal(algorithm.Parameters.FullBytes, &params); err != nil {
+		return nil, nil, err
+	}
+	utf8Password, err := decodeBMPString(password)
+	if err != nil {
+		return nil, nil, err
+	}
+	dk := pbkdf1(newHash, []byte(utf8Password), params.Salt, params.Iterations, m)
+	if err := m.err(); err != nil {
+		return nil, nil, err
+	}
+
+	var block cipher.Block
+	switch {
+	case algorithm.Algorithm.Equal(oidPBEWithMD5AndDESCBC), algorithm.Algorithm.Equal(oidPBEWithSHA1AndDESCBC):
+		block, err = des.NewCipher(dk[:8])
+	default:
+		// RFC 8018 fixes the effective key length of RC2 at 64 bits.
+		block, err = rc2.New(dk[:8], 64)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return block, dk[8:16], nil
+}
@@ -0,0 +1,137 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"crypto/ecdsa"
+	"encoding/base64"
+	"errors"
+	"testing"
+)
+
+func TestPBES1ShroudedKeys(t *testing.T) {
+	for name, base64P12 := range pbes1Testdata {
+		p12, _ := base64.StdEncoding.DecodeString(base64P12)
+
+		_, _, err := Decode(p12, "password")
+		var notImplemented NotImplementedError
+		if !errors.As(err, &notImplemented) {
+			t.Errorf("%s: got error %v by default, want NotImplementedError", name, err)
+		}
+
+		dec := DefaultDecoder.WithAllowInsecure(true)
+		privateKey, certificate, err := dec.Decode(p12, "password")
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if key, ok := privateKey.(*ecdsa.PrivateKey); !ok || !key.PublicKey.Equal(certificate.PublicKey) {
+			t.Errorf("%s: private key does not match certificate", name)
+		}
+		if _, _, err := dec.Decode(p12, "wrong"); err != ErrIncorrectPassword {
+			t.Errorf("%s: got error %v with the wrong password, want ErrIncorrectPassword", name, err)
+		}
+		if _, err := dec.ToPEM(p12, "password"); err != nil {
+			t.Errorf("%s: ToPEM: %v", name, err)
+		}
+	}
+}
+
+// pbes1Testdata are files whose key is shrouded with a PKCS#5 v1.5 scheme,
+// generated by OpenSSL 3 with "-legacy -keypbe <name>" and the password
+// "password".  In the last, the certificates are encrypted with PBES1 as
+// well.
+var pbes1Testdata = map[string]string{
+	// pbeWithMD5AndDES-CBC
+	"PBE-MD5-DES": `MIIDkQIBAzCCA1cGCSqGSIb3DQEHAaCCA0gEggNEMIIDQDCCAjcGCSqGSIb3DQEHBqCCAigwggIk
+AgEAMIICHQYJKoZIhvcNAQcBMBwGCiqGSIb3DQEMAQMwDgQIEaG/55Cdiv8CAggAgIIB8EpeTHp5
+fPO+Qf/j96lF92KMPQDfoZtCpLPOpeu5wtRvYZI1Fg9u6a7ZskyC/O90CPynB7AACc0lTHxt0HLN
+uEYfd/W8IxM3HrjJ2/Z1g2XxLCigXl0HCxOzrIS989qSwpZ+4y1Wp3U6cepS0Xttn5zhb9HBx8MA
+mMRLymZpM1YID7qczptMpUpYsuQF3CHd/HPlrCwkDIN35E8AetHvuSrRrmFeWuG+V//QbxpYbFzh
+hCX9jlj90Js5Ucyergmi6KcFye4p5m1RAdx1D0RN96f9JPcRKO5wgqqk5QllDGS0zirWieVuZHwk
+lpAXyuTvcZYTw6RXWuyy8aXmkJs+1ThY5V88wbBGEd/oSmzK+NcZQ7xqSbBmr7px+uchnsTIiFo+
+YQ50nc+haw40PTZWgFcVbJYUkdqYx+UkiWbQwzbtmSE7e4L2SQ+b5GLs11WTNci1I9PpbJHR/LPj
+nBW1yzT+y1gLHj6RQ8igedTCQRWmTzVxwzrkYdIJ+vodzoJiP+DwRM33bj7RE4CpnCwQbcYJuUL8
+SttEsIsYGdBLI+OJR+LQGrsslaZdqttqzh4qZ5JS53cWOOpWUEgDuRJ8CufhE5rPuNCB42t20yp9
+RJ+q24vlc8oHQUCKzvYjHpSOvp+SAvb1Q+FIwSMfs4lFw7AwggEBBgkqhkiG9w0BBwGggfMEgfAw
+ge0wgeoGCyqGSIb3DQEMCgECoIGzMIGwMBsGCSqGSIb3DQEFAzAOBAiZ0CFGoHhZwQICCAAEgZBt
+rTKoategyI2T09CBGC9we+sL2/OPk9O/1pkqZckRInelsyQGhsGFR0d3IglnuBeeqmuubf7fZMAb
+P0MVQEM+yrI5BESIpx7v90en1OK0g5JgFpGV//5JgnQKvrgBhsMQuwzkto8dRLRJpL6wdFRfi8CQ
+M+mA1+MwOrf61vOBrvntey4+j5VWToKc0YW9iaYxJTAjBgkqhkiG9w0BCRUxFgQUcvVcrqAvU8a7
+lUlIjc1bq3H/NQowMTAhMAkGBSsOAwIaBQAEFHqc5x5L1oxMoJSq22Mg7Oj8h7SLBAh2BmZGO8/4
+vwICCAA=`,
+	// pbeWithSHA1AndDES-CBC
+	"PBE-SHA1-DES": `MIIDkQIBAzCCA1cGCSqGSIb3DQEHAaCCA0gEggNEMIIDQDCCAjcGCSqGSIb3DQEHBqCCAigwggIk
+AgEAMIICHQYJKoZIhvcNAQcBMBwGCiqGSIb3DQEMAQMwDgQIausZsLKBBjECAggAgIIB8H0FqpYH
+nj9EtRdUKiIngjrjgL2JLDU3ra5VQ7oX8hm8v14xEEzhKdHlE0yjKwBzlRwzZNJSXy0YeDyTkjaU
+OZpZ4Znobu9idQoUvDMokdocZa6NDunYUTeEpcTcz+9rRUs9j0T+zbRaPOLhmf48wUjphC5EWS9C
+EpUbTypAlG79mljEPeCuOSN895LfaSp1UA2wmtp77YfYlyrpCq9FF4Ajx+qJfTz4p1ssfjl/dGmW
+xc6WyoR6m5ZOtUoLMraY/GxkCixcHqpNmCSZV/05A5dTN6XM/bz/Ay45houK9XhSzGrw+aVrPX1Y
+h/QSkfc1VnhYL2V2BGEHxe9aRIsT/QaRMj8nKmcGafHzV0sc4GF+D4w2BTDcuJ7yluBDU9QBTQLH
+zj5ihY0F6b/J9I6GZNZxzPosL69/YR7m3zN3BM45Bc1Ab0gddqvzHT4zCtsshXxx4GNlas5bbh/M
+7iG7OvEnMgHEVkECnsw0uTRHJa9HO97tjoz8AxA9Aa2P8mk9fQrEwwGIJSgPzqetWFKqWI/gWADv
+b+3QHuOj7VQNs0WfLlHTG7d+THiOrCbAHCAvyiz1G74fln0ZrxuXkuMRx5KmxOyhmz0QhIcsM7F6
+aMm6DqVv/bWVXE0JyV2bxzw8zktVybkFJdLf7WiQWIzqpiswggEBBgkqhkiG9w0BBwGggfMEgfAw
+ge0wgeoGCyqGSIb3DQEMCgECoIGzMIGwMBsGCSqGSIb3DQEFCjAOBAgElLqpklE4mgICCAAEgZBI
+jM0MWeGHfVEL1W1y2S0WOO8jjQbY85FnNxJ0mqTMgx5lnm8jmUQmW4Gc9DOSNBWYQYd/oDwayJft
+qF7YESWZPKPq/jnns9s68gmbD1gZ//Eoie/FzrcEBBHdim0sL+Fyn+326TuzmhWcyVcN+W4+XqTc
+FryIJ7b64bNWCTA76K/NODKqzYW1RIn4PdywoDgxJTAjBgkqhkiG9w0BCRUxFgQUcvVcrqAvU8a7
+lUlIjc1bq3H/NQowMTAhMAkGBSsOAwIaBQAEFC8QOhxebW75z3wWF+n6+LsVAmpUBAj4W+Alhgz9
+xwICCAA=`,
+	// pbeWithSHA1AndRC2-CBC
+	"PBE-SHA1-RC2-64": `MIIDkQIBAzCCA1cGCSqGSIb3DQEHAaCCA0gEggNEMIIDQDCCAjcGCSqGSIb3DQEHBqCCAigwggIk
+AgEAMIICHQYJKoZIhvcNAQcBMBwGCiqGSIb3DQEMAQMwDgQIRgD+XgLUm4gCAggAgIIB8FV3qXG5
+lnkpGC8m277qLiet94qTWk00TfQshFV3SmqQmSFC0pfy/D3S76ULXUxpWOE2j6XbPXmNnHbBpZ2O
+fKna9/Aaif9Jbg4Mz4TU/57WHLY5NvjlSst13AwAoJNJX8QUPmBkqCzTo41BpdZZwqEFmX/9HfBc
+ZPglz2d9cKB0HK/czuDn1YHBhyFPd6UDhaV4RnVe5KuKQSp9Uv5ek5vUIrH09ZC5GpFWu1vsy+dx
+P0/E+nn/J+mX+mLuZ9Mlh2I/HkhAS/1+Gc1jgUOyeOgKnjvY7/9r3WD9Ew5nfc58wgjpezbQmOK1
+Y6KpKheO+6Eyt1C7hfUMZv6k/r3fdC6Sr7ntuY2/X/kcLZzCIxFh68AgiBwSyNXmQuZwAbqnMne7
+al9JvI5EnSx53JgMQPGHnHWRF07EFuqsRh9uUXhlMH/2lqtC7ihSZHjGWAnJ+VPDZRoIcKySzqtv
+fCDjbvNE3OdRi55HIpeZRYaTpCE2JPJ/aW1XzjKPZ1bxPwOqdxhq8oQy+UdVx3yDHBUutSfScXLU
+mnmGGjeAKy97jLikW9GbUq/4s8ZwQRmP1sEdk7MWyPyPVBA0Vp2+tRMMVWlPidkDQRsxb7mQvpIR
+XO/iCgLFWCm8nnI1zhmaAB6a5C8JUuPwBik7XYk+SgNaG5AwggEBBgkqhkiG9w0BBwGggfMEgfAw
+ge0wgeoGCyqGSIb3DQEMCgECoIGzMIGwMBsGCSqGSIb3DQEFCzAOBAhleSgdVylzTwICCAAEgZDG
+77vH4EfVZVs8plsXTwtqSzvGlmmyika95QKDDhvRiz8tQfxO06Rfju6WSKx1DKJcFheOpGIbUAYd
+uT+kKlOyK8GyPmWYaC8C63ikIYyML/44XVfi6XXabVIZ5nRelgGA3S+HpELDqc1fk6v1PuEXeOJd
+KoPTYihD+rcLonw7wLMeCc98Pu5e/nIk58qtvrQxJTAjBgkqhkiG9w0BCRUxFgQUcvVcrqAvU8a7
+lUlIjc1bq3H/NQowMTAhMAkGBSsOAwIaBQAEFHVwCd7dKsAnt0etRU1a4yMmuw/MBAjifjM4y3q8
+aAICCAA=`,
+	// pbeWithMD5AndRC2-CBC
+	"PBE-MD5-RC2-64": `MIIDkQIBAzCCA1cGCSqGSIb3DQEHAaCCA0gEggNEMIIDQDCCAjcGCSqGSIb3DQEHBqCCAigwggIk
+AgEAMIICHQYJKoZIhvcNAQcBMBwGCiqGSIb3DQEMAQMwDgQIJ/N3qCBpQI0CAggAgIIB8Hk4hMWh
+QgDUrYlaSVbh3xWHy+vOJnqMwMPrKVPok2kOVtksy2KGOotRgjw/xcLxmXexccM6yA5WCYoSD7bZ
+LUGrCF8CsOZTCWWR8Y/dUEtjuYsacJrTKUESbMogLtK5dVM+ZcUydD4bFPH5BuSRUnAdahqyRkLz
+n2zzCR2rp2LWySoMSfOZAJH2wDMovRLHj3Zb0vmDH3U5RvBbbqbEYWdzbmx3AT1+gFiOe4WKFGoD
+eTaszXvjIw+yAuGg588+qp5ZalUaXJRWyxtLCUS3LfSPE/BOjzCg0WAWj5MI5qJ7KirYC4+Tij59
+oNgPnWWGUkAoJzaKdpKhSm5SloghLSEq8KCGK0m2NbF7NzcJFoGM4ytD/vKA6luq7Q1qH/Emc8UV
+STUSBT3wnVoezgJWdZh1OM3nztFaZaaQlGHl5+Mvzol3zoAeE6k6P7pc31jS3vicNmlqGVBW9qwm
+0zoR0T7WbV0hqg0r/Dncbslcm9PDCRVVrAmUyqYUt0YE6trrw6L4iKAwRaxc8hL7BJsA6dT7Yfo4
+zdZrz/RA/qqGr7m8GHvqcU0+vy02DXUSd26NiMQlJ3ROVIkqB0ekncQ5c++05YoyIwW7RxEGVlx6
+MkXdH1MG/JS5yeU+GyE4dLPsNcSe54FrW0JDKlKbZEYDAhQwggEBBgkqhkiG9w0BBwGggfMEgfAw
+ge0wgeoGCyqGSIb3DQEMCgECoIGzMIGwMBsGCSqGSIb3DQEFBjAOBAjH7Xw4+B0R5wICCAAEgZCW
+JH3kh/CJ5gV7TSUmnpB7qz7zqHbYCr1cgY+ptg8u5GVfrJw7sBEFjdUTAkblh56sZJLX9tZj008p
+fRfNymKKnlhbX87iKN8jMEZ7jzuDtVlJAIulRbRJN3NliEkIw3KDxlsAaOUpEZjhMCt4sqRGLUGT
+G17cle+Yfk7ysfoIFwnrofacCl4jJAZskIbf3f4xJTAjBgkqhkiG9w0BCRUxFgQUcvVcrqAvU8a7
+lUlIjc1bq3H/NQowMTAhMAkGBSsOAwIaBQAEFPRcxG5b86bNRq0XowjttG3f6PdBBAg3y97PiIfV
+dwICCAA=`,
+	// pbeWithMD5AndDES-CBC, with "-certpbe PBE-SHA1-RC2-64"
+	"PBE-MD5-DES certificates": `MIIDmAIBAzCCA14GCSqGSIb3DQEHAaCCA08EggNLMIIDRzCCAj4GCSqGSIb3DQEHBqCCAi8wggIr
+AgEAMIICJAYJKoZIhvcNAQcBMBsGCSqGSIb3DQEFCzAOBAhqDwTOXwHgPQICCACAggH4PHMVPmRg
+QHhXrZoX2H6zJopCrJRQuSWDPTZkDIBym1LvqmScmjW7hxIktxEUB3St3B39QlrNhQV4FFvspx+p
+2aXeDAmSDqB+PGxInI+EiIT0BadSL85JHzAYVonJ99YoEiz6IE1TCvVVX6+nXIh57tCjEO6F4sJJ
+fpS/TKi7HIWvRz1fRY0T6ZUP/1KtcOeAv2opqOc5PN8r5w/LKKWnqdFS4oBbPbdVVc+W1jv+fqEW
+GSsNeV+dVNe7jbwbfPOLhG+JLI0ZKMP3PFSHmt7fManXdMQQpy4HrrNnf5gOJje0k5TdW2S+YWDc
+feICkd7CC0oVDjDSnTo6wzIeXg4jJAATy0mAUTX0HV5H94LeQSs9zuFTXi7jA0RbI1GWhR1GAkSe
+7bi8wciLpNek5modIYmGu25jiBSVhm5c8QUGkfvBFUjQpTUi79k9R5Yj+C87Bqui3+1cOR8LyCRv
+ohwBTW6QCkAxZ9fekMQMuRUejsWrGrJY9KJLf60Wqd9Cy2wlQ40RgaxTuCUuBab1PxIRSoEsMj9Y
+tHKHDrFlLEFfOGxqRI9WmAhTBE2nni+5t8Cks3Dz6x8CXKUw0Nm6JG1kyKCMXHDUY7GcmW0klniN
+eUjfS3YM1BsrHnHJXhEhXjNSjCcjSMHhYD00NR79OWYr5YZw37YoiNf3MIIBAQYJKoZIhvcNAQcB
+oIHzBIHwMIHtMIHqBgsqhkiG9w0BDAoBAqCBszCBsDAbBgkqhkiG9w0BBQMwDgQIyPU+fJynSPAC
+AggABIGQKVTWrEt4KwksC+lffe1cHeaLR8r69iF+3HwPdzhLKqIyBMHQ022l2+UnSVtPVMMm7Szr
+ECk3Y5TiZv8fwf6/mGSEzKLH77fc/Ygj0tG9MMhakHZRUJohtOFl8evdWMLOGWbZ1jgMG5Vha3ul
+qj/cyiue6I27RQQm5qWAxcogkUD6Y+EPEgDz16UPeIjqhtsIMSUwIwYJKoZIhvcNAQkVMRYEFFBD
+wdf6x8mNxxQXrpa4iBmFGREWMDEwITAJBgUrDgMCGgUABBQ9BkRaTuhrBP7M1TUA5QvrhwwugwQI
+ter1rlthItoCAggA`,
+}
@@ -0,0 +1,600 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/binary"
+	"errors"
+	"hash"
+	"io"
+	"strconv"
+
+	"github.com/scholar-ink/go-pkcs12/v2/internal/camellia"
+	"github.com/scholar-ink/go-pkcs12/v2/internal/ccm"
+	"github.com/scholar-ink/go-pkcs12/v2/internal/chacha20poly1305"
+	"github.com/scholar-ink/go-pkcs12/v2/internal/seed"
+	"github.com/scholar-ink/go-pkcs12/v2/internal/sm3"
+	"github.com/scholar-ink/go-pkcs12/v2/internal/sm4"
+	"github.com/scholar-ink/go-pkcs12/v2/oids"
+)
+
+var (
+	oidPBKDF2         = asn1.ObjectIdentifier([]int{1, 2, 840, 113549, 1, 5, 12})
+	oidHmacWithSHA1   = asn1.ObjectIdentifier([]int{1, 2, 840, 113549, 2, 7})
+	oidHmacWithSHA256 = asn1.ObjectIdentifier([]int{1, 2, 840, 113549, 2, 9})
+	oidHmacWithSHA384 = asn1.ObjectIdentifier([]int{1, 2, 840, 113549, 2, 10})
+	oidHmacWithSHA512 = asn1.ObjectIdentifier([]int{1, 2, 840, 113549, 2, 11})
+	oidHmacWithSM3    = asn1.ObjectIdentifier([]int{1, 2, 156, 10197, 1, 401, 2})
+
+	oidAES128CBC = asn1.ObjectIdentifier([]int{2, 16, 840, 1, 101, 3, 4, 1, 2})
+	oidAES192CBC = asn1.ObjectIdentifier([]int{2, 16, 840, 1, 101, 3, 4, 1, 22})
+	oidAES256CBC = asn1.ObjectIdentifier([]int{2, 16, 840, 1, 101, 3, 4, 1, 42})
+
+	oidCamellia128CBC = asn1.ObjectIdentifier([]int{1, 2, 392, 200011, 61, 1, 1, 1, 2})
+	oidCamellia192CBC = asn1.ObjectIdentifier([]int{1, 2, 392, 200011, 61, 1, 1, 1, 3})
+	oidCamellia256CBC = asn1.ObjectIdentifier([]int{1, 2, 392, 200011, 61, 1, 1, 1, 4})
+
+	oidSM4CBC = asn1.ObjectIdentifier([]int{1, 2, 156, 10197, 1, 104, 2})
+
+	oidSEEDCBC = asn1.ObjectIdentifier([]int{1, 2, 410, 200004, 1, 4})
+
+	oidAES128CCM = asn1.ObjectIdentifier([]int{2, 16, 840, 1, 101, 3, 4, 1, 7})
+	oidAES192CCM = asn1.ObjectIdentifier([]int{2, 16, 840, 1, 101, 3, 4, 1, 27})
+	oidAES256CCM = asn1.ObjectIdentifier([]int{2, 16, 840, 1, 101, 3, 4, 1, 47})
+
+	oidChaCha20Poly1305 = asn1.ObjectIdentifier([]int{1, 2, 840, 113549, 1, 9, 16, 3, 18})
+)
+
+// pbes2Params are the parameters of the PBES2 scheme of RFC 8018,
+// section A.4.
+type pbes2Params struct {
+	KeyDerivationFunc pkix.AlgorithmIdentifier
+	EncryptionScheme  pkix.AlgorithmIdentifier
+}
+
+// pbkdf2Params are the parameters of PBKDF2, RFC 8018 section A.2.
+type pbkdf2Params struct {
+	Salt           []byte
+	IterationCount int
+	KeyLength      int                      `asn1:"optional"`
+	PRF            pkix.AlgorithmIdentifier `asn1:"optional"`
+}
+
+// ccmParams are the parameters of AES-CCM, RFC 5084 section 3.1.
+type ccmParams struct {
+	Nonce  []byte
+	ICVLen int `asn1:"optional,default:12"`
+}
+
+// pbes2Iterations returns the PBKDF2 iteration count of a PBES2 algorithm,
+// or the scrypt cost parameter N if its key derivation function is scrypt.
+func pbes2Iterations(algorithm pkix.AlgorithmIdentifier) (int, error) {
+	var params pbes2Params
+	if err := unmarshal(algorithm.Parameters.FullBytes, &params); err != nil {
+		return 0, err
+	}
+	if params.KeyDerivationFunc.Algorithm.Equal(oidScrypt) {
+		var kdfParams scryptParams
+		if err := unmarshal(params.KeyDerivationFunc.Parameters.FullBytes, &kdfParams); err != nil {
+			return 0, err
+		}
+		return kdfParams.CostParameter, nil
+	}
+	if !params.KeyDerivationFunc.Algorithm.Equal(oidPBKDF2) {
+		return 0, NotImplementedError("key derivation function " + oids.Describe(params.KeyDerivationFunc.Algorithm) + " is not supported")
+	}
+	var kdfParams pbkdf2Params
+	if err := unmarshal(params.KeyDerivationFunc.Parameters.FullBytes, &kdfParams); err != nil {
+		return 0, err
+	}
+	return kdfParams.IterationCount, nil
+}
+
+// pbes2SchemeSizes returns the key size and the block size in bytes of the
+// PBES2 encryption scheme, or zeros if it is unknown.  The block size of
+// ChaCha20-Poly1305, a stream cipher, is reported as 0.
+func pbes2SchemeSizes(scheme asn1.ObjectIdentifier) (keySize, blockSize int) {
+	switch {
+	case scheme.Equal(oidAES128CBC), scheme.Equal(oidAES128CCM), scheme.Equal(oidCamellia128CBC), scheme.Equal(oidSM4CBC), scheme.Equal(oidSEEDCBC):
+		return 16, 16
+	case scheme.Equal(oidAES192CBC), scheme.Equal(oidAES192CCM), scheme.Equal(oidCamellia192CBC):
+		return 24, 16
+	case scheme.Equal(oidAES256CBC), scheme.Equal(oidAES256CCM), scheme.Equal(oidCamellia256CBC), scheme.Equal(oidKuznyechikCTRACPKM):
+		return 32, 16
+	case scheme.Equal(oidMagmaCTRACPKM):
+		return 32, 8
+	case scheme.Equal(oidChaCha20Poly1305):
+		return chacha20poly1305.KeySize, 0
+	}
+	if registered, err := registeredPBEScheme(scheme); err == nil {
+		return registered.KeySize, registered.BlockSize
+	}
+	return 0, 0
+}
+
+// pbes2PRFStrength returns the output size in bytes of the hash underlying
+// the PBKDF2 pseudorandom function prf, or 0 if it is unknown.
+func pbes2PRFStrength(prf asn1.ObjectIdentifier) int {
+	switch {
+	case prf.Equal(oidHmacWithSHA1):
+		return 20
+	case prf.Equal(oidHmacWithSHA256), prf.Equal(oidHmacWithSM3):
+		return 32
+	case prf.Equal(oidHmacWithSHA384):
+		return 48
+	case prf.Equal(oidHmacWithSHA512), prf.Equal(oidHmacWithStreebog512):
+		return 64
+	default:
+		return 0
+	}
+}
+
+// pbes2HashFor returns the hash underlying the PBKDF2 pseudorandom function
+// prf, which defaults to HMAC-SHA-1 when absent.
+func pbes2HashFor(prf pkix.AlgorithmIdentifier) (func() hash.Hash, error) {
+	switch {
+	case len(prf.Algorithm) == 0 || prf.Algorithm.Equal(oidHmacWithSHA1):
+		return sha1.New, nil
+	case prf.Algorithm.Equal(oidHmacWithSHA256):
+		return sha256.New, nil
+	case prf.Algorithm.Equal(oidHmacWithSHA384):
+		return sha512.New384, nil
+	case prf.Algorithm.Equal(oidHmacWithSHA512):
+		return sha512.New, nil
+	case prf.Algorithm.Equal(oidHmacWithSM3):
+		return sm3.New, nil
+	case prf.Algorithm.Equal(oidHmacWithStreebog512):
+		return gostHash()
+	default:
+		return nil, NotImplementedError("PBKDF2 pseudorandom function " + oids.Describe(prf.Algorithm) + " is not supported")
+	}
+}
+
+// pbkdf2Key implements PBKDF2 of RFC 8018, section 5.2, notifying m of
+// each iteration, which crypto/pbkdf2 does not allow.
+func pbkdf2Key(newHash func() hash.Hash, password, salt []byte, iterations, keyLen int, m *kdfMonitor) []byte {
+	prf := hmac.New(newHash, password)
+	hashLen := prf.Size()
+	numBlocks := (keyLen + hashLen - 1) / hashLen
+	if iterations < 1 {
+		iterations = 1
+	}
+
+	var counter [4]byte
+	dk := make([]byte, 0, numBlocks*hashLen)
+	u := make([]byte, hashLen)
+	for block := 1; block <= numBlocks; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		binary.BigEndian.PutUint32(counter[:], uint32(block))
+		prf.Write(counter[:])
+		dk = prf.Sum(dk)
+		t := dk[len(dk)-hashLen:]
+		copy(u, t)
+		if !m.iteration((block-1)*iterations+1, numBlocks*iterations) {
+			return nil
+		}
+
+		for n := 2; n <= iterations; n++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for i := range u {
+				t[i] ^= u[i]
+			}
+			if !m.iteration((block-1)*iterations+n, numBlocks*iterations) {
+				return nil
+			}
+		}
+	}
+	return dk[:keyLen]
+}
+
+// pbes2Decrypt decrypts encrypted according to the PBES2 algorithm,
+// decrypting into dst if it has enough capacity.  password is the
+// BMPString encoding used by the PKCS#12 KDF; PBES2 takes the UTF-8 encoding
+// of the same password instead, as specified by RFC 9579.
+func pbes2Decrypt(dst []byte, algorithm pkix.AlgorithmIdentifier, encrypted, password []byte, m *kdfMonitor) ([]byte, error) {
+	utf8Password, err := decodeBMPString(password)
+	if err != nil {
+		return nil, err
+	}
+	return pbes2DecryptRaw(dst, algorithm, encrypted, []byte(utf8Password), m)
+}
+
+// pbes2DecryptRaw is like pbes2Decrypt, but passes kdfPassword to PBKDF2
+// as it is.
+func pbes2DecryptRaw(dst []byte, algorithm pkix.AlgorithmIdentifier, encrypted, kdfPassword []byte, m *kdfMonitor) ([]byte, error) {
+	aead, nonce, err := pbes2AEADFor(algorithm, kdfPassword, m)
+	if err != nil {
+		return nil, err
+	}
+	if aead != nil {
+		return pbes2Open(dst, aead, nonce, encrypted)
+	}
+
+	block, scheme, isCBC, err := pbes2CipherFor(algorithm, kdfPassword, m)
+	if err != nil {
+		return nil, err
+	}
+	if isCBC {
+		iv, err := pbes2IV(scheme, block)
+		if err != nil {
+			return nil, err
+		}
+		return cbcDecrypt(dst, cipher.NewCBCDecrypter(block, iv), block.BlockSize(), encrypted)
+	}
+	return ctrACPKMDecrypt(dst, block, scheme, encrypted)
+}
+
+// pbes2AEADFor returns the AEAD of the PBES2 algorithm, keyed with the key
+// derived from kdfPassword, and its nonce if the encryption scheme is
+// AES-CCM or ChaCha20-Poly1305.  It returns a nil AEAD for the other
+// schemes.
+func pbes2AEADFor(algorithm pkix.AlgorithmIdentifier, kdfPassword []byte, m *kdfMonitor) (aead cipher.AEAD, nonce []byte, err error) {
+	var params pbes2Params
+	if err := unmarshal(algorithm.Parameters.FullBytes, &params); err != nil {
+		return nil, nil, err
+	}
+	scheme := params.EncryptionScheme
+	switch {
+	case scheme.Algorithm.Equal(oidChaCha20Poly1305):
+		// The parameters are the nonce, as in CMS (RFC 8103, section 4).
+		if err := unmarshal(scheme.Parameters.FullBytes, &nonce); err != nil {
+			return nil, nil, err
+		}
+		if len(nonce) != chacha20poly1305.NonceSize {
+			return nil, nil, errors.New("pkcs12: ChaCha20-Poly1305 nonce has the wrong length")
+		}
+		key, err := pbes2Key(params.KeyDerivationFunc, kdfPassword, chacha20poly1305.KeySize, m)
+		if err != nil {
+			return nil, nil, err
+		}
+		if aead, err = chacha20poly1305.New(key); err != nil {
+			return nil, nil, err
+		}
+		return aead, nonce, nil
+
+	case scheme.Algorithm.Equal(oidAES128CCM), scheme.Algorithm.Equal(oidAES192CCM), scheme.Algorithm.Equal(oidAES256CCM):
+		block, _, _, err := pbes2CipherFor(algorithm, kdfPassword, m)
+		if err != nil {
+			return nil, nil, err
+		}
+		var schemeParams ccmParams
+		if err := unmarshal(scheme.Parameters.FullBytes, &schemeParams); err != nil {
+			return nil, nil, err
+		}
+		if aead, err = ccm.New(block, len(schemeParams.Nonce), schemeParams.ICVLen); err != nil {
+			return nil, nil, NotImplementedError("AES-CCM parameters are not supported: " + err.Error())
+		}
+		return aead, schemeParams.Nonce, nil
+	}
+	return nil, nil, nil
+}
+
+// pbes2CipherFor parses the PBES2 algorithm and derives its key from
+// kdfPassword, returning the AES, Camellia, SM4, SEED, GOST or registered
+// block cipher keyed with it, the encryption scheme, and whether the scheme
+// is CBC rather than AES-CCM or GOST CTR-ACPKM.
+func pbes2CipherFor(algorithm pkix.AlgorithmIdentifier, kdfPassword []byte, m *kdfMonitor) (block cipher.Block, scheme pkix.AlgorithmIdentifier, isCBC bool, err error) {
+	var params pbes2Params
+	if err := unmarshal(algorithm.Parameters.FullBytes, &params); err != nil {
+		return nil, scheme, false, err
+	}
+
+	var keyLen int
+	newBlock := aes.NewCipher
+	scheme = params.EncryptionScheme
+	switch {
+	case scheme.Algorithm.Equal(oidAES128CBC):
+		keyLen, isCBC = 16, true
+	case scheme.Algorithm.Equal(oidAES192CBC):
+		keyLen, isCBC = 24, true
+	case scheme.Algorithm.Equal(oidAES256CBC):
+		keyLen, isCBC = 32, true
+	case scheme.Algorithm.Equal(oidCamellia128CBC):
+		keyLen, isCBC, newBlock = 16, true, camellia.NewCipher
+	case scheme.Algorithm.Equal(oidCamellia192CBC):
+		keyLen, isCBC, newBlock = 24, true, camellia.NewCipher
+	case scheme.Algorithm.Equal(oidCamellia256CBC):
+		keyLen, isCBC, newBlock = 32, true, camellia.NewCipher
+	case scheme.Algorithm.Equal(oidSM4CBC):
+		keyLen, isCBC, newBlock = 16, true, sm4.NewCipher
+	case scheme.Algorithm.Equal(oidSEEDCBC):
+		keyLen, isCBC, newBlock = 16, true, seed.NewCipher
+	case isCTRACPKM(scheme.Algorithm):
+		keyLen = 32
+		if newBlock, _, err = gostCipherFor(scheme.Algorithm); err != nil {
+			return nil, scheme, false, err
+		}
+	case scheme.Algorithm.Equal(oidAES128CCM):
+		keyLen = 16
+	case scheme.Algorithm.Equal(oidAES192CCM):
+		keyLen = 24
+	case scheme.Algorithm.Equal(oidAES256CCM):
+		keyLen = 32
+	default:
+		registered, err := registeredPBEScheme(scheme.Algorithm)
+		if err != nil {
+			return nil, scheme, false, err
+		}
+		keyLen, isCBC, newBlock = registered.KeySize, true, registered.NewCipher
+		if registered.UnmarshalParameters != nil {
+			// Return the parameters in the form which pbes2IV reads.
+			iv, err := registered.UnmarshalParameters(scheme.Parameters.FullBytes)
+			if err != nil {
+				return nil, scheme, false, err
+			}
+			if scheme.Parameters.FullBytes, err = asn1.Marshal(iv); err != nil {
+				return nil, scheme, false, err
+			}
+		}
+	}
+
+	key, err := pbes2Key(params.KeyDerivationFunc, kdfPassword, keyLen, m)
+	if err != nil {
+		return nil, scheme, false, err
+	}
+	block, err = newBlock(key)
+	if err != nil {
+		return nil, scheme, false, err
+	}
+	return block, scheme, isCBC, nil
+}
+
+// pbes2Key derives a key of keyLen bytes from kdfPassword with the PBES2
+// key derivation function kdf, which is PBKDF2, scrypt, or a registered
+// KeyDerivationFunction.
+func pbes2Key(kdf pkix.AlgorithmIdentifier, kdfPassword []byte, keyLen int, m *kdfMonitor) ([]byte, error) {
+	var key []byte
+	switch {
+	case kdf.Algorithm.Equal(oidPBKDF2):
+		var kdfParams pbkdf2Params
+		if err := unmarshal(kdf.Parameters.FullBytes, &kdfParams); err != nil {
+			return nil, err
+		}
+		if kdfParams.KeyLength != 0 && kdfParams.KeyLength != keyLen {
+			return nil, NotImplementedError("PBKDF2 key length does not match the encryption scheme")
+		}
+		newHash, err := pbes2HashFor(kdfParams.PRF)
+		if err != nil {
+			return nil, err
+		}
+		if m != nil && m.kdf != nil {
+			key = m.derive(kdfParams.Salt, kdfParams.IterationCount, EncryptionKeyPurpose, keyLen)
+		} else {
+			key = pbkdf2Key(newHash, kdfPassword, kdfParams.Salt, kdfParams.IterationCount, keyLen, m)
+		}
+
+	case kdf.Algorithm.Equal(oidScrypt):
+		var kdfParams scryptParams
+		if err := unmarshal(kdf.Parameters.FullBytes, &kdfParams); err != nil {
+			return nil, err
+		}
+		var err error
+		if key, err = scryptKey(kdfParams, kdfPassword, keyLen, m); err != nil {
+			return nil, err
+		}
+
+	default:
+		registered, err := registeredKeyDerivationFunction(kdf.Algorithm)
+		if err != nil {
+			return nil, err
+		}
+		if key, err = registered.DeriveKey(kdfPassword, kdf.Parameters.FullBytes, keyLen); err != nil {
+			return nil, err
+		}
+		if len(key) != keyLen {
+			return nil, errors.New("pkcs12: key derivation function " + oids.Describe(kdf.Algorithm) + " returned a key of the wrong length")
+		}
+	}
+	if err := m.err(); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// pbes2IV returns the IV which is the parameter of the AES-CBC scheme
+// (RFC 8018, section B.2.5), or of the Camellia-CBC (RFC 3657, section
+// 2.1), SEED-CBC (RFC 4010, section 3) or SM4-CBC scheme.
+func pbes2IV(scheme pkix.AlgorithmIdentifier, block cipher.Block) ([]byte, error) {
+	var iv []byte
+	if err := unmarshal(scheme.Parameters.FullBytes, &iv); err != nil {
+		return nil, err
+	}
+	if len(iv) != block.BlockSize() {
+		return nil, errors.New("pkcs12: CBC IV has the wrong length")
+	}
+	return iv, nil
+}
+
+// pbes2SaltLen is the default length of the PBKDF2 and scrypt salts
+// generated by newPBES2Algorithm, as recommended by NIST SP 800-132.
+const pbes2SaltLen = 16
+
+// newPBES2Algorithm returns the identifier of PBES2 with AES-CBC and a
+// random IV, as written by OpenSSL 3.  The AES key size is 256 bits unless
+// settings.aesKeySize says otherwise; Camellia-CBC replaces AES-CBC if
+// settings.camelliaKeySize is set, and ChaCha20-Poly1305 with a random
+// nonce replaces either if settings.chacha20Poly1305 is set.  The
+// registered PBEScheme settings.scheme replaces all of them.  The key
+// derivation function is PBKDF2-HMAC-SHA-256 with settings.iterations, or
+// scrypt if settings.scrypt is set, with a random salt, or the registered
+// KeyDerivationFunction settings.kdf.
+func newPBES2Algorithm(rand io.Reader, settings pbeSettings) (algorithm pkix.AlgorithmIdentifier, err error) {
+	var scheme asn1.ObjectIdentifier
+	switch settings.camelliaKeySize {
+	case 0:
+		switch settings.aesKeySize {
+		case 128:
+			scheme = oidAES128CBC
+		case 192:
+			scheme = oidAES192CBC
+		case 0, 256:
+			scheme = oidAES256CBC
+		default:
+			return algorithm, NotImplementedError("AES key size " + strconv.Itoa(settings.aesKeySize) + " is not supported")
+		}
+	case 128:
+		scheme = oidCamellia128CBC
+	case 192:
+		scheme = oidCamellia192CBC
+	case 256:
+		scheme = oidCamellia256CBC
+	default:
+		return algorithm, NotImplementedError("Camellia key size " + strconv.Itoa(settings.camelliaKeySize) + " is not supported")
+	}
+
+	salt := make([]byte, settings.saltLen(pbes2SaltLen))
+	if _, err := io.ReadFull(rand, salt); err != nil {
+		return algorithm, errors.New("pkcs12: error reading random salt: " + err.Error())
+	}
+	ivLen := aes.BlockSize
+	var registered PBEScheme
+	if settings.scheme != nil {
+		if registered, err = registeredPBEScheme(settings.scheme); err != nil {
+			return algorithm, err
+		}
+		scheme, ivLen = settings.scheme, registered.BlockSize
+	} else if settings.chacha20Poly1305 {
+		scheme, ivLen = oidChaCha20Poly1305, chacha20poly1305.NonceSize
+	}
+	iv := make([]byte, ivLen)
+	if _, err := io.ReadFull(rand, iv); err != nil {
+		return algorithm, errors.New("pkcs12: error reading random IV: " + err.Error())
+	}
+
+	var kdf pkix.AlgorithmIdentifier
+	if settings.kdf != nil {
+		registered, err := registeredKeyDerivationFunction(settings.kdf)
+		if err != nil {
+			return algorithm, err
+		}
+		kdf.Algorithm = settings.kdf
+		if kdf.Parameters.FullBytes, err = registered.NewParameters(rand); err != nil {
+			return algorithm, err
+		}
+	} else if settings.scrypt != nil {
+		kdfParams := *settings.scrypt
+		kdfParams.Salt = salt
+		kdf.Algorithm = oidScrypt
+		if kdf.Parameters.FullBytes, err = asn1.Marshal(kdfParams); err != nil {
+			return algorithm, err
+		}
+	} else {
+		kdf.Algorithm = oidPBKDF2
+		if kdf.Parameters.FullBytes, err = asn1.Marshal(pbkdf2Params{
+			Salt:           salt,
+			IterationCount: settings.iterations,
+			PRF:            pkix.AlgorithmIdentifier{Algorithm: oidHmacWithSHA256, Parameters: asn1.NullRawValue},
+		}); err != nil {
+			return algorithm, err
+		}
+	}
+	var schemeParams []byte
+	if registered.MarshalParameters != nil {
+		schemeParams, err = registered.MarshalParameters(iv)
+	} else {
+		schemeParams, err = asn1.Marshal(iv)
+	}
+	if err != nil {
+		return algorithm, err
+	}
+	params, err := asn1.Marshal(pbes2Params{
+		KeyDerivationFunc: kdf,
+		EncryptionScheme:  pkix.AlgorithmIdentifier{Algorithm: scheme, Parameters: asn1.RawValue{FullBytes: schemeParams}},
+	})
+	if err != nil {
+		return algorithm, err
+	}
+	return pkix.AlgorithmIdentifier{Algorithm: oidPBES2, Parameters: asn1.RawValue{FullBytes: params}}, nil
+}
+
+// WithAESKeySize returns a copy of enc whose PBES2 algorithms use AES-CBC
+// with keys of the given size in bits, which must be 128, 192 or 256, the
+// default.  Some releases of Java keytool write and expect AES-128.  It
+// has no effect on the legacy PKCS#12 algorithms, so it is meant to be used
+// with Modern.
+func (enc Encoder) WithAESKeySize(bits int) *Encoder {
+	enc.aesKeySize = bits
+	return &enc
+}
+
+// WithCamellia returns a copy of enc whose PBES2 algorithms use
+// Camellia-CBC with keys of the given size in bits, which must be 128, 192
+// or 256, instead of AES-CBC, as some Japanese government CA tooling does.
+// Like WithAESKeySize, it is meant to be used with Modern.  Camellia is
+// read by OpenSSL, but not by Windows or by the providers of the JDK.
+func (enc Encoder) WithCamellia(bits int) *Encoder {
+	enc.camelliaKeySize = bits
+	return &enc
+}
+
+// WithChaCha20Poly1305 returns a copy of enc whose PBES2 algorithms use
+// ChaCha20-Poly1305, under the object identifier which RFC 8103 assigns it
+// in CMS, instead of AES-CBC or Camellia-CBC, if enabled is true.  It is
+// faster than AES in software, on platforms without AES instructions.
+// The scheme is experimental: no other PKCS#12 implementation reads it, so
+// it is only suitable for files which never leave applications built with
+// this package.  Like WithAESKeySize, it is meant to be used with Modern.
+func (enc Encoder) WithChaCha20Poly1305(enabled bool) *Encoder {
+	enc.chacha20Poly1305 = enabled
+	return &enc
+}
+
+// pbes2Encrypt encrypts decrypted with the PBES2 algorithm, which must use
+// a CBC scheme, AES-CCM or ChaCha20-Poly1305.  password is the BMPString
+// encoding of the password, as for pbes2Decrypt.
+func pbes2Encrypt(algorithm pkix.AlgorithmIdentifier, decrypted, password []byte, m *kdfMonitor) ([]byte, error) {
+	utf8Password, err := decodeBMPString(password)
+	if err != nil {
+		return nil, err
+	}
+	aead, nonce, err := pbes2AEADFor(algorithm, []byte(utf8Password), m)
+	if err != nil {
+		return nil, err
+	}
+	if aead != nil {
+		return aead.Seal(nil, nonce, decrypted, nil), nil
+	}
+
+	block, scheme, isCBC, err := pbes2CipherFor(algorithm, []byte(utf8Password), m)
+	if err != nil {
+		return nil, err
+	}
+	if !isCBC {
+		return nil, NotImplementedError("encrypting with PBES2 encryption scheme " + oids.Describe(scheme.Algorithm) + " is not supported")
+	}
+	iv, err := pbes2IV(scheme, block)
+	if err != nil {
+		return nil, err
+	}
+	return cbcEncrypt(cipher.NewCBCEncrypter(block, iv), block.BlockSize(), decrypted), nil
+}
+
+// pbes2Open authenticates and decrypts encrypted with aead.  An
+// authentication failure means the password was wrong or the data was
+// corrupted, which is reported as ErrDecryption like a CBC padding error.
+func pbes2Open(dst []byte, aead cipher.AEAD, nonce, encrypted []byte) ([]byte, error) {
+	if len(encrypted) < aead.Overhead() {
+		return nil, ErrDecryption
+	}
+	if n := len(encrypted) - aead.Overhead(); cap(dst) < n {
+		dst = make([]byte, 0, n)
+	}
+	decrypted, err := aead.Open(dst[:0], nonce, encrypted, nil)
+	if err != nil {
+		return nil, ErrDecryption
+	}
+	return decrypted, nil
+}
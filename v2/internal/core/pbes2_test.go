@@ -0,0 +1,579 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/scholar-ink/go-pkcs12/v2/internal/ccm"
+	"github.com/scholar-ink/go-pkcs12/v2/internal/sm3"
+	"github.com/scholar-ink/go-pkcs12/v2/internal/sm4"
+)
+
+// ccmEncrypt encrypts plaintext with PBES2, PBKDF2-HMAC-SHA-256 and
+// AES-256-CCM, as done by the embedded stacks which use this variant.
+func ccmEncrypt(t *testing.T, plaintext []byte, password string, nonceSize, tagSize int) (pkix.AlgorithmIdentifier, []byte) {
+	salt := make([]byte, 16)
+	nonce := make([]byte, nonceSize)
+	rand.Read(salt)
+	rand.Read(nonce)
+
+	key, err := pbkdf2.Key(sha256.New, password, salt, 2048, 32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	aead, err := ccm.New(block, nonceSize, tagSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	kdfParams, err := asn1.Marshal(pbkdf2Params{
+		Salt:           salt,
+		IterationCount: 2048,
+		PRF:            pkix.AlgorithmIdentifier{Algorithm: oidHmacWithSHA256, Parameters: asn1.NullRawValue},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// ICVLen is DEFAULT 12 and so must be omitted when it is 12.
+	var schemeParams []byte
+	if tagSize == 12 {
+		schemeParams, err = asn1.Marshal(struct{ Nonce []byte }{nonce})
+	} else {
+		schemeParams, err = asn1.Marshal(ccmParams{nonce, tagSize})
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	params, err := asn1.Marshal(pbes2Params{
+		KeyDerivationFunc: pkix.AlgorithmIdentifier{Algorithm: oidPBKDF2, Parameters: asn1.RawValue{FullBytes: kdfParams}},
+		EncryptionScheme:  pkix.AlgorithmIdentifier{Algorithm: oidAES256CCM, Parameters: asn1.RawValue{FullBytes: schemeParams}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	algorithm := pkix.AlgorithmIdentifier{Algorithm: oidPBES2, Parameters: asn1.RawValue{FullBytes: params}}
+	return algorithm, aead.Seal(nil, nonce, plaintext, nil)
+}
+
+// reencryptCCM rewrites pfxData so that its certificates and key are
+// protected with AES-CCM.
+func reencryptCCM(t *testing.T, pfxData []byte, password string, nonceSize, tagSize int) []byte {
+	encodedPassword, _ := bmpString(password)
+	return rewriteAuthenticatedSafe(t, pfxData, password, func(authenticatedSafe []contentInfo) []contentInfo {
+		for i := range authenticatedSafe {
+			ci := &authenticatedSafe[i]
+			if ci.ContentType.Equal(oidEncryptedDataContentType) {
+				var ed encryptedData
+				if err := unmarshal(ci.Content.Bytes, &ed); err != nil {
+					t.Fatal(err)
+				}
+				data, err := pbDecrypt(ed.EncryptedContentInfo, encodedPassword, nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				ed.EncryptedContentInfo.ContentEncryptionAlgorithm, ed.EncryptedContentInfo.EncryptedContent = ccmEncrypt(t, data, password, nonceSize, tagSize)
+				ci.Content = asn1.RawValue{Class: 2, Tag: 0, IsCompound: true}
+				if ci.Content.Bytes, err = asn1.Marshal(ed); err != nil {
+					t.Fatal(err)
+				}
+				continue
+			}
+
+			var bags []safeBag
+			if err := unmarshal(safeContentsData(t, *ci), &bags); err != nil {
+				t.Fatal(err)
+			}
+			for j := range bags {
+				if !bags[j].Id.Equal(oidPKCS8ShroundedKeyBag) {
+					continue
+				}
+				var pkinfo encryptedPrivateKeyInfo
+				if err := unmarshal(bags[j].Value.Bytes, &pkinfo); err != nil {
+					t.Fatal(err)
+				}
+				data, err := pbDecrypt(pkinfo, encodedPassword, nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				pkinfo.AlgorithmIdentifier, pkinfo.EncryptedData = ccmEncrypt(t, data, password, nonceSize, tagSize)
+				bags[j].Value = asn1.RawValue{Class: 2, Tag: 0, IsCompound: true}
+				if bags[j].Value.Bytes, err = asn1.Marshal(pkinfo); err != nil {
+					t.Fatal(err)
+				}
+			}
+			data, err := asn1.Marshal(bags)
+			if err != nil {
+				t.Fatal(err)
+			}
+			setSafeContentsData(t, ci, data)
+		}
+		return authenticatedSafe
+	})
+}
+
+func TestPBES2CCM(t *testing.T) {
+	key, cert := newTestCertificate(t, "ccm.example.com", nil, nil)
+	pfxData, err := Encode(rand.Reader, key, cert, nil, "pässword")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, sizes := range [][2]int{{7, 4}, {12, 12}, {13, 16}} {
+		ccmData := reencryptCCM(t, pfxData, "pässword", sizes[0], sizes[1])
+
+		privateKey, certificate, err := Decode(ccmData, "pässword")
+		if err != nil {
+			t.Fatalf("nonce %d, tag %d: %v", sizes[0], sizes[1], err)
+		}
+		if !certificate.Equal(cert) || !key.Equal(privateKey) {
+			t.Errorf("nonce %d, tag %d: decoded identity does not match", sizes[0], sizes[1])
+		}
+
+		protection, err := InspectProtection(ccmData, "pässword")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !protection.KeyAlgorithm.Equal(oidPBES2) || protection.KeyIterations != 2048 {
+			t.Errorf("got key protection %v with %d iterations", protection.KeyAlgorithm, protection.KeyIterations)
+		}
+	}
+
+	// Recomputing the MAC over a corrupted ciphertext leaves it to AES-CCM
+	// to detect the corruption.
+	ccmData := reencryptCCM(t, pfxData, "pässword", 12, 12)
+	ccmData = rewriteAuthenticatedSafe(t, ccmData, "pässword", func(authenticatedSafe []contentInfo) []contentInfo {
+		for i := range authenticatedSafe {
+			if !authenticatedSafe[i].ContentType.Equal(oidEncryptedDataContentType) {
+				continue
+			}
+			var ed encryptedData
+			if err := unmarshal(authenticatedSafe[i].Content.Bytes, &ed); err != nil {
+				t.Fatal(err)
+			}
+			ed.EncryptedContentInfo.EncryptedContent[0] ^= 1
+			authenticatedSafe[i].Content = asn1.RawValue{Class: 2, Tag: 0, IsCompound: true}
+			var err error
+			if authenticatedSafe[i].Content.Bytes, err = asn1.Marshal(ed); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return authenticatedSafe
+	})
+	if _, _, err := Decode(ccmData, "pässword"); err != ErrDecryption {
+		t.Errorf("got error %v, want ErrDecryption", err)
+	}
+}
+
+// openSSL3TestData holds files produced by "openssl pkcs12 -export" of
+// OpenSSL 3.0 with the password "password", for a P-256 key and a
+// certificate for openssl3.example.com.
+var openSSL3TestData = map[string]string{
+	// The defaults: AES-256-CBC for both the key and the certificates.
+	"AES-256-CBC": `MIIELAIBAzCCA+IGCSqGSIb3DQEHAaCCA9MEggPPMIIDyzCCAoIGCSqGSIb3DQEHBqCCAnMwggJv
+AgEAMIICaAYJKoZIhvcNAQcBMFcGCSqGSIb3DQEFDTBKMCkGCSqGSIb3DQEFDDAcBAgPnEz8FLPF
+ZgICCAAwDAYIKoZIhvcNAgkFADAdBglghkgBZQMEASoEEBRW0RN0GiYCY1Vz/3WFp3WAggIA44CQ
+3WrkkvtX89IB9BSzQ8C52h35Kqnb6RPSlAP0uFPZ6WlOcggG7e9NMdJ+jANJvB52HGJE8f2TtXf+
+XEv0D4ETu4aUTwdD8xMVboz4KwJO2MFHvZha/J0T/ya4iqovVPYOTiOXqwkyTvGml6Kv/Gsz7uf9
+0ydxqH9bQT1FRVsOCRqTHkh3dPqfj8jNFHJAO3eKu538mPIXhO/39jR8LNtSE+PIosqtwtTBtrQe
+3ynbU3X9GtsjDOVkBXDJOvcP/RlbNllI1eh0KB02ml8zWqhN1FZt7t34rjQ6h1AYLexg7xuwJWZh
+C5WFlFTVCVyTrK5BjHK9R84qHpnhGzsRY1JaI5KCHp6HFg3NGHXGl5bbOYeRig7bdLSP39hs8nQZ
+GvdBKzS1TxtTPekuSbZJ+qC2/HfB+XMnZoM5RP3865GmJkNEFI92XNOzmN6K82y9+/vbfgOO1ZoK
++F/vBe9s8pNkCrTcUFPzKsD04bn705BskUv8Zw2+B36X+mZfdiaPPLn+0MfbYHFPZo+9b7+IxQR3
+lTCP5HVH2Bq9F/ORIH76kbE3MLUM0kXHYN8MHX4YQUzw3T4VNLJmxzvmxy8wwL96lzCQvtARuqsU
+XPKV2jhRGsj+KjruCk8C2UspGou2M/IXg+KNJoZJUFNON+myM26qFqarMdvNzUkBJ22a5uMwggFB
+BgkqhkiG9w0BBwGgggEyBIIBLjCCASowggEmBgsqhkiG9w0BDAoBAqCB7zCB7DBXBgkqhkiG9w0B
+BQ0wSjApBgkqhkiG9w0BBQwwHAQILyXSVVb5T18CAggAMAwGCCqGSIb3DQIJBQAwHQYJYIZIAWUD
+BAEqBBAqYCnlbU51XNK2jAExQO3fBIGQlwux/BhvYwniOA1OLUbRAyO5+6uu5Kx1UAiVV0/DgaLt
+SM977AMSQicGa5hBgrDBM1qXZAi2nx/Y+lWIqXh0wBHRgRamgRABV/q1FfN+sLTZz65coENcc9UM
+JUqVpKNP3wj9N1kh5Pju7ilxMseXbqkoR5AsmzHY9vc90XMLi32J6oZ83U526seFj5sdYm59MSUw
+IwYJKoZIhvcNAQkVMRYEFFBDwdf6x8mNxxQXrpa4iBmFGREWMEEwMTANBglghkgBZQMEAgEFAAQg
+cq8YjrfWNfh/mZLvGKG1GR2kmnldwhUlFKaqr1u00mMECJQNOg1QkqvCAgIIAA==`,
+	// -keypbe AES-128-CBC -certpbe AES-192-CBC
+	"AES-128-CBC and AES-192-CBC": `MIIELAIBAzCCA+IGCSqGSIb3DQEHAaCCA9MEggPPMIIDyzCCAoIGCSqGSIb3DQEHBqCCAnMwggJv
+AgEAMIICaAYJKoZIhvcNAQcBMFcGCSqGSIb3DQEFDTBKMCkGCSqGSIb3DQEFDDAcBAg78D4cNQhZ
+wQICCAAwDAYIKoZIhvcNAgkFADAdBglghkgBZQMEARYEEEDZPend6ixtdqXk2eBZ/LGAggIA2xWh
+bvMkgaT/eeeguuoacPds4Fcc220+O+UF7BMwAdZf/GcA/+3TeMjyng8PfNSALksjHY3SNLaMvPKg
++tLrS5Md1sq5yLHFe+JgW6rBRjgBG3vyDGpkmXwTLPNj54mfCaugx3itOKYlhwiHvWDLmoAmNyRw
+3Oy3OgBGkfDntpl1tqU7ET7zElUYHeJ980SAHNaQqg1MKDiH8pBwGGxVtp1UwUpierqvO4xVAbdI
+ycztNDVIV6rPww43Svaav8hxRVqgWUjeBVYbb5qrDUN70OIssoGGq1bTpuV2+arGKgdBXzEXT+ar
+r5gjr+MaYqqSCbhkaojypXmiciHvNogHpGDqq8kq1j+AN94PV+Mf6G5xVhTHc1zo+10XH9q4ptv+
+gRTZmCyxa35dMfuFONLlhCNDlPQT5wVTpiLnCvXMoF3KX85M2nDkBw/4yeRC9ITzsYq7TCGjZmQz
++27ZhPMxWz+OaKVg7ybaGniZ4yGDq3kd9xd/Nsx6ziplKATRJb+vt2z/hoIqop89Q2BxG/dqaejB
+4LKCCDvtXLQQU6YiNyzPh+z2AAMRhkFaqF1ptrryeCGbJ3dfCmpT1HW+iWT4FSmne8R3Zp0RHbST
+f+ADXNk7LDuw2YCWjTvmPsAje+1+2s3gmVqeTUsVQZZw9i8z2rRjXZ5S735d2G04KDyssVcwggFB
+BgkqhkiG9w0BBwGgggEyBIIBLjCCASowggEmBgsqhkiG9w0BDAoBAqCB7zCB7DBXBgkqhkiG9w0B
+BQ0wSjApBgkqhkiG9w0BBQwwHAQI4jeMHKp49c0CAggAMAwGCCqGSIb3DQIJBQAwHQYJYIZIAWUD
+BAECBBAElyuS785h/mZGjFSBvf3kBIGQTDR6GtdBYLgD8h9yctde1bLI9hZeXE+y8dpWZDgotpbm
+JnUhkVrC6MUjnI4eB843H3SjkLq679LwwD8RtNKYZN9LwmFAuRoGJC9TKvU4jJqNL7ERylgioddH
+B6tI270VlMIpJvzvd+iMJIoPd/woQAFd9gEGGpRCuZAJquiyHWFQvJ1XhWcozu6U1Du5RRwsMSUw
+IwYJKoZIhvcNAQkVMRYEFFBDwdf6x8mNxxQXrpa4iBmFGREWMEEwMTANBglghkgBZQMEAgEFAAQg
+fCQlTeHwTWZ3tnC73xGlP83sd11xLDcCxYcbZUXFb0MECHs/alf3Zs+lAgIIAA==`,
+}
+
+func TestPBES2CBC(t *testing.T) {
+	for name, base64P12 := range openSSL3TestData {
+		p12, _ := base64.StdEncoding.DecodeString(base64P12)
+		privateKey, certificate, err := Decode(p12, "password")
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if certificate.Subject.CommonName != "openssl3.example.com" {
+			t.Errorf("%s: got certificate for %q", name, certificate.Subject.CommonName)
+		}
+		if _, ok := privateKey.(*ecdsa.PrivateKey); !ok {
+			t.Errorf("%s: got private key of type %T", name, privateKey)
+		}
+		if _, _, err := Decode(p12, "wrong"); err != ErrIncorrectPassword {
+			t.Errorf("%s: got error %v for the wrong password", name, err)
+		}
+	}
+}
+
+func TestModernEncoder(t *testing.T) {
+	key, cert := newTestCertificate(t, "modern.example.com", nil, nil)
+	_, ca := newTestCertificate(t, "ca.example.com", nil, nil)
+	pfxData, err := Modern.Encode(rand.Reader, key, cert, []*x509.Certificate{ca}, "pässword")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	privateKey, certificate, caCerts, err := DecodeChainWithCAs(pfxData, "pässword")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !key.Equal(privateKey) || !certificate.Equal(cert) || len(caCerts) != 1 || !caCerts[0].Equal(ca) {
+		t.Error("decoded identity does not match")
+	}
+
+	protection, err := InspectProtection(pfxData, "pässword")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !protection.KeyAlgorithm.Equal(oidPBES2) || !protection.ContentAlgorithm.Equal(oidPBES2) || !protection.MACAlgorithm.Equal(oidSHA256) {
+		t.Errorf("got protection %+v", protection)
+	}
+
+	legacyData, err := DefaultEncoder.Encode(rand.Reader, key, cert, nil, "pässword")
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacy, err := InspectProtection(legacyData, "pässword")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckDowngrade(legacy, protection); err != nil {
+		t.Errorf("moving from DefaultEncoder to Modern is reported as a downgrade: %v", err)
+	}
+	if err := CheckDowngrade(protection, legacy); err == nil {
+		t.Error("moving from Modern to DefaultEncoder is not reported as a downgrade")
+	}
+
+	trustStore, err := Modern.EncodeTrustStore(rand.Reader, []*x509.Certificate{ca}, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if certs, err := DecodeTrustStore(trustStore, "password"); err != nil || len(certs) != 1 {
+		t.Errorf("DecodeTrustStore returned %d certificates, %v", len(certs), err)
+	}
+}
+
+func TestWithAESKeySize(t *testing.T) {
+	key, cert := newTestCertificate(t, "aes.example.com", nil, nil)
+	for _, test := range []struct {
+		bits   int
+		scheme asn1.ObjectIdentifier
+	}{
+		{128, oidAES128CBC},
+		{192, oidAES192CBC},
+		{256, oidAES256CBC},
+	} {
+		pfxData, err := Modern.WithAESKeySize(test.bits).Encode(rand.Reader, key, cert, nil, "password")
+		if err != nil {
+			t.Errorf("%d: %v", test.bits, err)
+			continue
+		}
+		privateKey, certificate, err := Decode(pfxData, "password")
+		if err != nil {
+			t.Errorf("%d: %v", test.bits, err)
+			continue
+		}
+		if !key.Equal(privateKey) || !certificate.Equal(cert) {
+			t.Errorf("%d: decoded identity does not match", test.bits)
+		}
+
+		encodedPassword, _ := bmpString("password")
+		bags, _, err := DefaultDecoder.getSafeContents(pfxData, encodedPassword)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var pkinfo encryptedPrivateKeyInfo
+		if err := unmarshal(bags[1].Value.Bytes, &pkinfo); err != nil {
+			t.Fatal(err)
+		}
+		var params pbes2Params
+		if err := unmarshal(pkinfo.AlgorithmIdentifier.Parameters.FullBytes, &params); err != nil {
+			t.Fatal(err)
+		}
+		if !params.EncryptionScheme.Algorithm.Equal(test.scheme) {
+			t.Errorf("%d: got encryption scheme %v, want %v", test.bits, params.EncryptionScheme.Algorithm, test.scheme)
+		}
+	}
+
+	if _, err := Modern.WithAESKeySize(512).Encode(rand.Reader, key, cert, nil, "password"); err == nil {
+		t.Error("encoded with 512-bit AES")
+	} else if _, ok := err.(NotImplementedError); !ok {
+		t.Errorf("got error %v for 512-bit AES, want a NotImplementedError", err)
+	}
+}
+
+// openSSLCamelliaTestData was produced by "openssl pkcs12 -export" of
+// OpenSSL 3.0 with "-keypbe CAMELLIA-256-CBC -certpbe CAMELLIA-128-CBC" and
+// the password "password", for the identity of openSSL3TestData.
+const openSSLCamelliaTestData = `MIIEMAIBAzCCA+YGCSqGSIb3DQEHAaCCA9cEggPTMIIDzzCCAoQGCSqGSIb3DQEHBqCCAnUwggJx
+AgEAMIICagYJKoZIhvcNAQcBMFkGCSqGSIb3DQEFDTBMMCkGCSqGSIb3DQEFDDAcBAjp06nGYLQz
+6QICCAAwDAYIKoZIhvcNAgkFADAfBgsqgwiMmks9AQEBAgQQ465rPoy8Z6CJkudqOeSJ8oCCAgCW
+vTJKRrPtAsO8dXFUZ0ee7+CMw0Quw8PIWc+EcOlrJ13r4/pdVEuelx8cIlBkkOoyy4AyxolPq0Pk
+FbOJvgccmAfXF8o5/y65+RgVpHQbSQg4cf/welYhshPcO9hKZRUWW8aWbtbOKIyrJ3U8sYimJFVV
+vRtJBZlCv1KQLQiMuZb06UrD0ceZVs2lucOuOmEm+QyWjX0d4qt1/RWKtiT3cMQL2KyZp+vLdGXD
+h9YeqT+YdxLe3AfE8ssw3IXuVV3vnhPsP5i4j+yBbOIOtkDJPZELBXgSNn0q+nMk3kZkErzXB/HX
+rTeal4ZWguHZD4fL7DxQBRpRl6fhnoyulMi7ktoYOe/44H6AiGBj6f7XGQVgXA1P/0QVGFXSgT7/
+tgMnhtbdZjNgbEM4QxVM4PAxtCcxeO4E6oZKjp0s+wY7dNGkYlKhe20gtN92yxiwxr6UMPXNAvio
+P0UUNzJyluAfDqhRJVZIvAGTYJ7P8mQsBkB8IrpxBtKuWjQrypunG9yzP9xUVI9BorkIQB1/vQPt
+jgxw/A7QIGmGQnOqHn4dU+QCHgZaVmO1kftVrdcTzvYJCLNUt28XEIjO2D0HEB65hAj12FZ8nELw
+hQlMSRSg22Q5R48PY31qfszcmMIpgJoPTqwLsyujJNmmrryEhQJ+kG3G/jsvve3dyewtyHWFZzCC
+AUMGCSqGSIb3DQEHAaCCATQEggEwMIIBLDCCASgGCyqGSIb3DQEMCgECoIHxMIHuMFkGCSqGSIb3
+DQEFDTBMMCkGCSqGSIb3DQEFDDAcBAio2CE9vADVywICCAAwDAYIKoZIhvcNAgkFADAfBgsqgwiM
+mks9AQEBBAQQ5FrGjM8f+p27PWpbeTAdtASBkKnMv3M+8PeP6udnHqChSdWCVpTny7m6bKvBXRz/
+pbbB92EHL84Lyv3cN0VUcguJvhAlkMNsyB5qJR3fAekmV+pp+gbYGs+kOYXauooQCi6rDocrLVSq
+09kbsCFIDCN1FUta182HUhtwjDSa8IoxugS1tdLc/GR9HZybdNxiL2U2wfMEVHXOC430pwRERzC6
+mjElMCMGCSqGSIb3DQEJFTEWBBRQQ8HX+sfJjccUF66WuIgZhRkRFjBBMDEwDQYJYIZIAWUDBAIB
+BQAEIPN3xOabo19IifIr3UJ3pCH11KEEOd0V5gUwqWLMO4zBBAjmevyzO/10+AICCAA=`
+
+func TestCamellia(t *testing.T) {
+	p12, _ := base64.StdEncoding.DecodeString(openSSLCamelliaTestData)
+	privateKey, certificate, err := Decode(p12, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key, ok := privateKey.(*ecdsa.PrivateKey); !ok || !publicKeyMatches(key.Public(), certificate) {
+		t.Errorf("got the wrong private key %T", privateKey)
+	}
+
+	key, cert := newTestCertificate(t, "camellia.example.com", nil, nil)
+	for _, bits := range []int{128, 192, 256} {
+		pfxData, err := Modern.WithCamellia(bits).Encode(rand.Reader, key, cert, nil, "password")
+		if err != nil {
+			t.Errorf("%d: %v", bits, err)
+			continue
+		}
+		privateKey, certificate, err := Decode(pfxData, "password")
+		if err != nil {
+			t.Errorf("%d: %v", bits, err)
+			continue
+		}
+		if !key.Equal(privateKey) || !certificate.Equal(cert) {
+			t.Errorf("%d: decoded identity does not match", bits)
+		}
+
+		compat, err := ProbeCompatibility(pfxData)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, c := range compat {
+			if want := strings.HasPrefix(c.Reader, "OpenSSL"); c.Compatible != want {
+				t.Errorf("%d: %s: got compatible %v, want %v", bits, c.Reader, c.Compatible, want)
+			}
+		}
+	}
+
+	if _, err := Modern.WithCamellia(64).Encode(rand.Reader, key, cert, nil, "password"); err == nil {
+		t.Error("encoded with 64-bit Camellia")
+	} else if _, ok := err.(NotImplementedError); !ok {
+		t.Errorf("got error %v for 64-bit Camellia, want a NotImplementedError", err)
+	}
+}
+
+// openSSLSMTestData was produced by "openssl pkcs12 -export" of OpenSSL 3.0
+// with "-keypbe SM4-CBC -certpbe SM4-CBC -macalg SM3" and the password
+// "password", for the identity of openSSL3TestData.
+const openSSLSMTestData = `MIIEKQIBAzCCA+AGCSqGSIb3DQEHAaCCA9EEggPNMIIDyTCCAoEGCSqGSIb3DQEHBqCCAnIwggJu
+AgEAMIICZwYJKoZIhvcNAQcBMFYGCSqGSIb3DQEFDTBJMCkGCSqGSIb3DQEFDDAcBAgUXVszebwW
+UQICCAAwDAYIKoZIhvcNAgkFADAcBggqgRzPVQFoAgQQGANKFSrZz8f7UCFSRxb+HYCCAgBZBxEW
+YRwB8DZSelaChoAcTOLX6mU0ClJHurlCyz3xAOBvjzltPplH1Xe9p8GOiuMVkFy+yYO3Wu5TWRx8
+9eYgSE6ejb5J2UyrMxHEdLHx6NUQsFMhljdG6zXx64icSSgqRIgaEgsHMS/bRmqzekCOYboIdt/n
+Ids2rFM+sNS89ytgpXmQBZkmBzb8BJsS5dw6/QvJhGMM+kBcYGArGdch9vx4UIfIOZvfOPTpudG0
+iCrHXpljJcDEh+twFrHzQWckg70R07tE2T5AbvwRLV+hNHKbvSNg8WD+t1MqeG0L45Lqtsf19o6j
+0vlc7W2OBF4HTjkUzcjQdwq6NMf+nrT1BwvA9qg443mHjjMSUSCnzDbVdDPAPeXHfbKqOTZOmG0X
+/5DD4oW1YibkqY7QqnP1+CU5FnhZYHVPYK97Adkl4sWubg5dILZC5TQktqDH8CXRoA4XuGykE1Wh
+JSUvrSPN0/n9qIyHp5JaJ56Qw0d6qPuylaJsdxIjszO6IL8JqTyKm2JdphLkOVyG14IeoirPmvVC
+bowdXTZU/mqQ+TrZc0ZjTcluuqmyJyFoIlQYNhcHd360ZkjKKUVqEzxNwZVtfLMGlGDXpWFRh7dQ
+kw4eIng1eBDMKLNWCjFhMgiKfdTTZpCKVOehKega5PkExH+rqeizWfMFWqM1sYTxaZ2GXTCCAUAG
+CSqGSIb3DQEHAaCCATEEggEtMIIBKTCCASUGCyqGSIb3DQEMCgECoIHuMIHrMFYGCSqGSIb3DQEF
+DTBJMCkGCSqGSIb3DQEFDDAcBAiuLRWX9L+2WwICCAAwDAYIKoZIhvcNAgkFADAcBggqgRzPVQFo
+AgQQbF/+p8WoHxADhek/V96d8ASBkHt5jwp0MWoxb/sK8UFf8WFlWo4M+A0tvppXsqnWPaf+MdjY
+Qx7anbkrHj8+e5ez/mRizVvSi8CGi3/XfP3SC9G9TU32c1uTn41FluXUpiTXngchvPVlPPXuzAT/
+4Q2R2T0OrH9/AbhNYkJZPXXO44EUJVez0i7758qvk+RJ9RKvV/RBIApxdQBiRJAaMvUw8DElMCMG
+CSqGSIb3DQEJFTEWBBRQQ8HX+sfJjccUF66WuIgZhRkRFjBAMDAwDAYIKoEcz1UBgxEFAAQgB+lO
+NEw4pfWUrra23VUih31Vu3ZPQ2+0xhUw2qe1KdgECPVm57nRY8R0AgIIAA==`
+
+func TestSM4AndSM3(t *testing.T) {
+	p12, _ := base64.StdEncoding.DecodeString(openSSLSMTestData)
+	privateKey, certificate, err := Decode(p12, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key, ok := privateKey.(*ecdsa.PrivateKey); !ok || !publicKeyMatches(key.Public(), certificate) {
+		t.Errorf("got the wrong private key %T", privateKey)
+	}
+	if _, _, err := Decode(p12, "wrong"); err != ErrIncorrectPassword {
+		t.Errorf("got error %v for the wrong password", err)
+	}
+
+	// OpenSSL cannot use HMAC-SM3 as the PBKDF2 pseudorandom function, so
+	// encrypt with it here.
+	salt, iv := make([]byte, 16), make([]byte, 16)
+	rand.Read(salt)
+	rand.Read(iv)
+	key, err := pbkdf2.Key(sm3.New, "password", salt, 2048, 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err := sm4.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext := []byte("0123456789abcdef")
+	padded := append(plaintext, bytes.Repeat([]byte{16}, 16)...)
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(padded, padded)
+
+	kdfParams, _ := asn1.Marshal(pbkdf2Params{
+		Salt:           salt,
+		IterationCount: 2048,
+		PRF:            pkix.AlgorithmIdentifier{Algorithm: oidHmacWithSM3, Parameters: asn1.NullRawValue},
+	})
+	schemeParams, _ := asn1.Marshal(iv)
+	params, _ := asn1.Marshal(pbes2Params{
+		KeyDerivationFunc: pkix.AlgorithmIdentifier{Algorithm: oidPBKDF2, Parameters: asn1.RawValue{FullBytes: kdfParams}},
+		EncryptionScheme:  pkix.AlgorithmIdentifier{Algorithm: oidSM4CBC, Parameters: asn1.RawValue{FullBytes: schemeParams}},
+	})
+	encodedPassword, _ := bmpString("password")
+	decrypted, err := pbes2Decrypt(nil, pkix.AlgorithmIdentifier{Algorithm: oidPBES2, Parameters: asn1.RawValue{FullBytes: params}}, padded, encodedPassword, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decrypted, plaintext) {
+		t.Errorf("got %q, want %q", decrypted, plaintext)
+	}
+}
+
+// openSSLSEEDTestData was produced by "openssl pkcs12 -export" of OpenSSL
+// 3.0 with "-keypbe SEED-CBC -certpbe SEED-CBC" and the legacy provider,
+// and the password "password", for the identity of openSSL3TestData.
+var openSSLSEEDTestData = `MIIEKgIBAzCCA+AGCSqGSIb3DQEHAaCCA9EEggPNMIIDyTCCAoEGCSqGSIb3DQEHBqCCAnIwggJu
+AgEAMIICZwYJKoZIhvcNAQcBMFYGCSqGSIb3DQEFDTBJMCkGCSqGSIb3DQEFDDAcBAgOsWRWp9kg
+mQICCAAwDAYIKoZIhvcNAgkFADAcBggqgxqMmkQBBAQQfQuhP4OTkBlu0Lc1ziHZj4CCAgCkKPOO
+X4n958p8AmaqkFyELQz4/GGP4GcyMHuKCLwuEiju0LAeZJzZ8zc8t4NZlx+rko3u02ozU9NejSKc
++St320Tr+WMaZoGyAse/L8o3+acP2diWWhz9mOdX8MQyqmCaHExIc0o69gdSbotL7irPVifr0tE6
+EmqilyBEvspwEuwsXdZ3cHDf7W/c4VuHjZXn5AIeR7IlnjD6KB3xdfyDk5pC7t73aikzkJww7ENy
+7045qf9SfEjJNObEt6VoGCz630fBOb1dLDV81NR6YJbLBDiUiRWHpQfYwux+uauifJIaKjpqBJ15
+auLkpsHH1zc5rArQ4MHi3w+rkSFHkn/OEtYSIB4/mwUz1k+6/3GVL9wAWPqBNprzWMQe6vlfvKqW
+GpovThh/yf5H97xiRbvyS+K/3NYbZrFLM9DvC2VlkUin9TNMp0raOeMACpwiEaTHwHqlb3hU37Cz
+N6O6B+NeTOptKrdOhyDX2QuL1c61V1xLvRsu2YpySByrWOoZLyT9bwkqxOS4pChlW1u/uzQv0QtL
+oqqO7ptO1iwIaqwucGpbH2nGndS6NqT8fgQiI8zqCtIbgzJn8MOEsEKmJLiDKLxEJiW/wy5urd2X
+6HLQ7lS9iU2lZpzqT/dVxb+o6LpocOaqGINzlIMlUR06FWww9hbvOv0Ug+LvjbTUMtg02jCCAUAG
+CSqGSIb3DQEHAaCCATEEggEtMIIBKTCCASUGCyqGSIb3DQEMCgECoIHuMIHrMFYGCSqGSIb3DQEF
+DTBJMCkGCSqGSIb3DQEFDDAcBAjjFEtW0WSvGQICCAAwDAYIKoZIhvcNAgkFADAcBggqgxqMmkQB
+BAQQagZ3eTy6CQ56OLTTYEVM5QSBkLhDI4CBV/lmYnEfcER/eGf4Qn/ffhN+1sA6mqhn70s3L3a7
+nDNnPDquiNpoALNey49pqehMPXmpm6WENcAoneoz1G5RlPbIO+yHvwQ0XRwRLwl+9iwyoLt0FdQi
+e9f2ePO+0td3b8mHoTe49kWjKrh5EYgH94/GboMdOaucs8TegoMNkOL8Efnkf8x875PKOzElMCMG
+CSqGSIb3DQEJFTEWBBRQQ8HX+sfJjccUF66WuIgZhRkRFjBBMDEwDQYJYIZIAWUDBAIBBQAEIOHI
+QhEjfBw9jqNJBgprBCG5HrU2B6PyYC43uitaSY3/BAg1RJGEurJQDQICCAA=`
+
+func TestSEED(t *testing.T) {
+	p12, _ := base64.StdEncoding.DecodeString(openSSLSEEDTestData)
+	privateKey, certificate, err := Decode(p12, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key, ok := privateKey.(*ecdsa.PrivateKey); !ok || !publicKeyMatches(key.Public(), certificate) {
+		t.Errorf("got the wrong private key %T", privateKey)
+	}
+	if _, _, err := Decode(p12, "wrong"); err != ErrIncorrectPassword {
+		t.Errorf("got error %v for the wrong password", err)
+	}
+
+	compat, err := ProbeCompatibility(p12)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range compat {
+		if want := c.Reader == "OpenSSL 1.0" || c.Reader == "OpenSSL 1.1"; c.Compatible != want {
+			t.Errorf("%s: got compatible %v, want %v", c.Reader, c.Compatible, want)
+		}
+	}
+}
+
+func TestChaCha20Poly1305(t *testing.T) {
+	key, cert := newTestCertificate(t, "chacha.example.com", nil, nil)
+	pfxData, err := Modern.WithChaCha20Poly1305(true).Encode(rand.Reader, key, cert, nil, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	privateKey, certificate, err := Decode(pfxData, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !key.Equal(privateKey) || !certificate.Equal(cert) {
+		t.Error("decoded identity does not match")
+	}
+	if _, _, err := Decode(pfxData, "wrong"); err != ErrIncorrectPassword {
+		t.Errorf("got error %v for the wrong password, want ErrIncorrectPassword", err)
+	}
+
+	algorithm, err := newPBES2Algorithm(rand.Reader, pbeSettings{iterations: 1, chacha20Poly1305: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	encodedPassword, _ := bmpString("password")
+	encrypted, err := pbes2Encrypt(algorithm, []byte("plaintext"), encodedPassword, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(encrypted) != len("plaintext")+16 {
+		t.Errorf("got %d bytes of ciphertext, want the plaintext and a 16-byte tag", len(encrypted))
+	}
+	encrypted[0] ^= 1
+	if _, err := pbes2Decrypt(nil, algorithm, encrypted, encodedPassword, nil); err != ErrDecryption {
+		t.Errorf("got error %v for a modified ciphertext, want ErrDecryption", err)
+	}
+
+	compat, err := ProbeCompatibility(pfxData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range compat {
+		if c.Compatible {
+			t.Errorf("%s: got compatible, want incompatible", c.Reader)
+		}
+	}
+}
@@ -2,35 +2,30 @@
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
 
-package pkcs12
-
-import (
-	"bytes"
-	"crypto/sha1"
-	"math/big"
-)
-
-var (
-	one = big.NewInt(1)
-)
-
-// sha1Sum returns the SHA-1 hash of in.
-func sha1Sum(in []byte) []byte {
-	sum := sha1.Sum(in)
-	return sum[:]
-}
+package core
+
+import "hash"
 
-// fillWithRepeats returns v*ceiling(len(pattern) / v) bytes consisting of
-// repeats of pattern.
-func fillWithRepeats(pattern []byte, v int) []byte {
-	if len(pattern) == 0 {
-		return nil
+// fillWithRepeats fills dst with repeats of pattern, the final copy of
+// which may be truncated.
+func fillWithRepeats(dst, pattern []byte) {
+	for i := 0; i < len(dst); i += len(pattern) {
+		copy(dst[i:], pattern)
 	}
-	outputLen := v * ((len(pattern) + v - 1) / v)
-	return bytes.Repeat(pattern, (outputLen+len(pattern)-1)/len(pattern))[:outputLen]
 }
 
-func pbkdf(hash func([]byte) []byte, u, v int, salt, password []byte, r int, ID byte, size int) (key []byte) {
+// roundUp returns n rounded up to a multiple of v.
+func roundUp(n, v int) int {
+	return v * ((n + v - 1) / v)
+}
+
+// pbkdf derives size bytes of key material, notifying m of each iteration,
+// or returns that of the external KDF of m if it has one.
+func pbkdf(newHash func() hash.Hash, u, v int, salt, password []byte, r int, ID byte, size int, m *kdfMonitor) (key []byte) {
+	if m != nil && m.kdf != nil {
+		return m.derive(salt, r, KDFPurpose(ID), size)
+	}
+
 	// implementation of https://tools.ietf.org/html/rfc7292#appendix-B.2 , RFC text verbatim in comments
 
 	//    Let H be a hash function built around a compression function f:
@@ -74,11 +69,26 @@ func pbkdf(hash func([]byte) []byte, u, v int, salt, password []byte, r int, ID
 	//    3.  If ID=3, then the pseudorandom bits being produced are to be used
 	//        as an integrity key for MACing.
 
+	// The working strings D, I, A_i and B are carved out of a single
+	// scratch buffer.
+	sLen, pLen := 0, 0
+	if len(salt) > 0 {
+		sLen = roundUp(len(salt), v)
+	}
+	if len(password) > 0 {
+		pLen = roundUp(len(password), v)
+	}
+	buf := getScratch(v + sLen + pLen + u + v)
+	defer putScratch(buf)
+	DI := (*buf)[:v+sLen+pLen]
+	Ai := (*buf)[len(DI) : len(DI)+u : len(DI)+u]
+	B := (*buf)[len(DI)+u:]
+
 	//    1.  Construct a string, D (the "diversifier"), by concatenating v/8
 	//        copies of ID.
-	var D []byte
-	for i := 0; i < v; i++ {
-		D = append(D, ID)
+	D := DI[:v]
+	for i := range D {
+		D[i] = ID
 	}
 
 	//    2.  Concatenate copies of the salt together to create a string S of
@@ -86,72 +96,60 @@ func pbkdf(hash func([]byte) []byte, u, v int, salt, password []byte, r int, ID
 	//        truncated to create S).  Note that if the salt is the empty
 	//        string, then so is S.
 
-	S := fillWithRepeats(salt, v)
+	S := DI[v : v+sLen]
+	fillWithRepeats(S, salt)
 
 	//    3.  Concatenate copies of the password together to create a string P
 	//        of length v(ceiling(p/v)) bits (the final copy of the password
 	//        may be truncated to create P).  Note that if the password is the
 	//        empty string, then so is P.
 
-	P := fillWithRepeats(password, v)
+	P := DI[v+sLen:]
+	fillWithRepeats(P, password)
 
 	//    4.  Set I=S||P to be the concatenation of S and P.
-	I := append(S, P...)
+	I := DI[v:]
 
 	//    5.  Set c=ceiling(n/u).
 	c := (size + u - 1) / u
 
 	//    6.  For i=1, 2, ..., c, do the following:
-	A := make([]byte, c*20)
-	var IjBuf []byte
+	A := make([]byte, c*u)
+	h := newHash()
 	for i := 0; i < c; i++ {
 		//        A.  Set A2=H^r(D||I). (i.e., the r-th hash of D||1,
 		//            H(H(H(... H(D||I))))
-		Ai := hash(append(D, I...))
+		h.Reset()
+		h.Write(DI)
+		Ai = h.Sum(Ai[:0])
+		if !m.iteration(i*r+1, c*r) {
+			return nil
+		}
 		for j := 1; j < r; j++ {
-			Ai = hash(Ai)
+			h.Reset()
+			h.Write(Ai)
+			Ai = h.Sum(Ai[:0])
+			if !m.iteration(i*r+j+1, c*r) {
+				return nil
+			}
 		}
-		copy(A[i*20:], Ai[:])
+		copy(A[i*u:], Ai)
 
 		if i < c-1 { // skip on last iteration
 			// B.  Concatenate copies of Ai to create a string B of length v
 			//     bits (the final copy of Ai may be truncated to create B).
-			var B []byte
-			for len(B) < v {
-				B = append(B, Ai[:]...)
-			}
-			B = B[:v]
+			fillWithRepeats(B, Ai)
 
 			// C.  Treating I as a concatenation I_0, I_1, ..., I_(k-1) of v-bit
 			//     blocks, where k=ceiling(s/v)+ceiling(p/v), modify I by
 			//     setting I_j=(I_j+B+1) mod 2^v for each j.
-			{
-				Bbi := new(big.Int).SetBytes(B)
-				Ij := new(big.Int)
-
-				for j := 0; j < len(I)/v; j++ {
-					Ij.SetBytes(I[j*v : (j+1)*v])
-					Ij.Add(Ij, Bbi)
-					Ij.Add(Ij, one)
-					Ijb := Ij.Bytes()
-					// We expect Ijb to be exactly v bytes,
-					// if it is longer or shorter we must
-					// adjust it accordingly.
-					if len(Ijb) > v {
-						Ijb = Ijb[len(Ijb)-v:]
-					}
-					if len(Ijb) < v {
-						if IjBuf == nil {
-							IjBuf = make([]byte, v)
-						}
-						bytesShort := v - len(Ijb)
-						for i := 0; i < bytesShort; i++ {
-							IjBuf[i] = 0
-						}
-						copy(IjBuf[bytesShort:], Ijb)
-						Ijb = IjBuf
-					}
-					copy(I[j*v:(j+1)*v], Ijb)
+			for j := 0; j < len(I)/v; j++ {
+				Ij := I[j*v : (j+1)*v]
+				carry := 1
+				for k := v - 1; k >= 0; k-- {
+					sum := int(Ij[k]) + int(B[k]) + carry
+					Ij[k] = byte(sum)
+					carry = sum >> 8
 				}
 			}
 		}
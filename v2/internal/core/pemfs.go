@@ -0,0 +1,137 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"io"
+	"io/fs"
+)
+
+// EncodeFromFS reads a PEM-encoded private key from keyPath, a PEM-encoded
+// end-entity certificate from certPath, and PEM-encoded CA certificates from
+// every file in fsys matching chainGlob, and encodes them using
+// DefaultEncoder and entropy from crypto/rand.  See Encoder.EncodeFromFS.
+func EncodeFromFS(fsys fs.FS, keyPath, certPath, chainGlob, password string) (pfxData []byte, err error) {
+	return DefaultEncoder.EncodeFromFS(rand.Reader, fsys, keyPath, certPath, chainGlob, password)
+}
+
+// EncodeFromFS reads a PEM-encoded private key from keyPath, a PEM-encoded
+// end-entity certificate from certPath, and PEM-encoded CA certificates from
+// every file in fsys matching chainGlob, and encodes them with enc.Encode.
+//
+// The first certificate in certPath is the end-entity certificate; any
+// further certificates in certPath (as found in "fullchain" files) are
+// treated as CA certificates and precede those matched by chainGlob.  Files
+// matched by chainGlob are read in lexical order.  chainGlob may be empty,
+// in which case only certPath is consulted.
+//
+// The private key may be a PKCS#8 "PRIVATE KEY", a PKCS#1 "RSA PRIVATE KEY",
+// or a SEC 1 "EC PRIVATE KEY" block.  Encrypted PEM keys are not supported;
+// see EncryptedPEMKey.
+func (enc *Encoder) EncodeFromFS(rand io.Reader, fsys fs.FS, keyPath, certPath, chainGlob, password string) (pfxData []byte, err error) {
+	keyPEM, err := fs.ReadFile(fsys, keyPath)
+	if err != nil {
+		return nil, errors.New("pkcs12: error reading private key: " + err.Error())
+	}
+	privateKey, err := parsePEMPrivateKey(keyPEM)
+	if err != nil {
+		return nil, err
+	}
+
+	certPEM, err := fs.ReadFile(fsys, certPath)
+	if err != nil {
+		return nil, errors.New("pkcs12: error reading certificate: " + err.Error())
+	}
+	certs, err := parsePEMCertificates(certPEM)
+	if err != nil {
+		return nil, err
+	}
+	if len(certs) == 0 {
+		return nil, errors.New("pkcs12: no certificate found in " + certPath)
+	}
+	certificate, caCerts := certs[0], certs[1:]
+
+	if chainGlob != "" {
+		matches, err := fs.Glob(fsys, chainGlob)
+		if err != nil {
+			return nil, errors.New("pkcs12: error matching CA certificates: " + err.Error())
+		}
+		for _, match := range matches {
+			chainPEM, err := fs.ReadFile(fsys, match)
+			if err != nil {
+				return nil, errors.New("pkcs12: error reading CA certificate: " + err.Error())
+			}
+			chain, err := parsePEMCertificates(chainPEM)
+			if err != nil {
+				return nil, err
+			}
+			caCerts = append(caCerts, chain...)
+		}
+	}
+
+	return enc.Encode(rand, privateKey, certificate, caCerts, password)
+}
+
+// parsePEMPrivateKey returns the first private key found in pemData.
+func parsePEMPrivateKey(pemData []byte) (privateKey interface{}, err error) {
+	for {
+		var block *pem.Block
+		if block, pemData = pem.Decode(pemData); block == nil {
+			return nil, errors.New("pkcs12: no private key found in PEM data")
+		}
+
+		if !isPEMPrivateKeyType(block.Type) {
+			continue
+		}
+		return parsePEMPrivateKeyBlock(block.Type, block.Bytes)
+	}
+}
+
+// isPEMPrivateKeyType reports whether parsePEMPrivateKeyBlock handles PEM
+// blocks of type blockType.
+func isPEMPrivateKeyType(blockType string) bool {
+	return blockType == privateKeyType || blockType == "RSA PRIVATE KEY" || blockType == "EC PRIVATE KEY"
+}
+
+// parsePEMPrivateKeyBlock parses der, the contents of a PEM block of type
+// blockType holding an unencrypted private key.
+func parsePEMPrivateKeyBlock(blockType string, der []byte) (privateKey interface{}, err error) {
+	switch blockType {
+	case privateKeyType:
+		privateKey, err = parsePKCS8PrivateKey(der)
+	case "RSA PRIVATE KEY":
+		privateKey, err = x509.ParsePKCS1PrivateKey(der)
+	case "EC PRIVATE KEY":
+		privateKey, err = parseECPrivateKey(der)
+	default:
+		return nil, errors.New("pkcs12: unsupported PEM block type " + blockType)
+	}
+	if err != nil {
+		return nil, errors.New("pkcs12: error parsing " + blockType + ": " + err.Error())
+	}
+	return privateKey, nil
+}
+
+// parsePEMCertificates returns every certificate found in pemData, in order.
+func parsePEMCertificates(pemData []byte) (certs []*x509.Certificate, err error) {
+	for {
+		var block *pem.Block
+		if block, pemData = pem.Decode(pemData); block == nil {
+			return certs, nil
+		}
+		if block.Type != certificateType {
+			continue
+		}
+		cert, err := parseCertificate(block.Bytes)
+		if err != nil {
+			return nil, errors.New("pkcs12: error parsing certificate: " + err.Error())
+		}
+		certs = append(certs, cert)
+	}
+}
@@ -0,0 +1,108 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+	"testing/fstest"
+)
+
+func TestEncodeFromFS(t *testing.T) {
+	rootKey, root := newTestCertificate(t, "root", nil, nil)
+	intermediateKey, intermediate := newTestCertificate(t, "intermediate", root, rootKey)
+	leafKey, leaf := newTestCertificate(t, "leaf.example.com", intermediate, intermediateKey)
+
+	keyDER, err := x509.MarshalECPrivateKey(leafKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM := func(certs ...*x509.Certificate) []byte {
+		var out []byte
+		for _, cert := range certs {
+			out = append(out, pem.EncodeToMemory(&pem.Block{Type: certificateType, Bytes: cert.Raw})...)
+		}
+		return out
+	}
+
+	fsys := fstest.MapFS{
+		"key.pem":          {Data: pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})},
+		"cert.pem":         {Data: certPEM(leaf, intermediate)},
+		"chain/0-root.pem": {Data: certPEM(root)},
+		"chain/README":     {Data: []byte("not a certificate")},
+	}
+
+	pfxData, err := EncodeFromFS(fsys, "key.pem", "cert.pem", "chain/*.pem", "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	blocks, err := ToPEM(pfxData, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, block := range blocks {
+		if block.Type != certificateType {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, cert.Subject.CommonName)
+	}
+	want := []string{"leaf.example.com", "intermediate", "root"}
+	if len(got) != len(want) {
+		t.Fatalf("got certificates %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("certificate #%d: got %q, want %q", i, got[i], want[i])
+		}
+	}
+
+	if _, err := EncodeFromFS(fsys, "cert.pem", "cert.pem", "", "password"); err == nil {
+		t.Error("expected error when key file contains no private key")
+	}
+	if _, err := EncodeFromFS(fsys, "key.pem", "missing.pem", "", "password"); err == nil {
+		t.Error("expected error when certificate file is missing")
+	}
+}
+
+func TestEncoderEncodeFromFS(t *testing.T) {
+	key, cert := newTestCertificate(t, "leaf.example.com", nil, nil)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fsys := fstest.MapFS{
+		"key.pem":  {Data: pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})},
+		"cert.pem": {Data: pem.EncodeToMemory(&pem.Block{Type: certificateType, Bytes: cert.Raw})},
+	}
+
+	enc := Modern.WithFixedRandomness([]byte("seed"))
+	pfxData, err := enc.EncodeFromFS(nil, fsys, "key.pem", "cert.pem", "", "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := enc.EncodeFromFS(nil, fsys, "key.pem", "cert.pem", "", "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(pfxData, again) {
+		t.Error("encoding with fixed randomness is not deterministic")
+	}
+
+	mac, err := PeekMAC(pfxData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !mac.Digest.Equal(oidSHA256) {
+		t.Errorf("got MAC digest %v, want SHA-256 as used by Modern", mac.Digest)
+	}
+}
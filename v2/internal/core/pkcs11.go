@@ -0,0 +1,222 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/asn1"
+	"errors"
+	"math/big"
+)
+
+// PKCS#11 key types (CKK_*), as used in PKCS11PrivateKey.KeyType.
+const (
+	PKCS11KeyTypeRSA       uint = 0x00000000 // CKK_RSA
+	PKCS11KeyTypeEC        uint = 0x00000003 // CKK_EC
+	PKCS11KeyTypeECEdwards uint = 0x00000040 // CKK_EC_EDWARDS
+)
+
+var (
+	oidNamedCurveP224 = asn1.ObjectIdentifier{1, 3, 132, 0, 33}
+	oidNamedCurveP256 = asn1.ObjectIdentifier{1, 2, 840, 10045, 3, 1, 7}
+	oidNamedCurveP384 = asn1.ObjectIdentifier{1, 3, 132, 0, 34}
+	oidNamedCurveP521 = asn1.ObjectIdentifier{1, 3, 132, 0, 35}
+	oidEd25519        = asn1.ObjectIdentifier{1, 3, 101, 112}
+)
+
+// PKCS11Objects holds the attribute values needed to create the objects of
+// an identity decoded from a PKCS#12 file on a PKCS#11 token with
+// C_CreateObject.  Every byte slice is encoded exactly as PKCS#11 expects for
+// the attribute named in its comment; big integers are unsigned and
+// big-endian.  All objects share the same CKA_ID, so that tokens and
+// middleware can associate them.
+type PKCS11Objects struct {
+	PrivateKey PKCS11PrivateKey
+	PublicKey  PKCS11PublicKey
+
+	// Certificates holds the end-entity certificate followed by any CA
+	// certificates.
+	Certificates []PKCS11Certificate
+}
+
+// PKCS11PrivateKey holds the attributes of a CKO_PRIVATE_KEY object.
+// Fields which do not apply to KeyType are nil.
+type PKCS11PrivateKey struct {
+	KeyType uint   // CKA_KEY_TYPE
+	ID      []byte // CKA_ID
+	Label   string // CKA_LABEL
+	Subject []byte // CKA_SUBJECT
+
+	// RSA keys
+	Modulus         []byte // CKA_MODULUS
+	PublicExponent  []byte // CKA_PUBLIC_EXPONENT
+	PrivateExponent []byte // CKA_PRIVATE_EXPONENT
+	Prime1          []byte // CKA_PRIME_1
+	Prime2          []byte // CKA_PRIME_2
+	Exponent1       []byte // CKA_EXPONENT_1
+	Exponent2       []byte // CKA_EXPONENT_2
+	Coefficient     []byte // CKA_COEFFICIENT
+
+	// EC and Edwards keys
+	ECParams []byte // CKA_EC_PARAMS: DER-encoded curve OID
+	Value    []byte // CKA_VALUE: private scalar or Ed25519 seed
+}
+
+// PKCS11PublicKey holds the attributes of a CKO_PUBLIC_KEY object.
+// Fields which do not apply to KeyType are nil.
+type PKCS11PublicKey struct {
+	KeyType uint   // CKA_KEY_TYPE
+	ID      []byte // CKA_ID
+	Label   string // CKA_LABEL
+	Subject []byte // CKA_SUBJECT
+
+	// RSA keys
+	Modulus        []byte // CKA_MODULUS
+	PublicExponent []byte // CKA_PUBLIC_EXPONENT
+
+	// EC and Edwards keys
+	ECParams []byte // CKA_EC_PARAMS: DER-encoded curve OID
+	ECPoint  []byte // CKA_EC_POINT: DER-encoded OCTET STRING
+}
+
+// PKCS11Certificate holds the attributes of a CKO_CERTIFICATE object of type
+// CKC_X_509.
+type PKCS11Certificate struct {
+	ID           []byte // CKA_ID
+	Label        string // CKA_LABEL
+	Subject      []byte // CKA_SUBJECT
+	Issuer       []byte // CKA_ISSUER
+	SerialNumber []byte // CKA_SERIAL_NUMBER: DER-encoded INTEGER
+	Value        []byte // CKA_VALUE: DER-encoded certificate
+}
+
+// DecodePKCS11 decodes pfxData with DecodeChainWithCAs and returns the
+// PKCS#11 attribute values for its private key, public key, and
+// certificates.  RSA (two-prime), ECDSA (NIST curves), and Ed25519 keys are
+// supported.
+//
+// The CKA_ID of the private key, public key, and end-entity certificate is
+// the certificate's subject key identifier if present, or else the SHA-1
+// hash of its subject public key.  CA certificates get an ID computed the
+// same way from their own public key.  Labels are the common name of the
+// respective certificate's subject.
+func DecodePKCS11(pfxData []byte, password string) (*PKCS11Objects, error) {
+	return DefaultDecoder.DecodePKCS11(pfxData, password)
+}
+
+// DecodePKCS11 is like the package-level DecodePKCS11 function, but uses the
+// options of dec.
+func (dec *Decoder) DecodePKCS11(pfxData []byte, password string) (*PKCS11Objects, error) {
+	privateKey, certificate, caCerts, err := dec.DecodeChainWithCAs(pfxData, password)
+	if err != nil {
+		return nil, err
+	}
+
+	objects := new(PKCS11Objects)
+	for _, cert := range append([]*x509.Certificate{certificate}, caCerts...) {
+		serial, err := asn1.Marshal(cert.SerialNumber)
+		if err != nil {
+			return nil, err
+		}
+		objects.Certificates = append(objects.Certificates, PKCS11Certificate{
+			ID:           pkcs11ID(cert),
+			Label:        cert.Subject.CommonName,
+			Subject:      cert.RawSubject,
+			Issuer:       cert.RawIssuer,
+			SerialNumber: serial,
+			Value:        cert.Raw,
+		})
+	}
+
+	priv := &objects.PrivateKey
+	pub := &objects.PublicKey
+	priv.ID, pub.ID = objects.Certificates[0].ID, objects.Certificates[0].ID
+	priv.Label, pub.Label = certificate.Subject.CommonName, certificate.Subject.CommonName
+	priv.Subject, pub.Subject = certificate.RawSubject, certificate.RawSubject
+
+	switch key := privateKey.(type) {
+	case *rsa.PrivateKey:
+		if len(key.Primes) != 2 {
+			return nil, NotImplementedError("multi-prime RSA keys cannot be represented in PKCS#11")
+		}
+		key.Precompute()
+		priv.KeyType, pub.KeyType = PKCS11KeyTypeRSA, PKCS11KeyTypeRSA
+		priv.Modulus, pub.Modulus = key.N.Bytes(), key.N.Bytes()
+		e := big.NewInt(int64(key.E)).Bytes()
+		priv.PublicExponent, pub.PublicExponent = e, e
+		priv.PrivateExponent = key.D.Bytes()
+		priv.Prime1 = key.Primes[0].Bytes()
+		priv.Prime2 = key.Primes[1].Bytes()
+		priv.Exponent1 = key.Precomputed.Dp.Bytes()
+		priv.Exponent2 = key.Precomputed.Dq.Bytes()
+		priv.Coefficient = key.Precomputed.Qinv.Bytes()
+
+	case *ecdsa.PrivateKey:
+		var oid asn1.ObjectIdentifier
+		switch key.Curve {
+		case elliptic.P224():
+			oid = oidNamedCurveP224
+		case elliptic.P256():
+			oid = oidNamedCurveP256
+		case elliptic.P384():
+			oid = oidNamedCurveP384
+		case elliptic.P521():
+			oid = oidNamedCurveP521
+		default:
+			return nil, NotImplementedError("unsupported elliptic curve")
+		}
+		ecdhKey, err := key.ECDH()
+		if err != nil {
+			return nil, err
+		}
+		if priv.ECParams, err = asn1.Marshal(oid); err != nil {
+			return nil, err
+		}
+		if pub.ECPoint, err = asn1.Marshal(ecdhKey.PublicKey().Bytes()); err != nil {
+			return nil, err
+		}
+		priv.KeyType, pub.KeyType = PKCS11KeyTypeEC, PKCS11KeyTypeEC
+		pub.ECParams = priv.ECParams
+		priv.Value = ecdhKey.Bytes()
+
+	case ed25519.PrivateKey:
+		if priv.ECParams, err = asn1.Marshal(oidEd25519); err != nil {
+			return nil, err
+		}
+		if pub.ECPoint, err = asn1.Marshal([]byte(key.Public().(ed25519.PublicKey))); err != nil {
+			return nil, err
+		}
+		priv.KeyType, pub.KeyType = PKCS11KeyTypeECEdwards, PKCS11KeyTypeECEdwards
+		pub.ECParams = priv.ECParams
+		priv.Value = key.Seed()
+
+	default:
+		return nil, errors.New("pkcs12: unsupported private key type for PKCS#11")
+	}
+
+	return objects, nil
+}
+
+// pkcs11ID returns the CKA_ID to use for objects associated with cert.
+func pkcs11ID(cert *x509.Certificate) []byte {
+	if len(cert.SubjectKeyId) != 0 {
+		return cert.SubjectKeyId
+	}
+	var spki struct {
+		Algorithm asn1.RawValue
+		PublicKey asn1.BitString
+	}
+	if _, err := asn1.Unmarshal(cert.RawSubjectPublicKeyInfo, &spki); err != nil {
+		sum := sha1.Sum(cert.RawSubjectPublicKeyInfo)
+		return sum[:]
+	}
+	sum := sha1.Sum(spki.PublicKey.Bytes)
+	return sum[:]
+}
@@ -0,0 +1,105 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"bytes"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"math/big"
+	"testing"
+)
+
+func TestDecodePKCS11ECDSA(t *testing.T) {
+	rootKey, root := newTestCertificate(t, "root", nil, nil)
+	key, leaf := newTestCertificate(t, "token.example.com", root, rootKey)
+	pfxData, err := Encode(rand.Reader, key, leaf, []*x509.Certificate{root}, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	objects, err := DecodePKCS11(pfxData, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	priv, pub := objects.PrivateKey, objects.PublicKey
+	if priv.KeyType != PKCS11KeyTypeEC || pub.KeyType != PKCS11KeyTypeEC {
+		t.Errorf("got key types %#x/%#x, want CKK_EC", priv.KeyType, pub.KeyType)
+	}
+	var curve asn1.ObjectIdentifier
+	if err := unmarshal(priv.ECParams, &curve); err != nil || !curve.Equal(oidNamedCurveP256) {
+		t.Errorf("got EC params %x, want P-256", priv.ECParams)
+	}
+	if new(big.Int).SetBytes(priv.Value).Cmp(key.D) != 0 {
+		t.Error("private value does not match key")
+	}
+	var point []byte
+	if err := unmarshal(pub.ECPoint, &point); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(point, elliptic.Marshal(key.Curve, key.X, key.Y)) {
+		t.Error("EC point does not match key")
+	}
+
+	if len(objects.Certificates) != 2 {
+		t.Fatalf("got %d certificates, want 2", len(objects.Certificates))
+	}
+	certObj := objects.Certificates[0]
+	if !bytes.Equal(certObj.Value, leaf.Raw) || !bytes.Equal(certObj.Subject, leaf.RawSubject) || !bytes.Equal(certObj.Issuer, root.RawSubject) {
+		t.Error("certificate attributes do not match leaf")
+	}
+	if !bytes.Equal(certObj.ID, priv.ID) || !bytes.Equal(pub.ID, priv.ID) || len(priv.ID) == 0 {
+		t.Errorf("IDs do not match: %x %x %x", certObj.ID, pub.ID, priv.ID)
+	}
+	if priv.Label != "token.example.com" {
+		t.Errorf("got label %q", priv.Label)
+	}
+	if !bytes.Equal(objects.Certificates[1].ID, root.SubjectKeyId) {
+		t.Error("CA certificate ID is not its subject key identifier")
+	}
+}
+
+func TestDecodePKCS11RSA(t *testing.T) {
+	p12, _ := base64.StdEncoding.DecodeString(testdata["testing@example.com"])
+	objects, err := DecodePKCS11(p12, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	privateKey, _, err := Decode(p12, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := privateKey.(*rsa.PrivateKey)
+
+	priv := objects.PrivateKey
+	if priv.KeyType != PKCS11KeyTypeRSA {
+		t.Errorf("got key type %#x, want CKK_RSA", priv.KeyType)
+	}
+	for name, test := range map[string]struct {
+		got  []byte
+		want *big.Int
+	}{
+		"modulus":     {priv.Modulus, key.N},
+		"exponent":    {priv.PublicExponent, big.NewInt(int64(key.E))},
+		"private":     {priv.PrivateExponent, key.D},
+		"prime1":      {priv.Prime1, key.Primes[0]},
+		"prime2":      {priv.Prime2, key.Primes[1]},
+		"exponent1":   {priv.Exponent1, key.Precomputed.Dp},
+		"exponent2":   {priv.Exponent2, key.Precomputed.Dq},
+		"coefficient": {priv.Coefficient, key.Precomputed.Qinv},
+	} {
+		if new(big.Int).SetBytes(test.got).Cmp(test.want) != 0 {
+			t.Errorf("%s does not match key", name)
+		}
+	}
+	if !bytes.Equal(objects.PublicKey.Modulus, priv.Modulus) {
+		t.Error("public key modulus does not match")
+	}
+}
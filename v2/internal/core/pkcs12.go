@@ -0,0 +1,1047 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Copyright 2015 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package core implements some of PKCS#12 (also known as P12 or PFX) for
+// both versions of github.com/scholar-ink/go-pkcs12.  Version 2 exposes it
+// through functional options, and version 1 is a shim over version 2.  The
+// Decoder and Encoder of core are those of version 1 before it became the
+// shim, and the options of version 2 configure them.
+//
+// This package is forked from golang.org/x/crypto/pkcs12, which is frozen.
+// The implementation is distilled from https://tools.ietf.org/html/rfc7292
+// and referenced documents.
+package core
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"io"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/scholar-ink/go-pkcs12/v2/internal/der"
+	"github.com/scholar-ink/go-pkcs12/v2/oids"
+)
+
+// DefaultPassword is the string "changeit", a commonly-used password for
+// PKCS#12 files. Due to the weak encryption used by PKCS#12, it is
+// RECOMMENDED that you use DefaultPassword when encoding PKCS#12 files,
+// and protect the PKCS#12 files using other means.
+const DefaultPassword = "changeit"
+
+var (
+	oidDataContentType          = asn1.ObjectIdentifier([]int{1, 2, 840, 113549, 1, 7, 1})
+	oidEncryptedDataContentType = asn1.ObjectIdentifier([]int{1, 2, 840, 113549, 1, 7, 6})
+	oidEnvelopedDataContentType = asn1.ObjectIdentifier([]int{1, 2, 840, 113549, 1, 7, 3})
+
+	oidFriendlyName     = asn1.ObjectIdentifier([]int{1, 2, 840, 113549, 1, 9, 20})
+	oidLocalKeyID       = asn1.ObjectIdentifier([]int{1, 2, 840, 113549, 1, 9, 21})
+	oidMicrosoftCSPName = asn1.ObjectIdentifier([]int{1, 3, 6, 1, 4, 1, 311, 17, 1})
+)
+
+type pfxPdu struct {
+	Version  int
+	AuthSafe contentInfo
+	MacData  macData `asn1:"optional"`
+}
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"tag:0,explicit,optional"`
+}
+
+type encryptedData struct {
+	Version              int
+	EncryptedContentInfo encryptedContentInfo
+	UnprotectedAttrs     asn1.RawValue `asn1:"tag:1,optional"` // CMS version 2
+}
+
+type encryptedContentInfo struct {
+	ContentType                asn1.ObjectIdentifier
+	ContentEncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedContent           []byte `asn1:"tag:0,optional"`
+}
+
+func (i encryptedContentInfo) Algorithm() pkix.AlgorithmIdentifier {
+	return i.ContentEncryptionAlgorithm
+}
+
+func (i encryptedContentInfo) Data() []byte { return i.EncryptedContent }
+
+func (i *encryptedContentInfo) SetData(data []byte) { i.EncryptedContent = data }
+
+type safeBag struct {
+	Id         asn1.ObjectIdentifier
+	Value      asn1.RawValue     `asn1:"tag:0,explicit"`
+	Attributes []pkcs12Attribute `asn1:"set,optional"`
+}
+
+type pkcs12Attribute struct {
+	Id    asn1.ObjectIdentifier
+	Value asn1.RawValue `asn1:"set"`
+}
+
+type encryptedPrivateKeyInfo struct {
+	AlgorithmIdentifier pkix.AlgorithmIdentifier
+	EncryptedData       []byte
+}
+
+func (i encryptedPrivateKeyInfo) Algorithm() pkix.AlgorithmIdentifier {
+	return i.AlgorithmIdentifier
+}
+
+func (i encryptedPrivateKeyInfo) Data() []byte {
+	return i.EncryptedData
+}
+
+func (i *encryptedPrivateKeyInfo) SetData(data []byte) {
+	i.EncryptedData = data
+}
+
+// PEM block types
+const (
+	certificateType = "CERTIFICATE"
+	privateKeyType  = "PRIVATE KEY"
+	crlType         = "X509 CRL"
+)
+
+// unmarshal calls asn1.Unmarshal, but also returns an error if there is any
+// trailing data after unmarshaling.
+func unmarshal(in []byte, out interface{}) error {
+	trailing, err := asn1.Unmarshal(in, out)
+	if err != nil {
+		return err
+	}
+	if len(trailing) != 0 {
+		return errors.New("pkcs12: trailing data found")
+	}
+	return nil
+}
+
+// A Decoder contains options for decoding PKCS#12 files.  The zero value
+// decodes strictly, rejecting anything that does not conform to RFC 7292.
+// Decoders are configured with methods that return a modified copy, so a
+// Decoder can be shared freely once created.
+//
+// A Decoder is never modified after it has been returned by one of those
+// methods, and is safe for concurrent use by multiple goroutines, for
+// instance as a package-level variable of a service.  Callback functions
+// passed to a Decoder, such as the warning function of
+// WithEmptyContainers, are called from the goroutine doing the decoding
+// and must themselves be safe for concurrent use if the Decoder is shared.
+type Decoder struct {
+	// The With methods assign fresh values to these fields, and never
+	// modify values which may be shared with the receiver, such as the
+	// elements of a slice.
+	allowTrailingZeros  bool
+	leafInChain         bool
+	duplicates          DuplicatePolicy
+	annotate            CertificateAnnotator
+	sanitizeAttributes  bool
+	maxAttributeLength  int
+	ignoreKeyBags       bool
+	duplicateKeyIDs     KeyIDPolicy
+	reportKeyBag        func(localKeyID []byte)
+	verifier            *x509.Certificate
+	parser              ASN1Parser
+	allowEmpty          bool
+	warnEmpty           func(warning error)
+	lenientEncrypted    bool
+	warnEncrypted       func(warning error)
+	reportExtension     func(Extension)
+	allowInsecure       bool
+	minIterations       int
+	progress            func(Progress)
+	yieldEvery          int
+	ctx                 context.Context
+	limiter             Limiter
+	externalKDF         KDF
+	laxCertificates     bool
+	allowMissingMAC     bool
+	secp256k1           bool
+	maxDecompressedSize int
+	maxScryptMemory     int
+}
+
+// DefaultDecoder is the Decoder used by the package-level decoding
+// functions.  It decodes strictly.
+var DefaultDecoder = new(Decoder)
+
+// WithTrailingZeroPadding returns a copy of dec which, if allow is true,
+// ignores zero bytes following the SafeBag sequence of a SafeContents, as
+// emitted by some generators.  Trailing data which is not all zeros is
+// still rejected.
+func (dec Decoder) WithTrailingZeroPadding(allow bool) *Decoder {
+	dec.allowTrailingZeros = allow
+	return &dec
+}
+
+// WithLeafInChain returns a copy of dec which, if include is true, returns
+// the leaf certificate from DecodeChainWithCAs as the first element of
+// caCerts as well, for TLS stacks which expect the complete chain in a
+// single slice.
+func (dec Decoder) WithLeafInChain(include bool) *Decoder {
+	dec.leafInChain = include
+	return &dec
+}
+
+// WithAllowInsecure returns a copy of dec which, if allow is true, decodes
+// files protected with algorithms that are too weak to be trusted and are
+// otherwise rejected, such as the PKCS#5 v1.5 schemes used by some
+// pre-standard tools to shroud keys and the RC4 schemes of very old Windows
+// and Netscape exports.  It also lifts the iteration floor of
+// WithMinIterations.  It is intended for recovering data from archived
+// files, not for routine use.
+func (dec Decoder) WithAllowInsecure(allow bool) *Decoder {
+	dec.allowInsecure = allow
+	return &dec
+}
+
+// unmarshalSafeContents unmarshals a SafeContents, applying dec's policy
+// for trailing data.
+func (dec *Decoder) unmarshalSafeContents(data []byte, safeContents *[]safeBag) error {
+	var trailing []byte
+	var err error
+	if dec.parser == StreamParser {
+		trailing, err = streamSafeContents(data, safeContents)
+	} else {
+		trailing, err = asn1.Unmarshal(data, safeContents)
+	}
+	if err != nil {
+		return err
+	}
+	if len(trailing) != 0 && !(dec.allowTrailingZeros && allZeros(trailing)) {
+		return errors.New("pkcs12: trailing data found")
+	}
+	return nil
+}
+
+func allZeros(b []byte) bool {
+	for _, c := range b {
+		if c != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// ToPEM converts all "safe bags" contained in pfxData to PEM blocks using
+// DefaultDecoder.
+// DO NOT USE THIS FUNCTION. ToPEM creates invalid PEM blocks; private keys
+// other than Ed25519, X25519, Ed448 and X448 keys are encoded as raw RSA or
+// EC private keys rather than PKCS#8 despite being labeled "PRIVATE KEY".
+// To decode a PKCS#12 file, use DecodeChain instead, and use the
+// encoding/pem package to convert to PEM if necessary.
+func ToPEM(pfxData []byte, password string) ([]*pem.Block, error) {
+	return DefaultDecoder.ToPEM(pfxData, password)
+}
+
+// ToPEM is like the package-level ToPEM function, but uses the options of
+// dec.  The same warnings apply.
+func (dec *Decoder) ToPEM(pfxData []byte, password string) ([]*pem.Block, error) {
+	encodedPassword, err := bmpString(password)
+	if err != nil {
+		return nil, ErrIncorrectPassword
+	}
+
+	bags, encodedPassword, err := dec.getSafeContents(pfxData, encodedPassword)
+
+	if err != nil {
+		return nil, err
+	}
+
+	blocks := make([]*pem.Block, 0, len(bags))
+	for i, bag := range bags {
+		block, err := dec.convertBag(&bag, encodedPassword)
+		if err != nil {
+			return nil, err
+		}
+		if dec.sanitizeAttributes {
+			for k, v := range block.Headers {
+				block.Headers[k] = SanitizeAttribute(v, dec.maxAttributeLength)
+			}
+		}
+		blocks = append(blocks, block)
+		dec.bagDone(i, len(bags))
+	}
+
+	return blocks, nil
+}
+
+func (dec *Decoder) convertBag(bag *safeBag, password []byte) (*pem.Block, error) {
+	block := &pem.Block{
+		Headers: make(map[string]string),
+	}
+
+	for _, attribute := range bag.Attributes {
+		k, v, err := convertAttribute(&attribute)
+		if err != nil {
+			return nil, err
+		}
+		block.Headers[k] = v
+	}
+
+	switch {
+	case bag.Id.Equal(oidCertBag):
+		block.Type = certificateType
+		certsData, err := decodeCertBag(bag.Value.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		block.Bytes = certsData
+	case bag.Id.Equal(oidCRLBag):
+		block.Type = crlType
+		crlData, err := decodeCRLBag(bag.Value.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		block.Bytes = crlData
+	case bag.Id.Equal(oidPKCS8ShroundedKeyBag), bag.Id.Equal(oidKeyBag):
+		block.Type = privateKeyType
+
+		key, err := dec.decodeKeyBag(bag, password)
+		if err != nil {
+			return nil, err
+		}
+
+		switch key := key.(type) {
+		case *rsa.PrivateKey:
+			block.Bytes = x509.MarshalPKCS1PrivateKey(key)
+		case *ecdsa.PrivateKey:
+			block.Bytes, err = marshalECPrivateKey(key)
+			if err != nil {
+				return nil, err
+			}
+		case ed25519.PrivateKey, *ecdh.PrivateKey, Ed448PrivateKey, X448PrivateKey:
+			// These keys have no raw encoding other than PKCS#8.
+			block.Bytes, err = marshalPKCS8PrivateKey(key, nil)
+			if err != nil {
+				return nil, err
+			}
+		default:
+			return nil, errors.New("found unknown private key type in PKCS#8 wrapping")
+		}
+	default:
+		return nil, errors.New("don't know how to convert a safe bag of type " + oids.Describe(bag.Id))
+	}
+	return block, nil
+}
+
+func convertAttribute(attribute *pkcs12Attribute) (key, value string, err error) {
+	isString := false
+
+	switch {
+	case attribute.Id.Equal(oidFriendlyName):
+		key = "friendlyName"
+		isString = true
+	case attribute.Id.Equal(oidLocalKeyID):
+		key = "localKeyId"
+	case attribute.Id.Equal(oidMicrosoftCSPName):
+		// This key is chosen to match OpenSSL.
+		key = "Microsoft CSP Name"
+		isString = true
+	default:
+		// Attributes unknown to this package, such as the additional
+		// ones emitted by Mozilla NSS, are passed through as hex.
+		key = attribute.Id.String()
+		value = hex.EncodeToString(attribute.Value.Bytes)
+		return key, value, nil
+	}
+
+	attrValue, err := attributeValue(attribute)
+	if err != nil {
+		return "", "", err
+	}
+	if isString {
+		if value, err = decodeBMPString(attrValue.Bytes); err != nil {
+			return "", "", err
+		}
+	} else {
+		id, err := decodeLocalKeyID(attrValue)
+		if err != nil {
+			return "", "", err
+		}
+		value = hex.EncodeToString(id)
+	}
+
+	return key, value, nil
+}
+
+// attributeValue returns the first universal-class element in the SET of
+// values of attribute.  Some CA vendors put proprietary context-specific
+// elements alongside the standard value; these are skipped.
+func attributeValue(attribute *pkcs12Attribute) (value asn1.RawValue, err error) {
+	rest := attribute.Value.Bytes
+	for len(rest) > 0 {
+		if rest, err = asn1.Unmarshal(rest, &value); err != nil {
+			return value, err
+		}
+		if value.Class == asn1.ClassUniversal {
+			return value, nil
+		}
+		if value.Class != asn1.ClassContextSpecific {
+			return value, errors.New("pkcs12: unexpected element in attribute " + oids.Describe(attribute.Id))
+		}
+	}
+	return value, errors.New("pkcs12: attribute " + oids.Describe(attribute.Id) + " has no value")
+}
+
+// Decode extracts a certificate and private key from pfxData using
+// DefaultDecoder. This function assumes that there is only one certificate
+// and only one private key in the pfxData.  Since PKCS#12 files often contain
+// more than one certificate, you probably want to use DecodeChain instead.
+func Decode(pfxData []byte, password string) (privateKey interface{}, certificate *x509.Certificate, err error) {
+	return DefaultDecoder.Decode(pfxData, password)
+}
+
+// Decode is like the package-level Decode function, but uses the options of
+// dec.
+func (dec *Decoder) Decode(pfxData []byte, password string) (privateKey interface{}, certificate *x509.Certificate, err error) {
+	return dec.DecodeChain(pfxData, password)
+}
+
+// DecodeChain extracts a certificate, a CA certificate chain, and private key
+// from pfxData using DefaultDecoder. This function assumes that there is at
+// least one certificate and only one private key in the pfxData.  The first
+// certificate is assumed to be the leaf certificate, and subsequent
+// certificates, if any, are assumed to comprise the CA certificate chain.
+// Use DecodeChainWithCAs to obtain the CA certificates as well.
+//
+// The private key is a *rsa.PrivateKey, *ecdsa.PrivateKey,
+// ed25519.PrivateKey, *mldsa.PrivateKey, Ed448PrivateKey or X448PrivateKey,
+// or an *ecdh.PrivateKey for X25519 key agreement keys.  Encode accepts the
+// same types.  ECDSA keys, and the public keys of certificates, may also be
+// on the brainpoolP256r1, brainpoolP384r1 and brainpoolP512r1 curves of
+// RFC 5639, which crypto/x509 does not support, or on secp256k1 if the
+// Decoder is configured with WithSecp256k1.
+//
+// Unlike the curves of crypto/elliptic, this package's implementations of
+// the Brainpool curves and of secp256k1 are not constant-time: signing with
+// a Brainpool or secp256k1 key returned by DecodeChain, or any other use of
+// its Curve, takes time which depends on the private key.  Such keys are
+// meant to be handed to a constant-time implementation, such as an HSM,
+// rather than used where timing can be observed.
+//
+// Certificates are never re-encoded: the Raw field of each returned
+// certificate is exactly the DER embedded in pfxData, so signatures and
+// fingerprints computed over it match those of the original.
+func DecodeChain(pfxData []byte, password string) (privateKey interface{}, certificate *x509.Certificate, err error) {
+	return DefaultDecoder.DecodeChain(pfxData, password)
+}
+
+// DecodeChain is like the package-level DecodeChain function, but uses the
+// options of dec.
+func (dec *Decoder) DecodeChain(pfxData []byte, password string) (privateKey interface{}, certificate *x509.Certificate, err error) {
+	privateKey, certificate, _, err = dec.DecodeChainWithCAs(pfxData, password)
+	return
+}
+
+// DecodeChainWithCAs is like DecodeChain, but also returns the CA
+// certificate chain in caCerts, in the order in which it appears in
+// pfxData, using DefaultDecoder.  The leaf certificate is not included in
+// caCerts unless the Decoder is configured with WithLeafInChain.
+func DecodeChainWithCAs(pfxData []byte, password string) (privateKey interface{}, certificate *x509.Certificate, caCerts []*x509.Certificate, err error) {
+	return DefaultDecoder.DecodeChainWithCAs(pfxData, password)
+}
+
+// DecodeChainWithCAs is like the package-level DecodeChainWithCAs
+// function, but uses the options of dec.
+func (dec *Decoder) DecodeChainWithCAs(pfxData []byte, password string) (privateKey interface{}, certificate *x509.Certificate, caCerts []*x509.Certificate, err error) {
+	encodedPassword, err := bmpString(password)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	bags, encodedPassword, err := dec.getSafeContents(pfxData, encodedPassword)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if dec.emptyContainer(bags) {
+		return nil, nil, nil, nil
+	}
+
+	var certs []*x509.Certificate
+	var keys []KeyEntry
+	for i, bag := range bags {
+		switch {
+		case bag.Id.Equal(oidCertBag):
+			cert, err := dec.parseCert(bag.Value.Bytes)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			certs = append(certs, cert)
+
+		case bag.Id.Equal(oidPKCS8ShroundedKeyBag), bag.Id.Equal(oidKeyBag):
+			key, err := dec.decodeKeyBag(&bag, encodedPassword)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			keys = append(keys, KeyEntry{PrivateKey: key, LocalKeyID: localKeyID(&bag)})
+		}
+		dec.bagDone(i, len(bags))
+	}
+
+	if keys, err = dec.handleDuplicateKeyIDs(keys); err != nil {
+		return nil, nil, nil, err
+	}
+	if len(keys) > 1 {
+		return nil, nil, nil, errors.New("pkcs12: expected exactly one key bag")
+	}
+	if len(keys) == 1 {
+		privateKey = keys[0].PrivateKey
+	}
+
+	if certs, err = dec.handleDuplicates(certs); err != nil {
+		return nil, nil, nil, err
+	}
+	if len(certs) == 0 {
+		return nil, nil, nil, errors.New("pkcs12: certificate missing")
+	}
+	if privateKey == nil {
+		return nil, nil, nil, errors.New("pkcs12: private key missing")
+	}
+
+	certificate = certs[0]
+	if dec.leafInChain {
+		caCerts = certs
+	} else {
+		caCerts = certs[1:]
+	}
+	return
+}
+
+func (dec *Decoder) getSafeContents(p12Data, password []byte) (bags []safeBag, updatedPassword []byte, err error) {
+	pfx := new(pfxPdu)
+	if err := dec.unmarshalPFX(p12Data, pfx); err != nil {
+		return nil, nil, errors.New("pkcs12: error reading P12 data: " + err.Error())
+	}
+
+	if pfx.Version != 3 {
+		return nil, nil, NotImplementedError("can only decode v3 PFX PDU's")
+	}
+
+	content, password, _, err := dec.verifyIntegrity(pfx, password)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	authenticatedSafe, err := dec.unmarshalAuthenticatedSafe(content)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// RFC 7292 permits any number of SafeContents.  Most producers emit
+	// two, but Mozilla NSS (pk12util) sometimes adds an empty one.
+	for i, ci := range authenticatedSafe {
+		if dec.reportExtension != nil && isExtension(ci.ContentType) {
+			dec.reportExtension(newExtension(i, ci))
+			continue
+		}
+		safeContents, err := dec.getSafeContentsOf(ci, password)
+		if err != nil {
+			return nil, nil, err
+		}
+		bags = append(bags, safeContents...)
+	}
+	if err := dec.decompressBags(bags); err != nil {
+		return nil, nil, err
+	}
+
+	return bags, password, nil
+}
+
+// getSafeContentsOf returns the SafeBags of the SafeContents in ci,
+// decrypting it with password if needed.
+func (dec *Decoder) getSafeContentsOf(ci contentInfo, password []byte) (bags []safeBag, err error) {
+	var data []byte
+
+	switch {
+	case ci.ContentType.Equal(oidDataContentType):
+		if err := unmarshal(ci.Content.Bytes, &data); err != nil {
+			return nil, err
+		}
+	case ci.ContentType.Equal(oidEncryptedDataContentType):
+		var encryptedData encryptedData
+		if err := unmarshal(ci.Content.Bytes, &encryptedData); err != nil {
+			return nil, err
+		}
+		if err := dec.checkEncryptedData(&encryptedData); err != nil {
+			return nil, err
+		}
+		if dec.allowEmpty && len(encryptedData.EncryptedContentInfo.EncryptedContent) == 0 {
+			return nil, nil
+		}
+		if err := dec.checkInsecure(encryptedData.EncryptedContentInfo.ContentEncryptionAlgorithm.Algorithm); err != nil {
+			return nil, err
+		}
+		if err := dec.checkPBEIterations("content encryption", encryptedData.EncryptedContentInfo.ContentEncryptionAlgorithm); err != nil {
+			return nil, err
+		}
+		if err := dec.checkScrypt("content encryption", encryptedData.EncryptedContentInfo.ContentEncryptionAlgorithm); err != nil {
+			return nil, err
+		}
+		if data, err = pbDecrypt(encryptedData.EncryptedContentInfo, password, dec.monitor()); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, NotImplementedError("only data and encryptedData content types are supported in authenticated safe")
+	}
+
+	if len(data) == 0 {
+		return nil, nil
+	}
+
+	if err := dec.unmarshalSafeContents(data, &bags); err != nil {
+		return nil, err
+	}
+	return bags, nil
+}
+
+// An Encoder contains methods for encoding PKCS#12 files.  This package
+// defines several different Encoders with different parameters.
+//
+// Like a Decoder, an Encoder is configured with methods that return a
+// modified copy, is never modified afterwards, and is safe for concurrent
+// use by multiple goroutines.  The rand argument of its methods must be
+// safe for concurrent use if it is shared; crypto/rand.Reader is, and is
+// used when rand is nil.
+type Encoder struct {
+	// As in Decoder, the With methods never modify values which may be
+	// shared with the receiver.
+	macAlgorithm         asn1.ObjectIdentifier
+	macHash              crypto.Hash // for the error if macAlgorithm is nil
+	certAlgorithm        asn1.ObjectIdentifier
+	keyAlgorithm         asn1.ObjectIdentifier
+	macIterations        int
+	encryptionIterations int
+	scrypt               *scryptParams
+	kdf                  asn1.ObjectIdentifier
+	aesKeySize           int
+	camelliaKeySize      int
+	chacha20Poly1305     bool
+	pbeScheme            asn1.ObjectIdentifier
+	saltLength           int
+	progress             func(Progress)
+	yieldEvery           int
+	ctx                  context.Context
+	fixedSeed            []byte
+	autoFriendlyName     bool
+	maxSize              int
+	opensslStructure     bool
+	externalKDF          KDF
+	minimalProfile       bool
+	compressionThreshold int
+}
+
+// DefaultEncoder encrypts both the certificates and the private key with
+// SHA-1 and 3-key Triple DES, and authenticates the file with HMAC-SHA-1.
+// It is the Encoder used by Encode.
+//
+// The defaults of DefaultEncoder will change in the next major release of
+// this package; use WithCompatibilityLevel to opt into them early.
+var DefaultEncoder = &Encoder{
+	macAlgorithm:         oidSHA1,
+	certAlgorithm:        oidPBEWithSHAAnd3KeyTripleDESCBC,
+	keyAlgorithm:         oidPBEWithSHAAnd3KeyTripleDESCBC,
+	macIterations:        1,
+	encryptionIterations: 2048,
+}
+
+// Legacy emulates the behavior of OpenSSL's PKCS12_create and of earlier
+// versions of this package: the certificates are encrypted with 40-bit RC2,
+// which is trivially breakable, and the private key with 3-key Triple DES.
+// Only use Legacy when the output must be read by software which cannot
+// decrypt anything else.  Legacy refuses to encode after
+// DisableLegacyEncoding has been called.
+var Legacy = &Encoder{
+	macAlgorithm:         oidSHA1,
+	certAlgorithm:        oidPBEWithSHAAnd40BitRC2CBC,
+	keyAlgorithm:         oidPBEWithSHAAnd3KeyTripleDESCBC,
+	macIterations:        1,
+	encryptionIterations: 2048,
+}
+
+// OpenSSL111 reproduces the structure of the files written by the
+// "openssl pkcs12 -export" command of OpenSSL 1.1.1, and of OpenSSL 3 with
+// the -legacy flag: the algorithms of Legacy with 2048 iterations for the
+// MAC as well as the encryption, an explicit NULL parameter in the MAC
+// digest algorithm, and no empty attribute sets on the CA certificate bags.
+// Apart from the salts and the ciphertexts which depend on them, its output
+// is identical to OpenSSL's for the same key, certificates and
+// friendlyName, so the two can be diffed during interoperability
+// certification.  Like Legacy, it refuses to encode after
+// DisableLegacyEncoding has been called.
+var OpenSSL111 = &Encoder{
+	macAlgorithm:         oidSHA1,
+	certAlgorithm:        oidPBEWithSHAAnd40BitRC2CBC,
+	keyAlgorithm:         oidPBEWithSHAAnd3KeyTripleDESCBC,
+	macIterations:        2048,
+	encryptionIterations: 2048,
+	opensslStructure:     true,
+}
+
+// Modern encrypts both the certificates and the private key with PBES2,
+// using PBKDF2 with HMAC-SHA-256 and AES-256-CBC, and authenticates the file
+// with HMAC-SHA-256, as OpenSSL 3 does by default.  Its output is read by
+// OpenSSL 1.1.1 and later, Windows 10 1709 and later and JDK 8u301 and
+// later, but not by older software; use ProbeCompatibility to check.
+var Modern = &Encoder{
+	macAlgorithm:         oidSHA256,
+	certAlgorithm:        oidPBES2,
+	keyAlgorithm:         oidPBES2,
+	macIterations:        2048,
+	encryptionIterations: 2048,
+}
+
+// WithCompatibilityLevel returns a copy of enc which uses the defaults
+// that this package considers appropriate as of the given year, allowing
+// consumers to test their readers against upcoming default changes before
+// they take effect.  The levels are:
+//
+//   - before 2024: HMAC-SHA-1 MAC, as produced by DefaultEncoder today.
+//   - 2024 and later: HMAC-SHA-256 MAC, the default of OpenSSL 3.
+//
+// Only the parameters named above are affected; the encryption algorithms
+// of enc are retained.
+func (enc Encoder) WithCompatibilityLevel(year int) *Encoder {
+	if year >= 2024 {
+		enc.macAlgorithm = oidSHA256
+	} else {
+		enc.macAlgorithm = oidSHA1
+	}
+	return &enc
+}
+
+var legacyEncodingDisabled atomic.Bool
+
+// DisableLegacyEncoding prevents every Encoder, including Legacy, from
+// producing output protected with weak algorithms such as 40-bit RC2.
+// Subsequent attempts to do so fail with ErrLegacyEncodingDisabled.  It is
+// intended to be called during program initialization by applications which
+// must guarantee that no code path produces weak output, and cannot be
+// undone.
+func DisableLegacyEncoding() {
+	legacyEncodingDisabled.Store(true)
+}
+
+// isLegacy reports whether enc uses an algorithm that is disallowed by
+// DisableLegacyEncoding.
+func (enc *Encoder) isLegacy() bool {
+	return isWeakEncryptionAlgorithm(enc.certAlgorithm) || isWeakEncryptionAlgorithm(enc.keyAlgorithm)
+}
+
+// Encode produces pfxData containing one private key (privateKey), an
+// end-entity certificate (certificate), and any number of CA certificates
+// (caCerts) using DefaultEncoder.
+//
+// The private key is encrypted with the provided password, but due to the
+// weak encryption primitives used by PKCS#12, it is RECOMMENDED that you
+// specify a hard-coded password (such as pkcs12.DefaultPassword) and protect
+// the resulting pfxData using other means.
+//
+// The rand argument is used to provide entropy for the encryption, and
+// can be set to rand.Reader from the crypto/rand package, which is used if
+// rand is nil.
+//
+// caCerts may be nil or empty, but neither privateKey, certificate nor any
+// element of caCerts may be nil.
+//
+// Encode creates two SafeContents: one that's encrypted and contains the
+// certificates, and another that is unencrypted and contains the private key
+// shrouded with 3DES.  The private key bag and the end-entity certificate bag
+// have the LocalKeyId attribute set to the SHA-1 fingerprint of the
+// end-entity certificate.  Use Legacy.Encode if the certificates must be
+// encrypted with 40-bit RC2, as earlier versions of Encode did.
+//
+// Certificates are embedded exactly as their Raw field, which must hold a
+// valid DER certificate; they are never re-encoded.
+func Encode(rand io.Reader, privateKey interface{}, certificate *x509.Certificate, caCerts []*x509.Certificate, password string) (pfxData []byte, err error) {
+	return DefaultEncoder.Encode(rand, privateKey, certificate, caCerts, password)
+}
+
+// Encode produces pfxData containing one private key (privateKey), an
+// end-entity certificate (certificate), and any number of CA certificates
+// (caCerts), using the algorithms of enc.  See the package-level Encode
+// function for details.
+func (enc *Encoder) Encode(rand io.Reader, privateKey interface{}, certificate *x509.Certificate, caCerts []*x509.Certificate, password string) (pfxData []byte, err error) {
+	return enc.encode(rand, privateKey, certificate, caCerts, password, nil, nil)
+}
+
+// encode implements Encode.  identityAttrs are added to both the private key
+// bag and the end-entity certificate bag, following the LocalKeyId, and
+// keyAttrs to the private key bag only.
+func (enc *Encoder) encode(rand io.Reader, privateKey interface{}, certificate *x509.Certificate, caCerts []*x509.Certificate, password string, identityAttrs, keyAttrs []pkcs12Attribute) (pfxData []byte, err error) {
+	if enc.isLegacy() && legacyEncodingDisabled.Load() {
+		return nil, ErrLegacyEncodingDisabled
+	}
+	rand = enc.entropy(rand)
+
+	encodedPassword, err := bmpString(password)
+	if err != nil {
+		return nil, err
+	}
+
+	certBag, keyBag, err := enc.identityBags(rand, privateKey, certificate, encodedPassword, identityAttrs, keyAttrs)
+	if err != nil {
+		return nil, err
+	}
+	return enc.assemble(rand, []safeBag{certBag}, caCerts, []safeBag{keyBag}, encodedPassword)
+}
+
+// identityBags returns the end-entity certificate bag and the shrouded key
+// bag of an identity.  identityAttrs are added to both, following the
+// LocalKeyId, and keyAttrs to the key bag only.
+func (enc *Encoder) identityBags(rand io.Reader, privateKey interface{}, certificate *x509.Certificate, encodedPassword []byte, identityAttrs, keyAttrs []pkcs12Attribute) (certBag, keyBag safeBag, err error) {
+	if certificate == nil {
+		return certBag, keyBag, errors.New("pkcs12: certificate is nil")
+	}
+	if privateKey == nil {
+		return certBag, keyBag, errors.New("pkcs12: private key is nil")
+	}
+	if privateKey, err = decryptPEMKey(privateKey); err != nil {
+		return certBag, keyBag, err
+	}
+	if err := checkKeyMatchesCertificate(privateKey, certificate); err != nil {
+		return certBag, keyBag, err
+	}
+
+	var certFingerprint = sha1.Sum(certificate.Raw)
+	var localKeyIdAttr pkcs12Attribute
+	localKeyIdAttr.Id = oidLocalKeyID
+	localKeyIdAttr.Value.Class = 0
+	localKeyIdAttr.Value.Tag = 17
+	localKeyIdAttr.Value.IsCompound = true
+	if localKeyIdAttr.Value.Bytes, err = asn1.Marshal(certFingerprint[:]); err != nil {
+		return certBag, keyBag, err
+	}
+
+	identityAttrs = append([]pkcs12Attribute{localKeyIdAttr}, identityAttrs...)
+	if identityAttrs, err = enc.addFriendlyName(identityAttrs, certificate); err != nil {
+		return certBag, keyBag, err
+	}
+
+	leafBag, err := makeCertBag(certificate.Raw, identityAttrs)
+	if err != nil {
+		return certBag, keyBag, err
+	}
+
+	keyBag.Id = oidPKCS8ShroundedKeyBag
+	keyBag.Value.Class = 2
+	keyBag.Value.Tag = 0
+	keyBag.Value.IsCompound = true
+	if enc.minimalProfile {
+		keyBag.Id = oidKeyBag
+		if keyBag.Value.Bytes, err = marshalPKCS8PrivateKey(privateKey, certificate); err != nil {
+			return certBag, keyBag, err
+		}
+	} else if keyBag.Value.Bytes, err = encodePkcs8ShroudedKeyBag(rand, privateKey, certificate, enc.keyAlgorithm, encodedPassword, enc.pbeSettings(), enc.monitor()); err != nil {
+		return certBag, keyBag, err
+	}
+	keyBag.Attributes = append(keyBag.Attributes, identityAttrs...)
+	keyBag.Attributes = append(keyBag.Attributes, keyAttrs...)
+	return *leafBag, keyBag, nil
+}
+
+// assemble returns a PFX PDU whose authenticated safe has two SafeContents.
+// The first is encrypted and contains leafBags followed by the bags of
+// caCerts; the second is unencrypted and contains the shrouded keyBags.
+// For MinimalRouter, it has a single unencrypted SafeContents containing
+// keyBags followed by the certificate bags.
+func (enc *Encoder) assemble(rand io.Reader, leafBags []safeBag, caCerts []*x509.Certificate, keyBags []safeBag, encodedPassword []byte) (pfxData []byte, err error) {
+	certBags := make([]safeBag, 0, len(leafBags)+len(caCerts))
+	certBags = append(certBags, leafBags...)
+	caAttrs := []pkcs12Attribute{}
+	if enc.opensslStructure {
+		caAttrs = nil
+	}
+	for i, cert := range caCerts {
+		if cert == nil {
+			return nil, errors.New("pkcs12: CA certificate " + strconv.Itoa(i) + " is nil")
+		}
+		certBag, err := makeCertBag(cert.Raw, caAttrs)
+		if err != nil {
+			return nil, err
+		}
+		certBags = append(certBags, *certBag)
+	}
+
+	if enc.minimalProfile {
+		bags := append(append([]safeBag{}, keyBags...), certBags...)
+		contents, err := makeSafeContents(rand, bags, nil, nil, pbeSettings{}, nil)
+		if err != nil {
+			return nil, err
+		}
+		return enc.makePFX(rand, []contentInfo{contents}, encodedPassword, bags)
+	}
+
+	var authenticatedSafe [2]contentInfo
+	if authenticatedSafe[0], err = makeSafeContents(rand, certBags, enc.certAlgorithm, encodedPassword, enc.pbeSettings(), enc.monitor()); err != nil {
+		return nil, err
+	}
+	if authenticatedSafe[1], err = makeSafeContents(rand, keyBags, nil, nil, pbeSettings{}, nil); err != nil {
+		return nil, err
+	}
+
+	return enc.makePFX(rand, authenticatedSafe[:], encodedPassword, append(certBags, keyBags...))
+}
+
+// makePFX returns a PFX PDU containing authenticatedSafe, with a MAC computed
+// according to enc, or none for MinimalRouter.  bags are the contents of
+// authenticatedSafe, which are described in the error if the PDU exceeds
+// the size limit of enc.
+func (enc *Encoder) makePFX(rand io.Reader, authenticatedSafe []contentInfo, encodedPassword []byte, bags []safeBag) (pfxData []byte, err error) {
+	var pfx pfxPdu
+	pfx.Version = 3
+
+	var authenticatedSafeBytes []byte
+	if authenticatedSafeBytes, err = asn1.Marshal(authenticatedSafe); err != nil {
+		return nil, err
+	}
+
+	if err = enc.checkUnprotectedPassword(encodedPassword); err != nil {
+		return nil, err
+	}
+	if !enc.minimalProfile {
+		// compute the MAC
+		if enc.macAlgorithm == nil {
+			return nil, NotImplementedError("MAC digest " + enc.macHash.String() + " is not supported")
+		}
+		pfx.MacData.Mac.Algorithm.Algorithm = enc.macAlgorithm
+		if enc.opensslStructure {
+			pfx.MacData.Mac.Algorithm.Parameters = asn1.NullRawValue
+		}
+		macSettings := enc.pbeSettings()
+		pfx.MacData.MacSalt = make([]byte, macSettings.saltLen(8))
+		if _, err = rand.Read(pfx.MacData.MacSalt); err != nil {
+			return nil, err
+		}
+		pfx.MacData.Iterations = enc.macIterations
+		if err = computeMac(&pfx.MacData, authenticatedSafeBytes, encodedPassword, enc.monitor()); err != nil {
+			return nil, err
+		}
+	}
+
+	pfx.AuthSafe.ContentType = oidDataContentType
+	pfx.AuthSafe.Content.Class = 2
+	pfx.AuthSafe.Content.Tag = 0
+	pfx.AuthSafe.Content.IsCompound = true
+	if pfx.AuthSafe.Content.Bytes, err = asn1.Marshal(authenticatedSafeBytes); err != nil {
+		return nil, err
+	}
+
+	if pfxData, err = asn1.Marshal(pfx); err != nil {
+		return nil, errors.New("pkcs12: error writing P12 data: " + err.Error())
+	}
+	if err = enc.checkSize(pfxData, bags); err != nil {
+		return nil, err
+	}
+	return
+}
+
+// makeFriendlyNameAttribute returns a friendlyName attribute (RFC 2985,
+// section 5.5.1) with the given value.
+func makeFriendlyNameAttribute(name string) (attr pkcs12Attribute, err error) {
+	return makeBMPStringAttribute(oidFriendlyName, name)
+}
+
+// makeBMPStringAttribute returns an attribute of type id whose single value
+// is the BMPString value.
+func makeBMPStringAttribute(id asn1.ObjectIdentifier, value string) (attr pkcs12Attribute, err error) {
+	encodedName, err := bmpString(value)
+	if err != nil {
+		return attr, err
+	}
+	attr.Id = id
+	attr.Value.Class = 0
+	attr.Value.Tag = 17
+	attr.Value.IsCompound = true
+	// bmpString adds a terminator, which BMPString values do not have.
+	attr.Value.Bytes, err = asn1.Marshal(asn1.RawValue{Class: 0, Tag: asn1.TagBMPString, Bytes: encodedName[:len(encodedName)-2]})
+	return attr, err
+}
+
+func makeCertBag(certBytes []byte, attributes []pkcs12Attribute) (certBag *safeBag, err error) {
+	certBag = new(safeBag)
+	certBag.Id = oidCertBag
+	certBag.Value.Class = 2
+	certBag.Value.Tag = 0
+	certBag.Value.IsCompound = true
+	if certBag.Value.Bytes, err = encodeCertBag(certBytes); err != nil {
+		return nil, err
+	}
+	certBag.Attributes = attributes
+	return
+}
+
+// marshalSafeContents returns the DER encoding of bags as a SafeContents.
+// Each bag is marshaled on its own and copied once into a buffer of the
+// final size, which keeps the cost linear in the number of bags for trust
+// stores with many thousands of certificates.
+func marshalSafeContents(bags []safeBag) ([]byte, error) {
+	encoded := make([][]byte, len(bags))
+	length := 0
+	for i := range bags {
+		var err error
+		if encoded[i], err = asn1.Marshal(bags[i]); err != nil {
+			return nil, err
+		}
+		length += len(encoded[i])
+	}
+	data := der.AppendHeader(make([]byte, 0, der.HeaderLen(length)+length), der.Sequence, length)
+	for _, bag := range encoded {
+		data = append(data, bag...)
+	}
+	return data, nil
+}
+
+func makeSafeContents(rand io.Reader, bags []safeBag, algoID asn1.ObjectIdentifier, password []byte, settings pbeSettings, m *kdfMonitor) (ci contentInfo, err error) {
+	var data []byte
+	if data, err = marshalSafeContents(bags); err != nil {
+		return
+	}
+
+	if password == nil {
+		ci.ContentType = oidDataContentType
+		ci.Content.Class = 2
+		ci.Content.Tag = 0
+		ci.Content.IsCompound = true
+		if ci.Content.Bytes, err = asn1.Marshal(data); err != nil {
+			return
+		}
+	} else {
+		var algo pkix.AlgorithmIdentifier
+		if algo, err = newPBEAlgorithm(rand, algoID, settings); err != nil {
+			return
+		}
+
+		var encryptedData encryptedData
+		encryptedData.Version = 0
+		encryptedData.EncryptedContentInfo.ContentType = oidDataContentType
+		encryptedData.EncryptedContentInfo.ContentEncryptionAlgorithm = algo
+		if err = pbEncrypt(&encryptedData.EncryptedContentInfo, data, password, m); err != nil {
+			return
+		}
+
+		ci.ContentType = oidEncryptedDataContentType
+		ci.Content.Class = 2
+		ci.Content.Tag = 0
+		ci.Content.IsCompound = true
+		if ci.Content.Bytes, err = asn1.Marshal(encryptedData); err != nil {
+			return
+		}
+	}
+	return
+}
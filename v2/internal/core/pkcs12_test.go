@@ -0,0 +1,890 @@
+// Copyright 2015 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func TestPfx(t *testing.T) {
+	for commonName, base64P12 := range testdata {
+		p12, _ := base64.StdEncoding.DecodeString(base64P12)
+
+		priv, cert, err := Decode(p12, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := priv.(*rsa.PrivateKey).Validate(); err != nil {
+			t.Errorf("error while validating private key: %v", err)
+		}
+
+		if cert.Subject.CommonName != commonName {
+			t.Errorf("expected common name to be %q, but found %q", commonName, cert.Subject.CommonName)
+		}
+	}
+}
+
+func TestPEM(t *testing.T) {
+	for commonName, base64P12 := range testdata {
+		p12, _ := base64.StdEncoding.DecodeString(base64P12)
+
+		blocks, err := ToPEM(p12, "")
+		if err != nil {
+			t.Fatalf("error while converting to PEM: %s", err)
+		}
+
+		var pemData []byte
+		for _, b := range blocks {
+			pemData = append(pemData, pem.EncodeToMemory(b)...)
+		}
+
+		cert, err := tls.X509KeyPair(pemData, pemData)
+		if err != nil {
+			t.Errorf("err while converting to key pair: %v", err)
+		}
+		config := tls.Config{
+			Certificates: []tls.Certificate{cert},
+		}
+		config.BuildNameToCertificate()
+
+		if _, exists := config.NameToCertificate[commonName]; !exists {
+			t.Errorf("did not find our cert in PEM?: %v", config.NameToCertificate)
+		}
+	}
+}
+
+func TestEncoders(t *testing.T) {
+	key, cert := newTestCertificate(t, "encoder.example.com", nil, nil)
+
+	for name, test := range map[string]struct {
+		enc      *Encoder
+		certAlgo asn1.ObjectIdentifier
+	}{
+		"DefaultEncoder": {DefaultEncoder, oidPBEWithSHAAnd3KeyTripleDESCBC},
+		"Legacy":         {Legacy, oidPBEWithSHAAnd40BitRC2CBC},
+	} {
+		pfxData, err := test.enc.Encode(rand.Reader, key, cert, nil, "password")
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if algo := certSafeContentsAlgorithm(t, pfxData); !algo.Equal(test.certAlgo) {
+			t.Errorf("%s: certificates encrypted with %v, want %v", name, algo, test.certAlgo)
+		}
+
+		decodedKey, decodedCert, err := Decode(pfxData, "password")
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if !decodedKey.(*ecdsa.PrivateKey).Equal(key) {
+			t.Errorf("%s: decoded key does not match", name)
+		}
+		if !decodedCert.Equal(cert) {
+			t.Errorf("%s: decoded certificate does not match", name)
+		}
+	}
+}
+
+func TestCompatibilityLevel(t *testing.T) {
+	key, cert := newTestCertificate(t, "compat.example.com", nil, nil)
+
+	for _, test := range []struct {
+		year    int
+		macAlgo asn1.ObjectIdentifier
+	}{
+		{2019, oidSHA1},
+		{2024, oidSHA256},
+		{2030, oidSHA256},
+	} {
+		pfxData, err := DefaultEncoder.WithCompatibilityLevel(test.year).Encode(rand.Reader, key, cert, nil, "password")
+		if err != nil {
+			t.Fatalf("%d: %v", test.year, err)
+		}
+		var pfx pfxPdu
+		if err := unmarshal(pfxData, &pfx); err != nil {
+			t.Fatal(err)
+		}
+		if algo := pfx.MacData.Mac.Algorithm.Algorithm; !algo.Equal(test.macAlgo) {
+			t.Errorf("%d: got MAC algorithm %v, want %v", test.year, algo, test.macAlgo)
+		}
+		if _, _, err := Decode(pfxData, "password"); err != nil {
+			t.Errorf("%d: %v", test.year, err)
+		}
+	}
+
+	if !DefaultEncoder.macAlgorithm.Equal(oidSHA1) {
+		t.Error("WithCompatibilityLevel modified DefaultEncoder")
+	}
+}
+
+func TestSupplementaryPlanePassword(t *testing.T) {
+	key, cert := newTestCertificate(t, "emoji.example.com", nil, nil)
+	const password = "p\U0001f512ssw\u00f6rd"
+
+	pfxData, err := Encode(rand.Reader, key, cert, nil, password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := Decode(pfxData, password); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := Decode(pfxData, "p\ufffdssw\u00f6rd"); err != ErrIncorrectPassword {
+		t.Errorf("got error %v, want ErrIncorrectPassword", err)
+	}
+}
+
+func TestDisableLegacyEncoding(t *testing.T) {
+	defer legacyEncodingDisabled.Store(false)
+
+	key, cert := newTestCertificate(t, "legacy.example.com", nil, nil)
+	DisableLegacyEncoding()
+
+	if _, err := Legacy.Encode(rand.Reader, key, cert, nil, "password"); err != ErrLegacyEncodingDisabled {
+		t.Errorf("Legacy.Encode: got error %v, want ErrLegacyEncodingDisabled", err)
+	}
+	if _, err := Encode(rand.Reader, key, cert, nil, "password"); err != nil {
+		t.Errorf("Encode: %v", err)
+	}
+}
+
+// certSafeContentsAlgorithm returns the encryption algorithm of the first
+// (encrypted) SafeContents in pfxData.
+func certSafeContentsAlgorithm(t *testing.T, pfxData []byte) asn1.ObjectIdentifier {
+	var pfx pfxPdu
+	if err := unmarshal(pfxData, &pfx); err != nil {
+		t.Fatal(err)
+	}
+	var content []byte
+	if err := unmarshal(pfx.AuthSafe.Content.Bytes, &content); err != nil {
+		t.Fatal(err)
+	}
+	var authenticatedSafe []contentInfo
+	if err := unmarshal(content, &authenticatedSafe); err != nil {
+		t.Fatal(err)
+	}
+	var ed encryptedData
+	if err := unmarshal(authenticatedSafe[0].Content.Bytes, &ed); err != nil {
+		t.Fatal(err)
+	}
+	return ed.EncryptedContentInfo.ContentEncryptionAlgorithm.Algorithm
+}
+
+func TestDecodeChainLeafInChain(t *testing.T) {
+	rootKey, root := newTestCertificate(t, "root", nil, nil)
+	key, leaf := newTestCertificate(t, "leaf.example.com", root, rootKey)
+	pfxData, err := Encode(rand.Reader, key, leaf, []*x509.Certificate{root}, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, certificate, caCerts, err := DecodeChainWithCAs(pfxData, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !certificate.Equal(leaf) || len(caCerts) != 1 || !caCerts[0].Equal(root) {
+		t.Errorf("DecodeChainWithCAs: unexpected certificates %v, %v", certificate, caCerts)
+	}
+
+	_, certificate, caCerts, err = DefaultDecoder.WithLeafInChain(true).DecodeChainWithCAs(pfxData, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !certificate.Equal(leaf) || len(caCerts) != 2 || !caCerts[0].Equal(leaf) || !caCerts[1].Equal(root) {
+		t.Errorf("WithLeafInChain: unexpected certificates %v, %v", certificate, caCerts)
+	}
+}
+
+func TestTrailingZeroPadding(t *testing.T) {
+	key, cert := newTestCertificate(t, "padding.example.com", nil, nil)
+	pfxData, err := Encode(rand.Reader, key, cert, nil, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	padded := rewriteAuthenticatedSafe(t, pfxData, "password", func(authenticatedSafe []contentInfo) []contentInfo {
+		setSafeContentsData(t, &authenticatedSafe[1], append(safeContentsData(t, authenticatedSafe[1]), 0, 0, 0, 0))
+		return authenticatedSafe
+	})
+	if _, _, err := Decode(padded, "password"); err == nil {
+		t.Error("DefaultDecoder accepted trailing zeros")
+	}
+	if _, _, err := DefaultDecoder.WithTrailingZeroPadding(true).Decode(padded, "password"); err != nil {
+		t.Errorf("tolerant decoder rejected trailing zeros: %v", err)
+	}
+
+	garbage := rewriteAuthenticatedSafe(t, pfxData, "password", func(authenticatedSafe []contentInfo) []contentInfo {
+		setSafeContentsData(t, &authenticatedSafe[1], append(safeContentsData(t, authenticatedSafe[1]), 0, 1))
+		return authenticatedSafe
+	})
+	if _, _, err := DefaultDecoder.WithTrailingZeroPadding(true).Decode(garbage, "password"); err == nil {
+		t.Error("tolerant decoder accepted non-zero trailing data")
+	}
+}
+
+func TestNSSQuirks(t *testing.T) {
+	rootKey, root := newTestCertificate(t, "NSS Root", nil, nil)
+	key, leaf := newTestCertificate(t, "nss.example.com", root, rootKey)
+	pfxData, err := Encode(rand.Reader, key, leaf, []*x509.Certificate{root}, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// pk12util puts the key first, may emit empty SafeContents, and adds
+	// attributes which this package does not interpret.
+	unknownAttr := pkcs12Attribute{
+		Id:    asn1.ObjectIdentifier{2, 16, 840, 1, 113730, 1, 99},
+		Value: asn1.RawValue{Class: 0, Tag: 17, IsCompound: true, Bytes: []byte{0x05, 0x00}},
+	}
+	quirky := rewriteAuthenticatedSafe(t, pfxData, "password", func(authenticatedSafe []contentInfo) []contentInfo {
+		var keyBags []safeBag
+		if err := unmarshal(safeContentsData(t, authenticatedSafe[1]), &keyBags); err != nil {
+			t.Fatal(err)
+		}
+		keyBags[0].Attributes = append(keyBags[0].Attributes, unknownAttr)
+		data, err := asn1.Marshal(keyBags)
+		if err != nil {
+			t.Fatal(err)
+		}
+		setSafeContentsData(t, &authenticatedSafe[1], data)
+
+		var empty, emptySequence contentInfo
+		empty.ContentType = oidDataContentType
+		setSafeContentsData(t, &empty, nil)
+		emptySequence.ContentType = oidDataContentType
+		setSafeContentsData(t, &emptySequence, []byte{0x30, 0x00})
+		return []contentInfo{authenticatedSafe[1], empty, authenticatedSafe[0], emptySequence}
+	})
+
+	decodedKey, certificate, caCerts, err := DecodeChainWithCAs(quirky, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !certificate.Equal(leaf) || len(caCerts) != 1 || !caCerts[0].Equal(root) {
+		t.Errorf("unexpected certificates %v, %v", certificate, caCerts)
+	}
+
+	blocks, err := ToPEM(quirky, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := blocks[0].Headers[unknownAttr.Id.String()]; got != "0500" {
+		t.Errorf("unknown attribute: got %q, want \"0500\"", got)
+	}
+
+	roundTripped, err := Encode(rand.Reader, decodedKey, certificate, caCerts, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := DecodeChain(roundTripped, "password"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestVendorAttributeTags(t *testing.T) {
+	key, leaf := newTestCertificate(t, "vendor.example.com", nil, nil)
+	pfxData, err := Encode(rand.Reader, key, leaf, nil, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Proprietary context-specific elements alongside the standard values
+	// in the SETs of localKeyId and friendlyName.
+	vendorTag := []byte{0xa0, 0x03, 0x02, 0x01, 0x07}
+	friendlyName, err := makeFriendlyNameAttribute("vendor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	friendlyName.Value.Bytes = append(append([]byte{}, vendorTag...), friendlyName.Value.Bytes...)
+	quirky := rewriteAuthenticatedSafe(t, pfxData, "password", func(authenticatedSafe []contentInfo) []contentInfo {
+		var keyBags []safeBag
+		if err := unmarshal(safeContentsData(t, authenticatedSafe[1]), &keyBags); err != nil {
+			t.Fatal(err)
+		}
+		keyBags[0].Attributes[0].Value.Bytes = append(keyBags[0].Attributes[0].Value.Bytes, vendorTag...)
+		keyBags[0].Attributes = append(keyBags[0].Attributes, friendlyName)
+		data, err := asn1.Marshal(keyBags)
+		if err != nil {
+			t.Fatal(err)
+		}
+		setSafeContentsData(t, &authenticatedSafe[1], data)
+		return authenticatedSafe
+	})
+
+	blocks, err := ToPEM(quirky, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	certBlock, keyBlock := blocks[0], blocks[1]
+	if keyBlock.Type != privateKeyType {
+		certBlock, keyBlock = keyBlock, certBlock
+	}
+	if got, want := keyBlock.Headers["localKeyId"], certBlock.Headers["localKeyId"]; got != want {
+		t.Errorf("localKeyId: got %q, want %q", got, want)
+	}
+	if got := keyBlock.Headers["friendlyName"]; got != "vendor" {
+		t.Errorf("friendlyName: got %q, want \"vendor\"", got)
+	}
+}
+
+func TestEncodeVerbatimDER(t *testing.T) {
+	rootKey, root := newTestCertificate(t, "DER Root", nil, nil)
+	key, leaf := newTestCertificate(t, "der.example.com", root, rootKey)
+	pfxData, err := Encode(rand.Reader, key, leaf, []*x509.Certificate{root}, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	certBags, err := DecodeCertBags(pfxData, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(certBags) != 2 || !bytes.Equal(certBags[0].Certificate.Raw, leaf.Raw) || !bytes.Equal(certBags[1].Certificate.Raw, root.Raw) {
+		t.Error("certificate DER was not embedded verbatim")
+	}
+
+	if root.Raw[1] != 0x82 {
+		t.Fatalf("unexpected length encoding %x", root.Raw[:4])
+	}
+	for name, raw := range map[string][]byte{
+		"empty":              nil,
+		"trailing data":      append(append([]byte{}, root.Raw...), 0),
+		"non-minimal length": append([]byte{0x30, 0x83, 0x00}, root.Raw[2:]...),
+	} {
+		bad := *root
+		bad.Raw = raw
+		if _, err := Encode(rand.Reader, key, leaf, []*x509.Certificate{&bad}, "password"); err == nil {
+			t.Errorf("%s: invalid DER was accepted", name)
+		}
+	}
+}
+
+// rewriteAuthenticatedSafe decodes the authenticated safe of pfxData,
+// passes it to rewrite, and returns pfxData with the rewritten authenticated
+// safe and a recomputed MAC.
+func rewriteAuthenticatedSafe(t *testing.T, pfxData []byte, password string, rewrite func([]contentInfo) []contentInfo) []byte {
+	var pfx pfxPdu
+	if err := unmarshal(pfxData, &pfx); err != nil {
+		t.Fatal(err)
+	}
+	var content []byte
+	if err := unmarshal(pfx.AuthSafe.Content.Bytes, &content); err != nil {
+		t.Fatal(err)
+	}
+	var authenticatedSafe []contentInfo
+	if err := unmarshal(content, &authenticatedSafe); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := asn1.Marshal(rewrite(authenticatedSafe))
+	if err != nil {
+		t.Fatal(err)
+	}
+	encodedPassword, _ := bmpString(password)
+	if err := computeMac(&pfx.MacData, content, encodedPassword, nil); err != nil {
+		t.Fatal(err)
+	}
+	pfx.AuthSafe.Content = asn1.RawValue{Class: 2, Tag: 0, IsCompound: true}
+	if pfx.AuthSafe.Content.Bytes, err = asn1.Marshal(content); err != nil {
+		t.Fatal(err)
+	}
+	if pfxData, err = asn1.Marshal(pfx); err != nil {
+		t.Fatal(err)
+	}
+	return pfxData
+}
+
+// safeContentsData returns the contents of an unencrypted SafeContents.
+func safeContentsData(t *testing.T, ci contentInfo) []byte {
+	var data []byte
+	if err := unmarshal(ci.Content.Bytes, &data); err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// setSafeContentsData replaces the contents of an unencrypted SafeContents.
+func setSafeContentsData(t *testing.T, ci *contentInfo, data []byte) {
+	var err error
+	ci.Content = asn1.RawValue{Class: 2, Tag: 0, IsCompound: true}
+	if ci.Content.Bytes, err = asn1.Marshal(data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// newTestCertificate returns a freshly generated ECDSA P-256 key and a
+// certificate for it with the given common name.  If parent is nil, the
+// certificate is self-signed; otherwise it is signed by parent and
+// parentKey.  All test certificates are CA certificates, so that any of them
+// can be used to issue others.
+func newTestCertificate(t testing.TB, commonName string, parent *x509.Certificate, parentKey interface{}) (*ecdsa.PrivateKey, *x509.Certificate) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 64))
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: commonName},
+		DNSNames:              []string{commonName},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, key.Public(), parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, cert
+}
+
+var testdata = map[string]string{
+	// 'null' password test case
+	"Windows Azure Tools": `MIIKDAIBAzCCCcwGCSqGSIb3DQEHAaCCCb0Eggm5MIIJtTCCBe4GCSqGSIb3DQEHAaCCBd8EggXbMIIF1zCCBdMGCyqGSIb3DQEMCgECoIIE7jCCBOowHAYKKoZIhvcNAQwBAzAOBAhStUNnlTGV+gICB9AEggTIJ81JIossF6boFWpPtkiQRPtI6DW6e9QD4/WvHAVrM2bKdpMzSMsCML5NyuddANTKHBVq00Jc9keqGNAqJPKkjhSUebzQFyhe0E1oI9T4zY5UKr/I8JclOeccH4QQnsySzYUG2SnniXnQ+JrG3juetli7EKth9h6jLc6xbubPadY5HMB3wL/eG/kJymiXwU2KQ9Mgd4X6jbcV+NNCE/8jbZHvSTCPeYTJIjxfeX61Sj5kFKUCzERbsnpyevhY3X0eYtEDezZQarvGmXtMMdzf8HJHkWRdk9VLDLgjk8uiJif/+X4FohZ37ig0CpgC2+dP4DGugaZZ51hb8tN9GeCKIsrmWogMXDIVd0OACBp/EjJVmFB6y0kUCXxUE0TZt0XA1tjAGJcjDUpBvTntZjPsnH/4ZySy+s2d9OOhJ6pzRQBRm360TzkFdSwk9DLiLdGfv4pwMMu/vNGBlqjP/1sQtj+jprJiD1sDbCl4AdQZVoMBQHadF2uSD4/o17XG/Ci0r2h6Htc2yvZMAbEY4zMjjIn2a+vqIxD6onexaek1R3zbkS9j19D6EN9EWn8xgz80YRCyW65znZk8xaIhhvlU/mg7sTxeyuqroBZNcq6uDaQTehDpyH7bY2l4zWRpoj10a6JfH2q5shYz8Y6UZC/kOTfuGqbZDNZWro/9pYquvNNW0M847E5t9bsf9VkAAMHRGBbWoVoU9VpI0UnoXSfvpOo+aXa2DSq5sHHUTVY7A9eov3z5IqT+pligx11xcs+YhDWcU8di3BTJisohKvv5Y8WSkm/rloiZd4ig269k0jTRk1olP/vCksPli4wKG2wdsd5o42nX1yL7mFfXocOANZbB+5qMkiwdyoQSk+Vq+C8nAZx2bbKhUq2MbrORGMzOe0Hh0x2a0PeObycN1Bpyv7Mp3ZI9h5hBnONKCnqMhtyQHUj/nNvbJUnDVYNfoOEqDiEqqEwB7YqWzAKz8KW0OIqdlM8uiQ4JqZZlFllnWJUfaiDrdFM3lYSnFQBkzeVlts6GpDOOBjCYd7dcCNS6kq6pZC6p6HN60Twu0JnurZD6RT7rrPkIGE8vAenFt4iGe/yF52fahCSY8Ws4K0UTwN7bAS+4xRHVCWvE8sMRZsRCHizb5laYsVrPZJhE6+hux6OBb6w8kwPYXc+ud5v6UxawUWgt6uPwl8mlAtU9Z7Miw4Nn/wtBkiLL/ke1UI1gqJtcQXgHxx6mzsjh41+nAgTvdbsSEyU6vfOmxGj3Rwc1eOrIhJUqn5YjOWfzzsz/D5DzWKmwXIwdspt1p+u+kol1N3f2wT9fKPnd/RGCb4g/1hc3Aju4DQYgGY782l89CEEdalpQ/35bQczMFk6Fje12HykakWEXd/bGm9Unh82gH84USiRpeOfQvBDYoqEyrY3zkFZzBjhDqa+jEcAj41tcGx47oSfDq3iVYCdL7HSIjtnyEktVXd7mISZLoMt20JACFcMw+mrbjlug+eU7o2GR7T+LwtOp/p4LZqyLa7oQJDwde1BNZtm3TCK2P1mW94QDL0nDUps5KLtr1DaZXEkRbjSJub2ZE9WqDHyU3KA8G84Tq/rN1IoNu/if45jacyPje1Npj9IftUZSP22nV7HMwZtwQ4P4MYHRMBMGCSqGSIb3DQEJFTEGBAQBAAAAMFsGCSqGSIb3DQEJFDFOHkwAewBCADQAQQA0AEYARQBCADAALQBBADEAOABBAC0ANAA0AEIAQgAtAEIANQBGADIALQA0ADkAMQBFAEYAMQA1ADIAQgBBADEANgB9MF0GCSsGAQQBgjcRATFQHk4ATQBpAGMAcgBvAHMAbwBmAHQAIABTAG8AZgB0AHcAYQByAGUAIABLAGUAeQAgAFMAdABvAHIAYQBnAGUAIABQAHIAbwB2AGkAZABlAHIwggO/BgkqhkiG9w0BBwagggOwMIIDrAIBADCCA6UGCSqGSIb3DQEHATAcBgoqhkiG9w0BDAEGMA4ECEBk5ZAYpu0WAgIH0ICCA3hik4mQFGpw9Ha8TQPtk+j2jwWdxfF0+sTk6S8PTsEfIhB7wPltjiCK92Uv2tCBQnodBUmatIfkpnRDEySmgmdglmOCzj204lWAMRs94PoALGn3JVBXbO1vIDCbAPOZ7Z0Hd0/1t2hmk8v3//QJGUg+qr59/4y/MuVfIg4qfkPcC2QSvYWcK3oTf6SFi5rv9B1IOWFgN5D0+C+x/9Lb/myPYX+rbOHrwtJ4W1fWKoz9g7wwmGFA9IJ2DYGuH8ifVFbDFT1Vcgsvs8arSX7oBsJVW0qrP7XkuDRe3EqCmKW7rBEwYrFznhxZcRDEpMwbFoSvgSIZ4XhFY9VKYglT+JpNH5iDceYEBOQL4vBLpxNUk3l5jKaBNxVa14AIBxq18bVHJ+STInhLhad4u10v/Xbx7wIL3f9DX1yLAkPrpBYbNHS2/ew6H/ySDJnoIDxkw2zZ4qJ+qUJZ1S0lbZVG+VT0OP5uF6tyOSpbMlcGkdl3z254n6MlCrTifcwkzscysDsgKXaYQw06rzrPW6RDub+t+hXzGny799fS9jhQMLDmOggaQ7+LA4oEZsfT89HLMWxJYDqjo3gIfjciV2mV54R684qLDS+AO09U49e6yEbwGlq8lpmO/pbXCbpGbB1b3EomcQbxdWxW2WEkkEd/VBn81K4M3obmywwXJkw+tPXDXfBmzzaqqCR+onMQ5ME1nMkY8ybnfoCc1bDIupjVWsEL2Wvq752RgI6KqzVNr1ew1IdqV5AWN2fOfek+0vi3Jd9FHF3hx8JMwjJL9dZsETV5kHtYJtE7wJ23J68BnCt2eI0GEuwXcCf5EdSKN/xXCTlIokc4Qk/gzRdIZsvcEJ6B1lGovKG54X4IohikqTjiepjbsMWj38yxDmK3mtENZ9ci8FPfbbvIEcOCZIinuY3qFUlRSbx7VUerEoV1IP3clUwexVQo4lHFee2jd7ocWsdSqSapW7OWUupBtDzRkqVhE7tGria+i1W2d6YLlJ21QTjyapWJehAMO637OdbJCCzDs1cXbodRRE7bsP492ocJy8OX66rKdhYbg8srSFNKdb3pF3UDNbN9jhI/t8iagRhNBhlQtTr1me2E/c86Q18qcRXl4bcXTt6acgCeffK6Y26LcVlrgjlD33AEYRRUeyC+rpxbT0aMjdFderlndKRIyG23mSp0HaUwNzAfMAcGBSsOAwIaBBRlviCbIyRrhIysg2dc/KbLFTc2vQQUg4rfwHMM4IKYRD/fsd1x6dda+wQ=`,
+	// HMAC-SHA-256 MAC, generated by OpenSSL 3 with "-macalg sha256"
+	"OpenSSL SHA-256 MAC": `MIIJcQIBAzCCCScGCSqGSIb3DQEHAaCCCRgEggkUMIIJEDCCA8cGCSqGSIb3DQEHBqCCA7gwggO0
+AgEAMIIDrQYJKoZIhvcNAQcBMBwGCiqGSIb3DQEMAQMwDgQImgjtqrMagakCAggAgIIDgMBCjGtf
+urbukEtn94MpC0eum1GMI48DQRErPXeOde1pbblNvc689Qvd4zv6QnFn2r+wBsDxzfDUGIV+tlfn
+qSdyPwIr9XkuW6E/HoQNu8ZXh8Pm5mm6id6eEt0C0fGzLpyUCRqmJ+d1d0/7ytf3hw8PO1TKiSVE
++oVNmGtDYA7m3AWkZHmvngHzPNmVbHnnZB99xPIoFDEJp1qBznekQO6ES9jcJaOlqCAfyEWSCMom
+2XtBoeB/uYiB+mxL69zQMx4N2ZaDkK8FFy5oOj79l4fU/AgJUFzVWaCNySyvseDdhJRnGOeD2i3T
+GaOEJwuesG12r9BipsukGzVuMrCw/Oden9HFo2l4lNXNRSuz5KY4aURlJDiVg0vhcuPo+4uqvVh8
+lfOFLwwm+eQmntTLkLcf0tEKT9U17snGc+fkGYKYqpktSfZwm20bLYQloZh1MgA4jmIPkMl61U7H
+n6oZblZ51NmsAZVXob/p5cNC8FjG2dHojH5uTKA9YLuk8sYTeXHehnHIKn4cIqYP8dRmbN+yjvVV
+lS4rEUD5OSrzmjARvKBXflpyCFsW7JotojiZ+aYlJ+dWvg8WsjgNQB/F9Ry1JBMC9nsPgPM/pVPW
+0/0/BUwuHJTvpj5gUX4UFForWCNOgrNAr577Fq9Z5v/Uf68/op7t1VlE7lYaldiAH93bgCoFHQoN
+XFq8WXqMd/ThwlURwL1GtcAB1SXc0dxsk2fq/QrOHxycff1ITAj9JjvXxfIkcoiGVl3cySuxOqvI
+Yekq6TGCE0nIezcibyoCBkn/KcXdqdx/CFR0F7t5LalXC/4I/Hn+KJLuJTI6gi+oUC4Uf+euKZ1Q
+PwecCmKe/fbcalUMUBG3KJZqiLb0QhoFWXSANN25lKTHj2z/XQQUfMF472oxOl/6ht4VLWzJ4Xki
+591bDPMZEiLYw3K3SDVTL2dQeMqdSBv3yVmxMylPXsYdaYKxTBs7P7wuNVHxvv6DNau+kRn36jBi
+zHqQz2LD5OdSyWqK0NyUgr4vn3QvX24Y2f3qY/4SXoH6OiRrVwQ0lAiNXh5Pipz8I31WX1aXk3H5
+T7AwUmv+gTl9oNrAsrJ1mNyXJO5KBuU3sm34WmFeumjGsTPICQupazauIdT1eSAdj9ANOcUAwgY6
+qHNQJF5IeeMKSLlpwH7tjF3F1qUMoGrzAu9ClyB8G0DxamxLMIIFQQYJKoZIhvcNAQcBoIIFMgSC
+BS4wggUqMIIFJgYLKoZIhvcNAQwKAQKgggTuMIIE6jAcBgoqhkiG9w0BDAEDMA4ECG6EFXJrn288
+AgIIAASCBMjRsfZWYzOAlaklLBoPvB8qleb1menQCrHpeAY+QNBtZY2+c9QSchctDxoatLrmUixM
+pFPBM++MNZ/GxcYfUxflj7F8F6C2CBFD8TLrCmpbOH+JByZWDecXl6w4NmYbCHOiHdTRZs7cRIwG
+rM8QgYT9OSId/in1pFk0h/HFttwl7wJqYRCRjEzMeDtkf//kgfjkiRoMqcZylRKYKISaUHSwcrG2
+3jFSALond7IZbANbJIOdO2iamcUCCLG0vtWp45gHTxi0oqTMLOI4F8JK2T1VB7FSZTt+SCZmTqxN
+ysvwZfYq9dNuYHtSvsrtdKRaYaHIrCO+BnA+B3U2Zfky4EI7lQm8CW0S7VwSWHSBmwyCXzCG70ov
+WcJ1/yqGqAs4EaEw9Apm5SDDWMIDajMqPValAST3i134VurlIuI4/1Sld9vQO0vOSZw6hUGhkIpO
+dHOXkkLYjcaMfPY1+hGLCAtqG5N+ExYEDJGy+q7oW9PJiw9ooNTtYavtEE6Y096O+yXKup9uAz/+
+QU/weOIZFRZV2lPthRre+7xP30VUbz6rVkZgwRSUU9Tb1SzQPHCZqbUpUpicFBpSyWZa/CD9H0Xw
+n+cvUxzAkU8vuWxXPI9DCFtbya45g1Rro3twc1Pgh6csBIzFjihsmV3bacm1rBImvaCKU9xN5p2j
+v8mD9WgEjJExZuLhXqVTK7IXWvsnZciF9YAit0FDU2gUG+ne1zYU3ty5iYCZ536pv88LJXGnpnXW
+ex+eYx9O/Og6ROwt5jgydWptbELhPluZQKEcTiuOu2MA0UAg5YuIu6Tm8FkLnwM6otiNxgp8slmS
+0/EZ8Jas1Y+b+KZUjmXaWDkLCvL0hGnfFtnoeALp5Tz/8rIKxNvDCPjx9iXZ/UqV3ySYNTklYa7Q
+HFUnZg5A6J/aQmIXqcSmkPHQb9XN/GZnYZM8pNd0tlamM/erOBPspdMbITuMzAdTn4/PXl7WzmH4
+6yzPs0pfyyh1nSS+Fl/iXprA0RIbmD5ImAi/aa/qbGCv+z8cdlK7KRiBEk/tx6FKjdIWtQjCzQsp
+ixxLC4vcK9iLMLFqjF2uj0u50S8rWt6B6SvzU3HTYZxYDA+qZkgg87DG8wSV1nTVYY16DSOqLE5h
+IiD2em4udeUv/JjlF+x4tiw0iJZHvWZNSdT8PKC8D/2kERswSnNwjz6nb6ZWpLcTAXR55BcO0lV0
+I7elDLprSmQt5U4oDDthTikrHvhlc0oxus4MhZBYqNyC+UbjAlauaGW1LghxqKFHcFKArmZC3Omh
+DA3JiyZH8Sd+vj7rDABBlrTzVsK4aWEAXYBK9/G9yg1kCkQC1GUAJwAoRtn5YR0KOXzeeFnC1fbV
+zXXvLkanfkwdyzxKHusTzIU3h6qLz8nsNDFxJHwuGyXcwhKWJitwqf1JV8ccPRB+3ZKEBAvRkdhB
+Ti2w0DrJWUnCtdYnIj1v5FTemwXpgTAB82xcaLXIfv8ayvFmRraMI5htbfvYbd25wIgjx/VH4k63
+GYaMTR1k1sJnpjseOsO8w6lJq42M+2P29ncF6P8uke1t2BLv3dcwXq/OUcit12OSqxpZbdWG7sas
+2gZBdn2QIxN2xvdRKLqX0oyZqW5sAJZuPDh8h1MVecjrvQgxJTAjBgkqhkiG9w0BCRUxFgQUNfOy
+iYiMgSJIhUcH4v/i981wbKgwQTAxMA0GCWCGSAFlAwQCAQUABCDuZEnEV7CfKhYVL6pCeFoesIZK
+YEDpv69jIU3tGKiwpAQIL2mlGTbB9vYCAggA`,
+	// empty string password test case
+	"testing@example.com": `MIIJzgIBAzCCCZQGCSqGSIb3DQEHAaCCCYUEggmBMIIJfTCCA/cGCSqGSIb3DQEHBqCCA+gwggPk
+AgEAMIID3QYJKoZIhvcNAQcBMBwGCiqGSIb3DQEMAQYwDgQIIszfRGqcmPcCAggAgIIDsOZ9Eg1L
+s5Wx8JhYoV3HAL4aRnkAWvTYB5NISZOgSgIQTssmt/3A7134dibTmaT/93LikkL3cTKLnQzJ4wDf
+YZ1bprpVJvUqz+HFT79m27bP9zYXFrvxWBJbxjYKTSjQMgz+h8LAEpXXGajCmxMJ1oCOtdXkhhzc
+LdZN6SAYgtmtyFnCdMEDskSggGuLb3fw84QEJ/Sj6FAULXunW/CPaS7Ce0TMsKmNU/jfFWj3yXXw
+ro0kwjKiVLpVFlnBlHo2OoVU7hmkm59YpGhLgS7nxLD3n7nBroQ0ID1+8R01NnV9XLGoGzxMm1te
+6UyTCkr5mj+kEQ8EP1Ys7g/TC411uhVWySMt/rcpkx7Vz1r9kYEAzJpONAfr6cuEVkPKrxpq4Fh0
+2fzlKBky0i/hrfIEUmngh+ERHUb/Mtv/fkv1j5w9suESbhsMLLiCXAlsP1UWMX+3bNizi3WVMEts
+FM2k9byn+p8IUD/A8ULlE4kEaWeoc+2idkCNQkLGuIdGUXUFVm58se0auUkVRoRJx8x4CkMesT8j
+b1H831W66YRWoEwwDQp2kK1lA2vQXxdVHWlFevMNxJeromLzj3ayiaFrfByeUXhR2S+Hpm+c0yNR
+4UVU9WED2kacsZcpRm9nlEa5sr28mri5JdBrNa/K02OOhvKCxr5ZGmbOVzUQKla2z4w+Ku9k8POm
+dfDNU/fGx1b5hcFWtghXe3msWVsSJrQihnN6q1ughzNiYZlJUGcHdZDRtiWwCFI0bR8h/Dmg9uO9
+4rawQQrjIRT7B8yF3UbkZyAqs8Ppb1TsMeNPHh1rxEfGVQknh/48ouJYsmtbnzugTUt3mJCXXiL+
+XcPMV6bBVAUu4aaVKSmg9+yJtY4/VKv10iw88ktv29fViIdBe3t6l/oPuvQgbQ8dqf4T8w0l/uKZ
+9lS1Na9jfT1vCoS7F5TRi+tmyj1vL5kr/amEIW6xKEP6oeAMvCMtbPAzVEj38zdJ1R22FfuIBxkh
+f0Zl7pdVbmzRxl/SBx9iIBJSqAvcXItiT0FIj8HxQ+0iZKqMQMiBuNWJf5pYOLWGrIyntCWwHuaQ
+wrx0sTGuEL9YXLEAsBDrsvzLkx/56E4INGZFrH8G7HBdW6iGqb22IMI4GHltYSyBRKbB0gadYTyv
+abPEoqww8o7/85aPSzOTJ/53ozD438Q+d0u9SyDuOb60SzCD/zPuCEd78YgtXJwBYTuUNRT27FaM
+3LGMX8Hz+6yPNRnmnA2XKPn7dx/IlaqAjIs8MIIFfgYJKoZIhvcNAQcBoIIFbwSCBWswggVnMIIF
+YwYLKoZIhvcNAQwKAQKgggTuMIIE6jAcBgoqhkiG9w0BDAEDMA4ECJr0cClYqOlcAgIIAASCBMhe
+OQSiP2s0/46ONXcNeVAkz2ksW3u/+qorhSiskGZ0b3dFa1hhgBU2Q7JVIkc4Hf7OXaT1eVQ8oqND
+uhqsNz83/kqYo70+LS8Hocj49jFgWAKrf/yQkdyP1daHa2yzlEw4mkpqOfnIORQHvYCa8nEApspZ
+wVu8y6WVuLHKU67mel7db2xwstQp7PRuSAYqGjTfAylElog8ASdaqqYbYIrCXucF8iF9oVgmb/Qo
+xrXshJ9aSLO4MuXlTPELmWgj07AXKSb90FKNihE+y0bWb9LPVFY1Sly3AX9PfrtkSXIZwqW3phpv
+MxGxQl/R6mr1z+hlTfY9Wdpb5vlKXPKA0L0Rt8d2pOesylFi6esJoS01QgP1kJILjbrV731kvDc0
+Jsd+Oxv4BMwA7ClG8w1EAOInc/GrV1MWFGw/HeEqj3CZ/l/0jv9bwkbVeVCiIhoL6P6lVx9pXq4t
+KZ0uKg/tk5TVJmG2vLcMLvezD0Yk3G2ZOMrywtmskrwoF7oAUpO9e87szoH6fEvUZlkDkPVW1NV4
+cZk3DBSQiuA3VOOg8qbo/tx/EE3H59P0axZWno2GSB0wFPWd1aj+b//tJEJHaaNR6qPRj4IWj9ru
+Qbc8eRAcVWleHg8uAehSvUXlFpyMQREyrnpvMGddpiTC8N4UMrrBRhV7+UbCOWhxPCbItnInBqgl
+1JpSZIP7iUtsIMdu3fEC2cdbXMTRul+4rdzUR7F9OaezV3jjvcAbDvgbK1CpyC+MJ1Mxm/iTgk9V
+iUArydhlR8OniN84GyGYoYCW9O/KUwb6ASmeFOu/msx8x6kAsSQHIkKqMKv0TUR3kZnkxUvdpBGP
+KTl4YCTvNGX4dYALBqrAETRDhua2KVBD/kEttDHwBNVbN2xi81+Mc7ml461aADfk0c66R/m2sjHB
+2tN9+wG12OIWFQjL6wF/UfJMYamxx2zOOExiId29Opt57uYiNVLOO4ourPewHPeH0u8Gz35aero7
+lkt7cZAe1Q0038JUuE/QGlnK4lESK9UkSIQAjSaAlTsrcfwtQxB2EjoOoLhwH5mvxUEmcNGNnXUc
+9xj3M5BD3zBz3Ft7G3YMMDwB1+zC2l+0UG0MGVjMVaeoy32VVNvxgX7jk22OXG1iaOB+PY9kdk+O
+X+52BGSf/rD6X0EnqY7XuRPkMGgjtpZeAYxRQnFtCZgDY4wYheuxqSSpdF49yNczSPLkgB3CeCfS
++9NTKN7aC6hBbmW/8yYh6OvSiCEwY0lFS/T+7iaVxr1loE4zI1y/FFp4Pe1qfLlLttVlkygga2UU
+SCunTQ8UB/M5IXWKkhMOO11dP4niWwb39Y7pCWpau7mwbXOKfRPX96cgHnQJK5uG+BesDD1oYnX0
+6frN7FOnTSHKruRIwuI8KnOQ/I+owmyz71wiv5LMQt+yM47UrEjB/EZa5X8dpEwOZvkdqL7utcyo
+l0XH5kWMXdW856LL/FYftAqJIDAmtX1TXF/rbP6mPyN/IlDC0gjP84Uzd/a2UyTIWr+wk49Ek3vQ
+/uDamq6QrwAxVmNh5Tset5Vhpc1e1kb7mRMZIzxSP8JcTuYd45oFKi98I8YjvueHVZce1g7OudQP
+SbFQoJvdT46iBg1TTatlltpOiH2mFaxWVS0xYjAjBgkqhkiG9w0BCRUxFgQUdA9eVqvETX4an/c8
+p8SsTugkit8wOwYJKoZIhvcNAQkUMS4eLABGAHIAaQBlAG4AZABsAHkAIABuAGEAbQBlACAAZgBv
+AHIAIABjAGUAcgB0MDEwITAJBgUrDgMCGgUABBRFsNz3Zd1O1GI8GTuFwCWuDOjEEwQIuBEfIcAy
+HQ8CAggA`,
+}
+
+// openSSL111TestData was written by "openssl pkcs12 -export -legacy -name
+// myname" of OpenSSL 3.0, which behaves as OpenSSL 1.1.1, for a P-256 key
+// and certificate and a CA certificate, with the password "password".
+const openSSL111TestData = `MIIFkwIBAzCCBVkGCSqGSIb3DQEHAaCCBUoEggVGMIIFQjCCBBcGCSqGSIb3DQEHBqCCBAgwggQE
+AgEAMIID/QYJKoZIhvcNAQcBMBwGCiqGSIb3DQEMAQYwDgQINrRQN3VixWkCAggAgIID0GYiC9ZK
+U9rgcbAsptt6mW/xSOOk5rT/DIYVi1Bgt1pptm918HVKqDLzbgZ0CDW+9v+Eiw+gSK1qdBJtHnID
+eiP2lNUaUtAoMS4uXoQiR+jkjHtXv6KqIOGKi7G6dUj/zkfxpMsZXgbVkzKGVGdANf4rB0bW2u0+
+isdkFQqj51uSY2lqcj4lXD1ihNt54byPnLsqHGkylf1O8KFafNyP7TjJLb2fla/yW+T0RKi1cK2m
+aQHh8yWYlcFv/nWClUztiftygemIeRpxR+k80+g0gG8qBbNuWl8LLVtbFvVkO2HXvADHsHWsjo5S
+vRw7mpptjvLTRW3osGfMGuE/QdH9/QrH6XBP7EQFKBGiI6lKM8ek8yNpkMHBF4/KjGbma9m2J/Pl
+awOUaYik2jTnwtCKtBc2V3m22EIGITDg7I+3rb3kSiV/4+8PecW74fwERS7SVwoomhOiAh2X4iN+
+14pELLp8OI1Va4kQdhAhggwkA2F13ww2MFnTbO0fwl6BFg18LW5rHvPIT6MnLYwoFV7u+bdzTrXA
+Ny3YaCeqHvtJAY0Os+A51spY7mi7oC1oF2pfZKA2gWlL8UBeONU/OSmzksgdrUdJ9n4J1L0zaj0z
+cOlRjKnkf4IB/1byyqITb4QQlfpUeUsmQlvUuoQba2jeUW54Vl8ArXD36oFuAi73Knmil9j6ZxFt
+xnE6ecxVdRYyU8xuHEtmvObnzg6tzLjwTY2H09AAY4d5Ex/QK8Z5phf5acm2LReuPWNi4htzhjTw
+NbKIwMZW30V09YVpnsUoiNKjWNc4TE3DrYu3ZgOfHmhk0CyjBR3wlF2pmIOruL9MHr3qBF/r2Si2
+c3R1+b61mIL3Sjeip3GCaU1iFdsT10NN56qBWPYP/3Dc0v6XT0YHyE8LN/kMHhs3qFfySxFx1oaq
+TYXx5tL//gcoF1y2ggLoBKkdqyo3YYp0GZ2WlamXnUzuKvfr8iz3KNxtSkXnXim7NN7wSNol2aZ5
+3j0P5KA6M4BcNF18TvUe5U5fyMbMSm2cZsknc9hGjcWMaloVKGEbF6dBNjG++E2mbcgdKZN12IjK
+MhsAAJe99oq/gCWgWsOl9bciaPll1HGyYhF4BGhzEZG85q3t5OtwGZtKVaqA+h7X97jD4nrpbTuZ
+V5wHdoYtfsw9gGx4bpe1CGKyA1smSgfGSGN/uTxKootWvPBiWS2jWbvo6rSmsQNjYPG7ssv3AIKB
+gXmJXlNHqqKyQ6fvwrf8KnGF55DDapCTj7RidX8+vSf77YurgEJUDKZ1+ngHsWVFBk9G3/TNG+M8
+ho4wggEjBgkqhkiG9w0BBwGgggEUBIIBEDCCAQwwggEIBgsqhkiG9w0BDAoBAqCBtDCBsTAcBgoq
+hkiG9w0BDAEDMA4ECOyj4m8lV1VfAgIIAASBkOHaWjoQn06ATPRI24ZvboK+C7waBMeUMeyioaVH
+AzbWCdbx7GwaEw5QB77Tj9PVgvpY3Js1wC5989pbvpTGCXK3Vvl4AKmR5U1vQbME07QhEhE8+nSs
+fBnCsNkqXQB8MfXayR8ekYv4lZ4ErFZO6RB7dDKJc5whDRYrMVQpC024ctRlJpxTjo/NClpNuuNt
+LzFCMBsGCSqGSIb3DQEJFDEOHgwAbQB5AG4AYQBtAGUwIwYJKoZIhvcNAQkVMRYEFFBDwdf6x8mN
+xxQXrpa4iBmFGREWMDEwITAJBgUrDgMCGgUABBS++dOItyCfVyM1JIgcHWm0VLxBgAQICaZyzZlB
+gkICAggA`
+
+// pfxSkeleton describes the structure of pfxData down to the plaintext of
+// its bags, omitting only the salts and the values which depend on them.
+func pfxSkeleton(t *testing.T, pfxData []byte, password string) string {
+	encodedPassword, _ := bmpString(password)
+	var pfx pfxPdu
+	if err := unmarshal(pfxData, &pfx); err != nil {
+		t.Fatal(err)
+	}
+	params := func(algorithm pkix.AlgorithmIdentifier) string {
+		var p pbeParams
+		if err := unmarshal(algorithm.Parameters.FullBytes, &p); err != nil {
+			t.Fatal(err)
+		}
+		return fmt.Sprintf("%v salt %d iterations %d", algorithm.Algorithm, len(p.Salt), p.Iterations)
+	}
+	skeleton := fmt.Sprintf("version %d, MAC %v %x salt %d iterations %d\n", pfx.Version,
+		pfx.MacData.Mac.Algorithm.Algorithm, pfx.MacData.Mac.Algorithm.Parameters.FullBytes, len(pfx.MacData.MacSalt), pfx.MacData.Iterations)
+
+	var content []byte
+	if err := unmarshal(pfx.AuthSafe.Content.Bytes, &content); err != nil {
+		t.Fatal(err)
+	}
+	var authenticatedSafe []contentInfo
+	if err := unmarshal(content, &authenticatedSafe); err != nil {
+		t.Fatal(err)
+	}
+	for _, ci := range authenticatedSafe {
+		var data []byte
+		if ci.ContentType.Equal(oidEncryptedDataContentType) {
+			var ed encryptedData
+			if err := unmarshal(ci.Content.Bytes, &ed); err != nil {
+				t.Fatal(err)
+			}
+			skeleton += fmt.Sprintf("encrypted data version %d, %v, %s\n", ed.Version, ed.EncryptedContentInfo.ContentType, params(ed.EncryptedContentInfo.ContentEncryptionAlgorithm))
+			var err error
+			if data, err = pbDecrypt(ed.EncryptedContentInfo, encodedPassword, nil); err != nil {
+				t.Fatal(err)
+			}
+		} else {
+			skeleton += fmt.Sprintf("%v\n", ci.ContentType)
+			data = safeContentsData(t, ci)
+		}
+
+		// The attributes are kept as they are encoded, to tell an
+		// empty set from an absent one.
+		var bags []struct {
+			Id         asn1.ObjectIdentifier
+			Value      asn1.RawValue `asn1:"tag:0,explicit"`
+			Attributes asn1.RawValue `asn1:"optional"`
+		}
+		if err := unmarshal(data, &bags); err != nil {
+			t.Fatal(err)
+		}
+		for _, bag := range bags {
+			value := fmt.Sprintf("%x", bag.Value.FullBytes)
+			if bag.Id.Equal(oidPKCS8ShroundedKeyBag) {
+				var pkinfo encryptedPrivateKeyInfo
+				if err := unmarshal(bag.Value.Bytes, &pkinfo); err != nil {
+					t.Fatal(err)
+				}
+				pkData, err := pbDecrypt(pkinfo, encodedPassword, nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				value = fmt.Sprintf("%s %x", params(pkinfo.AlgorithmIdentifier), pkData)
+			}
+			skeleton += fmt.Sprintf("  bag %v attributes %x: %s\n", bag.Id, bag.Attributes.FullBytes, value)
+		}
+	}
+	return skeleton
+}
+
+func TestOpenSSL111Structure(t *testing.T) {
+	want, _ := base64.StdEncoding.DecodeString(openSSL111TestData)
+	privateKey, leaf, caCerts, err := DecodeChainWithCAs(want, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := OpenSSL111.EncodeTLSCertificate(rand.Reader, tls.Certificate{
+		Certificate: [][]byte{leaf.Raw, caCerts[0].Raw},
+		PrivateKey:  privateKey,
+		Leaf:        leaf,
+	}, "password", &TLSCertificateOptions{FriendlyName: "myname"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wantSkeleton, gotSkeleton := pfxSkeleton(t, want, "password"), pfxSkeleton(t, got, "password"); gotSkeleton != wantSkeleton {
+		t.Errorf("structure differs from OpenSSL's:\ngot:\n%s\nwant:\n%s", gotSkeleton, wantSkeleton)
+	}
+	if len(got) != len(want) {
+		t.Errorf("encoded %d bytes, OpenSSL %d", len(got), len(want))
+	}
+}
+
+func TestEncodeEdgeCases(t *testing.T) {
+	key, cert := newTestCertificate(t, "www.example.com", nil, nil)
+	decodeIdentity := func(pfxData []byte) error {
+		_, _, caCerts, err := DecodeChainWithCAs(pfxData, "password")
+		if err == nil && len(caCerts) != 0 {
+			err = fmt.Errorf("got %d CA certificates, want none", len(caCerts))
+		}
+		return err
+	}
+	decodeTrustStore := func(pfxData []byte) error {
+		_, err := DecodeTrustStore(pfxData, "password")
+		return err
+	}
+
+	tests := []struct {
+		name   string
+		encode func() ([]byte, error)
+		check  func([]byte) error // nil if encoding must fail
+	}{
+		{"nil rand", func() ([]byte, error) { return Encode(nil, key, cert, nil, "password") }, decodeIdentity},
+		{"nil rand with Modern", func() ([]byte, error) { return Modern.Encode(nil, key, cert, nil, "password") }, decodeIdentity},
+		{"empty CA certificates", func() ([]byte, error) { return Encode(nil, key, cert, []*x509.Certificate{}, "password") }, decodeIdentity},
+		{"empty password", func() ([]byte, error) { return Encode(nil, key, cert, nil, "") }, func(pfxData []byte) error {
+			_, _, err := Decode(pfxData, "")
+			return err
+		}},
+		{"nil certificate", func() ([]byte, error) { return Encode(nil, key, nil, nil, "password") }, nil},
+		{"nil private key", func() ([]byte, error) { return Encode(nil, nil, cert, nil, "password") }, nil},
+		{"nil CA certificate", func() ([]byte, error) { return Encode(nil, key, cert, []*x509.Certificate{nil}, "password") }, nil},
+		{"empty trust store", func() ([]byte, error) { return EncodeTrustStore(nil, nil, "password") }, decodeTrustStore},
+		{"nil trusted certificate", func() ([]byte, error) { return EncodeTrustStore(nil, []*x509.Certificate{cert, nil}, "password") }, nil},
+		{"nil CRL", func() ([]byte, error) {
+			return EncodeTrustStoreWithCRLs(nil, []*x509.Certificate{cert}, []*x509.RevocationList{nil}, "password")
+		}, nil},
+		{"nil rand for EncodeTLSCertificate", func() ([]byte, error) {
+			return EncodeTLSCertificate(nil, tls.Certificate{Certificate: [][]byte{cert.Raw}, PrivateKey: key}, "password", nil)
+		}, decodeIdentity},
+		{"empty tls.Certificate", func() ([]byte, error) { return EncodeTLSCertificate(nil, tls.Certificate{}, "password", nil) }, nil},
+		{"nil enrollment response", func() ([]byte, error) { return EncodeEnrollmentResponse(nil, nil, "password") }, nil},
+		{"nil CA certificate in enrollment response", func() ([]byte, error) {
+			return EncodeEnrollmentResponse(nil, &EnrollmentResponse{PrivateKey: key, Certificate: cert, CACerts: []*x509.Certificate{nil}}, "password")
+		}, nil},
+		{"nil rand for EncodeEmpty", func() ([]byte, error) { return EncodeEmpty(nil, "password") }, decodeTrustStore},
+		{"nil rand for ConvertToBCFKS", func() ([]byte, error) {
+			pfxData, err := Encode(nil, key, cert, nil, "password")
+			if err != nil {
+				return nil, err
+			}
+			return ConvertToBCFKS(nil, pfxData, "password")
+		}, func([]byte) error { return nil }},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pfxData, err := test.encode()
+			switch {
+			case test.check == nil && err == nil:
+				t.Error("encoding succeeded, want an error")
+			case test.check != nil && err != nil:
+				t.Errorf("encoding failed: %v", err)
+			case test.check != nil:
+				if err := test.check(pfxData); err != nil {
+					t.Errorf("the encoding cannot be decoded: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestEd25519(t *testing.T) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "ed25519.example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, privateKey := range []interface{}{key, &key} {
+		pfxData, err := Modern.Encode(rand.Reader, privateKey, cert, nil, "password")
+		if err != nil {
+			t.Fatalf("%T: %v", privateKey, err)
+		}
+		decodedKey, _, err := Decode(pfxData, "password")
+		if err != nil {
+			t.Fatalf("%T: %v", privateKey, err)
+		}
+		if !key.Equal(decodedKey) {
+			t.Errorf("%T: decoded key does not match", privateKey)
+		}
+	}
+
+	pfxData, _ := base64.StdEncoding.DecodeString(openSSLEd25519TestData)
+	privateKey, certificate, err := Decode(pfxData, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := privateKey.(ed25519.PrivateKey); !ok {
+		t.Fatalf("decoded a %T, want an ed25519.PrivateKey", privateKey)
+	}
+	if certificate.Subject.CommonName != "ed25519.example.com" {
+		t.Errorf("got common name %q", certificate.Subject.CommonName)
+	}
+
+	blocks, err := ToPEM(pfxData, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pemData []byte
+	for _, b := range blocks {
+		pemData = append(pemData, pem.EncodeToMemory(b)...)
+	}
+	if _, err := tls.X509KeyPair(pemData, pemData); err != nil {
+		t.Errorf("PEM blocks are not a key pair: %v", err)
+	}
+}
+
+func TestX25519(t *testing.T) {
+	pfxData, _ := base64.StdEncoding.DecodeString(openSSLX25519TestData)
+	privateKey, certificate, err := Decode(pfxData, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, ok := privateKey.(*ecdh.PrivateKey)
+	if !ok || key.Curve() != ecdh.X25519() {
+		t.Fatalf("decoded a %T, want an X25519 *ecdh.PrivateKey", privateKey)
+	}
+	if !publicKeyMatches(key.Public(), certificate) {
+		t.Error("key does not match the certificate")
+	}
+
+	pfxData, err = Modern.Encode(rand.Reader, key, certificate, nil, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	decodedKey, _, err := Decode(pfxData, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !key.Equal(decodedKey) {
+		t.Error("re-encoded key does not match")
+	}
+	if _, err := ToPEM(pfxData, "password"); err != nil {
+		t.Error(err)
+	}
+}
+
+// openSSLEd25519TestData was generated with
+//
+//	openssl genpkey -algorithm ed25519 -out ed.key
+//	openssl req -new -x509 -key ed.key -subj /CN=ed25519.example.com -days 36500 -out ed.crt
+//	openssl pkcs12 -export -inkey ed.key -in ed.crt -passout pass:password
+const openSSLEd25519TestData = `MIIDhgIBAzCCAzwGCSqGSIb3DQEHAaCCAy0EggMpMIIDJTCCAjIGCSqGSIb3DQEHBqCCAiMwggIf
+AgEAMIICGAYJKoZIhvcNAQcBMFcGCSqGSIb3DQEFDTBKMCkGCSqGSIb3DQEFDDAcBAiTMMsAk2iZ
+lAICCAAwDAYIKoZIhvcNAgkFADAdBglghkgBZQMEASoEEM3NSj/COazpf+fnOqvCtlaAggGwI+xn
+sCWoyw/d9JXfL/spH7a11qg2ZTGRm7Qxvc/b8rwJ9MlgLjR+b3KcwD3tj/hR1NRBgY6cMWOHtBHS
+QfF167RqZPoqyVFjzbDW8NHsPLkHP/mESfhCZDMrUYFp3DXwRza76sZDNGmU+DSN8hhzsaHDKB1Q
+8AC1MzOFFG57S7lf2OdNxGeZwPjcXa1Mx37jgQwriv4+T1Neg/qFXk1B89zkivt2agKf/9M64ND/
+EAid3z7bcFBzTak3qoOej9QgcWqiONYkmPSAAAmPHMAnWxlipfGAvxbECR/jAzvlCLD+sPT1ovgn
+gi68pcj6gZ4CBxn/uuKU7RroSMP+VQ3lAmoXuUC5MghUlFnA2uTgFizIH6ZlQeEKh2y7ReH7hZko
+0N94TnXGkjHYOAxpvnkj5hxLG81cHU7jQ/owaXh2I654uq+60yeJ/CfeU8t5r4RTLHiJlXbCI3kP
+xOzLtWWiiOyH5ZhdYnl6zCpLamt0LrO81JfoTYkB7DUs9oZPnPu1GrzkL1nIWeV6uJrEMdSmhgnz
+dC67fgIgJRz28hXBp38O78g4voHRVjNe/vMQfeueMIHsBgkqhkiG9w0BBwGggd4EgdswgdgwgdUG
+CyqGSIb3DQEMCgECoIGeMIGbMFcGCSqGSIb3DQEFDTBKMCkGCSqGSIb3DQEFDDAcBAi+8GJdaIlI
+WQICCAAwDAYIKoZIhvcNAgkFADAdBglghkgBZQMEASoEECb2NlLIm9+A7H9t9WaRMCsEQONmK8cN
+wftDBxUEwanctAl114Sfu7Vf18cMaclhpSDC5oHN8HHGxpuoaWDC2nP+Au3RkxgQs/zYMHUBdkfX
+bw8xJTAjBgkqhkiG9w0BCRUxFgQUL3RhZlA4vNJfbQfepB1B7x5UVb0wQTAxMA0GCWCGSAFlAwQC
+AQUABCD/PHkeNjYtBSgtj0P2qseBYOch3xAYCph6yfcpnIaeVgQIsHOav0U3K0cCAggA`
+
+// openSSLX25519TestData was generated, with ed.key and ed.crt of
+// openSSLEd25519TestData as the issuer, with
+//
+//	openssl genpkey -algorithm x25519 -out x25519.key
+//	openssl pkey -in x25519.key -pubout -out x25519.pub
+//	openssl x509 -new -subj /CN=x25519.example.com -force_pubkey x25519.pub -CA ed.crt -CAkey ed.key -days 36500 -out x25519.crt
+//	openssl pkcs12 -export -inkey x25519.key -in x25519.crt -passout pass:password
+const openSSLX25519TestData = `MIIDNgIBAzCCAuwGCSqGSIb3DQEHAaCCAt0EggLZMIIC1TCCAeIGCSqGSIb3DQEHBqCCAdMwggHP
+AgEAMIIByAYJKoZIhvcNAQcBMFcGCSqGSIb3DQEFDTBKMCkGCSqGSIb3DQEFDDAcBAi5LGZtP7mR
+PQICCAAwDAYIKoZIhvcNAgkFADAdBglghkgBZQMEASoEELEAUbQx/2EDv+nxLjHcF9uAggFgrAy/
+7RU/6fYfzPCrWe9kVMttU4rXfNVHBz5zvRm/gF0WL/KLTMgFnkVJiPSM3SBZCu6Kg0/tYVz3JfSv
+79PIN9t05i+e9gESYyRTBiGGXxSfyP5b8Aa9eVctwvnR6Cc1o3fi3AOVPmRaE3cawbKK8g2h/mTW
+Do2MjqxYHLVVkHLzoGEDHH8+myX+4vVvvPBzY6BVS9cNpyvEdIY3pgLwei8R6jKGyrYGFyznyqhx
+2v9O5EpojXPz+BXW5GyeCOG1FJzxDq/d8j3eFHuBvPizP4y0+vnYpeW4PEPeEuJ8kmKTdEpENLED
+GhrCYaE3N/c+aImBKXj+fBrStqGq1WVWT5iiSzxXeIlndO5Xp4BsRhM0LvA66r7x9RIR/tEPEOLx
+u6ZWWsFkFRrpTBDjueSjoKp/vnXLKUILzkF8fmNsGLcUTqKcpsLQMeja4zh1FONTNCIYk1Uovcrc
+tAdp+jrRSDCB7AYJKoZIhvcNAQcBoIHeBIHbMIHYMIHVBgsqhkiG9w0BDAoBAqCBnjCBmzBXBgkq
+hkiG9w0BBQ0wSjApBgkqhkiG9w0BBQwwHAQI0uXzqmS6qEwCAggAMAwGCCqGSIb3DQIJBQAwHQYJ
+YIZIAWUDBAEqBBBRmI5Gt+B4tjcRgsEWQ4zYBECwzdjhz94PH6aHUMCJwoQbeSPkLTxQ8J1uBzvX
+vWGvRV9hJl9NE+BRA/oLrr4BAWOV8xwQCJdFHCJsDF1Dl/DvMSUwIwYJKoZIhvcNAQkVMRYEFGPY
+TEM9jHqVVyWk6sN+eZ1pm8EmMEEwMTANBglghkgBZQMEAgEFAAQgirI57Mf/MQTtSUcxMyvGugoV
+wsKZK7T/yUK5dyEsxKUECMPx2Q9pbGD5AgIIAA==`
@@ -0,0 +1,40 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import "sync"
+
+// maxPooledScratch is the capacity above which scratch buffers are left to
+// the garbage collector rather than retained by scratchPool.
+const maxPooledScratch = 64 << 10
+
+// scratchPool holds buffers for temporary data, such as key derivation
+// state and decrypted private keys, which does not outlive the call using
+// it.  Reusing them reduces garbage for servers decoding many files.
+var scratchPool = sync.Pool{
+	New: func() interface{} { return new([]byte) },
+}
+
+// getScratch returns a zeroed buffer of length n from scratchPool.  It
+// must be released with putScratch.
+func getScratch(n int) *[]byte {
+	buf := scratchPool.Get().(*[]byte)
+	if cap(*buf) < n {
+		*buf = make([]byte, n)
+	}
+	*buf = (*buf)[:n]
+	return buf
+}
+
+// putScratch zeroes buf, which may have held key material, and returns it
+// to scratchPool.
+func putScratch(buf *[]byte) {
+	if cap(*buf) > maxPooledScratch {
+		return
+	}
+	clear((*buf)[:cap(*buf)])
+	*buf = (*buf)[:0]
+	scratchPool.Put(buf)
+}
@@ -0,0 +1,37 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"crypto/rand"
+	"testing"
+)
+
+func TestScratchIsZeroed(t *testing.T) {
+	for i := 0; i < 10; i++ {
+		buf := getScratch(64)
+		for j, c := range *buf {
+			if c != 0 {
+				t.Fatalf("scratch buffer byte %d is %#x", j, c)
+			}
+			(*buf)[j] = 0xff
+		}
+		putScratch(buf)
+	}
+}
+
+func BenchmarkDecodeChain(b *testing.B) {
+	key, cert := newTestCertificate(b, "benchmark.example.com", nil, nil)
+	pfxData, err := Encode(rand.Reader, key, cert, nil, "password")
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, _, err := DecodeChain(pfxData, "password"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import "context"
+
+// A ProgressStage identifies what a Progress report counts.
+type ProgressStage int
+
+const (
+	// KeyDerivationStage counts the iterations of a single key
+	// derivation.  Decoding or encoding a file involves several key
+	// derivations, for the MAC and for each encrypted SafeContents and
+	// shrouded key, and each is reported from zero to completion.
+	KeyDerivationStage ProgressStage = iota
+
+	// BagStage counts the SafeBags processed by a decoding operation.
+	BagStage
+)
+
+// A Progress reports how far a long-running operation has got, to the
+// callback configured with Decoder.WithProgress or Encoder.WithProgress.
+type Progress struct {
+	Stage ProgressStage
+	Done  int
+	Total int
+}
+
+// Percent returns the completed fraction of the current stage, from 0 to
+// 100.
+func (p Progress) Percent() int {
+	if p.Total <= 0 {
+		return 100
+	}
+	return int(int64(p.Done) * 100 / int64(p.Total))
+}
+
+// WithProgress returns a copy of dec which calls report as key derivations
+// and SafeBags are processed, so that interactive programs can show that
+// a decode with a high iteration count is not hung.  report is called on
+// the decoding goroutine, at most about a hundred times per key derivation.
+func (dec Decoder) WithProgress(report func(Progress)) *Decoder {
+	dec.progress = report
+	return &dec
+}
+
+// WithProgress returns a copy of enc which calls report as key derivations
+// are processed.  See Decoder.WithProgress.
+func (enc Encoder) WithProgress(report func(Progress)) *Encoder {
+	enc.progress = report
+	return &enc
+}
+
+// kdfMonitor is notified of the progress of key derivations, which it
+// reports, rations, yields during and cancels as configured.  It also
+// carries the external KDF, if any, which replaces them.  A nil
+// *kdfMonitor ignores all notifications, so it can be passed wherever none
+// of these is wanted.
+type kdfMonitor struct {
+	report     func(Progress)
+	yieldEvery int
+	ctx        context.Context
+	limiter    Limiter
+	kdf        KDF
+	cancelled  error
+}
+
+// newKDFMonitor returns a monitor for the given options, or nil if none
+// is set.
+func newKDFMonitor(report func(Progress), yieldEvery int, ctx context.Context, limiter Limiter, kdf KDF) *kdfMonitor {
+	if report == nil && yieldEvery <= 0 && ctx == nil && limiter == nil && kdf == nil {
+		return nil
+	}
+	return &kdfMonitor{report: report, yieldEvery: yieldEvery, ctx: ctx, limiter: limiter, kdf: kdf}
+}
+
+func (dec *Decoder) monitor() *kdfMonitor {
+	return newKDFMonitor(dec.progress, dec.yieldEvery, dec.ctx, dec.limiter, dec.externalKDF)
+}
+
+func (enc *Encoder) monitor() *kdfMonitor {
+	return newKDFMonitor(enc.progress, enc.yieldEvery, enc.ctx, nil, enc.externalKDF)
+}
+
+// iteration is called after each of the total iterations of a key
+// derivation, with done counting from 1.  It returns false if the
+// derivation must be abandoned, in which case err returns the reason.
+func (m *kdfMonitor) iteration(done, total int) bool {
+	if m == nil {
+		return true
+	}
+	if m.report != nil {
+		stride := total / 100
+		if stride == 0 {
+			stride = 1
+		}
+		if done%stride == 0 || done == total {
+			m.report(Progress{Stage: KeyDerivationStage, Done: done, Total: total})
+		}
+	}
+	return m.charge(done, total) && m.pause(done)
+}
+
+// err returns the error which caused a key derivation to be abandoned, or
+// nil if none was.
+func (m *kdfMonitor) err() error {
+	if m == nil {
+		return nil
+	}
+	return m.cancelled
+}
+
+// bagDone is called after the i-th of n SafeBags has been processed.
+func (dec *Decoder) bagDone(i, n int) {
+	if dec.progress != nil {
+		dec.progress(Progress{Stage: BagStage, Done: i + 1, Total: n})
+	}
+}
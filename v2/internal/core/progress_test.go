@@ -0,0 +1,98 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"crypto/rand"
+	"testing"
+)
+
+// progressRecorder collects Progress reports by stage.
+type progressRecorder map[ProgressStage][]Progress
+
+func (r progressRecorder) report(p Progress) {
+	r[p.Stage] = append(r[p.Stage], p)
+}
+
+// checkDerivations checks that key derivation reports count up to their
+// totals, restarting from the beginning for each derivation, and returns
+// the number of complete derivations reported.
+func checkDerivations(t *testing.T, reports []Progress) (completed int) {
+	t.Helper()
+	last := 0
+	for _, p := range reports {
+		if p.Done <= 0 || p.Done > p.Total {
+			t.Fatalf("report %+v is out of range", p)
+		}
+		if p.Done <= last && last != 0 {
+			t.Fatalf("report %+v does not follow %d", p, last)
+		}
+		last = p.Done
+		if p.Done == p.Total {
+			completed++
+			last = 0
+		}
+	}
+	if last != 0 {
+		t.Errorf("final derivation stopped at %d", last)
+	}
+	return completed
+}
+
+func TestProgress(t *testing.T) {
+	key, cert := newTestCertificate(t, "progress.example.com", nil, nil)
+
+	encReports := make(progressRecorder)
+	pfxData, err := DefaultEncoder.WithProgress(encReports.report).Encode(rand.Reader, key, cert, nil, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The MAC, the certificate encryption and the key encryption each
+	// derive a key, and the two encryptions also derive an IV.
+	if n := checkDerivations(t, encReports[KeyDerivationStage]); n != 5 {
+		t.Errorf("Encode reported %d key derivations, want 5", n)
+	}
+	if n := len(encReports[KeyDerivationStage]); n > 5*101 {
+		t.Errorf("Encode made %d reports, want at most %d", n, 5*101)
+	}
+
+	decReports := make(progressRecorder)
+	if _, _, err := DefaultDecoder.WithProgress(decReports.report).Decode(pfxData, "password"); err != nil {
+		t.Fatal(err)
+	}
+	if n := checkDerivations(t, decReports[KeyDerivationStage]); n != 5 {
+		t.Errorf("Decode reported %d key derivations, want 5", n)
+	}
+	bags := decReports[BagStage]
+	if len(bags) != 2 {
+		t.Fatalf("Decode reported %d bags, want 2", len(bags))
+	}
+	for i, p := range bags {
+		if p.Done != i+1 || p.Total != 2 {
+			t.Errorf("bag report %d is %+v", i, p)
+		}
+	}
+
+	if _, _, err := Decode(pfxData, "password"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestProgressPercent(t *testing.T) {
+	for _, test := range []struct {
+		p    Progress
+		want int
+	}{
+		{Progress{Done: 0, Total: 2048}, 0},
+		{Progress{Done: 1024, Total: 2048}, 50},
+		{Progress{Done: 2048, Total: 2048}, 100},
+		{Progress{Done: 1, Total: 3}, 33},
+		{Progress{Done: 0, Total: 0}, 100},
+	} {
+		if got := test.p.Percent(); got != test.want {
+			t.Errorf("%+v.Percent() = %d, want %d", test.p, got, test.want)
+		}
+	}
+}
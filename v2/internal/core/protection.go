@@ -0,0 +1,286 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"strconv"
+
+	"github.com/scholar-ink/go-pkcs12/v2/oids"
+)
+
+// Protection summarizes the cryptographic protection of a PKCS#12 file, as
+// reported by InspectProtection.  Where a file uses several encryption
+// algorithms, the weakest is reported, ranked by cipher, then by PBKDF2
+// pseudorandom function, then by iteration count.  For PBES2 with scrypt,
+// the iteration count is the scrypt cost parameter N.
+type Protection struct {
+	// MACAlgorithm identifies the digest of the integrity MAC.
+	MACAlgorithm  asn1.ObjectIdentifier
+	MACIterations int
+
+	// ContentAlgorithm identifies the encryption algorithm of the
+	// encrypted SafeContents, which usually hold the certificates.  It
+	// is nil if there are none.
+	ContentAlgorithm  asn1.ObjectIdentifier
+	ContentIterations int
+
+	// If ContentAlgorithm is PBES2, ContentScheme identifies its
+	// encryption scheme and ContentKDF its key derivation function, and
+	// ContentPRF identifies the pseudorandom function if that is PBKDF2.
+	// They are nil otherwise.
+	ContentScheme, ContentKDF, ContentPRF asn1.ObjectIdentifier
+
+	// KeyAlgorithm identifies the encryption algorithm of the shrouded
+	// private key bags.  It is nil if there are none.
+	KeyAlgorithm  asn1.ObjectIdentifier
+	KeyIterations int
+
+	// KeyScheme, KeyKDF and KeyPRF are as ContentScheme, ContentKDF and
+	// ContentPRF, for KeyAlgorithm.
+	KeyScheme, KeyKDF, KeyPRF asn1.ObjectIdentifier
+}
+
+// InspectProtection verifies pfxData with password using DefaultDecoder
+// and reports how it is protected.
+func InspectProtection(pfxData []byte, password string) (*Protection, error) {
+	return DefaultDecoder.InspectProtection(pfxData, password)
+}
+
+// InspectProtection is like the package-level InspectProtection function,
+// but uses the options of dec.  It fails for files encrypted with a key
+// derivation function registered with RegisterKeyDerivationFunction, whose
+// cost it cannot read.
+func (dec *Decoder) InspectProtection(pfxData []byte, password string) (*Protection, error) {
+	encodedPassword, err := bmpString(password)
+	if err != nil {
+		return nil, ErrIncorrectPassword
+	}
+
+	pfx := new(pfxPdu)
+	if err := dec.unmarshalPFX(pfxData, pfx); err != nil {
+		return nil, errors.New("pkcs12: error reading P12 data: " + err.Error())
+	}
+	if pfx.Version != 3 {
+		return nil, NotImplementedError("can only decode v3 PFX PDU's")
+	}
+	content, encodedPassword, _, err := dec.verifyIntegrity(pfx, encodedPassword)
+	if err != nil {
+		return nil, err
+	}
+	authenticatedSafe, err := dec.unmarshalAuthenticatedSafe(content)
+	if err != nil {
+		return nil, err
+	}
+
+	var contentPBE, keyPBE *pbeProtection
+	for i, ci := range authenticatedSafe {
+		if dec.reportExtension != nil && isExtension(ci.ContentType) {
+			dec.reportExtension(newExtension(i, ci))
+			continue
+		}
+		if ci.ContentType.Equal(oidEncryptedDataContentType) {
+			var encryptedData encryptedData
+			if err := unmarshal(ci.Content.Bytes, &encryptedData); err != nil {
+				return nil, err
+			}
+			pbe, err := inspectPBE(encryptedData.EncryptedContentInfo.ContentEncryptionAlgorithm)
+			if err != nil {
+				return nil, err
+			}
+			contentPBE = weakerPBE(contentPBE, pbe)
+		}
+
+		// The SafeContents are decrypted to reach the shrouded key
+		// bags, and to check that password opens them.
+		bags, err := dec.getSafeContentsOf(ci, encodedPassword)
+		if err != nil {
+			return nil, err
+		}
+		for _, bag := range bags {
+			if !bag.Id.Equal(oidPKCS8ShroundedKeyBag) {
+				continue
+			}
+			pkinfo := new(encryptedPrivateKeyInfo)
+			if err := unmarshal(bag.Value.Bytes, pkinfo); err != nil {
+				return nil, errors.New("pkcs12: error decoding PKCS#8 shrouded key bag: " + err.Error())
+			}
+			pbe, err := inspectPBE(pkinfo.AlgorithmIdentifier)
+			if err != nil {
+				return nil, err
+			}
+			keyPBE = weakerPBE(keyPBE, pbe)
+		}
+	}
+
+	protection := &Protection{
+		MACAlgorithm:  pfx.MacData.Mac.Algorithm.Algorithm,
+		MACIterations: pfx.MacData.Iterations,
+	}
+	if contentPBE != nil {
+		protection.ContentAlgorithm, protection.ContentIterations = contentPBE.algorithm, contentPBE.iterations
+		protection.ContentScheme, protection.ContentKDF, protection.ContentPRF = contentPBE.scheme, contentPBE.kdf, contentPBE.prf
+	}
+	if keyPBE != nil {
+		protection.KeyAlgorithm, protection.KeyIterations = keyPBE.algorithm, keyPBE.iterations
+		protection.KeyScheme, protection.KeyKDF, protection.KeyPRF = keyPBE.scheme, keyPBE.kdf, keyPBE.prf
+	}
+	return protection, nil
+}
+
+// pbeProtection describes a single password-based encryption, as do the
+// Content and Key fields of Protection.
+type pbeProtection struct {
+	algorithm, scheme, kdf, prf asn1.ObjectIdentifier
+	iterations                  int
+}
+
+// content returns the pbeProtection of the content encryption of p, or nil
+// if there is none.
+func (p *Protection) content() *pbeProtection {
+	if p.ContentAlgorithm == nil {
+		return nil
+	}
+	return &pbeProtection{algorithm: p.ContentAlgorithm, scheme: p.ContentScheme, kdf: p.ContentKDF, prf: p.ContentPRF, iterations: p.ContentIterations}
+}
+
+// key returns the pbeProtection of the key encryption of p, or nil if
+// there is none.
+func (p *Protection) key() *pbeProtection {
+	if p.KeyAlgorithm == nil {
+		return nil
+	}
+	return &pbeProtection{algorithm: p.KeyAlgorithm, scheme: p.KeyScheme, kdf: p.KeyKDF, prf: p.KeyPRF, iterations: p.KeyIterations}
+}
+
+// inspectPBE returns the pbeProtection of the password-based encryption
+// algorithm.
+func inspectPBE(algorithm pkix.AlgorithmIdentifier) (*pbeProtection, error) {
+	pbe := &pbeProtection{algorithm: algorithm.Algorithm}
+	if !algorithm.Algorithm.Equal(oidPBES2) {
+		var params pbeParams
+		if err := unmarshal(algorithm.Parameters.FullBytes, &params); err != nil {
+			return nil, err
+		}
+		pbe.iterations = params.Iterations
+		return pbe, nil
+	}
+
+	var params pbes2Params
+	if err := unmarshal(algorithm.Parameters.FullBytes, &params); err != nil {
+		return nil, err
+	}
+	pbe.scheme, pbe.kdf = params.EncryptionScheme.Algorithm, params.KeyDerivationFunc.Algorithm
+	switch {
+	case pbe.kdf.Equal(oidPBKDF2):
+		var kdfParams pbkdf2Params
+		if err := unmarshal(params.KeyDerivationFunc.Parameters.FullBytes, &kdfParams); err != nil {
+			return nil, err
+		}
+		pbe.iterations, pbe.prf = kdfParams.IterationCount, kdfParams.PRF.Algorithm
+		if len(pbe.prf) == 0 {
+			pbe.prf = oidHmacWithSHA1
+		}
+	case pbe.kdf.Equal(oidScrypt):
+		var kdfParams scryptParams
+		if err := unmarshal(params.KeyDerivationFunc.Parameters.FullBytes, &kdfParams); err != nil {
+			return nil, err
+		}
+		pbe.iterations = kdfParams.CostParameter
+	default:
+		return nil, errors.New("pkcs12: cannot inspect the protection of a file encrypted with key derivation function " + oids.Describe(pbe.kdf) + ", whose cost is unknown to this package")
+	}
+	return pbe, nil
+}
+
+// weakerPBE returns the weaker of weakest, which is nil if there is none
+// yet, and pbe.
+func weakerPBE(weakest, pbe *pbeProtection) *pbeProtection {
+	if weakest == nil || pbe.weakerThan(weakest) {
+		return pbe
+	}
+	return weakest
+}
+
+// weakerThan reports whether p ranks below other, by cipher, then by
+// PBKDF2 pseudorandom function, then by iteration count if both use the
+// same key derivation function.
+func (p *pbeProtection) weakerThan(other *pbeProtection) bool {
+	if strength, otherStrength := encryptionStrength(p.algorithm, p.scheme), encryptionStrength(other.algorithm, other.scheme); strength != otherStrength {
+		return strength < otherStrength
+	}
+	if p.prf != nil && other.prf != nil {
+		if strength, otherStrength := pbes2PRFStrength(p.prf), pbes2PRFStrength(other.prf); strength != otherStrength {
+			return strength < otherStrength
+		}
+	}
+	return p.kdf.Equal(other.kdf) && p.iterations < other.iterations
+}
+
+// describe names the cipher of p.
+func (p *pbeProtection) describe() string {
+	if p.scheme != nil {
+		return oids.Describe(p.algorithm) + " with " + oids.Describe(p.scheme)
+	}
+	return oids.Describe(p.algorithm)
+}
+
+// CheckDowngrade compares the protection of a re-issued PKCS#12 file, next,
+// with that of its predecessor, prev, and returns a *DowngradeError if next
+// has a weaker MAC, cipher or PBKDF2 pseudorandom function, fewer
+// iterations of the same key derivation function, or drops encryption that
+// prev had.  It returns nil if next is protected at least as strongly.
+func CheckDowngrade(prev, next *Protection) error {
+	var reasons []string
+
+	prevMAC, err := macDigestFor(prev.MACAlgorithm)
+	if err != nil {
+		return err
+	}
+	nextMAC, err := macDigestFor(next.MACAlgorithm)
+	if err != nil {
+		return err
+	}
+	if nextMAC.u < prevMAC.u {
+		reasons = append(reasons, "MAC algorithm "+oids.Describe(next.MACAlgorithm)+" is weaker than "+oids.Describe(prev.MACAlgorithm))
+	}
+	if next.MACIterations < prev.MACIterations {
+		reasons = append(reasons, "MAC iterations reduced from "+strconv.Itoa(prev.MACIterations)+" to "+strconv.Itoa(next.MACIterations))
+	}
+
+	reasons = appendEncryptionDowngrades(reasons, "content", prev.content(), next.content())
+	reasons = appendEncryptionDowngrades(reasons, "key", prev.key(), next.key())
+
+	if len(reasons) != 0 {
+		return &DowngradeError{Reasons: reasons}
+	}
+	return nil
+}
+
+// appendEncryptionDowngrades appends to reasons each way in which next, the
+// encryption of what, is weaker than prev.  Either is nil if what is not
+// encrypted.  Iteration counts are only compared if both use the same key
+// derivation function, since the cost of an iteration differs between
+// them.
+func appendEncryptionDowngrades(reasons []string, what string, prev, next *pbeProtection) []string {
+	if prev == nil {
+		return reasons
+	}
+	if next == nil {
+		return append(reasons, what+" is no longer encrypted")
+	}
+	if encryptionStrength(next.algorithm, next.scheme) < encryptionStrength(prev.algorithm, prev.scheme) {
+		reasons = append(reasons, what+" encryption algorithm "+next.describe()+" is weaker than "+prev.describe())
+	}
+	if prev.prf != nil && next.prf != nil && pbes2PRFStrength(next.prf) < pbes2PRFStrength(prev.prf) {
+		reasons = append(reasons, what+" encryption pseudorandom function "+oids.Describe(next.prf)+" is weaker than "+oids.Describe(prev.prf))
+	}
+	if prev.kdf.Equal(next.kdf) && next.iterations < prev.iterations {
+		reasons = append(reasons, what+" encryption iterations reduced from "+strconv.Itoa(prev.iterations)+" to "+strconv.Itoa(next.iterations))
+	}
+	return reasons
+}
@@ -0,0 +1,131 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"crypto/rand"
+	"testing"
+)
+
+func TestCheckDowngrade(t *testing.T) {
+	key, cert := newTestCertificate(t, "downgrade.example.com", nil, nil)
+	inspect := func(enc *Encoder) *Protection {
+		pfxData, err := enc.Encode(rand.Reader, key, cert, nil, "password")
+		if err != nil {
+			t.Fatal(err)
+		}
+		protection, err := InspectProtection(pfxData, "password")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return protection
+	}
+
+	modern := inspect(DefaultEncoder.WithCompatibilityLevel(2024))
+	if !modern.MACAlgorithm.Equal(oidSHA256) || modern.MACIterations != 1 {
+		t.Errorf("unexpected MAC protection %v, %d", modern.MACAlgorithm, modern.MACIterations)
+	}
+	if !modern.ContentAlgorithm.Equal(oidPBEWithSHAAnd3KeyTripleDESCBC) || modern.ContentIterations != 2048 {
+		t.Errorf("unexpected content protection %v, %d", modern.ContentAlgorithm, modern.ContentIterations)
+	}
+	if !modern.KeyAlgorithm.Equal(oidPBEWithSHAAnd3KeyTripleDESCBC) || modern.KeyIterations != 2048 {
+		t.Errorf("unexpected key protection %v, %d", modern.KeyAlgorithm, modern.KeyIterations)
+	}
+	standard := inspect(DefaultEncoder)
+	legacy := inspect(Legacy)
+
+	for _, test := range []struct {
+		name        string
+		prev, next  *Protection
+		wantReasons int
+	}{
+		{"same", standard, standard, 0},
+		{"upgrade", legacy, modern, 0},
+		{"weaker MAC", modern, standard, 1},
+		{"weaker content cipher", standard, legacy, 1},
+		{"weaker MAC and content cipher", modern, legacy, 2},
+		{"fewer iterations", standard, &Protection{MACAlgorithm: oidSHA1, MACIterations: 1, ContentAlgorithm: oidPBEWithSHAAnd3KeyTripleDESCBC, ContentIterations: 1, KeyAlgorithm: oidPBEWithSHAAnd3KeyTripleDESCBC, KeyIterations: 2048}, 1},
+		{"unencrypted key", standard, &Protection{MACAlgorithm: oidSHA1, MACIterations: 1, ContentAlgorithm: oidPBEWithSHAAnd3KeyTripleDESCBC, ContentIterations: 2048}, 1},
+	} {
+		err := CheckDowngrade(test.prev, test.next)
+		if test.wantReasons == 0 {
+			if err != nil {
+				t.Errorf("%s: unexpected error %v", test.name, err)
+			}
+			continue
+		}
+		downgrade, ok := err.(*DowngradeError)
+		if !ok {
+			t.Errorf("%s: got error %v, want *DowngradeError", test.name, err)
+		} else if len(downgrade.Reasons) != test.wantReasons {
+			t.Errorf("%s: got reasons %q, want %d", test.name, downgrade.Reasons, test.wantReasons)
+		}
+	}
+}
+
+func TestCheckDowngradePBES2(t *testing.T) {
+	key, cert := newTestCertificate(t, "downgrade.example.com", nil, nil)
+	inspect := func(enc *Encoder) *Protection {
+		pfxData, err := enc.Encode(rand.Reader, key, cert, nil, "password")
+		if err != nil {
+			t.Fatal(err)
+		}
+		protection, err := InspectProtection(pfxData, "password")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return protection
+	}
+
+	aes256 := inspect(Modern)
+	if !aes256.KeyScheme.Equal(oidAES256CBC) || !aes256.KeyKDF.Equal(oidPBKDF2) || !aes256.KeyPRF.Equal(oidHmacWithSHA256) {
+		t.Errorf("got key protection %v, %v, %v", aes256.KeyScheme, aes256.KeyKDF, aes256.KeyPRF)
+	}
+	if !aes256.ContentScheme.Equal(oidAES256CBC) {
+		t.Errorf("got content scheme %v", aes256.ContentScheme)
+	}
+	aes128 := inspect(Modern.WithAESKeySize(128))
+	scrypt := inspect(Modern.WithScrypt(1024, 8, 1))
+	if !scrypt.KeyKDF.Equal(oidScrypt) || scrypt.KeyPRF != nil {
+		t.Errorf("got scrypt key protection %v, %v", scrypt.KeyKDF, scrypt.KeyPRF)
+	}
+
+	sha1PRF := *aes256
+	sha1PRF.ContentPRF, sha1PRF.KeyPRF = oidHmacWithSHA1, oidHmacWithSHA1
+	magma := *aes256
+	magma.KeyScheme = oidMagmaCTRACPKM
+
+	for _, test := range []struct {
+		name        string
+		prev, next  *Protection
+		wantReasons int
+	}{
+		{"AES-256 to AES-128", aes256, aes128, 2},
+		{"AES-128 to AES-256", aes128, aes256, 0},
+		{"HMAC-SHA-1 PRF", aes256, &sha1PRF, 2},
+		{"Magma", aes256, &magma, 1},
+		// The scrypt cost N is not comparable with PBKDF2 iterations.
+		{"PBKDF2 to scrypt", aes256, scrypt, 0},
+		{"scrypt to PBKDF2", scrypt, aes256, 0},
+	} {
+		err := CheckDowngrade(test.prev, test.next)
+		if test.wantReasons == 0 {
+			if err != nil {
+				t.Errorf("%s: unexpected error %v", test.name, err)
+			}
+			continue
+		}
+		downgrade, ok := err.(*DowngradeError)
+		if !ok {
+			t.Errorf("%s: got error %v, want *DowngradeError", test.name, err)
+		} else if len(downgrade.Reasons) != test.wantReasons {
+			t.Errorf("%s: got reasons %q, want %d", test.name, downgrade.Reasons, test.wantReasons)
+		}
+	}
+
+	if strength := encryptionStrength(oidPBES2, oidMagmaCTRACPKM); strength >= encryptionStrength(oidPBES2, oidAES128CBC) {
+		t.Errorf("Magma, with a 64-bit block, is credited %d bits", strength)
+	}
+}
@@ -0,0 +1,60 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"crypto/cipher"
+	"crypto/rc4"
+	"crypto/sha1"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+)
+
+// The RC4 schemes of RFC 7292, appendix C, which exports from very old
+// Windows and Netscape versions use.
+var (
+	oidPBEWithSHAAnd128BitRC4 = asn1.ObjectIdentifier([]int{1, 2, 840, 113549, 1, 12, 1, 1})
+	oidPBEWithSHAAnd40BitRC4  = asn1.ObjectIdentifier([]int{1, 2, 840, 113549, 1, 12, 1, 2})
+)
+
+// isStreamPBE reports whether algorithm is a PKCS#12 PBE scheme with a
+// stream cipher, which has neither an IV nor padding.
+func isStreamPBE(algorithm asn1.ObjectIdentifier) bool {
+	return algorithm.Equal(oidPBEWithSHAAnd128BitRC4) || algorithm.Equal(oidPBEWithSHAAnd40BitRC4)
+}
+
+// pbeStreamFor returns the stream cipher of the RC4 PBE algorithm, keyed
+// with the PKCS#12 KDF.
+func pbeStreamFor(algorithm pkix.AlgorithmIdentifier, password []byte, m *kdfMonitor) (cipher.Stream, error) {
+	keyLen := 16
+	if algorithm.Algorithm.Equal(oidPBEWithSHAAnd40BitRC4) {
+		keyLen = 5
+	}
+
+	var params pbeParams
+	if err := unmarshal(algorithm.Parameters.FullBytes, &params); err != nil {
+		return nil, err
+	}
+	key := pbkdf(sha1.New, 20, 64, params.Salt, password, params.Iterations, 1, keyLen, m)
+	if err := m.err(); err != nil {
+		return nil, err
+	}
+	return rc4.NewCipher(key)
+}
+
+// streamDecrypt decrypts encrypted with the RC4 PBE algorithm, decrypting
+// into dst if it has enough capacity.
+func streamDecrypt(dst []byte, algorithm pkix.AlgorithmIdentifier, encrypted, password []byte, m *kdfMonitor) ([]byte, error) {
+	stream, err := pbeStreamFor(algorithm, password, m)
+	if err != nil {
+		return nil, err
+	}
+	if cap(dst) < len(encrypted) {
+		dst = make([]byte, len(encrypted))
+	}
+	decrypted := dst[:len(encrypted)]
+	stream.XORKeyStream(decrypted, encrypted)
+	return decrypted, nil
+}
@@ -0,0 +1,63 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"crypto/ecdsa"
+	"encoding/base64"
+	"testing"
+)
+
+// openSSLRC4TestData was produced by "openssl pkcs12 -export -legacy" of
+// OpenSSL 3.0 with "-keypbe PBE-SHA1-RC4-128 -certpbe PBE-SHA1-RC4-40" and
+// the password "password", for the identity of openSSL3TestData.
+const openSSLRC4TestData = `MIIDjAIBAzCCA1IGCSqGSIb3DQEHAaCCA0MEggM/MIIDOzCCAjgGCSqGSIb3DQEHBqCCAikwggIl
+AgEAMIICHgYJKoZIhvcNAQcBMBwGCiqGSIb3DQEMAQIwDgQIEtw/bPEkMwACAggAgIIB8bCuajoJ
+8zQyg5upRJhVbc/YCU04E+pBOsB9xieDzqv3R9zicxSZcuoS02R2f47H/Ezy/jeTloKEY6PlKtki
+71Y91qrfgpxupHyTfxkuL/7ljxkQSMmS0NCE8Lze7tc1OiMLYFHyYG72NSGLWXoK1BtdWa6JlR6M
+zc9MF5w1DoZWmC7SIiK3L7+zNvtwVZtFr1hhY2v1mqrBqrMKgxxSHNe9M3IDdtLbL3zLnSZpm0Bc
+UwlKy2c98oAVEc4XIHSH+Z+IG6Ow9SmrX2QC7Lbt7oVTAiIQd7PPWa/KYmUeTtf5xpQo4kZET03+
+tb5ukWFiayli0fy4zxoRVIBzpLQ25i2gERWfd4ob0frLDAM66pQygelpYLRHDkDkIXKqt/K0+XT/
+DWeQQfCcpWc8EYmrTL/Jl0ZrgCW+CmPdZ9vcOlxrH3ymbz1xva6Akpv1zbyjchl/s6owFtM5KWBE
+jyhNHFjH8gZHmXbIUt/YzQznDKqXQ/7ZFjy9Fz7rWCBxU+f7doB1Y5y7i0jsbdl3uub5cPr3JsqY
+h0oC5P5THk5qhNM9CUvYVLoGCnNsQ3H89EXzdCbstWNop+QE0DCQfNHZt/6f/gWvLTlxXjwen9pY
+l3ehNpdE/7lzhgYywEk1lS5kTQU0BlMjLz4C8ET2b6GyLUcGMIH8BgkqhkiG9w0BBwGgge4Egesw
+gegwgeUGCyqGSIb3DQEMCgECoIGuMIGrMBwGCiqGSIb3DQEMAQEwDgQIbeLlg+RcU6ACAggABIGK
+7EHdeC215snjwIHq6i29nXdhX/xM9cSwrqWBCi5msUZNM1L9Gf+SpbBT1qrqjbtk14ynVUGwHggC
+FsdzvArmCxXZe4rIXUf7pCMx4ncpuIqVTQWMfcASw/ZQ32Riju4rJo4WjweW+cLymV+ild4ye02b
+ylmO9DzEIEOtQnQZLDa3S2iTrnn4dkijMSUwIwYJKoZIhvcNAQkVMRYEFFBDwdf6x8mNxxQXrpa4
+iBmFGREWMDEwITAJBgUrDgMCGgUABBQDj7Kw8R/Zi63bYnlcNZYYur0lOwQItnLd47Yq4WACAggA`
+
+func TestRC4(t *testing.T) {
+	p12, _ := base64.StdEncoding.DecodeString(openSSLRC4TestData)
+	if _, _, err := Decode(p12, "password"); err == nil {
+		t.Error("decoded RC4 without WithAllowInsecure")
+	} else if _, ok := err.(NotImplementedError); !ok {
+		t.Errorf("got error %v, want a NotImplementedError", err)
+	}
+
+	dec := DefaultDecoder.WithAllowInsecure(true)
+	privateKey, certificate, err := dec.Decode(p12, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if certificate.Subject.CommonName != "openssl3.example.com" {
+		t.Errorf("got certificate for %q", certificate.Subject.CommonName)
+	}
+	if key, ok := privateKey.(*ecdsa.PrivateKey); !ok || !publicKeyMatches(key.Public(), certificate) {
+		t.Errorf("got the wrong private key %T", privateKey)
+	}
+	if _, _, err := dec.Decode(p12, "wrong"); err != ErrIncorrectPassword {
+		t.Errorf("got error %v for the wrong password", err)
+	}
+
+	protection, err := dec.InspectProtection(p12, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !protection.ContentAlgorithm.Equal(oidPBEWithSHAAnd40BitRC4) || !protection.KeyAlgorithm.Equal(oidPBEWithSHAAnd128BitRC4) {
+		t.Errorf("got protection %+v", protection)
+	}
+}
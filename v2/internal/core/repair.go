@@ -0,0 +1,218 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"errors"
+	"strconv"
+
+	"github.com/scholar-ink/go-pkcs12/v2/oids"
+)
+
+// RepairOptions configures Repair.  The zero value, and a nil
+// *RepairOptions, apply only the repairs that are safe to make
+// automatically.
+type RepairOptions struct {
+	// IgnoreMAC skips verification of a MAC which is structurally intact,
+	// for files whose MAC is corrupted but whose contents are not.  The
+	// password is then checked only by decrypting the contents.
+	IgnoreMAC bool
+}
+
+// A RepairResult holds what Repair could salvage from a damaged file.
+type RepairResult struct {
+	PrivateKeys  []interface{}
+	Certificates []*x509.Certificate
+	CRLs         []*x509.RevocationList
+
+	// Repairs describes each corruption which was worked around.
+	Repairs []string
+
+	// Errors describes each part of the file which could not be
+	// recovered.
+	Errors []error
+}
+
+// Repair recovers as many private keys, certificates and CRLs as possible
+// from a PKCS#12 file which cannot be decoded because of common
+// corruptions:
+//
+//   - data following the PFX, such as padding added by file transfers;
+//   - an outer length which does not match the size of the file;
+//   - a MacData which is truncated or otherwise unreadable, in which case
+//     the integrity of the file is not verified;
+//   - zero padding after a SafeContents;
+//   - individual SafeContents or SafeBags which cannot be decrypted or
+//     parsed, which are skipped.
+//
+// Shrouded and plain key bags, certificate and CRL bags, and the compressed
+// bags of Encoder.WithBagCompression are recovered.  Bags of any other
+// type are skipped, and each one is reported in Errors.
+//
+// Repair returns an error only if the authenticated safe itself cannot be
+// read, or if an intact MAC does not verify with password.  Its results
+// come from a damaged file and should be treated with suspicion; it is
+// intended for forensic and recovery use, not as a lenient Decode.
+func Repair(pfxData []byte, password string, opts *RepairOptions) (*RepairResult, error) {
+	if opts == nil {
+		opts = new(RepairOptions)
+	}
+	encodedPassword, err := bmpString(password)
+	if err != nil {
+		return nil, err
+	}
+
+	result := new(RepairResult)
+	body, err := repairOuterSequence(pfxData, result)
+	if err != nil {
+		return nil, err
+	}
+
+	var version int
+	if body, err = asn1.Unmarshal(body, &version); err != nil {
+		return nil, errors.New("pkcs12: error reading P12 data: " + err.Error())
+	}
+	if version != 3 {
+		return nil, NotImplementedError("can only decode v3 PFX PDU's")
+	}
+	var authSafe contentInfo
+	if body, err = asn1.Unmarshal(body, &authSafe); err != nil {
+		return nil, errors.New("pkcs12: error reading P12 data: " + err.Error())
+	}
+	if !authSafe.ContentType.Equal(oidDataContentType) {
+		return nil, NotImplementedError("only password integrity mode can be repaired")
+	}
+	var content []byte
+	if _, err := asn1.Unmarshal(authSafe.Content.Bytes, &content); err != nil {
+		return nil, errors.New("pkcs12: error reading authenticated safe: " + err.Error())
+	}
+
+	var md macData
+	switch _, err := asn1.Unmarshal(body, &md); {
+	case len(body) == 0:
+		result.Repairs = append(result.Repairs, "no MAC present, integrity not verified")
+	case err != nil:
+		result.Repairs = append(result.Repairs, "MAC data unreadable, integrity not verified")
+	case opts.IgnoreMAC:
+		result.Repairs = append(result.Repairs, "MAC ignored, integrity not verified")
+	default:
+		if err := verifyMac(&md, content, encodedPassword, nil); err != nil {
+			if err != ErrIncorrectPassword || password != "" {
+				return nil, err
+			}
+			if err := verifyMac(&md, content, nil, nil); err != nil {
+				return nil, err
+			}
+			encodedPassword = nil
+		}
+	}
+
+	var authenticatedSafe []contentInfo
+	if _, err := asn1.Unmarshal(content, &authenticatedSafe); err != nil {
+		return nil, errors.New("pkcs12: error reading authenticated safe: " + err.Error())
+	}
+
+	dec := DefaultDecoder.WithTrailingZeroPadding(true).WithEmptyContainers(nil)
+	decompressLimit := defaultMaxDecompressedSize
+	for i, ci := range authenticatedSafe {
+		where := "SafeContents " + strconv.Itoa(i)
+		bags, err := dec.getSafeContentsOf(ci, encodedPassword)
+		if err != nil {
+			result.Errors = append(result.Errors, errors.New(where+": "+err.Error()))
+			continue
+		}
+		for j := range bags {
+			where := where + ", SafeBag " + strconv.Itoa(j)
+			bag := &bags[j]
+			if bag.Id.Equal(oidCompressedBag) {
+				bagType, value, err := decompressBag(bag.Value.Bytes, decompressLimit)
+				if err != nil {
+					result.Errors = append(result.Errors, errors.New(where+": "+err.Error()))
+					continue
+				}
+				decompressLimit -= len(value)
+				bag.Id = bagType
+				bag.Value = asn1.RawValue{Class: 2, Tag: 0, IsCompound: true, Bytes: value}
+			}
+			switch {
+			case bag.Id.Equal(oidCertBag):
+				cert, err := parseCertBag(bag.Value.Bytes)
+				if err != nil {
+					result.Errors = append(result.Errors, errors.New(where+": "+err.Error()))
+					continue
+				}
+				result.Certificates = append(result.Certificates, cert)
+			case bag.Id.Equal(oidCRLBag):
+				crl, err := parseCRLBag(bag.Value.Bytes)
+				if err != nil {
+					result.Errors = append(result.Errors, errors.New(where+": "+err.Error()))
+					continue
+				}
+				result.CRLs = append(result.CRLs, crl)
+			case bag.Id.Equal(oidPKCS8ShroundedKeyBag), bag.Id.Equal(oidKeyBag):
+				key, err := dec.decodeKeyBag(bag, encodedPassword)
+				if err != nil {
+					result.Errors = append(result.Errors, errors.New(where+": "+err.Error()))
+					continue
+				}
+				result.PrivateKeys = append(result.PrivateKeys, key)
+			default:
+				result.Errors = append(result.Errors, errors.New(where+": pkcs12: "+oids.Name(bag.Id)+" bags are not supported"))
+			}
+		}
+	}
+	return result, nil
+}
+
+// repairOuterSequence returns the contents of the outermost SEQUENCE of
+// pfxData, working around trailing data and a wrong length.
+func repairOuterSequence(pfxData []byte, result *RepairResult) ([]byte, error) {
+	if len(pfxData) < 2 || pfxData[0] != 0x30 {
+		return nil, errors.New("pkcs12: error reading P12 data: not a SEQUENCE")
+	}
+
+	headerLen, length := 2, int(pfxData[1])
+	if pfxData[1]&0x80 != 0 {
+		n := int(pfxData[1] & 0x7f)
+		if n == 0 || n > 4 || len(pfxData) < 2+n {
+			return nil, errors.New("pkcs12: error reading P12 data: unsupported length")
+		}
+		length = 0
+		for _, b := range pfxData[2 : 2+n] {
+			length = length<<8 | int(b)
+		}
+		headerLen += n
+	}
+
+	rest := pfxData[headerLen:]
+	switch {
+	case length == len(rest):
+		return rest, nil
+	case length < len(rest) && !isPFXBody(rest) && isPFXBody(rest[:length]):
+		result.Repairs = append(result.Repairs, "ignored "+strconv.Itoa(len(rest)-length)+" bytes following the PFX")
+		return rest[:length], nil
+	default:
+		result.Repairs = append(result.Repairs, "outer length "+strconv.Itoa(length)+" does not match the "+strconv.Itoa(len(rest))+" bytes present")
+		return rest, nil
+	}
+}
+
+// isPFXBody reports whether body consists of exactly a PFX version, an
+// authenticated safe, and an optional MacData.
+func isPFXBody(body []byte) bool {
+	var version int
+	var authSafe contentInfo
+	var md macData
+	rest, err := asn1.Unmarshal(body, &version)
+	if err == nil {
+		rest, err = asn1.Unmarshal(rest, &authSafe)
+	}
+	if err == nil && len(rest) > 0 {
+		rest, err = asn1.Unmarshal(rest, &md)
+	}
+	return err == nil && len(rest) == 0
+}
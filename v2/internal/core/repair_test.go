@@ -0,0 +1,166 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/asn1"
+	"strings"
+	"testing"
+)
+
+func TestRepair(t *testing.T) {
+	caKey, ca := newTestCertificate(t, "Repair CA", nil, nil)
+	key, cert := newTestCertificate(t, "repair.example.com", ca, caKey)
+	pfxData, err := Encode(rand.Reader, key, cert, []*x509.Certificate{ca}, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	macData, err := rawMacData(pfxData)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// withOuterLength returns pfxData with its three-byte long-form
+	// length replaced.
+	withOuterLength := func(n int) []byte {
+		if pfxData[1] != 0x82 {
+			t.Fatalf("unexpected outer header %x", pfxData[:2])
+		}
+		data := append([]byte(nil), pfxData...)
+		data[2], data[3] = byte(n>>8), byte(n)
+		return data
+	}
+	bodyLen := len(pfxData) - 4
+
+	for _, test := range []struct {
+		name    string
+		data    []byte
+		repairs int
+	}{
+		{"intact", pfxData, 0},
+		{"stray padding", append(append([]byte(nil), pfxData...), 0, 0, 0, 0), 1},
+		{"wrong outer length", withOuterLength(bodyLen + 100), 1},
+		{"short outer length", withOuterLength(bodyLen - 10), 1},
+		{"truncated MAC", pfxData[:len(pfxData)-len(macData)/2], 2},
+		{"missing MAC", withOuterLength(bodyLen - len(macData))[:len(pfxData)-len(macData)], 1},
+	} {
+		if test.repairs > 0 {
+			if _, _, err := Decode(test.data, "password"); err == nil {
+				t.Errorf("%s: Decode accepted the corrupted file", test.name)
+			}
+		}
+
+		result, err := Repair(test.data, "password", nil)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if len(result.Repairs) != test.repairs {
+			t.Errorf("%s: got repairs %q", test.name, result.Repairs)
+		}
+		if len(result.Errors) != 0 {
+			t.Errorf("%s: got errors %v", test.name, result.Errors)
+		}
+		if len(result.PrivateKeys) != 1 || !key.Equal(result.PrivateKeys[0]) {
+			t.Errorf("%s: private key not recovered", test.name)
+		}
+		if len(result.Certificates) != 2 || !result.Certificates[0].Equal(cert) || !result.Certificates[1].Equal(ca) {
+			t.Errorf("%s: certificates not recovered", test.name)
+		}
+	}
+
+	if _, err := Repair(pfxData, "wrong", nil); err != ErrIncorrectPassword {
+		t.Errorf("got error %v with the wrong password, want ErrIncorrectPassword", err)
+	}
+
+	// A corrupted MAC can be ignored; the corrupted key bag is skipped
+	// while the certificates are still recovered.
+	corrupted := rewriteAuthenticatedSafe(t, pfxData, "password", func(authenticatedSafe []contentInfo) []contentInfo {
+		var bags []safeBag
+		if err := unmarshal(safeContentsData(t, authenticatedSafe[1]), &bags); err != nil {
+			t.Fatal(err)
+		}
+		var pkinfo encryptedPrivateKeyInfo
+		if err := unmarshal(bags[0].Value.Bytes, &pkinfo); err != nil {
+			t.Fatal(err)
+		}
+		pkinfo.EncryptedData[len(pkinfo.EncryptedData)-1] ^= 0xff
+		bags[0].Value = asn1.RawValue{Class: 2, Tag: 0, IsCompound: true}
+		var err error
+		if bags[0].Value.Bytes, err = asn1.Marshal(pkinfo); err != nil {
+			t.Fatal(err)
+		}
+		data, err := asn1.Marshal(bags)
+		if err != nil {
+			t.Fatal(err)
+		}
+		setSafeContentsData(t, &authenticatedSafe[1], data)
+		return authenticatedSafe
+	})
+	var pfx pfxPdu
+	if err := unmarshal(corrupted, &pfx); err != nil {
+		t.Fatal(err)
+	}
+	pfx.MacData.Mac.Digest[0] ^= 0xff
+	if corrupted, err = asn1.Marshal(pfx); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Repair(corrupted, "password", nil); err != ErrIncorrectPassword {
+		t.Errorf("got error %v with a corrupted MAC, want ErrIncorrectPassword", err)
+	}
+	result, err := Repair(corrupted, "password", &RepairOptions{IgnoreMAC: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Repairs) != 1 || len(result.Errors) != 1 || len(result.PrivateKeys) != 0 || len(result.Certificates) != 2 {
+		t.Errorf("got %d repairs, %d errors, %d keys and %d certificates", len(result.Repairs), len(result.Errors), len(result.PrivateKeys), len(result.Certificates))
+	}
+}
+
+func TestRepairBagTypes(t *testing.T) {
+	// Plain key bags, as written by MinimalRouter, are recovered.
+	key, cert := newTestCertificate(t, "router.example.com", nil, nil)
+	pfxData, err := MinimalRouter.Encode(rand.Reader, key, cert, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := Repair(pfxData, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Errors) != 0 || len(result.PrivateKeys) != 1 || !key.Equal(result.PrivateKeys[0]) {
+		t.Errorf("plain key bag: got errors %v and %d keys", result.Errors, len(result.PrivateKeys))
+	}
+
+	// Compressed certificate and CRL bags are recovered.
+	ca, crl := newTestCRLIssuer(t, "CA")
+	large := newCompressibleCertificate(t)
+	pfxData, err = Modern.WithBagCompression(256).EncodeTrustStoreWithCRLs(rand.Reader, []*x509.Certificate{ca, large}, []*x509.RevocationList{crl}, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result, err = Repair(pfxData, "password", nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Errors) != 0 || len(result.Certificates) != 2 || !result.Certificates[1].Equal(large) || len(result.CRLs) != 1 {
+		t.Errorf("compressed bags: got errors %v, %d certificates and %d CRLs", result.Errors, len(result.Certificates), len(result.CRLs))
+	}
+
+	// Other bags are reported rather than silently dropped.
+	secretBag := safeBag{Id: asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 10, 1, 5}}
+	secretBag.Value = asn1.RawValue{Class: 2, Tag: 0, IsCompound: true, Bytes: []byte{0x30, 0}}
+	if pfxData, err = Modern.encodeTrustStoreBags(rand.Reader, []safeBag{secretBag}, "password"); err != nil {
+		t.Fatal(err)
+	}
+	if result, err = Repair(pfxData, "password", nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Errors) != 1 || !strings.Contains(result.Errors[0].Error(), "secretBag") {
+		t.Errorf("secret bag: got errors %v", result.Errors)
+	}
+}
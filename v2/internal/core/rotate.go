@@ -0,0 +1,95 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"crypto/rand"
+	"errors"
+	"io"
+)
+
+// RotateMACOnly replaces the integrity password of pfxData with newPassword.
+// The MAC is verified with oldPassword and then recomputed over the
+// unchanged authenticated safe with newPassword, a fresh salt, and the
+// original digest algorithm and iteration count.  Any fields which follow
+// the iteration count in the MacData are carried over.  The encrypted
+// contents, including shrouded keys, are left byte-for-byte untouched and so
+// remain protected by whatever privacy password they were created with.
+//
+// This is intended for deployments where the privacy and integrity
+// passwords are managed separately.  Note that most software, including
+// Decode, assumes that both passwords are the same.
+//
+// The new salt is drawn from crypto/rand.  See Encoder.RotateMACOnly.
+func RotateMACOnly(pfxData []byte, oldPassword, newPassword string) ([]byte, error) {
+	return DefaultEncoder.RotateMACOnly(rand.Reader, pfxData, oldPassword, newPassword)
+}
+
+// RotateMACOnly is like the package-level RotateMACOnly function, but draws
+// the new salt from rand, or from the fixed stream if enc has fixed
+// randomness.  The digest algorithm and iteration count are still those of
+// the original MAC, not those of enc.
+func (enc *Encoder) RotateMACOnly(rand io.Reader, pfxData []byte, oldPassword, newPassword string) ([]byte, error) {
+	encodedOld, err := bmpString(oldPassword)
+	if err != nil {
+		return nil, err
+	}
+	encodedNew, err := bmpString(newPassword)
+	if err != nil {
+		return nil, err
+	}
+
+	pfx := new(pfxPdu)
+	if err := unmarshal(pfxData, pfx); err != nil {
+		return nil, errors.New("pkcs12: error reading P12 data: " + err.Error())
+	}
+	if pfx.Version != 3 {
+		return nil, NotImplementedError("can only decode v3 PFX PDU's")
+	}
+	if !pfx.AuthSafe.ContentType.Equal(oidDataContentType) {
+		return nil, NotImplementedError("only password-protected PFX is implemented")
+	}
+	if len(pfx.MacData.Mac.Algorithm.Algorithm) == 0 {
+		return nil, errors.New("pkcs12: no MAC in data")
+	}
+	raw, err := rawMacData(pfxData)
+	if err != nil {
+		return nil, errors.New("pkcs12: error reading P12 data: " + err.Error())
+	}
+	trailer, err := macDataTrailer(raw)
+	if err != nil {
+		return nil, errors.New("pkcs12: error reading MAC data: " + err.Error())
+	}
+
+	var authenticatedSafe []byte
+	if err := unmarshal(pfx.AuthSafe.Content.Bytes, &authenticatedSafe); err != nil {
+		return nil, err
+	}
+
+	if err := verifyMac(&pfx.MacData, authenticatedSafe, encodedOld, nil); err != nil {
+		if err != ErrIncorrectPassword || oldPassword != "" {
+			return nil, err
+		}
+		// some implementations use an empty byte array
+		// for the empty string password
+		if err := verifyMac(&pfx.MacData, authenticatedSafe, nil, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	pfx.MacData.MacSalt = make([]byte, len(pfx.MacData.MacSalt))
+	if _, err := io.ReadFull(enc.entropy(rand), pfx.MacData.MacSalt); err != nil {
+		return nil, err
+	}
+	if err := computeMac(&pfx.MacData, authenticatedSafe, encodedNew, nil); err != nil {
+		return nil, err
+	}
+
+	rotated, err := marshalPFXWithTrailer(pfx, trailer)
+	if err != nil {
+		return nil, errors.New("pkcs12: error writing P12 data: " + err.Error())
+	}
+	return rotated, nil
+}
@@ -0,0 +1,103 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"bytes"
+	"crypto/rand"
+	"testing"
+)
+
+func TestRotateMACOnly(t *testing.T) {
+	key, cert := newTestCertificate(t, "rotate.example.com", nil, nil)
+	pfxData, err := Encode(rand.Reader, key, cert, nil, "privacy")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := RotateMACOnly(pfxData, "wrong", "integrity"); err != ErrIncorrectPassword {
+		t.Fatalf("got error %v, want ErrIncorrectPassword", err)
+	}
+
+	rotated, err := RotateMACOnly(pfxData, "privacy", "integrity")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var before, after pfxPdu
+	if err := unmarshal(pfxData, &before); err != nil {
+		t.Fatal(err)
+	}
+	if err := unmarshal(rotated, &after); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(before.AuthSafe.Content.FullBytes, after.AuthSafe.Content.FullBytes) {
+		t.Error("authenticated safe was modified")
+	}
+	if after.MacData.Iterations != before.MacData.Iterations || !after.MacData.Mac.Algorithm.Algorithm.Equal(before.MacData.Mac.Algorithm.Algorithm) {
+		t.Error("MAC parameters were modified")
+	}
+
+	var content []byte
+	if err := unmarshal(after.AuthSafe.Content.Bytes, &content); err != nil {
+		t.Fatal(err)
+	}
+	integrity, _ := bmpString("integrity")
+	if err := verifyMac(&after.MacData, content, integrity, nil); err != nil {
+		t.Errorf("new MAC does not verify with new password: %v", err)
+	}
+	if _, _, err := Decode(rotated, "privacy"); err != ErrIncorrectPassword {
+		t.Errorf("old password still verifies MAC: %v", err)
+	}
+
+	// Rotating back restores a file readable with a single password.
+	restored, err := RotateMACOnly(rotated, "integrity", "privacy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := Decode(restored, "privacy"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestEncoderRotateMACOnly(t *testing.T) {
+	key, cert := newTestCertificate(t, "rotate.example.com", nil, nil)
+	pfxData, err := Encode(rand.Reader, key, cert, nil, "privacy")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	enc := DefaultEncoder.WithFixedRandomness([]byte("seed"))
+	first, err := enc.RotateMACOnly(failingReader{}, pfxData, "privacy", "integrity")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := enc.RotateMACOnly(nil, pfxData, "privacy", "integrity")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(first, second) {
+		t.Error("rotating with fixed randomness is not deterministic")
+	}
+
+	if _, err := DefaultEncoder.RotateMACOnly(failingReader{}, pfxData, "privacy", "integrity"); err == nil {
+		t.Error("expected error from failing rand")
+	}
+
+	var pfx pfxPdu
+	if err := unmarshal(pfxData, &pfx); err != nil {
+		t.Fatal(err)
+	}
+	pfx.Version = 2
+	v2Data, err := marshalPFXWithTrailer(&pfx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := RotateMACOnly(v2Data, "privacy", "integrity"); err == nil {
+		t.Error("expected error for a version 2 PFX")
+	} else if _, ok := err.(NotImplementedError); !ok {
+		t.Errorf("got error %v, want NotImplementedError", err)
+	}
+}
@@ -0,0 +1,51 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"errors"
+)
+
+// MinimalRouter produces the minimal layout exported by some embedded
+// routers, such as MikroTik RouterOS, which is also the layout they most
+// reliably import: a single unencrypted SafeContents holding a plain
+// keyBag followed by the certificate bags, and no MAC.  The LocalKeyId and
+// friendlyName attributes are set as by Modern.
+//
+// Nothing in its output is protected, so MinimalRouter only accepts the
+// empty password, and its output must be kept confidential by other means.
+// Files in this layout are read by a Decoder configured with
+// WithMissingMAC.
+var MinimalRouter = &Encoder{
+	minimalProfile: true,
+}
+
+// WithMissingMAC returns a copy of dec which, if allow is true, decodes
+// files in password integrity mode which have no MAC at all, such as those
+// produced by MinimalRouter and by the routers it emulates.  The integrity
+// of such files is not verified, and VerifyIntegrity reports that nothing
+// was checked.  A MAC which is present is still verified.
+func (dec Decoder) WithMissingMAC(allow bool) *Decoder {
+	dec.allowMissingMAC = allow
+	return &dec
+}
+
+// checkUnprotectedPassword returns an error if enc produces unprotected
+// files but encodedPassword is not the empty password.
+func (enc *Encoder) checkUnprotectedPassword(encodedPassword []byte) error {
+	if enc.minimalProfile && len(encodedPassword) > 2 {
+		return errors.New("pkcs12: the output of MinimalRouter is not protected, so the password must be empty")
+	}
+	return nil
+}
+
+// contentPassword returns the password with which enc encrypts
+// SafeContents, which is nil, for no encryption, if enc is MinimalRouter.
+func (enc *Encoder) contentPassword(encodedPassword []byte) []byte {
+	if enc.minimalProfile {
+		return nil
+	}
+	return encodedPassword
+}
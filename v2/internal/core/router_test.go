@@ -0,0 +1,123 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"testing"
+)
+
+func TestDecodeMinimalRouter(t *testing.T) {
+	pfxData, _ := base64.StdEncoding.DecodeString(minimalRouterTestData)
+	if _, _, err := Decode(pfxData, ""); err == nil {
+		t.Fatal("decoded a file without a MAC by default")
+	}
+
+	dec := DefaultDecoder.WithMissingMAC(true)
+	privateKey, certificate, caCerts, err := dec.DecodeChainWithCAs(pfxData, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, ok := privateKey.(*ecdsa.PrivateKey)
+	if !ok {
+		t.Fatalf("decoded a %T, want an *ecdsa.PrivateKey", privateKey)
+	}
+	if certificate.Subject.CommonName != "router.example.com" || len(caCerts) != 0 {
+		t.Errorf("got certificate %q and %d CA certificates", certificate.Subject.CommonName, len(caCerts))
+	}
+	if !publicKeyMatches(key.Public(), certificate) {
+		t.Error("key does not match the certificate")
+	}
+	if checked, err := dec.VerifyIntegrity(pfxData, ""); err != nil || checked != 0 {
+		t.Errorf("VerifyIntegrity = %v, %v, want nothing checked", checked, err)
+	}
+	if _, err := dec.ToPEM(pfxData, ""); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestEncodeMinimalRouter(t *testing.T) {
+	rootKey, root := newTestCertificate(t, "root", nil, nil)
+	key, leaf := newTestCertificate(t, "router.example.com", root, rootKey)
+
+	if _, err := MinimalRouter.Encode(rand.Reader, key, leaf, nil, "password"); err == nil {
+		t.Error("MinimalRouter encoded with a password")
+	}
+	pfxData, err := MinimalRouter.Encode(rand.Reader, key, leaf, []*x509.Certificate{root}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pfx := new(pfxPdu)
+	if err := unmarshal(pfxData, pfx); err != nil {
+		t.Fatal(err)
+	}
+	if len(pfx.MacData.Mac.Algorithm.Algorithm) != 0 {
+		t.Error("MinimalRouter output has a MAC")
+	}
+	var content []byte
+	if err := unmarshal(pfx.AuthSafe.Content.Bytes, &content); err != nil {
+		t.Fatal(err)
+	}
+	authenticatedSafe, err := DefaultDecoder.unmarshalAuthenticatedSafe(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(authenticatedSafe) != 1 || !authenticatedSafe[0].ContentType.Equal(oidDataContentType) {
+		t.Fatalf("got %d SafeContents, want a single unencrypted one", len(authenticatedSafe))
+	}
+	bags, err := DefaultDecoder.getSafeContentsOf(authenticatedSafe[0], nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bags) != 3 || !bags[0].Id.Equal(oidKeyBag) || !bags[1].Id.Equal(oidCertBag) || !bags[2].Id.Equal(oidCertBag) {
+		t.Fatalf("got bags %v, want a keyBag followed by two certBags", bags)
+	}
+
+	dec := DefaultDecoder.WithMissingMAC(true)
+	decodedKey, certificate, caCerts, err := dec.DecodeChainWithCAs(pfxData, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !key.Equal(decodedKey) || !certificate.Equal(leaf) || len(caCerts) != 1 || !caCerts[0].Equal(root) {
+		t.Error("decoded identity does not match")
+	}
+
+	pfxData, err = MinimalRouter.EncodeTrustStore(rand.Reader, []*x509.Certificate{root}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if certs, err := dec.DecodeTrustStore(pfxData, ""); err != nil {
+		t.Error(err)
+	} else if len(certs) != 1 || !certs[0].Equal(root) {
+		t.Error("decoded trust store does not match")
+	}
+}
+
+// minimalRouterTestData is the output of
+//
+//	openssl genpkey -algorithm EC -pkeyopt ec_paramgen_curve:P-256 -out router.key
+//	openssl req -new -x509 -key router.key -subj /CN=router.example.com -days 36500 -out router.crt
+//	openssl pkcs12 -export -inkey router.key -in router.crt -keypbe NONE -certpbe NONE -nomac -passout pass:
+//
+// with its two SafeContents merged into one holding the keyBag followed by
+// the certBag, the layout of the exports of embedded routers.
+const minimalRouterTestData = `MIIC5wIBAzCCAuAGCSqGSIb3DQEHAaCCAtEEggLNMIICyTCCAsUGCSqGSIb3DQEHAaCCArYEggKy
+MIICrjCBwQYLKoZIhvcNAQwKAQGggYowgYcCAQAwEwYHKoZIzj0CAQYIKoZIzj0DAQcEbTBrAgEB
+BCBrzvCI9mPKFXXIKnnUkuhQ94fzLRSJiX6Co3TIDatrK6FEA0IABDwx8rmiLzUyTPwlzTFuyKla
+7IwBCJ2scJUIelKQgcgLV9Xt6yAMdaMjnLURSf5swQftkaghAhsaWiHiKGMx0bkxJTAjBgkqhkiG
+9w0BCRUxFgQUHfgugDJP60Ki8PpBGqMPPK9G7h4wggHmBgsqhkiG9w0BDAoBA6CCAa4wggGqBgoq
+hkiG9w0BCRYBoIIBmgSCAZYwggGSMIIBN6ADAgECAhRLJuFtISdzqRJg6Wtg9ZPoDNw7szAKBggq
+hkjOPQQDAjAdMRswGQYDVQQDDBJyb3V0ZXIuZXhhbXBsZS5jb20wIBcNMjYxMDE0MDc0NDQwWhgP
+MjEyNjA5MjAwNzQ0NDBaMB0xGzAZBgNVBAMMEnJvdXRlci5leGFtcGxlLmNvbTBZMBMGByqGSM49
+AgEGCCqGSM49AwEHA0IABDwx8rmiLzUyTPwlzTFuyKla7IwBCJ2scJUIelKQgcgLV9Xt6yAMdaMj
+nLURSf5swQftkaghAhsaWiHiKGMx0bmjUzBRMB0GA1UdDgQWBBSn2GBGhNlDLP0dqEI/X9kV7zp2
+ajAfBgNVHSMEGDAWgBSn2GBGhNlDLP0dqEI/X9kV7zp2ajAPBgNVHRMBAf8EBTADAQH/MAoGCCqG
+SM49BAMCA0kAMEYCIQC0fNdEp0TnqYJhcNfVzuD0RvHtb4Tdp1cPgaRZdhxsrwIhAIaR8rPR2t1G
+NXrwzB6LiU+FCF9P33Cz/uezv9FUjkl6MSUwIwYJKoZIhvcNAQkVMRYEFB34LoAyT+tCovD6QRqj
+DzyvRu4e`
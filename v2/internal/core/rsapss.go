@@ -0,0 +1,131 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+
+	"github.com/scholar-ink/go-pkcs12/v2/oids"
+)
+
+// see https://tools.ietf.org/html/rfc4055#section-3.1
+var oidRSASSAPSS = asn1.ObjectIdentifier([]int{1, 2, 840, 113549, 1, 1, 10})
+
+type subjectPublicKeyInfo struct {
+	Algorithm pkix.AlgorithmIdentifier
+	PublicKey asn1.BitString
+}
+
+type pkcs8 struct {
+	Version    int
+	Algorithm  pkix.AlgorithmIdentifier
+	PrivateKey []byte
+}
+
+// rsaPSSAlgorithm returns the AlgorithmIdentifier of cert's public key if
+// it is id-RSASSA-PSS, restricting the key to RSA-PSS signatures, and
+// reports whether it is.
+func rsaPSSAlgorithm(cert *x509.Certificate) (algorithm pkix.AlgorithmIdentifier, ok bool) {
+	var spki subjectPublicKeyInfo
+	if err := unmarshal(cert.RawSubjectPublicKeyInfo, &spki); err != nil {
+		return algorithm, false
+	}
+	return spki.Algorithm, spki.Algorithm.Algorithm.Equal(oidRSASSAPSS)
+}
+
+// certificatePublicKey returns the public key of cert.  Unlike
+// cert.PublicKey, which crypto/x509 leaves nil for id-RSASSA-PSS and X25519
+// keys, it also handles RSA keys restricted to RSA-PSS, and returns an
+// *ecdh.PublicKey for X25519.
+func certificatePublicKey(cert *x509.Certificate) (crypto.PublicKey, error) {
+	if cert.PublicKey != nil {
+		return cert.PublicKey, nil
+	}
+	var spki subjectPublicKeyInfo
+	if err := unmarshal(cert.RawSubjectPublicKeyInfo, &spki); err != nil {
+		return nil, err
+	}
+	if spki.Algorithm.Algorithm.Equal(oidX25519) {
+		return x509.ParsePKIXPublicKey(cert.RawSubjectPublicKeyInfo)
+	}
+	if !spki.Algorithm.Algorithm.Equal(oidRSASSAPSS) {
+		return nil, errors.New("pkcs12: unsupported certificate public key algorithm " + oids.Describe(spki.Algorithm.Algorithm))
+	}
+	return x509.ParsePKCS1PublicKey(spki.PublicKey.RightAlign())
+}
+
+// publicKeyMatches reports whether publicKey is the public key of cert.
+func publicKeyMatches(publicKey crypto.PublicKey, cert *x509.Certificate) bool {
+	certPublicKey, err := certificatePublicKey(cert)
+	if err != nil {
+		return false
+	}
+	key, ok := publicKey.(interface{ Equal(crypto.PublicKey) bool })
+	return ok && key.Equal(certPublicKey)
+}
+
+// marshalPKCS8PrivateKey is like x509.MarshalPKCS8PrivateKey, but if
+// certificate has an id-RSASSA-PSS public key, an RSA private key is
+// labeled id-RSASSA-PSS with the certificate's PSS parameters, as RFC 4055
+// requires, rather than rsaEncryption.  It also accepts a
+// *ed25519.PrivateKey, an Ed448PrivateKey, an X448PrivateKey, and ECDSA
+// keys on the Brainpool curves and secp256k1, which
+// x509.MarshalPKCS8PrivateKey rejects.
+func marshalPKCS8PrivateKey(privateKey interface{}, certificate *x509.Certificate) ([]byte, error) {
+	if key, ok := privateKey.(*ed25519.PrivateKey); ok && key != nil {
+		privateKey = *key
+	}
+	if der, ok, err := marshalCurve448PrivateKey(privateKey); ok {
+		return der, err
+	}
+	if der, ok, err := marshalNamedCurvePrivateKey(privateKey); ok {
+		return der, err
+	}
+	rsaKey, ok := privateKey.(*rsa.PrivateKey)
+	if !ok || certificate == nil {
+		return x509.MarshalPKCS8PrivateKey(privateKey)
+	}
+	algorithm, ok := rsaPSSAlgorithm(certificate)
+	if !ok {
+		return x509.MarshalPKCS8PrivateKey(privateKey)
+	}
+	return asn1.Marshal(pkcs8{
+		Algorithm:  algorithm,
+		PrivateKey: x509.MarshalPKCS1PrivateKey(rsaKey),
+	})
+}
+
+// parsePKCS8PrivateKey is like x509.ParsePKCS8PrivateKey, but also parses
+// RSA keys labeled id-RSASSA-PSS, returning them as a *rsa.PrivateKey,
+// returns an Ed448PrivateKey or X448PrivateKey for Ed448 and X448 keys,
+// and parses ECDSA keys on the Brainpool curves.  The PSS parameters are
+// not part of the returned key; marshalPKCS8PrivateKey restores them from
+// the certificate.
+func parsePKCS8PrivateKey(der []byte) (key interface{}, err error) {
+	var privKey pkcs8
+	if _, err := asn1.Unmarshal(der, &privKey); err != nil {
+		return x509.ParsePKCS8PrivateKey(der)
+	}
+	if privKey.Algorithm.Algorithm.Equal(oidRSASSAPSS) {
+		rsaKey, err := x509.ParsePKCS1PrivateKey(privKey.PrivateKey)
+		if err != nil {
+			return nil, errors.New("pkcs12: invalid RSA-PSS private key: " + err.Error())
+		}
+		return rsaKey, nil
+	}
+	if key, ok, err := parseCurve448PrivateKey(&privKey); ok {
+		return key, err
+	}
+	if key, ok, err := parseNamedCurvePrivateKey(&privKey, brainpoolCurve); ok {
+		return key, err
+	}
+	return x509.ParsePKCS8PrivateKey(der)
+}
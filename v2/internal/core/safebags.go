@@ -0,0 +1,151 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Copyright 2015 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"errors"
+	"io"
+)
+
+var (
+	// see https://tools.ietf.org/html/rfc7292#appendix-D
+	oidCertTypeX509Certificate = asn1.ObjectIdentifier([]int{1, 2, 840, 113549, 1, 9, 22, 1})
+	oidKeyBag                  = asn1.ObjectIdentifier([]int{1, 2, 840, 113549, 1, 12, 10, 1, 1})
+	oidPKCS8ShroundedKeyBag    = asn1.ObjectIdentifier([]int{1, 2, 840, 113549, 1, 12, 10, 1, 2})
+	oidCertBag                 = asn1.ObjectIdentifier([]int{1, 2, 840, 113549, 1, 12, 10, 1, 3})
+)
+
+type certBag struct {
+	Id   asn1.ObjectIdentifier
+	Data []byte `asn1:"tag:0,explicit"`
+}
+
+func (dec *Decoder) decodePkcs8ShroudedKeyBag(asn1Data, password []byte) (privateKey interface{}, err error) {
+	pkinfo := new(encryptedPrivateKeyInfo)
+	if err = unmarshal(asn1Data, pkinfo); err != nil {
+		return nil, errors.New("pkcs12: error decoding PKCS#8 shrouded key bag: " + err.Error())
+	}
+
+	// The parsed key does not retain pkData, so it can be decrypted
+	// into a scratch buffer, which is zeroed after use.
+	buf := getScratch(len(pkinfo.Data()))
+	defer putScratch(buf)
+	pkData, err := dec.decryptShroudedKey(*buf, pkinfo, password)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := new(asn1.RawValue)
+	if err = unmarshal(pkData, ret); err != nil {
+		return nil, errors.New("pkcs12: error unmarshaling decrypted private key: " + err.Error())
+	}
+
+	if privateKey, err = dec.parsePKCS8PrivateKey(pkData); err != nil {
+		return nil, errors.New("pkcs12: error parsing PKCS#8 private key: " + err.Error())
+	}
+
+	return privateKey, nil
+}
+
+// decryptShroudedKey decrypts the PrivateKeyInfo of pkinfo into dst if it
+// has enough capacity.  Keys shrouded by pre-standard tools with PKCS#5
+// v1.5 schemes rather than PKCS#12 PBE, or with RC4, are decrypted only if
+// dec allows insecure algorithms.
+func (dec *Decoder) decryptShroudedKey(dst []byte, pkinfo *encryptedPrivateKeyInfo, password []byte) (pkData []byte, err error) {
+	m := dec.monitor()
+	if err := dec.checkInsecure(pkinfo.Algorithm().Algorithm); err != nil {
+		return nil, err
+	}
+	if err := dec.checkPBEIterations("key encryption", pkinfo.Algorithm()); err != nil {
+		return nil, err
+	}
+	if err := dec.checkScrypt("key encryption", pkinfo.Algorithm()); err != nil {
+		return nil, err
+	}
+	pkData, err = pbDecryptTo(dst, pkinfo, password, m)
+	if err := m.err(); err != nil {
+		return nil, err
+	}
+	if err != nil {
+		return nil, errors.New("pkcs12: error decrypting PKCS#8 shrouded key bag: " + err.Error())
+	}
+	return pkData, nil
+}
+
+func encodePkcs8ShroudedKeyBag(rand io.Reader, privateKey interface{}, certificate *x509.Certificate, algoID asn1.ObjectIdentifier, password []byte, settings pbeSettings, m *kdfMonitor) (asn1Data []byte, err error) {
+	var pkData []byte
+	if pkData, err = marshalPKCS8PrivateKey(privateKey, certificate); err != nil {
+		return nil, errors.New("pkcs12: error encoding PKCS#8 private key: " + err.Error())
+	}
+
+	var pkinfo encryptedPrivateKeyInfo
+	if pkinfo.AlgorithmIdentifier, err = newPBEAlgorithm(rand, algoID, settings); err != nil {
+		return nil, err
+	}
+
+	if err = pbEncrypt(&pkinfo, pkData, password, m); err != nil {
+		if err := m.err(); err != nil {
+			return nil, err
+		}
+		return nil, errors.New("pkcs12: error encrypting PKCS#8 shrouded key bag: " + err.Error())
+	}
+
+	if asn1Data, err = asn1.Marshal(pkinfo); err != nil {
+		return nil, errors.New("pkcs12: error encoding PKCS#8 shrouded key bag: " + err.Error())
+	}
+
+	return asn1Data, nil
+}
+
+func decodeCertBag(asn1Data []byte) (x509Certificates []byte, err error) {
+	bag := new(certBag)
+	if err := unmarshal(asn1Data, bag); err != nil {
+		return nil, errors.New("pkcs12: error decoding cert bag: " + err.Error())
+	}
+	if !bag.Id.Equal(oidCertTypeX509Certificate) {
+		return nil, NotImplementedError("only X509 certificates are supported")
+	}
+	return bag.Data, nil
+}
+
+// parseCertBag parses the single X.509 certificate contained in the cert bag
+// asn1Data.  The certificate's Raw field aliases asn1Data.
+func parseCertBag(asn1Data []byte) (*x509.Certificate, error) {
+	certsData, err := decodeCertBag(asn1Data)
+	if err != nil {
+		return nil, err
+	}
+	certs, err := x509.ParseCertificates(certsData)
+	if err != nil {
+		if cert, brainpoolErr := parseCertificate(certsData); brainpoolErr == nil {
+			return cert, nil
+		}
+		return nil, err
+	}
+	if len(certs) != 1 {
+		return nil, errors.New("pkcs12: expected exactly one certificate in the certBag")
+	}
+	return certs[0], nil
+}
+
+// encodeCertBag embeds the DER certificate x509Certificates in a cert bag
+// verbatim.  The DER is checked but never re-serialized, so that
+// signatures and key identifier lookups over it remain byte-exact.
+func encodeCertBag(x509Certificates []byte) (asn1Data []byte, err error) {
+	if _, err = parseNamedCurveCertificate(x509Certificates, anyNamedCurve); err != nil {
+		return nil, errors.New("pkcs12: certificate is not a valid DER certificate: " + err.Error())
+	}
+
+	var bag certBag
+	bag.Id = oidCertTypeX509Certificate
+	bag.Data = x509Certificates
+	if asn1Data, err = asn1.Marshal(bag); err != nil {
+		return nil, errors.New("pkcs12: error encoding cert bag: " + err.Error())
+	}
+	return asn1Data, nil
+}
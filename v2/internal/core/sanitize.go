@@ -0,0 +1,48 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// WithSanitizedAttributes returns a copy of dec which passes the bag
+// attribute values exposed by ToPEM, such as friendlyName, through
+// SanitizeAttribute with the given maxLength.  Attributes in PKCS#12 files
+// from untrusted sources may contain control characters or be arbitrarily
+// long, which is a hazard for UIs and logs that display them.  The
+// unsanitized values remain available from a Decoder without this option.
+func (dec Decoder) WithSanitizedAttributes(maxLength int) *Decoder {
+	dec.sanitizeAttributes = true
+	dec.maxAttributeLength = maxLength
+	return &dec
+}
+
+// SanitizeAttribute makes an attribute value safe for display.  Control
+// characters, Unicode bidirectional formatting characters, and invalid
+// UTF-8 are replaced with U+FFFD, and the result is truncated to at most
+// maxLength bytes, on a character boundary.  A maxLength of zero or less
+// means no limit.
+func SanitizeAttribute(value string, maxLength int) string {
+	sanitized := strings.Map(func(r rune) rune {
+		if r == utf8.RuneError || unicode.IsControl(r) || unicode.Is(unicode.Bidi_Control, r) {
+			return utf8.RuneError
+		}
+		return r
+	}, value)
+
+	if maxLength > 0 && len(sanitized) > maxLength {
+		sanitized = sanitized[:maxLength]
+		for len(sanitized) > 0 {
+			if r, size := utf8.DecodeLastRuneInString(sanitized); r != utf8.RuneError || size != 1 {
+				break
+			}
+			sanitized = sanitized[:len(sanitized)-1]
+		}
+	}
+	return sanitized
+}
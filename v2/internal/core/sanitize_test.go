@@ -0,0 +1,62 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"crypto/rand"
+	"strings"
+	"testing"
+)
+
+func TestSanitizeAttribute(t *testing.T) {
+	for _, test := range []struct {
+		value     string
+		maxLength int
+		want      string
+	}{
+		{"server", 0, "server"},
+		{"line1\nline2\x1b[31m", 0, "line1\ufffdline2\ufffd[31m"},
+		{"evil\u202egnp.exe", 0, "evil\ufffdgnp.exe"},
+		{"bad\xffutf8", 0, "bad\ufffdutf8"},
+		{"abcdef", 3, "abc"},
+		{"abé", 3, "ab"},
+		{"日本語", 7, "日本"},
+	} {
+		if got := SanitizeAttribute(test.value, test.maxLength); got != test.want {
+			t.Errorf("SanitizeAttribute(%q, %d) = %q, want %q", test.value, test.maxLength, got, test.want)
+		}
+	}
+}
+
+func TestWithSanitizedAttributes(t *testing.T) {
+	key, leaf := newTestCertificate(t, "sanitize.example.com", nil, nil)
+	friendlyName := "Proxy\r\nX-Injected: yes" + strings.Repeat("A", 1<<16)
+	pfxData, err := EncodeEnrollmentResponse(rand.Reader, &EnrollmentResponse{
+		PrivateKey:   key,
+		Certificate:  leaf,
+		FriendlyName: friendlyName,
+	}, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	blocks, err := DefaultDecoder.WithSanitizedAttributes(64).ToPEM(pfxData, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, block := range blocks {
+		if got, want := block.Headers["friendlyName"], SanitizeAttribute(friendlyName, 64); got != want {
+			t.Errorf("%s: got friendlyName %q, want %q", block.Type, got, want)
+		}
+	}
+
+	blocks, err = ToPEM(pfxData, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := blocks[0].Headers["friendlyName"]; got != friendlyName {
+		t.Errorf("raw friendlyName was modified")
+	}
+}
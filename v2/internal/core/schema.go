@@ -0,0 +1,131 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// ReportSchema is the version of the JSON encoding of Report and the types
+// it contains, which Dump records in Report.Schema.  The version is only
+// incremented by incompatible changes, such as the removal or reuse of a
+// field; fields may be added without one.  Consumers should therefore
+// ignore fields they do not know, and Report, BagReport and ExtensionReport
+// keep such fields in Unknown when a newer report is unmarshaled, and write
+// them back when it is marshaled again.
+const ReportSchema = 1
+
+// ParseReport unmarshals the JSON encoding of a Report, failing if it was
+// written with a schema other than ReportSchema.  A report without a
+// schema, written before the encoding was versioned, is treated as schema 1.
+func ParseReport(data []byte) (*Report, error) {
+	report := new(Report)
+	if err := json.Unmarshal(data, report); err != nil {
+		return nil, err
+	}
+	if report.Schema == 0 {
+		report.Schema = 1
+	}
+	if report.Schema != ReportSchema {
+		return nil, errors.New("pkcs12: unsupported report schema " + strconv.Itoa(report.Schema))
+	}
+	return report, nil
+}
+
+// The aliases have the fields but not the methods of the report types, so
+// that encoding/json handles their known fields as usual.
+type (
+	reportFields          Report
+	bagReportFields       BagReport
+	extensionReportFields ExtensionReport
+)
+
+func (r Report) MarshalJSON() ([]byte, error) {
+	return marshalWithUnknown(reportFields(r), r.Unknown)
+}
+
+func (r *Report) UnmarshalJSON(data []byte) error {
+	return unmarshalWithUnknown(data, (*reportFields)(r), &r.Unknown)
+}
+
+func (r BagReport) MarshalJSON() ([]byte, error) {
+	return marshalWithUnknown(bagReportFields(r), r.Unknown)
+}
+
+func (r *BagReport) UnmarshalJSON(data []byte) error {
+	return unmarshalWithUnknown(data, (*bagReportFields)(r), &r.Unknown)
+}
+
+func (r ExtensionReport) MarshalJSON() ([]byte, error) {
+	return marshalWithUnknown(extensionReportFields(r), r.Unknown)
+}
+
+func (r *ExtensionReport) UnmarshalJSON(data []byte) error {
+	return unmarshalWithUnknown(data, (*extensionReportFields)(r), &r.Unknown)
+}
+
+// marshalWithUnknown returns the JSON object encoding fields, a struct,
+// with the members of unknown added.  Members of unknown which have the
+// name of a field of fields are dropped.
+func marshalWithUnknown(fields interface{}, unknown map[string]json.RawMessage) ([]byte, error) {
+	data, err := json.Marshal(fields)
+	if err != nil || len(unknown) == 0 {
+		return data, err
+	}
+	members := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(data, &members); err != nil {
+		return nil, err
+	}
+	known := jsonFieldNames(reflect.TypeOf(fields))
+	for name, value := range unknown {
+		if !known[name] {
+			members[name] = value
+		}
+	}
+	return json.Marshal(members)
+}
+
+// unmarshalWithUnknown unmarshals the JSON object data into fields, a
+// pointer to a struct, and sets *unknown to its members which are not
+// fields of it, or nil if there are none.
+func unmarshalWithUnknown(data []byte, fields interface{}, unknown *map[string]json.RawMessage) error {
+	if err := json.Unmarshal(data, fields); err != nil {
+		return err
+	}
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(data, &members); err != nil {
+		return err
+	}
+	for name := range jsonFieldNames(reflect.TypeOf(fields).Elem()) {
+		delete(members, name)
+	}
+	if len(members) == 0 {
+		members = nil
+	}
+	*unknown = members
+	return nil
+}
+
+// jsonFieldNames returns the names of the JSON object members of the
+// struct type t.
+func jsonFieldNames(t reflect.Type) map[string]bool {
+	names := make(map[string]bool, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" || !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		names[name] = true
+	}
+	return names
+}
@@ -0,0 +1,65 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestReportSchema(t *testing.T) {
+	key, cert := newTestCertificate(t, "www.example.com", nil, nil)
+	pfxData, err := Encode(rand.Reader, key, cert, nil, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := Dump(pfxData, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Schema != ReportSchema {
+		t.Errorf("got schema %d, want %d", report.Schema, ReportSchema)
+	}
+	data, err := json.Marshal(report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := ParseReport(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(parsed, report) {
+		t.Errorf("report changed by a JSON round trip:\n%+v\n%+v", parsed, report)
+	}
+
+	// Members added by a later version survive a round trip.
+	newer := []byte(`{"schema":1,"bags":[{"type":"certBag","safeContents":0,"sha256":"00","issuer":"CN=ca"}],"source":{"path":"a.p12"}}`)
+	parsed, err = ParseReport(newer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(parsed.Unknown["source"]) != `{"path":"a.p12"}` || string(parsed.Bags[0].Unknown["issuer"]) != `"CN=ca"` {
+		t.Errorf("unknown members not kept: %v, %v", parsed.Unknown, parsed.Bags[0].Unknown)
+	}
+	data, err = json.Marshal(parsed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got, want interface{}
+	json.Unmarshal(data, &got)
+	json.Unmarshal(newer, &want)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %s, want %s", data, newer)
+	}
+
+	if parsed, err := ParseReport([]byte(`{"bags":[]}`)); err != nil || parsed.Schema != 1 {
+		t.Errorf("report without a schema: got %v, %v", parsed, err)
+	}
+	if _, err := ParseReport([]byte(`{"schema":2,"bags":[]}`)); err == nil {
+		t.Error("parsed a report with schema 2")
+	}
+}
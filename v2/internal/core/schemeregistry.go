@@ -0,0 +1,75 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"crypto/cipher"
+	"encoding/asn1"
+	"sync"
+
+	"github.com/scholar-ink/go-pkcs12/v2/oids"
+)
+
+// A PBEScheme is a PBES2 encryption scheme which is not built into this
+// package, such as a proprietary or national block cipher, used in CBC
+// mode with the padding of RFC 8018, section 6.1.1.
+type PBEScheme struct {
+	// KeySize is the length in bytes of the key derived for the scheme.
+	KeySize int
+
+	// BlockSize is the block size of the cipher in bytes, which is also
+	// the length of the IV.
+	BlockSize int
+
+	// NewCipher returns the block cipher keyed with key.
+	NewCipher func(key []byte) (cipher.Block, error)
+
+	// MarshalParameters, if not nil, returns the DER encoding of the
+	// parameters of the AlgorithmIdentifier of the scheme for an
+	// encryption with iv.  If it is nil, the parameters are iv as an
+	// OCTET STRING, as for AES-CBC.
+	MarshalParameters func(iv []byte) ([]byte, error)
+
+	// UnmarshalParameters, if not nil, returns the IV from the
+	// DER-encoded parameters of the scheme read from a file.  If it is
+	// nil, the parameters must be the IV as an OCTET STRING.
+	UnmarshalParameters func(params []byte) (iv []byte, err error)
+}
+
+var (
+	pbeSchemesMu sync.RWMutex
+	pbeSchemes   = make(map[string]PBEScheme)
+)
+
+// RegisterPBEScheme makes scheme available to every Decoder, and to
+// Encoders configured with WithPBEScheme, as the PBES2 encryption scheme
+// identified by oid, replacing any registered before.  The built-in
+// schemes, such as AES-CBC, cannot be replaced.  It is intended to be
+// called during program initialization.
+func RegisterPBEScheme(oid asn1.ObjectIdentifier, scheme PBEScheme) {
+	pbeSchemesMu.Lock()
+	defer pbeSchemesMu.Unlock()
+	pbeSchemes[oid.String()] = scheme
+}
+
+// registeredPBEScheme returns the PBEScheme registered for oid.
+func registeredPBEScheme(oid asn1.ObjectIdentifier) (PBEScheme, error) {
+	pbeSchemesMu.RLock()
+	defer pbeSchemesMu.RUnlock()
+	scheme, ok := pbeSchemes[oid.String()]
+	if !ok || scheme.NewCipher == nil || scheme.KeySize <= 0 || scheme.BlockSize <= 0 {
+		return PBEScheme{}, NotImplementedError("PBES2 encryption scheme " + oids.Describe(oid) + " is not supported")
+	}
+	return scheme, nil
+}
+
+// WithPBEScheme returns a copy of enc whose PBES2 algorithms encrypt with
+// the PBEScheme registered for oid, rather than with AES-CBC.  Encoding
+// fails with a NotImplementedError if none is registered.  Like
+// WithAESKeySize, it is meant to be used with Modern.
+func (enc Encoder) WithPBEScheme(oid asn1.ObjectIdentifier) *Encoder {
+	enc.pbeScheme = oid
+	return &enc
+}
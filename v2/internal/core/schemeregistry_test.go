@@ -0,0 +1,103 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/asn1"
+	"errors"
+	"testing"
+)
+
+// versionedIVParams stands in for the parameters of a proprietary scheme,
+// which wrap the IV in a SEQUENCE with a version number.
+type versionedIVParams struct {
+	Version int
+	IV      []byte
+}
+
+func TestPBEScheme(t *testing.T) {
+	oidCustom := asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 99999, 2}
+	key, cert := newTestCertificate(t, "www.example.com", nil, nil)
+	enc := Modern.WithPBEScheme(oidCustom)
+
+	if _, err := enc.Encode(rand.Reader, key, cert, nil, "password"); err == nil {
+		t.Fatal("encoded with an unregistered encryption scheme")
+	} else if _, ok := err.(NotImplementedError); !ok {
+		t.Fatalf("got error %v for an unregistered encryption scheme, want a NotImplementedError", err)
+	}
+
+	var marshaled, unmarshaled int
+	RegisterPBEScheme(oidCustom, PBEScheme{
+		KeySize:   16,
+		BlockSize: aes.BlockSize,
+		NewCipher: aes.NewCipher,
+		MarshalParameters: func(iv []byte) ([]byte, error) {
+			marshaled++
+			return asn1.Marshal(versionedIVParams{Version: 1, IV: iv})
+		},
+		UnmarshalParameters: func(params []byte) ([]byte, error) {
+			unmarshaled++
+			var p versionedIVParams
+			if _, err := asn1.Unmarshal(params, &p); err != nil {
+				return nil, err
+			}
+			if p.Version != 1 {
+				return nil, errors.New("unknown version")
+			}
+			return p.IV, nil
+		},
+	})
+	defer func() {
+		pbeSchemesMu.Lock()
+		delete(pbeSchemes, oidCustom.String())
+		pbeSchemesMu.Unlock()
+	}()
+
+	pfxData, err := enc.Encode(rand.Reader, key, cert, nil, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	privateKey, certificate, err := Decode(pfxData, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !key.Equal(privateKey) || !certificate.Equal(cert) {
+		t.Error("decoded identity does not match")
+	}
+	if marshaled != 2 || unmarshaled < 2 {
+		t.Errorf("parameters marshaled %d and unmarshaled %d times, want 2 and at least 2", marshaled, unmarshaled)
+	}
+	if _, _, err := Decode(pfxData, "wrong"); err != ErrIncorrectPassword {
+		t.Errorf("got error %v for the wrong password, want ErrIncorrectPassword", err)
+	}
+
+	// Without hooks, the parameters are the IV.
+	RegisterPBEScheme(oidCustom, PBEScheme{KeySize: 32, BlockSize: aes.BlockSize, NewCipher: aes.NewCipher})
+	if pfxData, err = enc.Encode(rand.Reader, key, cert, nil, "password"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := Decode(pfxData, "password"); err != nil {
+		t.Error(err)
+	}
+
+	// A built-in scheme cannot be replaced.
+	RegisterPBEScheme(oidAES256CBC, PBEScheme{KeySize: 32, BlockSize: aes.BlockSize, NewCipher: func([]byte) (cipher.Block, error) {
+		return nil, errors.New("replaced AES")
+	}})
+	defer func() {
+		pbeSchemesMu.Lock()
+		delete(pbeSchemes, oidAES256CBC.String())
+		pbeSchemesMu.Unlock()
+	}()
+	if pfxData, err = Modern.Encode(rand.Reader, key, cert, nil, "password"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := Decode(pfxData, "password"); err != nil {
+		t.Error(err)
+	}
+}
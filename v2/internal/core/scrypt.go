@@ -0,0 +1,117 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+
+	"github.com/scholar-ink/go-pkcs12/v2/internal/scrypt"
+)
+
+var oidScrypt = asn1.ObjectIdentifier([]int{1, 3, 6, 1, 4, 1, 11591, 4, 11})
+
+// scryptParams are the parameters of scrypt, RFC 7914 section 7.1.
+type scryptParams struct {
+	Salt                     []byte
+	CostParameter            int
+	BlockSize                int
+	ParallelizationParameter int
+	KeyLength                int `asn1:"optional"`
+}
+
+// WithScrypt returns a copy of enc whose PBES2 algorithms derive their keys
+// with scrypt (RFC 7914), using CPU/memory cost n, block size r and
+// parallelization p, rather than with PBKDF2.  n must be a power of two
+// greater than 1; RFC 7914 suggests n = 16384, r = 8 and p = 1 for
+// interactive use, which takes 16 MiB of memory.  Parameters needing more
+// than 1 GiB, 128 * r * n bytes, or mixing more than 4 GiB, 128 * r * n * p
+// bytes, are rejected when encoding and decoding alike, and a Decoder
+// rejects files needing more than 32 MiB unless configured with
+// WithMaxScryptMemory.  The iteration count of enc then has no effect on
+// PBES2.
+//
+// Only enc's PBES2 algorithms are affected, so WithScrypt is meant to be
+// used with Modern.  Not every reader of PKCS#12 files supports scrypt.
+func (enc Encoder) WithScrypt(n, r, p int) *Encoder {
+	enc.scrypt = &scryptParams{CostParameter: n, BlockSize: r, ParallelizationParameter: p}
+	return &enc
+}
+
+// maxScryptMemory bounds the memory, 128 * r * N bytes, which scrypt
+// parameters may make key derivation allocate, whatever the limit of the
+// Decoder.
+const maxScryptMemory = 1 << 30
+
+// defaultMaxScryptMemory is the memory which a Decoder lets the scrypt
+// parameters of a file make key derivation allocate, unless changed with
+// WithMaxScryptMemory.  It is twice that of the interactive parameters of
+// RFC 7914, which OpenSSL also uses by default.
+const defaultMaxScryptMemory = 32 << 20
+
+// maxScryptWork bounds N * r * p, to which the CPU time of key derivation
+// is proportional, for scrypt parameters read from a file.  It allows 4
+// GiB of mixing, such as p = 4 at the memory limit.
+const maxScryptWork = 1 << 25
+
+// scryptKey derives a key of keyLen bytes from kdfPassword with the scrypt
+// parameters params, notifying m of each mixing step.
+func scryptKey(params scryptParams, kdfPassword []byte, keyLen int, m *kdfMonitor) ([]byte, error) {
+	if params.KeyLength != 0 && params.KeyLength != keyLen {
+		return nil, NotImplementedError("scrypt key length does not match the encryption scheme")
+	}
+	if params.BlockSize > 0 && params.CostParameter > maxScryptMemory/128/params.BlockSize {
+		return nil, NotImplementedError("scrypt parameters need more than 1 GiB of memory")
+	}
+	if params.BlockSize > 0 && params.CostParameter > 0 && params.ParallelizationParameter > maxScryptWork/params.BlockSize/params.CostParameter {
+		return nil, NotImplementedError("scrypt parameters need more than 4 GiB of mixing")
+	}
+	key, err := scrypt.Key(kdfPassword, params.Salt, params.CostParameter, params.BlockSize, params.ParallelizationParameter, keyLen, m.iteration)
+	if err != nil {
+		return nil, NotImplementedError("scrypt parameters are not supported: " + err.Error())
+	}
+	return key, nil
+}
+
+// WithMaxScryptMemory returns a copy of dec which fails to decode a file
+// whose scrypt parameters need more than limit bytes of memory, 128 * r *
+// N, before deriving any key, so that untrusted files cannot make decoding
+// allocate large amounts of memory.  The default limit, restored by a
+// limit of 0, is 32 MiB.  Limits above 1 GiB have no effect, since scrypt
+// parameters needing more are always rejected.
+func (dec Decoder) WithMaxScryptMemory(limit int) *Decoder {
+	dec.maxScryptMemory = limit
+	return &dec
+}
+
+// checkScrypt returns an error if what, a password-based encryption
+// algorithm, is PBES2 with scrypt parameters needing more memory than dec
+// allows.  Parameters which cannot be parsed are left for the decryption
+// to report.
+func (dec *Decoder) checkScrypt(what string, algorithm pkix.AlgorithmIdentifier) error {
+	if !algorithm.Algorithm.Equal(oidPBES2) {
+		return nil
+	}
+	var params pbes2Params
+	if err := unmarshal(algorithm.Parameters.FullBytes, &params); err != nil {
+		return nil
+	}
+	if !params.KeyDerivationFunc.Algorithm.Equal(oidScrypt) {
+		return nil
+	}
+	var kdfParams scryptParams
+	if err := unmarshal(params.KeyDerivationFunc.Parameters.FullBytes, &kdfParams); err != nil {
+		return nil
+	}
+	limit := dec.maxScryptMemory
+	if limit <= 0 {
+		limit = defaultMaxScryptMemory
+	}
+	if kdfParams.BlockSize > 0 && kdfParams.CostParameter > limit/128/kdfParams.BlockSize {
+		return errors.New("pkcs12: " + what + " uses scrypt parameters needing more memory than the limit of the Decoder")
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"encoding/base64"
+	"testing"
+)
+
+// openSSLScryptKey is the key of openSSL3TestData encrypted by
+// "openssl pkcs8 -topk8 -scrypt" with the password "password": PBES2 with
+// scrypt (N = 16384, r = 8, p = 1) and AES-256-CBC.
+const openSSLScryptKey = `MIHkME8GCSqGSIb3DQEFDTBCMCEGCSsGAQQB2kcECzAUBAgrs1d4+ZTSOAICQAACAQgCAQEwHQYJ
+YIZIAWUDBAEqBBBjCyGdF11e7bukuI+yXXsJBIGQ80SLmW8PJ8GBAulJ5Cuowzy4jfjvpuRVOmDa
+un3Tccw1TtHbF3frxLT5GQQopgi8aRl6M7ucV9Znp3ey7QyI5iEnupD6QL9+0XCDtdYuuqaHEj3y
+FzKno1EPr02PT/Q+Md2HzzgbdYRzNkuJxGI9uUdlpDaX8C8Ayfl/yrNh9DbaOe7NF8a9pYzQV9eX
+mSfb`
+
+func TestScryptDecode(t *testing.T) {
+	p12, _ := base64.StdEncoding.DecodeString(openSSL3TestData["AES-256-CBC"])
+	_, certificate, err := Decode(p12, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encrypted, _ := base64.StdEncoding.DecodeString(openSSLScryptKey)
+	encodedPassword, _ := bmpString("password")
+	privateKey, err := DefaultDecoder.decodePkcs8ShroudedKeyBag(encrypted, encodedPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, ok := privateKey.(*ecdsa.PrivateKey)
+	if !ok || !publicKeyMatches(key.Public(), certificate) {
+		t.Errorf("got the wrong private key %T", privateKey)
+	}
+
+	encodedPassword, _ = bmpString("wrong")
+	if _, err := DefaultDecoder.decodePkcs8ShroudedKeyBag(encrypted, encodedPassword); err == nil {
+		t.Error("decrypted with the wrong password")
+	}
+}
+
+func TestWithScrypt(t *testing.T) {
+	key, cert := newTestCertificate(t, "scrypt.example.com", nil, nil)
+	pfxData, err := Modern.WithScrypt(1024, 8, 1).Encode(rand.Reader, key, cert, nil, "pässword")
+	if err != nil {
+		t.Fatal(err)
+	}
+	protection, err := InspectProtection(pfxData, "pässword")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if protection.KeyIterations != 1024 || protection.ContentIterations != 1024 {
+		t.Errorf("got iterations %d and %d, want the scrypt cost 1024", protection.KeyIterations, protection.ContentIterations)
+	}
+	privateKey, certificate, err := Decode(pfxData, "pässword")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !certificate.Equal(cert) || !key.Equal(privateKey) {
+		t.Error("round trip changed the key or certificate")
+	}
+
+	if _, err := Modern.WithScrypt(1000, 8, 1).Encode(rand.Reader, key, cert, nil, "password"); err == nil {
+		t.Error("encoded with an invalid scrypt cost")
+	}
+	if _, err := Modern.WithScrypt(1<<24, 8, 1).Encode(rand.Reader, key, cert, nil, "password"); err == nil {
+		t.Error("encoded with scrypt parameters needing 2 GiB of memory")
+	}
+	if _, err := Modern.WithScrypt(1<<14, 8, 1<<16).Encode(rand.Reader, key, cert, nil, "password"); err == nil {
+		t.Error("encoded with scrypt parameters needing 1 TiB of mixing")
+	}
+
+	// The limits protect decoding from hostile parameters before any work
+	// is done.
+	if _, err := scryptKey(scryptParams{Salt: []byte("salt"), CostParameter: 1 << 14, BlockSize: 8, ParallelizationParameter: 1<<30 - 1}, []byte("password"), 32, nil); err == nil {
+		t.Error("derived a key with scrypt parallelization 2^30 - 1")
+	}
+}
+
+func TestMaxScryptMemory(t *testing.T) {
+	key, cert := newTestCertificate(t, "scrypt.example.com", nil, nil)
+	// 128 * 8 * 2^16 bytes is 64 MiB.
+	pfxData, err := Modern.WithScrypt(1<<16, 8, 1).Encode(rand.Reader, key, cert, nil, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := Decode(pfxData, "password"); err == nil {
+		t.Error("DefaultDecoder decoded a file needing 64 MiB of scrypt memory")
+	}
+	if _, _, err := DefaultDecoder.WithMaxScryptMemory(64<<20).Decode(pfxData, "password"); err != nil {
+		t.Errorf("raised limit: %v", err)
+	}
+	if _, _, err := DefaultDecoder.WithMaxScryptMemory(64<<20).WithMaxScryptMemory(0).Decode(pfxData, "password"); err == nil {
+		t.Error("a limit of 0 did not restore the default")
+	}
+
+	// The RFC 7914 interactive parameters are within the default limit.
+	pfxData, err = Modern.WithScrypt(1<<14, 8, 1).Encode(rand.Reader, key, cert, nil, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := Decode(pfxData, "password"); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"crypto/elliptic"
+	"encoding/asn1"
+
+	"github.com/scholar-ink/go-pkcs12/v2/internal/secp256k1"
+)
+
+// see https://www.secg.org/sec2-v2.pdf, section 2.4.1
+var oidNamedCurveSecp256k1 = asn1.ObjectIdentifier{1, 3, 132, 0, 10}
+
+// Secp256k1 returns the secp256k1 curve of SEC 2, which is used by Bitcoin
+// and Ethereum and is not in the standard library.  Like
+// elliptic.CurveParams, its implementation is not constant-time; it is
+// meant for moving keys between PKCS#12 files and blockchain tooling, not
+// for signing with them.
+//
+// An ECDSA key on secp256k1 is a *ecdsa.PrivateKey with this Curve.  Its D
+// is the raw scalar, from which the key types of other packages can be
+// built, such as with crypto.ToECDSA of go-ethereum or
+// secp256k1.PrivKeyFromBytes of dcrd.  Encoders accept such keys, and
+// Decoders return them if configured with WithSecp256k1.
+func Secp256k1() elliptic.Curve {
+	return secp256k1.S256()
+}
+
+// secp256k1Curve returns secp256k1 if oid identifies it, or nil.
+func secp256k1Curve(oid asn1.ObjectIdentifier) elliptic.Curve {
+	if oid.Equal(oidNamedCurveSecp256k1) {
+		return secp256k1.S256()
+	}
+	return nil
+}
+
+// WithSecp256k1 returns a copy of dec which, if enabled is true, decodes
+// ECDSA keys on secp256k1, and certificates whose public key is on it, as
+// described for Secp256k1.  Otherwise they fail to decode with the error
+// of crypto/x509, which does not support the curve.
+//
+// The keys are ordinary *ecdsa.PrivateKey values, but signing with them
+// through crypto/ecdsa is not constant-time, and leaks information about
+// the private key to anyone who can time it.  Convert them to the key type
+// of a constant-time secp256k1 implementation before signing.
+func (dec Decoder) WithSecp256k1(enabled bool) *Decoder {
+	dec.secp256k1 = enabled
+	return &dec
+}
+
+// parsePKCS8PrivateKey is like the parsePKCS8PrivateKey function, but also
+// parses secp256k1 keys if dec is configured with WithSecp256k1.
+func (dec *Decoder) parsePKCS8PrivateKey(der []byte) (key interface{}, err error) {
+	if dec.secp256k1 {
+		var privKey pkcs8
+		if unmarshal(der, &privKey) == nil {
+			if key, ok, err := parseNamedCurvePrivateKey(&privKey, secp256k1Curve); ok {
+				return key, err
+			}
+		}
+	}
+	return parsePKCS8PrivateKey(der)
+}
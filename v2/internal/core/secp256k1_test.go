@@ -0,0 +1,86 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"testing"
+)
+
+func TestSecp256k1(t *testing.T) {
+	pfxData, _ := base64.StdEncoding.DecodeString(openSSLSecp256k1TestData)
+	if _, _, err := Decode(pfxData, "password"); err == nil {
+		t.Fatal("decoded a secp256k1 key without WithSecp256k1")
+	}
+
+	dec := DefaultDecoder.WithSecp256k1(true)
+	privateKey, certificate, err := dec.DecodeChain(pfxData, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, ok := privateKey.(*ecdsa.PrivateKey)
+	if !ok || key.Curve != Secp256k1() {
+		t.Fatalf("decoded a %T, want a secp256k1 *ecdsa.PrivateKey", privateKey)
+	}
+	if got, want := hex.EncodeToString(key.D.Bytes()), "ee271b4f3267c89f4e0194fb703297e3885f8b5c44693c01136c1bd6e6572921"; got != want {
+		t.Errorf("got scalar %s, want %s", got, want)
+	}
+	if certificate.Subject.CommonName != "secp256k1.example.com" || !publicKeyMatches(key.Public(), certificate) {
+		t.Error("key does not match the certificate")
+	}
+	if err := certificate.CheckSignatureFrom(certificate); err != nil {
+		t.Errorf("self-signature does not verify: %v", err)
+	}
+
+	digest := sha256.Sum256([]byte("message"))
+	sig, err := ecdsa.SignASN1(rand.Reader, key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ecdsa.VerifyASN1(&key.PublicKey, digest[:], sig) {
+		t.Error("signature does not verify")
+	}
+
+	pfxData, err = Modern.Encode(rand.Reader, key, certificate, nil, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	decodedKey, decodedCert, err := dec.Decode(pfxData, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !key.Equal(decodedKey) || !decodedCert.Equal(certificate) {
+		t.Error("re-encoded identity does not match")
+	}
+}
+
+// openSSLSecp256k1TestData was generated with
+//
+//	openssl genpkey -algorithm EC -pkeyopt ec_paramgen_curve:secp256k1 -out k1.key
+//	openssl req -new -x509 -key k1.key -subj /CN=secp256k1.example.com -days 36500 -out k1.crt
+//	openssl pkcs12 -export -inkey k1.key -in k1.crt -passout pass:password
+const openSSLSecp256k1TestData = `MIIELAIBAzCCA+IGCSqGSIb3DQEHAaCCA9MEggPPMIIDyzCCAoIGCSqGSIb3DQEHBqCCAnMwggJv
+AgEAMIICaAYJKoZIhvcNAQcBMFcGCSqGSIb3DQEFDTBKMCkGCSqGSIb3DQEFDDAcBAix4ALTJ8Cx
+SwICCAAwDAYIKoZIhvcNAgkFADAdBglghkgBZQMEASoEEDeaMk5gKJ8y5J4Tl3yYPAaAggIAHNAS
+tzH0cw1gQ9F5WLf7xUKmOQl/NynEigTfI7e5nDLcD5C9dGr0yPuoIR/hVK0lexYnmb/VLQLbUls4
+bI9p8OaCcE+X2V3407JmnR5tKkfMq5CU4C2Ks5LMus2rrA5Pe31GnXqW2wzMjyFl3RNxVNO4FmM9
+vi0zSrM5UBa0qEY9Rn7wVi5zWGcv8tuwzhZAaX4rbImZ/AGs+SCx7vDRFRVV0+9dZmHLtJXtPL3v
+dZrtXR/FvH4f6g2O9WyXzj+3UNBrHxkNZ+jaOoeoAGLq7pWzNPwA2eZr3t3VaRny8gRNQVu5i4Dm
+47nC+tt/w5/x87JicMWBjoi7FxRkWWC5ypCDtSrD0xObIcd4AO4dQFFADkubpRPREI4BrubMAp3t
+Xjxc3oYHDzXT0sQPqrgNB/jB+xULYf6X95K+gxBo6R5QpRQzUNv1wAnSDOf7V+5iFHXV1ij1Kn6R
+KarGs0WxkFts9S8hNu3pY9OEhiTpSer6GMywWth+5/WXyaTQy5IPycV2EKFMcKTZoBQDpOeGrQ6Z
+iKG3x1EZxNTLUyk2z8HCSHBPh75iv15E/t0M8Vvz+nPhs7v4tbK6tnbJy7OgEjdihVrw1eOiQ4c+
+PN8BvWtx/6Ql4m6qeuqpVRXgN3uDdNoS1Y9xD/lYeos1+W8T8w3Y3Yr4SwExlpfdtb5pjmEwggFB
+BgkqhkiG9w0BBwGgggEyBIIBLjCCASowggEmBgsqhkiG9w0BDAoBAqCB7zCB7DBXBgkqhkiG9w0B
+BQ0wSjApBgkqhkiG9w0BBQwwHAQINM1k6BhOHGgCAggAMAwGCCqGSIb3DQIJBQAwHQYJYIZIAWUD
+BAEqBBDCOYJH1dBrbRJfBW1zE97KBIGQYAErb3p8y1VpwhIAvFKeuTf30X7AUEGtcVNvrGrs2m6E
+UqXYWBtBMrzQWXyYT2HS4qP2JvN0mti9jODo29pDUkOwglZ7lUtoCvvHy4NuYp3ILCDKB/5rYfth
+rCIyGZ/kmopYLgEq1gaW7lcNKOWt1uqT6c1tYfDlEPCcshbddxyoCxFBvwQVhs2I3AvkpNxOMSUw
+IwYJKoZIhvcNAQkVMRYEFJlgQcRQ1WuNY2GnrkHlej8TmFR8MEEwMTANBglghkgBZQMEAgEFAAQg
+9wHjncz+JFN2VKcQkH+C8LR4+GerIYx2yV+XqYpymnAECN+8+MSLc7hrAgIIAA==`
@@ -0,0 +1,218 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+
+	"github.com/scholar-ink/go-pkcs12/v2/oids"
+)
+
+var (
+	oidSignedDataContentType = asn1.ObjectIdentifier([]int{1, 2, 840, 113549, 1, 7, 2})
+
+	oidContentTypeAttribute   = asn1.ObjectIdentifier([]int{1, 2, 840, 113549, 1, 9, 3})
+	oidMessageDigestAttribute = asn1.ObjectIdentifier([]int{1, 2, 840, 113549, 1, 9, 4})
+
+	oidSHA384 = asn1.ObjectIdentifier([]int{2, 16, 840, 1, 101, 3, 4, 2, 2})
+	oidSHA512 = asn1.ObjectIdentifier([]int{2, 16, 840, 1, 101, 3, 4, 2, 3})
+
+	oidRSAEncryption   = asn1.ObjectIdentifier([]int{1, 2, 840, 113549, 1, 1, 1})
+	oidSHA1WithRSA     = asn1.ObjectIdentifier([]int{1, 2, 840, 113549, 1, 1, 5})
+	oidSHA256WithRSA   = asn1.ObjectIdentifier([]int{1, 2, 840, 113549, 1, 1, 11})
+	oidSHA384WithRSA   = asn1.ObjectIdentifier([]int{1, 2, 840, 113549, 1, 1, 12})
+	oidSHA512WithRSA   = asn1.ObjectIdentifier([]int{1, 2, 840, 113549, 1, 1, 13})
+	oidECPublicKey     = asn1.ObjectIdentifier([]int{1, 2, 840, 10045, 2, 1})
+	oidECDSAWithSHA1   = asn1.ObjectIdentifier([]int{1, 2, 840, 10045, 4, 1})
+	oidECDSAWithSHA256 = asn1.ObjectIdentifier([]int{1, 2, 840, 10045, 4, 3, 2})
+	oidECDSAWithSHA384 = asn1.ObjectIdentifier([]int{1, 2, 840, 10045, 4, 3, 3})
+	oidECDSAWithSHA512 = asn1.ObjectIdentifier([]int{1, 2, 840, 10045, 4, 3, 4})
+)
+
+// signedData is the PKCS#7 (RFC 5652) SignedData which holds the
+// AuthenticatedSafe of a PFX in public-key integrity mode.
+type signedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	ContentInfo      contentInfo
+	Certificates     asn1.RawValue `asn1:"tag:0,optional"`
+	CRLs             asn1.RawValue `asn1:"tag:1,optional"`
+	SignerInfos      []signerInfo  `asn1:"set"`
+}
+
+type signerInfo struct {
+	Version            int
+	SID                asn1.RawValue
+	DigestAlgorithm    pkix.AlgorithmIdentifier
+	SignedAttrs        asn1.RawValue `asn1:"tag:0,optional"`
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          []byte
+	UnsignedAttrs      asn1.RawValue `asn1:"tag:1,optional"`
+}
+
+// content returns the signed content, which must be of type data.
+func (sd *signedData) content() ([]byte, error) {
+	if !sd.ContentInfo.ContentType.Equal(oidDataContentType) {
+		return nil, NotImplementedError("only data is supported as signed content")
+	}
+	var content []byte
+	if err := unmarshal(sd.ContentInfo.Content.Bytes, &content); err != nil {
+		return nil, err
+	}
+	return content, nil
+}
+
+// verify checks that at least one SignerInfo of sd is a valid signature of
+// content by verifier.
+func (sd *signedData) verify(content []byte, verifier *x509.Certificate) error {
+	if len(sd.SignerInfos) == 0 {
+		return errors.New("pkcs12: signed data has no signers")
+	}
+	var err error
+	for i := range sd.SignerInfos {
+		if err = sd.SignerInfos[i].verify(content, verifier); err == nil {
+			return nil
+		}
+	}
+	return errors.New("pkcs12: signature verification failed: " + err.Error())
+}
+
+func (si *signerInfo) verify(content []byte, verifier *x509.Certificate) error {
+	hash := hashFor(si.DigestAlgorithm.Algorithm)
+	if hash == 0 {
+		return NotImplementedError("unknown digest algorithm: " + oids.Describe(si.DigestAlgorithm.Algorithm))
+	}
+	algorithm := signatureAlgorithmFor(hash, si.SignatureAlgorithm.Algorithm)
+	if algorithm == x509.UnknownSignatureAlgorithm {
+		return NotImplementedError("unknown signature algorithm: " + oids.Describe(si.SignatureAlgorithm.Algorithm))
+	}
+
+	signed := content
+	if len(si.SignedAttrs.FullBytes) != 0 {
+		// The signature covers the DER encoding of the attributes
+		// with their universal SET tag, not the IMPLICIT [0].
+		signed = append([]byte{0x31}, si.SignedAttrs.FullBytes[1:]...)
+		var attrs []pkcs12Attribute
+		if rest, err := asn1.UnmarshalWithParams(signed, &attrs, "set"); err != nil {
+			return err
+		} else if len(rest) != 0 {
+			return errors.New("pkcs12: trailing data found")
+		}
+		h := hash.New()
+		h.Write(content)
+		if err := checkSignedAttributes(attrs, h.Sum(nil)); err != nil {
+			return err
+		}
+	}
+
+	return verifier.CheckSignature(algorithm, signed, si.Signature)
+}
+
+// checkSignedAttributes checks that attrs contain the content type data and
+// the given message digest.
+func checkSignedAttributes(attrs []pkcs12Attribute, digest []byte) error {
+	var haveContentType, haveDigest bool
+	for i := range attrs {
+		value, err := attributeValue(&attrs[i])
+		if err != nil {
+			return err
+		}
+		switch {
+		case attrs[i].Id.Equal(oidContentTypeAttribute):
+			var contentType asn1.ObjectIdentifier
+			if err := unmarshal(value.FullBytes, &contentType); err != nil {
+				return err
+			}
+			if !contentType.Equal(oidDataContentType) {
+				return errors.New("pkcs12: signed content type attribute is not data")
+			}
+			haveContentType = true
+		case attrs[i].Id.Equal(oidMessageDigestAttribute):
+			var messageDigest []byte
+			if err := unmarshal(value.FullBytes, &messageDigest); err != nil {
+				return err
+			}
+			if !bytes.Equal(messageDigest, digest) {
+				return errors.New("pkcs12: message digest does not match signed content")
+			}
+			haveDigest = true
+		}
+	}
+	if !haveContentType || !haveDigest {
+		return errors.New("pkcs12: signed attributes lack content type or message digest")
+	}
+	return nil
+}
+
+// hashFor returns the hash function identified by the digest algorithm
+// algorithm, or 0 if it is unknown.
+func hashFor(algorithm asn1.ObjectIdentifier) crypto.Hash {
+	switch {
+	case algorithm.Equal(oidSHA1):
+		return crypto.SHA1
+	case algorithm.Equal(oidSHA256):
+		return crypto.SHA256
+	case algorithm.Equal(oidSHA384):
+		return crypto.SHA384
+	case algorithm.Equal(oidSHA512):
+		return crypto.SHA512
+	default:
+		return 0
+	}
+}
+
+// signatureAlgorithmFor returns the x509.SignatureAlgorithm for a SignerInfo
+// with the given digest and signature algorithm, which may identify either a
+// signature scheme or just a public key algorithm.
+func signatureAlgorithmFor(hash crypto.Hash, algorithm asn1.ObjectIdentifier) x509.SignatureAlgorithm {
+	switch {
+	case algorithm.Equal(oidRSAEncryption):
+		switch hash {
+		case crypto.SHA1:
+			return x509.SHA1WithRSA
+		case crypto.SHA256:
+			return x509.SHA256WithRSA
+		case crypto.SHA384:
+			return x509.SHA384WithRSA
+		case crypto.SHA512:
+			return x509.SHA512WithRSA
+		}
+	case algorithm.Equal(oidECPublicKey):
+		switch hash {
+		case crypto.SHA1:
+			return x509.ECDSAWithSHA1
+		case crypto.SHA256:
+			return x509.ECDSAWithSHA256
+		case crypto.SHA384:
+			return x509.ECDSAWithSHA384
+		case crypto.SHA512:
+			return x509.ECDSAWithSHA512
+		}
+	case algorithm.Equal(oidSHA1WithRSA):
+		return x509.SHA1WithRSA
+	case algorithm.Equal(oidSHA256WithRSA):
+		return x509.SHA256WithRSA
+	case algorithm.Equal(oidSHA384WithRSA):
+		return x509.SHA384WithRSA
+	case algorithm.Equal(oidSHA512WithRSA):
+		return x509.SHA512WithRSA
+	case algorithm.Equal(oidECDSAWithSHA1):
+		return x509.ECDSAWithSHA1
+	case algorithm.Equal(oidECDSAWithSHA256):
+		return x509.ECDSAWithSHA256
+	case algorithm.Equal(oidECDSAWithSHA384):
+		return x509.ECDSAWithSHA384
+	case algorithm.Equal(oidECDSAWithSHA512):
+		return x509.ECDSAWithSHA512
+	case algorithm.Equal(oidEd25519):
+		return x509.PureEd25519
+	}
+	return x509.UnknownSignatureAlgorithm
+}
@@ -0,0 +1,84 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"encoding/asn1"
+	"sort"
+
+	"github.com/scholar-ink/go-pkcs12/v2/oids"
+)
+
+// A SizeContribution is the share of an encoded file taken by one of its
+// parts, as reported in a SizeError.
+type SizeContribution struct {
+	// Description identifies the part, such as "certificate CN=Example
+	// Root CA" or "private key".
+	Description string
+
+	// Size is the length in bytes of the part's encoding.
+	Size int
+}
+
+// WithMaxSize returns a copy of enc whose encoding methods fail with a
+// *SizeError, rather than returning the file, if it would be longer than
+// limit bytes, as required by a database column or a device's key slot.
+// The error lists the parts of the file by size, so that the caller can
+// tell which certificates to leave out.  A limit of 0 removes the
+// restriction.
+func (enc Encoder) WithMaxSize(limit int) *Encoder {
+	enc.maxSize = limit
+	return &enc
+}
+
+// checkSize returns a *SizeError if pfxData, which holds bags, exceeds the
+// limit of enc.
+func (enc *Encoder) checkSize(pfxData []byte, bags []safeBag) error {
+	if enc.maxSize <= 0 || len(pfxData) <= enc.maxSize {
+		return nil
+	}
+	return &SizeError{Size: len(pfxData), Limit: enc.maxSize, Contributors: estimateSize(len(pfxData), bags)}
+}
+
+// estimateSize attributes the total bytes of a file holding bags to each
+// bag, and the remainder to the file's structure.  The sizes of the bags
+// are those of their plaintext encoding; encryption adds padding, which is
+// counted as overhead.
+func estimateSize(total int, bags []safeBag) []SizeContribution {
+	contributions := make([]SizeContribution, 0, len(bags)+1)
+	overhead := total
+	for i := range bags {
+		data, err := asn1.Marshal(bags[i])
+		if err != nil {
+			continue
+		}
+		contributions = append(contributions, SizeContribution{Description: describeBag(&bags[i]), Size: len(data)})
+		overhead -= len(data)
+	}
+	if overhead > 0 {
+		contributions = append(contributions, SizeContribution{Description: "MAC, encryption and structure overhead", Size: overhead})
+	}
+	sort.SliceStable(contributions, func(i, j int) bool {
+		return contributions[i].Size > contributions[j].Size
+	})
+	return contributions
+}
+
+// describeBag returns a short human-readable description of bag.
+func describeBag(bag *safeBag) string {
+	switch {
+	case bag.Id.Equal(oidCertBag):
+		if cert, err := parseCertBag(bag.Value.Bytes); err == nil {
+			return "certificate " + cert.Subject.String()
+		}
+	case bag.Id.Equal(oidCRLBag):
+		if crl, err := parseCRLBag(bag.Value.Bytes); err == nil {
+			return "CRL of " + crl.Issuer.String()
+		}
+	case bag.Id.Equal(oidPKCS8ShroundedKeyBag), bag.Id.Equal(oidKeyBag):
+		return "private key"
+	}
+	return oids.Name(bag.Id)
+}
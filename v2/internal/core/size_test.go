@@ -0,0 +1,57 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"strings"
+	"testing"
+)
+
+func TestMaxSize(t *testing.T) {
+	key, cert := newTestCertificate(t, "leaf.example.com", nil, nil)
+	_, ca := newTestCertificate(t, strings.Repeat("big", 300), nil, nil)
+
+	pfxData, err := Encode(rand.Reader, key, cert, []*x509.Certificate{ca}, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DefaultEncoder.WithMaxSize(len(pfxData)).Encode(rand.Reader, key, cert, []*x509.Certificate{ca}, "password"); err != nil {
+		t.Errorf("a file of exactly the limit was rejected: %v", err)
+	}
+
+	_, err = DefaultEncoder.WithMaxSize(1000).Encode(rand.Reader, key, cert, []*x509.Certificate{ca}, "password")
+	sizeErr, ok := err.(*SizeError)
+	if !ok {
+		t.Fatalf("got error %v, want a *SizeError", err)
+	}
+	if sizeErr.Size != len(pfxData) || sizeErr.Limit != 1000 {
+		t.Errorf("got size %d and limit %d, want %d and 1000", sizeErr.Size, sizeErr.Limit, len(pfxData))
+	}
+	if len(sizeErr.Contributors) != 4 {
+		t.Fatalf("got contributors %+v, want the three bags and the overhead", sizeErr.Contributors)
+	}
+	if want := "certificate " + ca.Subject.String(); sizeErr.Contributors[0].Description != want {
+		t.Errorf("largest contributor is %q, want %q", sizeErr.Contributors[0].Description, want)
+	}
+	total := 0
+	for i, c := range sizeErr.Contributors {
+		total += c.Size
+		if i > 0 && c.Size > sizeErr.Contributors[i-1].Size {
+			t.Errorf("contributors are not sorted: %+v", sizeErr.Contributors)
+		}
+	}
+	if total != sizeErr.Size {
+		t.Errorf("contributors add up to %d bytes, want %d", total, sizeErr.Size)
+	}
+	if msg := err.Error(); !strings.Contains(msg, "exceeding the limit of 1000") || !strings.Contains(msg, "private key (") {
+		t.Errorf("unhelpful error %q", msg)
+	}
+
+	if _, err := DefaultEncoder.WithMaxSize(100).EncodeTrustStore(rand.Reader, []*x509.Certificate{ca}, "password"); err == nil {
+		t.Error("EncodeTrustStore exceeded the limit")
+	}
+}
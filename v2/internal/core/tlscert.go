@@ -0,0 +1,123 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+)
+
+// TLSCertificateOptions configures EncodeTLSCertificate.  A nil
+// *TLSCertificateOptions is equivalent to the zero value.
+type TLSCertificateOptions struct {
+	// FriendlyName, if not empty, is added as the friendlyName of both
+	// the private key and the leaf certificate.
+	FriendlyName string
+
+	// CSPName, if not empty, is added to the private key bag as the
+	// Microsoft CSP Name attribute, which names the cryptographic service
+	// or key storage provider into which Windows imports the key.  Set it
+	// to PlatformCryptoProvider to have the key imported into the TPM;
+	// most TPMs only accept 2048-bit RSA and P-256 ECDSA keys.
+	CSPName string
+}
+
+// PlatformCryptoProvider is the name of the Windows key storage provider
+// which keeps keys in the TPM, for use as TLSCertificateOptions.CSPName.
+const PlatformCryptoProvider = "Microsoft Platform Crypto Provider"
+
+// ToTLSCertificate decodes pfxData, which must contain exactly one private
+// key, using DefaultDecoder and returns it as a tls.Certificate whose
+// Certificate chain begins with the end-entity certificate, which is also
+// set as Leaf, followed by the CA certificates.
+func ToTLSCertificate(pfxData []byte, password string) (tls.Certificate, error) {
+	return DefaultDecoder.ToTLSCertificate(pfxData, password)
+}
+
+// ToTLSCertificate is like the package-level ToTLSCertificate function, but
+// uses the options of dec.  The leaf is never included twice, even if dec
+// includes it in the chain.
+func (dec *Decoder) ToTLSCertificate(pfxData []byte, password string) (tls.Certificate, error) {
+	privateKey, certificate, caCerts, err := dec.WithLeafInChain(false).DecodeChainWithCAs(pfxData, password)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return *tlsCertificate(privateKey, certificate, caCerts), nil
+}
+
+// EncodeTLSCertificate produces pfxData containing the private key and
+// chain of cert using DefaultEncoder.  See Encoder.EncodeTLSCertificate.
+func EncodeTLSCertificate(rand io.Reader, cert tls.Certificate, password string, opts *TLSCertificateOptions) (pfxData []byte, err error) {
+	return DefaultEncoder.EncodeTLSCertificate(rand, cert, password, opts)
+}
+
+// EncodeTLSCertificate produces pfxData containing the private key and
+// chain of cert, the mirror of ToTLSCertificate.  cert.Certificate[0] is
+// the end-entity certificate, as in crypto/tls, and the remaining
+// certificates are encoded as CA certificates in the same order.  If
+// cert.Leaf is set it must be the same certificate.  The private key must
+// implement crypto.Signer and match the end-entity certificate.
+func (enc *Encoder) EncodeTLSCertificate(rand io.Reader, cert tls.Certificate, password string, opts *TLSCertificateOptions) (pfxData []byte, err error) {
+	if opts == nil {
+		opts = new(TLSCertificateOptions)
+	}
+	certs, err := tlsCertificateChain(cert)
+	if err != nil {
+		return nil, err
+	}
+
+	var attrs []pkcs12Attribute
+	if opts.FriendlyName != "" {
+		attr, err := makeFriendlyNameAttribute(opts.FriendlyName)
+		if err != nil {
+			return nil, err
+		}
+		attrs = append(attrs, attr)
+	}
+	var keyAttrs []pkcs12Attribute
+	if opts.CSPName != "" {
+		attr, err := makeBMPStringAttribute(oidMicrosoftCSPName, opts.CSPName)
+		if err != nil {
+			return nil, err
+		}
+		keyAttrs = append(keyAttrs, attr)
+	}
+	return enc.encode(rand, cert.PrivateKey, certs[0], certs[1:], password, attrs, keyAttrs)
+}
+
+// tlsCertificateChain parses the chain of cert, which must begin with the
+// end-entity certificate, and checks that its private key implements
+// crypto.Signer and matches that certificate.
+func tlsCertificateChain(cert tls.Certificate) (certs []*x509.Certificate, err error) {
+	if len(cert.Certificate) == 0 {
+		return nil, errors.New("pkcs12: tls.Certificate has no certificates")
+	}
+	certs = make([]*x509.Certificate, len(cert.Certificate))
+	for i, der := range cert.Certificate {
+		if i == 0 && cert.Leaf != nil {
+			if !bytes.Equal(cert.Leaf.Raw, der) {
+				return nil, errors.New("pkcs12: tls.Certificate Leaf is not its first certificate")
+			}
+			certs[0] = cert.Leaf
+			continue
+		}
+		if certs[i], err = x509.ParseCertificate(der); err != nil {
+			return nil, errors.New("pkcs12: error parsing certificate: " + err.Error())
+		}
+	}
+
+	signer, ok := cert.PrivateKey.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("pkcs12: private key does not implement crypto.Signer")
+	}
+	if !publicKeyMatches(signer.Public(), certs[0]) {
+		return nil, errors.New("pkcs12: private key does not match certificate")
+	}
+	return certs, nil
+}
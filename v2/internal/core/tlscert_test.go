@@ -0,0 +1,89 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"crypto/rand"
+	"crypto/tls"
+	"testing"
+)
+
+func TestEncodeTLSCertificate(t *testing.T) {
+	caKey, ca := newTestCertificate(t, "ca.example.com", nil, nil)
+	key, leaf := newTestCertificate(t, "tls.example.com", ca, caKey)
+	cert := tls.Certificate{
+		Certificate: [][]byte{leaf.Raw, ca.Raw},
+		PrivateKey:  key,
+	}
+
+	pfxData, err := EncodeTLSCertificate(rand.Reader, cert, "password", &TLSCertificateOptions{FriendlyName: "server"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := DefaultDecoder.WithLeafInChain(true).ToTLSCertificate(pfxData, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded.Certificate) != 2 || string(decoded.Certificate[0]) != string(leaf.Raw) || string(decoded.Certificate[1]) != string(ca.Raw) {
+		t.Error("the chain was not preserved")
+	}
+	if !decoded.Leaf.Equal(leaf) || !key.Equal(decoded.PrivateKey) {
+		t.Error("the leaf or key was not preserved")
+	}
+	blocks, err := ToPEM(pfxData, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, block := range blocks {
+		if string(block.Bytes) == string(ca.Raw) {
+			continue
+		}
+		if block.Headers["friendlyName"] != "server" {
+			t.Errorf("%s has friendlyName %q, want %q", block.Type, block.Headers["friendlyName"], "server")
+		}
+	}
+
+	for name, bad := range map[string]tls.Certificate{
+		"no certificates": {PrivateKey: key},
+		"wrong key":       {Certificate: [][]byte{leaf.Raw}, PrivateKey: caKey},
+		"wrong order":     {Certificate: [][]byte{ca.Raw, leaf.Raw}, PrivateKey: key},
+		"mismatched leaf": {Certificate: [][]byte{leaf.Raw}, PrivateKey: key, Leaf: ca},
+	} {
+		if _, err := EncodeTLSCertificate(rand.Reader, bad, "password", nil); err == nil {
+			t.Errorf("%s: EncodeTLSCertificate succeeded", name)
+		}
+	}
+}
+
+func TestEncodeTLSCertificateCSPName(t *testing.T) {
+	key, cert := newTestCertificate(t, "tpm.example.com", nil, nil)
+	pfxData, err := EncodeTLSCertificate(rand.Reader, tls.Certificate{
+		Certificate: [][]byte{cert.Raw},
+		PrivateKey:  key,
+	}, "password", &TLSCertificateOptions{FriendlyName: "device", CSPName: PlatformCryptoProvider})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	blocks, err := ToPEM(pfxData, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != 2 {
+		t.Fatalf("got %d blocks, want 2", len(blocks))
+	}
+	for _, block := range blocks {
+		csp, ok := block.Headers["Microsoft CSP Name"]
+		switch {
+		case block.Type == privateKeyType && csp != PlatformCryptoProvider:
+			t.Errorf("key has CSP name %q", csp)
+		case block.Type == certificateType && ok:
+			t.Errorf("certificate has CSP name %q", csp)
+		}
+		if block.Headers["friendlyName"] != "device" {
+			t.Errorf("%s has friendlyName %q", block.Type, block.Headers["friendlyName"])
+		}
+	}
+}
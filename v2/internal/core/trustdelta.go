@@ -0,0 +1,81 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"errors"
+	"io"
+)
+
+// ApplyTrustDelta returns a copy of the trust store base in which the
+// certificates of remove are removed and those of add are added, using
+// DefaultEncoder and entropy from crypto/rand.  See
+// Encoder.ApplyTrustDelta.
+func ApplyTrustDelta(base []byte, add, remove []*x509.Certificate, password string) (pfxData []byte, err error) {
+	return DefaultEncoder.ApplyTrustDelta(rand.Reader, base, add, remove, password)
+}
+
+// ApplyTrustDelta returns a copy of the trust store base, decoded with
+// DefaultDecoder and password, in which the certificates of remove are
+// removed and those of add are added, protected with the algorithms of enc
+// and password.  It is intended for pipelines which periodically refresh a
+// CA bundle.
+//
+// Entries which are kept, including CRL bags, retain their bags exactly as
+// they appear in base, attributes and all, and keep their order, except
+// that compressed bags are stored decompressed unless enc is configured
+// with WithBagCompression.  The certificates of add follow them, marked as
+// trusted and named as EncodeTrustStore does; a certificate which is
+// already in the result is not added again.  Certificates of remove which
+// are not in base are ignored.  base must not contain private keys.
+func (enc *Encoder) ApplyTrustDelta(rand io.Reader, base []byte, add, remove []*x509.Certificate, password string) (pfxData []byte, err error) {
+	encodedPassword, err := bmpString(password)
+	if err != nil {
+		return nil, err
+	}
+	bags, _, err := DefaultDecoder.getSafeContents(base, encodedPassword)
+	if err != nil {
+		return nil, err
+	}
+
+	removed := make(map[string]bool, len(remove))
+	for _, cert := range remove {
+		removed[string(cert.Raw)] = true
+	}
+	present := make(map[string]bool, len(bags)+len(add))
+	kept := make([]safeBag, 0, len(bags)+len(add))
+	for _, bag := range bags {
+		switch {
+		case bag.Id.Equal(oidCRLBag):
+		case bag.Id.Equal(oidCertBag):
+			der, err := decodeCertBag(bag.Value.Bytes)
+			if err != nil {
+				return nil, err
+			}
+			if removed[string(der)] {
+				continue
+			}
+			present[string(der)] = true
+		default:
+			return nil, errors.New("pkcs12: expected only certificate bags")
+		}
+		kept = append(kept, bag)
+	}
+
+	var added []*x509.Certificate
+	for _, cert := range add {
+		if !present[string(cert.Raw)] {
+			present[string(cert.Raw)] = true
+			added = append(added, cert)
+		}
+	}
+	addedBags, err := trustedCertBags(added)
+	if err != nil {
+		return nil, err
+	}
+	return enc.encodeTrustStoreBags(rand, append(kept, addedBags...), password)
+}
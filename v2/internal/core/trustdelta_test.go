@@ -0,0 +1,71 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/asn1"
+	"testing"
+)
+
+func TestApplyTrustDelta(t *testing.T) {
+	_, ca1 := newTestCertificate(t, "ca1.example.com", nil, nil)
+	_, ca2 := newTestCertificate(t, "ca2.example.com", nil, nil)
+	_, ca3 := newTestCertificate(t, "ca3.example.com", nil, nil)
+
+	// Give ca2 an attribute which EncodeTrustStore would not produce.
+	extraAttr, err := makeFriendlyNameAttribute("Custom name")
+	if err != nil {
+		t.Fatal(err)
+	}
+	customBag, err := makeCertBag(ca2.Raw, []pkcs12Attribute{extraAttr})
+	if err != nil {
+		t.Fatal(err)
+	}
+	base, err := DefaultEncoder.encodeTrustStore(rand.Reader, []*x509.Certificate{ca1}, []safeBag{*customBag}, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	updated, err := ApplyTrustDelta(base, []*x509.Certificate{ca3, ca2}, []*x509.Certificate{ca1}, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	certs, err := DecodeTrustStore(updated, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(certs) != 2 || !certs[0].Equal(ca2) || !certs[1].Equal(ca3) {
+		t.Fatalf("got %d certificates, want ca2 followed by ca3", len(certs))
+	}
+
+	encodedPassword, _ := bmpString("password")
+	bags, _, err := DefaultDecoder.getSafeContents(updated, encodedPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := asn1.Marshal(bags[0])
+	want, _ := asn1.Marshal(*customBag)
+	if !bytes.Equal(got, want) {
+		t.Error("the bag of a kept certificate was changed")
+	}
+	if len(bags[1].Attributes) != 2 {
+		t.Errorf("added certificate bag has %d attributes, want the trust and friendlyName attributes", len(bags[1].Attributes))
+	}
+
+	key, cert := newTestCertificate(t, "www.example.com", nil, nil)
+	identity, err := Encode(rand.Reader, key, cert, nil, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ApplyTrustDelta(identity, []*x509.Certificate{ca3}, nil, "password"); err == nil {
+		t.Error("applied a delta to a file with a private key")
+	}
+	if _, err := ApplyTrustDelta(base, nil, nil, "wrong"); err != ErrIncorrectPassword {
+		t.Errorf("got error %v for the wrong password, want ErrIncorrectPassword", err)
+	}
+}
@@ -0,0 +1,245 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"errors"
+	"io"
+	"strconv"
+)
+
+var (
+	// oidJavaTrustStore is the attribute which marks a certificate bag as
+	// a trusted certificate entry in Java key stores.
+	oidJavaTrustStore      = asn1.ObjectIdentifier([]int{2, 16, 840, 1, 113894, 746875, 1, 1})
+	oidAnyExtendedKeyUsage = asn1.ObjectIdentifier([]int{2, 5, 29, 37, 0})
+)
+
+// A DuplicatePolicy specifies how a Decoder handles a certificate which
+// appears more than once in a file, possibly with different attributes.
+// Certificates are duplicates if their DER encodings are identical.
+type DuplicatePolicy int
+
+const (
+	// DeduplicateCertificates keeps only the first occurrence of each
+	// certificate.  It is the default.
+	DeduplicateCertificates DuplicatePolicy = iota
+
+	// KeepDuplicateCertificates returns every occurrence of each
+	// certificate.
+	KeepDuplicateCertificates
+
+	// RejectDuplicateCertificates fails decoding with
+	// ErrDuplicateCertificate.
+	RejectDuplicateCertificates
+)
+
+// WithDuplicateCertificates returns a copy of dec which handles duplicate
+// certificates in DecodeChain and DecodeTrustStore according to policy.
+func (dec Decoder) WithDuplicateCertificates(policy DuplicatePolicy) *Decoder {
+	dec.duplicates = policy
+	return &dec
+}
+
+// handleDuplicates applies dec's DuplicatePolicy to certs, preserving the
+// order of the certificates which are kept.
+func (dec *Decoder) handleDuplicates(certs []*x509.Certificate) ([]*x509.Certificate, error) {
+	if dec.duplicates == KeepDuplicateCertificates {
+		return certs, nil
+	}
+	seen := make(map[string]bool, len(certs))
+	kept := make([]*x509.Certificate, 0, len(certs))
+	for _, cert := range certs {
+		if seen[string(cert.Raw)] {
+			if dec.duplicates == RejectDuplicateCertificates {
+				return nil, ErrDuplicateCertificate
+			}
+			continue
+		}
+		seen[string(cert.Raw)] = true
+		kept = append(kept, cert)
+	}
+	return kept, nil
+}
+
+// WithIgnoredKeyBags returns a copy of dec whose DecodeTrustStore skips
+// private key bags rather than failing, since some tools leave an orphaned
+// key in the trust stores they export.  If report is non-nil, it is called
+// for each skipped key bag with the bag's localKeyId, or nil if it has none.
+func (dec Decoder) WithIgnoredKeyBags(report func(localKeyID []byte)) *Decoder {
+	dec.ignoreKeyBags = true
+	dec.reportKeyBag = report
+	return &dec
+}
+
+// DecodeTrustStore extracts the certificates from pfxData, which must be a
+// PKCS#12 file containing exclusively certificates with no associated
+// private keys, such as a Java trust store, using DefaultDecoder.
+// Certificates are returned in the order in which they appear in the file;
+// duplicates are handled according to the Decoder's DuplicatePolicy.  CRL
+// bags are skipped; use DecodeTrustStoreWithCRLs to obtain them.
+func DecodeTrustStore(pfxData []byte, password string) (certs []*x509.Certificate, err error) {
+	return DefaultDecoder.DecodeTrustStore(pfxData, password)
+}
+
+// DecodeTrustStore is like the package-level DecodeTrustStore function, but
+// uses the options of dec.
+func (dec *Decoder) DecodeTrustStore(pfxData []byte, password string) (certs []*x509.Certificate, err error) {
+	certs, _, err = dec.decodeTrustStore(pfxData, password, false)
+	return certs, err
+}
+
+// decodeTrustStore implements DecodeTrustStore and DecodeTrustStoreWithCRLs.
+// CRL bags are parsed if withCRLs is set, and skipped otherwise.
+func (dec *Decoder) decodeTrustStore(pfxData []byte, password string, withCRLs bool) (certs []*x509.Certificate, crls []*x509.RevocationList, err error) {
+	encodedPassword, err := bmpString(password)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	bags, _, err := dec.getSafeContents(pfxData, encodedPassword)
+	if err != nil {
+		return nil, nil, err
+	}
+	if dec.emptyContainer(bags) {
+		return nil, nil, nil
+	}
+
+	for i, bag := range bags {
+		if dec.ignoreKeyBags && (bag.Id.Equal(oidPKCS8ShroundedKeyBag) || bag.Id.Equal(oidKeyBag)) {
+			if dec.reportKeyBag != nil {
+				dec.reportKeyBag(localKeyID(&bag))
+			}
+			dec.bagDone(i, len(bags))
+			continue
+		}
+		if bag.Id.Equal(oidCRLBag) {
+			if withCRLs {
+				crl, err := parseCRLBag(bag.Value.Bytes)
+				if err != nil {
+					return nil, nil, err
+				}
+				crls = append(crls, crl)
+			}
+			dec.bagDone(i, len(bags))
+			continue
+		}
+		if !bag.Id.Equal(oidCertBag) {
+			return nil, nil, errors.New("pkcs12: expected only certificate bags")
+		}
+		cert, err := dec.parseCert(bag.Value.Bytes)
+		if err != nil {
+			return nil, nil, err
+		}
+		certs = append(certs, cert)
+		dec.bagDone(i, len(bags))
+	}
+	certs, err = dec.handleDuplicates(certs)
+	if err != nil {
+		return nil, nil, err
+	}
+	return certs, crls, nil
+}
+
+// localKeyID returns the value of bag's localKeyId attribute, or nil if it
+// has none or it is malformed.
+func localKeyID(bag *safeBag) []byte {
+	for i := range bag.Attributes {
+		if !bag.Attributes[i].Id.Equal(oidLocalKeyID) {
+			continue
+		}
+		value, err := attributeValue(&bag.Attributes[i])
+		if err != nil {
+			return nil
+		}
+		id, err := decodeLocalKeyID(value)
+		if err != nil {
+			return nil
+		}
+		return id
+	}
+	return nil
+}
+
+// EncodeTrustStore produces pfxData containing any number of CA certificates
+// (certs) to be trusted, using DefaultEncoder.  The certificates are marked
+// as trusted with the attribute used by Java key stores, so the output can
+// be used as a Java trust store, and carry a friendlyName equal to their
+// subject.
+func EncodeTrustStore(rand io.Reader, certs []*x509.Certificate, password string) (pfxData []byte, err error) {
+	return DefaultEncoder.EncodeTrustStore(rand, certs, password)
+}
+
+// EncodeTrustStore is like the package-level EncodeTrustStore function, but
+// uses the algorithms of enc.
+func (enc *Encoder) EncodeTrustStore(rand io.Reader, certs []*x509.Certificate, password string) (pfxData []byte, err error) {
+	return enc.encodeTrustStore(rand, certs, nil, password)
+}
+
+// encodeTrustStore implements EncodeTrustStore.  extraBags are stored after
+// the certificate bags.
+func (enc *Encoder) encodeTrustStore(rand io.Reader, certs []*x509.Certificate, extraBags []safeBag, password string) (pfxData []byte, err error) {
+	certBags, err := trustedCertBags(certs)
+	if err != nil {
+		return nil, err
+	}
+	return enc.encodeTrustStoreBags(rand, append(certBags, extraBags...), password)
+}
+
+// trustedCertBags returns a certificate bag for each of certs, marked as
+// trusted and named as EncodeTrustStore describes.
+func trustedCertBags(certs []*x509.Certificate) (certBags []safeBag, err error) {
+	var trustAttr pkcs12Attribute
+	trustAttr.Id = oidJavaTrustStore
+	trustAttr.Value.Class = 0
+	trustAttr.Value.Tag = 17
+	trustAttr.Value.IsCompound = true
+	if trustAttr.Value.Bytes, err = asn1.Marshal(oidAnyExtendedKeyUsage); err != nil {
+		return nil, err
+	}
+
+	certBags = make([]safeBag, 0, len(certs))
+	for i, cert := range certs {
+		if cert == nil {
+			return nil, errors.New("pkcs12: certificate " + strconv.Itoa(i) + " is nil")
+		}
+		friendlyNameAttr, err := makeFriendlyNameAttribute(cert.Subject.String())
+		if err != nil {
+			return nil, err
+		}
+		certBag, err := makeCertBag(cert.Raw, []pkcs12Attribute{trustAttr, friendlyNameAttr})
+		if err != nil {
+			return nil, err
+		}
+		certBags = append(certBags, *certBag)
+	}
+	return certBags, nil
+}
+
+// encodeTrustStoreBags returns a trust store whose authenticated safe has a
+// single SafeContents, encrypted with the certificate algorithm of enc,
+// containing bags.
+func (enc *Encoder) encodeTrustStoreBags(rand io.Reader, bags []safeBag, password string) (pfxData []byte, err error) {
+	if enc.isLegacy() && legacyEncodingDisabled.Load() {
+		return nil, ErrLegacyEncodingDisabled
+	}
+	rand = enc.entropy(rand)
+
+	encodedPassword, err := bmpString(password)
+	if err != nil {
+		return nil, err
+	}
+	if bags, err = enc.compressBags(bags); err != nil {
+		return nil, err
+	}
+
+	authenticatedSafe := make([]contentInfo, 1)
+	if authenticatedSafe[0], err = makeSafeContents(rand, bags, enc.certAlgorithm, enc.contentPassword(encodedPassword), enc.pbeSettings(), enc.monitor()); err != nil {
+		return nil, err
+	}
+	return enc.makePFX(rand, authenticatedSafe, encodedPassword, bags)
+}
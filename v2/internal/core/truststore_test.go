@@ -0,0 +1,163 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/asn1"
+	"strconv"
+	"testing"
+)
+
+func TestTrustStore(t *testing.T) {
+	var certs []*x509.Certificate
+	for _, name := range []string{"CA 1", "CA 2", "CA 3"} {
+		_, cert := newTestCertificate(t, name, nil, nil)
+		certs = append(certs, cert)
+	}
+	pfxData, err := EncodeTrustStore(rand.Reader, certs, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded, err := DecodeTrustStore(pfxData, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded) != len(certs) {
+		t.Fatalf("got %d certificates, want %d", len(decoded), len(certs))
+	}
+	for i := range certs {
+		if !decoded[i].Equal(certs[i]) {
+			t.Errorf("#%d: got %q, want %q", i, decoded[i].Subject, certs[i].Subject)
+		}
+	}
+
+	blocks, err := ToPEM(pfxData, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := blocks[0].Headers[oidJavaTrustStore.String()]; got == "" {
+		t.Error("Java trust attribute missing")
+	}
+	if got := blocks[0].Headers["friendlyName"]; got != "CN=CA 1" {
+		t.Errorf("got friendlyName %q, want \"CN=CA 1\"", got)
+	}
+
+	key, leaf := newTestCertificate(t, "leaf.example.com", nil, nil)
+	if identity, err := Encode(rand.Reader, key, leaf, nil, "password"); err != nil {
+		t.Fatal(err)
+	} else if _, err := DecodeTrustStore(identity, "password"); err == nil {
+		t.Error("DecodeTrustStore accepted a file with a private key")
+	}
+}
+
+func TestDuplicateCertificates(t *testing.T) {
+	_, ca1 := newTestCertificate(t, "CA 1", nil, nil)
+	_, ca2 := newTestCertificate(t, "CA 2", nil, nil)
+	pfxData, err := EncodeTrustStore(rand.Reader, []*x509.Certificate{ca2, ca1, ca2, ca1}, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certs, err := DecodeTrustStore(pfxData, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(certs) != 2 || !certs[0].Equal(ca2) || !certs[1].Equal(ca1) {
+		t.Errorf("DeduplicateCertificates: got %d certificates in unexpected order", len(certs))
+	}
+
+	if certs, err = DefaultDecoder.WithDuplicateCertificates(KeepDuplicateCertificates).DecodeTrustStore(pfxData, "password"); err != nil {
+		t.Fatal(err)
+	} else if len(certs) != 4 {
+		t.Errorf("KeepDuplicateCertificates: got %d certificates, want 4", len(certs))
+	}
+
+	if _, err := DefaultDecoder.WithDuplicateCertificates(RejectDuplicateCertificates).DecodeTrustStore(pfxData, "password"); err != ErrDuplicateCertificate {
+		t.Errorf("RejectDuplicateCertificates: got error %v, want ErrDuplicateCertificate", err)
+	}
+
+	rootKey, root := newTestCertificate(t, "root", nil, nil)
+	leafKey, leaf := newTestCertificate(t, "leaf.example.com", root, rootKey)
+	identity, err := Encode(rand.Reader, leafKey, leaf, []*x509.Certificate{root, root}, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, caCerts, err := DecodeChainWithCAs(identity, "password"); err != nil {
+		t.Fatal(err)
+	} else if len(caCerts) != 1 {
+		t.Errorf("DecodeChainWithCAs: got %d CA certificates, want 1", len(caCerts))
+	}
+}
+
+func TestTrustStoreIgnoredKeyBags(t *testing.T) {
+	key, leaf := newTestCertificate(t, "orphan.example.com", nil, nil)
+	pfxData, err := Encode(rand.Reader, key, leaf, nil, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var reported [][]byte
+	certs, err := DefaultDecoder.WithIgnoredKeyBags(func(localKeyID []byte) {
+		reported = append(reported, localKeyID)
+	}).DecodeTrustStore(pfxData, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(certs) != 1 || !certs[0].Equal(leaf) {
+		t.Errorf("unexpected certificates %v", certs)
+	}
+	fingerprint := sha1.Sum(leaf.Raw)
+	if len(reported) != 1 || !bytes.Equal(reported[0], fingerprint[:]) {
+		t.Errorf("got reported key bags %x, want [%x]", reported, fingerprint)
+	}
+
+	if _, err := DefaultDecoder.WithIgnoredKeyBags(nil).DecodeTrustStore(pfxData, "password"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMarshalSafeContents(t *testing.T) {
+	_, cert := newTestCertificate(t, "CA", nil, nil)
+	bags, err := trustedCertBags([]*x509.Certificate{cert, cert, cert})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for n := 0; n <= len(bags); n++ {
+		want, err := asn1.Marshal(bags[:n])
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := marshalSafeContents(bags[:n])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("%d bags: got %x, want %x", n, got, want)
+		}
+	}
+}
+
+func BenchmarkEncodeTrustStore(b *testing.B) {
+	_, cert := newTestCertificate(b, "CA", nil, nil)
+	for _, n := range []int{100, 1000, 10000} {
+		certs := make([]*x509.Certificate, n)
+		for i := range certs {
+			certs[i] = cert
+		}
+		b.Run(strconv.Itoa(n), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := Modern.EncodeTrustStore(rand.Reader, certs, "password"); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
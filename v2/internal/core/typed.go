@@ -0,0 +1,45 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"crypto"
+	"crypto/x509"
+	"fmt"
+	"reflect"
+)
+
+// KeyTypeError is returned by DecodeTyped when the private key of a file
+// is not of the expected type.
+type KeyTypeError struct {
+	// Got is the type of the private key found, and Want the type
+	// expected.
+	Got, Want reflect.Type
+}
+
+func (e *KeyTypeError) Error() string {
+	return fmt.Sprintf("pkcs12: private key is %v, not %v", e.Got, e.Want)
+}
+
+// DecodeTyped is like Decode, but returns the private key as a K, such as
+// *ecdsa.PrivateKey or crypto.Signer, and fails with a *KeyTypeError if
+// it is not one.  It uses DefaultDecoder; see DecodeTypedWith.
+func DecodeTyped[K crypto.PrivateKey](pfxData []byte, password string) (K, *x509.Certificate, error) {
+	return DecodeTypedWith[K](DefaultDecoder, pfxData, password)
+}
+
+// DecodeTypedWith is like DecodeTyped, but uses the options of dec.
+func DecodeTypedWith[K crypto.PrivateKey](dec *Decoder, pfxData []byte, password string) (K, *x509.Certificate, error) {
+	var typed K
+	privateKey, certificate, err := dec.Decode(pfxData, password)
+	if err != nil {
+		return typed, nil, err
+	}
+	typed, ok := privateKey.(K)
+	if !ok {
+		return typed, nil, &KeyTypeError{Got: reflect.TypeOf(privateKey), Want: reflect.TypeOf((*K)(nil)).Elem()}
+	}
+	return typed, certificate, nil
+}
@@ -0,0 +1,49 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"testing"
+)
+
+func TestDecodeTyped(t *testing.T) {
+	key, cert := newTestCertificate(t, "www.example.com", nil, nil)
+	pfxData, err := Encode(rand.Reader, key, cert, nil, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ecKey, certificate, err := DecodeTyped[*ecdsa.PrivateKey](pfxData, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ecKey.Equal(key) || !certificate.Equal(cert) {
+		t.Error("decoded identity does not match")
+	}
+	if _, _, err := DecodeTyped[crypto.Signer](pfxData, "password"); err != nil {
+		t.Errorf("crypto.Signer: %v", err)
+	}
+
+	rsaKey, certificate, err := DecodeTyped[*rsa.PrivateKey](pfxData, "password")
+	var typeErr *KeyTypeError
+	if !errors.As(err, &typeErr) {
+		t.Fatalf("got error %v for the wrong key type, want a *KeyTypeError", err)
+	}
+	if rsaKey != nil || certificate != nil {
+		t.Error("returned a key or certificate with the error")
+	}
+	if want := "pkcs12: private key is *ecdsa.PrivateKey, not *rsa.PrivateKey"; err.Error() != want {
+		t.Errorf("got error %q, want %q", err, want)
+	}
+
+	if _, _, err := DecodeTypedWith[*ecdsa.PrivateKey](DefaultDecoder, pfxData, "wrong"); err != ErrIncorrectPassword {
+		t.Errorf("got error %v for the wrong password", err)
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"context"
+	"runtime"
+)
+
+// ctxCheckInterval is the number of key derivation iterations between
+// checks of the context set with WithContext.
+const ctxCheckInterval = 1024
+
+// WithYieldInterval returns a copy of dec which calls runtime.Gosched
+// after every iterations iterations of each key derivation, so that a
+// decode with a high iteration count does not starve other goroutines on
+// single-core devices.  An interval of zero or less, the default, never
+// yields.
+func (dec Decoder) WithYieldInterval(iterations int) *Decoder {
+	dec.yieldEvery = iterations
+	return &dec
+}
+
+// WithYieldInterval returns a copy of enc which yields during key
+// derivations.  See Decoder.WithYieldInterval.
+func (enc Encoder) WithYieldInterval(iterations int) *Encoder {
+	enc.yieldEvery = iterations
+	return &enc
+}
+
+// WithContext returns a copy of dec which abandons key derivations once
+// ctx is done, making the decoding functions return ctx.Err().  ctx is
+// checked periodically during each derivation, so that a long-running
+// decode can be cancelled or given a deadline.
+func (dec Decoder) WithContext(ctx context.Context) *Decoder {
+	dec.ctx = ctx
+	return &dec
+}
+
+// WithContext returns a copy of enc which abandons key derivations once
+// ctx is done, making the encoding functions return ctx.Err().  See
+// Decoder.WithContext.
+func (enc Encoder) WithContext(ctx context.Context) *Encoder {
+	enc.ctx = ctx
+	return &enc
+}
+
+// pause yields or checks the context, as configured, after the done-th
+// iteration of a key derivation.  It returns false once the context is
+// done.
+func (m *kdfMonitor) pause(done int) bool {
+	if m.cancelled != nil {
+		return false
+	}
+	if m.yieldEvery > 0 && done%m.yieldEvery == 0 {
+		runtime.Gosched()
+	}
+	if m.ctx != nil && (done == 1 || done%ctxCheckInterval == 0) {
+		if err := m.ctx.Err(); err != nil {
+			m.cancelled = err
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,64 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"context"
+	"crypto/rand"
+	"testing"
+)
+
+func TestYieldInterval(t *testing.T) {
+	key, cert := newTestCertificate(t, "yield.example.com", nil, nil)
+	pfxData, err := DefaultEncoder.WithYieldInterval(100).Encode(rand.Reader, key, cert, nil, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	privateKey, _, err := DefaultDecoder.WithYieldInterval(1).Decode(pfxData, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !key.Equal(privateKey) {
+		t.Error("decoded key does not match")
+	}
+}
+
+func TestContext(t *testing.T) {
+	key, cert := newTestCertificate(t, "context.example.com", nil, nil)
+	pfxData, err := Encode(rand.Reader, key, cert, nil, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if _, _, err := DefaultDecoder.WithContext(ctx).Decode(pfxData, "password"); err != nil {
+		t.Fatalf("Decode failed before cancellation: %v", err)
+	}
+	cancel()
+
+	if _, err := DefaultEncoder.WithContext(ctx).Encode(rand.Reader, key, cert, nil, "password"); err != context.Canceled {
+		t.Errorf("Encode returned %v, want context.Canceled", err)
+	}
+	dec := DefaultDecoder.WithContext(ctx)
+	if _, _, err := dec.Decode(pfxData, "password"); err != context.Canceled {
+		t.Errorf("Decode returned %v, want context.Canceled", err)
+	}
+
+	// Shrouded key errors are otherwise wrapped with a description.
+	encodedPassword, err := bmpString("password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bag, err := encodePkcs8ShroudedKeyBag(rand.Reader, key, cert, oidPBEWithSHAAnd3KeyTripleDESCBC, encodedPassword, pbeSettings{iterations: 2048}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dec.decodePkcs8ShroudedKeyBag(bag, encodedPassword); err != context.Canceled {
+		t.Errorf("decodePkcs8ShroudedKeyBag returned %v, want context.Canceled", err)
+	}
+	if _, err := DefaultDecoder.decodePkcs8ShroudedKeyBag(bag, encodedPassword); err != nil {
+		t.Error(err)
+	}
+}
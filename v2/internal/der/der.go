@@ -0,0 +1,316 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package der implements a non-reflective reader of DER-encoded ASN.1,
+// modeled on golang.org/x/crypto/cryptobyte.  Unlike encoding/asn1, it
+// reports the byte offset in the original input at which a syntax error
+// occurred.  It also writes element headers, so that large structures can
+// be assembled from already encoded elements without encoding/asn1
+// copying them again.
+package der
+
+import (
+	"encoding/asn1"
+	"math"
+	"strconv"
+)
+
+// A Tag is an ASN.1 identifier octet.  Elements with high tag numbers (31
+// and above) can only be read with ReadAnyElement and ReadAnyRawValue.
+type Tag uint8
+
+const (
+	classConstructed     = 0x20
+	classContextSpecific = 0x80
+
+	Integer     Tag = 0x02
+	OctetString Tag = 0x04
+	Null        Tag = 0x05
+	OID         Tag = 0x06
+	Sequence    Tag = 0x10 | classConstructed
+	Set         Tag = 0x11 | classConstructed
+)
+
+// Constructed returns the tag with the constructed bit set.
+func (t Tag) Constructed() Tag { return t | classConstructed }
+
+// ContextSpecific returns the tag with the context-specific class set.
+func (t Tag) ContextSpecific() Tag { return t | classContextSpecific }
+
+// A SyntaxError describes malformed input.
+type SyntaxError struct {
+	Offset int // offset of the offending element in the original input
+	Msg    string
+}
+
+func (e *SyntaxError) Error() string {
+	return "der: " + e.Msg + " at offset " + strconv.Itoa(e.Offset)
+}
+
+// A String is a DER input being read, together with its offset in the
+// original input.
+type String struct {
+	b   []byte
+	off int
+}
+
+// NewString returns a String reading b.
+func NewString(b []byte) String { return String{b: b} }
+
+// Bytes returns the unread input.
+func (s String) Bytes() []byte { return s.b }
+
+// Empty reports whether all of s has been read.
+func (s String) Empty() bool { return len(s.b) == 0 }
+
+// Offset returns the offset of the unread input in the original input.
+func (s String) Offset() int { return s.off }
+
+func (s *String) errorf(msg string) error {
+	return &SyntaxError{Offset: s.off, Msg: msg}
+}
+
+// PeekTag reports whether the next element of s has tag.
+func (s String) PeekTag(tag Tag) bool {
+	return len(s.b) > 0 && Tag(s.b[0]) == tag
+}
+
+// ReadAnyElement reads the next element of s, returning its contents and
+// its complete encoding.  Its tag is the first byte of full unless it uses
+// the high tag number form.
+func (s *String) ReadAnyElement() (contents String, full []byte, err error) {
+	_, _, _, header, err := s.readIdentifier()
+	if err != nil {
+		return String{}, nil, err
+	}
+	if header == len(s.b) {
+		return String{}, nil, s.errorf("truncated element")
+	}
+
+	length := int(s.b[header])
+	header++
+	if length&0x80 != 0 {
+		n := length & 0x7f
+		if n == 0 {
+			return String{}, nil, s.errorf("indefinite length")
+		}
+		if n > 4 || len(s.b) < header+n {
+			return String{}, nil, s.errorf("invalid length")
+		}
+		length = 0
+		for _, c := range s.b[header : header+n] {
+			length = length<<8 | int(c)
+		}
+		if length < 0x80 || length>>(8*(n-1)) == 0 {
+			return String{}, nil, s.errorf("non-minimal length")
+		}
+		header += n
+	}
+	if length > len(s.b)-header {
+		return String{}, nil, s.errorf("truncated element")
+	}
+
+	full = s.b[:header+length]
+	contents = String{b: full[header:], off: s.off + header}
+	s.b = s.b[len(full):]
+	s.off += len(full)
+	return contents, full, nil
+}
+
+// HeaderLen returns the number of octets of the header of an element with
+// a single identifier octet and length octets of contents.
+func HeaderLen(length int) int {
+	if length < 0x80 {
+		return 2
+	}
+	n := 2
+	for ; length > 0; length >>= 8 {
+		n++
+	}
+	return n
+}
+
+// AppendHeader appends the identifier and length octets of an element with
+// the given tag and length octets of contents to b, which may then be
+// followed by the contents.
+func AppendHeader(b []byte, tag Tag, length int) []byte {
+	b = append(b, byte(tag))
+	if length < 0x80 {
+		return append(b, byte(length))
+	}
+	n := 0
+	for l := length; l > 0; l >>= 8 {
+		n++
+	}
+	b = append(b, 0x80|byte(n))
+	for i := n - 1; i >= 0; i-- {
+		b = append(b, byte(length>>(8*i)))
+	}
+	return b
+}
+
+// readIdentifier parses the identifier octets at the start of s, returning
+// the class, tag number, constructed bit and length of the identifier.
+func (s *String) readIdentifier() (class, number int, constructed bool, n int, err error) {
+	if len(s.b) == 0 {
+		return 0, 0, false, 0, s.errorf("missing element")
+	}
+	class, constructed, number, n = int(s.b[0])>>6, s.b[0]&classConstructed != 0, int(s.b[0]&0x1f), 1
+	if number != 0x1f {
+		return class, number, constructed, n, nil
+	}
+	// High tag number form.
+	number = 0
+	for shifted := 0; ; shifted++ {
+		if n == len(s.b) {
+			return 0, 0, false, 0, s.errorf("truncated tag")
+		}
+		if shifted == 5 || shifted == 0 && s.b[n] == 0x80 {
+			return 0, 0, false, 0, s.errorf("invalid tag")
+		}
+		c := s.b[n]
+		n++
+		number = number<<7 | int(c&0x7f)
+		if number > math.MaxInt32 {
+			return 0, 0, false, 0, s.errorf("invalid tag")
+		}
+		if c&0x80 == 0 {
+			break
+		}
+	}
+	if number < 0x1f {
+		return 0, 0, false, 0, s.errorf("non-minimal tag")
+	}
+	return class, number, constructed, n, nil
+}
+
+// ReadElement reads the next element of s, which must have tag, and
+// returns its contents.
+func (s *String) ReadElement(tag Tag) (String, error) {
+	if !s.PeekTag(tag) {
+		if len(s.b) == 0 {
+			return String{}, s.errorf("missing element")
+		}
+		return String{}, s.errorf("unexpected tag " + strconv.Itoa(int(s.b[0])))
+	}
+	contents, _, err := s.ReadAnyElement()
+	return contents, err
+}
+
+// ReadInt reads an INTEGER which must fit in an int.
+func (s *String) ReadInt() (int, error) {
+	start := *s
+	contents, err := s.ReadElement(Integer)
+	if err != nil {
+		return 0, err
+	}
+	b := contents.b
+	switch {
+	case len(b) == 0:
+		return 0, start.errorf("empty integer")
+	case len(b) > 1 && (b[0] == 0 && b[1]&0x80 == 0 || b[0] == 0xff && b[1]&0x80 != 0):
+		return 0, start.errorf("non-minimal integer")
+	case len(b) > 8:
+		return 0, start.errorf("integer too large")
+	}
+	var n int64
+	for _, c := range b {
+		n = n<<8 | int64(c)
+	}
+	// Sign-extend.
+	n <<= 64 - 8*uint(len(b))
+	n >>= 64 - 8*uint(len(b))
+	if int64(int(n)) != n {
+		return 0, start.errorf("integer too large")
+	}
+	return int(n), nil
+}
+
+// ReadOctetString reads a primitive OCTET STRING.
+func (s *String) ReadOctetString() ([]byte, error) {
+	contents, err := s.ReadElement(OctetString)
+	if err != nil {
+		return nil, err
+	}
+	return contents.b, nil
+}
+
+// ReadOID reads an OBJECT IDENTIFIER.
+func (s *String) ReadOID() (asn1.ObjectIdentifier, error) {
+	start := *s
+	contents, err := s.ReadElement(OID)
+	if err != nil {
+		return nil, err
+	}
+	b := contents.b
+	if len(b) == 0 {
+		return nil, start.errorf("empty object identifier")
+	}
+	oid := make(asn1.ObjectIdentifier, 1, len(b)+1)
+	for i := 0; i < len(b); {
+		if b[i] == 0x80 {
+			return nil, start.errorf("non-minimal object identifier")
+		}
+		var v int
+		for shifted := 0; ; shifted++ {
+			if i == len(b) {
+				return nil, start.errorf("truncated object identifier")
+			}
+			if shifted == 5 {
+				return nil, start.errorf("object identifier component too large")
+			}
+			c := b[i]
+			i++
+			v = v<<7 | int(c&0x7f)
+			if v > math.MaxInt32 {
+				return nil, start.errorf("object identifier component too large")
+			}
+			if c&0x80 == 0 {
+				break
+			}
+		}
+		if len(oid) == 1 {
+			switch {
+			case v < 40:
+				oid[0] = 0
+			case v < 80:
+				oid[0], v = 1, v-40
+			default:
+				oid[0], v = 2, v-80
+			}
+		}
+		oid = append(oid, v)
+	}
+	return oid, nil
+}
+
+// ReadRawValue reads the next element of s, which must have tag, as an
+// asn1.RawValue, as encoding/asn1 would produce.
+func (s *String) ReadRawValue(tag Tag) (asn1.RawValue, error) {
+	if !s.PeekTag(tag) {
+		_, err := s.ReadElement(tag)
+		return asn1.RawValue{}, err
+	}
+	return s.ReadAnyRawValue()
+}
+
+// ReadAnyRawValue reads the next element of s, whatever its tag, as an
+// asn1.RawValue.
+func (s *String) ReadAnyRawValue() (asn1.RawValue, error) {
+	class, number, constructed, _, err := s.readIdentifier()
+	if err != nil {
+		return asn1.RawValue{}, err
+	}
+	contents, full, err := s.ReadAnyElement()
+	if err != nil {
+		return asn1.RawValue{}, err
+	}
+	return asn1.RawValue{
+		Class:      class,
+		Tag:        number,
+		IsCompound: constructed,
+		Bytes:      contents.b,
+		FullBytes:  full,
+	}, nil
+}
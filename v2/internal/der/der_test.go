@@ -0,0 +1,112 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package der
+
+import (
+	"encoding/asn1"
+	"encoding/hex"
+	"testing"
+)
+
+// The tests below check that String agrees with encoding/asn1.
+
+func TestReadInt(t *testing.T) {
+	for _, in := range []string{
+		"020100", "02017f", "0201ff", "02020080", "0202ff7f", "020400ffffff",
+		"02087fffffffffffffff", "02088000000000000000",
+		"0200", "0202007f", "0202ff80", "0209010000000000000000", "020101ff", "0401ff",
+	} {
+		data, _ := hex.DecodeString(in)
+		var want int
+		_, wantErr := asn1.Unmarshal(data, &want)
+		s := NewString(data)
+		got, err := s.ReadInt()
+		if (err == nil) != (wantErr == nil) || err == nil && got != want {
+			t.Errorf("%s: got %d, %v; want %d, %v", in, got, err, want, wantErr)
+		}
+	}
+}
+
+func TestReadOID(t *testing.T) {
+	for _, in := range []string{
+		"06092a864886f70d010701", "0603550403", "060100", "06027f01", "06028837",
+		"0600", "0602802a", "06032a8648", "06068fffffff7f01", "060790808080800101",
+	} {
+		data, _ := hex.DecodeString(in)
+		var want asn1.ObjectIdentifier
+		_, wantErr := asn1.Unmarshal(data, &want)
+		s := NewString(data)
+		got, err := s.ReadOID()
+		if (err == nil) != (wantErr == nil) || err == nil && !got.Equal(want) {
+			t.Errorf("%s: got %v, %v; want %v, %v", in, got, err, want, wantErr)
+		}
+	}
+}
+
+func TestReadAnyRawValue(t *testing.T) {
+	for _, in := range []string{
+		"3000", "3003020101", "a0030201ff", "0481800000", "048180",
+		"0480", "04810100", "0482000100", "0403ff", "1f1f00", "1f2000", "bf8a3b00", "1f8001", "",
+	} {
+		data, _ := hex.DecodeString(in)
+		var want asn1.RawValue
+		rest, wantErr := asn1.Unmarshal(data, &want)
+		if wantErr == nil && len(rest) != 0 {
+			t.Fatalf("%s: trailing data", in)
+		}
+		s := NewString(data)
+		got, err := s.ReadAnyRawValue()
+		if (err == nil) != (wantErr == nil) {
+			t.Errorf("%s: got error %v, want %v", in, err, wantErr)
+			continue
+		}
+		if err == nil && (got.Class != want.Class || got.Tag != want.Tag || got.IsCompound != want.IsCompound || hex.EncodeToString(got.FullBytes) != hex.EncodeToString(want.FullBytes) || hex.EncodeToString(got.Bytes) != hex.EncodeToString(want.Bytes)) {
+			t.Errorf("%s: got %+v, want %+v", in, got, want)
+		}
+	}
+}
+
+func TestSyntaxErrorOffset(t *testing.T) {
+	data, _ := hex.DecodeString("30090201010404deadbe")
+	s := NewString(data)
+	body, err := s.ReadElement(Sequence)
+	if err == nil {
+		t.Fatal("truncated sequence was accepted")
+	}
+	if err.(*SyntaxError).Offset != 0 {
+		t.Errorf("got offset %d, want 0", err.(*SyntaxError).Offset)
+	}
+
+	data, _ = hex.DecodeString("30070201010403deadbe")
+	s = NewString(data)
+	if body, err = s.ReadElement(Sequence); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := body.ReadInt(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := body.ReadOID(); err == nil {
+		t.Fatal("OCTET STRING was accepted as OBJECT IDENTIFIER")
+	} else if err.(*SyntaxError).Offset != 5 {
+		t.Errorf("got offset %d, want 5", err.(*SyntaxError).Offset)
+	}
+}
+
+func TestAppendHeader(t *testing.T) {
+	for _, length := range []int{0, 1, 0x7f, 0x80, 0xff, 0x100, 0xffff, 0x10000, 1 << 24} {
+		contents := make([]byte, length)
+		want, err := asn1.Marshal(asn1.RawValue{Tag: asn1.TagSequence, IsCompound: true, Bytes: contents})
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := AppendHeader(nil, Sequence, length)
+		if n := HeaderLen(length); n != len(got) {
+			t.Errorf("%d: HeaderLen is %d, want %d", length, n, len(got))
+		}
+		if string(got) != string(want[:len(want)-length]) {
+			t.Errorf("%d: got header %x, want %x", length, got, want[:len(want)-length])
+		}
+	}
+}
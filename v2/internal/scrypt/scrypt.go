@@ -0,0 +1,140 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package scrypt implements the scrypt key derivation function specified in
+// RFC 7914.
+package scrypt
+
+import (
+	"crypto/pbkdf2"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"math/bits"
+)
+
+const maxInt = int(^uint(0) >> 1)
+
+// Key derives a key of keyLen bytes from password and salt with CPU/memory
+// cost n, which must be a power of two greater than 1, block size r and
+// parallelization p.  If progress is non-nil, it is called after each of
+// the 2*n*p mixing steps, with done counting from 1, and derivation is
+// abandoned with a nil key and error if it returns false.
+func Key(password, salt []byte, n, r, p, keyLen int, progress func(done, total int) bool) ([]byte, error) {
+	if n <= 1 || n&(n-1) != 0 {
+		return nil, errors.New("scrypt: N must be a power of two greater than 1")
+	}
+	if r <= 0 || p <= 0 || uint64(r)*uint64(p) >= 1<<30 || r > maxInt/128/p || r > maxInt/256 || n > maxInt/128/r {
+		return nil, errors.New("scrypt: parameters are too large")
+	}
+	if keyLen <= 0 {
+		return nil, errors.New("scrypt: invalid key length")
+	}
+
+	b, err := pbkdf2.Key(sha256.New, string(password), salt, 1, p*128*r)
+	if err != nil {
+		return nil, err
+	}
+	x := make([]uint32, 32*r)
+	v := make([]uint32, 32*r*n)
+	total := 2 * n * p
+	for i := 0; i < p; i++ {
+		if !roMix(b[i*128*r:(i+1)*128*r], r, n, x, v, func(done int) bool {
+			return progress == nil || progress(i*2*n+done, total)
+		}) {
+			return nil, nil
+		}
+	}
+	return pbkdf2.Key(sha256.New, string(password), b, 1, keyLen)
+}
+
+// roMix is scryptROMix of RFC 7914, section 5, applied to b in place, with
+// x and v as scratch space.
+func roMix(b []byte, r, n int, x, v []uint32, step func(done int) bool) bool {
+	for i := range x {
+		x[i] = binary.LittleEndian.Uint32(b[4*i:])
+	}
+	tmp := make([]uint32, 16)
+	y := make([]uint32, 32*r)
+	for i := 0; i < n; i++ {
+		copy(v[i*32*r:], x)
+		blockMix(x, y, tmp, r)
+		if !step(i + 1) {
+			return false
+		}
+	}
+	for i := 0; i < n; i++ {
+		j := int(x[(2*r-1)*16] & uint32(n-1))
+		for k := range x {
+			x[k] ^= v[j*32*r+k]
+		}
+		blockMix(x, y, tmp, r)
+		if !step(n + i + 1) {
+			return false
+		}
+	}
+	for i, w := range x {
+		binary.LittleEndian.PutUint32(b[4*i:], w)
+	}
+	return true
+}
+
+// blockMix is scryptBlockMix of RFC 7914, section 4, applied to b in place,
+// with y and tmp as scratch space.
+func blockMix(b, y, tmp []uint32, r int) {
+	copy(tmp, b[(2*r-1)*16:])
+	for i := 0; i < 2*r; i++ {
+		for j := range tmp {
+			tmp[j] ^= b[i*16+j]
+		}
+		salsa208(tmp)
+		// Even blocks go to the first half of the output and odd blocks
+		// to the second.
+		copy(y[(i/2+(i%2)*r)*16:], tmp)
+	}
+	copy(b, y)
+}
+
+// salsa208 applies the Salsa20/8 core of RFC 7914, section 3, to b.
+func salsa208(b []uint32) {
+	var x [16]uint32
+	copy(x[:], b)
+	for i := 0; i < 8; i += 2 {
+		x[4] ^= bits.RotateLeft32(x[0]+x[12], 7)
+		x[8] ^= bits.RotateLeft32(x[4]+x[0], 9)
+		x[12] ^= bits.RotateLeft32(x[8]+x[4], 13)
+		x[0] ^= bits.RotateLeft32(x[12]+x[8], 18)
+		x[9] ^= bits.RotateLeft32(x[5]+x[1], 7)
+		x[13] ^= bits.RotateLeft32(x[9]+x[5], 9)
+		x[1] ^= bits.RotateLeft32(x[13]+x[9], 13)
+		x[5] ^= bits.RotateLeft32(x[1]+x[13], 18)
+		x[14] ^= bits.RotateLeft32(x[10]+x[6], 7)
+		x[2] ^= bits.RotateLeft32(x[14]+x[10], 9)
+		x[6] ^= bits.RotateLeft32(x[2]+x[14], 13)
+		x[10] ^= bits.RotateLeft32(x[6]+x[2], 18)
+		x[3] ^= bits.RotateLeft32(x[15]+x[11], 7)
+		x[7] ^= bits.RotateLeft32(x[3]+x[15], 9)
+		x[11] ^= bits.RotateLeft32(x[7]+x[3], 13)
+		x[15] ^= bits.RotateLeft32(x[11]+x[7], 18)
+		x[1] ^= bits.RotateLeft32(x[0]+x[3], 7)
+		x[2] ^= bits.RotateLeft32(x[1]+x[0], 9)
+		x[3] ^= bits.RotateLeft32(x[2]+x[1], 13)
+		x[0] ^= bits.RotateLeft32(x[3]+x[2], 18)
+		x[6] ^= bits.RotateLeft32(x[5]+x[4], 7)
+		x[7] ^= bits.RotateLeft32(x[6]+x[5], 9)
+		x[4] ^= bits.RotateLeft32(x[7]+x[6], 13)
+		x[5] ^= bits.RotateLeft32(x[4]+x[7], 18)
+		x[11] ^= bits.RotateLeft32(x[10]+x[9], 7)
+		x[8] ^= bits.RotateLeft32(x[11]+x[10], 9)
+		x[9] ^= bits.RotateLeft32(x[8]+x[11], 13)
+		x[10] ^= bits.RotateLeft32(x[9]+x[8], 18)
+		x[12] ^= bits.RotateLeft32(x[15]+x[14], 7)
+		x[13] ^= bits.RotateLeft32(x[12]+x[15], 9)
+		x[14] ^= bits.RotateLeft32(x[13]+x[12], 13)
+		x[15] ^= bits.RotateLeft32(x[14]+x[13], 18)
+	}
+	for i := range x {
+		b[i] += x[i]
+	}
+}
@@ -0,0 +1,59 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package scrypt
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+func TestVectors(t *testing.T) {
+	// RFC 7914, section 12.  The last vector, with N = 1048576, is omitted
+	// because it needs a gigabyte of memory.
+	var tests = []struct {
+		password, salt string
+		n, r, p        int
+		key            string
+	}{
+		{"", "", 16, 1, 1, "77d6576238657b203b19ca42c18a0497f16b4844e3074ae8dfdffa3fede21442fcd0069ded0948f8326a753a0fc81f17e8d3e0fb2e0d3628cf35e20c38d18906"},
+		{"password", "NaCl", 1024, 8, 16, "fdbabe1c9d3472007856e7190d01e9fe7c6ad7cbc8237830e77376634b3731622eaf30d92e22a3886ff109279d9830dac727afb94a83ee6d8360cbdfa2cc0640"},
+		{"pleaseletmein", "SodiumChloride", 16384, 8, 1, "7023bdcb3afd7348461c06cd81fd38ebfda8fbba904f8e3ea9b543f6545da1f2d5432955613f0fcf62d49705242a9af9e61e85dc0d651e40dfcf017b45575887"},
+	}
+	for _, test := range tests {
+		key, err := Key([]byte(test.password), []byte(test.salt), test.n, test.r, test.p, 64, nil)
+		if err != nil {
+			t.Errorf("N=%d: %v", test.n, err)
+			continue
+		}
+		if got := hex.EncodeToString(key); got != test.key {
+			t.Errorf("N=%d: got %s, want %s", test.n, got, test.key)
+		}
+	}
+}
+
+func TestInvalidParameters(t *testing.T) {
+	for _, n := range []int{0, 1, 3, 1000} {
+		if _, err := Key(nil, nil, n, 1, 1, 32, nil); err == nil {
+			t.Errorf("N=%d: no error", n)
+		}
+	}
+	if _, err := Key(nil, nil, 16, 1<<15, 1<<15, 32, nil); err == nil {
+		t.Error("r*p >= 2^30: no error")
+	}
+}
+
+func TestProgress(t *testing.T) {
+	var calls int
+	key, err := Key([]byte("password"), []byte("salt"), 16, 1, 2, 32, func(done, total int) bool {
+		calls++
+		if done != calls || total != 64 {
+			t.Errorf("got progress %d/%d at call %d", done, total, calls)
+		}
+		return done < 20
+	})
+	if key != nil || err != nil || calls != 20 {
+		t.Errorf("got key %x, error %v after %d calls, want nil, nil after 20", key, err, calls)
+	}
+}
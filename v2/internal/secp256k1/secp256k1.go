@@ -0,0 +1,206 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package secp256k1 implements the secp256k1 elliptic curve of SEC 2, used
+// by Bitcoin and Ethereum.  Its coefficient a is 0, so unlike the Brainpool
+// curves it has no isomorphism onto a curve with a = -3 which
+// elliptic.CurveParams could compute on; it is implemented with Jacobian
+// coordinates instead.  Like elliptic.CurveParams, it is not constant-time.
+package secp256k1
+
+import (
+	"crypto/elliptic"
+	"math/big"
+	"sync"
+)
+
+type curve struct {
+	params *elliptic.CurveParams
+}
+
+var (
+	once sync.Once
+	s256 *curve
+)
+
+func initS256() {
+	s256 = &curve{params: &elliptic.CurveParams{
+		Name:    "secp256k1",
+		BitSize: 256,
+		P:       fromHex("fffffffffffffffffffffffffffffffffffffffffffffffffffffffefffffc2f"),
+		N:       fromHex("fffffffffffffffffffffffffffffffebaaedce6af48a03bbfd25e8cd0364141"),
+		B:       big.NewInt(7),
+		Gx:      fromHex("79be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798"),
+		Gy:      fromHex("483ada7726a3c4655da4fbfc0e1108a8fd17b448a68554199c47d08ffb10d4b8"),
+	}}
+}
+
+func fromHex(s string) *big.Int {
+	n, ok := new(big.Int).SetString(s, 16)
+	if !ok {
+		panic("secp256k1: invalid constant " + s)
+	}
+	return n
+}
+
+// S256 returns the secp256k1 curve.
+func S256() elliptic.Curve {
+	once.Do(initS256)
+	return s256
+}
+
+// Params returns the parameters of the curve, whose A is 0 rather than -3,
+// so that their generic methods must not be used.
+func (c *curve) Params() *elliptic.CurveParams { return c.params }
+
+func (c *curve) IsOnCurve(x, y *big.Int) bool {
+	P := c.params.P
+	if x.Sign() < 0 || x.Cmp(P) >= 0 || y.Sign() < 0 || y.Cmp(P) >= 0 {
+		return false
+	}
+	// y² = x³ + 7
+	y2 := new(big.Int).Mul(y, y)
+	y2.Mod(y2, P)
+	x3 := new(big.Int).Mul(x, x)
+	x3.Mul(x3, x)
+	x3.Add(x3, c.params.B)
+	x3.Mod(x3, P)
+	return x3.Cmp(y2) == 0
+}
+
+// jacobian is a point (X/Z², Y/Z³), which is the point at infinity if Z
+// is 0.
+type jacobian struct {
+	x, y, z *big.Int
+}
+
+// toJacobian returns the affine point (x, y), where (0, 0) is the point at
+// infinity as in crypto/elliptic.
+func toJacobian(x, y *big.Int) jacobian {
+	z := big.NewInt(1)
+	if x.Sign() == 0 && y.Sign() == 0 {
+		z.SetInt64(0)
+	}
+	return jacobian{new(big.Int).Set(x), new(big.Int).Set(y), z}
+}
+
+func (c *curve) toAffine(p jacobian) (x, y *big.Int) {
+	if p.z.Sign() == 0 {
+		return new(big.Int), new(big.Int)
+	}
+	P := c.params.P
+	zInv := new(big.Int).ModInverse(p.z, P)
+	zInv2 := new(big.Int).Mul(zInv, zInv)
+	x = new(big.Int).Mul(p.x, zInv2)
+	x.Mod(x, P)
+	y = new(big.Int).Mul(p.y, zInv2.Mul(zInv2, zInv))
+	y.Mod(y, P)
+	return x, y
+}
+
+// double returns 2p, with the dbl-2009-l formulas for a = 0.
+func (c *curve) double(p jacobian) jacobian {
+	if p.z.Sign() == 0 || p.y.Sign() == 0 {
+		return jacobian{new(big.Int), new(big.Int), new(big.Int)}
+	}
+	P := c.params.P
+	mod := func(v *big.Int) *big.Int { return v.Mod(v, P) }
+
+	a := mod(new(big.Int).Mul(p.x, p.x))
+	b := mod(new(big.Int).Mul(p.y, p.y))
+	cc := mod(new(big.Int).Mul(b, b))
+	d := new(big.Int).Add(p.x, b)
+	d.Mul(d, d)
+	d.Sub(d, a)
+	d.Sub(d, cc)
+	d = mod(d.Lsh(d, 1))
+	e := new(big.Int).Mul(a, big.NewInt(3))
+	f := mod(new(big.Int).Mul(e, e))
+
+	x3 := new(big.Int).Sub(f, new(big.Int).Lsh(d, 1))
+	mod(x3)
+	y3 := new(big.Int).Sub(d, x3)
+	y3.Mul(y3, e)
+	y3.Sub(y3, new(big.Int).Lsh(cc, 3))
+	mod(y3)
+	z3 := new(big.Int).Mul(p.y, p.z)
+	mod(z3.Lsh(z3, 1))
+	return jacobian{x3, y3, z3}
+}
+
+// add returns p + q, with the add-2007-bl formulas.
+func (c *curve) add(p, q jacobian) jacobian {
+	if p.z.Sign() == 0 {
+		return q
+	}
+	if q.z.Sign() == 0 {
+		return p
+	}
+	P := c.params.P
+	mod := func(v *big.Int) *big.Int { return v.Mod(v, P) }
+
+	z1z1 := mod(new(big.Int).Mul(p.z, p.z))
+	z2z2 := mod(new(big.Int).Mul(q.z, q.z))
+	u1 := mod(new(big.Int).Mul(p.x, z2z2))
+	u2 := mod(new(big.Int).Mul(q.x, z1z1))
+	s1 := new(big.Int).Mul(p.y, q.z)
+	s1 = mod(s1.Mul(s1, z2z2))
+	s2 := new(big.Int).Mul(q.y, p.z)
+	s2 = mod(s2.Mul(s2, z1z1))
+	h := mod(new(big.Int).Sub(u2, u1))
+	r := mod(new(big.Int).Sub(s2, s1))
+	if h.Sign() == 0 {
+		if r.Sign() == 0 {
+			return c.double(p)
+		}
+		return jacobian{new(big.Int), new(big.Int), new(big.Int)}
+	}
+	r.Lsh(r, 1)
+
+	i := new(big.Int).Lsh(h, 1)
+	i = mod(i.Mul(i, i))
+	j := mod(new(big.Int).Mul(h, i))
+	v := mod(new(big.Int).Mul(u1, i))
+
+	x3 := new(big.Int).Mul(r, r)
+	x3.Sub(x3, j)
+	x3.Sub(x3, new(big.Int).Lsh(v, 1))
+	mod(x3)
+	y3 := new(big.Int).Sub(v, x3)
+	y3.Mul(y3, r)
+	y3.Sub(y3, new(big.Int).Lsh(new(big.Int).Mul(s1, j), 1))
+	mod(y3)
+	z3 := new(big.Int).Add(p.z, q.z)
+	z3.Mul(z3, z3)
+	z3.Sub(z3, z1z1)
+	z3.Sub(z3, z2z2)
+	z3 = mod(z3.Mul(z3, h))
+	return jacobian{x3, y3, z3}
+}
+
+func (c *curve) Add(x1, y1, x2, y2 *big.Int) (*big.Int, *big.Int) {
+	return c.toAffine(c.add(toJacobian(x1, y1), toJacobian(x2, y2)))
+}
+
+func (c *curve) Double(x1, y1 *big.Int) (*big.Int, *big.Int) {
+	return c.toAffine(c.double(toJacobian(x1, y1)))
+}
+
+func (c *curve) ScalarMult(x1, y1 *big.Int, k []byte) (*big.Int, *big.Int) {
+	base := toJacobian(x1, y1)
+	p := jacobian{new(big.Int), new(big.Int), new(big.Int)}
+	for _, b := range k {
+		for bit := 7; bit >= 0; bit-- {
+			p = c.double(p)
+			if b>>uint(bit)&1 == 1 {
+				p = c.add(p, base)
+			}
+		}
+	}
+	return c.toAffine(p)
+}
+
+func (c *curve) ScalarBaseMult(k []byte) (*big.Int, *big.Int) {
+	return c.ScalarMult(c.params.Gx, c.params.Gy, k)
+}
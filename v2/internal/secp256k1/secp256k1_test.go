@@ -0,0 +1,86 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package secp256k1
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"math/big"
+	"testing"
+)
+
+func fromHexBytes(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+func TestArithmetic(t *testing.T) {
+	curve := S256()
+	params := curve.Params()
+	if !curve.IsOnCurve(params.Gx, params.Gy) {
+		t.Fatal("base point is not on the curve")
+	}
+
+	// 2G is the public key of the private key 2.
+	x, y := curve.Double(params.Gx, params.Gy)
+	if x.Cmp(fromHex("c6047f9441ed7d6d3045406e95c07cd85c778e4b8cef3ca7abac09b95c709ee5")) != 0 ||
+		y.Cmp(fromHex("1ae168fea63dc339a3c58419466ceaeef7f632653266d0e1236431a950cfe52a")) != 0 {
+		t.Errorf("got 2G = (%x, %x)", x, y)
+	}
+	if x1, y1 := curve.Add(params.Gx, params.Gy, params.Gx, params.Gy); x1.Cmp(x) != 0 || y1.Cmp(y) != 0 {
+		t.Error("G+G differs from 2G")
+	}
+	if x1, y1 := curve.ScalarBaseMult([]byte{2}); x1.Cmp(x) != 0 || y1.Cmp(y) != 0 {
+		t.Error("[2]G differs from 2G")
+	}
+	if x1, y1 := curve.ScalarBaseMult(params.N.Bytes()); x1.Sign() != 0 || y1.Sign() != 0 {
+		t.Error("nG is not the point at infinity")
+	}
+	negY := new(big.Int).Sub(params.P, params.Gy)
+	if x1, y1 := curve.Add(params.Gx, params.Gy, params.Gx, negY); x1.Sign() != 0 || y1.Sign() != 0 {
+		t.Error("G-G is not the point at infinity")
+	}
+	if x1, y1 := curve.Add(params.Gx, params.Gy, new(big.Int), new(big.Int)); x1.Cmp(params.Gx) != 0 || y1.Cmp(params.Gy) != 0 {
+		t.Error("G+O differs from G")
+	}
+}
+
+// The key and signature over "secp256k1 test message" with SHA-256 were
+// generated with OpenSSL.
+func TestOpenSSL(t *testing.T) {
+	curve := S256()
+	d := fromHexBytes("ee271b4f3267c89f4e0194fb703297e3885f8b5c44693c01136c1bd6e6572921")
+	x, y := curve.ScalarBaseMult(d)
+	want := "04ae5c09886d9f41c27c02649efbc0da8a311446ee9c429c6f887371eb85ea5cd6495911370353b0911ee4c34eb96ae30f3955961d1a1adb2c3f02fa450a91d7a6"
+	if got := hex.EncodeToString(elliptic.Marshal(curve, x, y)); got != want {
+		t.Fatalf("got public key %s, want %s", got, want)
+	}
+
+	digest := sha256.Sum256([]byte("secp256k1 test message"))
+	pub := &ecdsa.PublicKey{Curve: curve, X: x, Y: y}
+	sig := fromHexBytes("30460221008711308203509b1ca8253754c921dd7d03937f2e462d467af097dde9477a10150221009a1139d6bf943281df2008994c7ee22077d35b908c0e676bee70e517df95784d")
+	if !ecdsa.VerifyASN1(pub, digest[:], sig) {
+		t.Error("OpenSSL signature does not verify")
+	}
+
+	priv := &ecdsa.PrivateKey{PublicKey: *pub, D: new(big.Int).SetBytes(d)}
+	sig, err := ecdsa.SignASN1(rand.Reader, priv, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ecdsa.VerifyASN1(pub, digest[:], sig) {
+		t.Error("signature does not verify")
+	}
+	digest[0] ^= 1
+	if ecdsa.VerifyASN1(pub, digest[:], sig) {
+		t.Error("signature verifies for another digest")
+	}
+}
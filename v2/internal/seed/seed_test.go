@@ -0,0 +1,50 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package seed
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func TestVectors(t *testing.T) {
+	// The first two are from RFC 4269, appendix B; the last was produced
+	// by "openssl enc -seed-ecb".
+	var tests = []struct {
+		key, plaintext, ciphertext string
+	}{
+		{"00000000000000000000000000000000", "000102030405060708090a0b0c0d0e0f", "5ebac6e0054e166819aff1cc6d346cdb"},
+		{"000102030405060708090a0b0c0d0e0f", "00000000000000000000000000000000", "c11f22f20140505084483597e4370f43"},
+		{"0123456789abcdeffedcba9876543210", "000102030405060708090a0b0c0d0e0f", "2283dcf9a0bc90f487b4f30a59875ec4"},
+	}
+	for _, test := range tests {
+		key, _ := hex.DecodeString(test.key)
+		plaintext, _ := hex.DecodeString(test.plaintext)
+		ciphertext, _ := hex.DecodeString(test.ciphertext)
+
+		c, err := NewCipher(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := make([]byte, BlockSize)
+		c.Encrypt(got, plaintext)
+		if !bytes.Equal(got, ciphertext) {
+			t.Errorf("key %s: got ciphertext %x, want %x", test.key, got, ciphertext)
+		}
+		c.Decrypt(got, ciphertext)
+		if !bytes.Equal(got, plaintext) {
+			t.Errorf("key %s: got plaintext %x, want %x", test.key, got, plaintext)
+		}
+	}
+}
+
+func TestInvalidKeySize(t *testing.T) {
+	for _, n := range []int{0, 8, 15, 17, 24, 32} {
+		if _, err := NewCipher(make([]byte, n)); err == nil {
+			t.Errorf("%d-byte key: no error", n)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sm3
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func TestVectors(t *testing.T) {
+	// The first two are from GB/T 32905-2016, appendix A; the others were
+	// produced by "openssl dgst -sm3".
+	var tests = []struct {
+		message, digest string
+	}{
+		{hex.EncodeToString([]byte("abc")), "66c7f0f462eeedd9d1f2d46bdc10e4e24167c4875cf2f7a2297da02b8f4ba8e0"},
+		{hex.EncodeToString([]byte(strings.Repeat("abcd", 16))), "debe9ff92275b8a138604889c18e5a4d6fdb70e5387e5765293dcba39c0c5732"},
+		{"3b771c2ed04b7c74074ff86dc36064328c9b31a4065371a7be59e915e72fe6378059c2614f6a27d9705f25de7acf4124040170cdba9f7c", "664129fe191f14b14a2b09a79452b030b0fd6a7da79f8fcfe8f2cdd7d9e31b62"},
+		{"ac9ea4d20c068dd9136de7baa342b5645fd0fd4325a6b4ba7dda6e9e1893af5188506ab7261cd4aa5ca0afbaeb94467a2a253fefecb5c506c37f2138e38211036e1f7af0bb92edb148de357a8a5c00c852839d4f91f6a93eb6bad78af18b37df17e4f1a219a1f8cbb96ee281d1f65a46add3e57f35890708508a0896bebe4624d1ea201f55c607e709a1b82a631577e048dddeac63b4cb02ac228039d404417145c77e4f701d3039235a28f3ab8a352a9732e2daca2cea34aacde7ecfe462e03dc50bfb55a9bad3e", "2fc81ec235b8ff540e9020a9a8440b8935893ace9fa48a4b52d1354feeeee72a"},
+	}
+	for _, test := range tests {
+		message, _ := hex.DecodeString(test.message)
+		h := New()
+		h.Write(message)
+		if got := hex.EncodeToString(h.Sum(nil)); got != test.digest {
+			t.Errorf("%d-byte message: got %s, want %s", len(message), got, test.digest)
+		}
+
+		// Writing in pieces gives the same digest.
+		h.Reset()
+		for i := range message {
+			h.Write(message[i : i+1])
+		}
+		if got := hex.EncodeToString(h.Sum(nil)); got != test.digest {
+			t.Errorf("%d-byte message written bytewise: got %s, want %s", len(message), got, test.digest)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sm4
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func TestVectors(t *testing.T) {
+	// The first is from GB/T 32907-2016, appendix A; the second was
+	// produced by "openssl enc -sm4-ecb".
+	var tests = []struct {
+		key, plaintext, ciphertext string
+	}{
+		{"0123456789abcdeffedcba9876543210", "0123456789abcdeffedcba9876543210", "681edf34d206965e86b3e94f536e4246"},
+		{"d6ece202729ca5b4f8fe334722f3407f", "af17dbfcbfab49c693c06596ba41e426", "cb9b6f1851f7916501c472da27ed0609"},
+	}
+	for _, test := range tests {
+		key, _ := hex.DecodeString(test.key)
+		plaintext, _ := hex.DecodeString(test.plaintext)
+		ciphertext, _ := hex.DecodeString(test.ciphertext)
+
+		c, err := NewCipher(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := make([]byte, BlockSize)
+		c.Encrypt(got, plaintext)
+		if !bytes.Equal(got, ciphertext) {
+			t.Errorf("key %s: got ciphertext %x, want %x", test.key, got, ciphertext)
+		}
+		c.Decrypt(got, ciphertext)
+		if !bytes.Equal(got, plaintext) {
+			t.Errorf("key %s: got plaintext %x, want %x", test.key, got, plaintext)
+		}
+	}
+}
+
+func TestInvalidKeySize(t *testing.T) {
+	for _, n := range []int{0, 15, 17, 32} {
+		if _, err := NewCipher(make([]byte, n)); err == nil {
+			t.Errorf("%d-byte key: no error", n)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkcs12
+
+import (
+	"crypto"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+
+	"github.com/scholar-ink/go-pkcs12/v2/internal/core"
+)
+
+// DecodeKey extracts the single private key from pfxData, which may be held
+// in a shrouded or a plain key bag.  Certificate bags are skipped without
+// being parsed, so that a malformed or unsupported certificate does not
+// prevent access to the key.
+func DecodeKey(pfxData []byte, password string, opts ...DecodeOption) (crypto.PrivateKey, error) {
+	privateKey, err := newDecoder(opts).DecodeKey(pfxData, password)
+	return privateKey, decodeError("decode key", err)
+}
+
+// DecodeKeys extracts the private keys from pfxData, in the order in which
+// they appear, skipping certificate bags as DecodeKey does.  Keys which
+// share a localKeyId are handled according to the policy of
+// WithDuplicateKeyIDs.
+func DecodeKeys(pfxData []byte, password string, opts ...DecodeOption) ([]KeyEntry, error) {
+	keys, err := newDecoder(opts).DecodeKeys(pfxData, password)
+	return keys, decodeError("decode keys", err)
+}
+
+// DecodeTyped is like Decode, but returns the private key as a K, such as
+// *ecdsa.PrivateKey or crypto.Signer, and fails with a *KeyTypeError if
+// it is not one.  It does not return the CA certificates.
+func DecodeTyped[K crypto.PrivateKey](pfxData []byte, password string, opts ...DecodeOption) (K, *x509.Certificate, error) {
+	privateKey, certificate, err := core.DecodeTypedWith[K](newDecoder(opts), pfxData, password)
+	return privateKey, certificate, decodeError("decode", err)
+}
+
+// DecodeDualStack extracts the classical and post-quantum identities of
+// pfxData, the mirror of EncodeDualStack.  pfxData must contain exactly two
+// private keys, one of them ML-DSA.  Each key is paired with the
+// certificate which has the same LocalKeyId, or failing that with the
+// certificate whose public key matches it, and its chain is built from the
+// certificates which remain.
+func DecodeDualStack(pfxData []byte, password string, opts ...DecodeOption) (classical, postQuantum tls.Certificate, err error) {
+	classical, postQuantum, err = newDecoder(opts).DecodeDualStack(pfxData, password)
+	return classical, postQuantum, decodeError("decode dual-stack identity", err)
+}
+
+// EncodeDualStack produces pfxData containing two identities for the same
+// subject, for servers which offer both a classical and a post-quantum
+// certificate during a migration to hybrid TLS.  postQuantum must have an
+// ML-DSA private key and classical must not; the end-entity certificates
+// of both must have the same subject.
+//
+// Each certificate is linked to its key with its own LocalKeyId, and both
+// identities carry the same friendlyName, the common name of the subject,
+// so that tools which group entries by name show them together.  The two
+// end-entity certificates are stored first, classical first, followed by
+// the CA certificates of both chains without duplicates.
+func EncodeDualStack(rand io.Reader, classical, postQuantum tls.Certificate, password string, opts ...EncodeOption) ([]byte, error) {
+	pfxData, err := newEncoder(opts).EncodeDualStack(rand, classical, postQuantum, password)
+	return pfxData, encodeError("encode dual-stack identity", err)
+}
+
+// DecodePKCS11 decodes pfxData like Decode and returns the PKCS#11
+// attribute values for its private key, public key, and certificates.  RSA
+// (two-prime), ECDSA (NIST curves), and Ed25519 keys are supported.
+//
+// The CKA_ID of the private key, public key, and end-entity certificate is
+// the certificate's subject key identifier if present, or else the SHA-1
+// hash of its subject public key.  CA certificates get an ID computed the
+// same way from their own public key.  Labels are the common name of the
+// respective certificate's subject.
+func DecodePKCS11(pfxData []byte, password string, opts ...DecodeOption) (*PKCS11Objects, error) {
+	objects, err := newDecoder(opts).DecodePKCS11(pfxData, password)
+	return objects, decodeError("decode for PKCS#11", err)
+}
+
+// A KeyIDPolicy specifies how decoding handles private key bags which
+// share a localKeyId, as some buggy exporters produce.  Such a file does
+// not say which key belongs to which certificate.  Key bags without a
+// localKeyId never share one.
+type KeyIDPolicy = core.KeyIDPolicy
+
+const (
+	// RejectDuplicateKeyIDs fails decoding with ErrDuplicateKeyID.  It
+	// is the default.
+	RejectDuplicateKeyIDs = core.RejectDuplicateKeyIDs
+
+	// FirstDuplicateKeyID keeps only the first key bag with each
+	// localKeyId.
+	FirstDuplicateKeyID = core.FirstDuplicateKeyID
+
+	// KeepDuplicateKeyIDs keeps every key bag.  DecodeKeys marks keys
+	// which share a localKeyId as Ambiguous; the functions which return a
+	// single key still require the file to contain exactly one.
+	KeepDuplicateKeyIDs = core.KeepDuplicateKeyIDs
+)
+
+// A KeyEntry is a private key returned by DecodeKeys.
+type KeyEntry = core.KeyEntry
+
+const (
+	// Ed448PrivateKeySize is the size of an Ed448 private key in bytes.
+	Ed448PrivateKeySize = core.Ed448PrivateKeySize
+
+	// X448PrivateKeySize is the size of an X448 private key in bytes.
+	X448PrivateKeySize = core.X448PrivateKeySize
+)
+
+// An Ed448PrivateKey is the private key string of an Ed448 key, RFC 8032
+// section 5.2.5.  The standard library does not implement Ed448, so this
+// package can store such keys, as produced by OpenSSL, and read them back,
+// but cannot sign with them or compute their public keys.
+type Ed448PrivateKey = core.Ed448PrivateKey
+
+// An X448PrivateKey is the private key of an X448 key agreement key, RFC
+// 7748 section 5.  Like Ed448PrivateKey, it can be stored and read back,
+// but the standard library cannot use it.
+type X448PrivateKey = core.X448PrivateKey
+
+// PKCS#11 key types (CKK_*), as used in PKCS11PrivateKey.KeyType.
+const (
+	PKCS11KeyTypeRSA       = core.PKCS11KeyTypeRSA       // CKK_RSA
+	PKCS11KeyTypeEC        = core.PKCS11KeyTypeEC        // CKK_EC
+	PKCS11KeyTypeECEdwards = core.PKCS11KeyTypeECEdwards // CKK_EC_EDWARDS
+)
+
+// PKCS11Objects holds the attribute values needed to create the objects of
+// an identity decoded from a PKCS#12 file on a PKCS#11 token with
+// C_CreateObject.  Every byte slice is encoded exactly as PKCS#11 expects for
+// the attribute named in its comment; big integers are unsigned and
+// big-endian.  All objects share the same CKA_ID, so that tokens and
+// middleware can associate them.
+type PKCS11Objects = core.PKCS11Objects
+
+// PKCS11PrivateKey holds the attributes of a CKO_PRIVATE_KEY object.
+// Fields which do not apply to KeyType are nil.
+type PKCS11PrivateKey = core.PKCS11PrivateKey
+
+// PKCS11PublicKey holds the attributes of a CKO_PUBLIC_KEY object.
+// Fields which do not apply to KeyType are nil.
+type PKCS11PublicKey = core.PKCS11PublicKey
+
+// PKCS11Certificate holds the attributes of a CKO_CERTIFICATE object of type
+// CKC_X_509.
+type PKCS11Certificate = core.PKCS11Certificate
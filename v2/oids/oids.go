@@ -0,0 +1,246 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package oids names the ASN.1 object identifiers known to package pkcs12:
+// its content and bag types, attributes, and algorithms.  It is used by
+// pkcs12 to describe identifiers in error messages and reports, and lets
+// callers do the same with identifiers found in Protection or MacInfo.
+package oids
+
+import (
+	"encoding/asn1"
+	"sort"
+)
+
+// A Kind classifies an object identifier by the role it plays in a PKCS#12
+// file.
+type Kind int
+
+const (
+	ContentType   Kind = iota // a PKCS#7 content type
+	BagType                   // a SafeBag type, or the type of a certificate in a certBag
+	Attribute                 // a bag or signer attribute
+	Encryption                // a password-based encryption scheme or cipher
+	KeyDerivation             // a key derivation function
+	Digest                    // a message digest
+	MAC                       // an HMAC, as used as a PBKDF2 pseudorandom function
+	Signature                 // a signature algorithm
+	PublicKey                 // a public key algorithm
+	Curve                     // a named elliptic curve
+	Other                     // anything else
+)
+
+var kindNames = [...]string{
+	ContentType:   "content type",
+	BagType:       "bag type",
+	Attribute:     "attribute",
+	Encryption:    "encryption",
+	KeyDerivation: "key derivation",
+	Digest:        "digest",
+	MAC:           "MAC",
+	Signature:     "signature",
+	PublicKey:     "public key",
+	Curve:         "curve",
+	Other:         "other",
+}
+
+func (k Kind) String() string {
+	if k < 0 || int(k) >= len(kindNames) {
+		return "unknown"
+	}
+	return kindNames[k]
+}
+
+// An Info describes an object identifier.
+type Info struct {
+	OID asn1.ObjectIdentifier
+
+	// Name is the name given to the identifier by the specification
+	// which defines it, such as "pbeWithSHAAnd3-KeyTripleDES-CBC".
+	Name string
+
+	Kind Kind
+
+	// Spec names the defining specification, such as "RFC 7292".
+	Spec string
+
+	// Insecure reports that the algorithm is too weak to protect data,
+	// and is only supported for reading old files.
+	Insecure bool
+}
+
+func oid(arcs ...int) asn1.ObjectIdentifier { return asn1.ObjectIdentifier(arcs) }
+
+var registry = []Info{
+	{OID: oid(1, 2, 840, 113549, 1, 7, 1), Name: "data", Kind: ContentType, Spec: "RFC 2315"},
+	{OID: oid(1, 2, 840, 113549, 1, 7, 2), Name: "signedData", Kind: ContentType, Spec: "RFC 2315"},
+	{OID: oid(1, 2, 840, 113549, 1, 7, 3), Name: "envelopedData", Kind: ContentType, Spec: "RFC 2315"},
+	{OID: oid(1, 2, 840, 113549, 1, 7, 6), Name: "encryptedData", Kind: ContentType, Spec: "RFC 2315"},
+
+	{OID: oid(1, 2, 840, 113549, 1, 12, 10, 1, 1), Name: "keyBag", Kind: BagType, Spec: "RFC 7292"},
+	{OID: oid(1, 2, 840, 113549, 1, 12, 10, 1, 2), Name: "pkcs8ShroudedKeyBag", Kind: BagType, Spec: "RFC 7292"},
+	{OID: oid(1, 2, 840, 113549, 1, 12, 10, 1, 3), Name: "certBag", Kind: BagType, Spec: "RFC 7292"},
+	{OID: oid(1, 2, 840, 113549, 1, 12, 10, 1, 4), Name: "crlBag", Kind: BagType, Spec: "RFC 7292"},
+	{OID: oid(1, 2, 840, 113549, 1, 12, 10, 1, 5), Name: "secretBag", Kind: BagType, Spec: "RFC 7292"},
+	{OID: oid(1, 2, 840, 113549, 1, 12, 10, 1, 6), Name: "safeContentsBag", Kind: BagType, Spec: "RFC 7292"},
+	{OID: oid(1, 2, 840, 113549, 1, 9, 22, 1), Name: "x509Certificate", Kind: BagType, Spec: "RFC 7292"},
+	{OID: oid(1, 2, 840, 113549, 1, 9, 23, 1), Name: "x509CRL", Kind: BagType, Spec: "RFC 7292"},
+	{OID: oid(1, 2, 840, 113549, 1, 9, 16, 1, 9), Name: "compressedData", Kind: BagType, Spec: "RFC 3274"},
+
+	{OID: oid(1, 2, 840, 113549, 1, 9, 3), Name: "contentType", Kind: Attribute, Spec: "RFC 2985"},
+	{OID: oid(1, 2, 840, 113549, 1, 9, 4), Name: "messageDigest", Kind: Attribute, Spec: "RFC 2985"},
+	{OID: oid(1, 2, 840, 113549, 1, 9, 20), Name: "friendlyName", Kind: Attribute, Spec: "RFC 2985"},
+	{OID: oid(1, 2, 840, 113549, 1, 9, 21), Name: "localKeyId", Kind: Attribute, Spec: "RFC 2985"},
+	{OID: oid(1, 3, 6, 1, 4, 1, 311, 17, 1), Name: "Microsoft CSP Name", Kind: Attribute, Spec: "Microsoft"},
+	{OID: oid(2, 16, 840, 1, 113894, 746875, 1, 1), Name: "oracleTrustedKeyUsage", Kind: Attribute, Spec: "Oracle"},
+
+	{OID: oid(1, 2, 840, 113549, 1, 12, 1, 1), Name: "pbeWithSHAAnd128BitRC4", Kind: Encryption, Spec: "RFC 7292", Insecure: true},
+	{OID: oid(1, 2, 840, 113549, 1, 12, 1, 2), Name: "pbeWithSHAAnd40BitRC4", Kind: Encryption, Spec: "RFC 7292", Insecure: true},
+	{OID: oid(1, 2, 840, 113549, 1, 12, 1, 3), Name: "pbeWithSHAAnd3-KeyTripleDES-CBC", Kind: Encryption, Spec: "RFC 7292"},
+	{OID: oid(1, 2, 840, 113549, 1, 12, 1, 4), Name: "pbeWithSHAAnd2-KeyTripleDES-CBC", Kind: Encryption, Spec: "RFC 7292", Insecure: true},
+	{OID: oid(1, 2, 840, 113549, 1, 12, 1, 5), Name: "pbeWithSHAAnd128BitRC2-CBC", Kind: Encryption, Spec: "RFC 7292"},
+	{OID: oid(1, 2, 840, 113549, 1, 12, 1, 6), Name: "pbeWithSHAAnd40BitRC2-CBC", Kind: Encryption, Spec: "RFC 7292", Insecure: true},
+	{OID: oid(1, 2, 840, 113549, 1, 5, 3), Name: "pbeWithMD5AndDES-CBC", Kind: Encryption, Spec: "RFC 8018", Insecure: true},
+	{OID: oid(1, 2, 840, 113549, 1, 5, 6), Name: "pbeWithMD5AndRC2-CBC", Kind: Encryption, Spec: "RFC 8018", Insecure: true},
+	{OID: oid(1, 2, 840, 113549, 1, 5, 10), Name: "pbeWithSHA1AndDES-CBC", Kind: Encryption, Spec: "RFC 8018", Insecure: true},
+	{OID: oid(1, 2, 840, 113549, 1, 5, 11), Name: "pbeWithSHA1AndRC2-CBC", Kind: Encryption, Spec: "RFC 8018", Insecure: true},
+	{OID: oid(1, 2, 840, 113549, 1, 5, 13), Name: "PBES2", Kind: Encryption, Spec: "RFC 8018"},
+	{OID: oid(2, 16, 840, 1, 101, 3, 4, 1, 2), Name: "aes128-CBC", Kind: Encryption, Spec: "RFC 8018"},
+	{OID: oid(2, 16, 840, 1, 101, 3, 4, 1, 22), Name: "aes192-CBC", Kind: Encryption, Spec: "RFC 8018"},
+	{OID: oid(2, 16, 840, 1, 101, 3, 4, 1, 42), Name: "aes256-CBC", Kind: Encryption, Spec: "RFC 8018"},
+	{OID: oid(1, 2, 392, 200011, 61, 1, 1, 1, 2), Name: "camellia128-cbc", Kind: Encryption, Spec: "RFC 3657"},
+	{OID: oid(1, 2, 392, 200011, 61, 1, 1, 1, 3), Name: "camellia192-cbc", Kind: Encryption, Spec: "RFC 3657"},
+	{OID: oid(1, 2, 392, 200011, 61, 1, 1, 1, 4), Name: "camellia256-cbc", Kind: Encryption, Spec: "RFC 3657"},
+	{OID: oid(1, 2, 156, 10197, 1, 104, 2), Name: "sm4-cbc", Kind: Encryption, Spec: "GM/T 0006"},
+	{OID: oid(1, 2, 410, 200004, 1, 4), Name: "seedCBC", Kind: Encryption, Spec: "RFC 4010"},
+	{OID: oid(1, 2, 643, 7, 1, 1, 5, 1, 1), Name: "id-gostr3412-2015-magma-ctracpkm", Kind: Encryption, Spec: "RFC 9337"},
+	{OID: oid(1, 2, 643, 7, 1, 1, 5, 2, 1), Name: "id-gostr3412-2015-kuznyechik-ctracpkm", Kind: Encryption, Spec: "RFC 9337"},
+	{OID: oid(2, 16, 840, 1, 101, 3, 4, 1, 7), Name: "aes128-CCM", Kind: Encryption, Spec: "RFC 5084"},
+	{OID: oid(2, 16, 840, 1, 101, 3, 4, 1, 27), Name: "aes192-CCM", Kind: Encryption, Spec: "RFC 5084"},
+	{OID: oid(2, 16, 840, 1, 101, 3, 4, 1, 47), Name: "aes256-CCM", Kind: Encryption, Spec: "RFC 5084"},
+	{OID: oid(2, 16, 840, 1, 101, 3, 4, 1, 46), Name: "aes256-GCM", Kind: Encryption, Spec: "RFC 5084"},
+	{OID: oid(1, 2, 840, 113549, 1, 9, 16, 3, 18), Name: "id-alg-AEADChaCha20Poly1305", Kind: Encryption, Spec: "RFC 8103"},
+
+	{OID: oid(1, 2, 840, 113549, 1, 5, 12), Name: "PBKDF2", Kind: KeyDerivation, Spec: "RFC 8018"},
+	{OID: oid(1, 3, 6, 1, 4, 1, 11591, 4, 11), Name: "scrypt", Kind: KeyDerivation, Spec: "RFC 7914"},
+
+	{OID: oid(1, 3, 14, 3, 2, 26), Name: "sha1", Kind: Digest, Spec: "RFC 3279"},
+	{OID: oid(2, 16, 840, 1, 101, 3, 4, 2, 1), Name: "sha256", Kind: Digest, Spec: "RFC 5754"},
+	{OID: oid(2, 16, 840, 1, 101, 3, 4, 2, 2), Name: "sha384", Kind: Digest, Spec: "RFC 5754"},
+	{OID: oid(2, 16, 840, 1, 101, 3, 4, 2, 3), Name: "sha512", Kind: Digest, Spec: "RFC 5754"},
+	{OID: oid(2, 16, 840, 1, 101, 3, 4, 2, 4), Name: "sha224", Kind: Digest, Spec: "RFC 5754"},
+	{OID: oid(2, 16, 840, 1, 101, 3, 4, 2, 5), Name: "sha512-224", Kind: Digest, Spec: "RFC 8017"},
+	{OID: oid(2, 16, 840, 1, 101, 3, 4, 2, 6), Name: "sha512-256", Kind: Digest, Spec: "RFC 8017"},
+	{OID: oid(1, 2, 156, 10197, 1, 401), Name: "sm3", Kind: Digest, Spec: "GM/T 0006"},
+	{OID: oid(1, 2, 643, 7, 1, 1, 2, 3), Name: "id-tc26-gost3411-12-512", Kind: Digest, Spec: "RFC 6986"},
+
+	{OID: oid(1, 2, 840, 113549, 2, 7), Name: "hmacWithSHA1", Kind: MAC, Spec: "RFC 8018"},
+	{OID: oid(1, 2, 840, 113549, 2, 9), Name: "hmacWithSHA256", Kind: MAC, Spec: "RFC 8018"},
+	{OID: oid(1, 2, 840, 113549, 2, 10), Name: "hmacWithSHA384", Kind: MAC, Spec: "RFC 8018"},
+	{OID: oid(1, 2, 840, 113549, 2, 11), Name: "hmacWithSHA512", Kind: MAC, Spec: "RFC 8018"},
+	{OID: oid(1, 2, 156, 10197, 1, 401, 2), Name: "hmacWithSM3", Kind: MAC, Spec: "GM/T 0006"},
+	{OID: oid(1, 2, 643, 7, 1, 1, 4, 2), Name: "id-tc26-hmac-gost-3411-12-512", Kind: MAC, Spec: "RFC 7836"},
+
+	{OID: oid(1, 2, 840, 113549, 1, 1, 5), Name: "sha1WithRSAEncryption", Kind: Signature, Spec: "RFC 8017"},
+	{OID: oid(1, 2, 840, 113549, 1, 1, 11), Name: "sha256WithRSAEncryption", Kind: Signature, Spec: "RFC 8017"},
+	{OID: oid(1, 2, 840, 113549, 1, 1, 12), Name: "sha384WithRSAEncryption", Kind: Signature, Spec: "RFC 8017"},
+	{OID: oid(1, 2, 840, 113549, 1, 1, 13), Name: "sha512WithRSAEncryption", Kind: Signature, Spec: "RFC 8017"},
+	{OID: oid(1, 2, 840, 10045, 4, 1), Name: "ecdsa-with-SHA1", Kind: Signature, Spec: "RFC 3279"},
+	{OID: oid(1, 2, 840, 10045, 4, 3, 2), Name: "ecdsa-with-SHA256", Kind: Signature, Spec: "RFC 5758"},
+	{OID: oid(1, 2, 840, 10045, 4, 3, 3), Name: "ecdsa-with-SHA384", Kind: Signature, Spec: "RFC 5758"},
+	{OID: oid(1, 2, 840, 10045, 4, 3, 4), Name: "ecdsa-with-SHA512", Kind: Signature, Spec: "RFC 5758"},
+
+	{OID: oid(1, 2, 840, 113549, 1, 1, 1), Name: "rsaEncryption", Kind: PublicKey, Spec: "RFC 8017"},
+	{OID: oid(1, 2, 840, 113549, 1, 1, 10), Name: "id-RSASSA-PSS", Kind: PublicKey, Spec: "RFC 4055"},
+	{OID: oid(1, 2, 840, 10045, 2, 1), Name: "id-ecPublicKey", Kind: PublicKey, Spec: "RFC 5480"},
+	{OID: oid(1, 3, 101, 110), Name: "id-X25519", Kind: PublicKey, Spec: "RFC 8410"},
+	{OID: oid(1, 3, 101, 111), Name: "id-X448", Kind: PublicKey, Spec: "RFC 8410"},
+	{OID: oid(1, 3, 101, 112), Name: "id-Ed25519", Kind: PublicKey, Spec: "RFC 8410"},
+	{OID: oid(1, 3, 101, 113), Name: "id-Ed448", Kind: PublicKey, Spec: "RFC 8410"},
+
+	{OID: oid(1, 3, 132, 0, 33), Name: "secp224r1", Kind: Curve, Spec: "RFC 5480"},
+	{OID: oid(1, 2, 840, 10045, 3, 1, 7), Name: "secp256r1", Kind: Curve, Spec: "RFC 5480"},
+	{OID: oid(1, 3, 132, 0, 34), Name: "secp384r1", Kind: Curve, Spec: "RFC 5480"},
+	{OID: oid(1, 3, 132, 0, 35), Name: "secp521r1", Kind: Curve, Spec: "RFC 5480"},
+	{OID: oid(1, 3, 132, 0, 10), Name: "secp256k1", Kind: Curve, Spec: "SEC 2"},
+	{OID: oid(1, 3, 36, 3, 3, 2, 8, 1, 1, 7), Name: "brainpoolP256r1", Kind: Curve, Spec: "RFC 5639"},
+	{OID: oid(1, 3, 36, 3, 3, 2, 8, 1, 1, 11), Name: "brainpoolP384r1", Kind: Curve, Spec: "RFC 5639"},
+	{OID: oid(1, 3, 36, 3, 3, 2, 8, 1, 1, 13), Name: "brainpoolP512r1", Kind: Curve, Spec: "RFC 5639"},
+
+	{OID: oid(2, 5, 29, 37, 0), Name: "anyExtendedKeyUsage", Kind: Other, Spec: "RFC 5280"},
+	{OID: oid(1, 2, 840, 113549, 1, 9, 16, 3, 8), Name: "id-alg-zlibCompress", Kind: Other, Spec: "RFC 3274"},
+}
+
+var (
+	byOID  = make(map[string]*Info, len(registry))
+	byName = make(map[string]*Info, len(registry))
+)
+
+func init() {
+	for i := range registry {
+		byOID[registry[i].OID.String()] = &registry[i]
+		byName[registry[i].Name] = &registry[i]
+	}
+}
+
+// Lookup returns the description of oid, and whether it is known.
+func Lookup(oid asn1.ObjectIdentifier) (Info, bool) {
+	info, ok := byOID[oid.String()]
+	if !ok {
+		return Info{}, false
+	}
+	return info.clone(), true
+}
+
+// ByName returns the description of the object identifier named name, and
+// whether it is known.  Names are case-sensitive.
+func ByName(name string) (Info, bool) {
+	info, ok := byName[name]
+	if !ok {
+		return Info{}, false
+	}
+	return info.clone(), true
+}
+
+// Name returns the name of oid, or its dotted form if it is not known.
+func Name(oid asn1.ObjectIdentifier) string {
+	if info, ok := byOID[oid.String()]; ok {
+		return info.Name
+	}
+	return oid.String()
+}
+
+// Describe returns the name of oid followed by its dotted form in
+// parentheses, such as "pbeWithSHAAnd40BitRC2-CBC (1.2.840.113549.1.12.1.6)",
+// or only the dotted form if it is not known.  It is the form used in the
+// error messages of package pkcs12.
+func Describe(oid asn1.ObjectIdentifier) string {
+	if info, ok := byOID[oid.String()]; ok {
+		return info.Name + " (" + oid.String() + ")"
+	}
+	return oid.String()
+}
+
+// All returns the descriptions of every known object identifier, sorted by
+// kind and then by name.
+func All() []Info {
+	all := make([]Info, len(registry))
+	for i := range registry {
+		all[i] = registry[i].clone()
+	}
+	sort.Slice(all, func(i, j int) bool {
+		if all[i].Kind != all[j].Kind {
+			return all[i].Kind < all[j].Kind
+		}
+		return all[i].Name < all[j].Name
+	})
+	return all
+}
+
+// clone returns a copy of info which does not share the registry's OID.
+func (info *Info) clone() Info {
+	c := *info
+	c.OID = append(asn1.ObjectIdentifier(nil), info.OID...)
+	return c
+}
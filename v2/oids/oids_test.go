@@ -0,0 +1,68 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oids
+
+import (
+	"encoding/asn1"
+	"testing"
+)
+
+func TestLookup(t *testing.T) {
+	rc2 := asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 1, 6}
+	info, ok := Lookup(rc2)
+	if !ok {
+		t.Fatal("pbeWithSHAAnd40BitRC2-CBC is not known")
+	}
+	if info.Name != "pbeWithSHAAnd40BitRC2-CBC" || info.Kind != Encryption || !info.Insecure || info.Spec != "RFC 7292" {
+		t.Errorf("got %+v", info)
+	}
+	info.OID[0] = 2
+	if again, _ := Lookup(rc2); !again.OID.Equal(rc2) {
+		t.Error("modifying a returned OID modified the registry")
+	}
+
+	byName, ok := ByName("pbeWithSHAAnd40BitRC2-CBC")
+	if !ok || !byName.OID.Equal(rc2) {
+		t.Errorf("ByName returned %+v, %v", byName, ok)
+	}
+
+	unknown := asn1.ObjectIdentifier{1, 2, 3, 4}
+	if _, ok := Lookup(unknown); ok {
+		t.Error("Lookup found an unknown OID")
+	}
+	if got := Name(unknown); got != "1.2.3.4" {
+		t.Errorf("Name(unknown) = %q", got)
+	}
+	if got := Describe(unknown); got != "1.2.3.4" {
+		t.Errorf("Describe(unknown) = %q", got)
+	}
+	if got, want := Describe(rc2), "pbeWithSHAAnd40BitRC2-CBC (1.2.840.113549.1.12.1.6)"; got != want {
+		t.Errorf("Describe = %q, want %q", got, want)
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	all := All()
+	if len(all) != len(registry) {
+		t.Fatalf("All returned %d entries, want %d", len(all), len(registry))
+	}
+	oids := make(map[string]bool)
+	names := make(map[string]bool)
+	for i, info := range all {
+		if info.Name == "" || info.Spec == "" || len(info.OID) == 0 || info.Kind.String() == "unknown" {
+			t.Errorf("incomplete entry %+v", info)
+		}
+		if oids[info.OID.String()] {
+			t.Errorf("%s is registered twice", info.OID)
+		}
+		if names[info.Name] {
+			t.Errorf("%s is registered twice", info.Name)
+		}
+		oids[info.OID.String()], names[info.Name] = true, true
+		if i > 0 && (all[i-1].Kind > info.Kind || all[i-1].Kind == info.Kind && all[i-1].Name > info.Name) {
+			t.Errorf("%s is out of order", info.Name)
+		}
+	}
+}
@@ -0,0 +1,550 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkcs12
+
+import (
+	"context"
+	"crypto"
+	"crypto/x509"
+	"encoding/asn1"
+
+	"github.com/scholar-ink/go-pkcs12/v2/internal/core"
+)
+
+// WithASN1Parser parses the outer structure of files with parser.
+func WithASN1Parser(parser ASN1Parser) DecodeOption {
+	return DecodeOption{func(dec *core.Decoder) *core.Decoder { return dec.WithASN1Parser(parser) }}
+}
+
+// WithAllowInsecure, if allow is true, decodes files protected with
+// algorithms that are too weak to be trusted and are otherwise rejected,
+// such as the PKCS#5 v1.5 schemes used by some pre-standard tools to shroud
+// keys and the RC4 schemes of very old Windows and Netscape exports.  It
+// also lifts the iteration floor of WithMinIterations.  It is intended for
+// recovering data from archived files, not for routine use.
+func WithAllowInsecure(allow bool) DecodeOption {
+	return DecodeOption{func(dec *core.Decoder) *core.Decoder { return dec.WithAllowInsecure(allow) }}
+}
+
+// WithCertificateAnnotator calls annotate for every certificate decoded by
+// DecodeCertBags, in file order.
+func WithCertificateAnnotator(annotate CertificateAnnotator) DecodeOption {
+	return DecodeOption{func(dec *core.Decoder) *core.Decoder { return dec.WithCertificateAnnotator(annotate) }}
+}
+
+// WithDecodeContext abandons key derivations once ctx is done, making
+// decoding fail with an *Error of kind Canceled which wraps ctx.Err().
+// ctx is checked periodically during each derivation, so that a
+// long-running decode can be cancelled or given a deadline.
+func WithDecodeContext(ctx context.Context) DecodeOption {
+	return DecodeOption{func(dec *core.Decoder) *core.Decoder { return dec.WithContext(ctx) }}
+}
+
+// WithDecodeKDF derives the keys of decoding with kdf, which must be that
+// with which the file was encoded.  See WithEncodeKDF.
+func WithDecodeKDF(kdf KDF) DecodeOption {
+	return DecodeOption{func(dec *core.Decoder) *core.Decoder { return dec.WithKDF(kdf) }}
+}
+
+// WithDecodeProgress calls report as key derivations and SafeBags are
+// processed, so that interactive programs can show that a decode with a
+// high iteration count is not hung.  report is called on the decoding
+// goroutine, at most about a hundred times per key derivation.
+func WithDecodeProgress(report func(Progress)) DecodeOption {
+	return DecodeOption{func(dec *core.Decoder) *core.Decoder { return dec.WithProgress(report) }}
+}
+
+// WithDecodeYieldInterval calls runtime.Gosched after every iterations
+// iterations of each key derivation, so that a decode with a high
+// iteration count does not starve other goroutines on single-core
+// devices.  An interval of zero or less, the default, never yields.
+func WithDecodeYieldInterval(iterations int) DecodeOption {
+	return DecodeOption{func(dec *core.Decoder) *core.Decoder { return dec.WithYieldInterval(iterations) }}
+}
+
+// WithDuplicateCertificates handles duplicate certificates in Decode and
+// DecodeTrustStore according to policy.
+func WithDuplicateCertificates(policy DuplicatePolicy) DecodeOption {
+	return DecodeOption{func(dec *core.Decoder) *core.Decoder { return dec.WithDuplicateCertificates(policy) }}
+}
+
+// WithDuplicateKeyIDs handles private key bags sharing a localKeyId
+// according to policy.
+func WithDuplicateKeyIDs(policy KeyIDPolicy) DecodeOption {
+	return DecodeOption{func(dec *core.Decoder) *core.Decoder { return dec.WithDuplicateKeyIDs(policy) }}
+}
+
+// WithEmptyContainers accepts files that are structurally valid but
+// contain no SafeBags at all, as exported by some HSMs.  Decode then
+// returns no key and no certificates instead of an error, and an
+// EncryptedData without any encrypted content is taken to be an empty
+// SafeContents.  If warn is not nil, it is called with ErrEmptyContainer
+// whenever an empty file is decoded.
+//
+// Callers must then be prepared for a nil certificate and private key
+// alongside a nil error.
+func WithEmptyContainers(warn func(warning error)) DecodeOption {
+	return DecodeOption{func(dec *core.Decoder) *core.Decoder { return dec.WithEmptyContainers(warn) }}
+}
+
+// WithExtensions skips Extensions when decoding, calling report with each
+// of them, rather than failing with an *Error of kind Unsupported.  report
+// must not be nil.
+func WithExtensions(report func(Extension)) DecodeOption {
+	return DecodeOption{func(dec *core.Decoder) *core.Decoder { return dec.WithExtensions(report) }}
+}
+
+// WithIgnoredKeyBags makes DecodeTrustStore skip private key bags rather
+// than fail, since some tools leave an orphaned key in the trust stores
+// they export.  If report is non-nil, it is called for each skipped key
+// bag with the bag's localKeyId, or nil if it has none.
+func WithIgnoredKeyBags(report func(localKeyID []byte)) DecodeOption {
+	return DecodeOption{func(dec *core.Decoder) *core.Decoder { return dec.WithIgnoredKeyBags(report) }}
+}
+
+// WithIntegrityVerifier verifies the signature of files in public-key
+// integrity mode, whose AuthenticatedSafe is signed rather than (or as well
+// as) protected with a MAC, using the public key of verifier.  Files which
+// are not signed are then rejected with ErrMissingSignature, even if their
+// MAC is valid, so that a successful decode always means that the
+// signature was verified.  Without a verifier, signed files can only be
+// decoded if they also carry a password-based MAC, which is then verified
+// instead.
+func WithIntegrityVerifier(verifier *x509.Certificate) DecodeOption {
+	return DecodeOption{func(dec *core.Decoder) *core.Decoder { return dec.WithIntegrityVerifier(verifier) }}
+}
+
+// WithLaxCertificates, if lax is true, accepts certificates which
+// crypto/x509 rejects because they repeat an extension or are not DER,
+// such as those of some devices with non-minimal lengths, serial numbers
+// with leading zeros, or BOOLEANs other than 0xFF for true.  Such a
+// certificate is parsed from a normalized copy, in which every length,
+// INTEGER and BOOLEAN is re-encoded minimally and only the first of each
+// extension is kept.
+//
+// The Raw and RawTBSCertificate fields of the certificate are nevertheless
+// its original encoding, so that fingerprints and CheckSignatureFrom apply
+// to the certificate as issued.  Its other Raw fields refer to the
+// normalized copy.  Certificates which cannot be normalized still fail to
+// decode with the error of crypto/x509.
+func WithLaxCertificates(lax bool) DecodeOption {
+	return DecodeOption{func(dec *core.Decoder) *core.Decoder { return dec.WithLaxCertificates(lax) }}
+}
+
+// WithLeafInChain, if include is true, also returns the leaf certificate
+// from Decode as the first element of caCerts, for TLS stacks which expect
+// the complete chain in a single slice.
+func WithLeafInChain(include bool) DecodeOption {
+	return DecodeOption{func(dec *core.Decoder) *core.Decoder { return dec.WithLeafInChain(include) }}
+}
+
+// WithLenientEncryptedData accepts EncryptedData SafeContents whose version
+// is not 0, such as the version 2 of CMS, or whose encrypted content is
+// labeled with a content type other than data, as some producers emit
+// although the payload is an ordinary SafeContents.  If warn is not nil, it
+// is called with ErrEncryptedDataVersion or ErrEncryptedContentType for
+// each such EncryptedData.
+func WithLenientEncryptedData(warn func(warning error)) DecodeOption {
+	return DecodeOption{func(dec *core.Decoder) *core.Decoder { return dec.WithLenientEncryptedData(warn) }}
+}
+
+// WithLimiter takes the work of key derivations from limiter, so that a
+// multi-tenant service can give each tenant its own limiter and one
+// tenant's files, however high their iteration counts, cannot monopolize
+// the CPU.  A unit of work is one iteration of the PKCS#12 KDF, PBKDF1 or
+// PBKDF2, or one mixing step of scrypt, as counted by WithDecodeProgress;
+// files declaring more work simply wait longer.
+//
+// The work is requested ahead of each block of up to 1024 iterations, so
+// the burst of limiter must be at least 1024.  The context set with
+// WithDecodeContext, if any, is passed to WaitN, and an error from WaitN
+// abandons the decode and is returned.
+func WithLimiter(limiter Limiter) DecodeOption {
+	return DecodeOption{func(dec *core.Decoder) *core.Decoder { return dec.WithLimiter(limiter) }}
+}
+
+// WithMaxDecompressedSize fails to decode a file whose compressed bags,
+// such as those written with WithBagCompression, expand to more than limit
+// bytes in total.  The default limit, restored by a limit of 0, is 4 MiB.
+func WithMaxDecompressedSize(limit int) DecodeOption {
+	return DecodeOption{func(dec *core.Decoder) *core.Decoder { return dec.WithMaxDecompressedSize(limit) }}
+}
+
+// WithMaxScryptMemory fails to decode a file whose scrypt parameters need
+// more than limit bytes of memory, 128 * r * N, before deriving any key, so
+// that untrusted files cannot make decoding allocate large amounts of
+// memory.  The default limit, restored by a limit of 0, is 32 MiB.  Limits
+// above 1 GiB have no effect, since scrypt parameters needing more are
+// always rejected.
+func WithMaxScryptMemory(limit int) DecodeOption {
+	return DecodeOption{func(dec *core.Decoder) *core.Decoder { return dec.WithMaxScryptMemory(limit) }}
+}
+
+// WithMinIterations rejects files whose MAC, content encryption or key
+// encryption derives its key with fewer than min iterations of the PKCS#12
+// KDF, PBKDF2 or PKCS#5 v1.5 PBKDF1, with an *IterationsError.  This
+// enforces an organizational floor on inbound credentials, such as the
+// 10,000 iterations of OpenSSL 3.  Keys derived with scrypt are not subject
+// to the floor, whose cost is set by memory rather than by iterations.
+//
+// Even without this option, a count of zero iterations is rejected.
+// WithAllowInsecure disables both checks.
+func WithMinIterations(min int) DecodeOption {
+	return DecodeOption{func(dec *core.Decoder) *core.Decoder { return dec.WithMinIterations(min) }}
+}
+
+// WithMissingMAC, if allow is true, decodes files in password integrity
+// mode which have no MAC at all, such as those produced by the
+// MinimalRouter profile and by the routers it emulates.  The integrity of
+// such files is not verified, and VerifyIntegrity reports that nothing was
+// checked.  A MAC which is present is still verified.
+func WithMissingMAC(allow bool) DecodeOption {
+	return DecodeOption{func(dec *core.Decoder) *core.Decoder { return dec.WithMissingMAC(allow) }}
+}
+
+// WithSanitizedAttributes passes the bag attribute values exposed by ToPEM,
+// such as friendlyName, through SanitizeAttribute with the given
+// maxLength.  Attributes in PKCS#12 files from untrusted sources may
+// contain control characters or be arbitrarily long, which is a hazard for
+// UIs and logs that display them.
+func WithSanitizedAttributes(maxLength int) DecodeOption {
+	return DecodeOption{func(dec *core.Decoder) *core.Decoder { return dec.WithSanitizedAttributes(maxLength) }}
+}
+
+// WithSecp256k1, if enabled is true, decodes ECDSA keys on secp256k1, and
+// certificates whose public key is on it, as described for Secp256k1.
+// Otherwise they fail to decode with the error of crypto/x509, which does
+// not support the curve.
+//
+// The keys are ordinary *ecdsa.PrivateKey values, but signing with them
+// through crypto/ecdsa is not constant-time, and leaks information about
+// the private key to anyone who can time it.  Convert them to the key type
+// of a constant-time secp256k1 implementation before signing.
+func WithSecp256k1(enabled bool) DecodeOption {
+	return DecodeOption{func(dec *core.Decoder) *core.Decoder { return dec.WithSecp256k1(enabled) }}
+}
+
+// WithTrailingZeroPadding, if allow is true, ignores zero bytes following
+// the SafeBag sequence of a SafeContents, as emitted by some generators.
+// Trailing data which is not all zeros is still rejected.
+func WithTrailingZeroPadding(allow bool) DecodeOption {
+	return DecodeOption{func(dec *core.Decoder) *core.Decoder { return dec.WithTrailingZeroPadding(allow) }}
+}
+
+// A Profile is a set of algorithms and parameters for encoding, selected
+// with WithProfile.
+type Profile int
+
+const (
+	// Modern encrypts both the certificates and the private key with
+	// PBES2, using PBKDF2 with HMAC-SHA-256 and AES-256-CBC, and
+	// authenticates the file with HMAC-SHA-256, as OpenSSL 3 does by
+	// default.  Its output is read by OpenSSL 1.1.1 and later, Windows 10
+	// 1709 and later and JDK 8u301 and later, but not by older software;
+	// use ProbeCompatibility to check.  It is the default.
+	Modern Profile = iota
+
+	// Compatible encrypts both the certificates and the private key with
+	// SHA-1 and 3-key Triple DES, and authenticates the file with
+	// HMAC-SHA-1, for software too old to read Modern.  It is what version
+	// 1 encodes with by default.
+	Compatible
+
+	// Legacy emulates the behavior of OpenSSL's PKCS12_create and of
+	// early versions of this package: the certificates are encrypted with
+	// 40-bit RC2, which is trivially breakable, and the private key with
+	// 3-key Triple DES.  Only use Legacy when the output must be read by
+	// software which cannot decrypt anything else.  Encoding with it fails
+	// after DisableLegacyEncoding has been called.
+	Legacy
+
+	// OpenSSL111 reproduces the structure of the files written by the
+	// "openssl pkcs12 -export" command of OpenSSL 1.1.1, and of OpenSSL 3
+	// with the -legacy flag: the algorithms of Legacy with 2048 iterations
+	// for the MAC as well as the encryption, an explicit NULL parameter in
+	// the MAC digest algorithm, and no empty attribute sets on the CA
+	// certificate bags.  Apart from the salts and the ciphertexts which
+	// depend on them, its output is identical to OpenSSL's for the same
+	// key, certificates and friendlyName.  Like Legacy, encoding with it
+	// fails after DisableLegacyEncoding has been called.
+	OpenSSL111
+
+	// MinimalRouter produces the minimal layout exported by some embedded
+	// routers, such as MikroTik RouterOS, which is also the layout they
+	// most reliably import: a single unencrypted SafeContents holding a
+	// plain keyBag followed by the certificate bags, and no MAC.  Nothing
+	// in its output is protected, so it only accepts the empty password,
+	// and its output must be kept confidential by other means.  Such files
+	// are decoded with WithMissingMAC(true).
+	MinimalRouter
+)
+
+var profiles = [...]*core.Encoder{
+	Modern:        core.Modern,
+	Compatible:    core.DefaultEncoder,
+	Legacy:        core.Legacy,
+	OpenSSL111:    core.OpenSSL111,
+	MinimalRouter: core.MinimalRouter,
+}
+
+// WithProfile encodes with the algorithms and parameters of profile.  It
+// replaces the configuration made by the options before it, so it belongs
+// first.  WithProfile panics if profile is not one of the Profiles defined
+// by this package.
+func WithProfile(profile Profile) EncodeOption {
+	if profile < 0 || int(profile) >= len(profiles) {
+		panic("pkcs12: unknown Profile")
+	}
+	enc := profiles[profile]
+	return EncodeOption{func(*core.Encoder) *core.Encoder { return enc }}
+}
+
+// WithAESKeySize makes PBES2 use AES-CBC with keys of the given size in
+// bits, which must be 128, 192 or 256, the default.  Some releases of Java
+// keytool write and expect AES-128.  It has no effect on the legacy
+// PKCS#12 algorithms.
+func WithAESKeySize(bits int) EncodeOption {
+	return EncodeOption{func(enc *core.Encoder) *core.Encoder { return enc.WithAESKeySize(bits) }}
+}
+
+// WithAutomaticFriendlyName, if enabled is true, gives the private key bag
+// and the end-entity certificate bag a friendlyName taken from the
+// certificate, as OpenSSL and the Windows certificate export wizard
+// effectively do: the first DNS name of its Subject Alternative Name
+// extension, or, if it has none, the common name of its subject.  No
+// friendlyName is added if the certificate has neither, or if the
+// encoding function already sets one, as EncodeTLSCertificate does when
+// its options carry a FriendlyName.
+func WithAutomaticFriendlyName(enabled bool) EncodeOption {
+	return EncodeOption{func(enc *core.Encoder) *core.Encoder { return enc.WithAutomaticFriendlyName(enabled) }}
+}
+
+// WithBagCompression makes the trust store encoding functions compress
+// with zlib each certificate and CRL bag whose value is at least threshold
+// bytes long, if that makes it shorter, to reduce the size of large
+// bundles sent to devices with little bandwidth.  The compressed bags keep
+// their attributes, but use a bag type which only this package
+// understands; other implementations ignore or reject them.  A threshold
+// of 0 disables compression.
+func WithBagCompression(threshold int) EncodeOption {
+	return EncodeOption{func(enc *core.Encoder) *core.Encoder { return enc.WithBagCompression(threshold) }}
+}
+
+// WithCamellia makes PBES2 use Camellia-CBC with keys of the given size in
+// bits, which must be 128, 192 or 256, instead of AES-CBC, as some
+// Japanese government CA tooling does.  Camellia is read by OpenSSL, but
+// not by Windows or by the providers of the JDK.
+func WithCamellia(bits int) EncodeOption {
+	return EncodeOption{func(enc *core.Encoder) *core.Encoder { return enc.WithCamellia(bits) }}
+}
+
+// WithChaCha20Poly1305, if enabled is true, makes PBES2 use
+// ChaCha20-Poly1305, under the object identifier which RFC 8103 assigns it
+// in CMS, instead of AES-CBC or Camellia-CBC.  It is faster than AES in
+// software, on platforms without AES instructions.  The scheme is
+// experimental: no other PKCS#12 implementation reads it, so it is only
+// suitable for files which never leave applications built with this
+// package.
+func WithChaCha20Poly1305(enabled bool) EncodeOption {
+	return EncodeOption{func(enc *core.Encoder) *core.Encoder { return enc.WithChaCha20Poly1305(enabled) }}
+}
+
+// WithCompatibilityLevel uses the defaults that version 1 of this package
+// considers appropriate as of the given year.  The levels are:
+//
+//   - before 2024: HMAC-SHA-1 MAC, as produced by the Compatible profile.
+//   - 2024 and later: HMAC-SHA-256 MAC, the default of OpenSSL 3.
+//
+// Only the parameters named above are affected; the encryption algorithms
+// are retained.
+func WithCompatibilityLevel(year int) EncodeOption {
+	return EncodeOption{func(enc *core.Encoder) *core.Encoder { return enc.WithCompatibilityLevel(year) }}
+}
+
+// WithEncodeContext abandons key derivations once ctx is done, making
+// encoding fail with an *Error of kind Canceled.  See WithDecodeContext.
+func WithEncodeContext(ctx context.Context) EncodeOption {
+	return EncodeOption{func(enc *core.Encoder) *core.Encoder { return enc.WithContext(ctx) }}
+}
+
+// WithEncodeKDF derives the keys of encoding with kdf.  It replaces the
+// PKCS#12 key derivation function, used by the MAC and the PKCS#12
+// encryption algorithms, and PBKDF2, used by PBES2; other key derivation
+// functions, such as scrypt, PBKDF1 and that of the GOST MAC, are
+// unaffected.  The file records the usual algorithms, salts and iteration
+// counts, but it can only be decoded with WithDecodeKDF and the same KDF.
+// A nil kdf restores the built-in functions.
+func WithEncodeKDF(kdf KDF) EncodeOption {
+	return EncodeOption{func(enc *core.Encoder) *core.Encoder { return enc.WithKDF(kdf) }}
+}
+
+// WithEncodeProgress calls report as key derivations are processed.  See
+// WithDecodeProgress.
+func WithEncodeProgress(report func(Progress)) EncodeOption {
+	return EncodeOption{func(enc *core.Encoder) *core.Encoder { return enc.WithProgress(report) }}
+}
+
+// WithEncodeYieldInterval yields during key derivations.  See
+// WithDecodeYieldInterval.
+func WithEncodeYieldInterval(iterations int) EncodeOption {
+	return EncodeOption{func(enc *core.Encoder) *core.Encoder { return enc.WithYieldInterval(iterations) }}
+}
+
+// WithFixedRandomness ignores the rand argument of the encoding functions
+// and draws every salt from a stream determined by seed alone, so that
+// encoding the same input twice yields identical output.  It exists for
+// known-answer tests in validation labs, which need full control over the
+// generated values, and must never be used to produce files which protect
+// real keys: anyone who knows seed knows every salt.  A nil seed restores
+// the use of rand.
+//
+// The stream is the concatenation of SHA-256(seed || counter) for counter
+// = 0, 1, 2, ..., each counter encoded as a 64-bit big-endian integer, and
+// starts afresh for each call.  Salts are drawn from it in the order in
+// which the file is assembled: the shrouded key, then the certificates,
+// then the MAC.
+func WithFixedRandomness(seed []byte) EncodeOption {
+	return EncodeOption{func(enc *core.Encoder) *core.Encoder { return enc.WithFixedRandomness(seed) }}
+}
+
+// WithIterations encrypts the certificates and the private key with the
+// given iteration count of the key derivation, such as the 600,000 that
+// OWASP recommends for PBKDF2-HMAC-SHA-256, or a low count to speed up
+// tests.  It applies to PBES2 with PBKDF2 and to the legacy PKCS#12
+// algorithms alike, but not to the MAC, whose count is set with WithMAC,
+// nor to scrypt.  An iteration count below 1 is treated as 1.
+func WithIterations(iterations int) EncodeOption {
+	return EncodeOption{func(enc *core.Encoder) *core.Encoder { return enc.WithIterations(iterations) }}
+}
+
+// WithKeyDerivationFunction makes PBES2 derive its keys with the
+// KeyDerivationFunction registered for oid, rather than with PBKDF2 or
+// scrypt.  Encoding fails with an *Error of kind Unsupported if none is
+// registered.  The iteration count then has no effect on PBES2; the
+// parameters are chosen by the KeyDerivationFunction.
+func WithKeyDerivationFunction(oid asn1.ObjectIdentifier) EncodeOption {
+	return EncodeOption{func(enc *core.Encoder) *core.Encoder { return enc.WithKeyDerivationFunction(oid) }}
+}
+
+// WithMAC authenticates the file with HMAC using digest, keyed by the
+// PKCS#12 key derivation with the given iteration count, to meet policies
+// such as 100,000 iterations with SHA-256.  digest must be one of
+// crypto.SHA1, crypto.SHA224, crypto.SHA256, crypto.SHA384, crypto.SHA512,
+// crypto.SHA512_224 and crypto.SHA512_256; encoding with any other fails
+// with an *Error of kind Unsupported.  An iteration count below 1 is
+// treated as 1.
+func WithMAC(digest crypto.Hash, iterations int) EncodeOption {
+	return EncodeOption{func(enc *core.Encoder) *core.Encoder { return enc.WithMAC(digest, iterations) }}
+}
+
+// WithMaxSize makes the encoding functions fail with a *SizeError, rather
+// than returning the file, if it would be longer than limit bytes, as
+// required by a database column or a device's key slot.  The error lists
+// the parts of the file by size, so that the caller can tell which
+// certificates to leave out.  A limit of 0 removes the restriction.
+func WithMaxSize(limit int) EncodeOption {
+	return EncodeOption{func(enc *core.Encoder) *core.Encoder { return enc.WithMaxSize(limit) }}
+}
+
+// WithPBEScheme makes PBES2 encrypt with the PBEScheme registered for oid,
+// rather than with AES-CBC.  Encoding fails with an *Error of kind
+// Unsupported if none is registered.
+func WithPBEScheme(oid asn1.ObjectIdentifier) EncodeOption {
+	return EncodeOption{func(enc *core.Encoder) *core.Encoder { return enc.WithPBEScheme(oid) }}
+}
+
+// WithSaltLength generates salts of length bytes, such as the 16 or 32 that
+// some compliance profiles require, for both the encryption of the
+// certificates and the private key and the MAC.  The defaults are 8 bytes
+// for the MAC and the PKCS#12 algorithms, and 16 for PBES2.  PBES1 salts
+// are always 8 bytes, as RFC 8018 requires, and a registered
+// KeyDerivationFunction chooses its own salt.  A length below 1 restores
+// the defaults.
+func WithSaltLength(length int) EncodeOption {
+	return EncodeOption{func(enc *core.Encoder) *core.Encoder { return enc.WithSaltLength(length) }}
+}
+
+// WithScrypt makes PBES2 derive its keys with scrypt (RFC 7914), using
+// CPU/memory cost n, block size r and parallelization p, rather than with
+// PBKDF2.  n must be a power of two greater than 1; RFC 7914 suggests n =
+// 16384, r = 8 and p = 1 for interactive use, which takes 16 MiB of memory.
+// Parameters needing more than 1 GiB, 128 * r * n bytes, or mixing more
+// than 4 GiB, 128 * r * n * p bytes, are rejected when encoding and
+// decoding alike, and decoding rejects files needing more than 32 MiB
+// unless configured with WithMaxScryptMemory.  The iteration count then
+// has no effect on PBES2.  Not every reader of PKCS#12 files supports
+// scrypt.
+func WithScrypt(n, r, p int) EncodeOption {
+	return EncodeOption{func(enc *core.Encoder) *core.Encoder { return enc.WithScrypt(n, r, p) }}
+}
+
+// An ASN1Parser selects the ASN.1 implementation which decoding uses for
+// the outer structure of PKCS#12 files: the PFX, the AuthenticatedSafe and
+// the SafeContents.  The contents of individual bags are always parsed
+// with encoding/asn1.
+type ASN1Parser = core.ASN1Parser
+
+const (
+	// ReflectParser parses with encoding/asn1.  It is the default.
+	ReflectParser = core.ReflectParser
+
+	// StreamParser parses with a non-reflective DER reader modeled on
+	// golang.org/x/crypto/cryptobyte.  It is faster and allocates
+	// less, which matters to services decoding many files, and its
+	// syntax errors give the byte offset at which parsing failed.  It
+	// is intended to accept exactly the inputs that ReflectParser
+	// accepts, and to produce the same result.
+	StreamParser = core.StreamParser
+)
+
+// A KDFPurpose identifies what the key material returned by a KDF is used
+// for.  Its values are the ID bytes of the PKCS#12 key derivation function
+// (RFC 7292, appendix B.3).
+type KDFPurpose = core.KDFPurpose
+
+const (
+	// EncryptionKeyPurpose is the key of an encryption algorithm: a
+	// PKCS#12 algorithm or the encryption scheme of PBES2.
+	EncryptionKeyPurpose = core.EncryptionKeyPurpose
+
+	// IVPurpose is the IV of a PKCS#12 encryption algorithm.
+	IVPurpose = core.IVPurpose
+
+	// MACKeyPurpose is the key of the HMAC which authenticates the file.
+	MACKeyPurpose = core.MACKeyPurpose
+)
+
+// A KDF derives the keys of encoding or decoding configured with
+// WithEncodeKDF or WithDecodeKDF, in place of the key derivation functions of the file, so that
+// an organization can route key derivation through an HSM or KMS which
+// combines a secret it holds with the password.  A KDF is given the salt
+// and iteration count recorded in the file but not the password, which an
+// implementation that needs it must obtain itself, for instance when it is
+// constructed.  Its implementations must be safe for concurrent use.
+type KDF = core.KDF
+
+// A Limiter rations the key derivation work of decoding configured with
+// WithLimiter.  WaitN blocks until n units of work may be performed, or
+// returns an error if they never can be.  *rate.Limiter of
+// golang.org/x/time/rate implements Limiter.
+type Limiter = core.Limiter
+
+// A ProgressStage identifies what a Progress report counts.
+type ProgressStage = core.ProgressStage
+
+const (
+	// KeyDerivationStage counts the iterations of a single key
+	// derivation.  Decoding or encoding a file involves several key
+	// derivations, for the MAC and for each encrypted SafeContents and
+	// shrouded key, and each is reported from zero to completion.
+	KeyDerivationStage = core.KeyDerivationStage
+
+	// BagStage counts the SafeBags processed by a decoding operation.
+	BagStage = core.BagStage
+)
+
+// A Progress reports how far a long-running operation has got, to the
+// callback configured with WithDecodeProgress or WithEncodeProgress.
+type Progress = core.Progress
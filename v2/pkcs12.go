@@ -0,0 +1,148 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package pkcs12 is version 2 of github.com/scholar-ink/go-pkcs12, which
+// implements some of PKCS#12 (also known as P12 or PFX).  Its functions
+// take functional options instead of a configured Decoder or Encoder, every
+// error they return is an *Error which classifies it, and encoding uses the
+// algorithms of the Modern profile unless told otherwise, so no legacy
+// algorithm is ever chosen by default.  Since PKCS#12 uses weak encryption
+// primitives, it SHOULD NOT be used for new applications.
+//
+// Version 1 is a shim over this package and remains supported: its
+// Decoders and Encoders are lists of the options of this package, and its
+// functions return the errors which the *Error values of this package
+// wrap.  PLAN.md lists what remains before each version is a module of its
+// own.
+package pkcs12
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"io"
+
+	"github.com/scholar-ink/go-pkcs12/v2/internal/core"
+)
+
+// DefaultPassword is the string "changeit", a commonly-used password for
+// PKCS#12 files. Due to the weak encryption used by PKCS#12, it is
+// RECOMMENDED that you use DefaultPassword when encoding PKCS#12 files,
+// and protect the PKCS#12 files using other means.
+const DefaultPassword = core.DefaultPassword
+
+// A DecodeOption configures the functions which decode a file.
+type DecodeOption struct {
+	apply func(*core.Decoder) *core.Decoder
+}
+
+// An EncodeOption configures the functions which encode a file.
+type EncodeOption struct {
+	apply func(*core.Encoder) *core.Encoder
+}
+
+// newDecoder returns the Decoder configured by opts, which are applied in
+// order to one which decodes strictly.
+func newDecoder(opts []DecodeOption) *core.Decoder {
+	dec := core.DefaultDecoder
+	for _, opt := range opts {
+		dec = opt.apply(dec)
+	}
+	return dec
+}
+
+// newEncoder returns the Encoder configured by opts, which are applied in
+// order to the Modern profile.
+func newEncoder(opts []EncodeOption) *core.Encoder {
+	enc := core.Modern
+	for _, opt := range opts {
+		enc = opt.apply(enc)
+	}
+	return enc
+}
+
+// Decode extracts the private key, the end-entity certificate and the CA
+// certificates from pfxData.  The first certificate is assumed to be the
+// leaf certificate, and caCerts holds the others in the order in which they
+// appear in pfxData; the leaf is only included in caCerts with
+// WithLeafInChain(true).  The file must contain exactly one private key.
+//
+// The private key is a *rsa.PrivateKey, *ecdsa.PrivateKey,
+// ed25519.PrivateKey, *mldsa.PrivateKey, Ed448PrivateKey or X448PrivateKey,
+// or an *ecdh.PrivateKey for X25519 key agreement keys.  Encode accepts the
+// same types.  ECDSA keys, and the public keys of certificates, may also be
+// on the brainpoolP256r1, brainpoolP384r1 and brainpoolP512r1 curves of
+// RFC 5639, which crypto/x509 does not support, or on secp256k1 with
+// WithSecp256k1(true).
+//
+// Unlike the curves of crypto/elliptic, this package's implementations of
+// the Brainpool curves and of secp256k1 are not constant-time: signing with
+// a Brainpool or secp256k1 key returned by Decode, or any other use of its
+// Curve, takes time which depends on the private key.  Such keys are meant
+// to be handed to a constant-time implementation, such as an HSM, rather
+// than used where timing can be observed.
+//
+// Certificates are never re-encoded: the Raw field of each returned
+// certificate is exactly the DER embedded in pfxData, so signatures and
+// fingerprints computed over it match those of the original.
+func Decode(pfxData []byte, password string, opts ...DecodeOption) (privateKey crypto.PrivateKey, certificate *x509.Certificate, caCerts []*x509.Certificate, err error) {
+	privateKey, certificate, caCerts, err = newDecoder(opts).DecodeChainWithCAs(pfxData, password)
+	return privateKey, certificate, caCerts, decodeError("decode", err)
+}
+
+// ToPEM converts all "safe bags" contained in pfxData to PEM blocks.
+// DO NOT USE THIS FUNCTION. ToPEM creates invalid PEM blocks; private keys
+// other than Ed25519, X25519, Ed448 and X448 keys are encoded as raw RSA or
+// EC private keys rather than PKCS#8 despite being labeled "PRIVATE KEY".
+// To decode a PKCS#12 file, use Decode instead, and use the encoding/pem
+// package to convert to PEM if necessary.
+func ToPEM(pfxData []byte, password string, opts ...DecodeOption) ([]*pem.Block, error) {
+	blocks, err := newDecoder(opts).ToPEM(pfxData, password)
+	return blocks, decodeError("convert to PEM", err)
+}
+
+// Encode produces pfxData containing one private key (privateKey), an
+// end-entity certificate (certificate), and any number of CA certificates
+// (caCerts).
+//
+// The private key is encrypted with the provided password, but due to the
+// weak encryption primitives used by PKCS#12, it is RECOMMENDED that you
+// specify a hard-coded password (such as pkcs12.DefaultPassword) and protect
+// the resulting pfxData using other means.
+//
+// The rand argument is used to provide entropy for the encryption, and
+// can be set to rand.Reader from the crypto/rand package, which is used if
+// rand is nil.
+//
+// caCerts may be nil or empty, but neither privateKey, certificate nor any
+// element of caCerts may be nil.
+//
+// Encode creates two SafeContents: one that's encrypted and contains the
+// certificates, and another that is unencrypted and contains the private key
+// shrouded with the algorithms of the profile, Modern by default.  The
+// private key bag and the end-entity certificate bag have the LocalKeyId
+// attribute set to the SHA-1 fingerprint of the end-entity certificate.
+//
+// Certificates are embedded exactly as their Raw field, which must hold a
+// valid DER certificate; they are never re-encoded.
+func Encode(rand io.Reader, privateKey crypto.PrivateKey, certificate *x509.Certificate, caCerts []*x509.Certificate, password string, opts ...EncodeOption) ([]byte, error) {
+	pfxData, err := newEncoder(opts).Encode(rand, privateKey, certificate, caCerts, password)
+	return pfxData, encodeError("encode", err)
+}
+
+// An EncryptedPEMKey is a private key in a traditional encrypted PEM block,
+// with Proc-Type and DEK-Info headers, as written by "openssl ec -des3" and
+// "openssl rsa -aes256 -traditional".  Encode and the other encoding
+// functions accept an EncryptedPEMKey, or a pointer to one, in place of a
+// private key, and decrypt it with Passphrase, so that such keys need not
+// be converted with openssl first.
+//
+// PEM holds the PEM encoding, in which the first "RSA PRIVATE KEY", "EC
+// PRIVATE KEY" or "PRIVATE KEY" block is used.  That block may also be
+// unencrypted, in which case Passphrase is ignored.  PKCS#8 "ENCRYPTED
+// PRIVATE KEY" blocks are not supported.
+//
+// The encryption of traditional PEM is weak and unauthenticated, so a wrong
+// passphrase is usually, but not always, detected.
+type EncryptedPEMKey = core.EncryptedPEMKey
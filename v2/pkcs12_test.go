@@ -0,0 +1,172 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkcs12
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func newTestCertificate(t *testing.T) (*ecdsa.PrivateKey, *x509.Certificate) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "www.example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, cert
+}
+
+func errorKindOf(err error) ErrorKind {
+	var e *Error
+	if !errors.As(err, &e) {
+		return 0
+	}
+	return e.Kind
+}
+
+func TestRoundTrip(t *testing.T) {
+	key, cert := newTestCertificate(t)
+	pfxData, err := Encode(nil, key, cert, nil, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Without options, the algorithms of Modern are used.
+	mac, err := PeekMAC(pfxData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if oidSHA256 := (asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}); !mac.Digest.Equal(oidSHA256) {
+		t.Errorf("got MAC digest %v, want SHA-256", mac.Digest)
+	}
+
+	privateKey, certificate, caCerts, err := Decode(pfxData, "password", WithLeafInChain(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !key.Equal(privateKey) || !certificate.Equal(cert) || len(caCerts) != 1 {
+		t.Error("decoded identity does not match")
+	}
+
+	pfxData, err = Encode(rand.Reader, key, cert, nil, "password", WithMAC(crypto.SHA512, 4096), WithIterations(4096))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mac, err := PeekMAC(pfxData); err != nil || mac.Iterations != 4096 {
+		t.Errorf("got MAC %+v, %v, want 4096 iterations", mac, err)
+	}
+	if _, _, _, err := Decode(pfxData, "password", WithMinIterations(4096)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestProfiles(t *testing.T) {
+	key, cert := newTestCertificate(t)
+	pfxData, err := Encode(rand.Reader, key, cert, nil, "password", WithProfile(Legacy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	protection, err := InspectProtection(pfxData, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if oidTripleDES := (asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 1, 3}); !protection.KeyAlgorithm.Equal(oidTripleDES) {
+		t.Errorf("got key algorithm %v with Legacy, want 3DES", protection.KeyAlgorithm)
+	}
+
+	// A profile replaces the configuration made by earlier options.
+	pfxData, err = Encode(rand.Reader, key, cert, nil, "password", WithMAC(crypto.SHA512, 4096), WithProfile(Compatible))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mac, err := PeekMAC(pfxData); err != nil || !mac.Digest.Equal(asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}) {
+		t.Errorf("got MAC %+v, %v with Compatible, want SHA-1", mac, err)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("WithProfile accepted an unknown Profile")
+		}
+	}()
+	WithProfile(Profile(-1))
+}
+
+func TestErrors(t *testing.T) {
+	key, cert := newTestCertificate(t)
+	pfxData, err := Encode(rand.Reader, key, cert, nil, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, _, err = Decode(pfxData, "wrong")
+	if errorKindOf(err) != IncorrectPassword || !errors.Is(err, ErrIncorrectPassword) {
+		t.Errorf("got error %v for the wrong password", err)
+	}
+	if err != nil && err.Error() != "pkcs12: decode: decryption password incorrect" {
+		t.Errorf("got error message %q", err)
+	}
+
+	_, _, _, err = Decode(pfxData, "password", WithMinIterations(100000))
+	var iterations *IterationsError
+	if errorKindOf(err) != PolicyViolation || !errors.As(err, &iterations) {
+		t.Errorf("got error %v below the minimum iterations", err)
+	}
+
+	if _, _, _, err := Decode([]byte("not a PKCS#12 file"), "password"); errorKindOf(err) != Malformed {
+		t.Errorf("got error %v for malformed input", err)
+	}
+
+	_, otherKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Encode(rand.Reader, otherKey, cert, nil, "password"); errorKindOf(err) != InvalidInput {
+		t.Errorf("got error %v for a key of another algorithm", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := Encode(rand.Reader, key, cert, nil, "password", WithEncodeContext(ctx)); errorKindOf(err) != Canceled {
+		t.Errorf("got error %v with a canceled context", err)
+	}
+}
+
+func TestTrustStore(t *testing.T) {
+	_, cert := newTestCertificate(t)
+	pfxData, err := EncodeTrustStore(rand.Reader, []*x509.Certificate{cert}, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	certs, err := DecodeTrustStore(pfxData, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(certs) != 1 || !certs[0].Equal(cert) {
+		t.Error("decoded trust store does not match")
+	}
+}
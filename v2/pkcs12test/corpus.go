@@ -0,0 +1,92 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package pkcs12test provides a corpus of malformed and unusual PKCS#12
+// files for testing code which decodes them.  It is kept apart from package
+// pkcs12 so that the files are embedded only in the binaries which import
+// it, such as test binaries.
+package pkcs12test
+
+import (
+	"embed"
+	"fmt"
+)
+
+//go:embed testdata/malformed
+var malformedFiles embed.FS
+
+// A CorpusEntry is a file of the regression corpus returned by
+// MalformedCorpus.
+type CorpusEntry struct {
+	// Name identifies the entry; it is the name of its file under
+	// testdata/malformed.
+	Name string
+
+	// Description explains what is unusual about the file.
+	Description string
+
+	Data     []byte
+	Password string
+}
+
+// malformedCorpus describes the files under testdata/malformed.  They are
+// synthetic reproductions, with throwaway keys, of oddities found by fuzzing
+// and in files from the field.
+var malformedCorpus = []struct {
+	name, description, password string
+}{
+	{"truncated", "a file cut short inside the encrypted certificates", "password"},
+	{"trailing-garbage", "bytes following the PFX", "password"},
+	{"wrong-version", "a PFX version other than 3", "password"},
+	{"oversized-length", "a PFX header claiming a length of 4 GiB", "password"},
+	{"no-mac", "no MacData and no signature", "password"},
+	{"trailing-zero-padding", "zero bytes following the SafeBags of a SafeContents", "password"},
+	{"nss-empty-safecontents", "an additional empty SafeContents, as written by NSS pk12util", "password"},
+	{"encrypteddata-version-2", "an EncryptedData of version 2", "password"},
+	{"vendor-contentinfo", "a vendor ContentInfo appended to the authenticated safe", "password"},
+	{"string-localkeyid", "a localKeyId encoded as a PrintableString", "password"},
+	{"duplicate-key-bags", "the same key bag stored twice", "password"},
+	{"unknown-bag-type", "a secretBag, which this package does not interpret", "password"},
+	{"empty-password", "a file protected with the empty password", ""},
+}
+
+// MalformedCorpus returns the regression corpus of malformed and unusual
+// PKCS#12 files which package pkcs12 is tested against.  Some of them decode,
+// possibly only with lenient options, and others must be rejected, but
+// none may cause a panic or a hang.
+func MalformedCorpus() []CorpusEntry {
+	entries := make([]CorpusEntry, len(malformedCorpus))
+	for i, file := range malformedCorpus {
+		data, err := malformedFiles.ReadFile("testdata/malformed/" + file.name)
+		if err != nil {
+			panic("pkcs12test: corpus file missing: " + err.Error())
+		}
+		entries[i] = CorpusEntry{Name: file.name, Description: file.description, Data: data, Password: file.password}
+	}
+	return entries
+}
+
+// ReplayCorpus calls decode with the data and password of each entry of
+// MalformedCorpus, so that integrators can check that code wrapping
+// package pkcs12 tolerates the same inputs.  Errors returned by decode are
+// expected and ignored; ReplayCorpus returns an error naming the first
+// entry for which decode panicked.
+func ReplayCorpus(decode func(data []byte, password string) error) error {
+	for _, entry := range MalformedCorpus() {
+		if err := replayEntry(entry, decode); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func replayEntry(entry CorpusEntry, decode func(data []byte, password string) error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("pkcs12test: corpus entry %s (%s) caused a panic: %v", entry.Name, entry.Description, r)
+		}
+	}()
+	decode(entry.Data, entry.Password)
+	return nil
+}
@@ -0,0 +1,62 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkcs12test
+
+import (
+	"io/fs"
+	"strings"
+	"testing"
+
+	"github.com/scholar-ink/go-pkcs12/v2"
+)
+
+func TestMalformedCorpus(t *testing.T) {
+	files, err := fs.ReadDir(malformedFiles, "testdata/malformed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := MalformedCorpus()
+	if len(files) != len(entries) {
+		t.Errorf("testdata/malformed has %d files, but %d are described", len(files), len(entries))
+	}
+
+	// Whether each entry decodes without options and with every leniency
+	// option.
+	decodes := map[string][2]bool{
+		"trailing-zero-padding":   {false, true},
+		"nss-empty-safecontents":  {true, true},
+		"encrypteddata-version-2": {false, true},
+		"vendor-contentinfo":      {false, true},
+		"string-localkeyid":       {true, true},
+		"unknown-bag-type":        {true, true},
+		"empty-password":          {true, true},
+	}
+	lenient := []pkcs12.DecodeOption{
+		pkcs12.WithTrailingZeroPadding(true),
+		pkcs12.WithLenientEncryptedData(nil),
+		pkcs12.WithExtensions(func(pkcs12.Extension) {}),
+	}
+	for _, entry := range entries {
+		for i, opts := range [][]pkcs12.DecodeOption{nil, lenient} {
+			_, _, _, err := pkcs12.Decode(entry.Data, entry.Password, opts...)
+			if want := decodes[entry.Name][i]; (err == nil) != want {
+				t.Errorf("%s: options %d: got error %v, want success %v", entry.Name, i, err, want)
+			}
+		}
+	}
+
+	if err := ReplayCorpus(func(data []byte, password string) error {
+		pkcs12.FuzzDecode(data, password)
+		return nil
+	}); err != nil {
+		t.Error(err)
+	}
+	err = ReplayCorpus(func(data []byte, password string) error {
+		panic("boom")
+	})
+	if err == nil || !strings.Contains(err.Error(), "truncated") {
+		t.Errorf("got error %v, want a panic in the first entry", err)
+	}
+}
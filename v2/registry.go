@@ -0,0 +1,90 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkcs12
+
+import (
+	"crypto/elliptic"
+	"encoding/asn1"
+
+	"github.com/scholar-ink/go-pkcs12/v2/internal/core"
+)
+
+// The functions of this file act on the whole process, and so on both
+// versions of this package.
+
+// RegisterGOST makes the primitives of g available to every decoding
+// function, replacing any registered before.  It is intended to be called
+// during program initialization with implementations from a third-party
+// package.
+func RegisterGOST(g GOST) {
+	core.RegisterGOST(g)
+}
+
+// RegisterKeyDerivationFunction makes kdf available to every decoding
+// function, and to encoding functions given WithKeyDerivationFunction, as
+// the PBES2 key derivation function identified by oid, replacing any
+// registered before.  PBKDF2 and scrypt are built in and cannot be
+// replaced.  It is intended to be called during program initialization.
+func RegisterKeyDerivationFunction(oid asn1.ObjectIdentifier, kdf KeyDerivationFunction) {
+	core.RegisterKeyDerivationFunction(oid, kdf)
+}
+
+// RegisterPBEScheme makes scheme available to every decoding function, and
+// to encoding functions given WithPBEScheme, as the PBES2 encryption scheme
+// identified by oid, replacing any registered before.  The built-in
+// schemes, such as AES-CBC, cannot be replaced.  It is intended to be
+// called during program initialization.
+func RegisterPBEScheme(oid asn1.ObjectIdentifier, scheme PBEScheme) {
+	core.RegisterPBEScheme(oid, scheme)
+}
+
+// DisableLegacyEncoding prevents every encoding function, including those
+// given WithProfile(Legacy), from producing output protected with weak
+// algorithms such as 40-bit RC2.  Subsequent attempts to do so fail with a
+// PolicyViolation wrapping ErrLegacyEncodingDisabled.  It is intended to be
+// called during program initialization by applications which must
+// guarantee that no code path produces weak output, and cannot be undone.
+func DisableLegacyEncoding() {
+	core.DisableLegacyEncoding()
+}
+
+// Secp256k1 returns the secp256k1 curve of SEC 2, which is used by Bitcoin
+// and Ethereum and is not in the standard library.  Like
+// elliptic.CurveParams, its implementation is not constant-time; it is
+// meant for moving keys between PKCS#12 files and blockchain tooling, not
+// for signing with them.
+//
+// An ECDSA key on secp256k1 is a *ecdsa.PrivateKey with this Curve.  Its D
+// is the raw scalar, from which the key types of other packages can be
+// built, such as with crypto.ToECDSA of go-ethereum or
+// secp256k1.PrivKeyFromBytes of dcrd.  The encoding functions accept such
+// keys, and the decoding functions return them with WithSecp256k1(true).
+func Secp256k1() elliptic.Curve {
+	return core.Secp256k1()
+}
+
+// GOST holds implementations of the Russian GOST primitives, which this
+// package does not include, for decoding key containers that follow
+// RFC 9548, such as those exported by CryptoPro CSP.  Such files are
+// authenticated with HMAC using the 512-bit GOST R 34.11-2012 (Streebog)
+// hash, keyed by PBKDF2 rather than the PKCS#12 key derivation, and
+// encrypted with PBES2, using PBKDF2 with the same HMAC, and the
+// GOST R 34.12-2015 Kuznyechik or Magma cipher in CTR-ACPKM mode
+// (RFC 8645).
+//
+// A nil field leaves files which need it failing with a
+// NotImplementedError, as they do when no GOST is registered.
+type GOST = core.GOST
+
+// A KeyDerivationFunction is a PBES2 key derivation function which is not
+// built into this package, such as Argon2id under a private object
+// identifier, for files which are only produced and read by applications
+// that register it.  Its implementations must be safe for concurrent use.
+type KeyDerivationFunction = core.KeyDerivationFunction
+
+// A PBEScheme is a PBES2 encryption scheme which is not built into this
+// package, such as a proprietary or national block cipher, used in CBC
+// mode with the padding of RFC 8018, section 6.1.1.
+type PBEScheme = core.PBEScheme
@@ -0,0 +1,114 @@
+// Copyright 2015, 2018, 2019 Opsmate, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkcs12
+
+import (
+	"crypto/x509"
+	"io"
+
+	"github.com/scholar-ink/go-pkcs12/v2/internal/core"
+)
+
+// DecodeTrustStore extracts the certificates from pfxData, which must be a
+// PKCS#12 file containing exclusively certificates with no associated
+// private keys, such as a Java trust store.  Certificates are returned in
+// the order in which they appear in the file; duplicates are handled
+// according to the policy of WithDuplicateCertificates.  CRL bags are
+// skipped; use DecodeTrustStoreWithCRLs to obtain them.
+func DecodeTrustStore(pfxData []byte, password string, opts ...DecodeOption) ([]*x509.Certificate, error) {
+	certs, err := newDecoder(opts).DecodeTrustStore(pfxData, password)
+	return certs, decodeError("decode trust store", err)
+}
+
+// DecodeTrustStoreWithCRLs is like DecodeTrustStore, but also returns the
+// CRLs in pfxData, such as those embedded by EncodeTrustStoreWithCRLs, in
+// the order in which they appear.  The CRLs are parsed but not verified.
+func DecodeTrustStoreWithCRLs(pfxData []byte, password string, opts ...DecodeOption) ([]*x509.Certificate, []*x509.RevocationList, error) {
+	certs, crls, err := newDecoder(opts).DecodeTrustStoreWithCRLs(pfxData, password)
+	return certs, crls, decodeError("decode trust store", err)
+}
+
+// DecodeCertBags returns every certificate bag in pfxData, in the order in
+// which they appear.  Unlike Decode, it does not require a private key to
+// be present.
+func DecodeCertBags(pfxData []byte, password string, opts ...DecodeOption) ([]CertBag, error) {
+	bags, err := newDecoder(opts).DecodeCertBags(pfxData, password)
+	return bags, decodeError("decode certificate bags", err)
+}
+
+// EncodeTrustStore produces pfxData containing any number of CA certificates
+// (certs) to be trusted.  The certificates are marked as trusted with the
+// attribute used by Java key stores, so the output can be used as a Java
+// trust store, and carry a friendlyName equal to their subject.  rand may
+// be nil, in which case crypto/rand.Reader is used.
+func EncodeTrustStore(rand io.Reader, certs []*x509.Certificate, password string, opts ...EncodeOption) ([]byte, error) {
+	pfxData, err := newEncoder(opts).EncodeTrustStore(rand, certs, password)
+	return pfxData, encodeError("encode trust store", err)
+}
+
+// EncodeTrustStoreWithCRLs is like EncodeTrustStore, but also embeds the
+// current CRL of some or all of the CAs, so that systems without network
+// access receive revocation information together with the trust anchors.
+// Each CRL must be signed by one of certs, and no CA may have more than one
+// CRL.  The CRLs are stored in CRL bags carrying the same friendlyName as
+// the certificate of their issuer.
+func EncodeTrustStoreWithCRLs(rand io.Reader, certs []*x509.Certificate, crls []*x509.RevocationList, password string, opts ...EncodeOption) ([]byte, error) {
+	pfxData, err := newEncoder(opts).EncodeTrustStoreWithCRLs(rand, certs, crls, password)
+	return pfxData, encodeError("encode trust store", err)
+}
+
+// ApplyTrustDelta returns a copy of the trust store base, decoded strictly
+// with password, in which the certificates of remove are removed and those
+// of add are added, protected with password.  It is intended for pipelines
+// which periodically refresh a CA bundle.
+//
+// Entries which are kept, including CRL bags, retain their bags exactly as
+// they appear in base, attributes and all, and keep their order, except
+// that compressed bags are stored decompressed unless WithBagCompression is
+// given.  The certificates of add follow them, marked as trusted and named
+// as EncodeTrustStore does; a certificate which is already in the result is
+// not added again.  Certificates of remove which are not in base are
+// ignored.  base must not contain private keys.
+func ApplyTrustDelta(rand io.Reader, base []byte, add, remove []*x509.Certificate, password string, opts ...EncodeOption) ([]byte, error) {
+	pfxData, err := newEncoder(opts).ApplyTrustDelta(rand, base, add, remove, password)
+	return pfxData, encodeError("apply trust delta", err)
+}
+
+// EncodeEmpty produces pfxData containing no keys or certificates, for use
+// as a placeholder which is later replaced by a real identity or trust
+// store.  The file has an empty AuthenticatedSafe protected by a MAC, so
+// password can still be verified.
+func EncodeEmpty(rand io.Reader, password string, opts ...EncodeOption) ([]byte, error) {
+	pfxData, err := newEncoder(opts).EncodeEmpty(rand, password)
+	return pfxData, encodeError("encode empty file", err)
+}
+
+// A DuplicatePolicy specifies how decoding handles a certificate which
+// appears more than once in a file, possibly with different attributes.
+// Certificates are duplicates if their DER encodings are identical.
+type DuplicatePolicy = core.DuplicatePolicy
+
+const (
+	// DeduplicateCertificates keeps only the first occurrence of each
+	// certificate.  It is the default.
+	DeduplicateCertificates = core.DeduplicateCertificates
+
+	// KeepDuplicateCertificates returns every occurrence of each
+	// certificate.
+	KeepDuplicateCertificates = core.KeepDuplicateCertificates
+
+	// RejectDuplicateCertificates fails decoding with
+	// ErrDuplicateCertificate.
+	RejectDuplicateCertificates = core.RejectDuplicateCertificates
+)
+
+// A CertBag is a certificate bag decoded from a PKCS#12 file.
+type CertBag = core.CertBag
+
+// A CertificateAnnotator enriches each certificate decoded by
+// DecodeCertBags with caller-defined metadata, such as certificate
+// transparency lookup results or inventory identifiers, which is stored in
+// CertBag.Annotation.  Returning an error aborts decoding with that error.
+type CertificateAnnotator = core.CertificateAnnotator